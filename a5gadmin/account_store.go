@@ -0,0 +1,185 @@
+package a5gadmin
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryAccountStore struct {
+	mu       sync.Mutex
+	accounts []Account
+	keys     map[string]APIKey
+}
+
+func NewMemoryAccountStore() AccountStore {
+	return &memoryAccountStore{keys: make(map[string]APIKey)}
+}
+
+func (s *memoryAccountStore) CreateAccount(name string, at time.Time) (
+	*Account, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range s.accounts {
+		if a.Name == name {
+			return &a, false, nil
+		}
+	}
+	a := Account{ID: uint64(len(s.accounts) + 1), Name: name, CreatedAt: at}
+	s.accounts = append(s.accounts, a)
+	return &a, true, nil
+}
+
+func (s *memoryAccountStore) AddAPIKey(k *APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[k.ID]; ok {
+		return errors.Errorf("duplicate api key %q", k.ID)
+	}
+	s.keys[k.ID] = *k
+	return nil
+}
+
+func (s *memoryAccountStore) APIKey(id string) (*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[id]
+	if !ok {
+		return nil, errors.Wrap(ErrAPIKeyInvalid, id)
+	}
+	return &k, nil
+}
+
+func (s *memoryAccountStore) Account(id uint64) (*Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id == 0 || id > uint64(len(s.accounts)) {
+		return nil, errors.Wrap(ErrAccountUnknown, strconv.FormatUint(id, 10))
+	}
+	a := s.accounts[id-1]
+	return &a, nil
+}
+
+// dbAccountStore keeps accounts and keys in MySQL tables:
+//
+//	CREATE TABLE admin_accounts (
+//	  id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+//	  name VARCHAR(64) NOT NULL,
+//	  created_at BIGINT NOT NULL,
+//	  UNIQUE KEY name (name));
+//
+//	CREATE TABLE admin_api_keys (
+//	  id VARCHAR(16) NOT NULL PRIMARY KEY,
+//	  account_id BIGINT UNSIGNED NOT NULL,
+//	  hash CHAR(64) NOT NULL,
+//	  created_at BIGINT NOT NULL,
+//	  KEY account_id (account_id));
+type dbAccountStore struct {
+	pooler            a5gdb.Pooler
+	accountsTableName string
+	keysTableName     string
+}
+
+type dbAccount struct {
+	ID        uint64 `db:"id"`
+	Name      string `db:"name"`
+	CreatedAt int64  `db:"created_at"`
+}
+
+type dbAPIKey struct {
+	ID        string `db:"id"`
+	AccountID uint64 `db:"account_id"`
+	Hash      string `db:"hash"`
+	CreatedAt int64  `db:"created_at"`
+}
+
+func NewDBAccountStore(
+	p a5gdb.Pooler, accountsTableName, keysTableName string) (AccountStore, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if accountsTableName == "" || keysTableName == "" {
+		return nil, errors.New("empty admin accounts table name")
+	}
+	return &dbAccountStore{
+		pooler:            p,
+		accountsTableName: accountsTableName,
+		keysTableName:     keysTableName}, nil
+}
+
+func (s *dbAccountStore) CreateAccount(name string, at time.Time) (
+	*Account, bool, error) {
+	sess := s.pooler.WritePool().NewSession()
+	res, err := sess.InsertBySql("INSERT IGNORE INTO "+s.accountsTableName+
+		" (name, created_at) VALUES (?, ?)", name, at.UnixNano()).Exec()
+	if err != nil {
+		return nil, false, errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, false, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	x := new(dbAccount)
+	err = sess.Select("id", "name", "created_at").From(s.accountsTableName).
+		Where(dbr.Eq("name", name)).LoadOne(x)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	return x.account(), n == 1, nil
+}
+
+func (s *dbAccountStore) AddAPIKey(k *APIKey) error {
+	_, err := s.pooler.WritePool().NewSession().
+		InsertInto(s.keysTableName).
+		Pair("id", k.ID).
+		Pair("account_id", k.AccountID).
+		Pair("hash", k.Hash).
+		Pair("created_at", k.CreatedAt.UnixNano()).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	return nil
+}
+
+func (s *dbAccountStore) APIKey(id string) (*APIKey, error) {
+	x := new(dbAPIKey)
+	err := s.pooler.ReadPool().NewSession().
+		Select("id", "account_id", "hash", "created_at").
+		From(s.keysTableName).Where(dbr.Eq("id", id)).LoadOne(x)
+	if err == dbr.ErrNotFound {
+		return nil, errors.Wrap(ErrAPIKeyInvalid, id)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	return &APIKey{
+		ID:        x.ID,
+		AccountID: x.AccountID,
+		Hash:      x.Hash,
+		CreatedAt: time.Unix(0, x.CreatedAt).UTC()}, nil
+}
+
+func (s *dbAccountStore) Account(id uint64) (*Account, error) {
+	x := new(dbAccount)
+	err := s.pooler.ReadPool().NewSession().
+		Select("id", "name", "created_at").
+		From(s.accountsTableName).Where(dbr.Eq("id", id)).LoadOne(x)
+	if err == dbr.ErrNotFound {
+		return nil, errors.Wrap(ErrAccountUnknown, strconv.FormatUint(id, 10))
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	return x.account(), nil
+}
+
+func (x *dbAccount) account() *Account {
+	return &Account{
+		ID:        x.ID,
+		Name:      x.Name,
+		CreatedAt: time.Unix(0, x.CreatedAt).UTC()}
+}
@@ -0,0 +1,169 @@
+package a5gadmin
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrAccountUnknown = errors.New("unknown admin account")
+	ErrAPIKeyInvalid  = errors.New("invalid api key")
+)
+
+var ErrCodeAPIKeyInvalid = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+	Code:     4013,
+	Name:     "admin_api_key_invalid",
+	Severity: a5gapi.ErrSeverityWarn,
+	Public:   true,
+	Message:  "invalid api key"})
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeAPIKeyInvalid, http.StatusUnauthorized)
+}
+
+// Account is an operator of the console; its tools authenticate with API
+// keys.
+type Account struct {
+	ID        uint64    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// APIKey is stored by the SHA-256 of its secret only; the key handed out
+// is "<ID>.<secret>".
+type APIKey struct {
+	ID        string    `json:"id"`
+	AccountID uint64    `json:"accountId"`
+	Hash      string    `json:"-"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// AccountStore keeps accounts and their keys. CreateAccount returns the
+// account of name, created reports whether it did not exist yet.
+type AccountStore interface {
+	CreateAccount(name string, at time.Time) (a *Account, created bool, err error)
+	AddAPIKey(k *APIKey) error
+	APIKey(id string) (*APIKey, error)
+	Account(id uint64) (*Account, error)
+}
+
+type Accounts struct {
+	Store  AccountStore
+	Logger a5glogs.Logger
+
+	now func() time.Time
+}
+
+func NewAccounts(s AccountStore, l a5glogs.Logger) (*Accounts, error) {
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Accounts{Store: s, Logger: l, now: time.Now}, nil
+}
+
+// Ensure creates the account of name with an API key when missing. The
+// key is only returned on creation, an existing account keeps its keys.
+func (a *Accounts) Ensure(name string) (*Account, string, error) {
+	if name == "" {
+		return nil, "", errors.New("empty admin account name")
+	}
+	x, created, err := a.Store.CreateAccount(name, a.now().UTC())
+	if err != nil || !created {
+		return x, "", err
+	}
+	key, err := a.AddAPIKey(x.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	a.Logger.With(a5gfields.String("admin", name)).Info("admin account created")
+	return x, key, nil
+}
+
+// AddAPIKey creates a key of account and returns it; it is not kept and
+// can not be shown again.
+func (a *Accounts) AddAPIKey(accountID uint64) (string, error) {
+	b := make([]byte, 40)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.WithStack(err)
+	}
+	id, secret := hex.EncodeToString(b[:8]), hex.EncodeToString(b[8:])
+	err := a.Store.AddAPIKey(&APIKey{
+		ID:        id,
+		AccountID: accountID,
+		Hash:      hashSecret(secret),
+		CreatedAt: a.now().UTC()})
+	if err != nil {
+		return "", err
+	}
+	return id + "." + secret, nil
+}
+
+// Authenticate returns the account of key.
+func (a *Accounts) Authenticate(key string) (*Account, error) {
+	i := strings.Index(key, ".")
+	if i <= 0 {
+		return nil, errors.WithStack(ErrAPIKeyInvalid)
+	}
+	k, err := a.Store.APIKey(key[:i])
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(
+		[]byte(k.Hash), []byte(hashSecret(key[i+1:]))) != 1 {
+		return nil, errors.WithStack(ErrAPIKeyInvalid)
+	}
+	return a.Store.Account(k.AccountID)
+}
+
+func hashSecret(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+type ctxKey int
+
+const ctxKeyAccount ctxKey = iota
+
+func AccountFromContext(ctx context.Context) (*Account, bool) {
+	a, ok := ctx.Value(ctxKeyAccount).(*Account)
+	return a, ok && a != nil
+}
+
+// Middleware authenticates the "X-API-Key" header and injects the
+// account into the request context, mount it on admin routes; requests
+// without a valid key are answered with a 401 a5gapi envelope.
+func (a *Accounts) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		x, err := a.Authenticate(r.Header.Get("X-API-Key"))
+		if err != nil {
+			switch errors.Cause(err) {
+			case ErrAPIKeyInvalid, ErrAccountUnknown:
+				a.Logger.With(a5gfields.String("uri", r.RequestURI)).Debug(err.Error())
+			default:
+				a.Logger.Error(err.Error())
+			}
+			err = a5ghttp.WriteErrResponse(w, r, nil, a5gapi.NewErr(ErrCodeAPIKeyInvalid, ""))
+			if err != nil {
+				a.Logger.Error(err.Error())
+			}
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(
+			context.WithValue(r.Context(), ctxKeyAccount, x)))
+	})
+}
@@ -0,0 +1,174 @@
+// Package a5gadmin is the backend of the live ops console: aggregated
+// KPIs, searchable tables with server-side sorting and filtering, and
+// exports of tables run as a5gjobs jobs whose progress the console polls.
+package a5gadmin
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gcursor"
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5gjobs"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrKPIUnknown    = errors.New("kpi unknown")
+	ErrTableUnknown  = errors.New("table unknown")
+	ErrExportUnknown = errors.New("export unknown")
+	ErrQueryInvalid  = errors.New("table query invalid")
+)
+
+// KPIFunc aggregates a KPI over [from, to), e.g. revenue or daily active
+// players from the service's own tables.
+type KPIFunc func(ctx context.Context, from, to time.Time) (float64, error)
+
+// KPIValue is a KPI over the requested period and the equally long one
+// before it. Change is relative to Previous and zero without it; a KPI
+// which failed has Error set and does not fail the others.
+type KPIValue struct {
+	Name     string  `json:"name"`
+	Value    float64 `json:"value"`
+	Previous float64 `json:"previous"`
+	Change   float64 `json:"change"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// Console serves KPIs and tables registered by the service and exports
+// tables through Jobs into Sink, recording their progress in Exports.
+type Console struct {
+	Cursors *a5gcursor.Cursors
+	Limits  a5gcursor.PageLimits
+	Logger  a5glogs.Logger
+	Jobs    a5gjobs.Storer
+	Exports ExportStore
+	Sink    Sink
+	// BatchSize is the page size exports read tables with.
+	BatchSize int
+
+	mu     sync.RWMutex
+	kpis   map[string]KPIFunc
+	tables map[string]Table
+	now    func() time.Time
+}
+
+func NewConsole(c *a5gcursor.Cursors, l a5glogs.Logger) (*Console, error) {
+	if c == nil {
+		return nil, errors.New("cursors missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Console{
+		Cursors:   c,
+		Limits:    a5gcursor.PageLimits{Default: 50, Max: 500},
+		Logger:    l,
+		BatchSize: 1000,
+		kpis:      make(map[string]KPIFunc),
+		tables:    make(map[string]Table),
+		now:       time.Now}, nil
+}
+
+func (c *Console) HandleKPI(name string, fn KPIFunc) error {
+	if name == "" || fn == nil {
+		return errors.New("incomplete kpi")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.kpis[name]; ok {
+		return errors.Errorf("kpi %q already registered", name)
+	}
+	c.kpis[name] = fn
+	return nil
+}
+
+func (c *Console) HandleTable(name string, t Table) error {
+	if !exportName.MatchString(name) || t == nil {
+		return errors.Errorf("invalid table %q", name)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.tables[name]; ok {
+		return errors.Errorf("table %q already registered", name)
+	}
+	c.tables[name] = t
+	return nil
+}
+
+// KPINames lists registered KPIs in name order.
+func (c *Console) KPINames() []string {
+	c.mu.RLock()
+	a := make([]string, 0, len(c.kpis))
+	for k := range c.kpis {
+		a = append(a, k)
+	}
+	c.mu.RUnlock()
+	sort.Strings(a)
+	return a
+}
+
+func (c *Console) table(name string) (Table, error) {
+	c.mu.RLock()
+	t, ok := c.tables[name]
+	c.mu.RUnlock()
+	if !ok {
+		return nil, errors.Wrap(ErrTableUnknown, name)
+	}
+	return t, nil
+}
+
+// KPIs aggregates KPIs of names, every registered one without names,
+// over [from, to) and the period before it.
+func (c *Console) KPIs(ctx context.Context, names []string, from, to time.Time) (
+	[]*KPIValue, error) {
+	if !from.Before(to) {
+		return nil, errors.Wrap(ErrQueryInvalid, "empty kpi period")
+	}
+	if len(names) == 0 {
+		names = c.KPINames()
+	}
+	fns := make([]KPIFunc, len(names))
+	c.mu.RLock()
+	for i, name := range names {
+		fns[i] = c.kpis[name]
+	}
+	c.mu.RUnlock()
+	for i, fn := range fns {
+		if fn == nil {
+			return nil, errors.Wrap(ErrKPIUnknown, names[i])
+		}
+	}
+	a := make([]*KPIValue, len(names))
+	var wg sync.WaitGroup
+	for i := range names {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			a[i] = c.kpi(ctx, names[i], fns[i], from, to)
+		}(i)
+	}
+	wg.Wait()
+	return a, nil
+}
+
+func (c *Console) kpi(ctx context.Context, name string, fn KPIFunc,
+	from, to time.Time) *KPIValue {
+	v := &KPIValue{Name: name}
+	var err error
+	if v.Value, err = fn(ctx, from, to); err == nil {
+		v.Previous, err = fn(ctx, from.Add(-to.Sub(from)), from)
+	}
+	if err != nil {
+		c.Logger.With(a5gfields.String("kpi", name)).Error(err.Error())
+		return &KPIValue{Name: name, Error: err.Error()}
+	}
+	if v.Previous != 0 {
+		v.Change = (v.Value - v.Previous) / math.Abs(v.Previous)
+	}
+	return v
+}
@@ -0,0 +1,259 @@
+package a5gadmin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5gcursor"
+	"github.com/armor5games/a5g/a5gjobs"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+type buffer struct{ bytes.Buffer }
+
+func (b *buffer) Close() error { return nil }
+
+type memorySink map[string]*buffer
+
+func (s memorySink) Create(name string) (io.WriteCloser, error) {
+	s[name] = new(buffer)
+	return s[name], nil
+}
+
+func newTestConsole(t *testing.T) *Console {
+	cursors, err := a5gcursor.NewCursors([]byte(strings.Repeat("k", 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewConsole(cursors, a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	players, err := NewSliceTable([]*Column{
+		{Name: "id", Sortable: true, Filterable: true},
+		{Name: "name", Searchable: true},
+		{Name: "level", Sortable: true, Filterable: true},
+		{Name: "country", Filterable: true}},
+		func(context.Context) ([]Row, error) {
+			return []Row{
+				{"id": uint64(1), "name": "Alice", "level": int64(12), "country": "de"},
+				{"id": uint64(2), "name": "Bob", "level": int64(3), "country": "us"},
+				{"id": uint64(3), "name": "Carol", "level": int64(30), "country": "de"},
+				{"id": uint64(4), "name": "alina", "level": int64(7), "country": "fr"},
+				{"id": uint64(5), "name": "Dave", "level": int64(12), "country": "de"},
+			}, nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.HandleTable("players", players); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestKPIs(t *testing.T) {
+	c := newTestConsole(t)
+	day := 24 * time.Hour
+	t0 := time.Unix(0, 0).Add(10 * day)
+	// Revenue is the day number, so a later period earns more.
+	revenue := func(_ context.Context, from, to time.Time) (float64, error) {
+		return float64(from.Sub(time.Unix(0, 0))/day + to.Sub(time.Unix(0, 0))/day), nil
+	}
+	if err := c.HandleKPI("revenue", revenue); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.HandleKPI("revenue", revenue); err == nil {
+		t.Error("registered a kpi twice")
+	}
+	err := c.HandleKPI("dau", func(context.Context, time.Time, time.Time) (float64, error) {
+		return 0, errors.New("warehouse down")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := c.KPIs(context.Background(), nil, t0, t0.Add(2*day))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != 2 || a[0].Name != "dau" || a[0].Error == "" ||
+		*a[1] != (KPIValue{Name: "revenue", Value: 22, Previous: 18, Change: 4.0 / 18}) {
+		t.Errorf("unexpected kpis %+v %+v", a[0], a[1])
+	}
+	if _, err = c.KPIs(context.Background(), []string{"arpu"}, t0, t0.Add(day)); errors.Cause(err) != ErrKPIUnknown {
+		t.Errorf("KPIs() => %v want %v", err, ErrKPIUnknown)
+	}
+	if _, err = c.KPIs(context.Background(), nil, t0, t0); errors.Cause(err) != ErrQueryInvalid {
+		t.Errorf("KPIs() => %v want %v", err, ErrQueryInvalid)
+	}
+}
+
+func TestTableHandler(t *testing.T) {
+	c := newTestConsole(t)
+	h := c.TableHandler()
+	tests := []struct {
+		name  string
+		query string
+		ids   []string
+		code  a5gapi.APIErrCode
+	}{
+		{"all", `{"table": "players"}`, []string{"1 2 3", "4 5"}, 0},
+		{"sorted", `{"table": "players", "sort": "level", "desc": true}`,
+			[]string{"3 1 5", "4 2"}, 0},
+		{"filtered", `{"table": "players", "filters": [
+			{"column": "country", "op": "in", "value": ["de", "fr"]},
+			{"column": "level", "op": "gte", "value": 10}]}`, []string{"1 3 5"}, 0},
+		{"search", `{"table": "players", "search": "ali"}`, []string{"1 4"}, 0},
+		{"unsortable", `{"table": "players", "sort": "name"}`, nil, ErrCodeQueryInvalid},
+		{"bad op", `{"table": "players", "filters": [
+			{"column": "level", "op": "gt", "value": [1]}]}`, nil, ErrCodeQueryInvalid},
+		{"unknown", `{"table": "clans"}`, nil, ErrCodeUnknown},
+	}
+	for _, x := range tests {
+		raw := json.RawMessage(x.query)
+		req := &a5gapi.APIMsgRequest{Payload: &raw, Page: &a5gapi.PageRequest{Limit: 3}}
+		var pages []string
+		for {
+			v, errs := h(context.Background(), req)
+			if x.code != 0 {
+				if len(errs) != 1 || errs[0].Code != uint64(x.code) {
+					t.Errorf("%s: unexpected errors %v", x.name, errs)
+				}
+				break
+			}
+			if len(errs) != 0 {
+				t.Fatalf("%s: %v", x.name, errs)
+			}
+			items, page := a5gapi.UnwrapPaged(v)
+			rows, ok := items.([]Row)
+			if !ok {
+				t.Fatalf("%s: unexpected items %T", x.name, items)
+			}
+			var ids []string
+			for _, r := range rows {
+				ids = append(ids, cell(r["id"]))
+			}
+			pages = append(pages, strings.Join(ids, " "))
+			if !page.HasMore {
+				break
+			}
+			req.Page.Cursor = page.Cursor
+		}
+		if x.code == 0 && strings.Join(pages, "|") != strings.Join(x.ids, "|") {
+			t.Errorf("%s: pages %q want %q", x.name, pages, x.ids)
+		}
+	}
+
+	// A cursor is bound to its query.
+	raw := json.RawMessage(`{"table": "players"}`)
+	v, _ := h(context.Background(), &a5gapi.APIMsgRequest{Payload: &raw,
+		Page: &a5gapi.PageRequest{Limit: 1}})
+	_, page := a5gapi.UnwrapPaged(v)
+	raw = json.RawMessage(`{"table": "players", "sort": "level"}`)
+	_, errs := h(context.Background(), &a5gapi.APIMsgRequest{Payload: &raw,
+		Page: &a5gapi.PageRequest{Limit: 1, Cursor: page.Cursor}})
+	if len(errs) != 1 || errs[0].Code != uint64(a5gcursor.ErrCodeCursorInvalid) {
+		t.Errorf("cursor of another query: %v", errs)
+	}
+}
+
+func TestExport(t *testing.T) {
+	c := newTestConsole(t)
+	sink := make(memorySink)
+	c.Jobs, c.Exports, c.Sink, c.BatchSize = a5gjobs.NewMemoryStore(), NewMemoryStore(), sink, 2
+	if _, err := c.StartExport("players", &TableQuery{Sort: "name"}); errors.Cause(err) != ErrQueryInvalid {
+		t.Errorf("StartExport() => %v want %v", err, ErrQueryInvalid)
+	}
+	e, err := c.StartExport("players", &TableQuery{Filters: []*Filter{
+		{Column: "country", Op: OpEq, Value: "de"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Status != ExportQueued || e.Progress() != 0 {
+		t.Errorf("unexpected export %+v", e)
+	}
+
+	// Progress is stored after every full batch.
+	var progress []float64
+	c.Exports = &progressStore{ExportStore: c.Exports, progress: &progress}
+	j, err := c.Jobs.Acquire(time.Now().Add(time.Second), time.Minute)
+	if err != nil || j == nil {
+		t.Fatalf("Acquire() => %v, %v", j, err)
+	}
+	if err = c.JobHandler()(context.Background(), j); err != nil {
+		t.Fatal(err)
+	}
+	if e, err = c.Export(e.ID); err != nil {
+		t.Fatal(err)
+	}
+	if e.Status != ExportDone || e.Rows != 3 || e.Total != 3 || e.Progress() != 1 {
+		t.Errorf("unexpected export %+v", e)
+	}
+	if len(progress) != 2 || progress[0] != 2.0/3 || progress[1] != 1 {
+		t.Errorf("unexpected progress %v", progress)
+	}
+	want := "id,name,level,country\n1,Alice,12,de\n3,Carol,30,de\n5,Dave,12,de\n"
+	if got := sink[e.ID].String(); got != want {
+		t.Errorf("export %q want %q", got, want)
+	}
+	if _, err = c.Export("x"); errors.Cause(err) != ErrExportUnknown {
+		t.Errorf("Export() => %v want %v", err, ErrExportUnknown)
+	}
+}
+
+type progressStore struct {
+	ExportStore
+	progress *[]float64
+}
+
+func (s *progressStore) Put(e *Export) error {
+	*s.progress = append(*s.progress, e.Progress())
+	return s.ExportStore.Put(e)
+}
+
+func TestAccounts(t *testing.T) {
+	a, err := NewAccounts(NewMemoryAccountStore(), a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, key, err := a.Ensure("ops")
+	if err != nil || key == "" {
+		t.Fatalf("Ensure() => %+v, %q, %v", x, key, err)
+	}
+	h := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if x, ok := AccountFromContext(r.Context()); !ok || x.Name != "ops" {
+			t.Errorf("unexpected account %+v", x)
+		}
+	}))
+	tests := []struct {
+		key  string
+		code int
+	}{
+		{key, http.StatusOK},
+		{key[:len(key)-1] + "x", http.StatusUnauthorized},
+		{"x." + key[strings.Index(key, ".")+1:], http.StatusUnauthorized},
+		{"", http.StatusUnauthorized},
+	}
+	for _, x := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/admin/tables", nil)
+		r.Header.Set("X-API-Key", x.key)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != x.code {
+			t.Errorf("%q: status %d want %d", x.key, w.Code, x.code)
+		}
+	}
+	if _, key, err = a.Ensure("ops"); err != nil || key != "" {
+		t.Errorf("Ensure() of an existing account => %q, %v", key, err)
+	}
+}
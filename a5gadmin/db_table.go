@@ -0,0 +1,140 @@
+package a5gadmin
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type dbTable struct {
+	pooler    a5gdb.Pooler
+	tableName string
+	columns   []*Column
+}
+
+// NewDBTable serves a MySQL table or view; sorting, filtering and search
+// run in the database, so sortable and filterable columns should be
+// indexed. The first column orders rows without Sort and breaks ties.
+func NewDBTable(p a5gdb.Pooler, tableName string, columns []*Column) (Table, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if tableName == "" {
+		return nil, errors.New("empty table name")
+	}
+	if len(columns) == 0 {
+		return nil, errors.New("table without columns")
+	}
+	return &dbTable{pooler: p, tableName: tableName, columns: columns}, nil
+}
+
+func (t *dbTable) Columns() []*Column { return t.columns }
+
+func (t *dbTable) Rows(ctx context.Context, q *TableQuery, offset, limit int) (
+	[]Row, int64, error) {
+	sess := t.pooler.ReadPool().NewSession()
+	names := make([]string, len(t.columns))
+	for i, c := range t.columns {
+		names[i] = c.Name
+	}
+	stmt := t.where(sess.Select(names...).From(t.tableName), q)
+	if q.Sort != "" {
+		stmt.OrderDir(q.Sort, !q.Desc)
+	}
+	stmt.OrderDir(names[0], !q.Desc).Offset(uint64(offset))
+	if limit > 0 {
+		stmt.Limit(uint64(limit))
+	}
+	rows, err := stmt.RowsContext(ctx)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "dbr.(*SelectStmt).Rows fn")
+	}
+	a, err := scan(rows)
+	if closeErr := rows.Close(); err == nil && closeErr != nil {
+		err = errors.Wrap(closeErr, "sql.(*Rows).Close fn")
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	var total int64
+	err = t.where(sess.Select("COUNT(*)").From(t.tableName), q).
+		LoadOneContext(ctx, &total)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	return a, total, nil
+}
+
+func (t *dbTable) where(stmt *dbr.SelectStmt, q *TableQuery) *dbr.SelectStmt {
+	for _, f := range q.Filters {
+		switch f.Op {
+		case OpEq, OpIn:
+			stmt.Where(dbr.Eq(f.Column, f.Value))
+		case OpNe:
+			stmt.Where(dbr.Neq(f.Column, f.Value))
+		case OpLt:
+			stmt.Where(dbr.Lt(f.Column, f.Value))
+		case OpLte:
+			stmt.Where(dbr.Lte(f.Column, f.Value))
+		case OpGt:
+			stmt.Where(dbr.Gt(f.Column, f.Value))
+		case OpGte:
+			stmt.Where(dbr.Gte(f.Column, f.Value))
+		case OpLike:
+			s, _ := f.Value.(string)
+			stmt.Where(dbr.Like(f.Column, "%"+escapeLike(s)+"%"))
+		}
+	}
+	if q.Search == "" {
+		return stmt
+	}
+	var a []dbr.Builder
+	for _, c := range t.columns {
+		if c.Searchable {
+			a = append(a, dbr.Like(c.Name, "%"+escapeLike(q.Search)+"%"))
+		}
+	}
+	if len(a) == 0 {
+		return stmt.Where("1 = 0")
+	}
+	return stmt.Where(dbr.Or(a...))
+}
+
+var likeReplacer = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func escapeLike(s string) string { return likeReplacer.Replace(s) }
+
+func scan(rows *sql.Rows) ([]Row, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.(*Rows).Columns fn")
+	}
+	a := []Row{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err = rows.Scan(ptrs...); err != nil {
+			return nil, errors.Wrap(err, "sql.(*Rows).Scan fn")
+		}
+		r := make(Row, len(columns))
+		for i, c := range columns {
+			if b, ok := values[i].([]byte); ok {
+				r[c] = string(b)
+				continue
+			}
+			r[c] = values[i]
+		}
+		a = append(a, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "sql.(*Rows).Err fn")
+	}
+	return a, nil
+}
@@ -0,0 +1,242 @@
+package a5gadmin
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5gjobs"
+	"github.com/pkg/errors"
+)
+
+// JobKind is the a5gjobs kind of exports, see Console.JobHandler.
+const JobKind = "admin_export"
+
+type ExportStatus string
+
+const (
+	ExportQueued  ExportStatus = "queued"
+	ExportRunning ExportStatus = "running"
+	ExportDone    ExportStatus = "done"
+	ExportFailed  ExportStatus = "failed"
+)
+
+func (s ExportStatus) String() string { return string(s) }
+
+// Export is a table export the console polls: Rows of Total are written
+// so far. Total is counted when the export starts and rows changing
+// meanwhile may make Rows end up apart from it.
+type Export struct {
+	ID        string       `json:"id"`
+	Table     string       `json:"table"`
+	Query     *TableQuery  `json:"query"`
+	Status    ExportStatus `json:"status"`
+	Rows      int64        `json:"rows"`
+	Total     int64        `json:"total"`
+	Error     string       `json:"error,omitempty"`
+	CreatedAt time.Time    `json:"createdAt"`
+	UpdatedAt time.Time    `json:"updatedAt"`
+}
+
+// Progress is the share of rows written, from 0 to 1.
+func (e *Export) Progress() float64 {
+	switch {
+	case e.Status == ExportDone:
+		return 1
+	case e.Total <= 0:
+		return 0
+	case e.Rows >= e.Total:
+		return 0.99
+	}
+	return float64(e.Rows) / float64(e.Total)
+}
+
+func (e *Export) MarshalJSON() ([]byte, error) {
+	type export Export
+	return json.Marshal(&struct {
+		*export
+		Progress float64 `json:"progress"`
+	}{(*export)(e), e.Progress()})
+}
+
+// ExportStore keeps exports, Put inserts or replaces by ID.
+type ExportStore interface {
+	Put(e *Export) error
+	Get(id string) (*Export, error)
+}
+
+// Sink stores exports, Create truncates an export of the same name so
+// retried jobs write it anew; a5gplayers.NewDirSink makes one.
+type Sink interface {
+	Create(name string) (io.WriteCloser, error)
+}
+
+var exportName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+type jobPayload struct {
+	ID string `json:"id"`
+}
+
+// StartExport records an export of the rows of q and enqueues its job.
+func (c *Console) StartExport(table string, q *TableQuery) (*Export, error) {
+	if c.Jobs == nil || c.Exports == nil || c.Sink == nil {
+		return nil, errors.New("exports are not configured")
+	}
+	t, err := c.table(table)
+	if err != nil {
+		return nil, err
+	}
+	if err = q.Validate(t); err != nil {
+		return nil, err
+	}
+	now := c.now().UTC()
+	e := &Export{
+		ID:        table + "-" + strconv.FormatInt(now.UnixNano(), 10),
+		Table:     table,
+		Query:     q,
+		Status:    ExportQueued,
+		CreatedAt: now,
+		UpdatedAt: now}
+	b, err := json.Marshal(&jobPayload{ID: e.ID})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	j, err := a5gjobs.NewJob(JobKind, b, a5gjobs.PriorityLow, 3)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.Exports.Put(e); err != nil {
+		return nil, err
+	}
+	if err = c.Jobs.Enqueue(j); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Export returns an export for polling.
+func (c *Console) Export(id string) (*Export, error) {
+	if c.Exports == nil {
+		return nil, errors.New("exports are not configured")
+	}
+	return c.Exports.Get(id)
+}
+
+// JobHandler runs exports of StartExport, register it on the pool of
+// Jobs. Progress is stored after every batch; a retry writes the export
+// anew and the last attempt marks it failed.
+func (c *Console) JobHandler() a5gjobs.HandlerFunc {
+	return func(ctx context.Context, j *a5gjobs.Job) error {
+		p := new(jobPayload)
+		if err := json.Unmarshal(j.Payload, p); err != nil {
+			return errors.WithStack(err)
+		}
+		e, err := c.Exports.Get(p.ID)
+		if err != nil {
+			return err
+		}
+		l := c.Logger.With(a5gfields.String("export", e.ID))
+		if err = c.export(ctx, e); err == nil {
+			e.Status, e.UpdatedAt = ExportDone, c.now().UTC()
+			if err = c.Exports.Put(e); err != nil {
+				return err
+			}
+			l.With(a5gfields.Int64("rows", e.Rows)).Info("table exported")
+			return nil
+		}
+		e.Error = err.Error()
+		if j.Attempts+1 >= j.MaxAttempts {
+			e.Status = ExportFailed
+		}
+		e.UpdatedAt = c.now().UTC()
+		if err2 := c.Exports.Put(e); err2 != nil {
+			l.Error(err2.Error())
+		}
+		return err
+	}
+}
+
+func (c *Console) export(ctx context.Context, e *Export) (err error) {
+	t, err := c.table(e.Table)
+	if err != nil {
+		return err
+	}
+	if c.BatchSize <= 0 {
+		return errors.New("unexpected export batch size")
+	}
+	q := e.Query
+	if q == nil {
+		q = new(TableQuery)
+	}
+	if err = q.Validate(t); err != nil {
+		return err
+	}
+	f, err := c.Sink.Create(e.ID)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil && closeErr != nil {
+			err = errors.WithStack(closeErr)
+		}
+	}()
+	columns := t.Columns()
+	record := make([]string, len(columns))
+	for i, x := range columns {
+		record[i] = x.Name
+	}
+	w := csv.NewWriter(f)
+	if err = w.Write(record); err != nil {
+		return errors.WithStack(err)
+	}
+	e.Status, e.Rows, e.Error = ExportRunning, 0, ""
+	var (
+		rows  []Row
+		total int64
+	)
+	for {
+		if err = ctx.Err(); err != nil {
+			return errors.WithStack(err)
+		}
+		if rows, total, err = t.Rows(ctx, q, int(e.Rows), c.BatchSize); err != nil {
+			return err
+		}
+		if e.Rows == 0 {
+			e.Total = total
+		}
+		for _, r := range rows {
+			for i, x := range columns {
+				record[i] = cell(r[x.Name])
+			}
+			if err = w.Write(record); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		e.Rows += int64(len(rows))
+		if len(rows) < c.BatchSize {
+			break
+		}
+		e.UpdatedAt = c.now().UTC()
+		if err = c.Exports.Put(e); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return errors.WithStack(w.Error())
+}
+
+func cell(x interface{}) string {
+	switch v := x.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	}
+	return fmt.Sprint(x)
+}
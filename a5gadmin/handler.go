@@ -0,0 +1,208 @@
+package a5gadmin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCodeUnknown = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4071,
+		Name:     "admin_unknown",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "kpi, table or export not found"})
+
+	ErrCodeQueryInvalid = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4285,
+		Name:     "admin_query_invalid",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "invalid table query"})
+)
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeUnknown, http.StatusNotFound)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeQueryInvalid, http.StatusUnprocessableEntity)
+}
+
+// KPIsRequest times are unix seconds; no Names asks for every KPI.
+type KPIsRequest struct {
+	Names []string `json:"names,omitempty"`
+	From  int64    `json:"from" validate:"required"`
+	To    int64    `json:"to" validate:"required"`
+}
+
+type KPIsResponse struct {
+	KPIs []*KPIValue `json:"kpis"`
+}
+
+type TableInfo struct {
+	Name    string    `json:"name"`
+	Columns []*Column `json:"columns"`
+}
+
+type TablesResponse struct {
+	Tables []*TableInfo `json:"tables"`
+}
+
+// TableRequest asks for a page of rows of Table, paged by the envelope
+// page; a cursor is only valid for the query it was issued for.
+type TableRequest struct {
+	Table string `json:"table" validate:"required"`
+	TableQuery
+}
+
+type ExportRequest struct {
+	ID string `json:"id" validate:"required"`
+}
+
+type tableState struct {
+	Offset int `json:"offset"`
+}
+
+// KPIsHandler answers KPIs of a period, mount it on an admin route class.
+func (c *Console) KPIsHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(KPIsRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			r, ok := req.Payload.(*KPIsRequest)
+			if !ok {
+				return nil, c.apiErrs(errors.New("unexpected kpis request"))
+			}
+			a, err := c.KPIs(ctx, r.Names, time.Unix(r.From, 0), time.Unix(r.To, 0))
+			if err != nil {
+				return nil, c.apiErrs(err)
+			}
+			return &KPIsResponse{KPIs: a}, nil
+		})
+}
+
+// TablesHandler lists tables and their columns for the console to build
+// its views, mount it on an admin route class.
+func (c *Console) TablesHandler() a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		c.mu.RLock()
+		a := make([]*TableInfo, 0, len(c.tables))
+		for name, t := range c.tables {
+			a = append(a, &TableInfo{Name: name, Columns: t.Columns()})
+		}
+		c.mu.RUnlock()
+		sort.Slice(a, func(i, j int) bool { return a[i].Name < a[j].Name })
+		return &TablesResponse{Tables: a}, nil
+	}
+}
+
+// TableHandler answers a page of rows with the total count of the query,
+// mount it on an admin route class.
+func (c *Console) TableHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(TableRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			r, ok := req.Payload.(*TableRequest)
+			if !ok {
+				return nil, c.apiErrs(errors.New("unexpected table request"))
+			}
+			t, err := c.table(r.Table)
+			if err != nil {
+				return nil, c.apiErrs(err)
+			}
+			if err = r.Validate(t); err != nil {
+				return nil, c.apiErrs(err)
+			}
+			kind, err := cursorKind(r)
+			if err != nil {
+				return nil, c.apiErrs(err)
+			}
+			state := new(tableState)
+			limit, _, e := c.Cursors.ParsePage(req, kind, 0, c.Limits, state)
+			if e != nil {
+				return nil, []*a5gapi.APIErr{e}
+			}
+			rows, total, err := t.Rows(ctx, &r.TableQuery, state.Offset, limit)
+			if err != nil {
+				return nil, c.apiErrs(err)
+			}
+			state.Offset += len(rows)
+			hasMore := int64(state.Offset) < total
+			page, err := c.Cursors.NextPage(kind, 0, limit, hasMore, &total, state)
+			if err != nil {
+				return nil, c.apiErrs(err)
+			}
+			return &a5gapi.Paged{Items: rows, Page: page}, nil
+		})
+}
+
+// StartExportHandler starts an export of the rows of a table query and
+// answers with it, mount it on an admin route class.
+func (c *Console) StartExportHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(TableRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			r, ok := req.Payload.(*TableRequest)
+			if !ok {
+				return nil, c.apiErrs(errors.New("unexpected export request"))
+			}
+			e, err := c.StartExport(r.Table, &r.TableQuery)
+			if err != nil {
+				return nil, c.apiErrs(err)
+			}
+			return e, nil
+		})
+}
+
+// ExportHandler answers an export with its progress for the console to
+// poll, mount it on an admin route class.
+func (c *Console) ExportHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(ExportRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			r, ok := req.Payload.(*ExportRequest)
+			if !ok {
+				return nil, c.apiErrs(errors.New("unexpected export request"))
+			}
+			e, err := c.Export(r.ID)
+			if err != nil {
+				return nil, c.apiErrs(err)
+			}
+			return e, nil
+		})
+}
+
+// cursorKind binds cursors to the table and query they page.
+func cursorKind(r *TableRequest) (string, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	h := sha256.Sum256(b)
+	return "admin:" + hex.EncodeToString(h[:8]), nil
+}
+
+func (c *Console) apiErrs(err error) []*a5gapi.APIErr {
+	switch errors.Cause(err) {
+	case ErrKPIUnknown, ErrTableUnknown, ErrExportUnknown:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeUnknown, "%s", err)}
+	case ErrQueryInvalid:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeQueryInvalid, "%s", err)}
+	default:
+		c.Logger.Error(err.Error())
+		return a5gapi.NewJSONMsgDefautlErrors(err)
+	}
+}
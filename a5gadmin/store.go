@@ -0,0 +1,119 @@
+package a5gadmin
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryStore struct {
+	mu      sync.Mutex
+	exports map[string]Export
+}
+
+func NewMemoryStore() ExportStore {
+	return &memoryStore{exports: make(map[string]Export)}
+}
+
+func (s *memoryStore) Put(e *Export) error {
+	s.mu.Lock()
+	s.exports[e.ID] = *e
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryStore) Get(id string) (*Export, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.exports[id]
+	if !ok {
+		return nil, errors.Wrap(ErrExportUnknown, id)
+	}
+	return &e, nil
+}
+
+// dbStore keeps exports in a MySQL table:
+//
+//	CREATE TABLE admin_exports (
+//	  id VARCHAR(128) NOT NULL PRIMARY KEY,
+//	  table_name VARCHAR(64) NOT NULL,
+//	  query TEXT NOT NULL,
+//	  status VARCHAR(16) NOT NULL,
+//	  rows_written BIGINT NOT NULL,
+//	  total BIGINT NOT NULL,
+//	  error TEXT NOT NULL,
+//	  created_at BIGINT NOT NULL,
+//	  updated_at BIGINT NOT NULL);
+type dbStore struct {
+	pooler    a5gdb.Pooler
+	tableName string
+}
+
+type dbExport struct {
+	ID        string `db:"id"`
+	TableName string `db:"table_name"`
+	Query     string `db:"query"`
+	Status    string `db:"status"`
+	Rows      int64  `db:"rows_written"`
+	Total     int64  `db:"total"`
+	Error     string `db:"error"`
+	CreatedAt int64  `db:"created_at"`
+	UpdatedAt int64  `db:"updated_at"`
+}
+
+func NewDBStore(p a5gdb.Pooler, tableName string) (ExportStore, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if tableName == "" {
+		return nil, errors.New("empty exports table name")
+	}
+	return &dbStore{pooler: p, tableName: tableName}, nil
+}
+
+func (s *dbStore) Put(e *Export) error {
+	q, err := json.Marshal(e.Query)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = s.pooler.WritePool().NewSession().InsertBySql("REPLACE INTO "+
+		s.tableName+" (id, table_name, query, status, rows_written, total,"+
+		" error, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		e.ID, e.Table, string(q), e.Status.String(), e.Rows, e.Total, e.Error,
+		e.CreatedAt.UnixNano(), e.UpdatedAt.UnixNano()).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	return nil
+}
+
+func (s *dbStore) Get(id string) (*Export, error) {
+	x := new(dbExport)
+	err := s.pooler.ReadPool().NewSession().
+		Select("id", "table_name", "query", "status", "rows_written", "total",
+			"error", "created_at", "updated_at").
+		From(s.tableName).Where(dbr.Eq("id", id)).LoadOne(x)
+	if err == dbr.ErrNotFound {
+		return nil, errors.Wrap(ErrExportUnknown, id)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	e := &Export{
+		ID:        x.ID,
+		Table:     x.TableName,
+		Status:    ExportStatus(x.Status),
+		Rows:      x.Rows,
+		Total:     x.Total,
+		Error:     x.Error,
+		CreatedAt: time.Unix(0, x.CreatedAt).UTC(),
+		UpdatedAt: time.Unix(0, x.UpdatedAt).UTC()}
+	if err = json.Unmarshal([]byte(x.Query), &e.Query); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return e, nil
+}
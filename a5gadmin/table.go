@@ -0,0 +1,238 @@
+package a5gadmin
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Column describes a table column and what the console may do with it.
+type Column struct {
+	Name       string `json:"name"`
+	Sortable   bool   `json:"sortable,omitempty"`
+	Filterable bool   `json:"filterable,omitempty"`
+	// Searchable columns are matched by the free text search.
+	Searchable bool `json:"searchable,omitempty"`
+}
+
+// Filter ops; "in" takes a list and "like" matches a substring.
+const (
+	OpEq   = "eq"
+	OpNe   = "ne"
+	OpLt   = "lt"
+	OpLte  = "lte"
+	OpGt   = "gt"
+	OpGte  = "gte"
+	OpIn   = "in"
+	OpLike = "like"
+)
+
+type Filter struct {
+	Column string      `json:"column"`
+	Op     string      `json:"op"`
+	Value  interface{} `json:"value"`
+}
+
+// TableQuery selects rows matching Search and every filter, in Sort
+// order (the table's own order without one).
+type TableQuery struct {
+	Search  string    `json:"search,omitempty"`
+	Filters []*Filter `json:"filters,omitempty"`
+	Sort    string    `json:"sort,omitempty"`
+	Desc    bool      `json:"desc,omitempty"`
+}
+
+type Row map[string]interface{}
+
+// Table serves console rows. Rows returns rows of a validated q from
+// offset, up to limit, and the count of every row of q.
+type Table interface {
+	Columns() []*Column
+	Rows(ctx context.Context, q *TableQuery, offset, limit int) ([]Row, int64, error)
+}
+
+// Validate checks q against columns of t, so tables build queries from
+// known column names only.
+func (q *TableQuery) Validate(t Table) error {
+	columns := make(map[string]*Column)
+	for _, c := range t.Columns() {
+		columns[c.Name] = c
+	}
+	if q.Sort != "" {
+		if c := columns[q.Sort]; c == nil || !c.Sortable {
+			return errors.Wrapf(ErrQueryInvalid, "column %q is not sortable", q.Sort)
+		}
+	}
+	for _, f := range q.Filters {
+		if f == nil {
+			return errors.Wrap(ErrQueryInvalid, "empty filter")
+		}
+		if c := columns[f.Column]; c == nil || !c.Filterable {
+			return errors.Wrapf(ErrQueryInvalid, "column %q is not filterable", f.Column)
+		}
+		switch f.Op {
+		case OpEq, OpNe, OpLt, OpLte, OpGt, OpGte:
+			if !scalar(f.Value) {
+				return errors.Wrapf(ErrQueryInvalid, "%s %s takes a value", f.Column, f.Op)
+			}
+		case OpIn:
+			a, ok := f.Value.([]interface{})
+			if !ok || len(a) == 0 {
+				return errors.Wrapf(ErrQueryInvalid, "%s in takes a list", f.Column)
+			}
+			for _, x := range a {
+				if !scalar(x) {
+					return errors.Wrapf(ErrQueryInvalid, "%s in takes values", f.Column)
+				}
+			}
+		case OpLike:
+			if _, ok := f.Value.(string); !ok {
+				return errors.Wrapf(ErrQueryInvalid, "%s like takes a string", f.Column)
+			}
+		default:
+			return errors.Wrapf(ErrQueryInvalid, "unknown op %q", f.Op)
+		}
+	}
+	return nil
+}
+
+func scalar(x interface{}) bool {
+	switch x.(type) {
+	case string, float64, bool:
+		return true
+	}
+	return false
+}
+
+type sliceTable struct {
+	columns []*Column
+	rows    func(context.Context) ([]Row, error)
+}
+
+// NewSliceTable filters, sorts and pages rows in memory, for small tables
+// such as configs or tables other services answer whole.
+func NewSliceTable(columns []*Column,
+	rows func(context.Context) ([]Row, error)) (Table, error) {
+	if len(columns) == 0 {
+		return nil, errors.New("table without columns")
+	}
+	if rows == nil {
+		return nil, errors.New("rows func missing")
+	}
+	return &sliceTable{columns: columns, rows: rows}, nil
+}
+
+func (t *sliceTable) Columns() []*Column { return t.columns }
+
+func (t *sliceTable) Rows(ctx context.Context, q *TableQuery, offset, limit int) (
+	[]Row, int64, error) {
+	all, err := t.rows(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	a := []Row{}
+	for _, r := range all {
+		if t.match(q, r) {
+			a = append(a, r)
+		}
+	}
+	if q.Sort != "" {
+		sort.SliceStable(a, func(i, j int) bool {
+			if q.Desc {
+				return compare(a[j][q.Sort], a[i][q.Sort]) < 0
+			}
+			return compare(a[i][q.Sort], a[j][q.Sort]) < 0
+		})
+	}
+	total := int64(len(a))
+	if offset > len(a) {
+		offset = len(a)
+	}
+	a = a[offset:]
+	if limit > 0 && len(a) > limit {
+		a = a[:limit]
+	}
+	return a, total, nil
+}
+
+func (t *sliceTable) match(q *TableQuery, r Row) bool {
+	for _, f := range q.Filters {
+		if !matchFilter(f, r[f.Column]) {
+			return false
+		}
+	}
+	if q.Search == "" {
+		return true
+	}
+	s := strings.ToLower(q.Search)
+	for _, c := range t.columns {
+		if c.Searchable &&
+			strings.Contains(strings.ToLower(fmt.Sprint(r[c.Name])), s) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchFilter(f *Filter, v interface{}) bool {
+	switch f.Op {
+	case OpEq:
+		return compare(v, f.Value) == 0
+	case OpNe:
+		return compare(v, f.Value) != 0
+	case OpLt:
+		return compare(v, f.Value) < 0
+	case OpLte:
+		return compare(v, f.Value) <= 0
+	case OpGt:
+		return compare(v, f.Value) > 0
+	case OpGte:
+		return compare(v, f.Value) >= 0
+	case OpIn:
+		a, _ := f.Value.([]interface{})
+		for _, x := range a {
+			if compare(v, x) == 0 {
+				return true
+			}
+		}
+		return false
+	case OpLike:
+		s, _ := f.Value.(string)
+		return strings.Contains(strings.ToLower(fmt.Sprint(v)), strings.ToLower(s))
+	}
+	return false
+}
+
+// compare orders numbers of any kind by value and everything else by its
+// text.
+func compare(a, b interface{}) int {
+	x, xok := number(a)
+	y, yok := number(b)
+	if xok && yok {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func number(x interface{}) (float64, bool) {
+	v := reflect.ValueOf(x)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
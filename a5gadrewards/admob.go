@@ -0,0 +1,139 @@
+package a5gadrewards
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// AdMobVerifierKeysURL serves the public keys used to sign AdMob server-side
+// verification callbacks
+// <https://developers.google.com/admob/android/ssv>.
+const AdMobVerifierKeysURL = "https://www.gstatic.com/admob/reward/verifier-keys.json"
+
+var (
+	ErrAdMobSignatureMissing = errors.New("missing admob ssv signature")
+	ErrAdMobKeyUnknown       = errors.New("unknown admob ssv key id")
+	ErrAdMobSignatureInvalid = errors.New("invalid admob ssv signature")
+)
+
+// AdMobKeys is an public keys by key id. Fetch AdMobVerifierKeysURL
+// periodically (the keys rotate) and parse it with NewAdMobKeys.
+type AdMobKeys map[uint64]*ecdsa.PublicKey
+
+// AdMobReward is an verified AdMob rewarded ad callback.
+type AdMobReward struct {
+	AdNetwork     string
+	AdUnit        string
+	CustomData    string
+	RewardAmount  int64
+	RewardItem    string
+	Timestamp     int64
+	TransactionID string
+	UserID        string
+}
+
+func NewAdMobKeys(verifierKeysJSON []byte) (AdMobKeys, error) {
+	s := &struct {
+		Keys []struct {
+			KeyID uint64 `json:"keyId"`
+			PEM   string `json:"pem"`
+		} `json:"keys"`
+	}{}
+	if err := json.Unmarshal(verifierKeysJSON, s); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	keys := make(AdMobKeys)
+	for _, k := range s.Keys {
+		b, _ := pem.Decode([]byte(k.PEM))
+		if b == nil {
+			return nil, errors.Errorf("bad admob ssv key %d pem", k.KeyID)
+		}
+		x, err := x509.ParsePKIXPublicKey(b.Bytes)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		publicKey, ok := x.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, errors.New("public key is not an *ecdsa.PublicKey")
+		}
+		keys[k.KeyID] = publicKey
+	}
+	return keys, nil
+}
+
+// VerifyAdMob checks callback's raw query string (as received, without
+// re-encoding) and returns parsed reward on success.
+func (keys AdMobKeys) VerifyAdMob(rawQuery string) (*AdMobReward, error) {
+	i := strings.Index(rawQuery, "&signature=")
+	if i < 0 {
+		return nil, errors.WithStack(ErrAdMobSignatureMissing)
+	}
+	content := rawQuery[:i]
+	q, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	keyID, err := strconv.ParseUint(q.Get("key_id"), 10, 64)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	publicKey, ok := keys[keyID]
+	if !ok {
+		return nil, errors.WithStack(ErrAdMobKeyUnknown)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(
+		strings.TrimRight(q.Get("signature"), "="))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	sig := &struct{ R, S *big.Int }{}
+	if _, err = asn1.Unmarshal(signature, sig); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	hashed := sha256.Sum256([]byte(content))
+	if !ecdsa.Verify(publicKey, hashed[:], sig.R, sig.S) {
+		return nil, errors.WithStack(ErrAdMobSignatureInvalid)
+	}
+	r := &AdMobReward{
+		AdNetwork:     q.Get("ad_network"),
+		AdUnit:        q.Get("ad_unit"),
+		CustomData:    q.Get("custom_data"),
+		RewardItem:    q.Get("reward_item"),
+		TransactionID: q.Get("transaction_id"),
+		UserID:        q.Get("user_id")}
+	if s := q.Get("reward_amount"); s != "" {
+		if r.RewardAmount, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	if s := q.Get("timestamp"); s != "" {
+		if r.Timestamp, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	return r, nil
+}
+
+func (r *AdMobReward) Validate() error {
+	if strings.TrimSpace(r.TransactionID) == "" {
+		return errors.New("empty admob ssv transaction id")
+	}
+	if strings.TrimSpace(r.UserID) == "" {
+		return errors.New("empty admob ssv user id")
+	}
+	if r.RewardAmount < 1 {
+		return errors.New("unexpected admob ssv reward amount")
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package a5gadrewards
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"math/big"
+	"testing"
+)
+
+func TestVerifyAdMob(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := AdMobKeys{3335741209: &privateKey.PublicKey}
+	content := "ad_network=5450213213286189855&ad_unit=1234567890" +
+		"&reward_amount=5&reward_item=coins&timestamp=1507770365237823" +
+		"&transaction_id=123456789&user_id=42"
+	hashed := sha256.Sum256([]byte(content))
+	r, s, err := ecdsa.Sign(rand.Reader, privateKey, hashed[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := base64.RawURLEncoding.EncodeToString(signature)
+	var a = []struct {
+		in string
+		ok bool
+	}{
+		{content + "&signature=" + sig + "&key_id=3335741209", true},
+		{content + "&signature=" + sig + "&key_id=1", false},
+		{content + "1&signature=" + sig + "&key_id=3335741209", false},
+		{content + "&key_id=3335741209", false},
+	}
+	for _, v := range a {
+		reward, err := keys.VerifyAdMob(v.in)
+		if (err == nil) != v.ok {
+			t.Errorf("VerifyAdMob(%q) => %v want ok=%t", v.in, err, v.ok)
+			continue
+		}
+		if v.ok && (reward.UserID != "42" || reward.RewardAmount != 5) {
+			t.Errorf("VerifyAdMob(%q) => %+v", v.in, reward)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package a5gadrewards
+
+import (
+	"time"
+
+	"github.com/armor5games/a5g/a5greset"
+	"github.com/pkg/errors"
+)
+
+// Store keeps replay protection and daily counters of ad rewards, so they
+// hold across restarts and servers. Claim reports whether a transaction of
+// a network is seen for the first time, Release forgets it again for the
+// network to retry. Grant counts a reward of a user on a day unless limit
+// (zero is uncapped) is reached and Ungrant takes it back; Invalid counts a rejected callback and
+// returns the total of the day.
+type Store interface {
+	Claim(network, transactionID string) (bool, error)
+	Release(network, transactionID string) error
+	Grant(userID, day string, limit int) (bool, error)
+	Ungrant(userID, day string) error
+	Invalid(userID, day string) (int64, error)
+}
+
+// DailyCaps limits granted rewards per player per game day and counts
+// rejected (invalid signature, replayed) callbacks as fraud signals.
+type DailyCaps struct {
+	Limit int
+	// Reset is where days start, UTC midnight when nil.
+	Reset *a5greset.Reset
+	Store Store
+}
+
+func NewDailyCaps(limit int, s Store) (*DailyCaps, error) {
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	return &DailyCaps{Limit: limit, Store: s}, nil
+}
+
+// Grant reports whether userID may receive one more reward today and
+// counts it if so.
+func (c *DailyCaps) Grant(userID string, now time.Time) (bool, error) {
+	return c.Store.Grant(userID, c.Reset.Day(now).Key, c.Limit)
+}
+
+// Ungrant takes back a reward counted by Grant at now which failed.
+func (c *DailyCaps) Ungrant(userID string, now time.Time) error {
+	return c.Store.Ungrant(userID, c.Reset.Day(now).Key)
+}
+
+// Invalid counts a rejected callback and returns today's total for userID.
+func (c *DailyCaps) Invalid(userID string, now time.Time) (int64, error) {
+	return c.Store.Invalid(userID, c.Reset.Day(now).Key)
+}
@@ -0,0 +1,205 @@
+package a5gadrewards
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gconsent"
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+const (
+	NetworkAdMob = "admob"
+	NetworkUnity = "unity"
+)
+
+// EventReward is the Tracker event of a granted reward.
+const EventReward = "ad_reward"
+
+// Reward is a verified callback of a network granted to AccountID.
+type Reward struct {
+	Network       string
+	TransactionID string
+	AccountID     uint64
+	Item          string
+	Amount        int64
+}
+
+// GrantFunc credits a reward, e.g. through a5gwallet with TransactionID
+// as its transaction ID.
+type GrantFunc func(ctx context.Context, r *Reward) error
+
+// Rewarder serves server-side verification callbacks of ad networks: it
+// verifies them, drops replays, applies Caps and grants the rest. User
+// IDs of callbacks are account IDs.
+type Rewarder struct {
+	Caps        *DailyCaps
+	Grant       GrantFunc
+	Logger      a5glogs.Logger
+	UnitySecret string
+	// MaxInvalid is the count of rejected callbacks of a user per day
+	// logged as a fraud signal, zero disables it.
+	MaxInvalid int64
+	// Tracker gets an EventReward per granted reward of players who
+	// granted a5gconsent.PurposeAds and PurposeAnalytics in Consents;
+	// nothing is tracked without Consents.
+	Tracker  a5gconsent.Tracker
+	Consents *a5gconsent.Consents
+
+	now       func() time.Time
+	mu        sync.RWMutex
+	admobKeys AdMobKeys
+}
+
+func NewRewarder(caps *DailyCaps, fn GrantFunc, l a5glogs.Logger) (*Rewarder, error) {
+	if caps == nil {
+		return nil, errors.New("daily caps missing")
+	}
+	if fn == nil {
+		return nil, errors.New("grant fn missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Rewarder{
+		Caps:       caps,
+		Grant:      fn,
+		Logger:     l,
+		MaxInvalid: 10,
+		now:        time.Now}, nil
+}
+
+// SetAdMobKeys replaces the AdMob keys, call it whenever
+// AdMobVerifierKeysURL is fetched again.
+func (x *Rewarder) SetAdMobKeys(keys AdMobKeys) {
+	x.mu.Lock()
+	x.admobKeys = keys
+	x.mu.Unlock()
+}
+
+// AdMobHandler serves the AdMob callback URL.
+func (x *Rewarder) AdMobHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		x.mu.RLock()
+		keys := x.admobKeys
+		x.mu.RUnlock()
+		reward, err := keys.VerifyAdMob(r.URL.RawQuery)
+		if err != nil {
+			x.invalid(w, NetworkAdMob, r.URL.Query().Get("user_id"), err)
+			return
+		}
+		x.serve(r.Context(), w, &Reward{
+			Network:       NetworkAdMob,
+			TransactionID: reward.TransactionID,
+			Item:          reward.RewardItem,
+			Amount:        reward.RewardAmount}, reward.UserID, "")
+	})
+}
+
+// UnityHandler serves the Unity Ads callback URL, it answers "1" on
+// success as Unity expects.
+func (x *Rewarder) UnityHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reward, err := VerifyUnity(r.URL.Query(), x.UnitySecret)
+		if err != nil {
+			x.invalid(w, NetworkUnity, r.URL.Query().Get("sid"), err)
+			return
+		}
+		x.serve(r.Context(), w, &Reward{
+			Network:       NetworkUnity,
+			TransactionID: reward.OrderID,
+			Item:          reward.Product,
+			Amount:        1}, reward.UserID, "1")
+	})
+}
+
+func (x *Rewarder) invalid(
+	w http.ResponseWriter, network, userID string, cause error) {
+	l := x.Logger.With(a5gfields.String("adNetwork", network),
+		a5gfields.String("userId", userID))
+	l.Warn(cause.Error())
+	if userID != "" {
+		n, err := x.Caps.Invalid(userID, x.now())
+		if err != nil {
+			l.Error(err.Error())
+		} else if x.MaxInvalid > 0 && n >= x.MaxInvalid {
+			l.With(a5gfields.Int64("invalid", n)).Warn("ad rewards fraud signal")
+		}
+	}
+	http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+}
+
+// serve answers 200 to replays and capped rewards, networks retry
+// anything else; a failed grant releases its claim and its daily cap
+// count for that retry.
+func (x *Rewarder) serve(ctx context.Context,
+	w http.ResponseWriter, reward *Reward, userID, body string) {
+	var err error
+	reward.AccountID, err = strconv.ParseUint(userID, 10, 64)
+	if err != nil || reward.AccountID == 0 {
+		x.invalid(w, reward.Network, userID, errors.New("invalid ad reward user id"))
+		return
+	}
+	l := x.Logger.With(a5gfields.String("adNetwork", reward.Network),
+		a5gfields.String("transactionId", reward.TransactionID),
+		a5gfields.String("accountId", userID))
+	ok, err := x.Caps.Store.Claim(reward.Network, reward.TransactionID)
+	if err != nil {
+		l.Error(err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		l.Warn("ad reward replayed")
+		x.ok(w, l, body)
+		return
+	}
+	now := x.now()
+	granted, err := x.Caps.Grant(userID, now)
+	if err == nil && granted {
+		if err = x.Grant(ctx, reward); err != nil {
+			if e := x.Caps.Ungrant(userID, now); e != nil {
+				l.Error(e.Error())
+			}
+		}
+	}
+	if err != nil {
+		l.Error(err.Error())
+		if err = x.Caps.Store.Release(reward.Network, reward.TransactionID); err != nil {
+			l.Error(err.Error())
+		}
+		http.Error(w, http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError)
+		return
+	}
+	if !granted {
+		l.Info("ad reward over daily cap")
+	} else {
+		x.track(ctx, l, reward)
+	}
+	x.ok(w, l, body)
+}
+
+func (x *Rewarder) track(ctx context.Context, l a5glogs.Logger, reward *Reward) {
+	if x.Tracker == nil || x.Consents == nil ||
+		!x.Consents.Allows(ctx, reward.AccountID, a5gconsent.PurposeAds) {
+		return
+	}
+	err := x.Consents.AnalyticsTracker(x.Tracker).Track(
+		ctx, reward.AccountID, EventReward, reward)
+	if err != nil {
+		l.Error(err.Error())
+	}
+}
+
+func (x *Rewarder) ok(w http.ResponseWriter, l a5glogs.Logger, body string) {
+	if _, err := w.Write([]byte(body)); err != nil {
+		l.Error(err.Error())
+	}
+}
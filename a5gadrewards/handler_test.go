@@ -0,0 +1,161 @@
+package a5gadrewards
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5gconsent"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestRewarder(t *testing.T) {
+	caps, err := NewDailyCaps(2, NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var granted []*Reward
+	fail := false
+	x, err := NewRewarder(caps, func(ctx context.Context, r *Reward) error {
+		if fail {
+			return errors.New("wallet down")
+		}
+		granted = append(granted, r)
+		return nil
+	}, a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.UnitySecret = "secret"
+	now := time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC)
+	x.now = func() time.Time { return now }
+
+	call := func(oid, sid string) *httptest.ResponseRecorder {
+		q := unitySign(map[string][]string{"sid": {sid}, "oid": {oid}},
+			"secret", "oid="+oid+",sid="+sid)
+		w := httptest.NewRecorder()
+		x.UnityHandler().ServeHTTP(w,
+			httptest.NewRequest(http.MethodGet, "/unity?"+q.Encode(), nil))
+		return w
+	}
+	var a = []struct {
+		oid, sid string
+		status   int
+		granted  int
+	}{
+		{"1", "42", http.StatusOK, 1},
+		// A replayed order is acknowledged without a reward.
+		{"1", "42", http.StatusOK, 1},
+		{"2", "42", http.StatusOK, 2},
+		// Over the daily cap.
+		{"3", "42", http.StatusOK, 2},
+		{"4", "7", http.StatusOK, 3},
+		{"5", "nobody", http.StatusBadRequest, 3},
+	}
+	for i, v := range a {
+		w := call(v.oid, v.sid)
+		if w.Code != v.status || len(granted) != v.granted {
+			t.Errorf("%d: unexpected status %d, %d granted", i, w.Code, len(granted))
+		}
+		if w.Code == http.StatusOK && w.Body.String() != "1" {
+			t.Errorf("%d: unexpected body %q", i, w.Body.String())
+		}
+	}
+	if r := granted[2]; r.Network != NetworkUnity || r.AccountID != 7 ||
+		r.TransactionID != "4" {
+		t.Errorf("unexpected reward %+v", r)
+	}
+
+	// A failed grant is retried by the network and granted then.
+	fail = true
+	if w := call("6", "7"); w.Code != http.StatusInternalServerError {
+		t.Errorf("unexpected status %d", w.Code)
+	}
+	fail = false
+	if w := call("6", "7"); w.Code != http.StatusOK || len(granted) != 4 {
+		t.Errorf("unexpected status %d, %d granted", w.Code, len(granted))
+	}
+
+	// Caps start over the next day.
+	now = now.Add(24 * time.Hour)
+	if w := call("7", "42"); w.Code != http.StatusOK || len(granted) != 5 {
+		t.Errorf("unexpected status %d, %d granted", w.Code, len(granted))
+	}
+
+	bad := httptest.NewRecorder()
+	x.UnityHandler().ServeHTTP(bad, httptest.NewRequest(http.MethodGet,
+		"/unity?sid=42&oid=8&hmac=00", nil))
+	if bad.Code != http.StatusBadRequest {
+		t.Errorf("unexpected status %d", bad.Code)
+	}
+	if n, err := caps.Invalid("42", now); err != nil || n != 2 {
+		t.Errorf("unexpected invalid count %d, %v", n, err)
+	}
+}
+
+func TestRewarderConsent(t *testing.T) {
+	caps, err := NewDailyCaps(10, NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	x, err := NewRewarder(caps, func(ctx context.Context, r *Reward) error {
+		return nil
+	}, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.UnitySecret = "secret"
+	x.Consents, err = a5gconsent.NewConsents(map[string]string{
+		a5gconsent.PurposeAnalytics: "v1", a5gconsent.PurposeAds: "v1"},
+		a5gconsent.NewMemoryStore(), l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tracked []uint64
+	x.Tracker = a5gconsent.TrackerFunc(func(ctx context.Context,
+		accountID uint64, event string, payload interface{}) error {
+		if event != EventReward {
+			t.Errorf("unexpected event %q", event)
+		}
+		tracked = append(tracked, accountID)
+		return nil
+	})
+
+	// 1 granted both purposes, 2 only analytics, 3 ads withdrawn, 4 none.
+	decisions := []struct {
+		accountID uint64
+		purpose   string
+		granted   bool
+	}{
+		{1, a5gconsent.PurposeAnalytics, true},
+		{1, a5gconsent.PurposeAds, true},
+		{2, a5gconsent.PurposeAnalytics, true},
+		{3, a5gconsent.PurposeAnalytics, true},
+		{3, a5gconsent.PurposeAds, true},
+		{3, a5gconsent.PurposeAds, false},
+	}
+	for _, d := range decisions {
+		if _, err = x.Consents.Update(d.accountID, d.purpose, d.granted, "v1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, sid := range []string{"1", "2", "3", "4"} {
+		oid := string('a' + rune(i))
+		q := unitySign(map[string][]string{"sid": {sid}, "oid": {oid}},
+			"secret", "oid="+oid+",sid="+sid)
+		w := httptest.NewRecorder()
+		x.UnityHandler().ServeHTTP(w,
+			httptest.NewRequest(http.MethodGet, "/unity?"+q.Encode(), nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: unexpected status %d", sid, w.Code)
+		}
+	}
+	if len(tracked) != 1 || tracked[0] != 1 {
+		t.Errorf("unexpected tracked players %v", tracked)
+	}
+}
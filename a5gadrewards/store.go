@@ -0,0 +1,199 @@
+package a5gadrewards
+
+import (
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryStore struct {
+	mu      sync.Mutex
+	claims  map[string]bool
+	day     string
+	granted map[string]int
+	invalid map[string]int64
+}
+
+// NewMemoryStore keeps counters of the last day only, for tests and
+// single-server setups.
+func NewMemoryStore() Store {
+	return &memoryStore{claims: make(map[string]bool)}
+}
+
+func (s *memoryStore) Claim(network, transactionID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := network + ":" + transactionID
+	if s.claims[k] {
+		return false, nil
+	}
+	s.claims[k] = true
+	return true, nil
+}
+
+func (s *memoryStore) Release(network, transactionID string) error {
+	s.mu.Lock()
+	delete(s.claims, network+":"+transactionID)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryStore) rotate(day string) {
+	if day == s.day && s.granted != nil {
+		return
+	}
+	s.day = day
+	s.granted = make(map[string]int)
+	s.invalid = make(map[string]int64)
+}
+
+func (s *memoryStore) Grant(userID, day string, limit int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rotate(day)
+	if limit > 0 && s.granted[userID] >= limit {
+		return false, nil
+	}
+	s.granted[userID]++
+	return true, nil
+}
+
+func (s *memoryStore) Ungrant(userID, day string) error {
+	s.mu.Lock()
+	if day == s.day && s.granted[userID] > 0 {
+		s.granted[userID]--
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryStore) Invalid(userID, day string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rotate(day)
+	s.invalid[userID]++
+	return s.invalid[userID], nil
+}
+
+// dbStore keeps claims and counters in MySQL tables:
+//
+//	CREATE TABLE ad_reward_claims (
+//	  network VARCHAR(16) NOT NULL,
+//	  transaction_id VARCHAR(128) NOT NULL,
+//	  created_at DATETIME NOT NULL,
+//	  PRIMARY KEY (network, transaction_id));
+//
+//	CREATE TABLE ad_reward_counters (
+//	  day VARCHAR(16) NOT NULL,
+//	  user_id VARCHAR(64) NOT NULL,
+//	  granted INT NOT NULL,
+//	  invalid BIGINT NOT NULL,
+//	  PRIMARY KEY (day, user_id));
+type dbStore struct {
+	pooler            a5gdb.Pooler
+	claimsTableName   string
+	countersTableName string
+}
+
+func NewDBStore(
+	p a5gdb.Pooler, claimsTableName, countersTableName string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if claimsTableName == "" || countersTableName == "" {
+		return nil, errors.New("empty ad rewards table name")
+	}
+	return &dbStore{
+		pooler:            p,
+		claimsTableName:   claimsTableName,
+		countersTableName: countersTableName}, nil
+}
+
+func (s *dbStore) Claim(network, transactionID string) (bool, error) {
+	res, err := s.pooler.WritePool().NewSession().InsertBySql(
+		"INSERT IGNORE INTO "+s.claimsTableName+
+			" (network, transaction_id, created_at) VALUES (?, ?, ?)",
+		network, transactionID, time.Now().UTC()).Exec()
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	return n == 1, nil
+}
+
+func (s *dbStore) Release(network, transactionID string) error {
+	_, err := s.pooler.WritePool().NewSession().DeleteFrom(s.claimsTableName).
+		Where(dbr.Eq("network", network)).
+		Where(dbr.Eq("transaction_id", transactionID)).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*DeleteStmt).Exec fn")
+	}
+	return nil
+}
+
+// Grant increments the counter only while it is under limit, the row
+// lock of the update serializes concurrent callbacks of a user.
+func (s *dbStore) Grant(userID, day string, limit int) (bool, error) {
+	sess := s.pooler.WritePool().NewSession()
+	_, err := sess.InsertBySql("INSERT IGNORE INTO "+s.countersTableName+
+		" (day, user_id, granted, invalid) VALUES (?, ?, 0, 0)", day, userID).Exec()
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	stmt := sess.UpdateBySql("UPDATE "+s.countersTableName+
+		" SET granted = granted + 1 WHERE day = ? AND user_id = ?", day, userID)
+	if limit > 0 {
+		stmt = sess.UpdateBySql("UPDATE "+s.countersTableName+
+			" SET granted = granted + 1 WHERE day = ? AND user_id = ? AND granted < ?",
+			day, userID, limit)
+	}
+	res, err := stmt.Exec()
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.(*UpdateStmt).Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	return n == 1, nil
+}
+
+func (s *dbStore) Ungrant(userID, day string) error {
+	_, err := s.pooler.WritePool().NewSession().UpdateBySql("UPDATE "+
+		s.countersTableName+" SET granted = granted - 1"+
+		" WHERE day = ? AND user_id = ? AND granted > 0", day, userID).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*UpdateStmt).Exec fn")
+	}
+	return nil
+}
+
+func (s *dbStore) Invalid(userID, day string) (int64, error) {
+	tx, err := s.pooler.WritePool().NewSession().Begin()
+	if err != nil {
+		return 0, errors.Wrap(err, "dbr.(*Session).Begin fn")
+	}
+	defer tx.RollbackUnlessCommitted()
+	_, err = tx.InsertBySql("INSERT INTO "+s.countersTableName+
+		" (day, user_id, granted, invalid) VALUES (?, ?, 0, 1)"+
+		" ON DUPLICATE KEY UPDATE invalid = invalid + 1", day, userID).Exec()
+	if err != nil {
+		return 0, errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	var n int64
+	err = tx.Select("invalid").From(s.countersTableName).
+		Where(dbr.Eq("day", day)).Where(dbr.Eq("user_id", userID)).LoadOne(&n)
+	if err != nil {
+		return 0, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, errors.Wrap(err, "dbr.(*Tx).Commit fn")
+	}
+	return n, nil
+}
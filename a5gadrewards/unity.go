@@ -0,0 +1,66 @@
+package a5gadrewards
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/hex"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var ErrUnityHMACInvalid = errors.New("invalid unity ads ssv hmac")
+
+// UnityReward is an verified Unity Ads server-to-server redeem callback.
+type UnityReward struct {
+	// UserID (sid) is the user id set by the client.
+	UserID string
+	// OrderID (oid) is unique per callback and must be used to
+	// detect replays.
+	OrderID string
+	// Product (productid) if set in the placement.
+	Product string
+}
+
+// VerifyUnity checks "hmac" parameter which is HMAC-MD5 over all other
+// parameters sorted by name and joined as "k1=v1,k2=v2".
+func VerifyUnity(q url.Values, secretKey string) (*UnityReward, error) {
+	if secretKey == "" {
+		return nil, errors.New("empty secret key")
+	}
+	signature := q.Get("hmac")
+	if signature == "" {
+		return nil, errors.WithStack(ErrUnityHMACInvalid)
+	}
+	var keys []string
+	for k := range q {
+		if k == "hmac" {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	a := make([]string, 0, len(keys))
+	for _, k := range keys {
+		a = append(a, k+"="+q.Get(k))
+	}
+	h := hmac.New(md5.New, []byte(secretKey))
+	if _, err := h.Write([]byte(strings.Join(a, ","))); err != nil {
+		return nil, errors.Wrap(err, "hash.Hash.Write fn")
+	}
+	expected := []byte(hex.EncodeToString(h.Sum(nil)))
+	if !hmac.Equal(expected, bytes.ToLower([]byte(signature))) {
+		return nil, errors.WithStack(ErrUnityHMACInvalid)
+	}
+	r := &UnityReward{
+		UserID:  q.Get("sid"),
+		OrderID: q.Get("oid"),
+		Product: q.Get("productid")}
+	if strings.TrimSpace(r.OrderID) == "" {
+		return nil, errors.New("empty unity ads ssv order id")
+	}
+	return r, nil
+}
@@ -0,0 +1,48 @@
+package a5gadrewards
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/hex"
+	"net/url"
+	"testing"
+)
+
+func unitySign(q url.Values, secretKey, data string) url.Values {
+	h := hmac.New(md5.New, []byte(secretKey))
+	h.Write([]byte(data))
+	q.Set("hmac", hex.EncodeToString(h.Sum(nil)))
+	return q
+}
+
+func TestVerifyUnity(t *testing.T) {
+	valid := func() url.Values {
+		return unitySign(url.Values{
+			"sid": {"42"}, "oid": {"1001"}, "productid": {"coins"}},
+			"secret", "oid=1001,productid=coins,sid=42")
+	}
+	r, err := VerifyUnity(valid(), "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.UserID != "42" || r.OrderID != "1001" || r.Product != "coins" {
+		t.Errorf("unexpected reward %+v", r)
+	}
+
+	tampered := valid()
+	tampered.Set("sid", "43")
+	noHMAC := valid()
+	noHMAC.Del("hmac")
+	noOrder := unitySign(url.Values{"sid": {"42"}}, "secret", "sid=42")
+	for i, q := range []url.Values{tampered, noHMAC, noOrder} {
+		if _, err = VerifyUnity(q, "secret"); err == nil {
+			t.Errorf("%d: expected an error", i)
+		}
+	}
+	if _, err = VerifyUnity(valid(), "other"); err == nil {
+		t.Error("expected an error for another secret")
+	}
+	if _, err = VerifyUnity(valid(), ""); err == nil {
+		t.Error("expected an error for an empty secret")
+	}
+}
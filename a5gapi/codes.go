@@ -0,0 +1,139 @@
+package a5gapi
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrCodeDefinition declares an error code a server may emit with its
+// default severity, visibility and message template.
+type ErrCodeDefinition struct {
+	Code     APIErrCode  `json:"code"`
+	Name     string      `json:"name"`
+	Severity ErrSeverity `json:"severity"`
+	Public   bool        `json:"public"`
+	Message  string      `json:"message"`
+}
+
+// ErrCodes is an registry of error codes. Registering the same code or
+// name twice fails, so services sharing a registry cannot collide.
+type ErrCodes struct {
+	mu    sync.RWMutex
+	codes map[APIErrCode]*ErrCodeDefinition
+	names map[string]APIErrCode
+}
+
+// DefaultErrCodes is used by RegisterErrCode and NewErr.
+var DefaultErrCodes = NewErrCodes()
+
+func NewErrCodes() *ErrCodes {
+	return &ErrCodes{
+		codes: make(map[APIErrCode]*ErrCodeDefinition),
+		names: make(map[string]APIErrCode)}
+}
+
+func (r *ErrCodes) Register(d ErrCodeDefinition) error {
+	if d.Code == 0 {
+		return errors.New("zero error code")
+	}
+	if d.Name == "" {
+		return errors.New("empty error code name")
+	}
+	for s := ErrSeverityDebug; s <= ErrSeverityPanic; s++ {
+		if uint64(d.Code) == s.ErrorDefaultCode() {
+			return errors.Errorf("error code %d is reserved", d.Code)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if x, ok := r.codes[d.Code]; ok {
+		return errors.Errorf("error code %d already registered as %q",
+			d.Code, x.Name)
+	}
+	if x, ok := r.names[d.Name]; ok {
+		return errors.Errorf("error code name %q already registered as %d",
+			d.Name, x)
+	}
+	r.codes[d.Code] = &d
+	r.names[d.Name] = d.Code
+	return nil
+}
+
+// MustRegister is for package level declarations:
+//
+//	var ErrCodeSessionExpired = a5gapi.MustRegisterErrCode(
+//		a5gapi.ErrCodeDefinition{Code: 4011, Name: "session_expired", ...})
+func (r *ErrCodes) MustRegister(d ErrCodeDefinition) APIErrCode {
+	if err := r.Register(d); err != nil {
+		panic(err.Error())
+	}
+	return d.Code
+}
+
+func (r *ErrCodes) Lookup(c APIErrCode) (ErrCodeDefinition, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	d, ok := r.codes[c]
+	if !ok {
+		return ErrCodeDefinition{}, false
+	}
+	return *d, true
+}
+
+// Definitions lists registered codes ordered by code, e.g. for auditing
+// which codes a server can emit.
+func (r *ErrCodes) Definitions() []ErrCodeDefinition {
+	r.mu.RLock()
+	a := make([]ErrCodeDefinition, 0, len(r.codes))
+	for _, d := range r.codes {
+		a = append(a, *d)
+	}
+	r.mu.RUnlock()
+	sort.Slice(a, func(i, k int) bool { return a[i].Code < a[k].Code })
+	return a
+}
+
+// NewErr builds an APIErr from registered code definition. Details are
+// appended to the definition's message: "message: details". An
+// unregistered code produces a private error-severity APIErr.
+func (r *ErrCodes) NewErr(
+	c APIErrCode, format string, a ...interface{}) *APIErr {
+	d, ok := r.Lookup(c)
+	if !ok {
+		return &APIErr{
+			Code: uint64(c),
+			Err: errors.Errorf("unregistered error code %d: %s",
+				c, fmt.Sprintf(format, a...)),
+			Severity: ErrSeverityError.Uint64()}
+	}
+	s := d.Message
+	if format != "" {
+		if s != "" {
+			s += ": "
+		}
+		s += fmt.Sprintf(format, a...)
+	}
+	if s == "" {
+		s = d.Name
+	}
+	return &APIErr{
+		Code:     uint64(d.Code),
+		Err:      errors.New(s),
+		Public:   d.Public,
+		Severity: d.Severity.Uint64()}
+}
+
+func RegisterErrCode(d ErrCodeDefinition) error {
+	return DefaultErrCodes.Register(d)
+}
+
+func MustRegisterErrCode(d ErrCodeDefinition) APIErrCode {
+	return DefaultErrCodes.MustRegister(d)
+}
+
+func NewErr(c APIErrCode, format string, a ...interface{}) *APIErr {
+	return DefaultErrCodes.NewErr(c, format, a...)
+}
@@ -0,0 +1,52 @@
+package a5gapi
+
+import "testing"
+
+func TestErrCodesRegister(t *testing.T) {
+	r := NewErrCodes()
+	var a = []struct {
+		in ErrCodeDefinition
+		ok bool
+	}{
+		{ErrCodeDefinition{Code: 4001, Name: "bad_request"}, true},
+		{ErrCodeDefinition{Code: 4001, Name: "bad_request_2"}, false},
+		{ErrCodeDefinition{Code: 4002, Name: "bad_request"}, false},
+		{ErrCodeDefinition{Code: ErrCodeDefaultDebug, Name: "kv"}, false},
+		{ErrCodeDefinition{Code: ErrCodeDefaultError, Name: "error"}, false},
+		{ErrCodeDefinition{Code: 0, Name: "zero"}, false},
+		{ErrCodeDefinition{Code: 4003}, false},
+	}
+	for _, v := range a {
+		if err := r.Register(v.in); (err == nil) != v.ok {
+			t.Errorf("Register(%+v) => %v want ok=%t", v.in, err, v.ok)
+		}
+	}
+}
+
+func TestErrCodesNewErr(t *testing.T) {
+	r := NewErrCodes()
+	c := r.MustRegister(ErrCodeDefinition{
+		Code:     4041,
+		Name:     "item_not_found",
+		Severity: ErrSeverityWarn,
+		Public:   true,
+		Message:  "item not found"})
+	var a = []struct {
+		code   APIErrCode
+		format string
+		args   []interface{}
+		msg    string
+		public bool
+	}{
+		{c, "", nil, "item not found", true},
+		{c, "id %d", []interface{}{7}, "item not found: id 7", true},
+		{4999, "x", nil, "unregistered error code 4999: x", false},
+	}
+	for _, v := range a {
+		e := r.NewErr(v.code, v.format, v.args...)
+		if e.Error() != v.msg || e.Public != v.public || e.Code != uint64(v.code) {
+			t.Errorf("NewErr(%d, %q) => %+v want %q public=%t",
+				v.code, v.format, e, v.msg, v.public)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package a5gapi
+
+import "context"
+
+type ctxKey int
+
+const (
+	ctxKeyRequestID ctxKey = iota
+	ctxKeyAccountID
+	ctxKeyRoute
+	ctxKeyAPIVersion
+)
+
+// ContextWithRequestID stores the correlation id copied into responses
+// built by Responder.
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, ctxKeyRequestID, requestID)
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	s, _ := ctx.Value(ctxKeyRequestID).(string)
+	return s
+}
+
+// ContextWithAccountID tags errors logged by LogErrs with the account the
+// request is made by.
+func ContextWithAccountID(ctx context.Context, accountID uint64) context.Context {
+	return context.WithValue(ctx, ctxKeyAccountID, accountID)
+}
+
+func AccountIDFromContext(ctx context.Context) uint64 {
+	if ctx == nil {
+		return 0
+	}
+	i, _ := ctx.Value(ctxKeyAccountID).(uint64)
+	return i
+}
+
+// ContextWithRoute tags errors logged by LogErrs with the handling route.
+func ContextWithRoute(ctx context.Context, route string) context.Context {
+	return context.WithValue(ctx, ctxKeyRoute, route)
+}
+
+func RouteFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	s, _ := ctx.Value(ctxKeyRoute).(string)
+	return s
+}
+
+// ContextWithAPIVersion stores the negotiated envelope version for
+// handlers serving several versions.
+func ContextWithAPIVersion(ctx context.Context, v uint64) context.Context {
+	return context.WithValue(ctx, ctxKeyAPIVersion, v)
+}
+
+func APIVersionFromContext(ctx context.Context) uint64 {
+	if ctx == nil {
+		return 0
+	}
+	i, _ := ctx.Value(ctxKeyAPIVersion).(uint64)
+	return i
+}
@@ -0,0 +1,116 @@
+package a5gapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Projection builds a sparse payload of v containing only fields. Register
+// one for hot payload types where the generic json based selection is too
+// slow.
+type Projection func(v interface{}, fields []string) (interface{}, error)
+
+var (
+	projectionsMu sync.RWMutex
+	projections   = make(map[reflect.Type]Projection)
+)
+
+// RegisterProjection sets p for the dynamic type of sample.
+func RegisterProjection(sample interface{}, p Projection) {
+	projectionsMu.Lock()
+	projections[reflect.TypeOf(sample)] = p
+	projectionsMu.Unlock()
+}
+
+// ParseFields splits "name,score,entries.name" of a fields parameter.
+func ParseFields(s string) []string {
+	var a []string
+	for _, x := range strings.Split(s, ",") {
+		if x = strings.TrimSpace(x); x != "" {
+			a = append(a, x)
+		}
+	}
+	return a
+}
+
+// SelectFields keeps only fields (json names, dotted for nested objects)
+// of payload v. Arrays are filtered element-wise, so "entries.name" of
+// {"entries":[{"name":..,"score":..}]} keeps names only. Without fields v
+// is returned as is.
+func SelectFields(v interface{}, fields []string) (interface{}, error) {
+	if len(fields) == 0 || v == nil {
+		return v, nil
+	}
+	projectionsMu.RLock()
+	p, ok := projections[reflect.TypeOf(v)]
+	projectionsMu.RUnlock()
+	if ok {
+		return p(v, fields)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var x interface{}
+	if err = d.Decode(&x); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	t := make(fieldTree)
+	for _, s := range fields {
+		t.add(strings.Split(s, "."))
+	}
+	return t.apply(x), nil
+}
+
+// fieldTree is a set of selected names; an empty subtree selects the whole
+// value.
+type fieldTree map[string]fieldTree
+
+func (t fieldTree) add(path []string) {
+	if len(path) == 0 || path[0] == "" {
+		return
+	}
+	sub, ok := t[path[0]]
+	if ok && len(sub) == 0 {
+		return
+	}
+	if len(path) == 1 {
+		t[path[0]] = make(fieldTree)
+		return
+	}
+	if !ok {
+		sub = make(fieldTree)
+		t[path[0]] = sub
+	}
+	sub.add(path[1:])
+}
+
+func (t fieldTree) apply(x interface{}) interface{} {
+	if len(t) == 0 {
+		return x
+	}
+	switch v := x.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, sub := range t {
+			if y, ok := v[k]; ok {
+				m[k] = sub.apply(y)
+			}
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, y := range v {
+			a[i] = t.apply(y)
+		}
+		return a
+	}
+	return x
+}
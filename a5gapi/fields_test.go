@@ -0,0 +1,40 @@
+package a5gapi
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSelectFields(t *testing.T) {
+	type entry struct {
+		Name  string `json:"name"`
+		Score int    `json:"score"`
+	}
+	payload := &struct {
+		Season  int     `json:"season"`
+		Entries []entry `json:"entries"`
+	}{3, []entry{{"a", 10}, {"b", 9}}}
+	var a = []struct {
+		fields string
+		out    string
+	}{
+		{"", `{"season":3,"entries":[{"name":"a","score":10},{"name":"b","score":9}]}`},
+		{"season", `{"season":3}`},
+		{"entries.name", `{"entries":[{"name":"a"},{"name":"b"}]}`},
+		{"entries.name, entries", `{"entries":[{"name":"a","score":10},{"name":"b","score":9}]}`},
+		{"season,missing,entries.missing", `{"entries":[{},{}],"season":3}`},
+	}
+	for _, v := range a {
+		x, err := SelectFields(payload, ParseFields(v.fields))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := json.Marshal(x)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != v.out {
+			t.Errorf("SelectFields(%q) => %s want %s", v.fields, b, v.out)
+		}
+	}
+}
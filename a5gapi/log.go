@@ -0,0 +1,71 @@
+package a5gapi
+
+import (
+	"context"
+
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5glogs"
+)
+
+// LogErrs logs errs (all of them, before the public filtering of
+// NewMsgResponse) at the level of their severity, tagged with request id,
+// account id and route of ctx. Fatal and panic severities are logged as
+// errors, they describe the request, not the process.
+func LogErrs(ctx context.Context, l a5glogs.Logger, errs ...*APIErr) {
+	if len(errs) == 0 {
+		return
+	}
+	var a []a5gfields.Field
+	if s := RequestIDFromContext(ctx); s != "" {
+		a = append(a, a5gfields.String("reqID", s))
+	}
+	if i := AccountIDFromContext(ctx); i != 0 {
+		a = append(a, a5gfields.Int64("accountID", int64(i)))
+	}
+	if s := RouteFromContext(ctx); s != "" {
+		a = append(a, a5gfields.String("route", s))
+	}
+	if len(a) != 0 {
+		l = l.With(a...)
+	}
+	for _, e := range errs {
+		if e == nil || e.Err == nil {
+			continue
+		}
+		s := ErrSeverity(e.Severity)
+		x := l.With(
+			a5gfields.Int64("errCode", int64(e.Code)),
+			a5gfields.String("severity", s.String()))
+		if e.Field != "" {
+			x = x.With(a5gfields.String("field", e.Field))
+		}
+		switch s {
+		case ErrSeverityDebug:
+			x.Debug(e.Error())
+		case ErrSeverityWarn:
+			x.Warn(e.Error())
+		case ErrSeverityError, ErrSeverityFatal, ErrSeverityPanic:
+			x.Error(e.Error())
+		default:
+			x.Info(e.Error())
+		}
+	}
+}
+
+func (v ErrSeverity) String() string {
+	switch v {
+	case ErrSeverityDebug:
+		return "debug"
+	case ErrSeverityInfo:
+		return "info"
+	case ErrSeverityWarn:
+		return "warn"
+	case ErrSeverityError:
+		return "error"
+	case ErrSeverityFatal:
+		return "fatal"
+	case ErrSeverityPanic:
+		return "panic"
+	}
+	return "unknown"
+}
@@ -0,0 +1,57 @@
+package a5gapi
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+type testLogger struct {
+	fields map[string]string
+	lines  *[]string
+}
+
+func (l *testLogger) With(a ...a5gfields.Field) a5glogs.Logger {
+	m := make(map[string]string)
+	for k, v := range l.fields {
+		m[k] = v
+	}
+	for _, v := range a {
+		m[v.Key()] = v.Value()
+	}
+	return &testLogger{fields: m, lines: l.lines}
+}
+
+func (l *testLogger) log(level, s string) {
+	*l.lines = append(*l.lines, level+" "+s+" "+l.fields["reqID"]+" "+
+		l.fields["accountID"]+" "+l.fields["route"]+" "+l.fields["errCode"])
+}
+
+func (l *testLogger) Debug(s string, _ ...a5gfields.Field) { l.log("debug", s) }
+func (l *testLogger) Info(s string, _ ...a5gfields.Field)  { l.log("info", s) }
+func (l *testLogger) Warn(s string, _ ...a5gfields.Field)  { l.log("warn", s) }
+func (l *testLogger) Error(s string, _ ...a5gfields.Field) { l.log("error", s) }
+func (l *testLogger) Panic(s string, _ ...a5gfields.Field) { l.log("panic", s) }
+func (l *testLogger) Fatal(s string, _ ...a5gfields.Field) { l.log("fatal", s) }
+
+func TestLogErrs(t *testing.T) {
+	var lines []string
+	ctx := ContextWithRoute(ContextWithAccountID(
+		ContextWithRequestID(context.Background(), "r1"), 7), "POST /buy")
+	LogErrs(ctx, &testLogger{lines: &lines},
+		&APIErr{Code: 1100, Severity: ErrSeverityDebug.Uint64(), Err: errors.New("kv")},
+		&APIErr{Code: 4000, Severity: ErrSeverityWarn.Uint64(), Err: errors.New("bad")},
+		&APIErr{Code: 5100, Severity: ErrSeverityPanic.Uint64(), Err: errors.New("boom")},
+		&APIErr{Code: 5100, Severity: ErrSeverityError.Uint64()})
+	want := []string{
+		"debug kv r1 7 POST /buy 1100",
+		"warn bad r1 7 POST /buy 4000",
+		"error boom r1 7 POST /buy 5100"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("LogErrs => %q want %q", lines, want)
+	}
+}
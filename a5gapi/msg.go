@@ -10,15 +10,33 @@ import (
 )
 
 type APIMsgRequest struct {
-	Payload interface{} `json:"payload,omitempty"`
-	Time    uint64      `json:"time,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
+	// APIVersion is the envelope version the client speaks, zero is the
+	// first version.
+	APIVersion uint64 `json:"apiVersion,omitempty"`
+	// Fields asks for a sparse response payload, see SelectFields.
+	Fields []string `json:"fields,omitempty"`
+	// IfVersion and IfUnmodifiedSince (unix seconds) are preconditions of
+	// mutating requests, see CheckPreconditions.
+	IfVersion         uint64       `json:"ifVersion,omitempty"`
+	IfUnmodifiedSince uint64       `json:"ifUnmodifiedSince,omitempty"`
+	Page              *PageRequest `json:"page,omitempty"`
+	Payload           interface{}  `json:"payload,omitempty"`
+	Time              uint64       `json:"time,omitempty"`
 }
 
 type APIMsgResponse APIMsg
 
 type APIMsg struct {
-	Success bool        `json:"success"`
-	Errs    []*APIErr   `json:"messages,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
+	// APIVersion is the version the server answered with.
+	APIVersion uint64    `json:"apiVersion,omitempty"`
+	Success    bool      `json:"success"`
+	Errs       []*APIErr `json:"messages,omitempty"`
+	// Meta is an key-values for the client which, unlike the legacy
+	// "key:value" messages of a ResponseMessenger, are never stripped.
+	Meta    KV          `json:"meta,omitempty"`
+	Page    *Page       `json:"page,omitempty"`
 	Payload interface{} `json:"payload,omitempty"`
 	Time    uint64      `json:"time,omitempty"`
 }
@@ -26,8 +44,11 @@ type APIMsg struct {
 type APIErrs []*APIErr
 
 type APIErr struct {
-	Code     uint64 `json:"code"`
-	Err      error  `json:"message,omitempty"`
+	Code uint64 `json:"code"`
+	Err  error  `json:"message,omitempty"`
+	// Field is a path of the request payload field the error is about, e.g.
+	// "items[2].count".
+	Field    string `json:"field,omitempty"`
 	Public   bool   `json:"-"`
 	Severity uint64 `json:"-"`
 }
@@ -138,10 +159,12 @@ func (e *APIErr) MarshalJSON() ([]byte, error) {
 	return json.Marshal(&struct {
 		Code       uint64   `json:"code,omitempty"`
 		Message    string   `json:"message,omitempty"`
+		Field      string   `json:"field,omitempty"`
 		StackTrace []string `json:"stackTrace,omitempty"`
 	}{
 		Code:       e.Code,
 		Message:    s,
+		Field:      e.Field,
 		StackTrace: a})
 }
 
@@ -149,29 +172,49 @@ func (e *APIErr) UnmarshalJSON(b []byte) error {
 	s := &struct {
 		Code    uint64 `json:"code"`
 		Message string `json:"message"`
+		Field   string `json:"field"`
 	}{}
 	if err := json.Unmarshal(b, &s); err != nil {
 		return err
 	}
 	e.Code = s.Code
+	e.Field = s.Field
 	if s.Message != "" {
 		e.Err = errors.New(s.Message)
 	}
 	return nil
 }
 
+// KV returns Meta key-values and falls back to the legacy format embedded
+// into messages with ErrCodeDefaultDebug code.
 func (a *APIMsg) KV() (KV, error) {
 	if a == nil {
 		return nil, errors.New("empty api response")
 	}
-	if len(a.Errs) == 0 {
+	if len(a.Meta) > 0 {
+		return a.Meta, nil
+	}
+	return LegacyKV(a.Errs)
+}
+
+func (a *APIMsgResponse) KV() (KV, error) { return (*APIMsg)(a).KV() }
+
+// LegacyKV parses key-values encoded as "key:value" messages. Keys
+// containing ":" can not be represented in this format.
+func LegacyKV(errs []*APIErr) (KV, error) {
+	if len(errs) == 0 {
 		return nil, errors.New("empty key values")
 	}
 	kv := NewKV()
-	for _, e := range a.Errs {
+	for _, e := range errs {
 		if e.Code != uint64(ErrCodeDefaultDebug) {
 			continue
 		}
+		if e.Err == nil {
+			// Stripped by non-debug server: key-values were present but
+			// are not exposed.
+			continue
+		}
 		if e.Error() == "" {
 			return nil, errors.New("empty kv")
 		}
@@ -187,6 +230,33 @@ func (a *APIMsg) KV() (KV, error) {
 	return kv, nil
 }
 
+// MigrateLegacyKV moves legacy "key:value" messages into Meta and removes
+// them from Errs. Messages which can not be parsed are kept.
+func (a *APIMsg) MigrateLegacyKV() {
+	if a == nil {
+		return
+	}
+	var errs []*APIErr
+	for _, e := range a.Errs {
+		if e.Code != uint64(ErrCodeDefaultDebug) || e.Err == nil {
+			errs = append(errs, e)
+			continue
+		}
+		x := strings.SplitN(e.Error(), ":", 2)
+		if len(x) != 2 || x[0] == "" {
+			errs = append(errs, e)
+			continue
+		}
+		if a.Meta == nil {
+			a.Meta = NewKV()
+		}
+		if _, ok := a.Meta[x[0]]; !ok {
+			a.Meta[x[0]] = x[1]
+		}
+	}
+	a.Errs = errs
+}
+
 func NewMsgRequest(
 	responsePayload interface{}) (*APIMsgRequest, error) {
 	return &APIMsgRequest{
@@ -234,7 +304,9 @@ func newMsgResponseErrs(
 	debugLevel int,
 	responseMessenger ResponseMessenger,
 	errs ...*APIErr) ([]*APIErr, error) {
-	errs = append(errs, responseMessenger.ResponseMessages()...)
+	if responseMessenger != nil {
+		errs = append(errs, responseMessenger.ResponseMessages()...)
+	}
 	var publicErrs []*APIErr
 	if debugLevel > 0 {
 		for _, x := range errs {
@@ -242,6 +314,7 @@ func newMsgResponseErrs(
 				&APIErr{
 					Code:     x.Code,
 					Err:      errors.New(x.Error()),
+					Field:    x.Field,
 					Public:   x.Public,
 					Severity: x.Severity})
 		}
@@ -253,6 +326,7 @@ func newMsgResponseErrs(
 					&APIErr{
 						Code:     x.Code,
 						Err:      errors.New(x.Error()),
+						Field:    x.Field,
 						Public:   x.Public,
 						Severity: x.Severity})
 
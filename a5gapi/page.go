@@ -0,0 +1,33 @@
+package a5gapi
+
+// PageRequest asks a list endpoint for the page after Cursor (the first
+// page without one) of at most Limit items.
+type PageRequest struct {
+	Cursor string `json:"cursor,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+}
+
+// Page describes the page a response payload holds. Cursor is the cursor
+// of the next page and is empty on the last one; Total is set by endpoints
+// that can count cheaply.
+type Page struct {
+	Cursor  string `json:"cursor,omitempty"`
+	Limit   int    `json:"limit"`
+	Total   *int64 `json:"total,omitempty"`
+	HasMore bool   `json:"hasMore"`
+}
+
+// Paged is a handler payload of a list endpoint: transports send Items as
+// the payload and Page in the envelope.
+type Paged struct {
+	Items interface{}
+	Page  *Page
+}
+
+// UnwrapPaged splits a Paged payload, other payloads are returned as is.
+func UnwrapPaged(payload interface{}) (interface{}, *Page) {
+	if p, ok := payload.(*Paged); ok && p != nil {
+		return p.Items, p.Page
+	}
+	return payload, nil
+}
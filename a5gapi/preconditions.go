@@ -0,0 +1,44 @@
+package a5gapi
+
+import "time"
+
+var ErrCodePreconditionFailed = MustRegisterErrCode(ErrCodeDefinition{
+	Code:     4120,
+	Name:     "precondition_failed",
+	Severity: ErrSeverityWarn,
+	Public:   true,
+	Message:  "precondition failed"})
+
+// PreconditionFailure is the payload of a response rejected by
+// CheckPreconditions, it tells a stale client what to reload.
+type PreconditionFailure struct {
+	Version    uint64 `json:"version"`
+	ModifiedAt uint64 `json:"modifiedAt,omitempty"`
+}
+
+// CheckPreconditions compares request IfVersion and IfUnmodifiedSince with
+// the current player state version (e.g. UserDataVersion) and its last
+// modification time. Mutating handlers return both results as is when the
+// error is not nil:
+//
+//	if p, e := req.CheckPreconditions(v, t); e != nil {
+//		return p, []*a5gapi.APIErr{e}
+//	}
+func (r *APIMsgRequest) CheckPreconditions(
+	version uint64, modifiedAt time.Time) (*PreconditionFailure, *APIErr) {
+	var m uint64
+	if !modifiedAt.IsZero() {
+		m = uint64(modifiedAt.Unix())
+	}
+	switch {
+	case r.IfVersion != 0 && r.IfVersion != version:
+		return &PreconditionFailure{Version: version, ModifiedAt: m},
+			NewErr(ErrCodePreconditionFailed,
+				"version %d, current %d", r.IfVersion, version)
+	case r.IfUnmodifiedSince != 0 && m > r.IfUnmodifiedSince:
+		return &PreconditionFailure{Version: version, ModifiedAt: m},
+			NewErr(ErrCodePreconditionFailed,
+				"modified at %d, after %d", m, r.IfUnmodifiedSince)
+	}
+	return nil, nil
+}
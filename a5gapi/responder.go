@@ -0,0 +1,81 @@
+package a5gapi
+
+import (
+	"context"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+// Configer is the part of server configuration responses depend on.
+type Configer interface {
+	// DebugLevel above zero exposes private errors to clients.
+	DebugLevel() int
+}
+
+// ErrLocalizer translates an error message of a response for the client
+// of ctx, ok is false when there is no translation.
+type ErrLocalizer interface {
+	LocalizeErr(ctx context.Context, e *APIErr) (msg string, ok bool)
+}
+
+// Responder builds API messages with server configuration it was
+// constructed with, so handlers need no debug level plumbing.
+type Responder struct {
+	// Localizer, when set, translates messages of response errors.
+	Localizer ErrLocalizer
+
+	config Configer
+	logger a5glogs.Logger
+}
+
+func NewResponder(c Configer, l a5glogs.Logger) (*Responder, error) {
+	if c == nil {
+		return nil, errors.New("config missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Responder{config: c, logger: l}, nil
+}
+
+// NewRequest is NewMsgRequest carrying request id of ctx (if any) to the
+// next service.
+func (r *Responder) NewRequest(
+	ctx context.Context, requestPayload interface{}) (*APIMsgRequest, error) {
+	req, err := NewMsgRequest(requestPayload)
+	if err != nil {
+		return nil, err
+	}
+	req.RequestID = RequestIDFromContext(ctx)
+	return req, nil
+}
+
+// NewResponse is NewMsgResponse with the configured debug level and the
+// request id and API version of ctx. All errors, including private ones
+// hidden from the client, are logged by LogErrs before localization.
+func (r *Responder) NewResponse(
+	ctx context.Context,
+	isSuccess bool,
+	responsePayload interface{},
+	responseMessenger ResponseMessenger,
+	errs ...*APIErr) (*APIMsgResponse, error) {
+	debugLevel := r.config.DebugLevel()
+	LogErrs(ctx, r.logger, errs...)
+	res, err := NewMsgResponse(
+		debugLevel, isSuccess, responsePayload, responseMessenger, errs...)
+	if err != nil {
+		return nil, err
+	}
+	res.RequestID = RequestIDFromContext(ctx)
+	res.APIVersion = APIVersionFromContext(ctx)
+	if r.Localizer != nil {
+		for _, e := range res.Errs {
+			// Response errors are copies, handler errors stay intact.
+			if s, ok := r.Localizer.LocalizeErr(ctx, e); ok {
+				e.Err = errors.New(s)
+			}
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,247 @@
+package a5gapp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+// Module is an application part with a lifecycle, e.g. DB pools, sessions,
+// HTTP router. Start must return once the module is ready to serve.
+type Module interface {
+	Name() string
+	Start(context.Context) error
+	Stop(context.Context) error
+}
+
+// ModuleError tells which module failed and in which phase.
+type ModuleError struct {
+	Module string
+	Phase  string
+	Err    error
+}
+
+func (e *ModuleError) Error() string {
+	return fmt.Sprintf("module %q %s: %s", e.Module, e.Phase, e.Err.Error())
+}
+
+func (e *ModuleError) Cause() error { return e.Err }
+
+type entry struct {
+	module       Module
+	dependsOn    []string
+	startTimeout time.Duration
+	stopTimeout  time.Duration
+}
+
+// App starts modules in dependency order and stops them in reverse.
+type App struct {
+	Logger       a5glogs.Logger
+	StartTimeout time.Duration
+	StopTimeout  time.Duration
+
+	mu          sync.Mutex
+	names       []string
+	entries     map[string]*entry
+	started     []string
+	subscribers subscribers
+}
+
+func NewApp(l a5glogs.Logger) (*App, error) {
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &App{
+		Logger:       l,
+		StartTimeout: 30 * time.Second,
+		StopTimeout:  30 * time.Second,
+		entries:      make(map[string]*entry)}, nil
+}
+
+// Register adds a module started after the modules it depends on. Modules
+// implementing Router, Subscriber or Migrator plug into the server
+// through Routes, Publish and Migrate.
+func (a *App) Register(m Module, dependsOn ...string) error {
+	if m == nil {
+		return errors.New("nil module")
+	}
+	name := m.Name()
+	if name == "" {
+		return errors.New("empty module name")
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.entries[name]; ok {
+		return errors.Errorf("module %q already registered", name)
+	}
+	if x, ok := m.(Subscriber); ok {
+		if err := a.subscribers.add(x.Subscriptions()); err != nil {
+			return errors.Wrapf(err, "module %q", name)
+		}
+	}
+	a.entries[name] = &entry{module: m, dependsOn: dependsOn}
+	a.names = append(a.names, name)
+	return nil
+}
+
+// SetTimeouts overrides App.StartTimeout/StopTimeout for one module.
+func (a *App) SetTimeouts(name string, start, stop time.Duration) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	e, ok := a.entries[name]
+	if !ok {
+		return errors.Errorf("unknown module %q", name)
+	}
+	e.startTimeout, e.stopTimeout = start, stop
+	return nil
+}
+
+// Order returns modules names in start order. It fails on unknown
+// dependencies and cycles. Independent modules keep registration order.
+func (a *App) Order() ([]string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.order()
+}
+
+func (a *App) order() ([]string, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	var (
+		order []string
+		visit func(name string, path []string) error
+	)
+	visit = func(name string, path []string) error {
+		e, ok := a.entries[name]
+		if !ok {
+			return errors.Errorf("module %q depends on unknown module %q",
+				path[len(path)-1], name)
+		}
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			return errors.Errorf("module dependency cycle: %s",
+				strings.Join(append(path, name), " -> "))
+		}
+		state[name] = visiting
+		// Copied, so siblings never share a backing array.
+		next := append(append(make([]string, 0, len(path)+1), path...), name)
+		for _, d := range e.dependsOn {
+			if err := visit(d, next); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		order = append(order, name)
+		return nil
+	}
+	for _, name := range a.names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// Start starts every module. When one fails or times out, it is stopped
+// along with the started modules in reverse order, so it may release
+// what it acquired, and the start error is returned.
+func (a *App) Start(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	order, err := a.order()
+	if err != nil {
+		return err
+	}
+	for _, name := range order {
+		e := a.entries[name]
+		l := a.Logger.With(a5gfields.String("module", name))
+		t := time.Now()
+		a.started = append(a.started, name)
+		err = call(ctx, timeout(e.startTimeout, a.StartTimeout), e.module.Start)
+		if err != nil {
+			err = &ModuleError{Module: name, Phase: "start", Err: err}
+			l.Error(err.Error())
+			if stopErr := a.stop(ctx); stopErr != nil {
+				l.Error(stopErr.Error())
+			}
+			return err
+		}
+		l.With(a5gfields.Duration("elapsed", time.Since(t))).
+			Info("module started")
+	}
+	return nil
+}
+
+// Stop stops started modules in reverse order. All modules are given the
+// chance to stop; the first error is returned.
+func (a *App) Stop(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.stop(ctx)
+}
+
+func (a *App) stop(ctx context.Context) error {
+	var firstErr error
+	for i := len(a.started) - 1; i >= 0; i-- {
+		name := a.started[i]
+		e := a.entries[name]
+		l := a.Logger.With(a5gfields.String("module", name))
+		err := call(ctx, timeout(e.stopTimeout, a.StopTimeout), e.module.Stop)
+		if err != nil {
+			err = &ModuleError{Module: name, Phase: "stop", Err: err}
+			l.Error(err.Error())
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		l.Info("module stopped")
+	}
+	a.started = nil
+	return firstErr
+}
+
+func timeout(d, defaultDuration time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return defaultDuration
+}
+
+// call runs fn with deadline d and gives up waiting (reporting timeout)
+// if fn ignores context cancellation.
+func call(ctx context.Context, d time.Duration,
+	fn func(context.Context) error) error {
+	if d > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+	errc := make(chan error, 1)
+	go func() {
+		defer func() {
+			if v := recover(); v != nil {
+				errc <- errors.Errorf("panic: %v", v)
+			}
+		}()
+		errc <- fn(ctx)
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
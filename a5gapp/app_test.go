@@ -0,0 +1,123 @@
+package a5gapp
+
+import (
+	"context"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+type testModule struct {
+	name     string
+	startErr error
+	log      *[]string
+}
+
+func (m *testModule) Name() string { return m.name }
+
+func (m *testModule) Start(context.Context) error {
+	if m.startErr != nil {
+		return m.startErr
+	}
+	*m.log = append(*m.log, "start "+m.name)
+	return nil
+}
+
+func (m *testModule) Stop(context.Context) error {
+	*m.log = append(*m.log, "stop "+m.name)
+	return nil
+}
+
+func newTestApp(t *testing.T) *App {
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	a, err := NewApp(a5glogs.NewLogrusWrapper(l))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestAppStartStop(t *testing.T) {
+	var log []string
+	a := newTestApp(t)
+	var modules = []struct {
+		name string
+		deps []string
+	}{
+		{"router", []string{"sessions"}},
+		{"sessions", []string{"db"}},
+		{"db", nil},
+	}
+	for _, v := range modules {
+		if err := a.Register(&testModule{name: v.name, log: &log}, v.deps...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"start db", "start sessions", "start router",
+		"stop router", "stop sessions", "stop db"}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("App lifecycle => %q want %q", log, want)
+	}
+}
+
+func TestAppStartFailure(t *testing.T) {
+	var log []string
+	a := newTestApp(t)
+	if err := a.Register(&testModule{name: "db", log: &log}); err != nil {
+		t.Fatal(err)
+	}
+	failing := &testModule{name: "cache", log: &log, startErr: errors.New("boom")}
+	if err := a.Register(failing, "db"); err != nil {
+		t.Fatal(err)
+	}
+	err := a.Start(context.Background())
+	if e, ok := err.(*ModuleError); !ok || e.Module != "cache" || e.Phase != "start" {
+		t.Fatalf("Start() => %v want cache start error", err)
+	}
+	want := []string{"start db", "stop cache", "stop db"}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("App lifecycle => %q want %q", log, want)
+	}
+}
+
+func TestAppOrderErrors(t *testing.T) {
+	var log []string
+	a := newTestApp(t)
+	for _, v := range [][]string{{"a", "b"}, {"b", "c"}, {"c", "a"}} {
+		if err := a.Register(&testModule{name: v[0], log: &log}, v[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := a.Order(); err == nil {
+		t.Error("Order() => <nil> want dependency cycle error")
+	}
+	a = newTestApp(t)
+	for _, v := range [][]string{{"a", "b", "c"}, {"b"}, {"c", "d"}, {"d", "a"}} {
+		if err := a.Register(&testModule{name: v[0], log: &log}, v[1:]...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := a.Order()
+	if want := "module dependency cycle: a -> c -> d -> a"; err == nil || err.Error() != want {
+		t.Errorf("Order() => %v want %q", err, want)
+	}
+	a = newTestApp(t)
+	if err = a.Register(&testModule{name: "a", log: &log}, "missing"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = a.Order(); err == nil {
+		t.Error("Order() => <nil> want unknown module error")
+	}
+}
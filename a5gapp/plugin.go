@@ -0,0 +1,255 @@
+package a5gapp
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+// Route is an API route of a module, Pattern in chi syntax.
+type Route struct {
+	Method  string
+	Pattern string
+	Handler a5ghttp.HandlerFunc
+}
+
+// Subscription handles events of a name published with App.Publish.
+type Subscription struct {
+	Event  string
+	Handle func(ctx context.Context, payload interface{}) error
+}
+
+// Migration changes storage of a module once, ID is unique per module
+// and Up must be safe to run again when it failed halfway.
+type Migration struct {
+	ID string
+	Up func(ctx context.Context) error
+}
+
+// Modules registered with App.Register may implement these hooks to plug
+// game-specific routes, event handlers and migrations, e.g. of custom
+// quests or economy rules, into the server without forking it.
+type (
+	Router interface {
+		Routes() []*Route
+	}
+	Subscriber interface {
+		Subscriptions() []*Subscription
+	}
+	Migrator interface {
+		Migrations() []*Migration
+	}
+)
+
+// subscribers are kept apart from entries, so modules may publish while
+// App.Start holds its lock.
+type subscribers struct {
+	mu sync.RWMutex
+	m  map[string][]*Subscription
+}
+
+func (s *subscribers) add(a []*Subscription) error {
+	for _, x := range a {
+		if x == nil || x.Event == "" || x.Handle == nil {
+			return errors.New("empty subscription")
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.m == nil {
+		s.m = make(map[string][]*Subscription)
+	}
+	for _, x := range a {
+		s.m[x.Event] = append(s.m[x.Event], x)
+	}
+	return nil
+}
+
+// Publish hands payload to every subscription of event in registration
+// order. Every subscription is called; the first error is returned.
+func (a *App) Publish(ctx context.Context, event string, payload interface{}) error {
+	a.subscribers.mu.RLock()
+	subs := a.subscribers.m[event]
+	a.subscribers.mu.RUnlock()
+	var firstErr error
+	for _, x := range subs {
+		if err := x.Handle(ctx, payload); err != nil {
+			err = errors.Wrapf(err, "event %q", event)
+			a.Logger.Error(err.Error())
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// Routes returns routes of modules in start order for the server to
+// mount, e.g. with an a5ghttp.Adapter. Routes of different modules may
+// not collide.
+func (a *App) Routes() ([]*Route, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	order, err := a.order()
+	if err != nil {
+		return nil, err
+	}
+	var routes []*Route
+	owner := make(map[string]string)
+	for _, name := range order {
+		r, ok := a.entries[name].module.(Router)
+		if !ok {
+			continue
+		}
+		for _, x := range r.Routes() {
+			if x == nil || x.Method == "" || x.Pattern == "" || x.Handler == nil {
+				return nil, errors.Errorf("module %q: empty route", name)
+			}
+			k := x.Method + " " + x.Pattern
+			if m, ok := owner[k]; ok {
+				return nil, errors.Errorf("route %q of module %q already of %q", k, name, m)
+			}
+			owner[k] = name
+			routes = append(routes, x)
+		}
+	}
+	return routes, nil
+}
+
+// MigrationStore records applied migrations per module.
+type MigrationStore interface {
+	Applied(module string) (map[string]bool, error)
+	Record(module, id string, at int64) error
+}
+
+// Migrate runs migrations of modules which were not applied yet, in
+// start order and in module order within a module; run it before Start.
+func (a *App) Migrate(ctx context.Context, s MigrationStore) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	order, err := a.order()
+	if err != nil {
+		return err
+	}
+	for _, name := range order {
+		m, ok := a.entries[name].module.(Migrator)
+		if !ok {
+			continue
+		}
+		if err = a.migrate(ctx, s, name, m.Migrations()); err != nil {
+			return &ModuleError{Module: name, Phase: "migrate", Err: err}
+		}
+	}
+	return nil
+}
+
+func (a *App) migrate(
+	ctx context.Context, s MigrationStore, name string, migrations []*Migration) error {
+	applied, err := s.Applied(name)
+	if err != nil {
+		return err
+	}
+	for _, x := range migrations {
+		if x == nil || x.ID == "" || x.Up == nil {
+			return errors.New("empty migration")
+		}
+		if applied[x.ID] {
+			continue
+		}
+		if err = ctx.Err(); err != nil {
+			return errors.WithStack(err)
+		}
+		if err = x.Up(ctx); err != nil {
+			return errors.Wrapf(err, "migration %q", x.ID)
+		}
+		if err = s.Record(name, x.ID, time.Now().Unix()); err != nil {
+			return err
+		}
+		applied[x.ID] = true
+		a.Logger.With(a5gfields.String("module", name),
+			a5gfields.String("migration", x.ID)).Info("migration applied")
+	}
+	return nil
+}
+
+type memoryMigrationStore struct {
+	mu      sync.Mutex
+	applied map[string]map[string]bool
+}
+
+func NewMemoryMigrationStore() MigrationStore {
+	return &memoryMigrationStore{applied: make(map[string]map[string]bool)}
+}
+
+func (s *memoryMigrationStore) Applied(module string) (map[string]bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := make(map[string]bool, len(s.applied[module]))
+	for id := range s.applied[module] {
+		m[id] = true
+	}
+	return m, nil
+}
+
+func (s *memoryMigrationStore) Record(module, id string, at int64) error {
+	s.mu.Lock()
+	if s.applied[module] == nil {
+		s.applied[module] = make(map[string]bool)
+	}
+	s.applied[module][id] = true
+	s.mu.Unlock()
+	return nil
+}
+
+// dbMigrationStore keeps applied migrations in a MySQL table:
+//
+//	CREATE TABLE app_migrations (
+//	  module VARCHAR(64) NOT NULL,
+//	  id VARCHAR(64) NOT NULL,
+//	  applied_at BIGINT NOT NULL,
+//	  PRIMARY KEY (module, id));
+type dbMigrationStore struct {
+	pooler    a5gdb.Pooler
+	tableName string
+}
+
+func NewDBMigrationStore(p a5gdb.Pooler, tableName string) (MigrationStore, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if tableName == "" {
+		return nil, errors.New("empty migrations table name")
+	}
+	return &dbMigrationStore{pooler: p, tableName: tableName}, nil
+}
+
+func (s *dbMigrationStore) Applied(module string) (map[string]bool, error) {
+	var ids []string
+	_, err := s.pooler.ReadPool().NewSession().
+		Select("id").From(s.tableName).
+		Where(dbr.Eq("module", module)).Load(&ids)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	m := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		m[id] = true
+	}
+	return m, nil
+}
+
+func (s *dbMigrationStore) Record(module, id string, at int64) error {
+	_, err := s.pooler.WritePool().NewSession().InsertBySql("INSERT IGNORE INTO "+
+		s.tableName+" (module, id, applied_at) VALUES (?, ?, ?)",
+		module, id, at).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	return nil
+}
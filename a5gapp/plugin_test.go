@@ -0,0 +1,103 @@
+package a5gapp
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/pkg/errors"
+)
+
+type testPlugin struct {
+	testModule
+	routes     []*Route
+	events     []string
+	migrations []*Migration
+}
+
+func (p *testPlugin) Routes() []*Route { return p.routes }
+
+func (p *testPlugin) Subscriptions() []*Subscription {
+	return []*Subscription{{Event: "quest_done",
+		Handle: func(ctx context.Context, payload interface{}) error {
+			p.events = append(p.events, p.name+" "+payload.(string))
+			return nil
+		}}}
+}
+
+func (p *testPlugin) Migrations() []*Migration { return p.migrations }
+
+func TestAppPlugins(t *testing.T) {
+	var log []string
+	a := newTestApp(t)
+	handler := func(context.Context, *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		return nil, nil
+	}
+	fail := true
+	quests := &testPlugin{
+		testModule: testModule{name: "quests", log: &log},
+		routes:     []*Route{{Method: "POST", Pattern: "/quests/claim", Handler: handler}},
+		migrations: []*Migration{
+			{ID: "1_create", Up: func(context.Context) error {
+				log = append(log, "migrate quests 1")
+				return nil
+			}},
+			{ID: "2_index", Up: func(context.Context) error {
+				if fail {
+					return errors.New("lock wait timeout")
+				}
+				log = append(log, "migrate quests 2")
+				return nil
+			}}}}
+	economy := &testPlugin{
+		testModule: testModule{name: "economy", log: &log},
+		routes:     []*Route{{Method: "GET", Pattern: "/economy/rules", Handler: handler}}}
+	if err := a.Register(quests, "economy"); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Register(economy); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewMemoryMigrationStore()
+	err := a.Migrate(context.Background(), s)
+	if e, ok := err.(*ModuleError); !ok || e.Module != "quests" || e.Phase != "migrate" {
+		t.Fatalf("Migrate() => %v want quests migrate error", err)
+	}
+	fail = false
+	for i := 0; i < 2; i++ {
+		if err = a.Migrate(context.Background(), s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"migrate quests 1", "migrate quests 2"}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("migrations => %q want %q", log, want)
+	}
+
+	routes, err := a.Routes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 2 || routes[0].Pattern != "/economy/rules" ||
+		routes[1].Pattern != "/quests/claim" {
+		t.Errorf("unexpected routes %+v", routes)
+	}
+	economy.routes = append(economy.routes, quests.routes[0])
+	if _, err = a.Routes(); err == nil {
+		t.Error("Routes() => <nil> want collision error")
+	}
+
+	if err = a.Publish(context.Background(), "quest_done", "q1"); err != nil {
+		t.Fatal(err)
+	}
+	if err = a.Publish(context.Background(), "unknown", "q2"); err != nil {
+		t.Fatal(err)
+	}
+	if len(quests.events) != 1 || len(economy.events) != 1 ||
+		economy.events[0] != "economy q1" {
+		t.Errorf("unexpected events %q %q", quests.events, economy.events)
+	}
+}
@@ -0,0 +1,213 @@
+package a5garchive
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+var ErrPolicyUnknown = errors.New("archive policy unknown")
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Policy moves rows of HotTable older than Age, by TimeColumn, into
+// ColdTable of the same columns, e.g. old mail, expired listings and
+// finished matches. KeyColumn is the primary key rows are moved by in
+// batches of BatchSize. TimeColumn holds unix seconds when Unix, DATETIME
+// otherwise.
+type Policy struct {
+	Name       string
+	HotTable   string
+	ColdTable  string
+	KeyColumn  string
+	TimeColumn string
+	Unix       bool
+	Age        time.Duration
+	BatchSize  int
+}
+
+func (p *Policy) validate() error {
+	if p.Name == "" {
+		return errors.New("empty archive policy name")
+	}
+	for _, s := range []string{p.HotTable, p.ColdTable, p.KeyColumn, p.TimeColumn} {
+		if !identifier.MatchString(s) {
+			return errors.Errorf("archive policy %q: invalid identifier %q", p.Name, s)
+		}
+	}
+	if p.Age <= 0 || p.BatchSize < 1 {
+		return errors.Errorf("archive policy %q: no age or batch size", p.Name)
+	}
+	return nil
+}
+
+// Row is a table row by column name.
+type Row map[string]interface{}
+
+// Store moves rows between tiers. Move moves up to limit rows older than
+// before to the cold table and returns their count, atomically per batch.
+// Find reads cold rows where column equals value; Restore moves the cold
+// row of key back to the hot table.
+type Store interface {
+	Move(p *Policy, before time.Time, limit int) (int64, error)
+	Find(p *Policy, column string, value interface{}, limit int) ([]Row, error)
+	Restore(p *Policy, key interface{}) (bool, error)
+}
+
+// Archiver runs Policies every Interval. It is an a5gapp.Module; run a
+// single one per cluster, batches of concurrent archivers would contend.
+type Archiver struct {
+	Policies []*Policy
+	Store    Store
+	Logger   a5glogs.Logger
+	Interval time.Duration
+
+	now     func() time.Time
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+func NewArchiver(policies []*Policy, s Store, l a5glogs.Logger) (*Archiver, error) {
+	names := make(map[string]bool, len(policies))
+	for _, p := range policies {
+		if p == nil {
+			return nil, errors.New("nil archive policy")
+		}
+		if err := p.validate(); err != nil {
+			return nil, err
+		}
+		if names[p.Name] {
+			return nil, errors.Errorf("duplicate archive policy %q", p.Name)
+		}
+		names[p.Name] = true
+	}
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Archiver{
+		Policies: policies,
+		Store:    s,
+		Logger:   l,
+		Interval: time.Hour,
+		now:      time.Now}, nil
+}
+
+func (a *Archiver) policy(name string) (*Policy, error) {
+	for _, p := range a.Policies {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return nil, errors.Wrap(ErrPolicyUnknown, name)
+}
+
+// Archive moves every aged row of every policy and returns counts by
+// policy name. It stops between batches when ctx is done.
+func (a *Archiver) Archive(ctx context.Context) (map[string]int64, error) {
+	moved := make(map[string]int64, len(a.Policies))
+	for _, p := range a.Policies {
+		before := a.now().Add(-p.Age)
+		for {
+			if err := ctx.Err(); err != nil {
+				return moved, errors.WithStack(err)
+			}
+			n, err := a.Store.Move(p, before, p.BatchSize)
+			if err != nil {
+				return moved, errors.Wrapf(err, "archive policy %q", p.Name)
+			}
+			moved[p.Name] += n
+			if n < int64(p.BatchSize) {
+				break
+			}
+		}
+	}
+	return moved, nil
+}
+
+// Find reads archived rows of a policy, e.g. the old mail of a player.
+func (a *Archiver) Find(
+	policy, column string, value interface{}, limit int) ([]Row, error) {
+	p, err := a.policy(policy)
+	if err != nil {
+		return nil, err
+	}
+	if !identifier.MatchString(column) {
+		return nil, errors.Errorf("invalid archive column %q", column)
+	}
+	return a.Store.Find(p, column, value, limit)
+}
+
+// Restore moves an archived row back to the hot table.
+func (a *Archiver) Restore(policy string, key interface{}) (bool, error) {
+	p, err := a.policy(policy)
+	if err != nil {
+		return false, err
+	}
+	return a.Store.Restore(p, key)
+}
+
+func (a *Archiver) Name() string { return "archive" }
+
+// Start runs Archive every Interval until Stop is called.
+func (a *Archiver) Start(context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.cancel != nil {
+		return errors.New("archiver already started")
+	}
+	var ctx context.Context
+	ctx, a.cancel = context.WithCancel(context.Background())
+	a.stopped = make(chan struct{})
+	go a.run(ctx, a.stopped)
+	return nil
+}
+
+func (a *Archiver) run(ctx context.Context, stopped chan struct{}) {
+	defer close(stopped)
+	t := time.NewTicker(a.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		moved, err := a.Archive(ctx)
+		if err != nil && ctx.Err() == nil {
+			a.Logger.Error(err.Error())
+		}
+		for name, n := range moved {
+			if n > 0 {
+				a.Logger.With(a5gfields.String("archivePolicy", name),
+					a5gfields.Int64("rows", n)).Info("rows archived")
+			}
+		}
+	}
+}
+
+// Stop waits for the running batch until ctx is done.
+func (a *Archiver) Stop(ctx context.Context) error {
+	a.mu.Lock()
+	cancel, stopped := a.cancel, a.stopped
+	a.cancel = nil
+	a.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
@@ -0,0 +1,76 @@
+package a5garchive
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestArchiver(t *testing.T) {
+	now := time.Date(2020, 3, 10, 0, 0, 0, 0, time.UTC)
+	s := NewMemoryStore()
+	mail := &Policy{Name: "mail", HotTable: "mail", ColdTable: "mail_archive",
+		KeyColumn: "id", TimeColumn: "created_at", Unix: true,
+		Age: 30 * 24 * time.Hour, BatchSize: 2}
+	matches := &Policy{Name: "matches", HotTable: "matches",
+		ColdTable: "matches_archive", KeyColumn: "id", TimeColumn: "ended_at",
+		Age: 7 * 24 * time.Hour, BatchSize: 10}
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	if _, err := NewArchiver([]*Policy{{Name: "x", HotTable: "mail; DROP",
+		ColdTable: "a", KeyColumn: "id", TimeColumn: "t", Age: time.Hour,
+		BatchSize: 1}}, s, l); err == nil {
+		t.Fatal("expected an invalid identifier error")
+	}
+	a, err := NewArchiver([]*Policy{mail, matches}, s, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.now = func() time.Time { return now }
+
+	m := s.(*memoryStore)
+	for i, days := range []int{90, 45, 31, 29, 1} {
+		m.insert("mail", Row{"id": int64(i + 1), "account_id": int64(7),
+			"created_at": now.AddDate(0, 0, -days).Unix()})
+	}
+	m.insert("matches", Row{"id": int64(1), "ended_at": now.AddDate(0, 0, -8)})
+	m.insert("matches", Row{"id": int64(2), "ended_at": now.AddDate(0, 0, -6)})
+
+	moved, err := a.Archive(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved["mail"] != 3 || moved["matches"] != 1 {
+		t.Errorf("unexpected moved rows %v", moved)
+	}
+	if len(m.tables["mail"]) != 2 || len(m.tables["matches"]) != 1 {
+		t.Errorf("unexpected hot tables %v", m.tables)
+	}
+
+	rows, err := a.Find("mail", "account_id", "7", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0]["id"] != int64(1) {
+		t.Errorf("unexpected archived rows %v", rows)
+	}
+	if _, err = a.Find("chat", "id", "1", 0); errors.Cause(err) != ErrPolicyUnknown {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err = a.Find("mail", "id = 1 OR 1", "1", 0); err == nil {
+		t.Error("expected an invalid column error")
+	}
+	ok, err := a.Restore("mail", "2")
+	if err != nil || !ok {
+		t.Fatalf("Restore() => %v %v", ok, err)
+	}
+	if ok, _ = a.Restore("mail", "2"); ok {
+		t.Error("restored a row twice")
+	}
+	if len(m.tables["mail"]) != 3 || len(m.tables["mail_archive"]) != 2 {
+		t.Errorf("unexpected tables after restore %v", m.tables)
+	}
+}
@@ -0,0 +1,87 @@
+package a5garchive
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/pkg/errors"
+)
+
+var ErrCodePolicyUnknown = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+	Code:     4056,
+	Name:     "archive_policy_unknown",
+	Severity: a5gapi.ErrSeverityWarn,
+	Public:   true,
+	Message:  "archive policy not found"})
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodePolicyUnknown, http.StatusNotFound)
+}
+
+// FindRequest reads archived rows of Policy whose Column equals Value,
+// e.g. {"policy": "mail", "column": "account_id", "value": "42"}.
+type FindRequest struct {
+	Policy string `json:"policy" validate:"required"`
+	Column string `json:"column" validate:"required"`
+	Value  string `json:"value" validate:"required"`
+	Limit  int    `json:"limit" validate:"min=0,max=1000"`
+}
+
+type FindResponse struct {
+	Rows []Row `json:"rows"`
+}
+
+type RestoreRequest struct {
+	Policy string `json:"policy" validate:"required"`
+	Key    string `json:"key" validate:"required"`
+}
+
+type RestoreResponse struct {
+	Restored bool `json:"restored"`
+}
+
+// FindHandler serves archived rows, mount it on an admin route class.
+func (a *Archiver) FindHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(FindRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			r := req.Payload.(*FindRequest)
+			limit := r.Limit
+			if limit == 0 {
+				limit = 100
+			}
+			rows, err := a.Find(r.Policy, r.Column, r.Value, limit)
+			if err != nil {
+				return nil, a.apiErrs(err)
+			}
+			return &FindResponse{Rows: rows}, nil
+		})
+}
+
+// RestoreHandler moves an archived row back to its hot table, mount it on
+// an admin route class.
+func (a *Archiver) RestoreHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(RestoreRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			r := req.Payload.(*RestoreRequest)
+			ok, err := a.Restore(r.Policy, r.Key)
+			if err != nil {
+				return nil, a.apiErrs(err)
+			}
+			return &RestoreResponse{Restored: ok}, nil
+		})
+}
+
+func (a *Archiver) apiErrs(err error) []*a5gapi.APIErr {
+	if errors.Cause(err) == ErrPolicyUnknown {
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodePolicyUnknown, "")}
+	}
+	a.Logger.Error(err.Error())
+	return a5gapi.NewJSONMsgDefautlErrors(err)
+}
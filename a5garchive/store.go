@@ -0,0 +1,247 @@
+package a5garchive
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+// memoryStore keeps tables as rows in memory, tables are created on the
+// first insert.
+type memoryStore struct {
+	mu     sync.Mutex
+	tables map[string][]Row
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{tables: make(map[string][]Row)}
+}
+
+func (s *memoryStore) insert(table string, r Row) {
+	s.mu.Lock()
+	s.tables[table] = append(s.tables[table], r)
+	s.mu.Unlock()
+}
+
+func older(p *Policy, r Row, before time.Time) bool {
+	switch v := r[p.TimeColumn].(type) {
+	case int64:
+		return p.Unix && v < before.Unix()
+	case time.Time:
+		return !p.Unix && v.Before(before)
+	}
+	return false
+}
+
+func (s *memoryStore) Move(p *Policy, before time.Time, limit int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hot := s.tables[p.HotTable]
+	sort.SliceStable(hot, func(i, j int) bool {
+		return fmt.Sprint(hot[i][p.KeyColumn]) < fmt.Sprint(hot[j][p.KeyColumn])
+	})
+	var n int64
+	kept := hot[:0]
+	for _, r := range hot {
+		if n < int64(limit) && older(p, r, before) {
+			s.tables[p.ColdTable] = append(s.tables[p.ColdTable], r)
+			n++
+			continue
+		}
+		kept = append(kept, r)
+	}
+	s.tables[p.HotTable] = kept
+	return n, nil
+}
+
+func (s *memoryStore) Find(
+	p *Policy, column string, value interface{}, limit int) ([]Row, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := []Row{}
+	for _, r := range s.tables[p.ColdTable] {
+		if limit > 0 && len(a) >= limit {
+			break
+		}
+		if fmt.Sprint(r[column]) == fmt.Sprint(value) {
+			x := make(Row, len(r))
+			for k, v := range r {
+				x[k] = v
+			}
+			a = append(a, x)
+		}
+	}
+	return a, nil
+}
+
+func (s *memoryStore) Restore(p *Policy, key interface{}) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cold := s.tables[p.ColdTable]
+	for i, r := range cold {
+		if fmt.Sprint(r[p.KeyColumn]) == fmt.Sprint(key) {
+			s.tables[p.ColdTable] = append(cold[:i:i], cold[i+1:]...)
+			s.tables[p.HotTable] = append(s.tables[p.HotTable], r)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// dbStore moves rows between MySQL tables of the same database; cold
+// tables are created like their hot ones, e.g.
+//
+//	CREATE TABLE mail_archive LIKE mail;
+//
+// and may use another storage engine, such as ARCHIVE or compressed
+// InnoDB, or a partition on cheaper disks.
+type dbStore struct {
+	pooler a5gdb.Pooler
+}
+
+func NewDBStore(p a5gdb.Pooler) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	return &dbStore{pooler: p}, nil
+}
+
+func (p *Policy) before(t time.Time) interface{} {
+	if p.Unix {
+		return t.Unix()
+	}
+	return t.UTC()
+}
+
+// Move locks a batch of keys, copies their rows and deletes them in a
+// single transaction, so rows are never lost or duplicated.
+func (s *dbStore) Move(p *Policy, before time.Time, limit int) (int64, error) {
+	tx, err := s.pooler.WritePool().NewSession().Begin()
+	if err != nil {
+		return 0, errors.Wrap(err, "dbr.(*Session).Begin fn")
+	}
+	defer tx.RollbackUnlessCommitted()
+	var keys []interface{}
+	rows, err := tx.Select(p.KeyColumn).From(p.HotTable).
+		Where(dbr.Lt(p.TimeColumn, p.before(before))).
+		OrderAsc(p.KeyColumn).Limit(uint64(limit)).
+		Suffix("FOR UPDATE").Rows()
+	if err != nil {
+		return 0, errors.Wrap(err, "dbr.(*SelectStmt).Rows fn")
+	}
+	for rows.Next() {
+		var k interface{}
+		if err = rows.Scan(&k); err != nil {
+			_ = rows.Close()
+			return 0, errors.Wrap(err, "sql.(*Rows).Scan fn")
+		}
+		keys = append(keys, k)
+	}
+	if err = rows.Close(); err != nil {
+		return 0, errors.Wrap(err, "sql.(*Rows).Close fn")
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	_, err = tx.InsertBySql("INSERT IGNORE INTO "+p.ColdTable+
+		" SELECT * FROM "+p.HotTable+" WHERE "+p.KeyColumn+" IN ?", keys).Exec()
+	if err != nil {
+		return 0, errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	res, err := tx.DeleteFrom(p.HotTable).Where(dbr.Eq(p.KeyColumn, keys)).Exec()
+	if err != nil {
+		return 0, errors.Wrap(err, "dbr.(*DeleteStmt).Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, errors.Wrap(err, "dbr.(*Tx).Commit fn")
+	}
+	return n, nil
+}
+
+func (s *dbStore) Find(
+	p *Policy, column string, value interface{}, limit int) ([]Row, error) {
+	stmt := s.pooler.ReadPool().NewSession().Select("*").From(p.ColdTable).
+		Where(dbr.Eq(column, value)).OrderAsc(p.KeyColumn)
+	if limit > 0 {
+		stmt.Limit(uint64(limit))
+	}
+	rows, err := stmt.Rows()
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Rows fn")
+	}
+	a, err := scan(rows)
+	if closeErr := rows.Close(); err == nil && closeErr != nil {
+		err = errors.Wrap(closeErr, "sql.(*Rows).Close fn")
+	}
+	return a, err
+}
+
+func scan(rows *sql.Rows) ([]Row, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.(*Rows).Columns fn")
+	}
+	a := []Row{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err = rows.Scan(ptrs...); err != nil {
+			return nil, errors.Wrap(err, "sql.(*Rows).Scan fn")
+		}
+		r := make(Row, len(columns))
+		for i, c := range columns {
+			if b, ok := values[i].([]byte); ok {
+				r[c] = string(b)
+				continue
+			}
+			r[c] = values[i]
+		}
+		a = append(a, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "sql.(*Rows).Err fn")
+	}
+	return a, nil
+}
+
+func (s *dbStore) Restore(p *Policy, key interface{}) (bool, error) {
+	tx, err := s.pooler.WritePool().NewSession().Begin()
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.(*Session).Begin fn")
+	}
+	defer tx.RollbackUnlessCommitted()
+	res, err := tx.InsertBySql("INSERT INTO "+p.HotTable+
+		" SELECT * FROM "+p.ColdTable+" WHERE "+p.KeyColumn+" = ? FOR UPDATE",
+		key).Exec()
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	if n == 0 {
+		return false, nil
+	}
+	_, err = tx.DeleteFrom(p.ColdTable).Where(dbr.Eq(p.KeyColumn, key)).Exec()
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.(*DeleteStmt).Exec fn")
+	}
+	if err = tx.Commit(); err != nil {
+		return false, errors.Wrap(err, "dbr.(*Tx).Commit fn")
+	}
+	return true, nil
+}
@@ -0,0 +1,372 @@
+package a5gauction
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrAuctionUnknown = errors.New("auction unknown")
+	ErrAuctionClosed  = errors.New("auction closed")
+	ErrAuctionBusy    = errors.New("auction changed concurrently")
+	ErrBidTooLow      = errors.New("bid too low")
+	ErrOwnAuction     = errors.New("bid on own auction")
+)
+
+// Statuses of auctions: open ones take bids until EndAt, then they are
+// sold to the high bidder or expire with no bids.
+const (
+	StatusOpen    = "open"
+	StatusSold    = "sold"
+	StatusExpired = "expired"
+)
+
+// Auction sells Quantity of ItemID for Currency. Price is the current
+// price, MaxBid the hidden proxy bid of HighBidder the house bids up to
+// on its behalf.
+type Auction struct {
+	ID         string `json:"id"`
+	Seller     uint64 `json:"seller"`
+	ItemID     string `json:"itemId"`
+	Quantity   int64  `json:"quantity"`
+	Currency   string `json:"currency"`
+	StartPrice int64  `json:"startPrice"`
+	Increment  int64  `json:"increment"`
+	Price      int64  `json:"price"`
+	HighBidder uint64 `json:"highBidder,omitempty"`
+	MaxBid     int64  `json:"-"`
+	Bids       int64  `json:"bids"`
+	EndAt      int64  `json:"endAt"`
+	Status     string `json:"status"`
+	Version    int64  `json:"-"`
+}
+
+func (a *Auction) clone() *Auction {
+	x := *a
+	return &x
+}
+
+// MinBid is the lowest bid accepted now.
+func (a *Auction) MinBid() int64 {
+	if a.HighBidder == 0 {
+		return a.StartPrice
+	}
+	return a.Price + a.Increment
+}
+
+// Store keeps auctions. Update replaces prev with next unless the
+// auction changed since prev was read, nil prev creates it; Due lists
+// open auctions ended by before.
+type Store interface {
+	Get(id string) (*Auction, error)
+	Update(prev, next *Auction) (bool, error)
+	Due(before int64, limit int) ([]*Auction, error)
+}
+
+// Mailer delivers sold and expired items. It must be idempotent on refID.
+type Mailer interface {
+	Mail(accountID uint64, refID, itemID string, quantity int64) error
+}
+
+type MailerFunc func(accountID uint64, refID, itemID string, quantity int64) error
+
+func (fn MailerFunc) Mail(accountID uint64, refID, itemID string, quantity int64) error {
+	return fn(accountID, refID, itemID, quantity)
+}
+
+// House runs auctions. Listed items and proxy bids are held in escrow:
+// items leave the inventory of the seller, bids the wallet of the high
+// bidder, until the auction settles. Bids within SnipeWindow of the end
+// extend it to SnipeWindow from the bid. Fee is the percentage of the
+// price the house keeps. House is an a5gapp.Module settling ended
+// auctions every Interval.
+type House struct {
+	Store       Store
+	Wallet      *a5gwallet.Wallet
+	Inventory   *a5ginventory.Inventory
+	Mailer      Mailer
+	Logger      a5glogs.Logger
+	SnipeWindow time.Duration
+	Fee         int64
+	Interval    time.Duration
+
+	now     func() time.Time
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+func NewHouse(s Store, w *a5gwallet.Wallet, inv *a5ginventory.Inventory,
+	m Mailer, l a5glogs.Logger) (*House, error) {
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if w == nil || inv == nil {
+		return nil, errors.New("wallet or inventory missing")
+	}
+	if m == nil {
+		return nil, errors.New("mailer missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &House{
+		Store:       s,
+		Wallet:      w,
+		Inventory:   inv,
+		Mailer:      m,
+		Logger:      l,
+		SnipeWindow: 5 * time.Minute,
+		Fee:         5,
+		Interval:    time.Minute,
+		now:         time.Now}, nil
+}
+
+func ref(a *Auction, step string) string {
+	return "auction:" + a.ID + ":" + strconv.FormatInt(a.Version, 10) + ":" + step
+}
+
+// List puts an auction up for d, taking its items into escrow.
+func (h *House) List(a *Auction, d time.Duration) (*Auction, error) {
+	if a.ID == "" || a.Seller == 0 || a.ItemID == "" || a.Quantity <= 0 ||
+		a.Currency == "" || a.StartPrice <= 0 || a.Increment <= 0 || d <= 0 {
+		return nil, errors.New("invalid auction")
+	}
+	x := a.clone()
+	x.Price = x.StartPrice
+	x.HighBidder, x.MaxBid, x.Bids = 0, 0, 0
+	x.EndAt = h.now().Add(d).Unix()
+	x.Status = StatusOpen
+	x.Version = 1
+	_, err := h.Inventory.Apply(x.Seller,
+		a5ginventory.NewTx("auction", ref(x, "list")).Consume(x.ItemID, x.Quantity))
+	if err != nil {
+		return nil, err
+	}
+	ok, err := h.Store.Update(nil, x)
+	if err == nil && !ok {
+		err = errors.Wrap(ErrAuctionBusy, x.ID)
+	}
+	if err != nil {
+		_, e := h.Inventory.Apply(x.Seller, a5ginventory.NewTx("auction_refund",
+			ref(x, "list")).Grant(x.ItemID, x.Quantity).MailOverflow())
+		if e != nil {
+			h.Logger.With(a5gfields.String("auctionID", x.ID)).Error(
+				errors.Wrap(e, "auction items not refunded").Error())
+		}
+		return nil, err
+	}
+	return x, nil
+}
+
+// Bid places a proxy bid of up to max. A bid over the proxy bid of the
+// high bidder takes the lead at one increment over it; a lower one raises
+// the price to one increment over it, capped at the proxy bid. The high
+// bidder may raise their own proxy bid.
+func (h *House) Bid(id string, bidder uint64, max int64) (*Auction, error) {
+	a, err := h.get(id)
+	if err != nil {
+		return nil, err
+	}
+	now := h.now()
+	if a.Status != StatusOpen || now.Unix() >= a.EndAt {
+		return nil, ErrAuctionClosed
+	}
+	if a.Seller == bidder {
+		return nil, ErrOwnAuction
+	}
+	x := a.clone()
+	x.Version++
+	x.Bids++
+	if end := now.Add(h.SnipeWindow).Unix(); x.EndAt < end {
+		x.EndAt = end
+	}
+	switch {
+	case bidder == a.HighBidder:
+		if max <= a.MaxBid {
+			return nil, errors.Wrapf(ErrBidTooLow, "raise over %d", a.MaxBid)
+		}
+		x.MaxBid = max
+		return h.escrow(a, x, bidder, max-a.MaxBid, 0, 0)
+	case max < a.MinBid():
+		return nil, errors.Wrapf(ErrBidTooLow, "min %d", a.MinBid())
+	case a.HighBidder == 0:
+		x.HighBidder, x.MaxBid, x.Price = bidder, max, a.StartPrice
+		return h.escrow(a, x, bidder, max, 0, 0)
+	case max > a.MaxBid:
+		x.HighBidder, x.MaxBid = bidder, max
+		x.Price = a.MaxBid + a.Increment
+		if x.Price > max {
+			x.Price = max
+		}
+		return h.escrow(a, x, bidder, max, a.HighBidder, a.MaxBid)
+	default:
+		// The proxy bid of the high bidder answers the bid.
+		x.Price = max + a.Increment
+		if x.Price > a.MaxBid {
+			x.Price = a.MaxBid
+		}
+		if _, err = h.save(a, x); err != nil {
+			return nil, err
+		}
+		return nil, errors.Wrapf(ErrBidTooLow, "outbid by a proxy bid at %d", x.Price)
+	}
+}
+
+// escrow takes amount from bidder, saves the auction and refunds the
+// proxy bid of the outbid bidder, if any.
+func (h *House) escrow(a, x *Auction, bidder uint64, amount int64,
+	outbid uint64, refund int64) (*Auction, error) {
+	_, err := h.Wallet.Debit(bidder, ref(x, "bid"), "auction:"+a.ID, "auction_bid",
+		a.Currency, amount)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = h.save(a, x); err != nil {
+		h.credit(x, bidder, "bid:refund", amount)
+		return nil, err
+	}
+	if outbid != 0 {
+		h.credit(x, outbid, "outbid", refund)
+	}
+	return x, nil
+}
+
+// credit pays from escrow; failures are logged, escrow keeps the amount
+// on the auction counterparty of the ledger.
+func (h *House) credit(a *Auction, accountID uint64, step string, amount int64) {
+	if amount <= 0 {
+		return
+	}
+	_, err := h.Wallet.Credit(accountID, ref(a, step), "auction:"+a.ID,
+		"auction_"+step, a.Currency, amount)
+	if err != nil {
+		h.Logger.With(a5gfields.String("auctionID", a.ID),
+			a5gfields.String("accountID", strconv.FormatUint(accountID, 10))).
+			Error(errors.Wrapf(err, "auction %s not paid", step).Error())
+	}
+}
+
+func (h *House) get(id string) (*Auction, error) {
+	a, err := h.Store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if a == nil {
+		return nil, errors.Wrap(ErrAuctionUnknown, id)
+	}
+	return a, nil
+}
+
+func (h *House) save(prev, next *Auction) (*Auction, error) {
+	next.Version = prev.Version + 1
+	ok, err := h.Store.Update(prev, next)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.Wrap(ErrAuctionBusy, prev.ID)
+	}
+	return next, nil
+}
+
+// SettleDue settles ended auctions and returns their number: items are
+// mailed to the high bidder, the price less Fee paid to the seller and
+// the rest of the proxy bid refunded, or unsold items mailed back.
+func (h *House) SettleDue(ctx context.Context) (int, error) {
+	a, err := h.Store.Due(h.now().Unix(), 100)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, x := range a {
+		if err = ctx.Err(); err != nil {
+			return n, errors.WithStack(err)
+		}
+		if err = h.settle(x); err != nil {
+			h.Logger.With(a5gfields.String("auctionID", x.ID)).Error(err.Error())
+			continue
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (h *House) settle(a *Auction) error {
+	x := a.clone()
+	x.Status = StatusExpired
+	if a.HighBidder != 0 {
+		x.Status = StatusSold
+	}
+	x, err := h.save(a, x)
+	if err != nil {
+		return err
+	}
+	if x.Status == StatusExpired {
+		return h.Mailer.Mail(x.Seller, ref(x, "expired"), x.ItemID, x.Quantity)
+	}
+	if err = h.Mailer.Mail(x.HighBidder, ref(x, "won"), x.ItemID, x.Quantity); err != nil {
+		return err
+	}
+	h.credit(x, x.Seller, "proceeds", x.Price-x.Price*h.Fee/100)
+	h.credit(x, x.HighBidder, "change", x.MaxBid-x.Price)
+	return nil
+}
+
+func (h *House) Name() string { return "auction" }
+
+// Start settles ended auctions every Interval until Stop is called.
+func (h *House) Start(context.Context) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.cancel != nil {
+		return errors.New("auction house already started")
+	}
+	var ctx context.Context
+	ctx, h.cancel = context.WithCancel(context.Background())
+	h.stopped = make(chan struct{})
+	go h.run(ctx, h.stopped)
+	return nil
+}
+
+func (h *House) run(ctx context.Context, stopped chan struct{}) {
+	defer close(stopped)
+	t := time.NewTicker(h.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if _, err := h.SettleDue(ctx); err != nil && ctx.Err() == nil {
+			h.Logger.Error(err.Error())
+		}
+	}
+}
+
+// Stop waits for the running settlement until ctx is done.
+func (h *House) Stop(ctx context.Context) error {
+	h.mu.Lock()
+	cancel, stopped := h.cancel, h.stopped
+	h.cancel = nil
+	h.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
@@ -0,0 +1,110 @@
+package a5gauction
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestHouse(t *testing.T) {
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	c, _ := a5gwallet.NewCurrencies(a5gwallet.Currency{ID: "gold"})
+	w, _ := a5gwallet.NewWallet(a5gwallet.NewMemoryStore(), c, l)
+	catalog, _ := a5ginventory.NewCatalogJSON([]byte(`{"items": [{"id": "sword"}]}`))
+	inv, _ := a5ginventory.NewInventory(a5ginventory.NewMemoryStore(), catalog, l)
+	for id := uint64(1); id <= 3; id++ {
+		if _, err := w.Credit(id, fmt.Sprint("seed", id), "test", "seed", "gold", 1000); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := inv.Apply(1, a5ginventory.NewTx("seed", "").Grant("sword", 1)); err != nil {
+		t.Fatal(err)
+	}
+	mailed := map[string]uint64{}
+	h, err := NewHouse(NewMemoryStore(), w, inv, MailerFunc(
+		func(accountID uint64, refID, itemID string, n int64) error {
+			mailed[refID] = accountID
+			return nil
+		}), l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	h.now = func() time.Time { return now }
+	gold := func(id uint64) int64 {
+		b, _ := w.Balances(id)
+		return b[0].Balance
+	}
+
+	if _, err = h.List(&Auction{ID: "a1", Seller: 1, ItemID: "sword", Quantity: 1,
+		Currency: "gold", StartPrice: 100, Increment: 10}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := inv.Stacks(1); len(s) != 0 {
+		t.Errorf("listed items not in escrow %v", s)
+	}
+	tests := []struct {
+		name   string
+		bidder uint64
+		max    int64
+		err    error
+		high   uint64
+		price  int64
+	}{
+		{"own", 1, 500, ErrOwnAuction, 0, 100},
+		{"below start", 2, 90, ErrBidTooLow, 0, 100},
+		{"first", 2, 300, nil, 2, 100},
+		{"answered by proxy", 3, 200, ErrBidTooLow, 2, 210},
+		{"below min", 3, 215, ErrBidTooLow, 2, 210},
+		{"outbid", 3, 400, nil, 3, 310},
+		{"raise", 3, 450, nil, 3, 310},
+	}
+	for _, test := range tests {
+		_, err := h.Bid("a1", test.bidder, test.max)
+		if errors.Cause(err) != test.err {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+		a, _ := h.Store.Get("a1")
+		if a.HighBidder != test.high || a.Price != test.price {
+			t.Errorf("%s: unexpected high bid %d at %d", test.name, a.HighBidder, a.Price)
+		}
+	}
+	if gold(2) != 1000 || gold(3) != 550 {
+		t.Errorf("unexpected escrow %d %d", gold(2), gold(3))
+	}
+
+	// A bid in the last minutes extends the auction.
+	now = now.Add(58 * time.Minute)
+	if _, err = h.Bid("a1", 2, 500); err != nil {
+		t.Fatal(err)
+	}
+	a, _ := h.Store.Get("a1")
+	if a.EndAt != now.Add(5*time.Minute).Unix() || a.Price != 460 {
+		t.Errorf("unexpected auction %+v", a)
+	}
+	now = now.Add(2 * time.Minute)
+	if n, _ := h.SettleDue(context.Background()); n != 0 {
+		t.Errorf("settled %d auctions before the extended end", n)
+	}
+	now = now.Add(3 * time.Minute)
+	if n, _ := h.SettleDue(context.Background()); n != 1 {
+		t.Errorf("settled %d auctions", n)
+	}
+	if a, _ = h.Store.Get("a1"); a.Status != StatusSold || mailed[ref(a, "won")] != 2 {
+		t.Errorf("unexpected settlement %+v %v", a, mailed)
+	}
+	// 460 less 5% to the seller, 40 of the proxy bid back to the winner.
+	if gold(1) != 1437 || gold(2) != 540 || gold(3) != 1000 {
+		t.Errorf("unexpected balances %d %d %d", gold(1), gold(2), gold(3))
+	}
+	if _, err = h.Bid("a1", 3, 600); errors.Cause(err) != ErrAuctionClosed {
+		t.Errorf("unexpected error %v", err)
+	}
+}
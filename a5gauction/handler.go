@@ -0,0 +1,161 @@
+package a5gauction
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCodeOwnAuction = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4034,
+		Name:     "auction_own",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "bids on own auctions are not allowed"})
+
+	ErrCodeAuctionUnknown = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4058,
+		Name:     "auction_unknown",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "auction not found"})
+
+	ErrCodeAuctionClosed = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4248,
+		Name:     "auction_closed",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "auction closed"})
+
+	ErrCodeBidTooLow = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4249,
+		Name:     "auction_bid_too_low",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "bid too low"})
+
+	ErrCodeAuctionBusy = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4250,
+		Name:     "auction_busy",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "auction changed, try again"})
+)
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeOwnAuction, http.StatusForbidden)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeAuctionUnknown, http.StatusNotFound)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeAuctionClosed, http.StatusConflict)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeBidTooLow, http.StatusUnprocessableEntity)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeAuctionBusy, http.StatusConflict)
+}
+
+// ListRequest lists an auction for Duration seconds.
+type ListRequest struct {
+	ID         string `json:"id" validate:"required,max=64"`
+	ItemID     string `json:"itemId" validate:"required"`
+	Quantity   int64  `json:"quantity" validate:"min=1"`
+	Currency   string `json:"currency" validate:"required"`
+	StartPrice int64  `json:"startPrice" validate:"min=1"`
+	Increment  int64  `json:"increment" validate:"min=1"`
+	Duration   int64  `json:"duration" validate:"min=60,max=604800"`
+}
+
+type BidRequest struct {
+	ID  string `json:"id" validate:"required"`
+	Max int64  `json:"max" validate:"min=1"`
+}
+
+type AuctionRequest struct {
+	ID string `json:"id" validate:"required"`
+}
+
+// ListHandler lists an auction of the session player.
+func (h *House) ListHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(ListRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			r := req.Payload.(*ListRequest)
+			a, err := h.List(&Auction{
+				ID:         r.ID,
+				Seller:     s.AccountID,
+				ItemID:     r.ItemID,
+				Quantity:   r.Quantity,
+				Currency:   r.Currency,
+				StartPrice: r.StartPrice,
+				Increment:  r.Increment}, time.Duration(r.Duration)*time.Second)
+			if err != nil {
+				return nil, h.apiErrs(err)
+			}
+			return a, nil
+		})
+}
+
+// BidHandler places a proxy bid of the session player.
+func (h *House) BidHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(BidRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			r := req.Payload.(*BidRequest)
+			a, err := h.Bid(r.ID, s.AccountID, r.Max)
+			if err != nil {
+				return nil, h.apiErrs(err)
+			}
+			return a, nil
+		})
+}
+
+// AuctionHandler answers with an auction, proxy bids stay hidden.
+func (h *House) AuctionHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(AuctionRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			a, err := h.get(req.Payload.(*AuctionRequest).ID)
+			if err != nil {
+				return nil, h.apiErrs(err)
+			}
+			return a, nil
+		})
+}
+
+func (h *House) apiErrs(err error) []*a5gapi.APIErr {
+	switch errors.Cause(err) {
+	case ErrOwnAuction:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeOwnAuction, "")}
+	case ErrAuctionUnknown:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeAuctionUnknown, "")}
+	case ErrAuctionClosed:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeAuctionClosed, "")}
+	case ErrBidTooLow:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeBidTooLow, "%s", err)}
+	case ErrAuctionBusy:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeAuctionBusy, "")}
+	case a5gwallet.ErrInsufficientFunds:
+		return h.Wallet.APIErrs(err)
+	case a5ginventory.ErrInsufficient, a5ginventory.ErrItemUnknown:
+		return h.Inventory.APIErrs(err)
+	}
+	h.Logger.Error(err.Error())
+	return a5gapi.NewJSONMsgDefautlErrors(err)
+}
@@ -0,0 +1,171 @@
+package a5gauction
+
+import (
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryStore struct {
+	mu       sync.Mutex
+	auctions map[string]*Auction
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{auctions: make(map[string]*Auction)}
+}
+
+func (s *memoryStore) Get(id string) (*Auction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.auctions[id]
+	if !ok {
+		return nil, nil
+	}
+	return a.clone(), nil
+}
+
+func (s *memoryStore) Update(prev, next *Auction) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	x, ok := s.auctions[next.ID]
+	if ok != (prev != nil) || ok && x.Version != prev.Version {
+		return false, nil
+	}
+	s.auctions[next.ID] = next.clone()
+	return true, nil
+}
+
+func (s *memoryStore) Due(before int64, limit int) ([]*Auction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := []*Auction{}
+	for _, x := range s.auctions {
+		if x.Status == StatusOpen && x.EndAt <= before {
+			a = append(a, x.clone())
+		}
+	}
+	sort.Slice(a, func(i, j int) bool {
+		if a[i].EndAt != a[j].EndAt {
+			return a[i].EndAt < a[j].EndAt
+		}
+		return a[i].ID < a[j].ID
+	})
+	if len(a) > limit {
+		a = a[:limit]
+	}
+	return a, nil
+}
+
+// dbStore keeps auctions in a MySQL table; the proxy bid is kept apart
+// from the data clients see:
+//
+//	CREATE TABLE auctions (
+//	  id VARCHAR(64) NOT NULL PRIMARY KEY,
+//	  status VARCHAR(16) NOT NULL,
+//	  end_at BIGINT NOT NULL,
+//	  max_bid BIGINT NOT NULL,
+//	  data TEXT NOT NULL,
+//	  version BIGINT NOT NULL,
+//	  updated_at DATETIME NOT NULL,
+//	  KEY status (status, end_at));
+type dbStore struct {
+	pooler    a5gdb.Pooler
+	tableName string
+}
+
+type dbAuction struct {
+	MaxBid  int64  `db:"max_bid"`
+	Data    string `db:"data"`
+	Version int64  `db:"version"`
+}
+
+func NewDBStore(p a5gdb.Pooler, tableName string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if tableName == "" {
+		return nil, errors.New("empty auctions table name")
+	}
+	return &dbStore{pooler: p, tableName: tableName}, nil
+}
+
+func decode(rows []*dbAuction) ([]*Auction, error) {
+	a := make([]*Auction, 0, len(rows))
+	for _, r := range rows {
+		x := new(Auction)
+		if err := json.Unmarshal([]byte(r.Data), x); err != nil {
+			return nil, errors.Wrap(err, "auction data")
+		}
+		x.MaxBid, x.Version = r.MaxBid, r.Version
+		a = append(a, x)
+	}
+	return a, nil
+}
+
+func (s *dbStore) Get(id string) (*Auction, error) {
+	var rows []*dbAuction
+	_, err := s.pooler.WritePool().NewSession().
+		Select("max_bid", "data", "version").From(s.tableName).
+		Where(dbr.Eq("id", id)).Load(&rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	a, err := decode(rows)
+	if err != nil || len(a) == 0 {
+		return nil, err
+	}
+	return a[0], nil
+}
+
+func (s *dbStore) Update(prev, next *Auction) (bool, error) {
+	b, err := json.Marshal(next)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	sess := s.pooler.WritePool().NewSession()
+	var res sql.Result
+	if prev == nil {
+		res, err = sess.InsertBySql("INSERT IGNORE INTO "+s.tableName+
+			" (id, status, end_at, max_bid, data, version, updated_at)"+
+			" VALUES (?, ?, ?, ?, ?, ?, ?)", next.ID, next.Status, next.EndAt,
+			next.MaxBid, string(b), next.Version, time.Now().UTC()).Exec()
+	} else {
+		res, err = sess.Update(s.tableName).
+			Set("status", next.Status).
+			Set("end_at", next.EndAt).
+			Set("max_bid", next.MaxBid).
+			Set("data", string(b)).
+			Set("version", next.Version).
+			Set("updated_at", time.Now().UTC()).
+			Where(dbr.Eq("id", next.ID)).
+			Where(dbr.Eq("version", prev.Version)).Exec()
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	return n == 1, nil
+}
+
+func (s *dbStore) Due(before int64, limit int) ([]*Auction, error) {
+	var rows []*dbAuction
+	_, err := s.pooler.WritePool().NewSession().
+		Select("max_bid", "data", "version").From(s.tableName).
+		Where(dbr.Eq("status", StatusOpen)).
+		Where(dbr.Lte("end_at", before)).
+		OrderAsc("end_at").Limit(uint64(limit)).Load(&rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	return decode(rows)
+}
@@ -0,0 +1,206 @@
+// Package a5gbalance validates proposed balance data bundles before
+// rollout and diffs them against the live version, so designers and
+// reviewers see what a release changes in plain lines like
+//
+//	~ quests.hunter.reward.currencies.soft: 50 -> 80 (+60%)
+package a5gbalance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gquest"
+	"github.com/armor5games/a5g/a5grules"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+)
+
+// Bundle is the balance data of a release in one JSON document.
+type Bundle struct {
+	Version    string               `json:"version"`
+	Currencies []a5gwallet.Currency `json:"currencies"`
+	Inventory  *a5ginventory.Config `json:"inventory"`
+	Quests     []*a5gquest.Quest    `json:"quests,omitempty"`
+	Rules      []*a5grules.Rule     `json:"rules,omitempty"`
+}
+
+// Problem is a finding of validation; warnings don't fail it.
+type Problem struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+	Warning bool   `json:"warning,omitempty"`
+}
+
+func (p *Problem) String() string {
+	level := "error"
+	if p.Warning {
+		level = "warning"
+	}
+	return fmt.Sprintf("%s %s: %s", level, p.Path, p.Message)
+}
+
+// Sanity are numeric bounds of a bundle, zero fields are unchecked.
+type Sanity struct {
+	// MaxCurrencyReward caps single reward amounts by currency, e.g. of
+	// hard currency.
+	MaxCurrencyReward map[string]int64 `json:"maxCurrencyReward,omitempty"`
+	MaxItemReward     int64            `json:"maxItemReward,omitempty"`
+	MaxTarget         int64            `json:"maxTarget,omitempty"`
+	// MaxChange warns about numbers changed by more than the ratio
+	// against the live version, e.g. 0.5 for 50%.
+	MaxChange float64 `json:"maxChange,omitempty"`
+}
+
+// LiveFunc loads the bundle in production, nil when there is none yet.
+type LiveFunc func(ctx context.Context) (*Bundle, error)
+
+// Report is the outcome of a check, Valid unless a Problem is an error.
+type Report struct {
+	Version     string     `json:"version"`
+	LiveVersion string     `json:"liveVersion,omitempty"`
+	Valid       bool       `json:"valid"`
+	Problems    []*Problem `json:"problems,omitempty"`
+	Changes     []*Change  `json:"changes,omitempty"`
+}
+
+type Validator struct {
+	Live   LiveFunc
+	Sanity Sanity
+	Logger a5glogs.Logger
+}
+
+func NewValidator(live LiveFunc, s Sanity, l a5glogs.Logger) (*Validator, error) {
+	if live == nil {
+		return nil, errors.New("live func missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Validator{Live: live, Sanity: s, Logger: l}, nil
+}
+
+// Check validates the bundle raw and diffs it against the live one.
+// Problems of the bundle are in the report, errors are of loading the
+// live bundle.
+func (v *Validator) Check(ctx context.Context, raw []byte) (*Report, error) {
+	b, problems := Parse(raw)
+	r := &Report{Problems: problems}
+	if b != nil {
+		r.Version = b.Version
+		r.Problems = append(r.Problems, Validate(b, v.Sanity)...)
+		live, err := v.Live(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if live != nil {
+			r.LiveVersion = live.Version
+			if r.Changes, err = Diff(live, b); err != nil {
+				return nil, err
+			}
+			r.Problems = append(r.Problems, v.Sanity.changes(r.Changes)...)
+		}
+	}
+	r.Valid = true
+	for _, p := range r.Problems {
+		r.Valid = r.Valid && p.Warning
+	}
+	return r, nil
+}
+
+// Parse decodes raw, reporting syntax errors and fields the bundle
+// schema doesn't know, e.g. typos like "maxStak" which would silently
+// fall back to defaults.
+func Parse(raw []byte) (*Bundle, []*Problem) {
+	b := new(Bundle)
+	if err := json.Unmarshal(raw, b); err != nil {
+		return nil, []*Problem{{Path: "bundle", Message: err.Error()}}
+	}
+	known, err := flattenJSON(b)
+	if err != nil {
+		return nil, []*Problem{{Path: "bundle", Message: err.Error()}}
+	}
+	var doc interface{}
+	if err = json.Unmarshal(raw, &doc); err != nil {
+		return nil, []*Problem{{Path: "bundle", Message: err.Error()}}
+	}
+	given := make(map[string]interface{})
+	flatten("", doc, given)
+	var problems []*Problem
+	for _, path := range sortedKeys(given) {
+		if _, ok := known[path]; !ok && !zero(given[path]) {
+			problems = append(problems, &Problem{Path: path, Message: "unknown field"})
+		}
+	}
+	return b, problems
+}
+
+// zero values vanish on a round trip of omitempty fields.
+func zero(v interface{}) bool {
+	switch x := v.(type) {
+	case nil:
+		return true
+	case float64:
+		return x == 0
+	case string:
+		return x == ""
+	case bool:
+		return !x
+	case map[string]interface{}:
+		return len(x) == 0
+	case []interface{}:
+		return len(x) == 0
+	}
+	return false
+}
+
+// FileLive loads the live bundle from a file, e.g. the one the servers
+// read on start; a missing file is no live bundle.
+func FileLive(name string) LiveFunc {
+	return func(ctx context.Context) (*Bundle, error) {
+		raw, err := ioutil.ReadFile(name)
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		b, problems := Parse(raw)
+		if b == nil {
+			return nil, errors.Errorf("live bundle %s: %s", name, problems[0].Message)
+		}
+		return b, nil
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	a := make([]string, 0, len(m))
+	for k := range m {
+		a = append(a, k)
+	}
+	sort.Strings(a)
+	return a
+}
+
+// Lines renders the report for people: problems, then changes.
+func (r *Report) Lines() []string {
+	a := make([]string, 0, len(r.Problems)+len(r.Changes)+1)
+	status := "valid"
+	if !r.Valid {
+		status = "invalid"
+	}
+	a = append(a, fmt.Sprintf("bundle %q %s, %d problems, %d changes against %q",
+		r.Version, status, len(r.Problems), len(r.Changes), r.LiveVersion))
+	for _, p := range r.Problems {
+		a = append(a, p.String())
+	}
+	for _, c := range r.Changes {
+		a = append(a, c.String())
+	}
+	return a
+}
@@ -0,0 +1,119 @@
+package a5gbalance
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/sirupsen/logrus"
+)
+
+const liveBundle = `{"version": "1.4.0",
+	"currencies": [{"id": "soft"}, {"id": "gems", "max": 100000}],
+	"inventory": {"items": [{"id": "sword", "maxStack": 1}, {"id": "potion"}]},
+	"quests": [{"id": "hunter", "reward": {"currencies": {"soft": 50}},
+		"objectives": [{"id": "zombies", "event": "kill_zombie", "target": 5}]}],
+	"rules": [{"id": "new_player", "when": {"attr": "player.level", "op": "lt", "value": 5}}]}`
+
+func TestParse(t *testing.T) {
+	_, problems := Parse([]byte(`{"version": "1", "currencies": [{"id": "soft", "floor": 0}],
+		"inventory": {"items": [{"id": "sword", "maxStak": 5}]}, "quests": []}`))
+	want := []*Problem{{Path: "inventory.items.sword.maxStak", Message: "unknown field"}}
+	if !reflect.DeepEqual(problems, want) {
+		t.Errorf("Parse() problems => %v want %v", problems, want)
+	}
+	if b, problems := Parse([]byte(`{"version": 1}`)); b != nil || len(problems) != 1 {
+		t.Errorf("Parse() => %v, %v want a syntax problem", b, problems)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	b, _ := Parse([]byte(`{"version": "1.5.0",
+		"currencies": [{"id": "soft"}, {"id": "gems"}],
+		"inventory": {"items": [{"id": "sword", "tab": "gear"}],
+			"tabs": [{"id": "gear", "slots": 10}]},
+		"quests": [
+			{"id": "hunter", "rule": "veteran",
+				"reward": {"currencies": {"soft": 50, "gold": 5, "gems": 5000},
+					"items": {"sword": 1, "shield": 1, "potion": 0}},
+				"objectives": [{"id": "zombies", "event": "kill_zombie", "target": 100000}]},
+			{"id": "collector", "requires": ["hunter"],
+				"objectives": [{"id": "swords", "event": "craft", "target": 3}]}],
+		"rules": [{"id": "new_player", "when": {"attr": "player.level", "op": "lt", "value": 5}}]}`))
+	problems := Validate(b, Sanity{MaxCurrencyReward: map[string]int64{"gems": 1000},
+		MaxTarget: 1000})
+	var got []string
+	for _, p := range problems {
+		got = append(got, p.String())
+	}
+	want := []string{
+		`error quests.hunter.rule: unknown rule "veteran"`,
+		`warning quests.hunter.objectives.zombies.target: 100000 over the sanity cap 1000`,
+	}
+	items := []string{
+		`error quests.hunter.reward.items.shield: unknown item "shield"`,
+		`error quests.hunter.reward.items.potion: unknown item "potion"`,
+		`error quests.hunter.reward.items.potion: non-positive quantity 0`,
+		`error quests.hunter.reward.currencies.gold: unknown currency "gold"`,
+		`warning quests.hunter.reward.currencies.gems: 5000 over the sanity cap 1000`,
+	}
+	if len(got) != len(want)+len(items) || !reflect.DeepEqual(got[:2], want) {
+		t.Fatalf("Validate() => %q", got)
+	}
+	for _, s := range items {
+		found := false
+		for _, x := range got {
+			found = found || x == s
+		}
+		if !found {
+			t.Errorf("Validate() => %q, missing %q", got, s)
+		}
+	}
+
+	b, _ = Parse([]byte(`{"version": "", "currencies": [{"id": "soft"}, {"id": "soft"}],
+		"inventory": {"items": []}}`))
+	if problems = Validate(b, Sanity{}); len(problems) != 2 {
+		t.Errorf("Validate() => %v want empty version and duplicate currency", problems)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	live, _ := Parse([]byte(liveBundle))
+	v, err := NewValidator(func(context.Context) (*Bundle, error) { return live, nil },
+		Sanity{MaxChange: 0.5}, a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := v.Check(context.Background(), []byte(`{"version": "1.5.0",
+		"currencies": [{"id": "soft"}],
+		"inventory": {"items": [{"id": "potion", "maxStack": 20}, {"id": "sword", "maxStack": 1}]},
+		"quests": [{"id": "hunter", "reward": {"currencies": {"soft": 80}},
+			"objectives": [{"id": "zombies", "event": "kill_zombie", "target": 5}]}],
+		"rules": [{"id": "new_player", "when": {"attr": "player.level", "op": "lt", "value": 5}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`bundle "1.5.0" valid, 2 problems, 4 changes against "1.4.0"`,
+		`warning currencies.gems: removed, players may still hold it`,
+		`warning quests.hunter.reward.currencies.soft: changed by +60%`,
+		`- currencies.gems.id: "gems"`,
+		`- currencies.gems.max: 100000`,
+		`+ inventory.items.potion.maxStack: 20`,
+		`~ quests.hunter.reward.currencies.soft: 50 -> 80 (+60%)`,
+	}
+	if got := r.Lines(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Lines() => %q\nwant %q", got, want)
+	}
+
+	r, err = v.Check(context.Background(), []byte(`{"version": "1.5.1",
+		"currencies": [{"id": "soft"}], "inventory": {"items": []},
+		"quests": [{"id": "hunter", "objectives": []}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Valid {
+		t.Errorf("Check() => valid report %v", r.Lines())
+	}
+}
@@ -0,0 +1,161 @@
+package a5gbalance
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Kinds of changes.
+const (
+	Added   = "+"
+	Removed = "-"
+	Changed = "~"
+)
+
+// Change is a value of the bundle which differs from the live one. Paths
+// key list entries by their id, e.g. "inventory.items.sword.maxStack",
+// so reordering lists is no change.
+type Change struct {
+	Path string      `json:"path"`
+	Kind string      `json:"kind"`
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
+	// Ratio is the relative change of numbers, 0.6 for 50 -> 80.
+	Ratio float64 `json:"ratio,omitempty"`
+}
+
+func (c *Change) String() string {
+	switch c.Kind {
+	case Added:
+		return fmt.Sprintf("+ %s: %s", c.Path, text(c.To))
+	case Removed:
+		return fmt.Sprintf("- %s: %s", c.Path, text(c.From))
+	}
+	s := fmt.Sprintf("~ %s: %s -> %s", c.Path, text(c.From), text(c.To))
+	if c.Ratio != 0 {
+		s += fmt.Sprintf(" (%+.0f%%)", c.Ratio*100)
+	}
+	return s
+}
+
+func text(v interface{}) string {
+	if f, ok := v.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// Diff lists changes from live to next in path order.
+func Diff(live, next *Bundle) ([]*Change, error) {
+	from, err := flattenJSON(live)
+	if err != nil {
+		return nil, err
+	}
+	to, err := flattenJSON(next)
+	if err != nil {
+		return nil, err
+	}
+	delete(from, "version")
+	delete(to, "version")
+	var changes []*Change
+	for _, path := range sortedKeys(union(from, to)) {
+		x, inFrom := from[path]
+		y, inTo := to[path]
+		switch {
+		case !inFrom:
+			changes = append(changes, &Change{Path: path, Kind: Added, To: y})
+		case !inTo:
+			changes = append(changes, &Change{Path: path, Kind: Removed, From: x})
+		case text(x) != text(y):
+			c := &Change{Path: path, Kind: Changed, From: x, To: y}
+			if a, ok := x.(float64); ok && a != 0 {
+				if b, ok := y.(float64); ok {
+					c.Ratio = (b - a) / math.Abs(a)
+				}
+			}
+			changes = append(changes, c)
+		}
+	}
+	return changes, nil
+}
+
+func union(a, b map[string]interface{}) map[string]interface{} {
+	m := make(map[string]interface{}, len(a)+len(b))
+	for k, v := range a {
+		m[k] = v
+	}
+	for k, v := range b {
+		m[k] = v
+	}
+	return m
+}
+
+// flattenJSON flattens v as encoded to JSON.
+func flattenJSON(v interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var doc interface{}
+	if err = json.Unmarshal(b, &doc); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	m := make(map[string]interface{})
+	flatten("", doc, m)
+	return m, nil
+}
+
+// flatten maps leaf values of doc by dotted paths. Lists of objects are
+// keyed by the "id" of entries, or their index without one; other lists
+// are leaves.
+func flatten(path string, doc interface{}, m map[string]interface{}) {
+	switch x := doc.(type) {
+	case map[string]interface{}:
+		if len(x) == 0 {
+			m[path] = x
+		}
+		for k, v := range x {
+			flatten(join(path, k), v, m)
+		}
+	case []interface{}:
+		if !objects(x) {
+			m[path] = x
+			return
+		}
+		for i, v := range x {
+			key := strconv.Itoa(i)
+			if o, ok := v.(map[string]interface{}); ok {
+				if id, ok := o["id"].(string); ok && id != "" {
+					key = id
+				}
+			}
+			flatten(join(path, key), v, m)
+		}
+	default:
+		m[path] = x
+	}
+}
+
+func objects(a []interface{}) bool {
+	for _, v := range a {
+		if _, ok := v.(map[string]interface{}); !ok {
+			return false
+		}
+	}
+	return len(a) > 0
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
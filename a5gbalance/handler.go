@@ -0,0 +1,37 @@
+package a5gbalance
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gvalidate"
+)
+
+type CheckRequest struct {
+	Bundle json.RawMessage `json:"bundle" validate:"required"`
+}
+
+// CheckResponse is the Report with its changes and problems as lines for
+// the console to show as they are.
+type CheckResponse struct {
+	*Report
+	Text []string `json:"text"`
+}
+
+// CheckHandler validates a proposed bundle and diffs it against the live
+// one without rolling it out, mount it on an admin route class.
+func (v *Validator) CheckHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(CheckRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			r, err := v.Check(ctx, req.Payload.(*CheckRequest).Bundle)
+			if err != nil {
+				v.Logger.Error(err.Error())
+				return nil, a5gapi.NewJSONMsgDefautlErrors(err)
+			}
+			return &CheckResponse{Report: r, Text: r.Lines()}, nil
+		})
+}
@@ -0,0 +1,142 @@
+package a5gbalance
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5gquest"
+	"github.com/armor5games/a5g/a5grules"
+	"github.com/armor5games/a5g/a5gwallet"
+)
+
+// Validate checks sections of b the way the server loads them, then
+// references between sections and numbers against s.
+func Validate(b *Bundle, s Sanity) []*Problem {
+	var problems []*Problem
+	add := func(path, format string, a ...interface{}) {
+		problems = append(problems, &Problem{Path: path, Message: fmt.Sprintf(format, a...)})
+	}
+	if b.Version == "" {
+		add("version", "empty version")
+	}
+	currencies, err := a5gwallet.NewCurrencies(b.Currencies...)
+	if err != nil {
+		add("currencies", "%s", err)
+	}
+	catalog, err := a5ginventory.NewCatalog(b.Inventory)
+	if err != nil {
+		add("inventory", "%s", err)
+	}
+	if _, err = a5gquest.NewConfig(b.Quests); err != nil {
+		add("quests", "%s", err)
+	}
+	if err = (&a5grules.Engine{}).Replace(b.Rules); err != nil {
+		add("rules", "%s", err)
+	}
+	if currencies == nil || catalog == nil {
+		return problems
+	}
+	r := &refs{Sanity: s, currencies: currencies, catalog: catalog,
+		rules: make(map[string]bool, len(b.Rules))}
+	for _, x := range b.Rules {
+		if x != nil {
+			r.rules[x.ID] = true
+		}
+	}
+	r.inventory(b.Inventory)
+	for _, q := range b.Quests {
+		if q != nil {
+			r.quest(q)
+		}
+	}
+	return append(problems, r.problems...)
+}
+
+type refs struct {
+	Sanity
+
+	currencies *a5gwallet.Currencies
+	catalog    *a5ginventory.Catalog
+	rules      map[string]bool
+	problems   []*Problem
+}
+
+func (r *refs) add(warning bool, path, format string, a ...interface{}) {
+	r.problems = append(r.problems, &Problem{
+		Path: path, Message: fmt.Sprintf(format, a...), Warning: warning})
+}
+
+func (r *refs) inventory(c *a5ginventory.Config) {
+	for _, t := range c.Tabs {
+		for i, e := range t.Expansions {
+			path := fmt.Sprintf("inventory.tabs.%s.expansions.%d", t.ID, i)
+			if _, ok := r.currencies.Currency(e.Currency); e.Currency != "" && !ok {
+				r.add(false, path, "unknown currency %q", e.Currency)
+			}
+		}
+	}
+}
+
+func (r *refs) quest(q *a5gquest.Quest) {
+	path := "quests." + q.ID
+	if q.Rule != "" && !r.rules[q.Rule] {
+		r.add(false, path+".rule", "unknown rule %q", q.Rule)
+	}
+	for _, o := range q.Objectives {
+		if o != nil && r.MaxTarget > 0 && o.Target > r.MaxTarget {
+			r.add(true, path+".objectives."+o.ID+".target",
+				"%d over the sanity cap %d", o.Target, r.MaxTarget)
+		}
+	}
+	if q.Reward == nil {
+		return
+	}
+	for id, n := range q.Reward.Currencies {
+		p := path + ".reward.currencies." + id
+		if _, ok := r.currencies.Currency(id); !ok {
+			r.add(false, p, "unknown currency %q", id)
+		}
+		if n <= 0 {
+			r.add(false, p, "non-positive amount %d", n)
+		}
+		if max, ok := r.MaxCurrencyReward[id]; ok && n > max {
+			r.add(true, p, "%d over the sanity cap %d", n, max)
+		}
+	}
+	for id, n := range q.Reward.Items {
+		p := path + ".reward.items." + id
+		if _, ok := r.catalog.Item(id); !ok {
+			r.add(false, p, "unknown item %q", id)
+		}
+		if n <= 0 {
+			r.add(false, p, "non-positive quantity %d", n)
+		}
+		if r.MaxItemReward > 0 && n > r.MaxItemReward {
+			r.add(true, p, "%d over the sanity cap %d", n, r.MaxItemReward)
+		}
+	}
+}
+
+// changes warns about numbers changed by more than MaxChange, and about
+// removed currencies and items players may still hold.
+func (s Sanity) changes(changes []*Change) []*Problem {
+	var problems []*Problem
+	for _, c := range changes {
+		switch {
+		case s.MaxChange > 0 && math.Abs(c.Ratio) > s.MaxChange:
+			problems = append(problems, &Problem{Path: c.Path, Warning: true,
+				Message: fmt.Sprintf("changed by %+.0f%%", c.Ratio*100)})
+		case c.Kind == Removed && removedEntry(c.Path):
+			problems = append(problems, &Problem{Path: strings.TrimSuffix(c.Path, ".id"),
+				Warning: true, Message: "removed, players may still hold it"})
+		}
+	}
+	return problems
+}
+
+func removedEntry(path string) bool {
+	return strings.HasSuffix(path, ".id") && (strings.HasPrefix(path, "currencies.") ||
+		strings.HasPrefix(path, "inventory.items."))
+}
@@ -0,0 +1,175 @@
+package a5gbanners
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/armor5games/a5g/a5gevents"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrBannerUnknown = errors.New("banner unknown")
+	ErrBannerInvalid = errors.New("banner invalid")
+)
+
+// Statuses of a banner for a player.
+const (
+	StatusUpcoming = "upcoming"
+	StatusActive   = "active"
+)
+
+// Banner is an announcement shown between StartAt and EndAt and, from
+// AnnounceAt on, as an upcoming one with a countdown to its start. Times
+// are unix seconds; AnnounceAt zero shows it from the start. Segments,
+// when set, limit the banner to players of any of them. Banners of higher
+// Priority come first. Payload is what clients render, e.g. an image and
+// a deep link.
+type Banner struct {
+	ID         string          `json:"id" validate:"required"`
+	StartAt    int64           `json:"startAt" validate:"required"`
+	EndAt      int64           `json:"endAt" validate:"required"`
+	AnnounceAt int64           `json:"announceAt,omitempty"`
+	Segments   []string        `json:"segments,omitempty"`
+	Priority   int             `json:"priority,omitempty"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+}
+
+func (b *Banner) validate() error {
+	if b.ID == "" {
+		return errors.Wrap(ErrBannerInvalid, "empty id")
+	}
+	if b.EndAt <= b.StartAt {
+		return errors.Wrapf(ErrBannerInvalid, "%q ends before it starts", b.ID)
+	}
+	if b.AnnounceAt > b.StartAt {
+		return errors.Wrapf(ErrBannerInvalid, "%q announced after its start", b.ID)
+	}
+	return nil
+}
+
+// Store keeps banners. List returns ones ending after endAfter, Put
+// creates or replaces a banner.
+type Store interface {
+	List(endAfter int64) ([]*Banner, error)
+	Put(b *Banner) error
+	Remove(id string) (bool, error)
+}
+
+// Banners schedules banners through admin handlers and serves them to
+// players with countdowns computed on the server, so clients do not
+// depend on their own clocks.
+type Banners struct {
+	Store    Store
+	Segments a5gevents.SegmentFunc
+	Logger   a5glogs.Logger
+
+	now func() time.Time
+}
+
+func NewBanners(s Store, l a5glogs.Logger) (*Banners, error) {
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Banners{Store: s, Logger: l, now: time.Now}, nil
+}
+
+// Put schedules a banner or changes a scheduled one.
+func (x *Banners) Put(b *Banner) error {
+	if err := b.validate(); err != nil {
+		return err
+	}
+	return x.Store.Put(b)
+}
+
+func (x *Banners) Remove(id string) error {
+	ok, err := x.Store.Remove(id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.Wrap(ErrBannerUnknown, id)
+	}
+	return nil
+}
+
+// State is a banner as a player sees it. StartsIn and EndsIn are seconds
+// left at ServerTime of the response, clients count down from them.
+type State struct {
+	ID       string          `json:"id"`
+	Status   string          `json:"status"`
+	StartAt  int64           `json:"startAt"`
+	EndAt    int64           `json:"endAt"`
+	StartsIn int64           `json:"startsIn"`
+	EndsIn   int64           `json:"endsIn"`
+	Priority int             `json:"priority,omitempty"`
+	Payload  json.RawMessage `json:"payload,omitempty"`
+}
+
+// Banners returns upcoming and active banners of a player at now.
+func (x *Banners) Banners(
+	ctx context.Context, playerID int64, now int64) ([]*State, error) {
+	banners, err := x.Store.List(now)
+	if err != nil {
+		return nil, err
+	}
+	var segments []string
+	segmented := false
+	a := []*State{}
+	for _, b := range banners {
+		announceAt := b.AnnounceAt
+		if announceAt == 0 {
+			announceAt = b.StartAt
+		}
+		if announceAt > now || b.EndAt <= now {
+			continue
+		}
+		if len(b.Segments) > 0 {
+			if !segmented && x.Segments != nil {
+				if segments, err = x.Segments(ctx, playerID); err != nil {
+					return nil, err
+				}
+			}
+			segmented = true
+			if !intersects(b.Segments, segments) {
+				continue
+			}
+		}
+		s := &State{
+			ID:       b.ID,
+			Status:   StatusActive,
+			StartAt:  b.StartAt,
+			EndAt:    b.EndAt,
+			EndsIn:   b.EndAt - now,
+			Priority: b.Priority,
+			Payload:  b.Payload}
+		if b.StartAt > now {
+			s.Status, s.StartsIn = StatusUpcoming, b.StartAt-now
+		}
+		a = append(a, s)
+	}
+	sort.SliceStable(a, func(i, j int) bool {
+		if a[i].Priority != a[j].Priority {
+			return a[i].Priority > a[j].Priority
+		}
+		return a[i].StartAt < a[j].StartAt
+	})
+	return a, nil
+}
+
+func intersects(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
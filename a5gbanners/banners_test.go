@@ -0,0 +1,73 @@
+package a5gbanners
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestBanners(t *testing.T) {
+	x, err := NewBanners(NewMemoryStore(), a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.Segments = func(ctx context.Context, playerID int64) ([]string, error) {
+		if playerID == 2 {
+			return []string{"payer"}, nil
+		}
+		return nil, nil
+	}
+	for _, test := range []struct {
+		banner *Banner
+		err    error
+	}{
+		{&Banner{ID: "sale", StartAt: 1000, EndAt: 2000, AnnounceAt: 500}, nil},
+		{&Banner{ID: "news", StartAt: 800, EndAt: 1200, Priority: 1}, nil},
+		{&Banner{ID: "vip", StartAt: 900, EndAt: 3000,
+			Segments: []string{"payer"}}, nil},
+		{&Banner{ID: "broken", StartAt: 2000, EndAt: 1000}, ErrBannerInvalid},
+		{&Banner{ID: "late", StartAt: 1000, EndAt: 2000, AnnounceAt: 1500},
+			ErrBannerInvalid},
+	} {
+		if err := x.Put(test.banner); errors.Cause(err) != test.err {
+			t.Fatalf("%s: unexpected error %v", test.banner.ID, err)
+		}
+	}
+	if err := x.Remove("broken"); errors.Cause(err) != ErrBannerUnknown {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	ctx := context.Background()
+	tests := []struct {
+		name     string
+		playerID int64
+		now      int64
+		states   string
+	}{
+		{"nothing yet", 1, 400, ""},
+		{"announced", 1, 600, "sale upcoming 400 1400"},
+		{"active", 1, 900, "news active 0 300, sale upcoming 100 1100"},
+		{"segment", 2, 950,
+			"news active 0 250, vip active 0 2050, sale upcoming 50 1050"},
+		{"ended", 2, 2500, "vip active 0 500"},
+	}
+	for _, test := range tests {
+		a, err := x.Banners(ctx, test.playerID, test.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var states []string
+		for _, s := range a {
+			states = append(states,
+				fmt.Sprintf("%s %s %d %d", s.ID, s.Status, s.StartsIn, s.EndsIn))
+		}
+		if got := strings.Join(states, ", "); got != test.states {
+			t.Errorf("%s: expected %q, got %q", test.name, test.states, got)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package a5gbanners
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCodeBannerUnknown = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4052,
+		Name:     "banner_unknown",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "banner not found"})
+
+	ErrCodeBannerInvalid = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4242,
+		Name:     "banner_invalid",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "banner schedule is invalid"})
+)
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeBannerUnknown, http.StatusNotFound)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeBannerInvalid, http.StatusUnprocessableEntity)
+}
+
+// BannersResponse carries ServerTime, in unix seconds, the countdowns of
+// Banners were computed at.
+type BannersResponse struct {
+	Banners    []*State `json:"banners"`
+	ServerTime int64    `json:"serverTime"`
+}
+
+// ScheduleResponse lists banners which did not end yet, for admins.
+type ScheduleResponse struct {
+	Banners []*Banner `json:"banners"`
+}
+
+type BannerRequest struct {
+	BannerID string `json:"bannerId" validate:"required"`
+}
+
+// BannersHandler answers with upcoming and active banners of the
+// a5gsession authenticated player.
+func (x *Banners) BannersHandler() a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		sess, ok := a5gsession.FromContext(ctx)
+		if !ok {
+			return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+		}
+		now := x.now().Unix()
+		banners, err := x.Banners(ctx, int64(sess.AccountID), now)
+		if err != nil {
+			return nil, x.apiErrs(err)
+		}
+		return &BannersResponse{Banners: banners, ServerTime: now}, nil
+	}
+}
+
+// ScheduleHandler answers with banners which did not end yet, mount it
+// on an admin route class.
+func (x *Banners) ScheduleHandler() a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		res, err := x.scheduleResponse()
+		if err != nil {
+			return nil, x.apiErrs(err)
+		}
+		return res, nil
+	}
+}
+
+// PutHandler schedules a Banner and answers with the schedule, mount it
+// on an admin route class.
+func (x *Banners) PutHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(Banner) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			if err := x.Put(req.Payload.(*Banner)); err != nil {
+				return nil, x.apiErrs(err)
+			}
+			res, err := x.scheduleResponse()
+			if err != nil {
+				return nil, x.apiErrs(err)
+			}
+			return res, nil
+		})
+}
+
+// RemoveHandler unschedules a banner and answers with the schedule, mount
+// it on an admin route class.
+func (x *Banners) RemoveHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(BannerRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			if err := x.Remove(req.Payload.(*BannerRequest).BannerID); err != nil {
+				return nil, x.apiErrs(err)
+			}
+			res, err := x.scheduleResponse()
+			if err != nil {
+				return nil, x.apiErrs(err)
+			}
+			return res, nil
+		})
+}
+
+func (x *Banners) scheduleResponse() (*ScheduleResponse, error) {
+	banners, err := x.Store.List(x.now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	if banners == nil {
+		banners = []*Banner{}
+	}
+	return &ScheduleResponse{Banners: banners}, nil
+}
+
+func (x *Banners) apiErrs(err error) []*a5gapi.APIErr {
+	switch errors.Cause(err) {
+	case ErrBannerUnknown:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeBannerUnknown, "")}
+	case ErrBannerInvalid:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeBannerInvalid, "")}
+	}
+	x.Logger.Error(err.Error())
+	return a5gapi.NewJSONMsgDefautlErrors(err)
+}
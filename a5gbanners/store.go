@@ -0,0 +1,147 @@
+package a5gbanners
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryStore struct {
+	mu      sync.Mutex
+	banners map[string]*Banner
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{banners: make(map[string]*Banner)}
+}
+
+func (s *memoryStore) List(endAfter int64) ([]*Banner, error) {
+	s.mu.Lock()
+	var a []*Banner
+	for _, b := range s.banners {
+		if b.EndAt > endAfter {
+			x := *b
+			a = append(a, &x)
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(a, func(i, j int) bool { return a[i].ID < a[j].ID })
+	return a, nil
+}
+
+func (s *memoryStore) Put(b *Banner) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	x := *b
+	s.banners[b.ID] = &x
+	return nil
+}
+
+func (s *memoryStore) Remove(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.banners[id]
+	delete(s.banners, id)
+	return ok, nil
+}
+
+// dbStore keeps banners in a MySQL table:
+//
+//	CREATE TABLE banners (
+//	  id VARCHAR(64) NOT NULL PRIMARY KEY,
+//	  start_at BIGINT NOT NULL,
+//	  end_at BIGINT NOT NULL,
+//	  announce_at BIGINT NOT NULL,
+//	  segments TEXT NOT NULL,
+//	  priority INT NOT NULL,
+//	  payload TEXT,
+//	  KEY end_at (end_at));
+type dbStore struct {
+	pooler    a5gdb.Pooler
+	tableName string
+}
+
+type dbBanner struct {
+	ID         string          `db:"id"`
+	StartAt    int64           `db:"start_at"`
+	EndAt      int64           `db:"end_at"`
+	AnnounceAt int64           `db:"announce_at"`
+	Segments   string          `db:"segments"`
+	Priority   int             `db:"priority"`
+	Payload    json.RawMessage `db:"payload"`
+}
+
+var bannerColumns = []string{
+	"id", "start_at", "end_at", "announce_at", "segments", "priority", "payload"}
+
+func NewDBStore(p a5gdb.Pooler, tableName string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if tableName == "" {
+		return nil, errors.New("empty banner table name")
+	}
+	return &dbStore{pooler: p, tableName: tableName}, nil
+}
+
+func (s *dbStore) List(endAfter int64) ([]*Banner, error) {
+	var rows []*dbBanner
+	_, err := s.pooler.ReadPool().NewSession().
+		Select(bannerColumns...).From(s.tableName).
+		Where(dbr.Gt("end_at", endAfter)).OrderAsc("id").Load(&rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	a := make([]*Banner, len(rows))
+	for i, x := range rows {
+		b := &Banner{
+			ID:         x.ID,
+			StartAt:    x.StartAt,
+			EndAt:      x.EndAt,
+			AnnounceAt: x.AnnounceAt,
+			Priority:   x.Priority,
+			Payload:    x.Payload}
+		if err := json.Unmarshal([]byte(x.Segments), &b.Segments); err != nil {
+			return nil, errors.Wrapf(err, "banner %q segments", x.ID)
+		}
+		a[i] = b
+	}
+	return a, nil
+}
+
+func (s *dbStore) Put(b *Banner) error {
+	segments, err := json.Marshal(b.Segments)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = s.pooler.WritePool().NewSession().InsertBySql("INSERT INTO "+
+		s.tableName+
+		" (id, start_at, end_at, announce_at, segments, priority, payload)"+
+		" VALUES (?, ?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE"+
+		" start_at = VALUES(start_at), end_at = VALUES(end_at),"+
+		" announce_at = VALUES(announce_at), segments = VALUES(segments),"+
+		" priority = VALUES(priority), payload = VALUES(payload)",
+		b.ID, b.StartAt, b.EndAt, b.AnnounceAt, string(segments), b.Priority,
+		[]byte(b.Payload)).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	return nil
+}
+
+func (s *dbStore) Remove(id string) (bool, error) {
+	res, err := s.pooler.WritePool().NewSession().
+		DeleteFrom(s.tableName).Where(dbr.Eq("id", id)).Exec()
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.(*DeleteStmt).Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	return n == 1, nil
+}
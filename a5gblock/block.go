@@ -0,0 +1,135 @@
+package a5gblock
+
+import (
+	"context"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrListFull = errors.New("block list full")
+	ErrSelf     = errors.New("can not block oneself")
+)
+
+// Kinds of entries. Muted players are hidden in chat only, blocked ones
+// can not reach the player at all: no chat, friend requests, gifts or
+// matches together.
+const (
+	KindMute  = "mute"
+	KindBlock = "block"
+)
+
+// DefaultMaxEntries caps block lists unless List.MaxEntries is set.
+const DefaultMaxEntries = 200
+
+// Entry is a player on the list of another one, CreatedAt in unix
+// seconds.
+type Entry struct {
+	AccountID uint64 `json:"accountId"`
+	Kind      string `json:"kind"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+// Store keeps block lists. Put adds or updates an entry, failing with
+// ErrListFull when a new entry would take the list over limit.
+type Store interface {
+	List(accountID uint64) ([]*Entry, error)
+	Get(accountID, otherID uint64) (*Entry, error)
+	Put(accountID uint64, e *Entry, limit int) error
+	Remove(accountID, otherID uint64) (bool, error)
+}
+
+// Lists is the block-list service other systems consult, e.g.
+//
+//	if muted, err := lists.Muted(ctx, receiverID, senderID); ...
+//
+// before delivering a chat message.
+type Lists struct {
+	Store      Store
+	MaxEntries int
+	Logger     a5glogs.Logger
+
+	now func() time.Time
+}
+
+func NewLists(s Store, l a5glogs.Logger) (*Lists, error) {
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Lists{
+		Store:      s,
+		MaxEntries: DefaultMaxEntries,
+		Logger:     l,
+		now:        time.Now}, nil
+}
+
+// Put mutes or blocks otherID for accountID, changing the kind of an
+// existing entry.
+func (x *Lists) Put(accountID, otherID uint64, kind string) (*Entry, error) {
+	if accountID == otherID {
+		return nil, errors.WithStack(ErrSelf)
+	}
+	if kind != KindMute && kind != KindBlock {
+		return nil, errors.Errorf("unknown block kind %q", kind)
+	}
+	e := &Entry{AccountID: otherID, Kind: kind, CreatedAt: x.now().Unix()}
+	if err := x.Store.Put(accountID, e, x.MaxEntries); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Remove reports whether otherID was on the list of accountID.
+func (x *Lists) Remove(accountID, otherID uint64) (bool, error) {
+	return x.Store.Remove(accountID, otherID)
+}
+
+func (x *Lists) List(accountID uint64) ([]*Entry, error) {
+	return x.Store.List(accountID)
+}
+
+// Muted reports whether chat messages of senderID are hidden from
+// receiverID, i.e. the receiver muted or blocked the sender.
+func (x *Lists) Muted(ctx context.Context, receiverID, senderID uint64) (bool, error) {
+	e, err := x.Store.Get(receiverID, senderID)
+	if err != nil {
+		return false, err
+	}
+	return e != nil, nil
+}
+
+// Blocked reports whether either player blocked the other, consult it
+// before friend requests, gifts and other interactions between them.
+func (x *Lists) Blocked(ctx context.Context, a, b uint64) (bool, error) {
+	for _, ids := range [][2]uint64{{a, b}, {b, a}} {
+		e, err := x.Store.Get(ids[0], ids[1])
+		if err != nil {
+			return false, err
+		}
+		if e != nil && e.Kind == KindBlock {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Avoided returns players accountID blocked, e.g. for
+// a5gmatchmaking.Matchmaker.Avoid.
+func (x *Lists) Avoided(accountID uint64) ([]uint64, error) {
+	entries, err := x.Store.List(accountID)
+	if err != nil {
+		return nil, err
+	}
+	var a []uint64
+	for _, e := range entries {
+		if e.Kind == KindBlock {
+			a = append(a, e.AccountID)
+		}
+	}
+	return a, nil
+}
@@ -0,0 +1,74 @@
+package a5gblock
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestLists(t *testing.T) {
+	x, err := NewLists(NewMemoryStore(), a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.MaxEntries = 2
+	tests := []struct {
+		name  string
+		other uint64
+		kind  string
+		err   error
+	}{
+		{"self", 1, KindBlock, ErrSelf},
+		{"mute", 2, KindMute, nil},
+		{"block", 3, KindBlock, nil},
+		{"full", 4, KindMute, ErrListFull},
+		{"change kind", 2, KindBlock, nil},
+		{"mute back", 2, KindMute, nil},
+	}
+	for _, test := range tests {
+		if _, err := x.Put(1, test.other, test.kind); errors.Cause(err) != test.err {
+			t.Fatalf("%s: unexpected error %v", test.name, err)
+		}
+	}
+
+	ctx := context.Background()
+	checks := []struct {
+		name    string
+		a, b    uint64
+		muted   bool
+		blocked bool
+	}{
+		{"muted", 1, 2, true, false},
+		{"muted one way", 2, 1, false, false},
+		{"blocked", 1, 3, true, true},
+		{"blocked both ways", 3, 1, false, true},
+		{"strangers", 1, 4, false, false},
+	}
+	for _, c := range checks {
+		muted, err := x.Muted(ctx, c.a, c.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocked, err := x.Blocked(ctx, c.a, c.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if muted != c.muted || blocked != c.blocked {
+			t.Errorf("%s: unexpected muted %v, blocked %v", c.name, muted, blocked)
+		}
+	}
+	if a, _ := x.Avoided(1); !reflect.DeepEqual(a, []uint64{3}) {
+		t.Errorf("unexpected avoided %v", a)
+	}
+
+	if ok, _ := x.Remove(1, 3); !ok {
+		t.Error("expected a removed entry")
+	}
+	if _, err = x.Put(1, 4, KindMute); err != nil {
+		t.Errorf("unexpected error %v after a removal", err)
+	}
+}
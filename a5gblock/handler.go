@@ -0,0 +1,112 @@
+package a5gblock
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCodeListFull = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4238,
+		Name:     "block_list_full",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "block list is full"})
+
+	ErrCodeSelf = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4239,
+		Name:     "block_self",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "can not block oneself"})
+)
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeListFull, http.StatusUnprocessableEntity)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeSelf, http.StatusUnprocessableEntity)
+}
+
+// ListResponse is the whole list, clients replace their copy with it.
+type ListResponse struct {
+	Entries    []*Entry `json:"entries"`
+	MaxEntries int      `json:"maxEntries"`
+}
+
+// UpdateRequest mutes, blocks or, with "remove", unlists a player.
+type UpdateRequest struct {
+	AccountID uint64 `json:"accountId" validate:"required"`
+	Action    string `json:"action" validate:"required,oneof=mute block remove"`
+}
+
+// ListHandler answers with the list of the a5gsession authenticated
+// player.
+func (x *Lists) ListHandler() a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		sess, ok := a5gsession.FromContext(ctx)
+		if !ok {
+			return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+		}
+		res, err := x.listResponse(sess.AccountID)
+		if err != nil {
+			return nil, x.apiErrs(err)
+		}
+		return res, nil
+	}
+}
+
+// UpdateHandler applies an UpdateRequest to the list of the a5gsession
+// authenticated player and answers with the whole list.
+func (x *Lists) UpdateHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(UpdateRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			sess, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			p := req.Payload.(*UpdateRequest)
+			var err error
+			if p.Action == "remove" {
+				_, err = x.Remove(sess.AccountID, p.AccountID)
+			} else {
+				_, err = x.Put(sess.AccountID, p.AccountID, p.Action)
+			}
+			if err != nil {
+				return nil, x.apiErrs(err)
+			}
+			res, err := x.listResponse(sess.AccountID)
+			if err != nil {
+				return nil, x.apiErrs(err)
+			}
+			return res, nil
+		})
+}
+
+func (x *Lists) listResponse(accountID uint64) (*ListResponse, error) {
+	entries, err := x.List(accountID)
+	if err != nil {
+		return nil, err
+	}
+	return &ListResponse{Entries: entries, MaxEntries: x.MaxEntries}, nil
+}
+
+func (x *Lists) apiErrs(err error) []*a5gapi.APIErr {
+	switch errors.Cause(err) {
+	case ErrListFull:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeListFull, "")}
+	case ErrSelf:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeSelf, "")}
+	}
+	x.Logger.Error(err.Error())
+	return a5gapi.NewJSONMsgDefautlErrors(err)
+}
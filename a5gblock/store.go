@@ -0,0 +1,182 @@
+package a5gblock
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryStore struct {
+	mu    sync.Mutex
+	lists map[uint64]map[uint64]*Entry
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{lists: make(map[uint64]map[uint64]*Entry)}
+}
+
+func (s *memoryStore) List(accountID uint64) ([]*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := make([]*Entry, 0, len(s.lists[accountID]))
+	for _, e := range s.lists[accountID] {
+		x := *e
+		a = append(a, &x)
+	}
+	sort.Slice(a, func(i, j int) bool { return a[i].AccountID < a[j].AccountID })
+	return a, nil
+}
+
+func (s *memoryStore) Get(accountID, otherID uint64) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.lists[accountID][otherID]
+	if !ok {
+		return nil, nil
+	}
+	x := *e
+	return &x, nil
+}
+
+func (s *memoryStore) Put(accountID uint64, e *Entry, limit int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.lists[accountID]
+	if !ok {
+		m = make(map[uint64]*Entry)
+		s.lists[accountID] = m
+	}
+	if _, ok := m[e.AccountID]; !ok && limit > 0 && len(m) >= limit {
+		return errors.WithStack(ErrListFull)
+	}
+	x := *e
+	m[e.AccountID] = &x
+	return nil
+}
+
+func (s *memoryStore) Remove(accountID, otherID uint64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.lists[accountID][otherID]
+	delete(s.lists[accountID], otherID)
+	return ok, nil
+}
+
+// dbStore keeps block lists in a MySQL table, a row per entry:
+//
+//	CREATE TABLE block_lists (
+//	  account_id BIGINT UNSIGNED NOT NULL,
+//	  other_id BIGINT UNSIGNED NOT NULL,
+//	  kind VARCHAR(8) NOT NULL,
+//	  created_at DATETIME NOT NULL,
+//	  PRIMARY KEY (account_id, other_id));
+type dbStore struct {
+	pooler    a5gdb.Pooler
+	tableName string
+}
+
+type dbEntry struct {
+	OtherID   uint64    `db:"other_id"`
+	Kind      string    `db:"kind"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+func (x *dbEntry) entry() *Entry {
+	return &Entry{AccountID: x.OtherID, Kind: x.Kind, CreatedAt: x.CreatedAt.Unix()}
+}
+
+func NewDBStore(p a5gdb.Pooler, tableName string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if tableName == "" {
+		return nil, errors.New("empty block list table name")
+	}
+	return &dbStore{pooler: p, tableName: tableName}, nil
+}
+
+func (s *dbStore) List(accountID uint64) ([]*Entry, error) {
+	var rows []*dbEntry
+	_, err := s.pooler.ReadPool().NewSession().
+		Select("other_id", "kind", "created_at").From(s.tableName).
+		Where(dbr.Eq("account_id", accountID)).OrderAsc("other_id").Load(&rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	a := make([]*Entry, len(rows))
+	for i, x := range rows {
+		a[i] = x.entry()
+	}
+	return a, nil
+}
+
+func (s *dbStore) Get(accountID, otherID uint64) (*Entry, error) {
+	x := new(dbEntry)
+	err := s.pooler.ReadPool().NewSession().
+		Select("other_id", "kind", "created_at").From(s.tableName).
+		Where(dbr.Eq("account_id", accountID)).
+		Where(dbr.Eq("other_id", otherID)).LoadOne(x)
+	if err == dbr.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	return x.entry(), nil
+}
+
+// Put locks the list of the player, so concurrent additions can not take
+// it over limit.
+func (s *dbStore) Put(accountID uint64, e *Entry, limit int) error {
+	tx, err := s.pooler.WritePool().NewSession().Begin()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*Session).Begin fn")
+	}
+	defer tx.RollbackUnlessCommitted()
+	var ids []uint64
+	_, err = tx.Select("other_id").From(s.tableName).
+		Where(dbr.Eq("account_id", accountID)).
+		Suffix("FOR UPDATE").Load(&ids)
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	if limit > 0 && len(ids) >= limit {
+		listed := false
+		for _, id := range ids {
+			listed = listed || id == e.AccountID
+		}
+		if !listed {
+			return errors.WithStack(ErrListFull)
+		}
+	}
+	_, err = tx.InsertBySql("INSERT INTO "+s.tableName+
+		" (account_id, other_id, kind, created_at) VALUES (?, ?, ?, ?)"+
+		" ON DUPLICATE KEY UPDATE kind = VALUES(kind)",
+		accountID, e.AccountID, e.Kind, time.Unix(e.CreatedAt, 0).UTC()).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	if err = tx.Commit(); err != nil {
+		return errors.Wrap(err, "dbr.(*Tx).Commit fn")
+	}
+	return nil
+}
+
+func (s *dbStore) Remove(accountID, otherID uint64) (bool, error) {
+	res, err := s.pooler.WritePool().NewSession().
+		DeleteFrom(s.tableName).
+		Where(dbr.Eq("account_id", accountID)).
+		Where(dbr.Eq("other_id", otherID)).Exec()
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.(*DeleteStmt).Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	return n == 1, nil
+}
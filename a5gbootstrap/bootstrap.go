@@ -0,0 +1,182 @@
+// Package a5gbootstrap provisions a fresh environment, e.g. a new
+// regional stack: it migrates the database, seeds balance data, creates
+// admin accounts with API keys and waits for the servers to be healthy.
+// cmd/a5gbootstrap runs it.
+package a5gbootstrap
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/armor5games/a5g/a5gadmin"
+	"github.com/armor5games/a5g/a5gbalance"
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrBalanceInvalid = errors.New("invalid balance bundle")
+	ErrUnhealthy      = errors.New("server unhealthy")
+)
+
+// Bootstrap runs the configured steps in order; unset steps are skipped.
+// Every step is idempotent, so a failed run is fixed and run again:
+// applied migrations, an existing live balance and existing admin
+// accounts are left as they are.
+type Bootstrap struct {
+	Migrator   *Migrator
+	Migrations []*Migration
+
+	// Balance is seeded to BalanceLive, the file a5gbalance.FileLive and
+	// the servers read, when there is none yet.
+	Balance     []byte
+	BalanceLive string
+	Sanity      a5gbalance.Sanity
+
+	Accounts *a5gadmin.Accounts
+	Admins   []string
+
+	// HealthURLs answer 2xx once healthy, e.g. a5gops.Drainer.ReadyHandler.
+	HealthURLs     []string
+	HealthTimeout  time.Duration
+	HealthInterval time.Duration
+	HTTPClient     *http.Client
+
+	Logger a5glogs.Logger
+}
+
+func NewBootstrap(l a5glogs.Logger) (*Bootstrap, error) {
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Bootstrap{
+		HealthTimeout:  time.Minute,
+		HealthInterval: time.Second,
+		HTTPClient:     &http.Client{Timeout: 10 * time.Second},
+		Logger:         l}, nil
+}
+
+// Report tells what a run did; APIKey of an admin is only set for
+// accounts it created and is shown nowhere else.
+type Report struct {
+	Migrations    []string           `json:"migrations"`
+	Balance       *a5gbalance.Report `json:"balance,omitempty"`
+	BalanceSeeded bool               `json:"balanceSeeded"`
+	Admins        []*AdminReport     `json:"admins,omitempty"`
+	Healthy       []string           `json:"healthy,omitempty"`
+}
+
+type AdminReport struct {
+	Account *a5gadmin.Account `json:"account"`
+	APIKey  string            `json:"apiKey,omitempty"`
+}
+
+// Run returns the report so far along with an error of a failed step.
+func (b *Bootstrap) Run(ctx context.Context) (*Report, error) {
+	r := &Report{}
+	var err error
+	if b.Migrator != nil {
+		r.Migrations, err = b.Migrator.Migrate(ctx, b.Migrations)
+		for _, id := range r.Migrations {
+			b.Logger.With(a5gfields.String("migration", id)).Info("migration applied")
+		}
+		if err != nil {
+			return r, err
+		}
+	}
+	if b.Balance != nil {
+		if r.BalanceSeeded, r.Balance, err = b.seedBalance(ctx); err != nil {
+			return r, err
+		}
+	}
+	if b.Accounts != nil {
+		for _, name := range b.Admins {
+			a, key, err := b.Accounts.Ensure(name)
+			if err != nil {
+				return r, err
+			}
+			r.Admins = append(r.Admins, &AdminReport{Account: a, APIKey: key})
+		}
+	}
+	for _, u := range b.HealthURLs {
+		if err = b.waitHealthy(ctx, u); err != nil {
+			return r, err
+		}
+		r.Healthy = append(r.Healthy, u)
+	}
+	return r, nil
+}
+
+func (b *Bootstrap) seedBalance(ctx context.Context) (bool, *a5gbalance.Report, error) {
+	if b.BalanceLive == "" {
+		return false, nil, errors.New("live balance file missing")
+	}
+	v, err := a5gbalance.NewValidator(
+		a5gbalance.FileLive(b.BalanceLive), b.Sanity, b.Logger)
+	if err != nil {
+		return false, nil, err
+	}
+	r, err := v.Check(ctx, b.Balance)
+	if err != nil {
+		return false, nil, err
+	}
+	if !r.Valid {
+		return false, r, errors.Wrap(ErrBalanceInvalid, r.Version)
+	}
+	if r.LiveVersion != "" {
+		return false, r, nil
+	}
+	// Written aside and renamed, so servers never read half a bundle.
+	tmp := filepath.Join(filepath.Dir(b.BalanceLive),
+		"."+filepath.Base(b.BalanceLive)+".tmp")
+	if err = ioutil.WriteFile(tmp, b.Balance, 0644); err != nil {
+		return false, r, errors.WithStack(err)
+	}
+	if err = os.Rename(tmp, b.BalanceLive); err != nil {
+		return false, r, errors.WithStack(err)
+	}
+	b.Logger.With(a5gfields.String("version", r.Version)).Info("balance seeded")
+	return true, r, nil
+}
+
+func (b *Bootstrap) waitHealthy(ctx context.Context, u string) error {
+	ctx, cancel := context.WithTimeout(ctx, b.HealthTimeout)
+	defer cancel()
+	t := time.NewTicker(b.HealthInterval)
+	defer t.Stop()
+	for {
+		err := b.checkHealth(ctx, u)
+		if err == nil {
+			b.Logger.With(a5gfields.String("url", u)).Info("server healthy")
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ErrUnhealthy, err.Error())
+		case <-t.C:
+		}
+	}
+}
+
+func (b *Bootstrap) checkHealth(ctx context.Context, u string) error {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	res, err := b.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err = res.Body.Close(); err != nil {
+		b.Logger.Error(err.Error())
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return errors.Errorf("%s: status %d", u, res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package a5gbootstrap
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5gadmin"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const bundle = `{"version": "1.0.0",
+	"currencies": [{"id": "soft"}],
+	"inventory": {"items": [{"id": "potion"}]}}`
+
+func TestMigrations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "a5gbootstrap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"0002_wallet.sql": "CREATE TABLE a (\n  id INT);\n\nCREATE TABLE b (id INT);\n",
+		"0001_jobs.sql":   "CREATE TABLE jobs (id INT)",
+		"README.md":       "not a migration"}
+	for name, s := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, err := LoadMigrations(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != 2 || a[0].ID != "0001_jobs" || a[1].ID != "0002_wallet" {
+		t.Fatalf("unexpected migrations %+v", a)
+	}
+	tests := []struct {
+		m    *Migration
+		want []string
+	}{
+		{a[0], []string{"CREATE TABLE jobs (id INT)"}},
+		{a[1], []string{"CREATE TABLE a (\n  id INT)", "CREATE TABLE b (id INT)"}},
+		{&Migration{SQL: "\n;\n"}, nil},
+	}
+	for _, x := range tests {
+		if got := x.m.Statements(); !reflect.DeepEqual(got, x.want) {
+			t.Errorf("%s: statements %q want %q", x.m.ID, got, x.want)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "a5gbootstrap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	b, err := NewBootstrap(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Accounts, err = a5gadmin.NewAccounts(a5gadmin.NewMemoryAccountStore(), l); err != nil {
+		t.Fatal(err)
+	}
+	// The server turns healthy on the second check.
+	var checks int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&checks, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	b.Balance, b.BalanceLive = []byte(bundle), filepath.Join(dir, "balance.json")
+	b.Admins, b.HealthURLs = []string{"ops", "support"}, []string{srv.URL}
+	b.HealthInterval = time.Millisecond
+
+	r, err := b.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.BalanceSeeded || len(r.Admins) != 2 || r.Admins[0].APIKey == "" ||
+		len(r.Healthy) != 1 || atomic.LoadInt32(&checks) != 2 {
+		t.Errorf("unexpected report %+v, %d checks", r, atomic.LoadInt32(&checks))
+	}
+	live, err := ioutil.ReadFile(b.BalanceLive)
+	if err != nil || string(live) != bundle {
+		t.Errorf("live balance %q, %v", live, err)
+	}
+	a, err := b.Accounts.Authenticate(r.Admins[1].APIKey)
+	if err != nil || a.Name != "support" {
+		t.Errorf("Authenticate() => %+v, %v", a, err)
+	}
+
+	// A second run changes nothing.
+	b.Balance = []byte(`{"version": "1.1.0", "currencies": [{"id": "soft"}],
+		"inventory": {"items": [{"id": "potion"}]}}`)
+	if r, err = b.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if r.BalanceSeeded || r.Balance.LiveVersion != "1.0.0" ||
+		r.Admins[0].APIKey != "" || r.Admins[0].Account.ID != 1 {
+		t.Errorf("unexpected rerun report %+v %+v", r, r.Admins[0])
+	}
+
+	b.Balance = []byte(`{"version": "2"}`)
+	if _, err = b.Run(context.Background()); errors.Cause(err) != ErrBalanceInvalid {
+		t.Errorf("Run() => %v want %v", err, ErrBalanceInvalid)
+	}
+	b.Balance, b.HealthTimeout = nil, 10*time.Millisecond
+	srv.Close()
+	if _, err = b.Run(context.Background()); errors.Cause(err) != ErrUnhealthy {
+		t.Errorf("Run() => %v want %v", err, ErrUnhealthy)
+	}
+}
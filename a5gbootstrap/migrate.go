@@ -0,0 +1,129 @@
+package a5gbootstrap
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/pkg/errors"
+)
+
+// Migration is a schema change applied once, in ID order. Statements
+// end with a semicolon at the end of a line.
+type Migration struct {
+	ID  string
+	SQL string
+}
+
+// Statements splits SQL into statements.
+func (m *Migration) Statements() []string {
+	var (
+		a   []string
+		cur []string
+	)
+	for _, s := range strings.Split(m.SQL, "\n") {
+		cur = append(cur, s)
+		if strings.HasSuffix(strings.TrimSpace(s), ";") {
+			a = appendStatement(a, cur)
+			cur = nil
+		}
+	}
+	return appendStatement(a, cur)
+}
+
+func appendStatement(a, lines []string) []string {
+	s := strings.TrimSuffix(strings.TrimSpace(strings.Join(lines, "\n")), ";")
+	if s == "" {
+		return a
+	}
+	return append(a, s)
+}
+
+// LoadMigrations reads the "*.sql" files of dir, named by ID, e.g.
+// "0001_jobs.sql", "0002_wallet.sql".
+func LoadMigrations(dir string) ([]*Migration, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	sort.Strings(names)
+	a := make([]*Migration, 0, len(names))
+	for _, name := range names {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		a = append(a, &Migration{
+			ID:  strings.TrimSuffix(filepath.Base(name), ".sql"),
+			SQL: string(b)})
+	}
+	return a, nil
+}
+
+// Migrator applies migrations to a MySQL database and records them in a
+// table it creates:
+//
+//	CREATE TABLE IF NOT EXISTS schema_migrations (
+//	  id VARCHAR(128) NOT NULL PRIMARY KEY,
+//	  applied_at BIGINT NOT NULL);
+//
+// MySQL commits DDL implicitly, so a migration failing halfway is left
+// unrecorded for the operator to fix and rerun.
+type Migrator struct {
+	pooler    a5gdb.Pooler
+	tableName string
+
+	now func() time.Time
+}
+
+func NewMigrator(p a5gdb.Pooler, tableName string) (*Migrator, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if tableName == "" {
+		return nil, errors.New("empty migrations table name")
+	}
+	return &Migrator{pooler: p, tableName: tableName, now: time.Now}, nil
+}
+
+// Migrate applies migrations not recorded yet and returns their IDs.
+func (m *Migrator) Migrate(ctx context.Context, a []*Migration) ([]string, error) {
+	sess := m.pooler.WritePool().NewSession()
+	_, err := sess.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+m.tableName+
+		" (id VARCHAR(128) NOT NULL PRIMARY KEY, applied_at BIGINT NOT NULL)")
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*Session).Exec fn")
+	}
+	var ids []string
+	_, err = sess.Select("id").From(m.tableName).LoadContext(ctx, &ids)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	done := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		done[id] = true
+	}
+	var applied []string
+	for _, x := range a {
+		if done[x.ID] {
+			continue
+		}
+		for _, s := range x.Statements() {
+			if _, err = sess.ExecContext(ctx, s); err != nil {
+				return applied, errors.Wrapf(err, "migration %s", x.ID)
+			}
+		}
+		_, err = sess.InsertInto(m.tableName).
+			Pair("id", x.ID).
+			Pair("applied_at", m.now().UnixNano()).ExecContext(ctx)
+		if err != nil {
+			return applied, errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+		}
+		applied = append(applied, x.ID)
+	}
+	return applied, nil
+}
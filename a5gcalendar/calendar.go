@@ -0,0 +1,135 @@
+package a5gcalendar
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gbanners"
+	"github.com/armor5games/a5g/a5gevents"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5greset"
+	"github.com/pkg/errors"
+)
+
+// Kinds of scheduled windows.
+const (
+	KindSeason      = "season"
+	KindMaintenance = "maintenance"
+)
+
+// Window is timed content the other packages don't schedule, e.g. a
+// season end or a maintenance; times are unix seconds.
+type Window struct {
+	ID      string          `json:"id"`
+	Kind    string          `json:"kind"`
+	StartAt int64           `json:"startAt"`
+	EndAt   int64           `json:"endAt"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Resets are the ends of the current game day and week of a player,
+// when daily and weekly quests reset; unix seconds.
+type Resets struct {
+	DayKey  string `json:"dayKey"`
+	DayEnd  int64  `json:"dayEnd"`
+	WeekKey string `json:"weekKey"`
+	WeekEnd int64  `json:"weekEnd"`
+}
+
+// Calendar is a player's timed content at ServerTime, in one response
+// instead of a call per feature at login.
+type Calendar struct {
+	ServerTime int64               `json:"serverTime"`
+	Resets     *Resets             `json:"resets,omitempty"`
+	Events     []*a5gevents.State  `json:"events"`
+	Banners    []*a5gbanners.State `json:"banners"`
+	Windows    []*Window           `json:"windows"`
+}
+
+// Calendars aggregates the configured sources; each is optional.
+type Calendars struct {
+	Events  *a5gevents.Scheduler
+	Banners *a5gbanners.Banners
+	Resets  *a5greset.Service
+	Logger  a5glogs.Logger
+
+	now     func() time.Time
+	mu      sync.RWMutex
+	windows []*Window
+}
+
+func NewCalendars(l a5glogs.Logger) (*Calendars, error) {
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Calendars{Logger: l, now: time.Now}, nil
+}
+
+// ReplaceWindows swaps the windows, e.g. when a maintenance is planned.
+func (c *Calendars) ReplaceWindows(windows []*Window) error {
+	ids := make(map[string]bool, len(windows))
+	for _, w := range windows {
+		if w == nil || w.ID == "" || w.Kind == "" {
+			return errors.New("invalid calendar window")
+		}
+		if w.EndAt <= w.StartAt {
+			return errors.Errorf("calendar window %q ends before it starts", w.ID)
+		}
+		if ids[w.ID] {
+			return errors.Errorf("duplicate calendar window %q", w.ID)
+		}
+		ids[w.ID] = true
+	}
+	a := append([]*Window(nil), windows...)
+	sort.SliceStable(a, func(i, j int) bool { return a[i].StartAt < a[j].StartAt })
+	c.mu.Lock()
+	c.windows = a
+	c.mu.Unlock()
+	return nil
+}
+
+// Calendar returns the calendar of a player; windows which ended are
+// left out.
+func (c *Calendars) Calendar(ctx context.Context, accountID uint64) (*Calendar, error) {
+	now := c.now()
+	x := &Calendar{
+		ServerTime: now.Unix(),
+		Events:     []*a5gevents.State{},
+		Banners:    []*a5gbanners.State{},
+		Windows:    []*Window{}}
+	var err error
+	if c.Resets != nil {
+		r, err := c.Resets.For(int64(accountID))
+		if err != nil {
+			return nil, err
+		}
+		day, week := r.Day(now), r.Week(now)
+		x.Resets = &Resets{
+			DayKey:  day.Key,
+			DayEnd:  day.End.Unix(),
+			WeekKey: week.Key,
+			WeekEnd: week.End.Unix()}
+	}
+	if c.Events != nil {
+		if x.Events, err = c.Events.Events(ctx, int64(accountID)); err != nil {
+			return nil, err
+		}
+	}
+	if c.Banners != nil {
+		x.Banners, err = c.Banners.Banners(ctx, int64(accountID), x.ServerTime)
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.mu.RLock()
+	for _, w := range c.windows {
+		if w.EndAt > x.ServerTime {
+			x.Windows = append(x.Windows, w)
+		}
+	}
+	c.mu.RUnlock()
+	return x, nil
+}
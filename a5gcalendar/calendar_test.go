@@ -0,0 +1,75 @@
+package a5gcalendar
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5gbanners"
+	"github.com/armor5games/a5g/a5gevents"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5greset"
+	"github.com/sirupsen/logrus"
+)
+
+func TestCalendar(t *testing.T) {
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	now := time.Now().UTC().Truncate(time.Second)
+	events, err := a5gevents.NewScheduler([]*a5gevents.Event{{
+		ID:    "double-xp",
+		Start: now.Add(-time.Hour).Format(a5gevents.Layout),
+		End:   now.Add(time.Hour).Format(a5gevents.Layout)}}, time.UTC, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	banners, err := a5gbanners.NewBanners(a5gbanners.NewMemoryStore(), l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = banners.Put(&a5gbanners.Banner{
+		ID: "sale", StartAt: now.Unix() + 60, EndAt: now.Unix() + 3600,
+		AnnounceAt: now.Unix() - 60}); err != nil {
+		t.Fatal(err)
+	}
+	game, _ := a5greset.NewReset(time.UTC, 0, time.Monday)
+	resets, err := a5greset.NewService(game, a5greset.ModeGame, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewCalendars(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Events, c.Banners, c.Resets = events, banners, resets
+	c.now = func() time.Time { return now }
+	if err = c.ReplaceWindows([]*Window{
+		{ID: "s1", Kind: KindSeason, StartAt: now.Unix() - 86400, EndAt: now.Unix() + 86400},
+		{ID: "m0", Kind: KindMaintenance, StartAt: now.Unix() - 7200, EndAt: now.Unix() - 3600},
+		{ID: "m1", Kind: KindMaintenance, StartAt: now.Unix() + 7200, EndAt: now.Unix() + 9000},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.ReplaceWindows([]*Window{
+		{ID: "m2", Kind: KindMaintenance, StartAt: 10, EndAt: 5}}); err == nil {
+		t.Error("expected an invalid window error")
+	}
+
+	x, err := c.Calendar(context.Background(), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.ServerTime != now.Unix() || len(x.Events) != 1 || x.Events[0].ID != "double-xp" {
+		t.Errorf("unexpected events %+v", x.Events)
+	}
+	if len(x.Banners) != 1 || x.Banners[0].Status != a5gbanners.StatusUpcoming {
+		t.Errorf("unexpected banners %+v", x.Banners)
+	}
+	if len(x.Windows) != 2 || x.Windows[0].ID != "s1" || x.Windows[1].ID != "m1" {
+		t.Errorf("unexpected windows %+v", x.Windows)
+	}
+	day := game.Day(now)
+	if x.Resets == nil || x.Resets.DayKey != day.Key || x.Resets.DayEnd != day.End.Unix() {
+		t.Errorf("unexpected resets %+v", x.Resets)
+	}
+}
@@ -0,0 +1,47 @@
+package a5gcalendar
+
+import (
+	"context"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/armor5games/a5g/a5gvalidate"
+)
+
+type WindowsRequest struct {
+	Windows []*Window `json:"windows"`
+}
+
+// CalendarHandler answers with the calendar of the a5gsession
+// authenticated player, mount it on /calendar.
+func (c *Calendars) CalendarHandler() a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		s, ok := a5gsession.FromContext(ctx)
+		if !ok {
+			return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+		}
+		x, err := c.Calendar(ctx, s.AccountID)
+		if err != nil {
+			c.Logger.Error(err.Error())
+			return nil, a5gapi.NewJSONMsgDefautlErrors(err)
+		}
+		return x, nil
+	}
+}
+
+// WindowsHandler replaces season and maintenance windows, mount it on an
+// admin route class.
+func (c *Calendars) WindowsHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(WindowsRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			if err := c.ReplaceWindows(req.Payload.(*WindowsRequest).Windows); err != nil {
+				return nil, []*a5gapi.APIErr{a5gapi.NewErr(
+					a5gvalidate.ErrCodeInvalid, "%s", err)}
+			}
+			return nil, nil
+		})
+}
@@ -0,0 +1,415 @@
+package a5gcampaign
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5gjobs"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCampaignUnknown = errors.New("campaign unknown")
+	ErrCampaignState   = errors.New("unexpected campaign state")
+)
+
+const (
+	StatusRunning  = "running"
+	StatusPaused   = "paused"
+	StatusDone     = "done"
+	StatusCanceled = "canceled"
+)
+
+// Campaign is a mail or push fan-out to an audience. Recipients are sent
+// in batches of BatchSize at Rate recipients a second in account ID
+// order; Cursor is the last account ID handed to the Sender, so a
+// campaign resumes where it stopped. Failed counts recipients of parked
+// batches, see Dispatcher.
+type Campaign struct {
+	ID        string          `json:"id"`
+	Kind      string          `json:"kind"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	Rate      float64         `json:"rate"`
+	BatchSize int             `json:"batchSize"`
+	Status    string          `json:"status"`
+	Cursor    uint64          `json:"cursor"`
+	Total     int64           `json:"total,omitempty"`
+	Sent      int64           `json:"sent"`
+	Failed    int64           `json:"failed"`
+	CreatedAt int64           `json:"createdAt"`
+	UpdatedAt int64           `json:"updatedAt"`
+}
+
+// Batch is a parked batch, sent again once the audience is exhausted.
+type Batch struct {
+	ID         int64    `json:"id"`
+	CampaignID string   `json:"campaignId"`
+	Recipients []uint64 `json:"recipients"`
+	LastErr    string   `json:"lastError"`
+}
+
+// Audience pages recipients of a campaign by account ID: up to limit IDs
+// above after in ascending order, none at the end.
+type Audience interface {
+	Next(ctx context.Context, c *Campaign, after uint64, limit int) ([]uint64, error)
+}
+
+type AudienceFunc func(
+	ctx context.Context, c *Campaign, after uint64, limit int) ([]uint64, error)
+
+func (fn AudienceFunc) Next(
+	ctx context.Context, c *Campaign, after uint64, limit int) ([]uint64, error) {
+	return fn(ctx, c, after, limit)
+}
+
+// Sender delivers a batch, e.g. inserts mail rows or enqueues pushes. A
+// batch may be sent again after a crash, so senders should be idempotent
+// per campaign and recipient.
+type Sender interface {
+	Send(ctx context.Context, c *Campaign, recipients []uint64) error
+}
+
+type SenderFunc func(ctx context.Context, c *Campaign, recipients []uint64) error
+
+func (fn SenderFunc) Send(
+	ctx context.Context, c *Campaign, recipients []uint64) error {
+	return fn(ctx, c, recipients)
+}
+
+// Store keeps campaigns and parked batches. Update applies fn to the
+// campaign atomically and stores the result unless fn fails.
+type Store interface {
+	Create(c *Campaign) error
+	Get(id string) (*Campaign, error)
+	List(status string) ([]*Campaign, error)
+	Update(id string, fn func(*Campaign) error) (*Campaign, error)
+	Park(b *Batch) error
+	Parked(campaignID string) ([]*Batch, error)
+	Unpark(batchID int64) error
+}
+
+// Dispatcher runs campaigns of the Store. Batches are retried Attempts
+// times with Backoff, then parked and sent again after the audience is
+// exhausted or when a done campaign is resumed. Pause, Resume, Cancel and
+// SetRate take effect between batches, on any instance.
+type Dispatcher struct {
+	Store    Store
+	Audience Audience
+	Sender   Sender
+	Logger   a5glogs.Logger
+	Attempts int
+	Backoff  a5gjobs.Backoff
+	// Interval is how often running campaigns are looked up.
+	Interval time.Duration
+
+	now     func() time.Time
+	sleep   func(ctx context.Context, d time.Duration) error
+	mu      sync.Mutex
+	running map[string]bool
+	wg      sync.WaitGroup
+	cancel  context.CancelFunc
+}
+
+func NewDispatcher(
+	s Store, a Audience, snd Sender, l a5glogs.Logger) (*Dispatcher, error) {
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if a == nil {
+		return nil, errors.New("audience missing")
+	}
+	if snd == nil {
+		return nil, errors.New("sender missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Dispatcher{
+		Store:    s,
+		Audience: a,
+		Sender:   snd,
+		Logger:   l,
+		Attempts: 3,
+		Backoff:  a5gjobs.Backoff{Base: time.Second, Max: time.Minute},
+		Interval: 10 * time.Second,
+		now:      time.Now,
+		sleep:    sleep,
+		running:  make(map[string]bool)}, nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
+
+// Create starts a campaign.
+func (d *Dispatcher) Create(c *Campaign) error {
+	if c.ID == "" {
+		return errors.New("empty campaign id")
+	}
+	if c.Rate <= 0 || c.BatchSize < 1 {
+		return errors.Errorf("campaign %q has no rate or batch size", c.ID)
+	}
+	now := d.now().Unix()
+	c.Status, c.Cursor, c.Sent, c.Failed = StatusRunning, 0, 0, 0
+	c.CreatedAt, c.UpdatedAt = now, now
+	return d.Store.Create(c)
+}
+
+// Pause stops a running campaign after its current batch.
+func (d *Dispatcher) Pause(id string) (*Campaign, error) {
+	return d.transit(id, StatusPaused, StatusRunning)
+}
+
+// Resume continues a paused campaign or sends parked batches of a done
+// one again.
+func (d *Dispatcher) Resume(id string) (*Campaign, error) {
+	return d.transit(id, StatusRunning, StatusPaused, StatusDone)
+}
+
+func (d *Dispatcher) Cancel(id string) (*Campaign, error) {
+	return d.transit(id, StatusCanceled, StatusRunning, StatusPaused)
+}
+
+func (d *Dispatcher) transit(id, to string, from ...string) (*Campaign, error) {
+	return d.Store.Update(id, func(c *Campaign) error {
+		for _, s := range from {
+			if c.Status == s {
+				c.Status = to
+				c.UpdatedAt = d.now().Unix()
+				return nil
+			}
+		}
+		return errors.Wrapf(ErrCampaignState, "campaign %q is %s", id, c.Status)
+	})
+}
+
+// SetRate changes the send rate, in recipients a second.
+func (d *Dispatcher) SetRate(id string, rate float64) (*Campaign, error) {
+	if rate <= 0 {
+		return nil, errors.Errorf("invalid campaign rate %v", rate)
+	}
+	return d.Store.Update(id, func(c *Campaign) error {
+		c.Rate = rate
+		c.UpdatedAt = d.now().Unix()
+		return nil
+	})
+}
+
+// Run sends a campaign until it is done, paused or canceled.
+func (d *Dispatcher) Run(ctx context.Context, id string) error {
+	b := new(bucket)
+	for {
+		c, err := d.Store.Get(id)
+		if err != nil {
+			return err
+		}
+		if c.Status != StatusRunning {
+			return nil
+		}
+		ids, err := d.Audience.Next(ctx, c, c.Cursor, c.BatchSize)
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return d.finish(ctx, c, b)
+		}
+		if err = d.wait(ctx, b, c, len(ids)); err != nil {
+			return err
+		}
+		sendErr := d.send(ctx, c, ids)
+		if sendErr != nil && ctx.Err() != nil {
+			// Stopped, the batch is sent again on the next run.
+			return sendErr
+		}
+		if sendErr != nil {
+			if err = d.Store.Park(&Batch{CampaignID: c.ID, Recipients: ids,
+				LastErr: sendErr.Error()}); err != nil {
+				return err
+			}
+		}
+		cursor := c.Cursor
+		_, err = d.Store.Update(id, func(x *Campaign) error {
+			if x.Cursor != cursor {
+				return errors.Wrapf(ErrCampaignState,
+					"campaign %q advanced concurrently", id)
+			}
+			x.Cursor = ids[len(ids)-1]
+			if sendErr != nil {
+				x.Failed += int64(len(ids))
+			} else {
+				x.Sent += int64(len(ids))
+			}
+			x.UpdatedAt = d.now().Unix()
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// finish sends parked batches again and marks the campaign done; batches
+// failing again stay parked.
+func (d *Dispatcher) finish(ctx context.Context, c *Campaign, b *bucket) error {
+	batches, err := d.Store.Parked(c.ID)
+	if err != nil {
+		return err
+	}
+	for _, x := range batches {
+		if err = d.wait(ctx, b, c, len(x.Recipients)); err != nil {
+			return err
+		}
+		if err := d.send(ctx, c, x.Recipients); err != nil {
+			continue
+		}
+		if err = d.Store.Unpark(x.ID); err != nil {
+			return err
+		}
+		n := int64(len(x.Recipients))
+		if _, err = d.Store.Update(c.ID, func(c *Campaign) error {
+			c.Sent += n
+			c.Failed -= n
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	_, err = d.transit(c.ID, StatusDone, StatusRunning)
+	if errors.Cause(err) == ErrCampaignState {
+		// Paused or canceled meanwhile.
+		return nil
+	}
+	return err
+}
+
+// send delivers a batch with retries.
+func (d *Dispatcher) send(ctx context.Context, c *Campaign, ids []uint64) error {
+	var err error
+	for i := 1; ; i++ {
+		if err = d.Sender.Send(ctx, c, ids); err == nil {
+			return nil
+		}
+		if i >= d.Attempts {
+			break
+		}
+		if x := d.sleep(ctx, d.Backoff.Duration(i)); x != nil {
+			return x
+		}
+	}
+	d.Logger.With(
+		a5gfields.String("campaign", c.ID),
+		a5gfields.Int("recipients", len(ids))).Error(err.Error())
+	return err
+}
+
+// bucket is a token bucket of a campaign holding up to a batch of
+// recipients, refilled at the campaign rate re-read before every batch. It
+// starts full.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (d *Dispatcher) wait(ctx context.Context, b *bucket, c *Campaign, n int) error {
+	now := d.now()
+	if b.last.IsZero() {
+		b.tokens = float64(c.BatchSize)
+	} else {
+		b.tokens += now.Sub(b.last).Seconds() * c.Rate
+	}
+	if max := float64(c.BatchSize); b.tokens > max {
+		b.tokens = max
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return nil
+	}
+	return d.sleep(ctx, time.Duration(-b.tokens/c.Rate*float64(time.Second)))
+}
+
+// Start runs campaigns of the Store every Interval until Stop is called.
+// Run a single dispatcher per Store, e.g. on the leader instance.
+func (d *Dispatcher) Start() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cancel != nil {
+		return errors.New("dispatcher already started")
+	}
+	var ctx context.Context
+	ctx, d.cancel = context.WithCancel(context.Background())
+	d.wg.Add(1)
+	go d.poll(ctx)
+	return nil
+}
+
+func (d *Dispatcher) poll(ctx context.Context) {
+	defer d.wg.Done()
+	t := time.NewTicker(d.Interval)
+	defer t.Stop()
+	for {
+		campaigns, err := d.Store.List(StatusRunning)
+		if err != nil {
+			d.Logger.Error(err.Error())
+		}
+		for _, c := range campaigns {
+			d.mu.Lock()
+			if d.running[c.ID] {
+				d.mu.Unlock()
+				continue
+			}
+			d.running[c.ID] = true
+			d.wg.Add(1)
+			d.mu.Unlock()
+			go func(id string) {
+				defer d.wg.Done()
+				if err := d.Run(ctx, id); err != nil && ctx.Err() == nil {
+					d.Logger.With(a5gfields.String("campaign", id)).
+						Error(err.Error())
+				}
+				d.mu.Lock()
+				delete(d.running, id)
+				d.mu.Unlock()
+			}(c.ID)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Stop waits for running batches until ctx is done.
+func (d *Dispatcher) Stop(ctx context.Context) error {
+	d.mu.Lock()
+	cancel := d.cancel
+	d.cancel = nil
+	d.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
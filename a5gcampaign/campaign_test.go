@@ -0,0 +1,92 @@
+package a5gcampaign
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestDispatcherRun(t *testing.T) {
+	audience := AudienceFunc(func(
+		ctx context.Context, c *Campaign, after uint64, limit int) ([]uint64, error) {
+		var a []uint64
+		for id := after + 1; id <= 9 && len(a) < limit; id++ {
+			a = append(a, id)
+		}
+		return a, nil
+	})
+	sent := make(map[uint64]int)
+	failing := true
+	sender := SenderFunc(func(
+		ctx context.Context, c *Campaign, recipients []uint64) error {
+		if recipients[0] == 4 && failing {
+			return errors.New("mail db unavailable")
+		}
+		for _, id := range recipients {
+			sent[id]++
+		}
+		return nil
+	})
+	s := NewMemoryStore()
+	d, err := NewDispatcher(
+		s, audience, sender, a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1000, 0)
+	var slept time.Duration
+	d.now = func() time.Time { return now }
+	d.sleep = func(ctx context.Context, x time.Duration) error {
+		slept += x
+		now = now.Add(x)
+		return nil
+	}
+	if err = d.Create(&Campaign{ID: "spring", Kind: "mail", Rate: 3,
+		BatchSize: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Pause("spring"); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Run(context.Background(), "spring"); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 0 {
+		t.Fatalf("paused campaign sent %v", sent)
+	}
+	if _, err = d.Resume("spring"); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Run(context.Background(), "spring"); err != nil {
+		t.Fatal(err)
+	}
+	c, _ := s.Get("spring")
+	if c.Status != StatusDone || c.Sent != 6 || c.Failed != 3 || c.Cursor != 9 {
+		t.Errorf("unexpected campaign %+v", c)
+	}
+	// Batches of three recipients a second after the first one from the
+	// full bucket, the failing batch twice with 1s and 2s of backoff.
+	if slept != 8*time.Second {
+		t.Errorf("unexpected sleep %s", slept)
+	}
+	failing = false
+	if _, err = d.Resume("spring"); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Run(context.Background(), "spring"); err != nil {
+		t.Fatal(err)
+	}
+	c, _ = s.Get("spring")
+	batches, _ := s.Parked("spring")
+	if c.Status != StatusDone || c.Sent != 9 || c.Failed != 0 ||
+		len(batches) != 0 || len(sent) != 9 {
+		t.Errorf("unexpected campaign %+v after a retry", c)
+	}
+	if _, err = d.Cancel("spring"); errors.Cause(err) != ErrCampaignState {
+		t.Errorf("expected a state error, got %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package a5gcampaign
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCodeCampaignUnknown = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4046,
+		Name:     "campaign_unknown",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "campaign not found"})
+
+	ErrCodeCampaignState = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4230,
+		Name:     "campaign_state",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "campaign can not do that now"})
+)
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeCampaignUnknown, http.StatusNotFound)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeCampaignState, http.StatusUnprocessableEntity)
+}
+
+type CampaignRequest struct {
+	CampaignID string `json:"campaignId" validate:"required"`
+}
+
+// ControlRequest pauses, resumes or cancels a campaign or, with "rate",
+// changes its send rate.
+type ControlRequest struct {
+	CampaignID string  `json:"campaignId" validate:"required"`
+	Action     string  `json:"action" validate:"required,oneof=pause resume cancel rate"`
+	Rate       float64 `json:"rate"`
+}
+
+// ProgressHandler answers with a campaign, mount it on an admin route
+// class.
+func (d *Dispatcher) ProgressHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(CampaignRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			c, err := d.Store.Get(req.Payload.(*CampaignRequest).CampaignID)
+			if err != nil {
+				return nil, d.apiErrs(err)
+			}
+			return c, nil
+		})
+}
+
+// ControlHandler applies a ControlRequest and answers with the campaign,
+// mount it on an admin route class.
+func (d *Dispatcher) ControlHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(ControlRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			p := req.Payload.(*ControlRequest)
+			var (
+				c   *Campaign
+				err error
+			)
+			switch p.Action {
+			case "pause":
+				c, err = d.Pause(p.CampaignID)
+			case "resume":
+				c, err = d.Resume(p.CampaignID)
+			case "cancel":
+				c, err = d.Cancel(p.CampaignID)
+			case "rate":
+				if p.Rate <= 0 {
+					return nil, []*a5gapi.APIErr{a5gapi.NewErr(
+						ErrCodeCampaignState, "rate must be positive")}
+				}
+				c, err = d.SetRate(p.CampaignID, p.Rate)
+			}
+			if err != nil {
+				return nil, d.apiErrs(err)
+			}
+			return c, nil
+		})
+}
+
+func (d *Dispatcher) apiErrs(err error) []*a5gapi.APIErr {
+	switch errors.Cause(err) {
+	case ErrCampaignUnknown:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeCampaignUnknown, "")}
+	case ErrCampaignState:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeCampaignState, "%s", err)}
+	}
+	d.Logger.Error(err.Error())
+	return a5gapi.NewJSONMsgDefautlErrors(err)
+}
@@ -0,0 +1,305 @@
+package a5gcampaign
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryStore struct {
+	mu        sync.Mutex
+	campaigns map[string]*Campaign
+	batches   map[int64]*Batch
+	lastID    int64
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{
+		campaigns: make(map[string]*Campaign),
+		batches:   make(map[int64]*Batch)}
+}
+
+func (s *memoryStore) Create(c *Campaign) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.campaigns[c.ID]; ok {
+		return errors.Errorf("campaign %q already exists", c.ID)
+	}
+	x := *c
+	s.campaigns[c.ID] = &x
+	return nil
+}
+
+func (s *memoryStore) Get(id string) (*Campaign, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.campaigns[id]
+	if !ok {
+		return nil, errors.Wrap(ErrCampaignUnknown, id)
+	}
+	x := *c
+	return &x, nil
+}
+
+func (s *memoryStore) List(status string) ([]*Campaign, error) {
+	s.mu.Lock()
+	var a []*Campaign
+	for _, c := range s.campaigns {
+		if status == "" || c.Status == status {
+			x := *c
+			a = append(a, &x)
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(a, func(i, j int) bool { return a[i].CreatedAt < a[j].CreatedAt })
+	return a, nil
+}
+
+func (s *memoryStore) Update(id string, fn func(*Campaign) error) (*Campaign, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.campaigns[id]
+	if !ok {
+		return nil, errors.Wrap(ErrCampaignUnknown, id)
+	}
+	x := *c
+	if err := fn(&x); err != nil {
+		return nil, err
+	}
+	s.campaigns[id] = &x
+	y := x
+	return &y, nil
+}
+
+func (s *memoryStore) Park(b *Batch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	x := *b
+	x.ID = s.lastID
+	s.batches[x.ID] = &x
+	return nil
+}
+
+func (s *memoryStore) Parked(campaignID string) ([]*Batch, error) {
+	s.mu.Lock()
+	var a []*Batch
+	for _, b := range s.batches {
+		if b.CampaignID == campaignID {
+			x := *b
+			a = append(a, &x)
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(a, func(i, j int) bool { return a[i].ID < a[j].ID })
+	return a, nil
+}
+
+func (s *memoryStore) Unpark(batchID int64) error {
+	s.mu.Lock()
+	delete(s.batches, batchID)
+	s.mu.Unlock()
+	return nil
+}
+
+// dbStore keeps campaigns and parked batches in MySQL tables:
+//
+//	CREATE TABLE campaigns (
+//	  id VARCHAR(64) PRIMARY KEY,
+//	  kind VARCHAR(32) NOT NULL,
+//	  payload BLOB,
+//	  rate DOUBLE NOT NULL,
+//	  batch_size INT NOT NULL,
+//	  status VARCHAR(16) NOT NULL,
+//	  last_recipient BIGINT UNSIGNED NOT NULL,
+//	  total BIGINT NOT NULL,
+//	  sent BIGINT NOT NULL,
+//	  failed BIGINT NOT NULL,
+//	  created_at BIGINT NOT NULL,
+//	  updated_at BIGINT NOT NULL,
+//	  KEY status (status));
+//
+//	CREATE TABLE campaign_batches (
+//	  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+//	  campaign_id VARCHAR(64) NOT NULL,
+//	  recipients MEDIUMTEXT NOT NULL,
+//	  last_error TEXT,
+//	  KEY campaign_id (campaign_id));
+type dbStore struct {
+	pooler             a5gdb.Pooler
+	campaignsTableName string
+	batchesTableName   string
+}
+
+type dbCampaign struct {
+	ID        string          `db:"id"`
+	Kind      string          `db:"kind"`
+	Payload   json.RawMessage `db:"payload"`
+	Rate      float64         `db:"rate"`
+	BatchSize int             `db:"batch_size"`
+	Status    string          `db:"status"`
+	Cursor    uint64          `db:"last_recipient"`
+	Total     int64           `db:"total"`
+	Sent      int64           `db:"sent"`
+	Failed    int64           `db:"failed"`
+	CreatedAt int64           `db:"created_at"`
+	UpdatedAt int64           `db:"updated_at"`
+}
+
+var campaignColumns = []string{
+	"id", "kind", "payload", "rate", "batch_size", "status", "last_recipient",
+	"total", "sent", "failed", "created_at", "updated_at"}
+
+type dbBatch struct {
+	ID         int64  `db:"id"`
+	CampaignID string `db:"campaign_id"`
+	Recipients string `db:"recipients"`
+	LastErr    string `db:"last_error"`
+}
+
+func NewDBStore(
+	p a5gdb.Pooler, campaignsTableName, batchesTableName string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if campaignsTableName == "" || batchesTableName == "" {
+		return nil, errors.New("empty campaign table name")
+	}
+	return &dbStore{
+		pooler:             p,
+		campaignsTableName: campaignsTableName,
+		batchesTableName:   batchesTableName}, nil
+}
+
+func (s *dbStore) Create(c *Campaign) error {
+	x := dbCampaign(*c)
+	_, err := s.pooler.WritePool().NewSession().
+		InsertInto(s.campaignsTableName).Columns(campaignColumns...).
+		Record(&x).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	return nil
+}
+
+func (s *dbStore) Get(id string) (*Campaign, error) {
+	x := new(dbCampaign)
+	err := s.pooler.ReadPool().NewSession().
+		Select(campaignColumns...).From(s.campaignsTableName).
+		Where(dbr.Eq("id", id)).LoadOne(x)
+	if err == dbr.ErrNotFound {
+		return nil, errors.Wrap(ErrCampaignUnknown, id)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	c := Campaign(*x)
+	return &c, nil
+}
+
+func (s *dbStore) List(status string) ([]*Campaign, error) {
+	stmt := s.pooler.ReadPool().NewSession().
+		Select(campaignColumns...).From(s.campaignsTableName).
+		OrderAsc("created_at")
+	if status != "" {
+		stmt = stmt.Where(dbr.Eq("status", status))
+	}
+	var a []*dbCampaign
+	if _, err := stmt.Load(&a); err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	campaigns := make([]*Campaign, len(a))
+	for i, x := range a {
+		c := Campaign(*x)
+		campaigns[i] = &c
+	}
+	return campaigns, nil
+}
+
+// Update locks the campaign row, so control calls and progress of a
+// running campaign are serialized.
+func (s *dbStore) Update(id string, fn func(*Campaign) error) (*Campaign, error) {
+	tx, err := s.pooler.WritePool().NewSession().Begin()
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*Session).Begin fn")
+	}
+	defer tx.RollbackUnlessCommitted()
+	x := new(dbCampaign)
+	err = tx.Select(campaignColumns...).From(s.campaignsTableName).
+		Where(dbr.Eq("id", id)).Suffix("FOR UPDATE").LoadOne(x)
+	if err == dbr.ErrNotFound {
+		return nil, errors.Wrap(ErrCampaignUnknown, id)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	c := Campaign(*x)
+	if err = fn(&c); err != nil {
+		return nil, err
+	}
+	_, err = tx.Update(s.campaignsTableName).
+		Set("rate", c.Rate).
+		Set("status", c.Status).
+		Set("last_recipient", c.Cursor).
+		Set("total", c.Total).
+		Set("sent", c.Sent).
+		Set("failed", c.Failed).
+		Set("updated_at", c.UpdatedAt).
+		Where(dbr.Eq("id", id)).Exec()
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*UpdateStmt).Exec fn")
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "dbr.(*Tx).Commit fn")
+	}
+	return &c, nil
+}
+
+func (s *dbStore) Park(b *Batch) error {
+	recipients, err := json.Marshal(b.Recipients)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = s.pooler.WritePool().NewSession().
+		InsertInto(s.batchesTableName).
+		Pair("campaign_id", b.CampaignID).
+		Pair("recipients", string(recipients)).
+		Pair("last_error", b.LastErr).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	return nil
+}
+
+func (s *dbStore) Parked(campaignID string) ([]*Batch, error) {
+	var a []*dbBatch
+	_, err := s.pooler.ReadPool().NewSession().
+		Select("id", "campaign_id", "recipients", "last_error").
+		From(s.batchesTableName).
+		Where(dbr.Eq("campaign_id", campaignID)).OrderAsc("id").Load(&a)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	batches := make([]*Batch, len(a))
+	for i, x := range a {
+		b := &Batch{ID: x.ID, CampaignID: x.CampaignID, LastErr: x.LastErr}
+		if err := json.Unmarshal([]byte(x.Recipients), &b.Recipients); err != nil {
+			return nil, errors.Wrapf(err, "campaign batch %d", x.ID)
+		}
+		batches[i] = b
+	}
+	return batches, nil
+}
+
+func (s *dbStore) Unpark(batchID int64) error {
+	_, err := s.pooler.WritePool().NewSession().
+		DeleteFrom(s.batchesTableName).Where(dbr.Eq("id", batchID)).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*DeleteStmt).Exec fn")
+	}
+	return nil
+}
@@ -0,0 +1,422 @@
+package a5gchat
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/armor5games/a5g/a5gblock"
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrChannelUnknown = errors.New("chat channel unknown")
+	ErrMessageInvalid = errors.New("chat message invalid")
+	ErrNotMember      = errors.New("not a chat channel member")
+	ErrBlocked        = errors.New("chat receiver unreachable")
+)
+
+// Message is a chat line, CreatedAt in unix milliseconds. Translation is
+// added for the receiver, it is never stored.
+type Message struct {
+	ID          int64        `json:"id" db:"id"`
+	Channel     string       `json:"channel" db:"channel"`
+	SenderID    uint64       `json:"senderId" db:"sender_id"`
+	Text        string       `json:"text" db:"text"`
+	CreatedAt   int64        `json:"createdAt" db:"created_at"`
+	Translation *Translation `json:"translation,omitempty" db:"-"`
+}
+
+const privatePrefix = "private:"
+
+// PrivateChannel is the channel of two players, the same either way.
+func PrivateChannel(a, b uint64) string {
+	if a > b {
+		a, b = b, a
+	}
+	return privatePrefix + strconv.FormatUint(a, 10) + ":" + strconv.FormatUint(b, 10)
+}
+
+func privateMembers(channel string) ([]uint64, bool) {
+	if !strings.HasPrefix(channel, privatePrefix) {
+		return nil, false
+	}
+	ids := strings.Split(channel[len(privatePrefix):], ":")
+	if len(ids) != 2 {
+		return nil, false
+	}
+	a := make([]uint64, 2)
+	for i, s := range ids {
+		id, err := strconv.ParseUint(s, 10, 64)
+		if err != nil || id == 0 {
+			return nil, false
+		}
+		a[i] = id
+	}
+	return a, a[0] < a[1]
+}
+
+// Policy keeps messages of channels starting with Prefix, e.g. "clan:",
+// for Retention. Channels without a policy are unknown.
+type Policy struct {
+	Prefix    string
+	Retention time.Duration
+}
+
+// Query filters messages for moderation cases, zero fields match any.
+// Keyword matches text case-insensitively; From and To bound CreatedAt.
+type Query struct {
+	SenderID uint64 `json:"senderId"`
+	Channel  string `json:"channel" validate:"max=128"`
+	Keyword  string `json:"keyword" validate:"max=64"`
+	From     int64  `json:"from"`
+	To       int64  `json:"to"`
+}
+
+func (q *Query) Match(m *Message) bool {
+	return (q.SenderID == 0 || m.SenderID == q.SenderID) &&
+		(q.Channel == "" || m.Channel == q.Channel) &&
+		(q.Keyword == "" ||
+			strings.Contains(strings.ToLower(m.Text), strings.ToLower(q.Keyword))) &&
+		(q.From == 0 || m.CreatedAt >= q.From) &&
+		(q.To == 0 || m.CreatedAt < q.To)
+}
+
+// Store keeps messages. Append assigns increasing IDs; History and
+// Search list messages before beforeID, 0 for the latest, newest first.
+// Purge deletes up to limit messages of channels starting with prefix
+// created before before; Erase deletes every message of a sender.
+type Store interface {
+	Append(m *Message) (int64, error)
+	History(channel string, beforeID int64, limit int) ([]*Message, error)
+	Search(q *Query, beforeID int64, limit int) ([]*Message, error)
+	Purge(prefix string, before int64, limit int) (int64, error)
+	Erase(senderID uint64) (int64, error)
+}
+
+// MembersFunc returns members of a group channel, e.g. of a clan, nil
+// for channels open to everyone.
+type MembersFunc func(ctx context.Context, channel string) ([]uint64, error)
+
+// PushFunc delivers an event to a player, usually an a5gws.Conn lookup
+// by account.
+type PushFunc func(accountID uint64, event string, payload interface{}) error
+
+// Chat stores messages by channel and delivers them. Private channels
+// are between their two players; group channels are limited to Members
+// when it is set and open otherwise. Blocks hides muted senders and
+// keeps blocked players apart; Translations, when set, translates messages
+// for receivers of other languages. Chat is an a5gapp.Module purging messages
+// past the retention of their Policies every Interval.
+type Chat struct {
+	Store    Store
+	Policies []*Policy
+	Blocks   *a5gblock.Lists
+	Members  MembersFunc
+	Push     PushFunc
+	// Translations is optional.
+	Translations *Translations
+	// Prefs gates typing events and read receipts kept by Reads, both
+	// are optional.
+	Prefs     PrefsStore
+	Reads     ReadStore
+	Logger    a5glogs.Logger
+	MaxLength int
+	Interval  time.Duration
+	BatchSize int
+
+	now     func() time.Time
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+// NewChat checks that prefixes of policies do not overlap, so every
+// channel has a single retention.
+func NewChat(s Store, policies []*Policy, l a5glogs.Logger) (*Chat, error) {
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	for i, p := range policies {
+		if p == nil || p.Prefix == "" || p.Retention <= 0 {
+			return nil, errors.New("unexpected chat retention policy")
+		}
+		for _, x := range policies[:i] {
+			if strings.HasPrefix(p.Prefix, x.Prefix) ||
+				strings.HasPrefix(x.Prefix, p.Prefix) {
+				return nil, errors.Errorf("chat policies %q and %q overlap",
+					x.Prefix, p.Prefix)
+			}
+		}
+	}
+	return &Chat{
+		Store:     s,
+		Policies:  policies,
+		Logger:    l,
+		MaxLength: 500,
+		Interval:  time.Hour,
+		BatchSize: 1000,
+		now:       time.Now}, nil
+}
+
+func (c *Chat) policy(channel string) *Policy {
+	for _, p := range c.Policies {
+		if strings.HasPrefix(channel, p.Prefix) {
+			return p
+		}
+	}
+	return nil
+}
+
+// members returns players of a channel accountID may use, nil for open
+// channels.
+func (c *Chat) members(
+	ctx context.Context, accountID uint64, channel string) ([]uint64, error) {
+	if c.policy(channel) == nil {
+		return nil, errors.Wrap(ErrChannelUnknown, channel)
+	}
+	a, ok := privateMembers(channel)
+	if !ok && strings.HasPrefix(channel, privatePrefix) {
+		return nil, errors.Wrap(ErrChannelUnknown, channel)
+	}
+	if !ok && c.Members == nil {
+		return nil, nil
+	}
+	if !ok {
+		var err error
+		if a, err = c.Members(ctx, channel); err != nil || a == nil {
+			return nil, err
+		}
+	}
+	for _, id := range a {
+		if id == accountID {
+			return a, nil
+		}
+	}
+	return nil, ErrNotMember
+}
+
+// Send stores a message of senderID and pushes it as the "chat" event to
+// the other members who did not mute the sender.
+func (c *Chat) Send(
+	ctx context.Context, senderID uint64, channel, text string) (*Message, error) {
+	text = strings.TrimSpace(text)
+	if text == "" || utf8.RuneCountInString(text) > c.MaxLength ||
+		!utf8.ValidString(text) {
+		return nil, ErrMessageInvalid
+	}
+	members, err := c.members(ctx, senderID, channel)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := privateMembers(channel); ok && c.Blocks != nil {
+		blocked, err := c.Blocks.Blocked(ctx, members[0], members[1])
+		if err != nil {
+			return nil, err
+		}
+		if blocked {
+			return nil, ErrBlocked
+		}
+	}
+	m := &Message{
+		Channel:   channel,
+		SenderID:  senderID,
+		Text:      text,
+		CreatedAt: c.now().UnixNano() / int64(time.Millisecond)}
+	if m.ID, err = c.Store.Append(m); err != nil {
+		return nil, err
+	}
+	c.deliver(ctx, m, members)
+	return m, nil
+}
+
+func (c *Chat) deliver(ctx context.Context, m *Message, members []uint64) {
+	if c.Push == nil {
+		return
+	}
+	locale := c.Translations.senderLocale(m.SenderID)
+	for _, id := range members {
+		if id == m.SenderID {
+			continue
+		}
+		if c.Blocks != nil {
+			muted, err := c.Blocks.Muted(ctx, id, m.SenderID)
+			if err != nil {
+				c.Logger.Error(err.Error())
+				continue
+			}
+			if muted {
+				continue
+			}
+		}
+		x := c.Translations.translated(ctx, m, locale, id)
+		if err := c.Push(id, "chat", x); err != nil {
+			c.Logger.With(a5gfields.String("channel", m.Channel)).Warn(err.Error())
+		}
+	}
+}
+
+// History returns messages of a channel before beforeID, newest first,
+// translated for accountID and leaving out senders they muted. next is
+// where the following page starts, 0 when there are no more messages.
+func (c *Chat) History(ctx context.Context, accountID uint64, channel string,
+	beforeID int64, limit int) (a []*Message, next int64, err error) {
+	if _, err = c.members(ctx, accountID, channel); err != nil {
+		return nil, 0, err
+	}
+	if a, err = c.Store.History(channel, beforeID, limit); err != nil {
+		return nil, 0, err
+	}
+	if len(a) == limit && limit > 0 {
+		next = a[len(a)-1].ID
+	}
+	kept := a[:0]
+	locales := map[uint64]string{}
+	for _, m := range a {
+		if c.Blocks != nil {
+			muted, err := c.Blocks.Muted(ctx, accountID, m.SenderID)
+			if err != nil {
+				return nil, 0, err
+			}
+			if muted {
+				continue
+			}
+		}
+		if c.Translations != nil && m.SenderID != accountID {
+			locale, ok := locales[m.SenderID]
+			if !ok {
+				locale = c.Translations.senderLocale(m.SenderID)
+				locales[m.SenderID] = locale
+			}
+			m = c.Translations.translated(ctx, m, locale, accountID)
+		}
+		kept = append(kept, m)
+	}
+	return kept, next, nil
+}
+
+// Search lists messages of a query for moderation, newest first.
+func (c *Chat) Search(q *Query, beforeID int64, limit int) ([]*Message, error) {
+	return c.Store.Search(q, beforeID, limit)
+}
+
+// Export writes every message of a player as JSON lines, for data
+// access requests, and returns their number.
+func (c *Chat) Export(ctx context.Context, accountID uint64, w io.Writer) (int64, error) {
+	enc := json.NewEncoder(w)
+	var n, before int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return n, errors.WithStack(err)
+		}
+		a, err := c.Store.Search(&Query{SenderID: accountID}, before, c.BatchSize)
+		if err != nil {
+			return n, err
+		}
+		for _, m := range a {
+			if err = enc.Encode(m); err != nil {
+				return n, errors.WithStack(err)
+			}
+			n++
+		}
+		if len(a) < c.BatchSize {
+			return n, nil
+		}
+		before = a[len(a)-1].ID
+	}
+}
+
+// Erase deletes every message of a player, for erasure requests.
+func (c *Chat) Erase(ctx context.Context, accountID uint64) (int64, error) {
+	return c.Store.Erase(accountID)
+}
+
+// Purge deletes messages past their retention and returns counts by
+// policy prefix. It stops between batches when ctx is done.
+func (c *Chat) Purge(ctx context.Context) (map[string]int64, error) {
+	purged := make(map[string]int64, len(c.Policies))
+	for _, p := range c.Policies {
+		before := c.now().Add(-p.Retention).UnixNano() / int64(time.Millisecond)
+		for {
+			if err := ctx.Err(); err != nil {
+				return purged, errors.WithStack(err)
+			}
+			n, err := c.Store.Purge(p.Prefix, before, c.BatchSize)
+			if err != nil {
+				return purged, errors.Wrapf(err, "chat policy %q", p.Prefix)
+			}
+			purged[p.Prefix] += n
+			if n < int64(c.BatchSize) {
+				break
+			}
+		}
+	}
+	return purged, nil
+}
+
+func (c *Chat) Name() string { return "chat" }
+
+// Start runs Purge every Interval until Stop is called.
+func (c *Chat) Start(context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancel != nil {
+		return errors.New("chat already started")
+	}
+	var ctx context.Context
+	ctx, c.cancel = context.WithCancel(context.Background())
+	c.stopped = make(chan struct{})
+	go c.run(ctx, c.stopped)
+	return nil
+}
+
+func (c *Chat) run(ctx context.Context, stopped chan struct{}) {
+	defer close(stopped)
+	t := time.NewTicker(c.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		purged, err := c.Purge(ctx)
+		if err != nil && ctx.Err() == nil {
+			c.Logger.Error(err.Error())
+		}
+		for prefix, n := range purged {
+			if n > 0 {
+				c.Logger.With(a5gfields.String("chatPolicy", prefix),
+					a5gfields.Int64("messages", n)).Info("chat messages purged")
+			}
+		}
+	}
+}
+
+// Stop waits for the running purge until ctx is done.
+func (c *Chat) Stop(ctx context.Context) error {
+	c.mu.Lock()
+	cancel, stopped := c.cancel, c.stopped
+	c.cancel = nil
+	c.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
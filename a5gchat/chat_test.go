@@ -0,0 +1,138 @@
+package a5gchat
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5gblock"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestChat(t *testing.T) {
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	if _, err := NewChat(NewMemoryStore(), []*Policy{
+		{Prefix: "clan:", Retention: time.Hour},
+		{Prefix: "clan:1", Retention: time.Hour}}, l); err == nil {
+		t.Error("overlapping policies accepted")
+	}
+	c, err := NewChat(NewMemoryStore(), []*Policy{
+		{Prefix: privatePrefix, Retention: 30 * 24 * time.Hour},
+		{Prefix: "clan:", Retention: 7 * 24 * time.Hour},
+		{Prefix: "world", Retention: 24 * time.Hour}}, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := a5gblock.NewLists(a5gblock.NewMemoryStore(), l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Blocks = blocks
+	c.MaxLength = 10
+	c.BatchSize = 2
+	c.Members = func(ctx context.Context, channel string) ([]uint64, error) {
+		if !strings.HasPrefix(channel, "clan:") {
+			return nil, nil
+		}
+		return []uint64{1, 2, 3}, nil
+	}
+	pushed := map[uint64]int{}
+	c.Push = func(accountID uint64, event string, payload interface{}) error {
+		pushed[accountID]++
+		return nil
+	}
+	now := time.Unix(1600000000, 0)
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if _, err = blocks.Put(3, 1, a5gblock.KindMute); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = blocks.Put(4, 1, a5gblock.KindBlock); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		senderID uint64
+		channel  string
+		text     string
+		err      error
+	}{
+		{"unknown channel", 1, "trade", "hi", ErrChannelUnknown},
+		{"malformed private", 1, "private:2:1", "hi", ErrChannelUnknown},
+		{"empty", 1, "clan:7", "  ", ErrMessageInvalid},
+		{"too long", 1, "clan:7", "hello there!", ErrMessageInvalid},
+		{"not member", 4, "clan:7", "hi", ErrNotMember},
+		{"blocked", 1, PrivateChannel(4, 1), "hi", ErrBlocked},
+		{"not in private", 3, PrivateChannel(1, 2), "hi", ErrNotMember},
+		{"clan", 1, "clan:7", "hi clan", nil},
+		{"private", 2, PrivateChannel(1, 2), "hi", nil},
+		{"world", 4, "world", "100%_off", nil},
+	}
+	for _, test := range tests {
+		_, err := c.Send(ctx, test.senderID, test.channel, test.text)
+		if errors.Cause(err) != test.err {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+	}
+	if pushed[2] != 1 || pushed[3] != 0 || pushed[1] != 1 {
+		t.Errorf("unexpected pushes %v", pushed)
+	}
+
+	a, next, err := c.History(ctx, 3, "clan:7", 0, 10)
+	if err != nil || len(a) != 0 || next != 0 {
+		t.Errorf("muted sender in history %v %d %v", a, next, err)
+	}
+	a, _, err = c.History(ctx, 2, "clan:7", 0, 10)
+	if err != nil || len(a) != 1 || a[0].Text != "hi clan" {
+		t.Errorf("unexpected history %v %v", a, err)
+	}
+
+	now = now.Add(time.Minute)
+	for i := 0; i < 3; i++ {
+		if _, err = c.Send(ctx, 1, "world", "gg"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, next, err = c.History(ctx, 1, "world", 0, 2)
+	if err != nil || len(a) != 2 || next != a[1].ID {
+		t.Fatalf("unexpected page %v %d %v", a, next, err)
+	}
+	a, next, err = c.History(ctx, 1, "world", next, 2)
+	if err != nil || len(a) != 2 || a[1].Text != "100%_off" {
+		t.Errorf("unexpected next page %v %d %v", a, next, err)
+	}
+
+	a, err = c.Search(&Query{Keyword: "GG", SenderID: 1}, 0, 10)
+	if err != nil || len(a) != 3 {
+		t.Errorf("unexpected search %v %v", a, err)
+	}
+	a, err = c.Search(&Query{Channel: "world", To: now.Unix() * 1000}, 0, 10)
+	if err != nil || len(a) != 1 || a[0].SenderID != 4 {
+		t.Errorf("unexpected search %v %v", a, err)
+	}
+
+	var buf bytes.Buffer
+	n, err := c.Export(ctx, 1, &buf)
+	if err != nil || n != 4 || strings.Count(buf.String(), "\n") != 4 {
+		t.Errorf("unexpected export %d %q %v", n, buf.String(), err)
+	}
+
+	// A day and a half later world messages are gone, clan ones stay.
+	now = now.Add(36 * time.Hour)
+	purged, err := c.Purge(ctx)
+	if err != nil || purged["world"] != 4 || purged["clan:"] != 0 {
+		t.Errorf("unexpected purge %v %v", purged, err)
+	}
+	if n, err = c.Erase(ctx, 1); err != nil || n != 1 {
+		t.Errorf("unexpected erase %d %v", n, err)
+	}
+	a, err = c.Search(&Query{}, 0, 10)
+	if err != nil || len(a) != 1 || a[0].SenderID != 2 {
+		t.Errorf("unexpected messages left %v %v", a, err)
+	}
+}
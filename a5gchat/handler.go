@@ -0,0 +1,309 @@
+package a5gchat
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5gcursor"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCodeChannelUnknown = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4065,
+		Name:     "chat_channel_unknown",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "chat channel not found"})
+
+	ErrCodeMessageInvalid = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4263,
+		Name:     "chat_message_invalid",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "chat message empty or too long"})
+
+	ErrCodeNotMember = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4264,
+		Name:     "chat_not_member",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "not a member of the chat channel"})
+
+	ErrCodeBlocked = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4265,
+		Name:     "chat_blocked",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "chat receiver unreachable"})
+
+	ErrCodePrivateOnly = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4266,
+		Name:     "chat_private_only",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "private chat channels only"})
+)
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeChannelUnknown, http.StatusNotFound)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeMessageInvalid, http.StatusUnprocessableEntity)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeNotMember, http.StatusForbidden)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeBlocked, http.StatusForbidden)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodePrivateOnly, http.StatusUnprocessableEntity)
+}
+
+const (
+	historyCursorKind = "chat_history"
+	searchCursorKind  = "chat_search"
+)
+
+// Cursor is the state of a message page.
+type Cursor struct {
+	BeforeID int64 `json:"beforeId"`
+}
+
+type SendRequest struct {
+	Channel string `json:"channel" validate:"required,max=128"`
+	Text    string `json:"text" validate:"required"`
+}
+
+// PrivateRequest names the other player of a private channel.
+type PrivateRequest struct {
+	AccountID uint64 `json:"accountId" validate:"required"`
+	Text      string `json:"text" validate:"required"`
+}
+
+type TranslationOptOutRequest struct {
+	OptOut bool `json:"optOut"`
+}
+
+type ChannelRequest struct {
+	Channel string `json:"channel" validate:"required,max=128"`
+}
+
+type ReadRequest struct {
+	Channel   string `json:"channel" validate:"required,max=128"`
+	MessageID int64  `json:"messageId" validate:"min=1"`
+}
+
+type ReadResponse struct {
+	// PeerRead is the last message the other player read.
+	PeerRead int64 `json:"peerRead"`
+}
+
+type HistoryRequest struct {
+	Channel string `json:"channel" validate:"required,max=128"`
+}
+
+// SendHandler posts a message of the session player to a channel.
+func (c *Chat) SendHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(SendRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			r := req.Payload.(*SendRequest)
+			m, err := c.Send(ctx, s.AccountID, r.Channel, r.Text)
+			if err != nil {
+				return nil, c.apiErrs(err)
+			}
+			return m, nil
+		})
+}
+
+// PrivateHandler posts a message of the session player to another one.
+func (c *Chat) PrivateHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(PrivateRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			r := req.Payload.(*PrivateRequest)
+			if r.AccountID == s.AccountID {
+				return nil, c.apiErrs(ErrChannelUnknown)
+			}
+			m, err := c.Send(ctx, s.AccountID,
+				PrivateChannel(s.AccountID, r.AccountID), r.Text)
+			if err != nil {
+				return nil, c.apiErrs(err)
+			}
+			return m, nil
+		})
+}
+
+// HistoryHandler answers with a page of a channel, newest first.
+func (c *Chat) HistoryHandler(
+	cs *a5gcursor.Cursors, l a5gcursor.PageLimits) a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(HistoryRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			cursor := new(Cursor)
+			limit, _, e := cs.ParsePage(req, historyCursorKind, s.AccountID, l, cursor)
+			if e != nil {
+				return nil, []*a5gapi.APIErr{e}
+			}
+			a, next, err := c.History(ctx, s.AccountID,
+				req.Payload.(*HistoryRequest).Channel, cursor.BeforeID, limit)
+			if err != nil {
+				return nil, c.apiErrs(err)
+			}
+			page, err := cs.NextPage(historyCursorKind, s.AccountID, limit,
+				next != 0, nil, &Cursor{BeforeID: next})
+			if err != nil {
+				return nil, c.apiErrs(err)
+			}
+			return &a5gapi.Paged{Items: a, Page: page}, nil
+		})
+}
+
+// SearchHandler answers with a page of messages of a Query for
+// moderation cases, mount it on an admin route class.
+func (c *Chat) SearchHandler(
+	cs *a5gcursor.Cursors, l a5gcursor.PageLimits) a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(Query) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			q := req.Payload.(*Query)
+			cursor := new(Cursor)
+			limit, _, e := cs.ParsePage(req, searchCursorKind, q.SenderID, l, cursor)
+			if e != nil {
+				return nil, []*a5gapi.APIErr{e}
+			}
+			a, err := c.Search(q, cursor.BeforeID, limit)
+			if err != nil {
+				return nil, c.apiErrs(err)
+			}
+			next := &Cursor{}
+			if len(a) == limit && limit > 0 {
+				next.BeforeID = a[len(a)-1].ID
+			}
+			page, err := cs.NextPage(searchCursorKind, q.SenderID, limit,
+				next.BeforeID != 0, nil, next)
+			if err != nil {
+				return nil, c.apiErrs(err)
+			}
+			return &a5gapi.Paged{Items: a, Page: page}, nil
+		})
+}
+
+// TranslationOptOutHandler turns translations off or back on for the
+// session player.
+func (c *Chat) TranslationOptOutHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(TranslationOptOutRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			r := req.Payload.(*TranslationOptOutRequest)
+			if c.Translations == nil {
+				return nil, c.apiErrs(errors.New("chat translations disabled"))
+			}
+			if err := c.Translations.OptOuts.SetOptOut(s.AccountID, r.OptOut); err != nil {
+				return nil, c.apiErrs(err)
+			}
+			return r, nil
+		})
+}
+
+// TypingHandler sends a typing event of the session player, mount it on
+// the a5gws.Server as clients send it every few seconds while typing.
+func (c *Chat) TypingHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(ChannelRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			err := c.Typing(ctx, s.AccountID, req.Payload.(*ChannelRequest).Channel)
+			if err != nil {
+				return nil, c.apiErrs(err)
+			}
+			return struct{}{}, nil
+		})
+}
+
+// ReadHandler marks a private channel read by the session player and
+// answers with how far the other player read.
+func (c *Chat) ReadHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(ReadRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			r := req.Payload.(*ReadRequest)
+			if err := c.MarkRead(ctx, s.AccountID, r.Channel, r.MessageID); err != nil {
+				return nil, c.apiErrs(err)
+			}
+			id, err := c.PeerRead(ctx, s.AccountID, r.Channel)
+			if err != nil {
+				return nil, c.apiErrs(err)
+			}
+			return &ReadResponse{PeerRead: id}, nil
+		})
+}
+
+// PrefsHandler replaces the typing and read receipt preferences of the
+// session player.
+func (c *Chat) PrefsHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(Prefs) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			if c.Prefs == nil {
+				return nil, c.apiErrs(errors.New("chat prefs store missing"))
+			}
+			p := req.Payload.(*Prefs)
+			if err := c.Prefs.Set(s.AccountID, p); err != nil {
+				return nil, c.apiErrs(err)
+			}
+			return p, nil
+		})
+}
+
+func (c *Chat) apiErrs(err error) []*a5gapi.APIErr {
+	switch errors.Cause(err) {
+	case ErrChannelUnknown:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeChannelUnknown, "")}
+	case ErrMessageInvalid:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeMessageInvalid, "")}
+	case ErrNotMember:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeNotMember, "")}
+	case ErrBlocked:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeBlocked, "")}
+	case ErrPrivateOnly:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodePrivateOnly, "")}
+	}
+	c.Logger.Error(err.Error())
+	return a5gapi.NewJSONMsgDefautlErrors(err)
+}
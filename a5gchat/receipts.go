@@ -0,0 +1,299 @@
+package a5gchat
+
+import (
+	"context"
+	"sync"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+// ErrPrivateOnly is returned for typing and read events of group channels.
+var ErrPrivateOnly = errors.New("private chat channels only")
+
+// Prefs are the notification preferences of a player for private chats.
+// Typing events and read receipts go both ways: a player who turns them
+// off neither sends nor receives them.
+type Prefs struct {
+	NoTyping       bool `json:"noTyping"`
+	NoReadReceipts bool `json:"noReadReceipts"`
+}
+
+// PrefsStore keeps preferences, Get returns the zero Prefs for players
+// who never changed them.
+type PrefsStore interface {
+	Get(accountID uint64) (*Prefs, error)
+	Set(accountID uint64, p *Prefs) error
+}
+
+// ReadStore keeps the last message a player read per channel. MarkRead
+// only moves forward and reports whether it did.
+type ReadStore interface {
+	MarkRead(channel string, accountID uint64, messageID int64) (bool, error)
+	LastRead(channel string, accountID uint64) (int64, error)
+}
+
+// TypingEvent is pushed as "chat_typing", ReadEvent as "chat_read".
+type TypingEvent struct {
+	Channel   string `json:"channel"`
+	AccountID uint64 `json:"accountId"`
+}
+
+type ReadEvent struct {
+	Channel   string `json:"channel"`
+	AccountID uint64 `json:"accountId"`
+	MessageID int64  `json:"messageId"`
+}
+
+// peer returns the other player of a private channel of accountID.
+func (c *Chat) peer(
+	ctx context.Context, accountID uint64, channel string) (uint64, error) {
+	if _, ok := privateMembers(channel); !ok {
+		return 0, errors.Wrap(ErrPrivateOnly, channel)
+	}
+	members, err := c.members(ctx, accountID, channel)
+	if err != nil {
+		return 0, err
+	}
+	if members[0] == accountID {
+		return members[1], nil
+	}
+	return members[0], nil
+}
+
+// allowed reports whether both players enabled an event kind.
+func (c *Chat) allowed(a, b uint64, off func(*Prefs) bool) (bool, error) {
+	if c.Prefs == nil {
+		return true, nil
+	}
+	for _, id := range []uint64{a, b} {
+		p, err := c.Prefs.Get(id)
+		if err != nil {
+			return false, err
+		}
+		if off(p) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Typing tells the other player of a private channel that accountID is
+// typing. The event is ephemeral, it is dropped for offline players.
+func (c *Chat) Typing(ctx context.Context, accountID uint64, channel string) error {
+	peerID, err := c.peer(ctx, accountID, channel)
+	if err != nil || c.Push == nil {
+		return err
+	}
+	ok, err := c.allowed(accountID, peerID, func(p *Prefs) bool { return p.NoTyping })
+	if err != nil || !ok {
+		return err
+	}
+	if c.Blocks != nil {
+		muted, err := c.Blocks.Muted(ctx, peerID, accountID)
+		if err != nil || muted {
+			return err
+		}
+	}
+	return c.Push(peerID, "chat_typing",
+		&TypingEvent{Channel: channel, AccountID: accountID})
+}
+
+// MarkRead records that accountID read a private channel up to
+// messageID and sends a receipt to the other player.
+func (c *Chat) MarkRead(ctx context.Context, accountID uint64, channel string,
+	messageID int64) error {
+	if c.Reads == nil {
+		return errors.New("chat read store missing")
+	}
+	peerID, err := c.peer(ctx, accountID, channel)
+	if err != nil {
+		return err
+	}
+	moved, err := c.Reads.MarkRead(channel, accountID, messageID)
+	if err != nil || !moved || c.Push == nil {
+		return err
+	}
+	ok, err := c.allowed(accountID, peerID,
+		func(p *Prefs) bool { return p.NoReadReceipts })
+	if err != nil || !ok {
+		return err
+	}
+	return c.Push(peerID, "chat_read", &ReadEvent{
+		Channel: channel, AccountID: accountID, MessageID: messageID})
+}
+
+// PeerRead returns the last message of a private channel the other
+// player read, 0 when either player turned read receipts off.
+func (c *Chat) PeerRead(
+	ctx context.Context, accountID uint64, channel string) (int64, error) {
+	if c.Reads == nil {
+		return 0, errors.New("chat read store missing")
+	}
+	peerID, err := c.peer(ctx, accountID, channel)
+	if err != nil {
+		return 0, err
+	}
+	ok, err := c.allowed(accountID, peerID,
+		func(p *Prefs) bool { return p.NoReadReceipts })
+	if err != nil || !ok {
+		return 0, err
+	}
+	return c.Reads.LastRead(channel, peerID)
+}
+
+type memoryPrefsStore struct {
+	mu sync.RWMutex
+	m  map[uint64]Prefs
+}
+
+func NewMemoryPrefsStore() PrefsStore {
+	return &memoryPrefsStore{m: make(map[uint64]Prefs)}
+}
+
+func (s *memoryPrefsStore) Get(accountID uint64) (*Prefs, error) {
+	s.mu.RLock()
+	p := s.m[accountID]
+	s.mu.RUnlock()
+	return &p, nil
+}
+
+func (s *memoryPrefsStore) Set(accountID uint64, p *Prefs) error {
+	s.mu.Lock()
+	s.m[accountID] = *p
+	s.mu.Unlock()
+	return nil
+}
+
+type memoryReadStore struct {
+	mu sync.Mutex
+	m  map[string]map[uint64]int64
+}
+
+func NewMemoryReadStore() ReadStore {
+	return &memoryReadStore{m: make(map[string]map[uint64]int64)}
+}
+
+func (s *memoryReadStore) MarkRead(
+	channel string, accountID uint64, messageID int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reads, ok := s.m[channel]
+	if !ok {
+		reads = make(map[uint64]int64)
+		s.m[channel] = reads
+	}
+	if reads[accountID] >= messageID {
+		return false, nil
+	}
+	reads[accountID] = messageID
+	return true, nil
+}
+
+func (s *memoryReadStore) LastRead(channel string, accountID uint64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.m[channel][accountID], nil
+}
+
+// dbPrefsStore keeps preferences in a MySQL table:
+//
+//	CREATE TABLE chat_prefs (
+//	  account_id BIGINT UNSIGNED NOT NULL PRIMARY KEY,
+//	  no_typing TINYINT NOT NULL,
+//	  no_read_receipts TINYINT NOT NULL);
+type dbPrefsStore struct {
+	pooler    a5gdb.Pooler
+	tableName string
+}
+
+func NewDBPrefsStore(p a5gdb.Pooler, tableName string) (PrefsStore, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if tableName == "" {
+		return nil, errors.New("empty chat prefs table name")
+	}
+	return &dbPrefsStore{pooler: p, tableName: tableName}, nil
+}
+
+func (s *dbPrefsStore) Get(accountID uint64) (*Prefs, error) {
+	var row struct {
+		NoTyping       bool `db:"no_typing"`
+		NoReadReceipts bool `db:"no_read_receipts"`
+	}
+	err := s.pooler.ReadPool().NewSession().
+		Select("no_typing", "no_read_receipts").From(s.tableName).
+		Where(dbr.Eq("account_id", accountID)).LoadOne(&row)
+	if err != nil && err != dbr.ErrNotFound {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	return &Prefs{NoTyping: row.NoTyping, NoReadReceipts: row.NoReadReceipts}, nil
+}
+
+func (s *dbPrefsStore) Set(accountID uint64, p *Prefs) error {
+	_, err := s.pooler.WritePool().NewSession().InsertBySql("INSERT INTO "+
+		s.tableName+" (account_id, no_typing, no_read_receipts) VALUES (?, ?, ?)"+
+		" ON DUPLICATE KEY UPDATE no_typing = VALUES(no_typing),"+
+		" no_read_receipts = VALUES(no_read_receipts)",
+		accountID, p.NoTyping, p.NoReadReceipts).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	return nil
+}
+
+// dbReadStore keeps read positions in a MySQL table:
+//
+//	CREATE TABLE chat_reads (
+//	  channel VARCHAR(128) NOT NULL,
+//	  account_id BIGINT UNSIGNED NOT NULL,
+//	  message_id BIGINT NOT NULL,
+//	  PRIMARY KEY (channel, account_id));
+type dbReadStore struct {
+	pooler    a5gdb.Pooler
+	tableName string
+}
+
+func NewDBReadStore(p a5gdb.Pooler, tableName string) (ReadStore, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if tableName == "" {
+		return nil, errors.New("empty chat reads table name")
+	}
+	return &dbReadStore{pooler: p, tableName: tableName}, nil
+}
+
+func (s *dbReadStore) MarkRead(
+	channel string, accountID uint64, messageID int64) (bool, error) {
+	res, err := s.pooler.WritePool().NewSession().InsertBySql("INSERT INTO "+
+		s.tableName+" (channel, account_id, message_id) VALUES (?, ?, ?)"+
+		" ON DUPLICATE KEY UPDATE message_id = GREATEST(message_id, VALUES(message_id))",
+		channel, accountID, messageID).Exec()
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	// 1 for an insert, 2 for an update and 0 when nothing changed.
+	return n > 0, nil
+}
+
+func (s *dbReadStore) LastRead(channel string, accountID uint64) (int64, error) {
+	var id int64
+	err := s.pooler.ReadPool().NewSession().
+		Select("message_id").From(s.tableName).
+		Where(dbr.Eq("channel", channel)).
+		Where(dbr.Eq("account_id", accountID)).LoadOne(&id)
+	if err == dbr.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	return id, nil
+}
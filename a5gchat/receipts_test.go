@@ -0,0 +1,83 @@
+package a5gchat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestReceipts(t *testing.T) {
+	c, err := NewChat(NewMemoryStore(), []*Policy{
+		{Prefix: privatePrefix, Retention: time.Hour},
+		{Prefix: "world", Retention: time.Hour}},
+		a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Prefs = NewMemoryPrefsStore()
+	c.Reads = NewMemoryReadStore()
+	var events []interface{}
+	c.Push = func(accountID uint64, event string, payload interface{}) error {
+		if event != "chat" {
+			events = append(events, payload)
+		}
+		return nil
+	}
+	ctx := context.Background()
+	ch := PrivateChannel(1, 2)
+
+	if err = c.Typing(ctx, 1, "world"); errors.Cause(err) != ErrPrivateOnly {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err = c.Typing(ctx, 3, ch); errors.Cause(err) != ErrNotMember {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err = c.Typing(ctx, 1, ch); err != nil {
+		t.Fatal(err)
+	}
+	if e, ok := events[0].(*TypingEvent); len(events) != 1 || !ok || e.AccountID != 1 {
+		t.Errorf("unexpected events %v", events)
+	}
+
+	m, err := c.Send(ctx, 1, ch, "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.MarkRead(ctx, 2, ch, m.ID); err != nil {
+		t.Fatal(err)
+	}
+	if e, ok := events[1].(*ReadEvent); len(events) != 2 || !ok || e.MessageID != m.ID {
+		t.Errorf("unexpected events %v", events)
+	}
+	// Reading an older message again sends nothing.
+	if err = c.MarkRead(ctx, 2, ch, m.ID); err != nil || len(events) != 2 {
+		t.Errorf("unexpected events %v %v", events, err)
+	}
+	if id, err := c.PeerRead(ctx, 1, ch); err != nil || id != m.ID {
+		t.Errorf("unexpected peer read %d %v", id, err)
+	}
+
+	// Turning receipts off hides them both ways, typing still works.
+	if err = c.Prefs.Set(2, &Prefs{NoReadReceipts: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.MarkRead(ctx, 1, ch, m.ID); err != nil || len(events) != 2 {
+		t.Errorf("unexpected events %v %v", events, err)
+	}
+	if id, err := c.PeerRead(ctx, 1, ch); err != nil || id != 0 {
+		t.Errorf("unexpected peer read %d %v", id, err)
+	}
+	if err = c.Typing(ctx, 2, ch); err != nil || len(events) != 3 {
+		t.Errorf("unexpected events %v %v", events, err)
+	}
+	if err = c.Prefs.Set(1, &Prefs{NoTyping: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Typing(ctx, 2, ch); err != nil || len(events) != 3 {
+		t.Errorf("unexpected events %v %v", events, err)
+	}
+}
@@ -0,0 +1,210 @@
+package a5gchat
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryStore struct {
+	mu       sync.Mutex
+	lastID   int64
+	messages []*Message
+}
+
+func NewMemoryStore() Store {
+	return new(memoryStore)
+}
+
+func (s *memoryStore) Append(m *Message) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	x := *m
+	x.ID = s.lastID
+	s.messages = append(s.messages, &x)
+	return x.ID, nil
+}
+
+func (s *memoryStore) list(
+	match func(*Message) bool, beforeID int64, limit int) []*Message {
+	a := []*Message{}
+	for i := len(s.messages) - 1; i >= 0 && len(a) < limit; i-- {
+		m := s.messages[i]
+		if (beforeID == 0 || m.ID < beforeID) && match(m) {
+			x := *m
+			a = append(a, &x)
+		}
+	}
+	return a
+}
+
+func (s *memoryStore) History(
+	channel string, beforeID int64, limit int) ([]*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list(func(m *Message) bool { return m.Channel == channel },
+		beforeID, limit), nil
+}
+
+func (s *memoryStore) Search(q *Query, beforeID int64, limit int) ([]*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list(q.Match, beforeID, limit), nil
+}
+
+func (s *memoryStore) remove(match func(*Message) bool, limit int) int64 {
+	var n int64
+	kept := s.messages[:0]
+	for _, m := range s.messages {
+		if (limit < 0 || n < int64(limit)) && match(m) {
+			n++
+			continue
+		}
+		kept = append(kept, m)
+	}
+	for i := len(kept); i < len(s.messages); i++ {
+		s.messages[i] = nil
+	}
+	s.messages = kept
+	return n
+}
+
+func (s *memoryStore) Purge(prefix string, before int64, limit int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.remove(func(m *Message) bool {
+		return strings.HasPrefix(m.Channel, prefix) && m.CreatedAt < before
+	}, limit), nil
+}
+
+func (s *memoryStore) Erase(senderID uint64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.remove(func(m *Message) bool { return m.SenderID == senderID }, -1), nil
+}
+
+// dbStore keeps messages in a MySQL table:
+//
+//	CREATE TABLE chat_messages (
+//	  id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+//	  channel VARCHAR(128) NOT NULL,
+//	  sender_id BIGINT UNSIGNED NOT NULL,
+//	  text TEXT NOT NULL,
+//	  created_at BIGINT NOT NULL,
+//	  KEY history (channel, id),
+//	  KEY sender (sender_id, id),
+//	  KEY created (created_at));
+type dbStore struct {
+	pooler    a5gdb.Pooler
+	tableName string
+}
+
+func NewDBStore(p a5gdb.Pooler, tableName string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if tableName == "" {
+		return nil, errors.New("empty chat messages table name")
+	}
+	return &dbStore{pooler: p, tableName: tableName}, nil
+}
+
+func (s *dbStore) Append(m *Message) (int64, error) {
+	res, err := s.pooler.WritePool().NewSession().
+		InsertInto(s.tableName).
+		Pair("channel", m.Channel).
+		Pair("sender_id", m.SenderID).
+		Pair("text", m.Text).
+		Pair("created_at", m.CreatedAt).Exec()
+	if err != nil {
+		return 0, errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, errors.Wrap(err, "sql.Result.LastInsertId fn")
+	}
+	return id, nil
+}
+
+func (s *dbStore) load(
+	conds []dbr.Builder, beforeID int64, limit int) ([]*Message, error) {
+	if beforeID > 0 {
+		conds = append(conds, dbr.Lt("id", beforeID))
+	}
+	stmt := s.pooler.ReadPool().NewSession().
+		Select("id", "channel", "sender_id", "text", "created_at").
+		From(s.tableName)
+	for _, c := range conds {
+		stmt = stmt.Where(c)
+	}
+	a := []*Message{}
+	_, err := stmt.OrderDesc("id").Limit(uint64(limit)).Load(&a)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	return a, nil
+}
+
+func (s *dbStore) History(
+	channel string, beforeID int64, limit int) ([]*Message, error) {
+	return s.load([]dbr.Builder{dbr.Eq("channel", channel)}, beforeID, limit)
+}
+
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// Search matches keywords with LIKE, case-insensitive under the usual
+// _ci collations.
+func (s *dbStore) Search(q *Query, beforeID int64, limit int) ([]*Message, error) {
+	conds := []dbr.Builder{}
+	if q.SenderID != 0 {
+		conds = append(conds, dbr.Eq("sender_id", q.SenderID))
+	}
+	if q.Channel != "" {
+		conds = append(conds, dbr.Eq("channel", q.Channel))
+	}
+	if q.Keyword != "" {
+		conds = append(conds, dbr.Like("text",
+			"%"+likeEscaper.Replace(q.Keyword)+"%", "!"))
+	}
+	if q.From != 0 {
+		conds = append(conds, dbr.Gte("created_at", q.From))
+	}
+	if q.To != 0 {
+		conds = append(conds, dbr.Lt("created_at", q.To))
+	}
+	return s.load(conds, beforeID, limit)
+}
+
+func (s *dbStore) Purge(prefix string, before int64, limit int) (int64, error) {
+	res, err := s.pooler.WritePool().NewSession().
+		DeleteFrom(s.tableName).
+		Where(dbr.Like("channel", likeEscaper.Replace(prefix)+"%", "!")).
+		Where(dbr.Lt("created_at", before)).
+		Limit(uint64(limit)).Exec()
+	if err != nil {
+		return 0, errors.Wrap(err, "dbr.(*DeleteStmt).Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	return n, nil
+}
+
+func (s *dbStore) Erase(senderID uint64) (int64, error) {
+	res, err := s.pooler.WritePool().NewSession().
+		DeleteFrom(s.tableName).
+		Where(dbr.Eq("sender_id", senderID)).Exec()
+	if err != nil {
+		return 0, errors.Wrap(err, "dbr.(*DeleteStmt).Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	return n, nil
+}
@@ -0,0 +1,304 @@
+package a5gchat
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/go-redis/redis"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+// Translator is a machine translation provider, from and to are locale
+// tags such as "en-US".
+type Translator interface {
+	Translate(ctx context.Context, text, from, to string) (string, error)
+}
+
+// Translation is the text of a message in the locale of its receiver.
+type Translation struct {
+	Locale string `json:"locale"`
+	Text   string `json:"text"`
+}
+
+// TranslationCache keeps translations so a message to a channel is
+// translated once per locale. Get reports misses with false.
+type TranslationCache interface {
+	Get(key string) (string, bool, error)
+	Set(key, text string, ttl time.Duration) error
+}
+
+// OptOutStore keeps players who want messages untranslated.
+type OptOutStore interface {
+	OptedOut(accountID uint64) (bool, error)
+	SetOptOut(accountID uint64, optOut bool) error
+}
+
+// LocaleFunc returns the locale of a player, e.g.
+// (*a5glocale.Detector).PlayerLocale.
+type LocaleFunc func(accountID uint64) (string, error)
+
+// Translations adds translations to messages between players of
+// different languages unless the receiver opted out. Failures never hold
+// a message back, it is delivered untranslated.
+type Translations struct {
+	Translator Translator
+	Cache      TranslationCache
+	Locale     LocaleFunc
+	OptOuts    OptOutStore
+	Logger     a5glogs.Logger
+	TTL        time.Duration
+}
+
+func NewTranslations(t Translator, c TranslationCache, fn LocaleFunc,
+	s OptOutStore, l a5glogs.Logger) (*Translations, error) {
+	if t == nil {
+		return nil, errors.New("translator missing")
+	}
+	if c == nil {
+		return nil, errors.New("translation cache missing")
+	}
+	if fn == nil {
+		return nil, errors.New("locale func missing")
+	}
+	if s == nil {
+		return nil, errors.New("opt-out store missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Translations{
+		Translator: t,
+		Cache:      c,
+		Locale:     fn,
+		OptOuts:    s,
+		Logger:     l,
+		TTL:        24 * time.Hour}, nil
+}
+
+func language(locale string) string {
+	return strings.ToLower(strings.SplitN(locale, "-", 2)[0])
+}
+
+// Translate returns the text of a message from a player of fromLocale
+// for receiverID, nil when it needs no translation.
+func (ts *Translations) Translate(ctx context.Context, text, fromLocale string,
+	receiverID uint64) (*Translation, error) {
+	to, err := ts.Locale(receiverID)
+	if err != nil {
+		return nil, err
+	}
+	if to == "" || fromLocale == "" || language(to) == language(fromLocale) {
+		return nil, nil
+	}
+	optedOut, err := ts.OptOuts.OptedOut(receiverID)
+	if err != nil || optedOut {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(text))
+	key := language(fromLocale) + ":" + language(to) + ":" + hex.EncodeToString(sum[:])
+	s, ok, err := ts.Cache.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if s, err = ts.Translator.Translate(ctx, text, fromLocale, to); err != nil {
+			return nil, err
+		}
+		if err = ts.Cache.Set(key, s, ts.TTL); err != nil {
+			ts.Logger.Warn(err.Error())
+		}
+	}
+	return &Translation{Locale: to, Text: s}, nil
+}
+
+// translated returns m with a translation for receiverID or m itself.
+func (ts *Translations) translated(ctx context.Context, m *Message,
+	fromLocale string, receiverID uint64) *Message {
+	if ts == nil {
+		return m
+	}
+	t, err := ts.Translate(ctx, m.Text, fromLocale, receiverID)
+	if err != nil {
+		ts.Logger.With(a5gfields.Int64("messageID", m.ID)).Warn(err.Error())
+	}
+	if t == nil {
+		return m
+	}
+	x := *m
+	x.Translation = t
+	return &x
+}
+
+// senderLocale returns the locale of a sender, "" when it is unknown and
+// messages are left untranslated.
+func (ts *Translations) senderLocale(senderID uint64) string {
+	if ts == nil {
+		return ""
+	}
+	s, err := ts.Locale(senderID)
+	if err != nil {
+		ts.Logger.Warn(err.Error())
+	}
+	return s
+}
+
+type memoryTranslationCache struct {
+	mu      sync.Mutex
+	max     int
+	entries map[string]memoryTranslation
+	now     func() time.Time
+}
+
+type memoryTranslation struct {
+	text      string
+	expiresAt time.Time
+}
+
+// NewMemoryTranslationCache keeps up to max translations, dropping
+// expired ones and then arbitrary ones when full.
+func NewMemoryTranslationCache(max int) TranslationCache {
+	return &memoryTranslationCache{
+		max:     max,
+		entries: make(map[string]memoryTranslation),
+		now:     time.Now}
+}
+
+func (c *memoryTranslationCache) Get(key string) (string, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || !c.now().Before(e.expiresAt) {
+		return "", false, nil
+	}
+	return e.text, true, nil
+}
+
+func (c *memoryTranslationCache) Set(key, text string, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if len(c.entries) >= c.max {
+		for k, e := range c.entries {
+			if !now.Before(e.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	for k := range c.entries {
+		if len(c.entries) < c.max {
+			break
+		}
+		delete(c.entries, k)
+	}
+	c.entries[key] = memoryTranslation{text: text, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+type redisTranslationCache struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisTranslationCache keeps translations as strings under
+// prefix+key.
+func NewRedisTranslationCache(
+	c redis.UniversalClient, prefix string) (TranslationCache, error) {
+	if c == nil {
+		return nil, errors.New("redis client missing")
+	}
+	return &redisTranslationCache{client: c, prefix: prefix}, nil
+}
+
+func (c *redisTranslationCache) Get(key string) (string, bool, error) {
+	s, err := c.client.Get(c.prefix + key).Result()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, errors.WithStack(err)
+	}
+	return s, true, nil
+}
+
+func (c *redisTranslationCache) Set(key, text string, ttl time.Duration) error {
+	if err := c.client.Set(c.prefix+key, text, ttl).Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+type memoryOptOutStore struct {
+	mu sync.RWMutex
+	m  map[uint64]bool
+}
+
+func NewMemoryOptOutStore() OptOutStore {
+	return &memoryOptOutStore{m: make(map[uint64]bool)}
+}
+
+func (s *memoryOptOutStore) OptedOut(accountID uint64) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.m[accountID], nil
+}
+
+func (s *memoryOptOutStore) SetOptOut(accountID uint64, optOut bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if optOut {
+		s.m[accountID] = true
+	} else {
+		delete(s.m, accountID)
+	}
+	return nil
+}
+
+// dbOptOutStore keeps players who opted out in a MySQL table:
+//
+//	CREATE TABLE chat_translation_opt_outs (
+//	  account_id BIGINT UNSIGNED NOT NULL PRIMARY KEY);
+type dbOptOutStore struct {
+	pooler    a5gdb.Pooler
+	tableName string
+}
+
+func NewDBOptOutStore(p a5gdb.Pooler, tableName string) (OptOutStore, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if tableName == "" {
+		return nil, errors.New("empty opt-outs table name")
+	}
+	return &dbOptOutStore{pooler: p, tableName: tableName}, nil
+}
+
+func (s *dbOptOutStore) OptedOut(accountID uint64) (bool, error) {
+	var n int
+	_, err := s.pooler.ReadPool().NewSession().
+		Select("COUNT(*)").From(s.tableName).
+		Where(dbr.Eq("account_id", accountID)).Load(&n)
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	return n > 0, nil
+}
+
+func (s *dbOptOutStore) SetOptOut(accountID uint64, optOut bool) error {
+	sess := s.pooler.WritePool().NewSession()
+	if !optOut {
+		_, err := sess.DeleteFrom(s.tableName).
+			Where(dbr.Eq("account_id", accountID)).Exec()
+		return errors.Wrap(err, "dbr.(*DeleteStmt).Exec fn")
+	}
+	_, err := sess.InsertBySql("INSERT IGNORE INTO "+s.tableName+
+		" (account_id) VALUES (?)", accountID).Exec()
+	return errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+}
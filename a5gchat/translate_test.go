@@ -0,0 +1,90 @@
+package a5gchat
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+type upperTranslator struct{ calls int }
+
+func (t *upperTranslator) Translate(
+	ctx context.Context, text, from, to string) (string, error) {
+	t.calls++
+	if text == "fail" {
+		return "", errors.New("translator down")
+	}
+	return to + ":" + strings.ToUpper(text), nil
+}
+
+func TestTranslations(t *testing.T) {
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	c, err := NewChat(NewMemoryStore(),
+		[]*Policy{{Prefix: "world", Retention: time.Hour}}, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locales := map[uint64]string{1: "en-US", 2: "de-DE", 3: "en-GB", 4: "fr"}
+	tr := new(upperTranslator)
+	optOuts := NewMemoryOptOutStore()
+	c.Translations, err = NewTranslations(tr, NewMemoryTranslationCache(10),
+		func(accountID uint64) (string, error) { return locales[accountID], nil },
+		optOuts, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Members = func(ctx context.Context, channel string) ([]uint64, error) {
+		return []uint64{1, 2, 3, 4, 5}, nil
+	}
+	pushed := map[uint64]*Message{}
+	c.Push = func(accountID uint64, event string, payload interface{}) error {
+		pushed[accountID] = payload.(*Message)
+		return nil
+	}
+	if err = optOuts.SetOptOut(4, true); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if _, err = c.Send(ctx, 1, "world", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range map[uint64]string{2: "de-DE:HELLO", 3: "", 4: "", 5: ""} {
+		m := pushed[id]
+		if m == nil || m.Text != "hello" {
+			t.Fatalf("%d: unexpected push %+v", id, m)
+		}
+		if got := ""; m.Translation != nil {
+			got = m.Translation.Text
+			if got != want {
+				t.Errorf("%d: unexpected translation %q", id, got)
+			}
+		} else if want != "" {
+			t.Errorf("%d: translation missing", id)
+		}
+	}
+
+	// History of the same message is served from the cache.
+	a, _, err := c.History(ctx, 2, "world", 0, 10)
+	if err != nil || len(a) != 1 || a[0].Translation == nil ||
+		a[0].Translation.Text != "de-DE:HELLO" || tr.calls != 1 {
+		t.Errorf("unexpected history %v %d %v", a, tr.calls, err)
+	}
+
+	// Failed translations leave messages untranslated.
+	if _, err = c.Send(ctx, 1, "world", "fail"); err != nil {
+		t.Fatal(err)
+	}
+	if m := pushed[2]; m.Text != "fail" || m.Translation != nil {
+		t.Errorf("unexpected push %+v", m)
+	}
+	a, err = c.Store.Search(&Query{}, 0, 10)
+	if err != nil || len(a) != 2 || a[0].Translation != nil {
+		t.Errorf("translation stored %v %v", a, err)
+	}
+}
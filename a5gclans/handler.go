@@ -0,0 +1,256 @@
+package a5gclans
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5glocale"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCodeListingUnknown = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4067,
+		Name:     "clan_listing_unknown",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "clan listing not found"})
+
+	ErrCodeListingInvalid = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4270,
+		Name:     "clan_listing_invalid",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "unexpected clan listing"})
+
+	ErrCodeNotAllowed = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4271,
+		Name:     "clan_not_allowed",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "clan role does not allow it"})
+
+	ErrCodeMatrixInvalid = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4272,
+		Name:     "clan_matrix_invalid",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "unexpected clan permission matrix"})
+
+	ErrCodeMatrixBusy = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4273,
+		Name:     "clan_matrix_busy",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "clan permission matrix changed, reload it"})
+)
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeListingUnknown, http.StatusNotFound)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeListingInvalid, http.StatusUnprocessableEntity)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeNotAllowed, http.StatusForbidden)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeMatrixInvalid, http.StatusUnprocessableEntity)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeMatrixBusy, http.StatusConflict)
+}
+
+// LevelFunc returns the level of a player from game data.
+type LevelFunc func(ctx context.Context, accountID uint64) (int, error)
+
+// ClanFunc fills the clan part of a listing from game data: name,
+// members, capacity and activity, leaving out what the client may lie
+// about.
+type ClanFunc func(ctx context.Context, l *Listing) error
+
+type PostRequest struct {
+	ClanID   uint64 `json:"clanId" validate:"required"`
+	Language string `json:"language" validate:"required,max=16"`
+	Message  string `json:"message"`
+	MinLevel int    `json:"minLevel" validate:"min=0"`
+}
+
+type RemoveRequest struct {
+	ClanID uint64 `json:"clanId" validate:"required"`
+}
+
+type ClanRequest struct {
+	ClanID uint64 `json:"clanId" validate:"required"`
+}
+
+type SetMatrixRequest struct {
+	ClanID  uint64              `json:"clanId" validate:"required"`
+	Roles   map[string][]string `json:"roles" validate:"required"`
+	Version int64               `json:"version" validate:"min=0"`
+}
+
+type SearchRequest struct {
+	Filter
+	Limit int `json:"limit" validate:"min=0,max=50"`
+}
+
+// PostHandler puts up a listing of a clan of the session player.
+func (b *Board) PostHandler(fn ClanFunc) a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(PostRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			r := req.Payload.(*PostRequest)
+			l := &Listing{ClanID: r.ClanID, Language: r.Language,
+				Message: r.Message, MinLevel: r.MinLevel}
+			if err := fn(ctx, l); err != nil {
+				return nil, b.apiErrs(err)
+			}
+			l, err := b.Post(ctx, s.AccountID, l)
+			if err != nil {
+				return nil, b.apiErrs(err)
+			}
+			return l, nil
+		})
+}
+
+// RemoveHandler takes a listing of a clan of the session player down.
+func (b *Board) RemoveHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(RemoveRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			r := req.Payload.(*RemoveRequest)
+			if err := b.Remove(ctx, s.AccountID, r.ClanID); err != nil {
+				return nil, b.apiErrs(err)
+			}
+			return r, nil
+		})
+}
+
+// SearchHandler ranks listings for the session player by their level and
+// request locale.
+func (b *Board) SearchHandler(fn LevelFunc) a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(SearchRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			r := req.Payload.(*SearchRequest)
+			level, err := fn(ctx, s.AccountID)
+			if err != nil {
+				return nil, b.apiErrs(err)
+			}
+			if r.Limit == 0 {
+				r.Limit = 20
+			}
+			a, err := b.Search(a5glocale.FromContext(ctx), level, &r.Filter, r.Limit)
+			if err != nil {
+				return nil, b.apiErrs(err)
+			}
+			return a, nil
+		})
+}
+
+// MatrixHandler answers with the permission matrix of a clan.
+func (r *Roles) MatrixHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(ClanRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			m, err := r.Matrix(req.Payload.(*ClanRequest).ClanID)
+			if err != nil {
+				return nil, r.apiErrs(err)
+			}
+			return m, nil
+		})
+}
+
+// SetMatrixHandler replaces the matrix of a clan of the session player,
+// Version is that of the matrix the player edited.
+func (r *Roles) SetMatrixHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(SetMatrixRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			x := req.Payload.(*SetMatrixRequest)
+			m, err := r.SetMatrix(ctx, x.ClanID, s.AccountID, x.Roles, x.Version)
+			if err != nil {
+				return nil, r.apiErrs(err)
+			}
+			return m, nil
+		})
+}
+
+// ChangesHandler answers with the audit of matrix changes of a clan to
+// members allowed to edit it.
+func (r *Roles) ChangesHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(ClanRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			clanID := req.Payload.(*ClanRequest).ClanID
+			ok, err := r.Allowed(ctx, clanID, s.AccountID, PermEditRoles)
+			if err != nil {
+				return nil, r.apiErrs(err)
+			}
+			if !ok {
+				return nil, r.apiErrs(ErrNotAllowed)
+			}
+			a, err := r.Changes(clanID, 50)
+			if err != nil {
+				return nil, r.apiErrs(err)
+			}
+			return a, nil
+		})
+}
+
+func (r *Roles) apiErrs(err error) []*a5gapi.APIErr {
+	if e := apiErr(err); e != nil {
+		return []*a5gapi.APIErr{e}
+	}
+	r.Logger.Error(err.Error())
+	return a5gapi.NewJSONMsgDefautlErrors(err)
+}
+
+func (b *Board) apiErrs(err error) []*a5gapi.APIErr {
+	if e := apiErr(err); e != nil {
+		return []*a5gapi.APIErr{e}
+	}
+	b.Logger.Error(err.Error())
+	return a5gapi.NewJSONMsgDefautlErrors(err)
+}
+
+func apiErr(err error) *a5gapi.APIErr {
+	switch errors.Cause(err) {
+	case ErrListingUnknown:
+		return a5gapi.NewErr(ErrCodeListingUnknown, "")
+	case ErrListingInvalid:
+		return a5gapi.NewErr(ErrCodeListingInvalid, "%s", err)
+	case ErrNotAllowed:
+		return a5gapi.NewErr(ErrCodeNotAllowed, "")
+	case ErrMatrixInvalid:
+		return a5gapi.NewErr(ErrCodeMatrixInvalid, "%s", err)
+	case ErrMatrixBusy:
+		return a5gapi.NewErr(ErrCodeMatrixBusy, "")
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package a5gclans
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrListingUnknown = errors.New("clan listing unknown")
+	ErrListingInvalid = errors.New("clan listing invalid")
+	ErrNotAllowed     = errors.New("clan action not allowed")
+)
+
+// Listing is a recruitment post of a clan. Activity is a clan score from
+// game data, e.g. member logins over the last week; CreatedAt and
+// ExpiresAt are in unix seconds.
+type Listing struct {
+	ClanID    uint64  `json:"clanId" db:"clan_id"`
+	Name      string  `json:"name" db:"name"`
+	Language  string  `json:"language" db:"language"`
+	Message   string  `json:"message" db:"message"`
+	Members   int     `json:"members" db:"members"`
+	Capacity  int     `json:"capacity" db:"capacity"`
+	MinLevel  int     `json:"minLevel" db:"min_level"`
+	Activity  float64 `json:"activity" db:"activity"`
+	CreatedAt int64   `json:"createdAt" db:"created_at"`
+	ExpiresAt int64   `json:"expiresAt" db:"expires_at"`
+}
+
+// Filter narrows a search, zero fields match any listing.
+type Filter struct {
+	Language string `json:"language" validate:"max=16"`
+	Name     string `json:"name" validate:"max=32"`
+	// MinFree is the number of free slots a clan must have.
+	MinFree int `json:"minFree" validate:"min=0"`
+}
+
+// Ranked is a listing with its search score.
+type Ranked struct {
+	*Listing
+	Score float64 `json:"score"`
+}
+
+// ListingStore keeps listings. Active returns unexpired listings at now a
+// player of level may join, the most active first, up to limit; Purge
+// deletes up to limit expired ones.
+type ListingStore interface {
+	Put(l *Listing) error
+	Get(clanID uint64) (*Listing, error)
+	Remove(clanID uint64) (bool, error)
+	Active(now int64, level int, limit int) ([]*Listing, error)
+	Purge(now int64, limit int) (int64, error)
+}
+
+// Weights mix the parts of a search score, each part is within [0, 1]:
+// activity relative to the most active candidate, how full the clan is
+// and whether it speaks the language of the player.
+type Weights struct {
+	Activity float64
+	Size     float64
+	Language float64
+}
+
+// AllowedFunc reports whether a player may act for a clan, e.g.
+// (*Roles).Permission(PermRecruit).
+type AllowedFunc func(ctx context.Context, clanID, accountID uint64) (bool, error)
+
+// Board is the recruitment board: clans post listings that expire after
+// TTL and players search them with a ranking of Weights.
+type Board struct {
+	Store     ListingStore
+	Allowed   AllowedFunc
+	Weights   Weights
+	Logger    a5glogs.Logger
+	TTL       time.Duration
+	MaxScan   int
+	MaxLength int
+
+	now func() time.Time
+}
+
+func NewBoard(s ListingStore, fn AllowedFunc, l a5glogs.Logger) (*Board, error) {
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if fn == nil {
+		return nil, errors.New("allowed func missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Board{
+		Store:     s,
+		Allowed:   fn,
+		Weights:   Weights{Activity: 0.5, Size: 0.2, Language: 0.3},
+		Logger:    l,
+		TTL:       7 * 24 * time.Hour,
+		MaxScan:   500,
+		MaxLength: 200,
+		now:       time.Now}, nil
+}
+
+func (b *Board) allowed(ctx context.Context, clanID, accountID uint64) error {
+	ok, err := b.Allowed(ctx, clanID, accountID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotAllowed
+	}
+	return nil
+}
+
+// Post puts up or renews a listing of a clan for accountID.
+func (b *Board) Post(ctx context.Context, accountID uint64, l *Listing) (*Listing, error) {
+	switch {
+	case l.ClanID == 0 || strings.TrimSpace(l.Name) == "":
+		return nil, errors.Wrap(ErrListingInvalid, "clan missing")
+	case l.Capacity <= 0 || l.Members < 0 || l.Members >= l.Capacity:
+		return nil, errors.Wrapf(ErrListingInvalid, "%d of %d members",
+			l.Members, l.Capacity)
+	case utf8.RuneCountInString(l.Message) > b.MaxLength:
+		return nil, errors.Wrap(ErrListingInvalid, "message too long")
+	case l.MinLevel < 0 || l.Activity < 0:
+		return nil, errors.Wrap(ErrListingInvalid, "negative requirement")
+	}
+	if err := b.allowed(ctx, l.ClanID, accountID); err != nil {
+		return nil, err
+	}
+	x := *l
+	now := b.now()
+	x.CreatedAt = now.Unix()
+	x.ExpiresAt = now.Add(b.TTL).Unix()
+	if err := b.Store.Put(&x); err != nil {
+		return nil, err
+	}
+	return &x, nil
+}
+
+// Remove takes a listing of a clan down for accountID.
+func (b *Board) Remove(ctx context.Context, accountID, clanID uint64) error {
+	if err := b.allowed(ctx, clanID, accountID); err != nil {
+		return err
+	}
+	ok, err := b.Store.Remove(clanID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.Wrapf(ErrListingUnknown, "clan %d", clanID)
+	}
+	return nil
+}
+
+// Search ranks listings a player of level and language may join, best
+// first.
+func (b *Board) Search(
+	language string, level int, f *Filter, limit int) ([]*Ranked, error) {
+	a, err := b.Store.Active(b.now().Unix(), level, b.MaxScan)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.ToLower(f.Name)
+	ranked := make([]*Ranked, 0, len(a))
+	var maxActivity float64
+	for _, l := range a {
+		if f.Language != "" && !sameLanguage(l.Language, f.Language) ||
+			name != "" && !strings.Contains(strings.ToLower(l.Name), name) ||
+			l.Capacity-l.Members < f.MinFree || l.Members >= l.Capacity {
+			continue
+		}
+		if l.Activity > maxActivity {
+			maxActivity = l.Activity
+		}
+		ranked = append(ranked, &Ranked{Listing: l})
+	}
+	for _, r := range ranked {
+		r.Score = b.Weights.Size * float64(r.Members) / float64(r.Capacity)
+		if maxActivity > 0 {
+			r.Score += b.Weights.Activity * r.Activity / maxActivity
+		}
+		if language != "" && sameLanguage(r.Language, language) {
+			r.Score += b.Weights.Language
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].ClanID < ranked[j].ClanID
+	})
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	return ranked, nil
+}
+
+// sameLanguage compares languages of locale tags, "en-US" speaks "en".
+func sameLanguage(a, b string) bool {
+	return strings.EqualFold(strings.SplitN(a, "-", 2)[0], strings.SplitN(b, "-", 2)[0])
+}
+
+// Purge deletes expired listings in batches of batchSize, run it daily
+// from a job.
+func (b *Board) Purge(ctx context.Context, batchSize int) (int64, error) {
+	var total int64
+	now := b.now().Unix()
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, errors.WithStack(err)
+		}
+		n, err := b.Store.Purge(now, batchSize)
+		if err != nil {
+			return total, err
+		}
+		total += n
+		if n < int64(batchSize) {
+			return total, nil
+		}
+	}
+}
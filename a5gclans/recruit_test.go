@@ -0,0 +1,100 @@
+package a5gclans
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestBoard(t *testing.T) {
+	officers := map[uint64]uint64{1: 10, 2: 20, 3: 30, 4: 40}
+	b, err := NewBoard(NewMemoryListingStore(),
+		func(ctx context.Context, clanID, accountID uint64) (bool, error) {
+			return officers[clanID] == accountID, nil
+		}, a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1600000000, 0)
+	b.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		accountID uint64
+		l         *Listing
+		err       error
+	}{
+		{"full", 10, &Listing{ClanID: 1, Name: "a", Members: 5, Capacity: 5},
+			ErrListingInvalid},
+		{"not officer", 20, &Listing{ClanID: 1, Name: "a", Members: 1, Capacity: 5},
+			ErrNotAllowed},
+		{"active", 10, &Listing{ClanID: 1, Name: "Wolves", Language: "en",
+			Members: 10, Capacity: 50, Activity: 100}, nil},
+		{"full-ish", 20, &Listing{ClanID: 2, Name: "Bears", Language: "en",
+			Members: 45, Capacity: 50, Activity: 50}, nil},
+		{"german", 30, &Listing{ClanID: 3, Name: "Wölfe", Language: "de",
+			Members: 25, Capacity: 50, Activity: 80}, nil},
+		{"veterans", 40, &Listing{ClanID: 4, Name: "Old Wolves", Language: "en",
+			Members: 10, Capacity: 50, Activity: 100, MinLevel: 30}, nil},
+	}
+	for _, test := range tests {
+		_, err := b.Post(ctx, test.accountID, test.l)
+		if errors.Cause(err) != test.err {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+	}
+
+	ids := func(a []*Ranked) []uint64 {
+		x := make([]uint64, len(a))
+		for i, r := range a {
+			x[i] = r.ClanID
+		}
+		return x
+	}
+	// Scores for an English player of level 10:
+	// 1: 0.5*1 + 0.2*0.2 + 0.3 = 0.84, 2: 0.25 + 0.18 + 0.3 = 0.73,
+	// 3: 0.4 + 0.1 = 0.5; 4 is over the level.
+	a, err := b.Search("en-US", 10, &Filter{}, 10)
+	if err != nil || len(a) != 3 || ids(a)[0] != 1 || ids(a)[1] != 2 || ids(a)[2] != 3 {
+		t.Errorf("unexpected search %v %v", ids(a), err)
+	}
+	// Language weighs less than activity for a German player.
+	a, err = b.Search("de", 10, &Filter{}, 2)
+	if err != nil || len(a) != 2 || ids(a)[0] != 3 || ids(a)[1] != 1 {
+		t.Errorf("unexpected search %v %v", ids(a), err)
+	}
+	a, err = b.Search("en", 40, &Filter{Name: "wolves", MinFree: 10}, 10)
+	if err != nil || len(a) != 2 || ids(a)[0] != 1 || ids(a)[1] != 4 {
+		t.Errorf("unexpected search %v %v", ids(a), err)
+	}
+
+	if err = b.Remove(ctx, 10, 2); errors.Cause(err) != ErrNotAllowed {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err = b.Remove(ctx, 20, 2); err != nil {
+		t.Error(err)
+	}
+	if err = b.Remove(ctx, 20, 2); errors.Cause(err) != ErrListingUnknown {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// Listings expire unless renewed.
+	now = now.Add(6 * 24 * time.Hour)
+	if _, err = b.Post(ctx, 30, &Listing{ClanID: 3, Name: "Wölfe", Language: "de",
+		Members: 25, Capacity: 50, Activity: 80}); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(2 * 24 * time.Hour)
+	a, err = b.Search("en", 40, &Filter{}, 10)
+	if err != nil || len(a) != 1 || ids(a)[0] != 3 {
+		t.Errorf("unexpected search %v %v", ids(a), err)
+	}
+	if n, err := b.Purge(ctx, 1); err != nil || n != 2 {
+		t.Errorf("unexpected purge %d %v", n, err)
+	}
+}
@@ -0,0 +1,218 @@
+package a5gclans
+
+import (
+	"context"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrMatrixInvalid = errors.New("clan permission matrix invalid")
+	ErrMatrixBusy    = errors.New("clan permission matrix changed concurrently")
+)
+
+// Permissions a clan grants to its roles.
+const (
+	PermInvite      = "invite"
+	PermKick        = "kick"
+	PermStartWar    = "start_war"
+	PermEditMessage = "edit_message"
+	PermRecruit     = "recruit"
+	PermEditRoles   = "edit_roles"
+)
+
+// Permissions lists every permission, RoleLeader always has them all so
+// a clan can not lock itself out of its matrix.
+var Permissions = []string{PermInvite, PermKick, PermStartWar,
+	PermEditMessage, PermRecruit, PermEditRoles}
+
+const RoleLeader = "leader"
+
+// Matrix maps role names of a clan to their permissions, Version counts
+// changes from 0 for the default matrix.
+type Matrix struct {
+	Roles   map[string][]string `json:"roles"`
+	Version int64               `json:"version"`
+}
+
+// DefaultMatrix is what clans start with: a leader, officers managing
+// members and plain members.
+func DefaultMatrix() *Matrix {
+	return &Matrix{Roles: map[string][]string{
+		RoleLeader: append([]string(nil), Permissions...),
+		"officer":  {PermInvite, PermKick, PermEditMessage, PermRecruit},
+		"member":   {}}}
+}
+
+// Has reports whether a role has a permission.
+func (m *Matrix) Has(role, perm string) bool {
+	for _, p := range m.Roles[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Change is an audit entry of a matrix edit, CreatedAt in unix seconds.
+type Change struct {
+	ID        int64               `json:"id"`
+	ClanID    uint64              `json:"clanId"`
+	AccountID uint64              `json:"accountId"`
+	Previous  map[string][]string `json:"previous"`
+	Roles     map[string][]string `json:"roles"`
+	CreatedAt int64               `json:"createdAt"`
+}
+
+// MatrixStore keeps matrices of clans that changed the default one, Get
+// returns nil for the others. Update replaces the matrix of version
+// prev.Version with next and records c along, reporting false when the
+// matrix changed since.
+type MatrixStore interface {
+	Get(clanID uint64) (*Matrix, error)
+	Update(clanID uint64, prev, next *Matrix, c *Change) (bool, error)
+	Changes(clanID uint64, limit int) ([]*Change, error)
+}
+
+// RoleFunc returns the role of a player in a clan from game data, "" for
+// non-members.
+type RoleFunc func(ctx context.Context, clanID, accountID uint64) (string, error)
+
+// Roles checks clan actions against per-clan permission matrices.
+// Members of a role removed from the matrix have no permissions until
+// they are given another role.
+type Roles struct {
+	Store    MatrixStore
+	Role     RoleFunc
+	Logger   a5glogs.Logger
+	MaxRoles int
+
+	now func() time.Time
+}
+
+func NewRoles(s MatrixStore, fn RoleFunc, l a5glogs.Logger) (*Roles, error) {
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if fn == nil {
+		return nil, errors.New("role func missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Roles{Store: s, Role: fn, Logger: l, MaxRoles: 10, now: time.Now}, nil
+}
+
+// Matrix returns the matrix of a clan.
+func (r *Roles) Matrix(clanID uint64) (*Matrix, error) {
+	m, err := r.Store.Get(clanID)
+	if err != nil || m != nil {
+		return m, err
+	}
+	return DefaultMatrix(), nil
+}
+
+// Allowed reports whether a player has a permission in a clan.
+func (r *Roles) Allowed(
+	ctx context.Context, clanID, accountID uint64, perm string) (bool, error) {
+	role, err := r.Role(ctx, clanID, accountID)
+	if err != nil || role == "" {
+		return false, err
+	}
+	m, err := r.Matrix(clanID)
+	if err != nil {
+		return false, err
+	}
+	return m.Has(role, perm), nil
+}
+
+// Permission adapts Allowed for a single permission, e.g. for NewBoard
+// with PermRecruit.
+func (r *Roles) Permission(perm string) AllowedFunc {
+	return func(ctx context.Context, clanID, accountID uint64) (bool, error) {
+		return r.Allowed(ctx, clanID, accountID, perm)
+	}
+}
+
+func (r *Roles) validate(roles map[string][]string) error {
+	if len(roles) > r.MaxRoles {
+		return errors.Wrapf(ErrMatrixInvalid, "%d roles over %d", len(roles), r.MaxRoles)
+	}
+	for role, perms := range roles {
+		if role == "" || utf8.RuneCountInString(role) > 32 {
+			return errors.Wrapf(ErrMatrixInvalid, "role name %q", role)
+		}
+		seen := make(map[string]bool, len(perms))
+		for _, p := range perms {
+			if !contains(Permissions, p) {
+				return errors.Wrapf(ErrMatrixInvalid, "role %q: unknown permission %q",
+					role, p)
+			}
+			if seen[p] {
+				return errors.Wrapf(ErrMatrixInvalid, "role %q: duplicate permission %q",
+					role, p)
+			}
+			seen[p] = true
+		}
+	}
+	if len(roles[RoleLeader]) != len(Permissions) {
+		return errors.Wrapf(ErrMatrixInvalid, "%s must have every permission", RoleLeader)
+	}
+	return nil
+}
+
+// SetMatrix replaces the matrix of version of a clan for a player with
+// PermEditRoles and records the change.
+func (r *Roles) SetMatrix(ctx context.Context, clanID, accountID uint64,
+	roles map[string][]string, version int64) (*Matrix, error) {
+	if err := r.validate(roles); err != nil {
+		return nil, err
+	}
+	ok, err := r.Allowed(ctx, clanID, accountID, PermEditRoles)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotAllowed
+	}
+	prev, err := r.Matrix(clanID)
+	if err != nil {
+		return nil, err
+	}
+	if prev.Version != version {
+		return nil, errors.Wrapf(ErrMatrixBusy, "version %d", prev.Version)
+	}
+	next := &Matrix{Roles: make(map[string][]string, len(roles)), Version: version + 1}
+	for role, perms := range roles {
+		a := append([]string{}, perms...)
+		sort.Strings(a)
+		next.Roles[role] = a
+	}
+	c := &Change{ClanID: clanID, AccountID: accountID, Previous: prev.Roles,
+		Roles: next.Roles, CreatedAt: r.now().Unix()}
+	if ok, err = r.Store.Update(clanID, prev, next, c); err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrMatrixBusy
+	}
+	return next, nil
+}
+
+// Changes lists the latest matrix changes of a clan, newest first.
+func (r *Roles) Changes(clanID uint64, limit int) ([]*Change, error) {
+	return r.Store.Changes(clanID, limit)
+}
+
+func contains(a []string, s string) bool {
+	for _, x := range a {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package a5gclans
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestRoles(t *testing.T) {
+	members := map[uint64]string{1: RoleLeader, 2: "officer", 3: "member"}
+	r, err := NewRoles(NewMemoryMatrixStore(),
+		func(ctx context.Context, clanID, accountID uint64) (string, error) {
+			return members[accountID], nil
+		}, a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.now = func() time.Time { return time.Unix(1600000000, 0) }
+	ctx := context.Background()
+
+	allowed := func(accountID uint64, perm string) bool {
+		ok, err := r.Allowed(ctx, 7, accountID, perm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+	if !allowed(2, PermKick) || allowed(2, PermStartWar) || allowed(3, PermInvite) ||
+		allowed(4, PermInvite) {
+		t.Error("unexpected default permissions")
+	}
+
+	leader := append([]string(nil), Permissions...)
+	tests := []struct {
+		name      string
+		accountID uint64
+		roles     map[string][]string
+		version   int64
+		err       error
+	}{
+		{"unknown permission", 1, map[string][]string{RoleLeader: leader,
+			"officer": {"ban"}}, 0, ErrMatrixInvalid},
+		{"duplicate permission", 1, map[string][]string{RoleLeader: leader,
+			"officer": {PermKick, PermKick}}, 0, ErrMatrixInvalid},
+		{"weak leader", 1, map[string][]string{RoleLeader: {PermKick}}, 0,
+			ErrMatrixInvalid},
+		{"officer", 2, map[string][]string{RoleLeader: leader}, 0, ErrNotAllowed},
+		{"stale", 1, map[string][]string{RoleLeader: leader}, 3, ErrMatrixBusy},
+		{"war officers", 1, map[string][]string{RoleLeader: leader,
+			"officer": {PermStartWar, PermKick}, "member": {PermInvite}}, 0, nil},
+	}
+	for _, test := range tests {
+		_, err := r.SetMatrix(ctx, 7, test.accountID, test.roles, test.version)
+		if errors.Cause(err) != test.err {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+	}
+	if !allowed(2, PermStartWar) || allowed(2, PermEditMessage) || !allowed(3, PermInvite) {
+		t.Error("unexpected custom permissions")
+	}
+	if ok, err := r.Allowed(ctx, 8, 3, PermInvite); err != nil || ok {
+		t.Errorf("other clan changed %v %v", ok, err)
+	}
+
+	// Dropping a role leaves its members without permissions.
+	m, err := r.SetMatrix(ctx, 7, 1, map[string][]string{RoleLeader: leader}, 1)
+	if err != nil || m.Version != 2 {
+		t.Fatalf("unexpected matrix %+v %v", m, err)
+	}
+	if allowed(2, PermKick) {
+		t.Error("dropped role allowed")
+	}
+	a, err := r.Changes(7, 10)
+	if err != nil || len(a) != 2 || len(a[0].Previous) != 3 || len(a[0].Roles) != 1 ||
+		a[1].AccountID != 1 || len(a[1].Previous["officer"]) != 4 {
+		t.Errorf("unexpected changes %+v %v", a, err)
+	}
+}
@@ -0,0 +1,381 @@
+package a5gclans
+
+import (
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryListingStore struct {
+	mu       sync.Mutex
+	listings map[uint64]Listing
+}
+
+func NewMemoryListingStore() ListingStore {
+	return &memoryListingStore{listings: make(map[uint64]Listing)}
+}
+
+func (s *memoryListingStore) Put(l *Listing) error {
+	s.mu.Lock()
+	s.listings[l.ClanID] = *l
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryListingStore) Get(clanID uint64) (*Listing, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.listings[clanID]
+	if !ok {
+		return nil, nil
+	}
+	return &l, nil
+}
+
+func (s *memoryListingStore) Remove(clanID uint64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.listings[clanID]
+	delete(s.listings, clanID)
+	return ok, nil
+}
+
+func (s *memoryListingStore) Active(now int64, level int, limit int) ([]*Listing, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := []*Listing{}
+	for _, l := range s.listings {
+		if l.ExpiresAt > now && l.MinLevel <= level {
+			x := l
+			a = append(a, &x)
+		}
+	}
+	sort.Slice(a, func(i, j int) bool {
+		if a[i].Activity != a[j].Activity {
+			return a[i].Activity > a[j].Activity
+		}
+		return a[i].ClanID < a[j].ClanID
+	})
+	if len(a) > limit {
+		a = a[:limit]
+	}
+	return a, nil
+}
+
+func (s *memoryListingStore) Purge(now int64, limit int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for id, l := range s.listings {
+		if n == int64(limit) {
+			break
+		}
+		if l.ExpiresAt <= now {
+			delete(s.listings, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// dbListingStore keeps listings in a MySQL table:
+//
+//	CREATE TABLE clan_listings (
+//	  clan_id BIGINT UNSIGNED NOT NULL PRIMARY KEY,
+//	  name VARCHAR(64) NOT NULL,
+//	  language VARCHAR(16) NOT NULL,
+//	  message VARCHAR(1024) NOT NULL,
+//	  members INT NOT NULL,
+//	  capacity INT NOT NULL,
+//	  min_level INT NOT NULL,
+//	  activity DOUBLE NOT NULL,
+//	  created_at BIGINT NOT NULL,
+//	  expires_at BIGINT NOT NULL,
+//	  KEY active (expires_at, activity));
+type dbListingStore struct {
+	pooler    a5gdb.Pooler
+	tableName string
+}
+
+var listingColumns = []string{"clan_id", "name", "language", "message", "members",
+	"capacity", "min_level", "activity", "created_at", "expires_at"}
+
+func NewDBListingStore(p a5gdb.Pooler, tableName string) (ListingStore, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if tableName == "" {
+		return nil, errors.New("empty clan listings table name")
+	}
+	return &dbListingStore{pooler: p, tableName: tableName}, nil
+}
+
+func (s *dbListingStore) Put(l *Listing) error {
+	_, err := s.pooler.WritePool().NewSession().InsertBySql("REPLACE INTO "+
+		s.tableName+" (clan_id, name, language, message, members, capacity,"+
+		" min_level, activity, created_at, expires_at)"+
+		" VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		l.ClanID, l.Name, l.Language, l.Message, l.Members, l.Capacity,
+		l.MinLevel, l.Activity, l.CreatedAt, l.ExpiresAt).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	return nil
+}
+
+func (s *dbListingStore) Get(clanID uint64) (*Listing, error) {
+	l := new(Listing)
+	err := s.pooler.ReadPool().NewSession().
+		Select(listingColumns...).From(s.tableName).
+		Where(dbr.Eq("clan_id", clanID)).LoadOne(l)
+	if err == dbr.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	return l, nil
+}
+
+func (s *dbListingStore) Remove(clanID uint64) (bool, error) {
+	res, err := s.pooler.WritePool().NewSession().
+		DeleteFrom(s.tableName).Where(dbr.Eq("clan_id", clanID)).Exec()
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.(*DeleteStmt).Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	return n > 0, nil
+}
+
+func (s *dbListingStore) Active(now int64, level int, limit int) ([]*Listing, error) {
+	a := []*Listing{}
+	_, err := s.pooler.ReadPool().NewSession().
+		Select(listingColumns...).From(s.tableName).
+		Where(dbr.Gt("expires_at", now)).
+		Where(dbr.Lte("min_level", level)).
+		OrderDesc("activity").OrderAsc("clan_id").
+		Limit(uint64(limit)).Load(&a)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	return a, nil
+}
+
+func (s *dbListingStore) Purge(now int64, limit int) (int64, error) {
+	res, err := s.pooler.WritePool().NewSession().
+		DeleteFrom(s.tableName).
+		Where(dbr.Lte("expires_at", now)).
+		Limit(uint64(limit)).Exec()
+	if err != nil {
+		return 0, errors.Wrap(err, "dbr.(*DeleteStmt).Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	return n, nil
+}
+
+type memoryMatrixStore struct {
+	mu       sync.Mutex
+	matrices map[uint64]*Matrix
+	changes  []*Change
+}
+
+func NewMemoryMatrixStore() MatrixStore {
+	return &memoryMatrixStore{matrices: make(map[uint64]*Matrix)}
+}
+
+func (s *memoryMatrixStore) Get(clanID uint64) (*Matrix, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.matrices[clanID]
+	if !ok {
+		return nil, nil
+	}
+	x := *m
+	return &x, nil
+}
+
+func (s *memoryMatrixStore) Update(
+	clanID uint64, prev, next *Matrix, c *Change) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var version int64
+	if m, ok := s.matrices[clanID]; ok {
+		version = m.Version
+	}
+	if version != prev.Version {
+		return false, nil
+	}
+	x := *next
+	s.matrices[clanID] = &x
+	y := *c
+	y.ID = int64(len(s.changes) + 1)
+	s.changes = append(s.changes, &y)
+	return true, nil
+}
+
+func (s *memoryMatrixStore) Changes(clanID uint64, limit int) ([]*Change, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := []*Change{}
+	for i := len(s.changes) - 1; i >= 0 && len(a) < limit; i-- {
+		if s.changes[i].ClanID == clanID {
+			x := *s.changes[i]
+			a = append(a, &x)
+		}
+	}
+	return a, nil
+}
+
+// dbMatrixStore keeps matrices and their changes in MySQL tables:
+//
+//	CREATE TABLE clan_role_matrices (
+//	  clan_id BIGINT UNSIGNED NOT NULL PRIMARY KEY,
+//	  roles TEXT NOT NULL,
+//	  version BIGINT NOT NULL);
+//
+//	CREATE TABLE clan_role_changes (
+//	  id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+//	  clan_id BIGINT UNSIGNED NOT NULL,
+//	  account_id BIGINT UNSIGNED NOT NULL,
+//	  previous TEXT NOT NULL,
+//	  roles TEXT NOT NULL,
+//	  created_at BIGINT NOT NULL,
+//	  KEY clan (clan_id, id));
+//
+// Roles are JSON objects of role names to permissions.
+type dbMatrixStore struct {
+	pooler       a5gdb.Pooler
+	matrixTable  string
+	changesTable string
+}
+
+func NewDBMatrixStore(
+	p a5gdb.Pooler, matrixTable, changesTable string) (MatrixStore, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if matrixTable == "" || changesTable == "" {
+		return nil, errors.New("empty clan roles table name")
+	}
+	return &dbMatrixStore{
+		pooler:       p,
+		matrixTable:  matrixTable,
+		changesTable: changesTable}, nil
+}
+
+func (s *dbMatrixStore) Get(clanID uint64) (*Matrix, error) {
+	var row struct {
+		Roles   string `db:"roles"`
+		Version int64  `db:"version"`
+	}
+	err := s.pooler.ReadPool().NewSession().
+		Select("roles", "version").From(s.matrixTable).
+		Where(dbr.Eq("clan_id", clanID)).LoadOne(&row)
+	if err == dbr.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	m := &Matrix{Version: row.Version}
+	if err = json.Unmarshal([]byte(row.Roles), &m.Roles); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return m, nil
+}
+
+// Update inserts the first custom matrix of a clan, relying on the
+// primary key against concurrent inserts, and swaps later ones by
+// version.
+func (s *dbMatrixStore) Update(
+	clanID uint64, prev, next *Matrix, c *Change) (bool, error) {
+	roles, err := json.Marshal(next.Roles)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	previous, err := json.Marshal(prev.Roles)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	tx, err := s.pooler.WritePool().NewSession().Begin()
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.(*Session).Begin fn")
+	}
+	defer tx.RollbackUnlessCommitted()
+	var res sql.Result
+	if prev.Version == 0 {
+		res, err = tx.InsertBySql("INSERT IGNORE INTO "+s.matrixTable+
+			" (clan_id, roles, version) VALUES (?, ?, ?)",
+			clanID, string(roles), next.Version).Exec()
+	} else {
+		res, err = tx.Update(s.matrixTable).
+			Set("roles", string(roles)).
+			Set("version", next.Version).
+			Where(dbr.Eq("clan_id", clanID)).
+			Where(dbr.Eq("version", prev.Version)).Exec()
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.(*UpdateStmt).Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	if n == 0 {
+		return false, nil
+	}
+	_, err = tx.InsertInto(s.changesTable).
+		Pair("clan_id", clanID).
+		Pair("account_id", c.AccountID).
+		Pair("previous", string(previous)).
+		Pair("roles", string(roles)).
+		Pair("created_at", c.CreatedAt).Exec()
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	if err = tx.Commit(); err != nil {
+		return false, errors.Wrap(err, "dbr.(*Tx).Commit fn")
+	}
+	return true, nil
+}
+
+func (s *dbMatrixStore) Changes(clanID uint64, limit int) ([]*Change, error) {
+	var rows []struct {
+		ID        int64  `db:"id"`
+		AccountID uint64 `db:"account_id"`
+		Previous  string `db:"previous"`
+		Roles     string `db:"roles"`
+		CreatedAt int64  `db:"created_at"`
+	}
+	_, err := s.pooler.ReadPool().NewSession().
+		Select("id", "account_id", "previous", "roles", "created_at").
+		From(s.changesTable).Where(dbr.Eq("clan_id", clanID)).
+		OrderDesc("id").Limit(uint64(limit)).Load(&rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	a := make([]*Change, len(rows))
+	for i, row := range rows {
+		c := &Change{ID: row.ID, ClanID: clanID, AccountID: row.AccountID,
+			CreatedAt: row.CreatedAt}
+		if err = json.Unmarshal([]byte(row.Previous), &c.Previous); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if err = json.Unmarshal([]byte(row.Roles), &c.Roles); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		a[i] = c
+	}
+	return a, nil
+}
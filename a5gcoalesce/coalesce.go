@@ -0,0 +1,128 @@
+package a5gcoalesce
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/pkg/errors"
+)
+
+type call struct {
+	wg  sync.WaitGroup
+	val interface{}
+	err error
+}
+
+// Stats are the metrics of a key: InFlight calls running now, Calls run
+// against the backend, Coalesced callers served by a call of another one
+// and MaxWaiters callers waiting on a single call at most.
+type Stats struct {
+	Key        string `json:"key"`
+	InFlight   int64  `json:"inFlight"`
+	Calls      int64  `json:"calls"`
+	Errors     int64  `json:"errors"`
+	Coalesced  int64  `json:"coalesced"`
+	MaxWaiters int64  `json:"maxWaiters"`
+}
+
+// Group coalesces identical concurrent reads: callers of Do with a key of
+// a running call wait for it and share its result, so a thundering herd
+// after a cache expiry makes one backend query. Results are shared, so
+// callers must not modify them.
+type Group struct {
+	// Metric maps a key to the name its stats are kept under, e.g. to drop
+	// player IDs off keys; the key itself when nil.
+	Metric func(key string) string
+
+	mu      sync.Mutex
+	calls   map[string]*call
+	waiters map[string]int64
+	stats   map[string]*Stats
+}
+
+func NewGroup() *Group {
+	return &Group{
+		calls:   make(map[string]*call),
+		waiters: make(map[string]int64),
+		stats:   make(map[string]*Stats)}
+}
+
+// Do runs fn unless a call of key is running, in which case it waits for
+// that one; shared reports a result of another caller.
+func (g *Group) Do(
+	key string, fn func() (interface{}, error)) (v interface{}, shared bool, err error) {
+	metric := key
+	if g.Metric != nil {
+		metric = g.Metric(key)
+	}
+	g.mu.Lock()
+	s, ok := g.stats[metric]
+	if !ok {
+		s = &Stats{Key: metric}
+		g.stats[metric] = s
+	}
+	if c, ok := g.calls[key]; ok {
+		s.Coalesced++
+		g.waiters[key]++
+		if g.waiters[key] > s.MaxWaiters {
+			s.MaxWaiters = g.waiters[key]
+		}
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val, true, c.err
+	}
+	c := new(call)
+	c.wg.Add(1)
+	g.calls[key] = c
+	s.Calls++
+	s.InFlight++
+	g.mu.Unlock()
+	g.run(c, key, s, fn)
+	return c.val, false, c.err
+}
+
+func (g *Group) run(c *call, key string, s *Stats, fn func() (interface{}, error)) {
+	returned := false
+	defer func() {
+		if !returned {
+			// Waiters get an error while the panic goes up the caller.
+			c.err = errors.Errorf("coalesced call %q panicked", key)
+		}
+		g.mu.Lock()
+		delete(g.calls, key)
+		delete(g.waiters, key)
+		s.InFlight--
+		if c.err != nil {
+			s.Errors++
+		}
+		g.mu.Unlock()
+		c.wg.Done()
+	}()
+	c.val, c.err = fn()
+	returned = true
+}
+
+// Report returns stats of keys sorted by name.
+func (g *Group) Report() []*Stats {
+	g.mu.Lock()
+	a := make([]*Stats, 0, len(g.stats))
+	for _, s := range g.stats {
+		x := *s
+		a = append(a, &x)
+	}
+	g.mu.Unlock()
+	sort.Slice(a, func(i, j int) bool { return a[i].Key < a[j].Key })
+	return a
+}
+
+// ReportHandler answers with the Report for dashboards, mount it on an
+// admin route class.
+func (g *Group) ReportHandler() a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		return g.Report(), nil
+	}
+}
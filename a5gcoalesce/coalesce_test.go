@@ -0,0 +1,62 @@
+package a5gcoalesce
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestGroupDo(t *testing.T) {
+	g := NewGroup()
+	g.Metric = func(key string) string { return strings.SplitN(key, ":", 2)[0] }
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var wg sync.WaitGroup
+	results := make([]interface{}, 5)
+	shared := make([]bool, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], shared[i], _ = g.Do("top:100", func() (interface{}, error) {
+				close(started)
+				<-release
+				return "entries", nil
+			})
+		}(i)
+		if i == 0 {
+			<-started
+		}
+	}
+	// Let the other callers join the running call.
+	for g.Report()[0].Coalesced < 4 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	n := 0
+	for i, v := range results {
+		if v != "entries" {
+			t.Errorf("unexpected result %v", v)
+		}
+		if shared[i] {
+			n++
+		}
+	}
+	if n != 4 {
+		t.Errorf("expected 4 shared results, got %d", n)
+	}
+	if _, _, err := g.Do("top:10", func() (interface{}, error) {
+		return nil, errors.New("backend down")
+	}); err == nil {
+		t.Error("expected an error")
+	}
+	r := g.Report()
+	if len(r) != 1 || r[0].Calls != 2 || r[0].Coalesced != 4 ||
+		r[0].Errors != 1 || r[0].InFlight != 0 || r[0].MaxWaiters != 4 {
+		t.Errorf("unexpected report %+v", r[0])
+	}
+}
@@ -0,0 +1,100 @@
+package a5gcodec
+
+import (
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Codec is an API envelope encoding.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(b []byte, v interface{}) error
+	ContentType() string
+}
+
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeMsgpack  = "application/x-msgpack"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+var ErrContentTypeUnsupported = errors.New("unsupported content type")
+
+var (
+	mu     sync.RWMutex
+	codecs = map[string]Codec{
+		ContentTypeJSON:        JSON,
+		ContentTypeMsgpack:     Msgpack,
+		"application/msgpack":  Msgpack,
+		ContentTypeProtobuf:    Protobuf,
+		"application/protobuf": Protobuf}
+)
+
+// Register adds (or replaces) a codec for its content type.
+func Register(c Codec) {
+	mu.Lock()
+	codecs[c.ContentType()] = c
+	mu.Unlock()
+}
+
+// ByContentType returns codec for Content-Type header value; empty value
+// means JSON.
+func ByContentType(contentType string) (Codec, error) {
+	if strings.TrimSpace(contentType) == "" {
+		return JSON, nil
+	}
+	s, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	mu.RLock()
+	c, ok := codecs[s]
+	mu.RUnlock()
+	if !ok {
+		return nil, errors.Wrap(ErrContentTypeUnsupported, s)
+	}
+	return c, nil
+}
+
+// Negotiate picks the most preferred supported codec of an Accept header
+// value and falls back to JSON.
+func Negotiate(accept string) Codec {
+	type choice struct {
+		codec Codec
+		q     float64
+		i     int
+	}
+	var a []choice
+	for i, part := range strings.Split(accept, ",") {
+		s, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if x, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(x, 64); err != nil || q <= 0 {
+				continue
+			}
+		}
+		if s == "*/*" || s == "application/*" {
+			a = append(a, choice{codec: JSON, q: q, i: i})
+			continue
+		}
+		mu.RLock()
+		c, ok := codecs[s]
+		mu.RUnlock()
+		if ok {
+			a = append(a, choice{codec: c, q: q, i: i})
+		}
+	}
+	if len(a) == 0 {
+		return JSON
+	}
+	sort.SliceStable(a, func(i, k int) bool { return a[i].q > a[k].q })
+	return a[0].codec
+}
@@ -0,0 +1,168 @@
+package a5gcodec
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/pkg/errors"
+)
+
+type testPayload struct {
+	ID     uint64   `json:"id"`
+	Delta  int64    `json:"delta"`
+	Ratio  float64  `json:"ratio"`
+	Name   string   `json:"name"`
+	Tags   []string `json:"tags"`
+	Nested *struct {
+		OK bool `json:"ok"`
+	} `json:"nested"`
+}
+
+var codecs3 = []Codec{JSON, Msgpack, Protobuf}
+
+func TestRequestRoundTrip(t *testing.T) {
+	p := &testPayload{ID: math.MaxUint64, Delta: math.MinInt64, Ratio: 0.25,
+		Name: "x", Tags: []string{}}
+	tests := []struct {
+		payload interface{}
+		raw     string
+	}{
+		{p, ""},
+		{nil, ""},
+		{[]int{}, "[]"},
+		{map[string]int{}, "{}"},
+	}
+	for _, c := range codecs3 {
+		for i, x := range tests {
+			req := &a5gapi.APIMsgRequest{RequestID: "r1", Payload: x.payload,
+				Time: 1500000000, Fields: []string{"id"}, IfVersion: 3,
+				Page: &a5gapi.PageRequest{Cursor: "c", Limit: 20}, APIVersion: 2}
+			b, err := c.Marshal(req)
+			if err != nil {
+				t.Fatalf("%s %d: %+v", c.ContentType(), i, err)
+			}
+			raw := new(json.RawMessage)
+			got := &a5gapi.APIMsgRequest{Payload: raw}
+			if err = c.Unmarshal(b, got); err != nil {
+				t.Fatalf("%s %d: %+v", c.ContentType(), i, err)
+			}
+			switch {
+			case x.payload == nil && len(*raw) != 0:
+				t.Errorf("%s %d: payload %s want none", c.ContentType(), i, *raw)
+			case x.raw != "" && string(*raw) != x.raw:
+				t.Errorf("%s %d: payload %s want %s", c.ContentType(), i, *raw, x.raw)
+			case x.payload == p:
+				v := new(testPayload)
+				if err = json.Unmarshal(*raw, v); err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(v, p) {
+					t.Errorf("%s: payload %+v want %+v", c.ContentType(), v, p)
+				}
+			}
+			got.Payload, req.Payload = nil, nil
+			if !reflect.DeepEqual(got, req) {
+				t.Errorf("%s %d: %+v want %+v", c.ContentType(), i, got, req)
+			}
+		}
+	}
+}
+
+func TestResponseRoundTrip(t *testing.T) {
+	total := int64(42)
+	p := &testPayload{ID: math.MaxUint64 - 1, Delta: -1, Tags: []string{"a"}}
+	for _, c := range codecs3 {
+		res := &a5gapi.APIMsgResponse{RequestID: "r1", APIVersion: 2,
+			Errs: []*a5gapi.APIErr{
+				{Code: 4221, Err: errors.New("bad"), Field: "items[0]"},
+				{Code: 1}},
+			Meta:    a5gapi.KV{"n": 7, "list": []interface{}{"a", true, nil}},
+			Page:    &a5gapi.Page{Cursor: "next", Limit: 10, Total: &total, HasMore: true},
+			Payload: p,
+			Time:    1500000000}
+		b, err := c.Marshal(res)
+		if err != nil {
+			t.Fatalf("%s: %+v", c.ContentType(), err)
+		}
+		v := new(testPayload)
+		got := &a5gapi.APIMsgResponse{Payload: v}
+		if err = c.Unmarshal(b, got); err != nil {
+			t.Fatalf("%s: %+v", c.ContentType(), err)
+		}
+		if !reflect.DeepEqual(v, p) {
+			t.Errorf("%s: payload %+v want %+v", c.ContentType(), v, p)
+		}
+		if !reflect.DeepEqual(got.Page, res.Page) {
+			t.Errorf("%s: page %+v want %+v", c.ContentType(), got.Page, res.Page)
+		}
+		meta, err := json.Marshal(got.Meta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := `{"list":["a",true,null],"n":7}`; string(meta) != s {
+			t.Errorf("%s: meta %s want %s", c.ContentType(), meta, s)
+		}
+		if len(got.Errs) != 2 || got.Errs[0].Code != 4221 ||
+			got.Errs[0].Err == nil || got.Errs[0].Err.Error() != "bad" ||
+			got.Errs[0].Field != "items[0]" ||
+			got.Errs[1].Code != 1 || got.Errs[1].Err != nil {
+			t.Errorf("%s: errs %+v", c.ContentType(), got.Errs)
+		}
+		if got.RequestID != "r1" || got.APIVersion != 2 || got.Time != 1500000000 ||
+			got.Success {
+			t.Errorf("%s: envelope %+v", c.ContentType(), got)
+		}
+
+		// A response without payload keeps none.
+		if b, err = c.Marshal(&a5gapi.APIMsgResponse{Success: true}); err != nil {
+			t.Fatal(err)
+		}
+		got = new(a5gapi.APIMsgResponse)
+		if err = c.Unmarshal(b, got); err != nil {
+			t.Fatal(err)
+		}
+		if !got.Success || got.Payload != nil || got.Meta != nil || got.Page != nil {
+			t.Errorf("%s: empty response %+v", c.ContentType(), got)
+		}
+	}
+}
+
+func TestCodecErrors(t *testing.T) {
+	if _, err := ByContentType("text/plain"); errors.Cause(err) != ErrContentTypeUnsupported {
+		t.Errorf("ByContentType() => %v want %v", err, ErrContentTypeUnsupported)
+	}
+	if _, err := Protobuf.Marshal(new(testPayload)); err == nil {
+		t.Error("protobuf marshaled a non envelope type")
+	}
+	if _, err := Protobuf.Marshal(&a5gapi.APIMsgResponse{
+		Payload: map[string]interface{}{"nan": math.NaN()}}); err == nil {
+		t.Error("protobuf marshaled NaN")
+	}
+	for _, c := range codecs3 {
+		if err := c.Unmarshal([]byte{0xff, 0xff}, new(a5gapi.APIMsgResponse)); err == nil {
+			t.Errorf("%s: unmarshaled garbage", c.ContentType())
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		codec  Codec
+	}{
+		{"", JSON},
+		{"text/html", JSON},
+		{"application/x-protobuf", Protobuf},
+		{"application/json;q=0.5, application/msgpack", Msgpack},
+		{"application/x-msgpack;q=0.1, */*", JSON},
+	}
+	for _, x := range tests {
+		if c := Negotiate(x.accept); c != x.codec {
+			t.Errorf("Negotiate(%q) => %s want %s", x.accept, c.ContentType(),
+				x.codec.ContentType())
+		}
+	}
+}
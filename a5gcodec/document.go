@@ -0,0 +1,78 @@
+package a5gcodec
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// document returns the JSON form of v as plain maps, slices and scalars.
+// Numbers are int64, uint64 or float64 as their text allows so 64 bit
+// ids survive encodings that are not JSON.
+func document(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var x interface{}
+	if err = d.Decode(&x); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return numbers(x)
+}
+
+func numbers(x interface{}) (interface{}, error) {
+	switch v := x.(type) {
+	case json.Number:
+		if i, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return i, nil
+		}
+		if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return u, nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return f, nil
+	case map[string]interface{}:
+		for k, y := range v {
+			n, err := numbers(y)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = n
+		}
+	case []interface{}:
+		for i, y := range v {
+			n, err := numbers(y)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = n
+		}
+	}
+	return x, nil
+}
+
+// fromDocument stores a decoded document in *dst: as is when *dst is nil,
+// otherwise through JSON into the value *dst holds, e.g. a
+// *json.RawMessage of a request payload.
+func fromDocument(x interface{}, dst *interface{}) error {
+	if *dst == nil {
+		*dst = x
+		return nil
+	}
+	b, err := json.Marshal(x)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err = json.Unmarshal(b, dst); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package a5gcodec
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// JSON is the default (and reference) encoding.
+var JSON Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string { return ContentTypeJSON }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return b, nil
+}
+
+func (jsonCodec) Unmarshal(b []byte, v interface{}) error {
+	if err := json.Unmarshal(b, v); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
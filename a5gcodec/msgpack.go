@@ -0,0 +1,44 @@
+package a5gcodec
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"github.com/vmihailenco/msgpack"
+)
+
+// Msgpack encodes the same document as JSON does (a5gapi types define
+// their wire form with json marshalers), only in a binary representation.
+// Integers stay msgpack integers, so uint64 ids keep their precision.
+var Msgpack Codec = msgpackCodec{}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string { return ContentTypeMsgpack }
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	x, err := document(v)
+	if err != nil {
+		return nil, err
+	}
+	b, err := msgpack.Marshal(x)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return b, nil
+}
+
+func (msgpackCodec) Unmarshal(b []byte, v interface{}) error {
+	var x interface{}
+	if err := msgpack.Unmarshal(b, &x); err != nil {
+		return errors.WithStack(err)
+	}
+	b, err := json.Marshal(x)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err = json.Unmarshal(b, v); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
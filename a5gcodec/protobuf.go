@@ -0,0 +1,520 @@
+package a5gcodec
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Protobuf encodes a5gapi envelope types as described by a5gapi.proto.
+// Other types are not supported.
+var Protobuf Codec = protobufCodec{}
+
+type protobufCodec struct{}
+
+func (protobufCodec) ContentType() string { return ContentTypeProtobuf }
+
+func (protobufCodec) Marshal(v interface{}) ([]byte, error) {
+	switch x := v.(type) {
+	case *a5gapi.APIMsgRequest:
+		return marshalProtoRequest(x)
+	case *a5gapi.APIMsgResponse:
+		return marshalProtoMsg((*a5gapi.APIMsg)(x))
+	case *a5gapi.APIMsg:
+		return marshalProtoMsg(x)
+	}
+	return nil, errors.Errorf("protobuf codec does not support %T", v)
+}
+
+func (protobufCodec) Unmarshal(b []byte, v interface{}) error {
+	switch x := v.(type) {
+	case *a5gapi.APIMsgRequest:
+		return unmarshalProtoRequest(b, x)
+	case *a5gapi.APIMsgResponse:
+		return unmarshalProtoMsg(b, (*a5gapi.APIMsg)(x))
+	case *a5gapi.APIMsg:
+		return unmarshalProtoMsg(b, x)
+	}
+	return errors.Errorf("protobuf codec does not support %T", v)
+}
+
+func marshalProtoRequest(v *a5gapi.APIMsgRequest) ([]byte, error) {
+	var b []byte
+	if v.RequestID != "" {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, v.RequestID)
+	}
+	if v.Payload != nil {
+		x, err := marshalProtoDocument(v.Payload)
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, x)
+	}
+	if v.Time != 0 {
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		b = protowire.AppendVarint(b, v.Time)
+	}
+	for _, x := range v.Fields {
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendString(b, x)
+	}
+	if v.IfVersion != 0 {
+		b = protowire.AppendTag(b, 5, protowire.VarintType)
+		b = protowire.AppendVarint(b, v.IfVersion)
+	}
+	if v.IfUnmodifiedSince != 0 {
+		b = protowire.AppendTag(b, 6, protowire.VarintType)
+		b = protowire.AppendVarint(b, v.IfUnmodifiedSince)
+	}
+	if v.Page != nil {
+		b = protowire.AppendTag(b, 7, protowire.BytesType)
+		b = protowire.AppendBytes(b, marshalProtoPage(v.Page.Cursor, v.Page.Limit))
+	}
+	if v.APIVersion != 0 {
+		b = protowire.AppendTag(b, 8, protowire.VarintType)
+		b = protowire.AppendVarint(b, v.APIVersion)
+	}
+	return b, nil
+}
+
+func marshalProtoMsg(v *a5gapi.APIMsg) ([]byte, error) {
+	var b []byte
+	if v.RequestID != "" {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, v.RequestID)
+	}
+	if v.Success {
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(true))
+	}
+	for _, e := range v.Errs {
+		x, err := marshalProtoErr(e)
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendBytes(b, x)
+	}
+	if len(v.Meta) > 0 {
+		x, err := document(v.Meta)
+		if err != nil {
+			return nil, err
+		}
+		m, ok := x.(map[string]interface{})
+		if !ok {
+			return nil, errors.Errorf("meta is %T", x)
+		}
+		if b, err = appendProtoEntries(b, 4, m); err != nil {
+			return nil, err
+		}
+	}
+	if v.Payload != nil {
+		x, err := marshalProtoDocument(v.Payload)
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, 5, protowire.BytesType)
+		b = protowire.AppendBytes(b, x)
+	}
+	if v.Time != 0 {
+		b = protowire.AppendTag(b, 6, protowire.VarintType)
+		b = protowire.AppendVarint(b, v.Time)
+	}
+	if v.Page != nil {
+		x := marshalProtoPage(v.Page.Cursor, v.Page.Limit)
+		if v.Page.Total != nil {
+			x = protowire.AppendTag(x, 3, protowire.VarintType)
+			x = protowire.AppendVarint(x, uint64(*v.Page.Total))
+		}
+		if v.Page.HasMore {
+			x = protowire.AppendTag(x, 4, protowire.VarintType)
+			x = protowire.AppendVarint(x, protowire.EncodeBool(true))
+		}
+		b = protowire.AppendTag(b, 7, protowire.BytesType)
+		b = protowire.AppendBytes(b, x)
+	}
+	if v.APIVersion != 0 {
+		b = protowire.AppendTag(b, 8, protowire.VarintType)
+		b = protowire.AppendVarint(b, v.APIVersion)
+	}
+	return b, nil
+}
+
+// marshalProtoPage encodes fields Page and PageRequest share.
+func marshalProtoPage(cursor string, limit int) []byte {
+	var b []byte
+	if cursor != "" {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, cursor)
+	}
+	if limit != 0 {
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(limit))
+	}
+	return b
+}
+
+// marshalProtoDocument encodes the JSON form of v as a Value message.
+func marshalProtoDocument(v interface{}) ([]byte, error) {
+	x, err := document(v)
+	if err != nil {
+		return nil, err
+	}
+	return appendProtoValue(nil, x)
+}
+
+func appendProtoValue(b []byte, x interface{}) ([]byte, error) {
+	var err error
+	switch v := x.(type) {
+	case nil:
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(true))
+	case float64:
+		b = protowire.AppendTag(b, 2, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(v))
+	case string:
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendString(b, v)
+	case bool:
+		b = protowire.AppendTag(b, 4, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(v))
+	case map[string]interface{}:
+		var s []byte
+		if s, err = appendProtoEntries(nil, 1, v); err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, 5, protowire.BytesType)
+		b = protowire.AppendBytes(b, s)
+	case []interface{}:
+		var l []byte
+		for _, y := range v {
+			var e []byte
+			if e, err = appendProtoValue(nil, y); err != nil {
+				return nil, err
+			}
+			l = protowire.AppendTag(l, 1, protowire.BytesType)
+			l = protowire.AppendBytes(l, e)
+		}
+		b = protowire.AppendTag(b, 6, protowire.BytesType)
+		b = protowire.AppendBytes(b, l)
+	case int64:
+		b = protowire.AppendTag(b, 7, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeZigZag(v))
+	case uint64:
+		b = protowire.AppendTag(b, 8, protowire.VarintType)
+		b = protowire.AppendVarint(b, v)
+	default:
+		return nil, errors.Errorf("protobuf codec does not support %T values", x)
+	}
+	return b, nil
+}
+
+// appendProtoEntries appends m as map<string, Value> field num, in key
+// order so equal maps encode equally.
+func appendProtoEntries(
+	b []byte, num protowire.Number, m map[string]interface{}) ([]byte, error) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v, err := appendProtoValue(nil, m[k])
+		if err != nil {
+			return nil, err
+		}
+		var e []byte
+		e = protowire.AppendTag(e, 1, protowire.BytesType)
+		e = protowire.AppendString(e, k)
+		e = protowire.AppendTag(e, 2, protowire.BytesType)
+		e = protowire.AppendBytes(e, v)
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		b = protowire.AppendBytes(b, e)
+	}
+	return b, nil
+}
+
+// marshalProtoErr reuses APIErr JSON form so message and stack trace
+// rules are the same for every codec.
+func marshalProtoErr(e *a5gapi.APIErr) ([]byte, error) {
+	j, err := json.Marshal(e)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	s := &struct {
+		Code       uint64   `json:"code"`
+		Message    string   `json:"message"`
+		Field      string   `json:"field"`
+		StackTrace []string `json:"stackTrace"`
+	}{}
+	if err = json.Unmarshal(j, s); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var b []byte
+	if s.Code != 0 {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, s.Code)
+	}
+	if s.Message != "" {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendString(b, s.Message)
+	}
+	for _, x := range s.StackTrace {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendString(b, x)
+	}
+	if s.Field != "" {
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendString(b, s.Field)
+	}
+	return b, nil
+}
+
+// protoFields walks b calling fn for every varint, fixed64 and bytes
+// field; other wire types are skipped.
+func protoFields(b []byte,
+	fn func(protowire.Number, protowire.Type, uint64, []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return errors.WithStack(protowire.ParseError(n))
+		}
+		b = b[n:]
+		switch typ {
+		case protowire.VarintType:
+			x, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return errors.WithStack(protowire.ParseError(n))
+			}
+			if err := fn(num, typ, x, nil); err != nil {
+				return err
+			}
+			b = b[n:]
+		case protowire.Fixed64Type:
+			x, n := protowire.ConsumeFixed64(b)
+			if n < 0 {
+				return errors.WithStack(protowire.ParseError(n))
+			}
+			if err := fn(num, typ, x, nil); err != nil {
+				return err
+			}
+			b = b[n:]
+		case protowire.BytesType:
+			x, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return errors.WithStack(protowire.ParseError(n))
+			}
+			if err := fn(num, typ, 0, x); err != nil {
+				return err
+			}
+			b = b[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return errors.WithStack(protowire.ParseError(n))
+			}
+			b = b[n:]
+		}
+	}
+	return nil
+}
+
+func unmarshalProtoRequest(b []byte, v *a5gapi.APIMsgRequest) error {
+	return protoFields(b, func(
+		num protowire.Number, typ protowire.Type, i uint64, x []byte) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			v.RequestID = string(x)
+		case num == 2 && typ == protowire.BytesType:
+			d, err := unmarshalProtoValue(x)
+			if err != nil {
+				return err
+			}
+			return fromDocument(d, &v.Payload)
+		case num == 3 && typ == protowire.VarintType:
+			v.Time = i
+		case num == 4 && typ == protowire.BytesType:
+			v.Fields = append(v.Fields, string(x))
+		case num == 5 && typ == protowire.VarintType:
+			v.IfVersion = i
+		case num == 6 && typ == protowire.VarintType:
+			v.IfUnmodifiedSince = i
+		case num == 7 && typ == protowire.BytesType:
+			p, err := unmarshalProtoPage(x)
+			if err != nil {
+				return err
+			}
+			v.Page = &a5gapi.PageRequest{Cursor: p.Cursor, Limit: p.Limit}
+		case num == 8 && typ == protowire.VarintType:
+			v.APIVersion = i
+		}
+		return nil
+	})
+}
+
+func unmarshalProtoMsg(b []byte, v *a5gapi.APIMsg) error {
+	return protoFields(b, func(
+		num protowire.Number, typ protowire.Type, i uint64, x []byte) error {
+		var err error
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			v.RequestID = string(x)
+		case num == 2 && typ == protowire.VarintType:
+			v.Success = protowire.DecodeBool(i)
+		case num == 3 && typ == protowire.BytesType:
+			var e *a5gapi.APIErr
+			if e, err = unmarshalProtoErr(x); err != nil {
+				return err
+			}
+			v.Errs = append(v.Errs, e)
+		case num == 4 && typ == protowire.BytesType:
+			if v.Meta == nil {
+				v.Meta = a5gapi.NewKV()
+			}
+			return unmarshalProtoEntry(x, v.Meta)
+		case num == 5 && typ == protowire.BytesType:
+			var d interface{}
+			if d, err = unmarshalProtoValue(x); err != nil {
+				return err
+			}
+			return fromDocument(d, &v.Payload)
+		case num == 6 && typ == protowire.VarintType:
+			v.Time = i
+		case num == 7 && typ == protowire.BytesType:
+			v.Page, err = unmarshalProtoPage(x)
+		case num == 8 && typ == protowire.VarintType:
+			v.APIVersion = i
+		}
+		return err
+	})
+}
+
+func unmarshalProtoPage(b []byte) (*a5gapi.Page, error) {
+	p := new(a5gapi.Page)
+	err := protoFields(b, func(
+		num protowire.Number, typ protowire.Type, i uint64, x []byte) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			p.Cursor = string(x)
+		case num == 2 && typ == protowire.VarintType:
+			p.Limit = int(int64(i))
+		case num == 3 && typ == protowire.VarintType:
+			total := int64(i)
+			p.Total = &total
+		case num == 4 && typ == protowire.VarintType:
+			p.HasMore = protowire.DecodeBool(i)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// unmarshalProtoValue decodes a Value message into the document form
+// document returns; a Value without a kind is null.
+func unmarshalProtoValue(b []byte) (interface{}, error) {
+	var v interface{}
+	err := protoFields(b, func(
+		num protowire.Number, typ protowire.Type, i uint64, x []byte) error {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			v = nil
+		case num == 2 && typ == protowire.Fixed64Type:
+			v = math.Float64frombits(i)
+		case num == 3 && typ == protowire.BytesType:
+			v = string(x)
+		case num == 4 && typ == protowire.VarintType:
+			v = protowire.DecodeBool(i)
+		case num == 5 && typ == protowire.BytesType:
+			m := make(map[string]interface{})
+			if err := protoFields(x, func(
+				num protowire.Number, typ protowire.Type, _ uint64, e []byte) error {
+				if num != 1 || typ != protowire.BytesType {
+					return nil
+				}
+				return unmarshalProtoEntry(e, m)
+			}); err != nil {
+				return err
+			}
+			v = m
+		case num == 6 && typ == protowire.BytesType:
+			l := make([]interface{}, 0)
+			if err := protoFields(x, func(
+				num protowire.Number, typ protowire.Type, _ uint64, e []byte) error {
+				if num != 1 || typ != protowire.BytesType {
+					return nil
+				}
+				y, err := unmarshalProtoValue(e)
+				if err != nil {
+					return err
+				}
+				l = append(l, y)
+				return nil
+			}); err != nil {
+				return err
+			}
+			v = l
+		case num == 7 && typ == protowire.VarintType:
+			v = protowire.DecodeZigZag(i)
+		case num == 8 && typ == protowire.VarintType:
+			v = i
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// unmarshalProtoEntry decodes a map<string, Value> entry into m.
+func unmarshalProtoEntry(b []byte, m map[string]interface{}) error {
+	var (
+		k string
+		v interface{}
+	)
+	err := protoFields(b, func(
+		num protowire.Number, typ protowire.Type, _ uint64, x []byte) error {
+		var err error
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			k = string(x)
+		case num == 2 && typ == protowire.BytesType:
+			v, err = unmarshalProtoValue(x)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	m[k] = v
+	return nil
+}
+
+func unmarshalProtoErr(b []byte) (*a5gapi.APIErr, error) {
+	e := new(a5gapi.APIErr)
+	err := protoFields(b, func(
+		num protowire.Number, typ protowire.Type, i uint64, x []byte) error {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			e.Code = i
+		case num == 2 && typ == protowire.BytesType:
+			e.Err = errors.New(string(x))
+		case num == 4 && typ == protowire.BytesType:
+			e.Field = string(x)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
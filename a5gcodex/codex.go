@@ -0,0 +1,438 @@
+package a5gcodex
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+)
+
+// Reason of wallet and inventory transactions of milestone rewards.
+const Reason = "codex"
+
+var (
+	ErrMilestoneUnknown = errors.New("codex milestone unknown")
+	ErrNotReached       = errors.New("codex milestone not reached")
+)
+
+// Statuses of a milestone for a player.
+const (
+	StatusLocked  = "locked"
+	StatusReached = "reached"
+	StatusClaimed = "claimed"
+)
+
+// Event types passed to listeners.
+const (
+	EventDiscovered = "discovered"
+	EventReached    = "reached"
+	EventClaimed    = "claimed"
+)
+
+// Entry is a page of the codex, e.g. an item or a unit; its ID is the one
+// Acquire is called with.
+type Entry struct {
+	ID       string `json:"id"`
+	Category string `json:"category"`
+}
+
+// Reward is what claiming a milestone grants: wallet currencies and
+// inventory items.
+type Reward struct {
+	Currencies map[string]int64 `json:"currencies,omitempty"`
+	Items      map[string]int64 `json:"items,omitempty"`
+}
+
+// Milestone is reached once Percent of the entries of Category, or of the
+// whole codex when Category is empty, are discovered.
+type Milestone struct {
+	ID       string  `json:"id"`
+	Category string  `json:"category,omitempty"`
+	Percent  int     `json:"percent"`
+	Reward   *Reward `json:"reward,omitempty"`
+}
+
+// Config is an balance data of the codex. Entry and milestone IDs key the
+// stored progress, so they must not be reused for something else; adding
+// entries lowers percentages but never takes back claimed milestones.
+type Config struct {
+	Entries    []*Entry     `json:"entries"`
+	Milestones []*Milestone `json:"milestones,omitempty"`
+
+	categories []string
+	byID       map[string]*Entry
+	totals     map[string]int
+	milestones map[string]*Milestone
+}
+
+func NewConfig(c *Config) (*Config, error) {
+	if c == nil {
+		return nil, errors.New("nil codex config")
+	}
+	c.byID = make(map[string]*Entry, len(c.Entries))
+	c.totals = make(map[string]int)
+	c.categories = nil
+	for _, e := range c.Entries {
+		if e == nil || e.ID == "" || e.Category == "" {
+			return nil, errors.New("empty codex entry id or category")
+		}
+		if c.byID[e.ID] != nil {
+			return nil, errors.Errorf("duplicate codex entry %q", e.ID)
+		}
+		c.byID[e.ID] = e
+		if c.totals[e.Category] == 0 {
+			c.categories = append(c.categories, e.Category)
+		}
+		c.totals[e.Category]++
+	}
+	c.milestones = make(map[string]*Milestone, len(c.Milestones))
+	for _, m := range c.Milestones {
+		switch {
+		case m == nil || m.ID == "":
+			return nil, errors.New("empty codex milestone id")
+		case c.milestones[m.ID] != nil:
+			return nil, errors.Errorf("duplicate codex milestone %q", m.ID)
+		case m.Category != "" && c.totals[m.Category] == 0:
+			return nil, errors.Errorf(
+				"codex milestone %q has unknown category %q", m.ID, m.Category)
+		case m.Percent <= 0 || m.Percent > 100:
+			return nil, errors.Errorf(
+				"codex milestone %q percent out of range", m.ID)
+		}
+		c.milestones[m.ID] = m
+	}
+	return c, nil
+}
+
+func NewConfigJSON(b []byte) (*Config, error) {
+	c := new(Config)
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return NewConfig(c)
+}
+
+// Progress is the codex of a player: first acquisition times of entries
+// and claimed milestones, in unix seconds.
+type Progress struct {
+	Entries    map[string]int64 `json:"entries"`
+	Milestones map[string]int64 `json:"milestones"`
+}
+
+// Store keeps codex progress. Discover records entries not recorded yet
+// and returns them, so each entry is discovered once. Claim records a
+// milestone claim reporting whether it was not claimed before, Unclaim
+// reverts it.
+type Store interface {
+	Get(accountID uint64) (*Progress, error)
+	Discover(accountID uint64, entryIDs []string, at time.Time) ([]string, error)
+	Claim(accountID uint64, milestoneID string, at time.Time) (bool, error)
+	Unclaim(accountID uint64, milestoneID string) error
+}
+
+// Event is passed to listeners, e.g. analytics. EntryID is set for
+// discoveries, MilestoneID for the others.
+type Event struct {
+	Type        string `json:"type"`
+	EntryID     string `json:"entryId,omitempty"`
+	MilestoneID string `json:"milestoneId,omitempty"`
+	At          int64  `json:"at"`
+}
+
+type EventFunc func(ctx context.Context, accountID uint64, e *Event)
+
+// Codex tracks first-time acquisitions other modules report, e.g.
+//
+//	codex.AcquireChanges(ctx, accountID, changes)
+//
+// after an inventory transaction, and grants rewards of reached
+// milestones on claim.
+type Codex struct {
+	Config    *Config
+	Store     Store
+	Wallet    *a5gwallet.Wallet
+	Inventory *a5ginventory.Inventory
+	Logger    a5glogs.Logger
+
+	listeners []EventFunc
+	now       func() time.Time
+}
+
+func NewCodex(
+	c *Config, s Store, l a5glogs.Logger, listeners ...EventFunc) (*Codex, error) {
+	if c == nil {
+		return nil, errors.New("nil codex config")
+	}
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Codex{
+		Config:    c,
+		Store:     s,
+		Logger:    l,
+		listeners: listeners,
+		now:       time.Now}, nil
+}
+
+// Acquire records entries a player got, ignoring IDs which are not codex
+// entries, and returns the ones discovered for the first time.
+func (x *Codex) Acquire(
+	ctx context.Context, accountID uint64, ids ...string) ([]string, error) {
+	var known []string
+	for _, id := range ids {
+		if x.Config.byID[id] != nil {
+			known = append(known, id)
+		}
+	}
+	if len(known) == 0 {
+		return nil, nil
+	}
+	p, err := x.Store.Get(accountID)
+	if err != nil {
+		return nil, err
+	}
+	before := x.reached(p)
+	discovered, err := x.Store.Discover(accountID, known, x.now().UTC())
+	if err != nil || len(discovered) == 0 {
+		return discovered, err
+	}
+	for _, id := range discovered {
+		x.emit(ctx, accountID, &Event{Type: EventDiscovered, EntryID: id})
+		p.Entries[id] = x.now().Unix()
+	}
+	// Milestones are walked in config order, so are their events.
+	after := x.reached(p)
+	for _, y := range x.Config.Milestones {
+		if after[y.ID] && !before[y.ID] {
+			x.emit(ctx, accountID, &Event{Type: EventReached, MilestoneID: y.ID})
+		}
+	}
+	return discovered, nil
+}
+
+// AcquireChanges acquires items granted by inventory changes.
+func (x *Codex) AcquireChanges(
+	ctx context.Context, accountID uint64, c *a5ginventory.Changes) (
+	[]string, error) {
+	if c == nil {
+		return nil, nil
+	}
+	var ids []string
+	for _, d := range c.Changes {
+		if d.Delta > 0 {
+			ids = append(ids, d.ItemID)
+		}
+	}
+	for _, s := range c.Overflow {
+		ids = append(ids, s.ItemID)
+	}
+	return x.Acquire(ctx, accountID, ids...)
+}
+
+// reached returns milestones reached by the progress, claimed or not.
+func (x *Codex) reached(p *Progress) map[string]bool {
+	counts := x.counts(p)
+	m := make(map[string]bool)
+	for _, y := range x.Config.Milestones {
+		if percent(counts, x.Config.totals, y.Category) >= y.Percent {
+			m[y.ID] = true
+		}
+	}
+	return m
+}
+
+// counts returns discovered entries per category, the whole codex under
+// the empty category.
+func (x *Codex) counts(p *Progress) map[string]int {
+	m := make(map[string]int)
+	for id := range p.Entries {
+		if e := x.Config.byID[id]; e != nil {
+			m[e.Category]++
+			m[""]++
+		}
+	}
+	return m
+}
+
+func percent(counts, totals map[string]int, category string) int {
+	total := totals[category]
+	if category == "" {
+		total = 0
+		for _, n := range totals {
+			total += n
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return counts[category] * 100 / total
+}
+
+// CategoryView is the completion of a category.
+type CategoryView struct {
+	Category   string `json:"category"`
+	Discovered int    `json:"discovered"`
+	Total      int    `json:"total"`
+	Percent    int    `json:"percent"`
+}
+
+// MilestoneView is a milestone of the player for the client UI.
+type MilestoneView struct {
+	ID       string  `json:"id"`
+	Category string  `json:"category,omitempty"`
+	Percent  int     `json:"percent"`
+	Status   string  `json:"status"`
+	Reward   *Reward `json:"reward,omitempty"`
+}
+
+// View is the codex of a player. Entries are discovered entry IDs with
+// first acquisition times, Percent is the completion of the whole codex.
+type View struct {
+	Entries    map[string]int64 `json:"entries"`
+	Categories []*CategoryView  `json:"categories"`
+	Milestones []*MilestoneView `json:"milestones"`
+	Percent    int              `json:"percent"`
+}
+
+// View returns the codex of a player, categories in config order.
+func (x *Codex) View(accountID uint64) (*View, error) {
+	p, err := x.Store.Get(accountID)
+	if err != nil {
+		return nil, err
+	}
+	counts := x.counts(p)
+	v := &View{
+		Entries:    make(map[string]int64, len(p.Entries)),
+		Categories: make([]*CategoryView, 0, len(x.Config.categories)),
+		Milestones: make([]*MilestoneView, 0, len(x.Config.Milestones)),
+		Percent:    percent(counts, x.Config.totals, "")}
+	for id, at := range p.Entries {
+		if x.Config.byID[id] != nil {
+			v.Entries[id] = at
+		}
+	}
+	for _, c := range x.Config.categories {
+		v.Categories = append(v.Categories, &CategoryView{
+			Category:   c,
+			Discovered: counts[c],
+			Total:      x.Config.totals[c],
+			Percent:    percent(counts, x.Config.totals, c)})
+	}
+	reached := x.reached(p)
+	for _, y := range x.Config.Milestones {
+		m := &MilestoneView{
+			ID:       y.ID,
+			Category: y.Category,
+			Percent:  y.Percent,
+			Status:   StatusLocked,
+			Reward:   y.Reward}
+		if _, ok := p.Milestones[y.ID]; ok {
+			m.Status = StatusClaimed
+		} else if reached[y.ID] {
+			m.Status = StatusReached
+		}
+		v.Milestones = append(v.Milestones, m)
+	}
+	return v, nil
+}
+
+// ClaimResult is the payload of a claim. A repeated claim is Replayed:
+// nothing is granted again.
+type ClaimResult struct {
+	MilestoneID string                `json:"milestoneId"`
+	Reward      *Reward               `json:"reward,omitempty"`
+	Wallet      *a5gwallet.Result     `json:"wallet,omitempty"`
+	Inventory   *a5ginventory.Changes `json:"inventory,omitempty"`
+	Replayed    bool                  `json:"replayed,omitempty"`
+}
+
+// Claim grants the reward of a reached milestone. A failed grant reverts
+// the claim so the player may retry: wallet transactions are idempotent
+// by the milestone and inventory ones are atomic.
+func (x *Codex) Claim(
+	ctx context.Context, accountID uint64, milestoneID string) (*ClaimResult, error) {
+	y, ok := x.Config.milestones[milestoneID]
+	if !ok {
+		return nil, errors.Wrap(ErrMilestoneUnknown, milestoneID)
+	}
+	p, err := x.Store.Get(accountID)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := p.Milestones[milestoneID]; ok {
+		return &ClaimResult{MilestoneID: milestoneID, Replayed: true}, nil
+	}
+	if !x.reached(p)[milestoneID] {
+		return nil, errors.Wrap(ErrNotReached, milestoneID)
+	}
+	ok, err = x.Store.Claim(accountID, milestoneID, x.now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return &ClaimResult{MilestoneID: milestoneID, Replayed: true}, nil
+	}
+	res, err := x.grant(accountID, y)
+	if err != nil {
+		if err := x.Store.Unclaim(accountID, milestoneID); err != nil {
+			x.Logger.Error(err.Error())
+		}
+		return nil, err
+	}
+	res.MilestoneID = milestoneID
+	res.Reward = y.Reward
+	x.emit(ctx, accountID, &Event{Type: EventClaimed, MilestoneID: milestoneID})
+	return res, nil
+}
+
+func (x *Codex) grant(accountID uint64, y *Milestone) (*ClaimResult, error) {
+	res := new(ClaimResult)
+	if y.Reward == nil {
+		return res, nil
+	}
+	ref := strconv.FormatUint(accountID, 10) + ":" + y.ID
+	if len(y.Reward.Currencies) > 0 {
+		if x.Wallet == nil {
+			return nil, errors.New("wallet missing")
+		}
+		t := a5gwallet.NewTx("codex:"+ref, Reason, Reason)
+		for c, n := range y.Reward.Currencies {
+			t.Credit(c, n)
+		}
+		z, err := x.Wallet.Apply(accountID, t)
+		if err != nil {
+			return nil, err
+		}
+		res.Wallet = z
+	}
+	if len(y.Reward.Items) > 0 {
+		if x.Inventory == nil {
+			return nil, errors.New("inventory missing")
+		}
+		t := a5ginventory.NewTx(Reason, ref).MailOverflow()
+		for id, n := range y.Reward.Items {
+			t.Grant(id, n)
+		}
+		z, err := x.Inventory.Apply(accountID, t)
+		if err != nil {
+			return nil, err
+		}
+		res.Inventory = z
+	}
+	return res, nil
+}
+
+func (x *Codex) emit(ctx context.Context, accountID uint64, e *Event) {
+	e.At = x.now().Unix()
+	for _, fn := range x.listeners {
+		fn(ctx, accountID, e)
+	}
+}
@@ -0,0 +1,106 @@
+package a5gcodex
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestCodex(t *testing.T) {
+	c, err := NewConfigJSON([]byte(`{
+		"entries": [
+			{"id": "sword", "category": "weapons"},
+			{"id": "axe", "category": "weapons"},
+			{"id": "knight", "category": "units"},
+			{"id": "archer", "category": "units"}],
+		"milestones": [
+			{"id": "armory", "category": "weapons", "percent": 100,
+				"reward": {"currencies": {"soft": 10}}},
+			{"id": "half", "percent": 50}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []string
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	x, err := NewCodex(c, NewMemoryStore(), l,
+		func(ctx context.Context, accountID uint64, e *Event) {
+			events = append(events, e.Type+":"+e.EntryID+e.MilestoneID)
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	currencies, _ := a5gwallet.NewCurrencies(a5gwallet.Currency{ID: "soft"})
+	x.Wallet, _ = a5gwallet.NewWallet(a5gwallet.NewMemoryStore(), currencies, l)
+
+	ctx := context.Background()
+	tests := []struct {
+		name       string
+		changes    *a5ginventory.Changes
+		discovered int
+		claim      string
+		err        error
+		replayed   bool
+		percents   string
+		statuses   string
+	}{
+		{"claim unknown", nil, 0, "hoard", ErrMilestoneUnknown, false,
+			"0 0 0", "locked locked"},
+		{"first", &a5ginventory.Changes{Changes: []*a5ginventory.Delta{
+			{ItemID: "sword", Delta: 1}, {ItemID: "potion", Delta: 5}}},
+			1, "armory", ErrNotReached, false, "50 0 25", "locked locked"},
+		{"consumed", &a5ginventory.Changes{Changes: []*a5ginventory.Delta{
+			{ItemID: "axe", Delta: -1}}},
+			0, "", nil, false, "50 0 25", "locked locked"},
+		{"mailed", &a5ginventory.Changes{
+			Changes:  []*a5ginventory.Delta{{ItemID: "sword", Delta: 1}},
+			Overflow: []*a5ginventory.Stack{{ItemID: "axe", Quantity: 1}}},
+			1, "armory", nil, false, "100 0 50", "claimed reached"},
+		{"claim again", nil, 0, "armory", nil, true,
+			"100 0 50", "claimed reached"},
+	}
+	for _, test := range tests {
+		discovered, err := x.AcquireChanges(ctx, 1, test.changes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(discovered) != test.discovered {
+			t.Errorf("%s: unexpected discoveries %v", test.name, discovered)
+		}
+		if test.claim != "" {
+			res, err := x.Claim(ctx, 1, test.claim)
+			if errors.Cause(err) != test.err {
+				t.Fatalf("%s: unexpected error %v", test.name, err)
+			}
+			if res != nil && res.Replayed != test.replayed {
+				t.Errorf("%s: expected replayed %v", test.name, test.replayed)
+			}
+		}
+		v, err := x.View(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		percents := fmt.Sprintf("%d %d %d",
+			v.Categories[0].Percent, v.Categories[1].Percent, v.Percent)
+		statuses := v.Milestones[0].Status + " " + v.Milestones[1].Status
+		if percents != test.percents || statuses != test.statuses {
+			t.Errorf("%s: unexpected percents %q, statuses %q",
+				test.name, percents, statuses)
+		}
+	}
+	balances, _ := x.Wallet.Balances(1)
+	if len(balances) != 1 || balances[0].Balance != 10 {
+		t.Errorf("unexpected balances %+v", balances)
+	}
+	expected := "discovered:sword discovered:axe reached:armory " +
+		"reached:half claimed:armory"
+	if s := strings.Join(events, " "); s != expected {
+		t.Errorf("unexpected events %q", s)
+	}
+}
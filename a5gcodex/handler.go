@@ -0,0 +1,96 @@
+package a5gcodex
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCodeMilestoneUnknown = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4050,
+		Name:     "codex_milestone_unknown",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "codex milestone not found"})
+
+	ErrCodeNotReached = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4235,
+		Name:     "codex_milestone_not_reached",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "codex milestone is not reached"})
+)
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeMilestoneUnknown, http.StatusNotFound)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeNotReached, http.StatusUnprocessableEntity)
+}
+
+type ClaimRequest struct {
+	MilestoneID string `json:"milestoneId" validate:"required"`
+}
+
+// ViewHandler answers with the codex View of the a5gsession authenticated
+// player.
+func (x *Codex) ViewHandler() a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		sess, ok := a5gsession.FromContext(ctx)
+		if !ok {
+			return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+		}
+		v, err := x.View(sess.AccountID)
+		if err != nil {
+			return nil, x.apiErrs(err)
+		}
+		return v, nil
+	}
+}
+
+// ClaimHandler claims a reached milestone of the a5gsession authenticated
+// player and answers with the ClaimResult.
+func (x *Codex) ClaimHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(ClaimRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			sess, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			p := req.Payload.(*ClaimRequest)
+			res, err := x.Claim(ctx, sess.AccountID, p.MilestoneID)
+			if err != nil {
+				return nil, x.apiErrs(err)
+			}
+			return res, nil
+		})
+}
+
+func (x *Codex) apiErrs(err error) []*a5gapi.APIErr {
+	var c a5gapi.APIErrCode
+	switch errors.Cause(err) {
+	case ErrMilestoneUnknown:
+		c = ErrCodeMilestoneUnknown
+	case ErrNotReached:
+		c = ErrCodeNotReached
+	case a5gwallet.ErrBalanceCapExceeded:
+		return x.Wallet.APIErrs(err)
+	case a5ginventory.ErrCapExceeded, a5ginventory.ErrTabFull:
+		return x.Inventory.APIErrs(err)
+	default:
+		x.Logger.Error(err.Error())
+		return a5gapi.NewJSONMsgDefautlErrors(err)
+	}
+	return []*a5gapi.APIErr{a5gapi.NewErr(c, "")}
+}
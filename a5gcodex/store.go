@@ -0,0 +1,193 @@
+package a5gcodex
+
+import (
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryStore struct {
+	mu       sync.Mutex
+	progress map[uint64]*Progress
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{progress: make(map[uint64]*Progress)}
+}
+
+func (s *memoryStore) player(accountID uint64) *Progress {
+	p, ok := s.progress[accountID]
+	if !ok {
+		p = &Progress{
+			Entries:    make(map[string]int64),
+			Milestones: make(map[string]int64)}
+		s.progress[accountID] = p
+	}
+	return p
+}
+
+func (s *memoryStore) Get(accountID uint64) (*Progress, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.player(accountID)
+	x := &Progress{
+		Entries:    make(map[string]int64, len(p.Entries)),
+		Milestones: make(map[string]int64, len(p.Milestones))}
+	for k, v := range p.Entries {
+		x.Entries[k] = v
+	}
+	for k, v := range p.Milestones {
+		x.Milestones[k] = v
+	}
+	return x, nil
+}
+
+func (s *memoryStore) Discover(
+	accountID uint64, entryIDs []string, at time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.player(accountID)
+	var a []string
+	for _, id := range entryIDs {
+		if _, ok := p.Entries[id]; !ok {
+			p.Entries[id] = at.Unix()
+			a = append(a, id)
+		}
+	}
+	return a, nil
+}
+
+func (s *memoryStore) Claim(
+	accountID uint64, milestoneID string, at time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.player(accountID)
+	if _, ok := p.Milestones[milestoneID]; ok {
+		return false, nil
+	}
+	p.Milestones[milestoneID] = at.Unix()
+	return true, nil
+}
+
+func (s *memoryStore) Unclaim(accountID uint64, milestoneID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.player(accountID).Milestones, milestoneID)
+	return nil
+}
+
+// dbStore keeps codex progress in MySQL tables, a row per discovered entry
+// and per claimed milestone:
+//
+//	CREATE TABLE codex_entries (
+//	  account_id BIGINT UNSIGNED NOT NULL,
+//	  entry_id VARCHAR(64) NOT NULL,
+//	  acquired_at DATETIME NOT NULL,
+//	  PRIMARY KEY (account_id, entry_id));
+//
+//	CREATE TABLE codex_milestones (
+//	  account_id BIGINT UNSIGNED NOT NULL,
+//	  milestone_id VARCHAR(64) NOT NULL,
+//	  claimed_at DATETIME NOT NULL,
+//	  PRIMARY KEY (account_id, milestone_id));
+type dbStore struct {
+	pooler          a5gdb.Pooler
+	entriesTable    string
+	milestonesTable string
+}
+
+type dbRow struct {
+	ID string    `db:"id"`
+	At time.Time `db:"at"`
+}
+
+func NewDBStore(p a5gdb.Pooler, entriesTable, milestonesTable string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if entriesTable == "" || milestonesTable == "" {
+		return nil, errors.New("empty codex table name")
+	}
+	return &dbStore{
+		pooler:          p,
+		entriesTable:    entriesTable,
+		milestonesTable: milestonesTable}, nil
+}
+
+func (s *dbStore) Get(accountID uint64) (*Progress, error) {
+	sess := s.pooler.ReadPool().NewSession()
+	var entries, milestones []*dbRow
+	_, err := sess.Select("entry_id AS id", "acquired_at AS at").
+		From(s.entriesTable).
+		Where(dbr.Eq("account_id", accountID)).Load(&entries)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	_, err = sess.Select("milestone_id AS id", "claimed_at AS at").
+		From(s.milestonesTable).
+		Where(dbr.Eq("account_id", accountID)).Load(&milestones)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	p := &Progress{
+		Entries:    make(map[string]int64, len(entries)),
+		Milestones: make(map[string]int64, len(milestones))}
+	for _, x := range entries {
+		p.Entries[x.ID] = x.At.Unix()
+	}
+	for _, x := range milestones {
+		p.Milestones[x.ID] = x.At.Unix()
+	}
+	return p, nil
+}
+
+func (s *dbStore) Discover(
+	accountID uint64, entryIDs []string, at time.Time) ([]string, error) {
+	sess := s.pooler.WritePool().NewSession()
+	var a []string
+	for _, id := range entryIDs {
+		ok, err := insert(sess, s.entriesTable, "entry_id", "acquired_at",
+			accountID, id, at)
+		if err != nil {
+			return a, err
+		}
+		if ok {
+			a = append(a, id)
+		}
+	}
+	return a, nil
+}
+
+func (s *dbStore) Claim(
+	accountID uint64, milestoneID string, at time.Time) (bool, error) {
+	return insert(s.pooler.WritePool().NewSession(), s.milestonesTable,
+		"milestone_id", "claimed_at", accountID, milestoneID, at)
+}
+
+func (s *dbStore) Unclaim(accountID uint64, milestoneID string) error {
+	_, err := s.pooler.WritePool().NewSession().
+		DeleteFrom(s.milestonesTable).
+		Where(dbr.Eq("account_id", accountID)).
+		Where(dbr.Eq("milestone_id", milestoneID)).Exec()
+	return errors.Wrap(err, "dbr.(*DeleteStmt).Exec fn")
+}
+
+// insert reports whether the row was not there before.
+func insert(
+	sess *dbr.Session, table, idColumn, atColumn string, accountID uint64,
+	id string, at time.Time) (bool, error) {
+	res, err := sess.InsertBySql("INSERT IGNORE INTO "+table+
+		" (account_id, "+idColumn+", "+atColumn+") VALUES (?, ?, ?)",
+		accountID, id, at).Exec()
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	return n == 1, nil
+}
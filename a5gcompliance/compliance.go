@@ -0,0 +1,317 @@
+package a5gcompliance
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrUnverified      = errors.New("real-name verification required")
+	ErrIdentityInvalid = errors.New("real-name identity invalid")
+	ErrCurfew          = errors.New("minor play-time curfew")
+	ErrSpendCap        = errors.New("minor spend cap reached")
+	ErrPoolUnknown     = errors.New("gacha pool unknown")
+)
+
+// Curfew limits minors, players younger than MaxAge, to play From till
+// To, "15:04" in Location, on Days and Holidays ("2006-01-02" dates).
+type Curfew struct {
+	Location string         `json:"location"`
+	MaxAge   int            `json:"maxAge"`
+	Days     []time.Weekday `json:"days"`
+	Holidays []string       `json:"holidays"`
+	From     string         `json:"from"`
+	To       string         `json:"to"`
+
+	loc      *time.Location
+	from, to int
+}
+
+// SpendCap limits spending of players aged MinAge to MaxAge exclusive,
+// amounts are in minor currency units; zero caps forbid spending.
+type SpendCap struct {
+	MinAge      int   `json:"minAge"`
+	MaxAge      int   `json:"maxAge"`
+	PerPurchase int64 `json:"perPurchase"`
+	PerMonth    int64 `json:"perMonth"`
+}
+
+// Rules are the compliance rules of a region, zero Rules require nothing.
+type Rules struct {
+	RealName   bool        `json:"realName"`
+	Curfew     *Curfew     `json:"curfew"`
+	SpendCaps  []*SpendCap `json:"spendCaps"`
+	Disclosure bool        `json:"disclosure"`
+}
+
+// Odds is the disclosed probability of an item of a gacha pool.
+type Odds struct {
+	Item        string  `json:"item"`
+	Rarity      string  `json:"rarity"`
+	Probability float64 `json:"probability"`
+}
+
+// Config toggles Rules per player region and lists gacha Pools to
+// disclose.
+type Config struct {
+	Regions map[string]*Rules  `json:"regions"`
+	Pools   map[string][]*Odds `json:"pools"`
+}
+
+// Identity is the outcome of a real-name verification. The ID number is
+// never kept, only the birth date ("2006-01-02") derived from it.
+type Identity struct {
+	AccountID  uint64 `json:"accountId" db:"account_id"`
+	Verified   bool   `json:"verified" db:"verified"`
+	BirthDate  string `json:"birthDate" db:"birth_date"`
+	VerifiedAt int64  `json:"verifiedAt" db:"verified_at"`
+}
+
+// Verifier is the hook to a real-name verification service, it returns
+// ErrIdentityInvalid for names not matching the ID number.
+type Verifier interface {
+	Verify(ctx context.Context, name, idNumber string) (*Identity, error)
+}
+
+// Store keeps identities and monthly spending. AddSpend adds amount to
+// the spending of month unless the sum goes over limit and reports false
+// then.
+type Store interface {
+	Identity(accountID uint64) (*Identity, error)
+	SetIdentity(x *Identity) error
+	AddSpend(accountID uint64, month string, amount, limit int64) (bool, error)
+}
+
+// RegionFunc returns the region of a player.
+type RegionFunc func(ctx context.Context, accountID uint64) (string, error)
+
+// Compliance enforces regional rules: real-name verification, minor
+// curfews and spend caps, and gacha odds disclosure.
+type Compliance struct {
+	Store    Store
+	Verifier Verifier
+	Region   RegionFunc
+	Logger   a5glogs.Logger
+
+	config *Config
+	now    func() time.Time
+}
+
+func NewCompliance(
+	c *Config, s Store, v Verifier, fn RegionFunc, l a5glogs.Logger) (*Compliance, error) {
+	switch {
+	case c == nil:
+		return nil, errors.New("config missing")
+	case s == nil:
+		return nil, errors.New("store missing")
+	case v == nil:
+		return nil, errors.New("verifier missing")
+	case fn == nil:
+		return nil, errors.New("region func missing")
+	case l == nil:
+		return nil, errors.New("logger missing")
+	}
+	for region, r := range c.Regions {
+		if r == nil || r.Curfew == nil {
+			continue
+		}
+		if err := r.Curfew.parse(); err != nil {
+			return nil, errors.Wrapf(err, "region %q", region)
+		}
+	}
+	for pool, a := range c.Pools {
+		var sum float64
+		for _, o := range a {
+			if o.Probability <= 0 {
+				return nil, errors.Errorf("pool %q: item %q probability", pool, o.Item)
+			}
+			sum += o.Probability
+		}
+		if math.Abs(sum-1) > 1e-9 {
+			return nil, errors.Errorf("pool %q: probabilities sum to %g", pool, sum)
+		}
+	}
+	return &Compliance{
+		Store:    s,
+		Verifier: v,
+		Region:   fn,
+		Logger:   l,
+		config:   c,
+		now:      time.Now}, nil
+}
+
+func (c *Curfew) parse() error {
+	loc, err := time.LoadLocation(c.Location)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	c.loc = loc
+	for _, x := range []struct {
+		s string
+		m *int
+	}{{c.From, &c.from}, {c.To, &c.to}} {
+		t, err := time.Parse("15:04", x.s)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		*x.m = t.Hour()*60 + t.Minute()
+	}
+	if c.from >= c.to {
+		return errors.Errorf("curfew from %s is not before %s", c.From, c.To)
+	}
+	return nil
+}
+
+// allows reports whether a minor may play at t.
+func (c *Curfew) allows(t time.Time) bool {
+	t = t.In(c.loc)
+	if m := t.Hour()*60 + t.Minute(); m < c.from || m >= c.to {
+		return false
+	}
+	for _, d := range c.Days {
+		if t.Weekday() == d {
+			return true
+		}
+	}
+	day := t.Format("2006-01-02")
+	for _, h := range c.Holidays {
+		if h == day {
+			return true
+		}
+	}
+	return false
+}
+
+// Rules returns rules of a region, zero Rules for unlisted regions.
+func (c *Compliance) Rules(region string) *Rules {
+	if r := c.config.Regions[region]; r != nil {
+		return r
+	}
+	return &Rules{}
+}
+
+func (c *Compliance) rules(ctx context.Context, accountID uint64) (*Rules, error) {
+	region, err := c.Region(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	return c.Rules(region), nil
+}
+
+// Verify verifies the real name of a player through the Verifier and
+// keeps the outcome.
+func (c *Compliance) Verify(
+	ctx context.Context, accountID uint64, name, idNumber string) (*Identity, error) {
+	x, err := c.Verifier.Verify(ctx, name, idNumber)
+	if err != nil {
+		return nil, err
+	}
+	if !x.Verified {
+		return nil, ErrIdentityInvalid
+	}
+	if _, err = time.Parse("2006-01-02", x.BirthDate); err != nil {
+		return nil, errors.Wrapf(ErrIdentityInvalid, "birth date %q", x.BirthDate)
+	}
+	x.AccountID = accountID
+	x.VerifiedAt = c.now().Unix()
+	if err = c.Store.SetIdentity(x); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// age returns the age of a verified player at now, -1 when the region
+// does not require verification and the player did not verify.
+func (c *Compliance) age(accountID uint64, r *Rules) (int, error) {
+	x, err := c.Store.Identity(accountID)
+	if err != nil {
+		return 0, err
+	}
+	if x == nil || !x.Verified {
+		if r.RealName {
+			return 0, ErrUnverified
+		}
+		return -1, nil
+	}
+	b, err := time.Parse("2006-01-02", x.BirthDate)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	now := c.now().UTC()
+	age := now.Year() - b.Year()
+	if now.Month() < b.Month() || now.Month() == b.Month() && now.Day() < b.Day() {
+		age--
+	}
+	return age, nil
+}
+
+// CheckPlay returns ErrUnverified or ErrCurfew when a player may not play
+// now.
+func (c *Compliance) CheckPlay(ctx context.Context, accountID uint64) error {
+	r, err := c.rules(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	if !r.RealName && r.Curfew == nil {
+		return nil
+	}
+	age, err := c.age(accountID, r)
+	if err != nil {
+		return err
+	}
+	if r.Curfew != nil && age >= 0 && age < r.Curfew.MaxAge && !r.Curfew.allows(c.now()) {
+		return errors.Wrapf(ErrCurfew, "account %d", accountID)
+	}
+	return nil
+}
+
+// Spend records a purchase of amount minor units against the spend cap of
+// a player, returning ErrSpendCap when it is over. Call it before
+// charging and only once per purchase.
+func (c *Compliance) Spend(ctx context.Context, accountID uint64, amount int64) error {
+	if amount <= 0 {
+		return nil
+	}
+	r, err := c.rules(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	if !r.RealName && len(r.SpendCaps) == 0 {
+		return nil
+	}
+	age, err := c.age(accountID, r)
+	if err != nil || age < 0 {
+		return err
+	}
+	for _, x := range r.SpendCaps {
+		if age < x.MinAge || age >= x.MaxAge {
+			continue
+		}
+		if amount > x.PerPurchase {
+			return errors.Wrapf(ErrSpendCap, "%d over %d per purchase", amount, x.PerPurchase)
+		}
+		month := c.now().UTC().Format("2006-01")
+		ok, err := c.Store.AddSpend(accountID, month, amount, x.PerMonth)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.Wrapf(ErrSpendCap, "%d per month", x.PerMonth)
+		}
+		return nil
+	}
+	return nil
+}
+
+// Disclose returns the odds of a gacha pool for a region disclosing them.
+func (c *Compliance) Disclose(region, pool string) ([]*Odds, error) {
+	a, ok := c.config.Pools[pool]
+	if !ok || !c.Rules(region).Disclosure {
+		return nil, errors.Wrap(ErrPoolUnknown, pool)
+	}
+	return a, nil
+}
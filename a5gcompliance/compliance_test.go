@@ -0,0 +1,117 @@
+package a5gcompliance
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+type testVerifier map[string]string
+
+func (v testVerifier) Verify(ctx context.Context, name, idNumber string) (*Identity, error) {
+	if v[name] != idNumber {
+		return nil, ErrIdentityInvalid
+	}
+	// Birth dates are in ID numbers after a 6-digit area code.
+	b, err := time.Parse("20060102", idNumber[6:14])
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{Verified: true, BirthDate: b.Format("2006-01-02")}, nil
+}
+
+func TestCompliance(t *testing.T) {
+	regions := map[uint64]string{1: "cn", 2: "cn", 3: "cn", 4: "us"}
+	ids := testVerifier{
+		"adult": "110101199001011234",
+		"teen":  "110101200601011234",
+		"kid":   "110101201501011234"}
+	c, err := NewCompliance(&Config{
+		Regions: map[string]*Rules{"cn": {
+			RealName: true,
+			Curfew: &Curfew{Location: "Asia/Shanghai", MaxAge: 18,
+				Days:     []time.Weekday{time.Friday, time.Saturday, time.Sunday},
+				Holidays: []string{"2020-10-01"}, From: "20:00", To: "21:00"},
+			SpendCaps: []*SpendCap{
+				{MinAge: 0, MaxAge: 8},
+				{MinAge: 8, MaxAge: 16, PerPurchase: 5000, PerMonth: 20000},
+				{MinAge: 16, MaxAge: 18, PerPurchase: 10000, PerMonth: 40000}},
+			Disclosure: true}},
+		Pools: map[string][]*Odds{"standard": {
+			{Item: "sword", Rarity: "legendary", Probability: 0.01},
+			{Item: "shield", Rarity: "common", Probability: 0.99}}},
+	}, NewMemoryStore(), ids, func(ctx context.Context, accountID uint64) (string, error) {
+		return regions[accountID], nil
+	}, a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Tuesday 2020-09-29 20:30 in Shanghai, Thursday is a holiday.
+	now := time.Date(2020, 9, 29, 20, 30, 0, 0, c.config.Regions["cn"].Curfew.loc)
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if err = c.CheckPlay(ctx, 1); errors.Cause(err) != ErrUnverified {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err = c.Verify(ctx, 1, "adult", "110101199001019999"); errors.Cause(err) != ErrIdentityInvalid {
+		t.Errorf("unexpected error %v", err)
+	}
+	for id, name := range map[uint64]string{1: "adult", 2: "teen", 3: "kid"} {
+		if _, err = c.Verify(ctx, id, name, ids[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plays := []struct {
+		at        time.Time
+		accountID uint64
+		err       error
+	}{
+		{now, 1, nil},
+		{now, 2, ErrCurfew},
+		{now, 4, nil},
+		{now.Add(3 * 24 * time.Hour), 2, nil},
+		{now.Add(3*24*time.Hour + time.Hour), 2, ErrCurfew},
+		{now.Add(24 * time.Hour), 2, ErrCurfew},
+		{time.Date(2020, 10, 1, 20, 0, 0, 0, now.Location()), 2, nil},
+	}
+	for i, test := range plays {
+		now = test.at
+		if err = c.CheckPlay(ctx, test.accountID); errors.Cause(err) != test.err {
+			t.Errorf("%d: unexpected error %v", i, err)
+		}
+	}
+
+	spends := []struct {
+		accountID uint64
+		amount    int64
+		err       error
+	}{
+		{1, 1000000, nil},
+		{2, 5001, ErrSpendCap},
+		{2, 5000, nil},
+		{2, 5000, nil},
+		{2, 5000, nil},
+		{2, 5000, nil},
+		{2, 1, ErrSpendCap},
+		{3, 1, ErrSpendCap},
+		{4, 1000000, nil},
+	}
+	for i, test := range spends {
+		if err = c.Spend(ctx, test.accountID, test.amount); errors.Cause(err) != test.err {
+			t.Errorf("%d: unexpected error %v", i, err)
+		}
+	}
+
+	if a, err := c.Disclose("cn", "standard"); err != nil || len(a) != 2 {
+		t.Errorf("unexpected odds %v %v", a, err)
+	}
+	if _, err = c.Disclose("us", "standard"); errors.Cause(err) != ErrPoolUnknown {
+		t.Errorf("unexpected error %v", err)
+	}
+}
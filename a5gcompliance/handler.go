@@ -0,0 +1,171 @@
+package a5gcompliance
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCodePoolUnknown = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4069,
+		Name:     "gacha_pool_unknown",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "gacha pool not found"})
+
+	ErrCodeUnverified = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4279,
+		Name:     "real_name_unverified",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "real-name verification required"})
+
+	ErrCodeCurfew = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4280,
+		Name:     "minor_curfew",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "play time for minors is over"})
+
+	ErrCodeSpendCap = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4281,
+		Name:     "minor_spend_cap",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "spend cap for minors reached"})
+
+	ErrCodeIdentityInvalid = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4282,
+		Name:     "real_name_invalid",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "name does not match the ID number"})
+)
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodePoolUnknown, http.StatusNotFound)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeUnverified, http.StatusForbidden)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeCurfew, http.StatusForbidden)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeSpendCap, http.StatusForbidden)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeIdentityInvalid, http.StatusUnprocessableEntity)
+}
+
+type VerifyRequest struct {
+	Name     string `json:"name" validate:"required,max=64"`
+	IDNumber string `json:"idNumber" validate:"required,max=32"`
+}
+
+type DisclosureRequest struct {
+	Pool string `json:"pool" validate:"required,max=64"`
+}
+
+// Status is the compliance state of a player.
+type Status struct {
+	Region   string    `json:"region"`
+	Rules    *Rules    `json:"rules"`
+	Identity *Identity `json:"identity"`
+}
+
+// VerifyHandler verifies the real name of the session player, the ID
+// number goes to the Verifier only.
+func (c *Compliance) VerifyHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(VerifyRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			r := req.Payload.(*VerifyRequest)
+			x, err := c.Verify(ctx, s.AccountID, r.Name, r.IDNumber)
+			if err != nil {
+				return nil, c.apiErrs(err)
+			}
+			return x, nil
+		})
+}
+
+// StatusHandler answers with the rules of the session player region and
+// their identity, e.g. for the client to ask for verification.
+func (c *Compliance) StatusHandler() a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		s, ok := a5gsession.FromContext(ctx)
+		if !ok {
+			return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+		}
+		region, err := c.Region(ctx, s.AccountID)
+		if err != nil {
+			return nil, c.apiErrs(err)
+		}
+		x, err := c.Store.Identity(s.AccountID)
+		if err != nil {
+			return nil, c.apiErrs(err)
+		}
+		return &Status{Region: region, Rules: c.Rules(region), Identity: x}, nil
+	}
+}
+
+// DisclosureHandler answers with the odds of a gacha pool when the
+// session player region discloses them.
+func (c *Compliance) DisclosureHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(DisclosureRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			region, err := c.Region(ctx, s.AccountID)
+			if err != nil {
+				return nil, c.apiErrs(err)
+			}
+			a, err := c.Disclose(region, req.Payload.(*DisclosureRequest).Pool)
+			if err != nil {
+				return nil, c.apiErrs(err)
+			}
+			return a, nil
+		})
+}
+
+// Guard rejects requests of players who may not play now, mount it on
+// gameplay routes.
+func (c *Compliance) Guard(next a5ghttp.HandlerFunc) a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		s, ok := a5gsession.FromContext(ctx)
+		if !ok {
+			return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+		}
+		if err := c.CheckPlay(ctx, s.AccountID); err != nil {
+			return nil, c.apiErrs(err)
+		}
+		return next(ctx, req)
+	}
+}
+
+func (c *Compliance) apiErrs(err error) []*a5gapi.APIErr {
+	switch errors.Cause(err) {
+	case ErrPoolUnknown:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodePoolUnknown, "")}
+	case ErrUnverified:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeUnverified, "")}
+	case ErrCurfew:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeCurfew, "")}
+	case ErrSpendCap:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeSpendCap, "")}
+	case ErrIdentityInvalid:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeIdentityInvalid, "")}
+	}
+	c.Logger.Error(err.Error())
+	return a5gapi.NewJSONMsgDefautlErrors(err)
+}
@@ -0,0 +1,134 @@
+package a5gcompliance
+
+import (
+	"sync"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type spendKey struct {
+	accountID uint64
+	month     string
+}
+
+type memoryStore struct {
+	mu         sync.Mutex
+	identities map[uint64]Identity
+	spend      map[spendKey]int64
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{
+		identities: make(map[uint64]Identity),
+		spend:      make(map[spendKey]int64)}
+}
+
+func (s *memoryStore) Identity(accountID uint64) (*Identity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	x, ok := s.identities[accountID]
+	if !ok {
+		return nil, nil
+	}
+	return &x, nil
+}
+
+func (s *memoryStore) SetIdentity(x *Identity) error {
+	s.mu.Lock()
+	s.identities[x.AccountID] = *x
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryStore) AddSpend(
+	accountID uint64, month string, amount, limit int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := spendKey{accountID: accountID, month: month}
+	if s.spend[k]+amount > limit {
+		return false, nil
+	}
+	s.spend[k] += amount
+	return true, nil
+}
+
+// dbStore keeps identities and spending in MySQL tables:
+//
+//	CREATE TABLE compliance_identities (
+//	  account_id BIGINT UNSIGNED NOT NULL PRIMARY KEY,
+//	  verified TINYINT(1) NOT NULL,
+//	  birth_date CHAR(10) NOT NULL,
+//	  verified_at BIGINT NOT NULL);
+//
+//	CREATE TABLE compliance_spend (
+//	  account_id BIGINT UNSIGNED NOT NULL,
+//	  month CHAR(7) NOT NULL,
+//	  amount BIGINT NOT NULL,
+//	  PRIMARY KEY (account_id, month));
+type dbStore struct {
+	pooler          a5gdb.Pooler
+	identitiesTable string
+	spendTable      string
+}
+
+func NewDBStore(p a5gdb.Pooler, identitiesTable, spendTable string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if identitiesTable == "" || spendTable == "" {
+		return nil, errors.New("empty compliance table name")
+	}
+	return &dbStore{
+		pooler:          p,
+		identitiesTable: identitiesTable,
+		spendTable:      spendTable}, nil
+}
+
+func (s *dbStore) Identity(accountID uint64) (*Identity, error) {
+	x := new(Identity)
+	err := s.pooler.ReadPool().NewSession().
+		Select("account_id", "verified", "birth_date", "verified_at").
+		From(s.identitiesTable).Where(dbr.Eq("account_id", accountID)).LoadOne(x)
+	if err == dbr.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	return x, nil
+}
+
+func (s *dbStore) SetIdentity(x *Identity) error {
+	_, err := s.pooler.WritePool().NewSession().InsertBySql("REPLACE INTO "+
+		s.identitiesTable+" (account_id, verified, birth_date, verified_at)"+
+		" VALUES (?, ?, ?, ?)",
+		x.AccountID, x.Verified, x.BirthDate, x.VerifiedAt).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	return nil
+}
+
+// AddSpend checks the limit in the upsert so concurrent purchases can not
+// both pass it; an unchanged row affects none.
+func (s *dbStore) AddSpend(
+	accountID uint64, month string, amount, limit int64) (bool, error) {
+	if amount > limit {
+		return false, nil
+	}
+	res, err := s.pooler.WritePool().NewSession().InsertBySql("INSERT INTO "+
+		s.spendTable+" (account_id, month, amount) VALUES (?, ?, ?)"+
+		" ON DUPLICATE KEY UPDATE"+
+		" amount = IF(amount + VALUES(amount) <= ?, amount + VALUES(amount), amount)",
+		accountID, month, amount, limit).Exec()
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	return n > 0, nil
+}
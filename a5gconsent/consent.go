@@ -0,0 +1,178 @@
+package a5gconsent
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrPurposeUnknown = errors.New("consent purpose unknown")
+	ErrPolicyOutdated = errors.New("consent policy version outdated")
+)
+
+// Purposes of data processing players consent to.
+const (
+	PurposeAnalytics = "analytics"
+	PurposeAds       = "ads"
+)
+
+// Decision is a consent given or withdrawn by a player for the policy
+// version shown to them, At in unix seconds.
+type Decision struct {
+	Purpose       string `json:"purpose"`
+	Granted       bool   `json:"granted"`
+	PolicyVersion string `json:"policyVersion"`
+	At            int64  `json:"at"`
+}
+
+// Store keeps decisions as an append-only log, so the consent given at any
+// time can be proven. Latest returns the last decision per purpose.
+type Store interface {
+	Latest(accountID uint64) (map[string]*Decision, error)
+	Append(accountID uint64, d *Decision) error
+	History(accountID uint64, limit int) ([]*Decision, error)
+}
+
+// Consents records decisions and answers whether a purpose is allowed for
+// a player. Policies maps purposes to current policy versions; a decision
+// for an older version does not count, so players are asked again once a
+// policy changes.
+type Consents struct {
+	Policies map[string]string
+	Store    Store
+	Logger   a5glogs.Logger
+
+	now func() time.Time
+}
+
+func NewConsents(
+	policies map[string]string, s Store, l a5glogs.Logger) (*Consents, error) {
+	if len(policies) == 0 {
+		return nil, errors.New("empty consent policies")
+	}
+	for purpose, version := range policies {
+		if purpose == "" || version == "" {
+			return nil, errors.New("empty consent purpose or policy version")
+		}
+	}
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Consents{Policies: policies, Store: s, Logger: l, now: time.Now}, nil
+}
+
+// Update records a decision on the policyVersion the player was shown,
+// which must be the current one.
+func (c *Consents) Update(
+	accountID uint64, purpose string, granted bool, policyVersion string) (
+	*Decision, error) {
+	version, ok := c.Policies[purpose]
+	if !ok {
+		return nil, errors.Wrap(ErrPurposeUnknown, purpose)
+	}
+	if policyVersion != version {
+		return nil, errors.Wrapf(ErrPolicyOutdated, "%s %q", purpose, policyVersion)
+	}
+	d := &Decision{
+		Purpose:       purpose,
+		Granted:       granted,
+		PolicyVersion: version,
+		At:            c.now().Unix()}
+	if err := c.Store.Append(accountID, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// PurposeState is a purpose as a player sees it. Prompt asks the client to
+// show the policy: the player never decided on its current version.
+type PurposeState struct {
+	Purpose       string    `json:"purpose"`
+	PolicyVersion string    `json:"policyVersion"`
+	Granted       bool      `json:"granted"`
+	Prompt        bool      `json:"prompt"`
+	Decision      *Decision `json:"decision,omitempty"`
+}
+
+// State returns every purpose of a player. Clients pass the Granted of
+// PurposeAds to ad SDKs, which serve non-personalized ads without it.
+func (c *Consents) State(accountID uint64) (map[string]*PurposeState, error) {
+	latest, err := c.Store.Latest(accountID)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]*PurposeState, len(c.Policies))
+	for purpose, version := range c.Policies {
+		x := &PurposeState{
+			Purpose:       purpose,
+			PolicyVersion: version,
+			Prompt:        true,
+			Decision:      latest[purpose]}
+		if d := latest[purpose]; d != nil && d.PolicyVersion == version {
+			x.Granted, x.Prompt = d.Granted, false
+		}
+		m[purpose] = x
+	}
+	return m, nil
+}
+
+// Allowed reports whether a player granted the current policy of a
+// purpose.
+func (c *Consents) Allowed(accountID uint64, purpose string) (bool, error) {
+	version, ok := c.Policies[purpose]
+	if !ok {
+		return false, errors.Wrap(ErrPurposeUnknown, purpose)
+	}
+	latest, err := c.Store.Latest(accountID)
+	if err != nil {
+		return false, err
+	}
+	d := latest[purpose]
+	return d != nil && d.Granted && d.PolicyVersion == version, nil
+}
+
+// Allows is Allowed for pipelines which can not fail: errors are logged
+// and deny the purpose.
+func (c *Consents) Allows(ctx context.Context, accountID uint64, purpose string) bool {
+	ok, err := c.Allowed(accountID, purpose)
+	if err != nil {
+		c.Logger.With(a5gfields.String(
+			"accountId", strconv.FormatUint(accountID, 10))).Error(err.Error())
+		return false
+	}
+	return ok
+}
+
+// Tracker is an analytics sink, e.g. one module listeners forward their
+// events to.
+type Tracker interface {
+	Track(ctx context.Context, accountID uint64, event string, payload interface{}) error
+}
+
+type TrackerFunc func(
+	ctx context.Context, accountID uint64, event string, payload interface{}) error
+
+func (fn TrackerFunc) Track(
+	ctx context.Context, accountID uint64, event string, payload interface{}) error {
+	return fn(ctx, accountID, event, payload)
+}
+
+// AnalyticsTracker drops events of players who did not grant
+// PurposeAnalytics before they reach t.
+func (c *Consents) AnalyticsTracker(t Tracker) Tracker {
+	return TrackerFunc(func(
+		ctx context.Context, accountID uint64, event string, payload interface{}) error {
+		if !c.Allows(ctx, accountID, PurposeAnalytics) {
+			return nil
+		}
+		return t.Track(ctx, accountID, event, payload)
+	})
+}
@@ -0,0 +1,79 @@
+package a5gconsent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestConsents(t *testing.T) {
+	c, err := NewConsents(
+		map[string]string{PurposeAnalytics: "v1", PurposeAds: "v1"},
+		NewMemoryStore(), a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tracked []string
+	tracker := c.AnalyticsTracker(TrackerFunc(func(ctx context.Context,
+		accountID uint64, event string, payload interface{}) error {
+		tracked = append(tracked, event)
+		return nil
+	}))
+
+	ctx := context.Background()
+	tests := []struct {
+		name      string
+		purpose   string
+		granted   bool
+		version   string
+		policy    string
+		err       error
+		analytics bool
+		prompt    bool
+	}{
+		{"undecided", "", false, "", "", nil, false, true},
+		{"unknown", "location", true, "v1", "", ErrPurposeUnknown, false, true},
+		{"outdated", PurposeAnalytics, true, "v0", "", ErrPolicyOutdated,
+			false, true},
+		{"granted", PurposeAnalytics, true, "v1", "", nil, true, false},
+		{"policy changed", "", false, "", "v2", nil, false, true},
+		{"granted again", PurposeAnalytics, true, "v2", "", nil, true, false},
+		{"withdrawn", PurposeAnalytics, false, "v2", "", nil, false, false},
+	}
+	for _, test := range tests {
+		if test.policy != "" {
+			c.Policies[PurposeAnalytics] = test.policy
+		}
+		if test.purpose != "" {
+			_, err := c.Update(1, test.purpose, test.granted, test.version)
+			if errors.Cause(err) != test.err {
+				t.Fatalf("%s: unexpected error %v", test.name, err)
+			}
+		}
+		if err := tracker.Track(ctx, 1, test.name, nil); err != nil {
+			t.Fatal(err)
+		}
+		m, err := c.State(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		x := m[PurposeAnalytics]
+		if x.Granted != test.analytics || x.Prompt != test.prompt {
+			t.Errorf("%s: unexpected state %+v", test.name, x)
+		}
+		if !m[PurposeAds].Prompt {
+			t.Errorf("%s: expected an ads prompt", test.name)
+		}
+	}
+	if len(tracked) != 2 || tracked[0] != "granted" ||
+		tracked[1] != "granted again" {
+		t.Errorf("unexpected tracked events %v", tracked)
+	}
+	history, _ := c.Store.History(1, 0)
+	if len(history) != 3 || history[0].Granted {
+		t.Errorf("unexpected history %+v", history)
+	}
+}
@@ -0,0 +1,115 @@
+package a5gconsent
+
+import (
+	"context"
+	"net/http"
+	"sort"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCodePurposeUnknown = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4240,
+		Name:     "consent_purpose_unknown",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "consent purpose not found"})
+
+	ErrCodePolicyOutdated = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4241,
+		Name:     "consent_policy_outdated",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "policy version is not the current one"})
+)
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodePurposeUnknown, http.StatusUnprocessableEntity)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodePolicyOutdated, http.StatusUnprocessableEntity)
+}
+
+type StateResponse struct {
+	Purposes []*PurposeState `json:"purposes"`
+}
+
+// UpdateRequest carries the decision on the policy version shown to the
+// player.
+type UpdateRequest struct {
+	Purpose       string `json:"purpose" validate:"required"`
+	Granted       bool   `json:"granted"`
+	PolicyVersion string `json:"policyVersion" validate:"required"`
+}
+
+// StateHandler answers with purposes of the a5gsession authenticated
+// player.
+func (c *Consents) StateHandler() a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		sess, ok := a5gsession.FromContext(ctx)
+		if !ok {
+			return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+		}
+		res, err := c.stateResponse(sess.AccountID)
+		if err != nil {
+			return nil, c.apiErrs(err)
+		}
+		return res, nil
+	}
+}
+
+// UpdateHandler records a decision of the a5gsession authenticated player
+// and answers with its purposes.
+func (c *Consents) UpdateHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(UpdateRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			sess, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			p := req.Payload.(*UpdateRequest)
+			_, err := c.Update(sess.AccountID, p.Purpose, p.Granted, p.PolicyVersion)
+			if err != nil {
+				return nil, c.apiErrs(err)
+			}
+			res, err := c.stateResponse(sess.AccountID)
+			if err != nil {
+				return nil, c.apiErrs(err)
+			}
+			return res, nil
+		})
+}
+
+func (c *Consents) stateResponse(accountID uint64) (*StateResponse, error) {
+	m, err := c.State(accountID)
+	if err != nil {
+		return nil, err
+	}
+	res := &StateResponse{Purposes: make([]*PurposeState, 0, len(m))}
+	for _, x := range m {
+		res.Purposes = append(res.Purposes, x)
+	}
+	sort.Slice(res.Purposes, func(i, j int) bool {
+		return res.Purposes[i].Purpose < res.Purposes[j].Purpose
+	})
+	return res, nil
+}
+
+func (c *Consents) apiErrs(err error) []*a5gapi.APIErr {
+	switch errors.Cause(err) {
+	case ErrPurposeUnknown:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodePurposeUnknown, "")}
+	case ErrPolicyOutdated:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodePolicyOutdated, "")}
+	}
+	c.Logger.Error(err.Error())
+	return a5gapi.NewJSONMsgDefautlErrors(err)
+}
@@ -0,0 +1,142 @@
+package a5gconsent
+
+import (
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryStore struct {
+	mu  sync.Mutex
+	log map[uint64][]*Decision
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{log: make(map[uint64][]*Decision)}
+}
+
+func (s *memoryStore) Latest(accountID uint64) (map[string]*Decision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := make(map[string]*Decision)
+	for _, d := range s.log[accountID] {
+		x := *d
+		m[d.Purpose] = &x
+	}
+	return m, nil
+}
+
+func (s *memoryStore) Append(accountID uint64, d *Decision) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	x := *d
+	s.log[accountID] = append(s.log[accountID], &x)
+	return nil
+}
+
+func (s *memoryStore) History(accountID uint64, limit int) ([]*Decision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.log[accountID]
+	l := make([]*Decision, 0, len(a))
+	for i := len(a) - 1; i >= 0 && (limit <= 0 || len(l) < limit); i-- {
+		x := *a[i]
+		l = append(l, &x)
+	}
+	return l, nil
+}
+
+// dbStore keeps the decision log in a MySQL table:
+//
+//	CREATE TABLE consent_log (
+//	  id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+//	  account_id BIGINT UNSIGNED NOT NULL,
+//	  purpose VARCHAR(32) NOT NULL,
+//	  granted TINYINT(1) NOT NULL,
+//	  policy_version VARCHAR(32) NOT NULL,
+//	  created_at DATETIME NOT NULL,
+//	  PRIMARY KEY (id),
+//	  KEY account_id_purpose_id (account_id, purpose, id));
+type dbStore struct {
+	pooler    a5gdb.Pooler
+	tableName string
+}
+
+type dbDecision struct {
+	Purpose       string    `db:"purpose"`
+	Granted       bool      `db:"granted"`
+	PolicyVersion string    `db:"policy_version"`
+	CreatedAt     time.Time `db:"created_at"`
+}
+
+var decisionColumns = []string{
+	"purpose", "granted", "policy_version", "created_at"}
+
+func (x *dbDecision) decision() *Decision {
+	return &Decision{
+		Purpose:       x.Purpose,
+		Granted:       x.Granted,
+		PolicyVersion: x.PolicyVersion,
+		At:            x.CreatedAt.Unix()}
+}
+
+func NewDBStore(p a5gdb.Pooler, tableName string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if tableName == "" {
+		return nil, errors.New("empty consent log table name")
+	}
+	return &dbStore{pooler: p, tableName: tableName}, nil
+}
+
+// Latest reads the last row of each purpose of the player.
+func (s *dbStore) Latest(accountID uint64) (map[string]*Decision, error) {
+	var rows []*dbDecision
+	_, err := s.pooler.ReadPool().NewSession().
+		Select(decisionColumns...).From(s.tableName).
+		Where(dbr.Eq("account_id", accountID)).
+		Where("id IN (SELECT MAX(id) FROM "+s.tableName+
+			" WHERE account_id = ? GROUP BY purpose)", accountID).
+		Load(&rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	m := make(map[string]*Decision, len(rows))
+	for _, x := range rows {
+		m[x.Purpose] = x.decision()
+	}
+	return m, nil
+}
+
+func (s *dbStore) Append(accountID uint64, d *Decision) error {
+	_, err := s.pooler.WritePool().NewSession().
+		InsertInto(s.tableName).
+		Pair("account_id", accountID).
+		Pair("purpose", d.Purpose).
+		Pair("granted", d.Granted).
+		Pair("policy_version", d.PolicyVersion).
+		Pair("created_at", time.Unix(d.At, 0).UTC()).Exec()
+	return errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+}
+
+func (s *dbStore) History(accountID uint64, limit int) ([]*Decision, error) {
+	stmt := s.pooler.ReadPool().NewSession().
+		Select(decisionColumns...).From(s.tableName).
+		Where(dbr.Eq("account_id", accountID)).OrderDesc("id")
+	if limit > 0 {
+		stmt.Limit(uint64(limit))
+	}
+	var rows []*dbDecision
+	if _, err := stmt.Load(&rows); err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	a := make([]*Decision, len(rows))
+	for i, x := range rows {
+		a[i] = x.decision()
+	}
+	return a, nil
+}
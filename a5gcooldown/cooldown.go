@@ -0,0 +1,182 @@
+package a5gcooldown
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrActionUnknown = errors.New("cooldown action unknown")
+	ErrActive        = errors.New("cooldown active")
+)
+
+// Action is a player action with a cooldown, e.g. "rename" for "720h".
+type Action struct {
+	ID       string `json:"id"`
+	Duration string `json:"duration"`
+
+	duration time.Duration
+}
+
+func NewActionsJSON(b []byte) ([]*Action, error) {
+	var a []*Action
+	if err := json.Unmarshal(b, &a); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return a, nil
+}
+
+// Store keeps when cooldowns of players end. Start sets until only when
+// the cooldown of the action is over at now, reporting whether it did, so
+// concurrent uses of an action let one through; Set overrides it, zero
+// until clears it. Time comes from the caller so that every instance
+// agrees on it; ended cooldowns may be reported as zero.
+type Store interface {
+	Get(accountID uint64, actions []string) (map[string]time.Time, error)
+	Start(accountID uint64, action string, now, until time.Time) (bool, error)
+	Set(accountID uint64, action string, now, until time.Time) error
+}
+
+// State is a cooldown of a player, times in unix seconds; Remaining is
+// zero when the action is ready.
+type State struct {
+	Action    string `json:"action"`
+	Ready     bool   `json:"ready"`
+	Until     int64  `json:"until,omitempty"`
+	Remaining int64  `json:"remaining,omitempty"`
+}
+
+// Cooldowns is the shared cooldown math of modules: rename, clan hop,
+// report, trade and the like call Use before acting.
+type Cooldowns struct {
+	Store  Store
+	Logger a5glogs.Logger
+
+	actions map[string]*Action
+	ids     []string
+	now     func() time.Time
+}
+
+func NewCooldowns(actions []*Action, s Store, l a5glogs.Logger) (*Cooldowns, error) {
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	c := &Cooldowns{
+		Store:   s,
+		Logger:  l,
+		actions: make(map[string]*Action, len(actions)),
+		now:     time.Now}
+	for _, a := range actions {
+		if a == nil || a.ID == "" {
+			return nil, errors.New("empty cooldown action id")
+		}
+		if c.actions[a.ID] != nil {
+			return nil, errors.Errorf("duplicate cooldown action %q", a.ID)
+		}
+		d, err := time.ParseDuration(a.Duration)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cooldown action %q", a.ID)
+		}
+		if d <= 0 {
+			return nil, errors.Errorf("cooldown action %q has no duration", a.ID)
+		}
+		a.duration = d
+		c.actions[a.ID] = a
+		c.ids = append(c.ids, a.ID)
+	}
+	sort.Strings(c.ids)
+	return c, nil
+}
+
+func (c *Cooldowns) action(id string) (*Action, error) {
+	a, ok := c.actions[id]
+	if !ok {
+		return nil, errors.Wrap(ErrActionUnknown, id)
+	}
+	return a, nil
+}
+
+// Use starts the cooldown of an action unless it is running, in which case
+// it fails with ErrActive and returns the running cooldown. Callers whose
+// action then fails may give the use back with a zero Override.
+func (c *Cooldowns) Use(accountID uint64, action string) (*State, error) {
+	a, err := c.action(action)
+	if err != nil {
+		return nil, err
+	}
+	now := c.now()
+	until := now.Add(a.duration)
+	ok, err := c.Store.Start(accountID, action, now, until)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return c.state(action, until), nil
+	}
+	x, err := c.State(accountID, action)
+	if err != nil {
+		return nil, err
+	}
+	return x, errors.Wrapf(ErrActive, "%s ready in %ds", action, x.Remaining)
+}
+
+// State returns the cooldown of an action.
+func (c *Cooldowns) State(accountID uint64, action string) (*State, error) {
+	if _, err := c.action(action); err != nil {
+		return nil, err
+	}
+	m, err := c.Store.Get(accountID, []string{action})
+	if err != nil {
+		return nil, err
+	}
+	return c.state(action, m[action]), nil
+}
+
+// States returns cooldowns of every action by ID.
+func (c *Cooldowns) States(accountID uint64) ([]*State, error) {
+	m, err := c.Store.Get(accountID, c.ids)
+	if err != nil {
+		return nil, err
+	}
+	a := make([]*State, len(c.ids))
+	for i, id := range c.ids {
+		a[i] = c.state(id, m[id])
+	}
+	return a, nil
+}
+
+func (c *Cooldowns) state(action string, until time.Time) *State {
+	x := &State{Action: action, Ready: true}
+	if d := until.Sub(c.now()); d > 0 {
+		x.Ready = false
+		x.Until = until.Unix()
+		// Rounded up, so a client never retries too early.
+		x.Remaining = int64((d + time.Second - 1) / time.Second)
+	}
+	return x
+}
+
+// Override sets the remaining cooldown of an action, zero makes it ready,
+// e.g. for support granting a free rename.
+func (c *Cooldowns) Override(
+	accountID uint64, action string, remaining time.Duration) (*State, error) {
+	if _, err := c.action(action); err != nil {
+		return nil, err
+	}
+	now := c.now()
+	var until time.Time
+	if remaining > 0 {
+		until = now.Add(remaining)
+	}
+	if err := c.Store.Set(accountID, action, now, until); err != nil {
+		return nil, err
+	}
+	return c.state(action, until), nil
+}
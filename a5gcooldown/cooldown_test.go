@@ -0,0 +1,65 @@
+package a5gcooldown
+
+import (
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestCooldownsUse(t *testing.T) {
+	actions, err := NewActionsJSON([]byte(`[
+		{"id": "rename", "duration": "720h"},
+		{"id": "report", "duration": "90s"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewCooldowns(
+		actions, NewMemoryStore(), a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1000, 0)
+	c.now = func() time.Time { return now }
+	tests := []struct {
+		name      string
+		after     time.Duration
+		action    string
+		override  time.Duration
+		err       error
+		remaining int64
+	}{
+		{"unknown", 0, "trade", -1, ErrActionUnknown, 0},
+		{"first", 0, "report", -1, nil, 90},
+		{"too early", 30 * time.Second, "report", -1, ErrActive, 60},
+		{"rounded up", 59500 * time.Millisecond, "report", -1, ErrActive, 1},
+		{"ready", 500 * time.Millisecond, "report", -1, nil, 90},
+		{"rename", 0, "rename", -1, nil, 30 * 24 * 3600},
+		{"extended", 0, "rename", time.Hour, ErrActive, 3600},
+		{"reset", 0, "rename", 0, nil, 30 * 24 * 3600},
+	}
+	for _, test := range tests {
+		now = now.Add(test.after)
+		if test.override >= 0 {
+			if _, err := c.Override(1, test.action, test.override); err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+		}
+		x, err := c.Use(1, test.action)
+		if errors.Cause(err) != test.err {
+			t.Fatalf("%s: unexpected error %v", test.name, err)
+		}
+		if x != nil && x.Remaining != test.remaining {
+			t.Errorf("%s: unexpected cooldown %+v", test.name, x)
+		}
+	}
+	a, err := c.States(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != 2 || !a[0].Ready || a[0].Action != "rename" {
+		t.Errorf("unexpected states %+v", a)
+	}
+}
@@ -0,0 +1,93 @@
+package a5gcooldown
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCodeActionUnknown = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4047,
+		Name:     "cooldown_action_unknown",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "cooldown action not found"})
+
+	ErrCodeActive = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4291,
+		Name:     "cooldown_active",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "action is on cooldown"})
+)
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeActionUnknown, http.StatusNotFound)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeActive, http.StatusTooManyRequests)
+}
+
+type StatesResponse struct {
+	Cooldowns []*State `json:"cooldowns"`
+}
+
+// OverrideRequest sets the remaining cooldown of a player action in
+// seconds, zero makes it ready.
+type OverrideRequest struct {
+	AccountID uint64 `json:"accountId" validate:"required"`
+	Action    string `json:"action" validate:"required"`
+	Remaining int64  `json:"remaining" validate:"min=0"`
+}
+
+// StatesHandler answers with cooldowns of the a5gsession authenticated
+// player.
+func (c *Cooldowns) StatesHandler() a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		s, ok := a5gsession.FromContext(ctx)
+		if !ok {
+			return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+		}
+		a, err := c.States(s.AccountID)
+		if err != nil {
+			return nil, c.APIErrs(err)
+		}
+		return &StatesResponse{Cooldowns: a}, nil
+	}
+}
+
+// OverrideHandler applies an OverrideRequest and answers with the State,
+// mount it on an admin route class.
+func (c *Cooldowns) OverrideHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(OverrideRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			p := req.Payload.(*OverrideRequest)
+			x, err := c.Override(p.AccountID, p.Action,
+				time.Duration(p.Remaining)*time.Second)
+			if err != nil {
+				return nil, c.APIErrs(err)
+			}
+			return x, nil
+		})
+}
+
+// APIErrs converts a Use error, the message tells when the action is
+// ready.
+func (c *Cooldowns) APIErrs(err error) []*a5gapi.APIErr {
+	switch errors.Cause(err) {
+	case ErrActionUnknown:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeActionUnknown, "")}
+	case ErrActive:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeActive, "%s", err)}
+	}
+	c.Logger.Error(err.Error())
+	return a5gapi.NewJSONMsgDefautlErrors(err)
+}
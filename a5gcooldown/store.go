@@ -0,0 +1,144 @@
+package a5gcooldown
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+)
+
+type memoryKey struct {
+	accountID uint64
+	action    string
+}
+
+type memoryStore struct {
+	mu    sync.Mutex
+	until map[memoryKey]time.Time
+}
+
+// NewMemoryStore is a single-process store, ended cooldowns are dropped
+// when started again.
+func NewMemoryStore() Store {
+	return &memoryStore{until: make(map[memoryKey]time.Time)}
+}
+
+func (s *memoryStore) Get(
+	accountID uint64, actions []string) (map[string]time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := make(map[string]time.Time, len(actions))
+	for _, a := range actions {
+		if t, ok := s.until[memoryKey{accountID, a}]; ok {
+			m[a] = t
+		}
+	}
+	return m, nil
+}
+
+func (s *memoryStore) Start(
+	accountID uint64, action string, now, until time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := memoryKey{accountID, action}
+	if t, ok := s.until[k]; ok && t.After(now) {
+		return false, nil
+	}
+	s.until[k] = until
+	return true, nil
+}
+
+func (s *memoryStore) Set(
+	accountID uint64, action string, now, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := memoryKey{accountID, action}
+	if !until.After(now) {
+		delete(s.until, k)
+		return nil
+	}
+	s.until[k] = until
+	return nil
+}
+
+// redisStore keeps a key per running cooldown holding its end in unix
+// milliseconds and expiring with it.
+type redisStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisStore is a store shared by all instances using the same redis
+// and prefix.
+func NewRedisStore(c redis.UniversalClient, prefix string) (Store, error) {
+	if c == nil {
+		return nil, errors.New("redis client missing")
+	}
+	return &redisStore{client: c, prefix: prefix}, nil
+}
+
+// key hash tags the account, so the MGet of Get stays in one cluster slot.
+func (s *redisStore) key(accountID uint64, action string) string {
+	return "{" + s.prefix + strconv.FormatUint(accountID, 10) + "}:" + action
+}
+
+func (s *redisStore) Get(
+	accountID uint64, actions []string) (map[string]time.Time, error) {
+	m := make(map[string]time.Time, len(actions))
+	if len(actions) == 0 {
+		return m, nil
+	}
+	keys := make([]string, len(actions))
+	for i, a := range actions {
+		keys[i] = s.key(accountID, a)
+	}
+	a, err := s.client.MGet(keys...).Result()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for i, x := range a {
+		v, ok := x.(string)
+		if !ok {
+			continue
+		}
+		ms, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		m[actions[i]] = time.Unix(0, ms*int64(time.Millisecond))
+	}
+	return m, nil
+}
+
+func (s *redisStore) Start(
+	accountID uint64, action string, now, until time.Time) (bool, error) {
+	ok, err := s.client.SetNX(s.key(accountID, action),
+		until.UnixNano()/int64(time.Millisecond), ttl(now, until)).Result()
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	return ok, nil
+}
+
+func (s *redisStore) Set(
+	accountID uint64, action string, now, until time.Time) error {
+	k := s.key(accountID, action)
+	var err error
+	if until.After(now) {
+		err = s.client.Set(k,
+			until.UnixNano()/int64(time.Millisecond), ttl(now, until)).Err()
+	} else {
+		err = s.client.Del(k).Err()
+	}
+	return errors.WithStack(err)
+}
+
+// ttl is at least a millisecond, redis treats zero as no expiration.
+func ttl(now, until time.Time) time.Duration {
+	if d := until.Sub(now); d >= time.Millisecond {
+		return d
+	}
+	return time.Millisecond
+}
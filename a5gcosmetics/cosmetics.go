@@ -0,0 +1,198 @@
+package a5gcosmetics
+
+import (
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCosmeticUnknown = errors.New("cosmetic unknown")
+	ErrNotOwned        = errors.New("cosmetic not owned")
+	ErrEquipInvalid    = errors.New("cosmetics equip invalid")
+)
+
+// Kinds of cosmetics. A player shows one title and up to MaxBadges
+// badges.
+const (
+	KindTitle = "title"
+	KindBadge = "badge"
+)
+
+// Sources of grants.
+const (
+	SourceAchievement = "achievement"
+	SourceTournament  = "tournament"
+	SourceSeason      = "season"
+	SourceAdmin       = "admin"
+)
+
+// Cosmetic is a catalog entry, Name is a localization key.
+type Cosmetic struct {
+	ID   string `json:"id"`
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// Owned is a cosmetic a player earned, Ref identifies the grant in its
+// Source, e.g. an achievement or tournament ID. GrantedAt is in unix
+// seconds.
+type Owned struct {
+	CosmeticID string `json:"cosmeticId" db:"cosmetic_id"`
+	Source     string `json:"source" db:"source"`
+	Ref        string `json:"ref" db:"ref"`
+	GrantedAt  int64  `json:"grantedAt" db:"granted_at"`
+}
+
+// Equipped are the cosmetics a player shows in profiles and leaderboards.
+type Equipped struct {
+	Title  string   `json:"title,omitempty"`
+	Badges []string `json:"badges,omitempty"`
+}
+
+// Store keeps owned and equipped cosmetics. Grant reports false when the
+// player already owns the cosmetic; Equipped returns the equipped
+// cosmetics of players who equipped any.
+type Store interface {
+	Grant(accountID uint64, o *Owned) (bool, error)
+	Owned(accountID uint64) ([]*Owned, error)
+	Equip(accountID uint64, e *Equipped) error
+	Equipped(accountIDs []uint64) (map[uint64]*Equipped, error)
+}
+
+// Cosmetics grants titles and badges of the Catalog and keeps what
+// players equip.
+type Cosmetics struct {
+	Store     Store
+	Catalog   map[string]*Cosmetic
+	Logger    a5glogs.Logger
+	MaxBadges int
+
+	now func() time.Time
+}
+
+func NewCosmetics(s Store, catalog []*Cosmetic, l a5glogs.Logger) (*Cosmetics, error) {
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	m := make(map[string]*Cosmetic, len(catalog))
+	for _, c := range catalog {
+		if c == nil || c.ID == "" {
+			return nil, errors.New("empty cosmetic id")
+		}
+		if c.Kind != KindTitle && c.Kind != KindBadge {
+			return nil, errors.Errorf("cosmetic %q: unknown kind %q", c.ID, c.Kind)
+		}
+		if _, ok := m[c.ID]; ok {
+			return nil, errors.Errorf("duplicate cosmetic %q", c.ID)
+		}
+		m[c.ID] = c
+	}
+	return &Cosmetics{
+		Store:     s,
+		Catalog:   m,
+		Logger:    l,
+		MaxBadges: 3,
+		now:       time.Now}, nil
+}
+
+// Grant gives a cosmetic to a player, granting an owned one again is a
+// no-op reported with false.
+func (c *Cosmetics) Grant(
+	accountID uint64, cosmeticID, source, ref string) (bool, error) {
+	if _, ok := c.Catalog[cosmeticID]; !ok {
+		return false, errors.Wrap(ErrCosmeticUnknown, cosmeticID)
+	}
+	return c.Store.Grant(accountID, &Owned{
+		CosmeticID: cosmeticID,
+		Source:     source,
+		Ref:        ref,
+		GrantedAt:  c.now().Unix()})
+}
+
+// Owned lists cosmetics of a player, leaving out those gone from the
+// Catalog.
+func (c *Cosmetics) Owned(accountID uint64) ([]*Owned, error) {
+	a, err := c.Store.Owned(accountID)
+	if err != nil {
+		return nil, err
+	}
+	kept := a[:0]
+	for _, o := range a {
+		if _, ok := c.Catalog[o.CosmeticID]; ok {
+			kept = append(kept, o)
+		}
+	}
+	return kept, nil
+}
+
+// Equip shows owned cosmetics of a player, an empty Equipped shows none.
+func (c *Cosmetics) Equip(accountID uint64, e *Equipped) error {
+	if len(e.Badges) > c.MaxBadges {
+		return errors.Wrapf(ErrEquipInvalid, "%d badges over %d",
+			len(e.Badges), c.MaxBadges)
+	}
+	owned, err := c.Owned(accountID)
+	if err != nil {
+		return err
+	}
+	has := make(map[string]bool, len(owned))
+	for _, o := range owned {
+		has[o.CosmeticID] = true
+	}
+	check := func(id, kind string) error {
+		x, ok := c.Catalog[id]
+		if !ok {
+			return errors.Wrap(ErrCosmeticUnknown, id)
+		}
+		if x.Kind != kind {
+			return errors.Wrapf(ErrEquipInvalid, "%q is not a %s", id, kind)
+		}
+		if !has[id] {
+			return errors.Wrap(ErrNotOwned, id)
+		}
+		return nil
+	}
+	if e.Title != "" {
+		if err = check(e.Title, KindTitle); err != nil {
+			return err
+		}
+	}
+	seen := make(map[string]bool, len(e.Badges))
+	for _, id := range e.Badges {
+		if seen[id] {
+			return errors.Wrapf(ErrEquipInvalid, "duplicate badge %q", id)
+		}
+		seen[id] = true
+		if err = check(id, KindBadge); err != nil {
+			return err
+		}
+	}
+	return c.Store.Equip(accountID, e)
+}
+
+// Equipped returns what players show, for profile and leaderboard
+// views. Cosmetics gone from the Catalog are left out.
+func (c *Cosmetics) Equipped(accountIDs []uint64) (map[uint64]*Equipped, error) {
+	m, err := c.Store.Equipped(accountIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range m {
+		if _, ok := c.Catalog[e.Title]; !ok {
+			e.Title = ""
+		}
+		badges := e.Badges[:0]
+		for _, id := range e.Badges {
+			if _, ok := c.Catalog[id]; ok {
+				badges = append(badges, id)
+			}
+		}
+		e.Badges = badges
+	}
+	return m, nil
+}
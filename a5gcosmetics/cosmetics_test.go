@@ -0,0 +1,127 @@
+package a5gcosmetics
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/armor5games/a5g/a5gleaderboard"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gpayout"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestCosmetics(t *testing.T) {
+	c, err := NewCosmetics(NewMemoryStore(), []*Cosmetic{
+		{ID: "champion", Kind: KindTitle},
+		{ID: "veteran", Kind: KindTitle},
+		{ID: "gold", Kind: KindBadge},
+		{ID: "silver", Kind: KindBadge},
+		{ID: "bronze", Kind: KindBadge},
+		{ID: "iron", Kind: KindBadge},
+	}, a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"champion", "gold", "silver", "bronze", "iron"} {
+		ok, err := c.Grant(1, id, SourceAchievement, "a-"+id)
+		if err != nil || !ok {
+			t.Fatalf("grant %s: %v %v", id, ok, err)
+		}
+	}
+	if ok, err := c.Grant(1, "gold", SourceTournament, "t"); err != nil || ok {
+		t.Errorf("unexpected second grant %v %v", ok, err)
+	}
+	if _, err = c.Grant(1, "diamond", SourceAdmin, ""); errors.Cause(err) != ErrCosmeticUnknown {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	tests := []struct {
+		name string
+		e    *Equipped
+		err  error
+	}{
+		{"not owned", &Equipped{Title: "veteran"}, ErrNotOwned},
+		{"badge as title", &Equipped{Title: "gold"}, ErrEquipInvalid},
+		{"unknown", &Equipped{Badges: []string{"diamond"}}, ErrCosmeticUnknown},
+		{"duplicate", &Equipped{Badges: []string{"gold", "gold"}}, ErrEquipInvalid},
+		{"too many", &Equipped{Badges: []string{"gold", "silver", "bronze", "iron"}},
+			ErrEquipInvalid},
+		{"ok", &Equipped{Title: "champion", Badges: []string{"gold", "iron"}}, nil},
+	}
+	for _, test := range tests {
+		if err = c.Equip(1, test.e); errors.Cause(err) != test.err {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+	}
+
+	lb, err := a5gleaderboard.NewLeaderboards(
+		a5gleaderboard.NewMemoryStore(), a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = lb.Register(&a5gleaderboard.Board{
+		ID: "arena", Schedule: a5gleaderboard.Forever}); err != nil {
+		t.Fatal(err)
+	}
+	for id, score := range map[uint64]int64{1: 10, 2: 20} {
+		if _, err = lb.Submit("arena", id, score); err != nil {
+			t.Fatal(err)
+		}
+	}
+	top, err := lb.Top("arena", 10, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := c.Decorate(top)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[uint64]*Equipped{1: {Title: "champion", Badges: []string{"gold", "iron"}}}
+	if len(s.Entries) != 2 || !reflect.DeepEqual(s.Cosmetics, want) {
+		t.Errorf("unexpected season cosmetics %+v", s.Cosmetics)
+	}
+
+	// Cosmetics removed from the catalog are no longer shown.
+	delete(c.Catalog, "iron")
+	m, err := c.Equipped([]uint64{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m[1].Badges, []string{"gold"}) {
+		t.Errorf("unexpected badges %v", m[1].Badges)
+	}
+}
+
+func TestPayoutMailer(t *testing.T) {
+	c, err := NewCosmetics(NewMemoryStore(), []*Cosmetic{{ID: "cup", Kind: KindBadge}},
+		a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mailed []*a5gpayout.Payout
+	m := c.PayoutMailer(a5gpayout.MailerFunc(
+		func(ctx context.Context, p *a5gpayout.Payout) error {
+			mailed = append(mailed, p)
+			return nil
+		}))
+	p := &a5gpayout.Payout{RunID: "arena:s1", AccountID: 3, Rank: 1,
+		Reward: &a5gpayout.Reward{Items: map[string]int64{"cup": 1, "chest": 2}}}
+	for i := 0; i < 2; i++ {
+		if err = m.Mail(context.Background(), p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	owned, err := c.Owned(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(owned) != 1 || owned[0].Source != SourceTournament || owned[0].Ref != "arena:s1:1" {
+		t.Errorf("unexpected owned %+v", owned)
+	}
+	if len(mailed) != 2 || !reflect.DeepEqual(mailed[0].Reward.Items,
+		map[string]int64{"chest": 2}) {
+		t.Errorf("unexpected mailed %+v", mailed)
+	}
+}
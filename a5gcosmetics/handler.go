@@ -0,0 +1,213 @@
+package a5gcosmetics
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gleaderboard"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCodeCosmeticUnknown = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4068,
+		Name:     "cosmetic_unknown",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "cosmetic not found"})
+
+	ErrCodeNotOwned = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4274,
+		Name:     "cosmetic_not_owned",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "cosmetic not owned"})
+
+	ErrCodeEquipInvalid = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4275,
+		Name:     "cosmetics_equip_invalid",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "unexpected cosmetics to equip"})
+)
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeCosmeticUnknown, http.StatusNotFound)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeNotOwned, http.StatusForbidden)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeEquipInvalid, http.StatusUnprocessableEntity)
+}
+
+type EquipRequest struct {
+	Title  string   `json:"title" validate:"max=64"`
+	Badges []string `json:"badges"`
+}
+
+type ProfileRequest struct {
+	AccountID uint64 `json:"accountId" validate:"required"`
+}
+
+type GrantRequest struct {
+	AccountID  uint64 `json:"accountId" validate:"required"`
+	CosmeticID string `json:"cosmeticId" validate:"required,max=64"`
+	Source     string `json:"source" validate:"required,oneof=achievement tournament season admin"`
+	Ref        string `json:"ref" validate:"max=64"`
+}
+
+// Profile is the cosmetic part of a player profile.
+type Profile struct {
+	AccountID uint64    `json:"accountId"`
+	Equipped  *Equipped `json:"equipped"`
+}
+
+// Season is a leaderboard season with the cosmetics its players equipped.
+type Season struct {
+	*a5gleaderboard.Season
+	Cosmetics map[uint64]*Equipped `json:"cosmetics"`
+}
+
+// Decorate adds equipped cosmetics of players of s, leaving s entries as
+// they are since they may be shared.
+func (c *Cosmetics) Decorate(s *a5gleaderboard.Season) (*Season, error) {
+	ids := make([]uint64, len(s.Entries))
+	for i, e := range s.Entries {
+		ids[i] = e.PlayerID
+	}
+	m, err := c.Equipped(ids)
+	if err != nil {
+		return nil, err
+	}
+	return &Season{Season: s, Cosmetics: m}, nil
+}
+
+// EquipHandler equips owned cosmetics of the session player.
+func (c *Cosmetics) EquipHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(EquipRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			r := req.Payload.(*EquipRequest)
+			e := &Equipped{Title: r.Title, Badges: r.Badges}
+			if err := c.Equip(s.AccountID, e); err != nil {
+				return nil, c.apiErrs(err)
+			}
+			return e, nil
+		})
+}
+
+// OwnedHandler lists cosmetics of the session player.
+func (c *Cosmetics) OwnedHandler() a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		s, ok := a5gsession.FromContext(ctx)
+		if !ok {
+			return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+		}
+		a, err := c.Owned(s.AccountID)
+		if err != nil {
+			return nil, c.apiErrs(err)
+		}
+		return a, nil
+	}
+}
+
+// ProfileHandler answers with cosmetics a player shows on their profile.
+func (c *Cosmetics) ProfileHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(ProfileRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			id := req.Payload.(*ProfileRequest).AccountID
+			m, err := c.Equipped([]uint64{id})
+			if err != nil {
+				return nil, c.apiErrs(err)
+			}
+			p := &Profile{AccountID: id, Equipped: m[id]}
+			if p.Equipped == nil {
+				p.Equipped = &Equipped{}
+			}
+			return p, nil
+		})
+}
+
+// GrantHandler grants a cosmetic by hand, e.g. for an achievement the
+// client can not report; mount it on an admin route class.
+func (c *Cosmetics) GrantHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(GrantRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			r := req.Payload.(*GrantRequest)
+			if _, err := c.Grant(r.AccountID, r.CosmeticID, r.Source, r.Ref); err != nil {
+				return nil, c.apiErrs(err)
+			}
+			return r, nil
+		})
+}
+
+// TopHandler is (*a5gleaderboard.Leaderboards).TopHandler with equipped
+// cosmetics of the players.
+func (c *Cosmetics) TopHandler(lb *a5gleaderboard.Leaderboards) a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return &a5gleaderboard.TopRequest{Limit: 10} },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			p := req.Payload.(*a5gleaderboard.TopRequest)
+			s, err := lb.Top(p.Board, p.Limit, p.Previous)
+			if err != nil {
+				return nil, c.apiErrs(err)
+			}
+			x, err := c.Decorate(s)
+			if err != nil {
+				return nil, c.apiErrs(err)
+			}
+			return x, nil
+		})
+}
+
+// AroundHandler is (*a5gleaderboard.Leaderboards).AroundHandler with
+// equipped cosmetics of the players.
+func (c *Cosmetics) AroundHandler(lb *a5gleaderboard.Leaderboards) a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return &a5gleaderboard.AroundRequest{Neighbors: 5} },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			sess, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			p := req.Payload.(*a5gleaderboard.AroundRequest)
+			s, err := lb.Around(p.Board, sess.AccountID, p.Neighbors, p.Previous)
+			if err != nil {
+				return nil, c.apiErrs(err)
+			}
+			x, err := c.Decorate(s)
+			if err != nil {
+				return nil, c.apiErrs(err)
+			}
+			return x, nil
+		})
+}
+
+func (c *Cosmetics) apiErrs(err error) []*a5gapi.APIErr {
+	switch errors.Cause(err) {
+	case ErrCosmeticUnknown:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeCosmeticUnknown, "")}
+	case ErrNotOwned:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeNotOwned, "")}
+	case ErrEquipInvalid:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeEquipInvalid, "%s", err)}
+	case a5gleaderboard.ErrBoardUnknown:
+		return []*a5gapi.APIErr{a5gapi.NewErr(a5gleaderboard.ErrCodeBoardUnknown, "")}
+	}
+	c.Logger.Error(err.Error())
+	return a5gapi.NewJSONMsgDefautlErrors(err)
+}
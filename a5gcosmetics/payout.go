@@ -0,0 +1,39 @@
+package a5gcosmetics
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/armor5games/a5g/a5gpayout"
+)
+
+// PayoutMailer grants tournament cosmetics: reward items found in the
+// Catalog are granted with SourceTournament, the rest of the payout goes
+// on to next. Grants are idempotent, so mailing a payout again is safe.
+func (c *Cosmetics) PayoutMailer(next a5gpayout.Mailer) a5gpayout.Mailer {
+	return a5gpayout.MailerFunc(func(ctx context.Context, p *a5gpayout.Payout) error {
+		if p.Reward == nil {
+			return next.Mail(ctx, p)
+		}
+		rest := &a5gpayout.Reward{Currencies: p.Reward.Currencies}
+		ref := p.RunID + ":" + strconv.FormatInt(p.Rank, 10)
+		for id, n := range p.Reward.Items {
+			if _, ok := c.Catalog[id]; !ok {
+				if rest.Items == nil {
+					rest.Items = make(map[string]int64)
+				}
+				rest.Items[id] = n
+				continue
+			}
+			if _, err := c.Grant(p.AccountID, id, SourceTournament, ref); err != nil {
+				return err
+			}
+		}
+		if len(rest.Items) == 0 && len(rest.Currencies) == 0 {
+			return nil
+		}
+		x := *p
+		x.Reward = rest
+		return next.Mail(ctx, &x)
+	})
+}
@@ -0,0 +1,179 @@
+package a5gcosmetics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryStore struct {
+	mu       sync.Mutex
+	owned    map[uint64][]Owned
+	equipped map[uint64]Equipped
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{
+		owned:    make(map[uint64][]Owned),
+		equipped: make(map[uint64]Equipped)}
+}
+
+func (s *memoryStore) Grant(accountID uint64, o *Owned) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, x := range s.owned[accountID] {
+		if x.CosmeticID == o.CosmeticID {
+			return false, nil
+		}
+	}
+	s.owned[accountID] = append(s.owned[accountID], *o)
+	return true, nil
+}
+
+func (s *memoryStore) Owned(accountID uint64) ([]*Owned, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := make([]*Owned, 0, len(s.owned[accountID]))
+	for _, o := range s.owned[accountID] {
+		x := o
+		a = append(a, &x)
+	}
+	sort.Slice(a, func(i, j int) bool { return a[i].CosmeticID < a[j].CosmeticID })
+	return a, nil
+}
+
+func (s *memoryStore) Equip(accountID uint64, e *Equipped) error {
+	s.mu.Lock()
+	if e.Title == "" && len(e.Badges) == 0 {
+		delete(s.equipped, accountID)
+	} else {
+		s.equipped[accountID] = Equipped{
+			Title:  e.Title,
+			Badges: append([]string(nil), e.Badges...)}
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryStore) Equipped(accountIDs []uint64) (map[uint64]*Equipped, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := make(map[uint64]*Equipped, len(accountIDs))
+	for _, id := range accountIDs {
+		if e, ok := s.equipped[id]; ok {
+			m[id] = &Equipped{Title: e.Title, Badges: append([]string(nil), e.Badges...)}
+		}
+	}
+	return m, nil
+}
+
+// dbStore keeps cosmetics in MySQL tables:
+//
+//	CREATE TABLE cosmetics_owned (
+//	  account_id BIGINT UNSIGNED NOT NULL,
+//	  cosmetic_id VARCHAR(64) NOT NULL,
+//	  source VARCHAR(32) NOT NULL,
+//	  ref VARCHAR(64) NOT NULL,
+//	  granted_at BIGINT NOT NULL,
+//	  PRIMARY KEY (account_id, cosmetic_id));
+//
+//	CREATE TABLE cosmetics_equipped (
+//	  account_id BIGINT UNSIGNED NOT NULL PRIMARY KEY,
+//	  title VARCHAR(64) NOT NULL,
+//	  badges VARCHAR(255) NOT NULL);
+//
+// Badges are comma separated cosmetic IDs.
+type dbStore struct {
+	pooler        a5gdb.Pooler
+	ownedTable    string
+	equippedTable string
+}
+
+func NewDBStore(p a5gdb.Pooler, ownedTable, equippedTable string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if ownedTable == "" || equippedTable == "" {
+		return nil, errors.New("empty cosmetics table name")
+	}
+	return &dbStore{
+		pooler:        p,
+		ownedTable:    ownedTable,
+		equippedTable: equippedTable}, nil
+}
+
+func (s *dbStore) Grant(accountID uint64, o *Owned) (bool, error) {
+	res, err := s.pooler.WritePool().NewSession().InsertBySql("INSERT IGNORE INTO "+
+		s.ownedTable+" (account_id, cosmetic_id, source, ref, granted_at)"+
+		" VALUES (?, ?, ?, ?, ?)",
+		accountID, o.CosmeticID, o.Source, o.Ref, o.GrantedAt).Exec()
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	return n > 0, nil
+}
+
+func (s *dbStore) Owned(accountID uint64) ([]*Owned, error) {
+	a := []*Owned{}
+	_, err := s.pooler.ReadPool().NewSession().
+		Select("cosmetic_id", "source", "ref", "granted_at").From(s.ownedTable).
+		Where(dbr.Eq("account_id", accountID)).
+		OrderAsc("cosmetic_id").Load(&a)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	return a, nil
+}
+
+func (s *dbStore) Equip(accountID uint64, e *Equipped) error {
+	sess := s.pooler.WritePool().NewSession()
+	if e.Title == "" && len(e.Badges) == 0 {
+		_, err := sess.DeleteFrom(s.equippedTable).
+			Where(dbr.Eq("account_id", accountID)).Exec()
+		if err != nil {
+			return errors.Wrap(err, "dbr.(*DeleteStmt).Exec fn")
+		}
+		return nil
+	}
+	_, err := sess.InsertBySql("REPLACE INTO "+s.equippedTable+
+		" (account_id, title, badges) VALUES (?, ?, ?)",
+		accountID, e.Title, strings.Join(e.Badges, ",")).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	return nil
+}
+
+func (s *dbStore) Equipped(accountIDs []uint64) (map[uint64]*Equipped, error) {
+	m := make(map[uint64]*Equipped, len(accountIDs))
+	if len(accountIDs) == 0 {
+		return m, nil
+	}
+	var rows []struct {
+		AccountID uint64 `db:"account_id"`
+		Title     string `db:"title"`
+		Badges    string `db:"badges"`
+	}
+	_, err := s.pooler.ReadPool().NewSession().
+		Select("account_id", "title", "badges").From(s.equippedTable).
+		Where(dbr.Eq("account_id", accountIDs)).Load(&rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	for _, row := range rows {
+		e := &Equipped{Title: row.Title}
+		if row.Badges != "" {
+			e.Badges = strings.Split(row.Badges, ",")
+		}
+		m[row.AccountID] = e
+	}
+	return m, nil
+}
@@ -0,0 +1,222 @@
+package a5gcost
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/pkg/errors"
+)
+
+// Resources metered out of the box; Observe takes any other name, e.g.
+// "cpu" for a manually timed computation.
+const (
+	ResourceDB      = "db"
+	ResourceRedis   = "redis"
+	ResourceHandler = "handler"
+)
+
+// FeatureUnknown is the feature of work done outside of a feature context.
+const FeatureUnknown = "unknown"
+
+type ctxKey int
+
+const ctxKeyFeature ctxKey = iota
+
+func ContextWithFeature(ctx context.Context, feature string) context.Context {
+	return context.WithValue(ctx, ctxKeyFeature, feature)
+}
+
+func FeatureFromContext(ctx context.Context) string {
+	if s, ok := ctx.Value(ctxKeyFeature).(string); ok && s != "" {
+		return s
+	}
+	return FeatureUnknown
+}
+
+type usageKey struct {
+	feature  string
+	resource string
+}
+
+type usage struct {
+	calls  int64
+	errors int64
+	time   time.Duration
+}
+
+// Meter accumulates resource consumption per feature (module), so e.g.
+// chat history can be seen to make 40% of Redis load. Features tag their
+// DB pools, Redis clients and handlers through Pooler, Redis, Wrap and
+// Middleware.
+type Meter struct {
+	mu    sync.Mutex
+	since time.Time
+	usage map[usageKey]*usage
+	now   func() time.Time
+}
+
+func NewMeter() *Meter {
+	return &Meter{
+		since: time.Now(),
+		usage: make(map[usageKey]*usage),
+		now:   time.Now}
+}
+
+// Observe records a call of feature to resource that took d.
+func (m *Meter) Observe(feature, resource string, d time.Duration, err error) {
+	m.mu.Lock()
+	u := m.get(feature, resource)
+	u.calls++
+	u.time += d
+	if err != nil {
+		u.errors++
+	}
+	m.mu.Unlock()
+}
+
+// fail records an error of a call observed separately.
+func (m *Meter) fail(feature, resource string) {
+	m.mu.Lock()
+	m.get(feature, resource).errors++
+	m.mu.Unlock()
+}
+
+func (m *Meter) get(feature, resource string) *usage {
+	k := usageKey{feature: feature, resource: resource}
+	u, ok := m.usage[k]
+	if !ok {
+		u = new(usage)
+		m.usage[k] = u
+	}
+	return u
+}
+
+// Time starts timing a call to resource of the ctx feature, the returned
+// func records it:
+//
+//	defer meter.Time(ctx, "cpu")(nil)
+func (m *Meter) Time(ctx context.Context, resource string) func(error) {
+	feature, start := FeatureFromContext(ctx), m.now()
+	return func(err error) {
+		m.Observe(feature, resource, m.now().Sub(start), err)
+	}
+}
+
+// Wrap runs fn in the feature context and meters its time as
+// ResourceHandler; handlers failing with errors of error severity or
+// above count as errors.
+func (m *Meter) Wrap(feature string, fn a5ghttp.HandlerFunc) a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		start := m.now()
+		payload, errs := fn(ContextWithFeature(ctx, feature), req)
+		var err error
+		if a5ghttp.MaxSeverity(errs) >= a5gapi.ErrSeverityError {
+			err = errors.New("handler failed")
+		}
+		m.Observe(feature, ResourceHandler, m.now().Sub(start), err)
+		return payload, errs
+	}
+}
+
+// Middleware is Wrap for plain http handlers, 5xx answers count as errors.
+func (m *Meter) Middleware(feature string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := m.now()
+			x := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(x, r.WithContext(ContextWithFeature(r.Context(), feature)))
+			var err error
+			if x.status >= http.StatusInternalServerError {
+				err = errors.Errorf("status %d", x.status)
+			}
+			m.Observe(feature, ResourceHandler, m.now().Sub(start), err)
+		})
+	}
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Usage is the consumption of a resource by a feature; Share is its part
+// of the resource total time in percents.
+type Usage struct {
+	Feature string  `json:"feature"`
+	Calls   int64   `json:"calls"`
+	Errors  int64   `json:"errors"`
+	TimeMs  float64 `json:"timeMs"`
+	Share   float64 `json:"share"`
+}
+
+// Report is the consumption per resource since Since, features sorted by
+// time, heaviest first.
+type Report struct {
+	Since     int64               `json:"since"`
+	Resources map[string][]*Usage `json:"resources"`
+}
+
+// Report takes a snapshot of the usage, reset starts metering anew, e.g.
+// for periodic exports.
+func (m *Meter) Report(reset bool) *Report {
+	m.mu.Lock()
+	x, since := m.usage, m.since
+	if reset {
+		m.usage = make(map[usageKey]*usage)
+		m.since = m.now()
+	} else {
+		x = make(map[usageKey]*usage, len(m.usage))
+		for k, u := range m.usage {
+			y := *u
+			x[k] = &y
+		}
+	}
+	m.mu.Unlock()
+	r := &Report{
+		Since:     since.Unix(),
+		Resources: make(map[string][]*Usage)}
+	totals := make(map[string]time.Duration)
+	for k, u := range x {
+		totals[k.resource] += u.time
+	}
+	for k, u := range x {
+		y := &Usage{
+			Feature: k.feature,
+			Calls:   u.calls,
+			Errors:  u.errors,
+			TimeMs:  float64(u.time) / float64(time.Millisecond)}
+		if t := totals[k.resource]; t > 0 {
+			y.Share = 100 * float64(u.time) / float64(t)
+		}
+		r.Resources[k.resource] = append(r.Resources[k.resource], y)
+	}
+	for _, a := range r.Resources {
+		sort.Slice(a, func(i, j int) bool {
+			if a[i].TimeMs != a[j].TimeMs {
+				return a[i].TimeMs > a[j].TimeMs
+			}
+			return a[i].Feature < a[j].Feature
+		})
+	}
+	return r
+}
+
+// ReportHandler answers with the Report for dashboards, mount it on an
+// admin route class.
+func (m *Meter) ReportHandler() a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		return m.Report(false), nil
+	}
+}
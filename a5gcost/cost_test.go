@@ -0,0 +1,60 @@
+package a5gcost
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+)
+
+func TestMeterReport(t *testing.T) {
+	m := NewMeter()
+	m.Observe("chat", ResourceRedis, 40*time.Millisecond, nil)
+	m.Observe("chat", ResourceRedis, 20*time.Millisecond, nil)
+	m.Observe("shop", ResourceRedis, 90*time.Millisecond, errors.New("x"))
+	m.Observe("shop", ResourceDB, 10*time.Millisecond, nil)
+	r := m.Report(true)
+	expected := map[string][]*Usage{
+		ResourceRedis: {
+			{Feature: "shop", Calls: 1, Errors: 1, TimeMs: 90, Share: 60},
+			{Feature: "chat", Calls: 2, TimeMs: 60, Share: 40}},
+		ResourceDB: {{Feature: "shop", Calls: 1, TimeMs: 10, Share: 100}}}
+	if !reflect.DeepEqual(r.Resources, expected) {
+		t.Errorf("unexpected report %+v", r.Resources)
+	}
+	if len(m.Report(false).Resources) != 0 {
+		t.Error("report not reset")
+	}
+}
+
+func TestMeterTagging(t *testing.T) {
+	m := NewMeter()
+	c := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1"})
+	defer c.Close()
+	chat, err := m.Redis("chat", c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := m.Wrap("chat", func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		defer m.Time(ctx, "cpu")(nil)
+		chat.Get("history").Err()
+		c.Get("untagged").Err()
+		return nil, nil
+	})
+	fn(context.Background(), new(a5gapi.APIMsgRequest))
+	r := m.Report(false)
+	for _, resource := range []string{ResourceRedis, ResourceHandler, "cpu"} {
+		a := r.Resources[resource]
+		if len(a) != 1 || a[0].Feature != "chat" || a[0].Calls != 1 {
+			t.Errorf("unexpected %s usage %+v", resource, a)
+		}
+	}
+	if a := r.Resources[ResourceRedis]; len(a) == 1 && a[0].Errors != 1 {
+		t.Errorf("expected failed redis call, got %+v", a[0])
+	}
+}
@@ -0,0 +1,98 @@
+package a5gcost
+
+import (
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+)
+
+// Pooler tags every query run through sessions of p with feature; hand the
+// result to the stores the feature owns:
+//
+//	store, err := a5gchat.NewDBStore(meter.Pooler("chat", pooler), "messages")
+func (m *Meter) Pooler(feature string, p a5gdb.Pooler) a5gdb.Pooler {
+	return &pooler{
+		Pooler: p,
+		read:   &connector{Connector: p.ReadPool(), r: m.receiver(feature)},
+		write:  &connector{Connector: p.WritePool(), r: m.receiver(feature)}}
+}
+
+type pooler struct {
+	a5gdb.Pooler
+	read, write *connector
+}
+
+func (p *pooler) ReadPool() a5gdb.Connector  { return p.read }
+func (p *pooler) WritePool() a5gdb.Connector { return p.write }
+
+type connector struct {
+	a5gdb.Connector
+	r *receiver
+}
+
+// NewSession keeps the session receiver of the pool, e.g. a logging one,
+// receiving the events too.
+func (c *connector) NewSession() *dbr.Session {
+	s := c.Connector.NewSession()
+	x := *c.r
+	x.next = s.EventReceiver
+	s.EventReceiver = &x
+	return s
+}
+
+func (m *Meter) receiver(feature string) *receiver {
+	return &receiver{meter: m, feature: feature}
+}
+
+// receiver meters dbr query timings, dbr reports failures of timed
+// queries through EventErrKv.
+type receiver struct {
+	meter   *Meter
+	feature string
+	next    dbr.EventReceiver
+}
+
+func (r *receiver) Event(eventName string) {
+	if r.next != nil {
+		r.next.Event(eventName)
+	}
+}
+
+func (r *receiver) EventKv(eventName string, kvs map[string]string) {
+	if r.next != nil {
+		r.next.EventKv(eventName, kvs)
+	}
+}
+
+func (r *receiver) EventErr(eventName string, err error) error {
+	r.meter.fail(r.feature, ResourceDB)
+	if r.next != nil {
+		return r.next.EventErr(eventName, err)
+	}
+	return err
+}
+
+func (r *receiver) EventErrKv(
+	eventName string, err error, kvs map[string]string) error {
+	r.meter.fail(r.feature, ResourceDB)
+	if r.next != nil {
+		return r.next.EventErrKv(eventName, err, kvs)
+	}
+	return err
+}
+
+func (r *receiver) Timing(eventName string, nanoseconds int64) {
+	r.meter.Observe(r.feature, ResourceDB, time.Duration(nanoseconds), nil)
+	if r.next != nil {
+		r.next.Timing(eventName, nanoseconds)
+	}
+}
+
+func (r *receiver) TimingKv(
+	eventName string, nanoseconds int64, kvs map[string]string) {
+	r.meter.Observe(r.feature, ResourceDB, time.Duration(nanoseconds), nil)
+	if r.next != nil {
+		r.next.TimingKv(eventName, nanoseconds, kvs)
+	}
+}
@@ -0,0 +1,48 @@
+package a5gcost
+
+import (
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+)
+
+// Redis returns a copy of c sharing its connections that meters every
+// command and pipeline with feature; c itself stays untagged. Pipelines
+// count as a single call.
+func (m *Meter) Redis(
+	feature string, c redis.UniversalClient) (redis.UniversalClient, error) {
+	var x redis.UniversalClient
+	switch y := c.(type) {
+	case *redis.Client:
+		x = y.WithContext(y.Context())
+	case *redis.ClusterClient:
+		x = y.WithContext(y.Context())
+	default:
+		return nil, errors.Errorf("unsupported redis client %T", c)
+	}
+	x.WrapProcess(func(next func(redis.Cmder) error) func(redis.Cmder) error {
+		return func(cmd redis.Cmder) error {
+			start := m.now()
+			err := next(cmd)
+			m.Observe(feature, ResourceRedis, m.now().Sub(start), redisErr(err))
+			return err
+		}
+	})
+	x.WrapProcessPipeline(
+		func(next func([]redis.Cmder) error) func([]redis.Cmder) error {
+			return func(cmds []redis.Cmder) error {
+				start := m.now()
+				err := next(cmds)
+				m.Observe(feature, ResourceRedis, m.now().Sub(start), redisErr(err))
+				return err
+			}
+		})
+	return x, nil
+}
+
+// redisErr drops redis.Nil, a missing key is not a failure.
+func redisErr(err error) error {
+	if err == redis.Nil {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,277 @@
+package a5gcrosspromo
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrSignatureInvalid = errors.New("cross-promotion claim signature invalid")
+	ErrClaimExpired     = errors.New("cross-promotion claim expired")
+	ErrOfferUnknown     = errors.New("cross-promotion offer unknown")
+	ErrAccountUnlinked  = errors.New("shared account not linked")
+	ErrOfferIneligible  = errors.New("cross-promotion offer ineligible")
+)
+
+const reason = "crosspromo"
+
+// Claim is signed by title Source for title Target when the shared
+// account SharedID completes Action in Source. ID is unique per Source, a
+// claim is granted once however often it is sent.
+type Claim struct {
+	ID       string `json:"id"`
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	SharedID string `json:"sharedId"`
+	Action   string `json:"action"`
+	IssuedAt int64  `json:"issuedAt"`
+}
+
+// Request carries a claim as signed, so it is verified over the very
+// bytes Source signed.
+type Request struct {
+	Claim     json.RawMessage `json:"claim" validate:"required"`
+	Signature []byte          `json:"signature" validate:"required"`
+}
+
+// NewRequest signs c for its Target with the signer of the source title.
+func NewRequest(c *Claim, s a5gsession.Signer) (*Request, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	sig, err := s.Sign(b)
+	if err != nil {
+		return nil, err
+	}
+	return &Request{Claim: b, Signature: sig}, nil
+}
+
+// Offer rewards Action of title Source with Currencies and Items; Rule,
+// when set, names a rule players must match, see Promo.Rules.
+type Offer struct {
+	Source     string           `json:"source"`
+	Action     string           `json:"action"`
+	Rule       string           `json:"rule,omitempty"`
+	Currencies map[string]int64 `json:"currencies,omitempty"`
+	Items      map[string]int64 `json:"items,omitempty"`
+}
+
+// Grant records a granted claim.
+type Grant struct {
+	Source    string    `json:"source"`
+	ClaimID   string    `json:"claimId"`
+	Action    string    `json:"action"`
+	AccountID uint64    `json:"accountId"`
+	At        time.Time `json:"at"`
+}
+
+// Store maps shared accounts to accounts of this title and records
+// grants. Record stores g unless a grant of its claim exists, which it
+// returns; Release forgets a grant which failed to apply.
+type Store interface {
+	Link(sharedID string, accountID uint64) error
+	Account(sharedID string) (uint64, error)
+	Record(g *Grant) (*Grant, error)
+	Release(source, claimID string) error
+}
+
+// Promo grants offers of other titles to players of Title. Titles are
+// signers (verifiers suffice, e.g. a5gsession.NewEd25519Verifier) of
+// titles allowed to send claims, by title.
+type Promo struct {
+	Title     string
+	Titles    map[string]a5gsession.Signer
+	Offers    []*Offer
+	Store     Store
+	Wallet    *a5gwallet.Wallet
+	Inventory *a5ginventory.Inventory
+	Logger    a5glogs.Logger
+	// MaxAge bounds how old claims are accepted and how far their clocks
+	// may run ahead.
+	MaxAge time.Duration
+	// Rules evaluates Rule of offers, e.g. (*a5grules.Engine).Match.
+	Rules func(ctx context.Context, accountID uint64, rule string) (bool, error)
+
+	now func() time.Time
+}
+
+func NewPromo(title string, titles map[string]a5gsession.Signer, offers []*Offer,
+	s Store, w *a5gwallet.Wallet, inv *a5ginventory.Inventory,
+	l a5glogs.Logger) (*Promo, error) {
+	if title == "" {
+		return nil, errors.New("empty title")
+	}
+	for _, o := range offers {
+		if o == nil || o.Source == "" || o.Action == "" {
+			return nil, errors.New("invalid cross-promotion offer")
+		}
+		if titles[o.Source] == nil {
+			return nil, errors.Errorf("no signer of title %q", o.Source)
+		}
+		if w == nil && len(o.Currencies) > 0 {
+			return nil, errors.New("wallet missing")
+		}
+		if inv == nil && len(o.Items) > 0 {
+			return nil, errors.New("inventory missing")
+		}
+	}
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Promo{
+		Title:     title,
+		Titles:    titles,
+		Offers:    offers,
+		Store:     s,
+		Wallet:    w,
+		Inventory: inv,
+		Logger:    l,
+		MaxAge:    24 * time.Hour,
+		now:       time.Now}, nil
+}
+
+// Link maps a shared account, e.g. a platform or publisher account, to an
+// account of this title.
+func (p *Promo) Link(sharedID string, accountID uint64) error {
+	if sharedID == "" || accountID == 0 {
+		return errors.New("invalid shared account link")
+	}
+	return p.Store.Link(sharedID, accountID)
+}
+
+// Verify checks the signature, the target and the age of a request.
+func (p *Promo) Verify(r *Request) (*Claim, error) {
+	c := new(Claim)
+	if err := json.Unmarshal(r.Claim, c); err != nil {
+		return nil, errors.Wrap(ErrSignatureInvalid, err.Error())
+	}
+	s := p.Titles[c.Source]
+	if s == nil || !s.Verify(r.Claim, r.Signature) {
+		return nil, errors.WithStack(ErrSignatureInvalid)
+	}
+	if c.Target != p.Title || c.ID == "" || c.SharedID == "" {
+		return nil, errors.Wrap(ErrSignatureInvalid, "claim of another title")
+	}
+	age := p.now().Sub(time.Unix(c.IssuedAt, 0))
+	if age > p.MaxAge || age < -p.MaxAge {
+		return nil, errors.WithStack(ErrClaimExpired)
+	}
+	return c, nil
+}
+
+func (p *Promo) offer(source, action string) *Offer {
+	for _, o := range p.Offers {
+		if o.Source == source && o.Action == action {
+			return o
+		}
+	}
+	return nil
+}
+
+// Redeem grants the offer of a verified claim. A claim granted before
+// returns its first grant, so sources may retry until they get one.
+func (p *Promo) Redeem(ctx context.Context, r *Request) (*Grant, error) {
+	c, err := p.Verify(r)
+	if err != nil {
+		return nil, err
+	}
+	o := p.offer(c.Source, c.Action)
+	if o == nil {
+		return nil, errors.Wrap(ErrOfferUnknown, c.Source+":"+c.Action)
+	}
+	accountID, err := p.Store.Account(c.SharedID)
+	if err != nil {
+		return nil, err
+	}
+	if accountID == 0 {
+		return nil, errors.WithStack(ErrAccountUnlinked)
+	}
+	if err = p.eligible(ctx, accountID, o); err != nil {
+		return nil, err
+	}
+	g := &Grant{
+		Source:    c.Source,
+		ClaimID:   c.ID,
+		Action:    c.Action,
+		AccountID: accountID,
+		At:        p.now().UTC()}
+	prev, err := p.Store.Record(g)
+	if err != nil {
+		return nil, err
+	}
+	if prev != nil {
+		return prev, nil
+	}
+	if err = p.apply(o, g); err != nil {
+		if e := p.Store.Release(g.Source, g.ClaimID); e != nil {
+			p.Logger.Error(e.Error())
+		}
+		return nil, err
+	}
+	return g, nil
+}
+
+// eligible checks Rule of o. The claim isn't recorded, so a player who
+// becomes eligible later may send it again.
+func (p *Promo) eligible(ctx context.Context, accountID uint64, o *Offer) error {
+	if o.Rule == "" {
+		return nil
+	}
+	if p.Rules == nil {
+		return errors.Errorf("offer %s:%s rule func missing", o.Source, o.Action)
+	}
+	ok, err := p.Rules(ctx, accountID, o.Rule)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.Wrap(ErrOfferIneligible, o.Source+":"+o.Action)
+	}
+	return nil
+}
+
+func sorted(m map[string]int64) []string {
+	a := make([]string, 0, len(m))
+	for id := range m {
+		a = append(a, id)
+	}
+	sort.Strings(a)
+	return a
+}
+
+// apply credits currencies first: the wallet is idempotent by transaction
+// ID, so a retry after the inventory failed doesn't credit them twice.
+func (p *Promo) apply(o *Offer, g *Grant) error {
+	ref := reason + ":" + g.Source + ":" + g.ClaimID
+	if len(o.Currencies) > 0 {
+		t := a5gwallet.NewTx(ref, reason+":"+g.Source, reason)
+		for _, id := range sorted(o.Currencies) {
+			t.Credit(id, o.Currencies[id])
+		}
+		if _, err := p.Wallet.Apply(g.AccountID, t); err != nil {
+			return err
+		}
+	}
+	if len(o.Items) > 0 {
+		t := a5ginventory.NewTx(reason, ref).MailOverflow()
+		for _, id := range sorted(o.Items) {
+			t.Grant(id, o.Items[id])
+		}
+		if _, err := p.Inventory.Apply(g.AccountID, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package a5gcrosspromo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestPromoRedeem(t *testing.T) {
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	c, _ := a5gwallet.NewCurrencies(a5gwallet.Currency{ID: "gold"})
+	w, _ := a5gwallet.NewWallet(a5gwallet.NewMemoryStore(), c, l)
+	catalog, _ := a5ginventory.NewCatalogJSON([]byte(`{"items": [{"id": "hat"}]}`))
+	inv, _ := a5ginventory.NewInventory(a5ginventory.NewMemoryStore(), catalog, l)
+	titleA, _ := a5gsession.NewHMACSigner([]byte("0123456789abcdef0123456789abcdef"))
+	other, _ := a5gsession.NewHMACSigner([]byte("fedcba9876543210fedcba9876543210"))
+	p, err := NewPromo("b", map[string]a5gsession.Signer{"a": titleA},
+		[]*Offer{{Source: "a", Action: "level10",
+			Currencies: map[string]int64{"gold": 100},
+			Items:      map[string]int64{"hat": 1}},
+			{Source: "a", Action: "level30", Rule: "new_player",
+				Currencies: map[string]int64{"gold": 500}}},
+		NewMemoryStore(), w, inv, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	p.now = func() time.Time { return now }
+	p.Rules = func(ctx context.Context, accountID uint64, rule string) (bool, error) {
+		return rule != "new_player", nil
+	}
+	if err = p.Link("shared-1", 7); err != nil {
+		t.Fatal(err)
+	}
+
+	claim := func(id, target, shared, action string, age time.Duration) *Claim {
+		return &Claim{ID: id, Source: "a", Target: target, SharedID: shared,
+			Action: action, IssuedAt: now.Add(-age).Unix()}
+	}
+	var a = []struct {
+		name   string
+		claim  *Claim
+		signer a5gsession.Signer
+		err    error
+	}{
+		{"granted", claim("c1", "b", "shared-1", "level10", time.Minute), titleA, nil},
+		{"retried", claim("c1", "b", "shared-1", "level10", 0), titleA, nil},
+		{"forged", claim("c2", "b", "shared-1", "level10", 0), other, ErrSignatureInvalid},
+		{"another title", claim("c3", "c", "shared-1", "level10", 0), titleA,
+			ErrSignatureInvalid},
+		{"expired", claim("c4", "b", "shared-1", "level10", 48*time.Hour), titleA,
+			ErrClaimExpired},
+		{"unlinked", claim("c5", "b", "shared-2", "level10", 0), titleA,
+			ErrAccountUnlinked},
+		{"no offer", claim("c6", "b", "shared-1", "level20", 0), titleA,
+			ErrOfferUnknown},
+		{"ineligible", claim("c7", "b", "shared-1", "level30", 0), titleA,
+			ErrOfferIneligible},
+	}
+	for _, v := range a {
+		r, err := NewRequest(v.claim, v.signer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g, err := p.Redeem(context.Background(), r)
+		if errors.Cause(err) != v.err {
+			t.Errorf("%s: unexpected error %v", v.name, err)
+			continue
+		}
+		if err == nil && (g.AccountID != 7 || g.ClaimID != "c1" || !g.At.Equal(now)) {
+			t.Errorf("%s: unexpected grant %+v", v.name, g)
+		}
+	}
+
+	b, err := w.Balances(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stacks, err := inv.Stacks(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != 1 || b[0].Balance != 100 || len(stacks) != 1 || stacks[0].Quantity != 1 {
+		t.Errorf("unexpected rewards %v %+v", b, stacks)
+	}
+}
@@ -0,0 +1,91 @@
+package a5gcrosspromo
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCodeSignatureInvalid = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4035,
+		Name:     "crosspromo_signature_invalid",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "cross-promotion claim signature invalid"})
+
+	ErrCodeOfferUnknown = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4059,
+		Name:     "crosspromo_offer_unknown",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "cross-promotion offer not found"})
+
+	ErrCodeAccountUnlinked = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4060,
+		Name:     "crosspromo_account_unlinked",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "shared account not linked"})
+
+	ErrCodeClaimExpired = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4251,
+		Name:     "crosspromo_claim_expired",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "cross-promotion claim expired"})
+
+	ErrCodeOfferIneligible = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4284,
+		Name:     "crosspromo_offer_ineligible",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "player not eligible for the cross-promotion offer"})
+)
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeSignatureInvalid, http.StatusForbidden)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeOfferUnknown, http.StatusNotFound)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeAccountUnlinked, http.StatusNotFound)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeClaimExpired, http.StatusUnprocessableEntity)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeOfferIneligible, http.StatusForbidden)
+}
+
+// RedeemHandler grants signed claims of other titles; the signature
+// authenticates the calling title, so it may be mounted on a public
+// route class.
+func (p *Promo) RedeemHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(Request) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			g, err := p.Redeem(ctx, req.Payload.(*Request))
+			if err != nil {
+				return nil, p.apiErrs(err)
+			}
+			return g, nil
+		})
+}
+
+func (p *Promo) apiErrs(err error) []*a5gapi.APIErr {
+	switch errors.Cause(err) {
+	case ErrSignatureInvalid:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeSignatureInvalid, "")}
+	case ErrOfferUnknown:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeOfferUnknown, "")}
+	case ErrAccountUnlinked:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeAccountUnlinked, "")}
+	case ErrClaimExpired:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeClaimExpired, "")}
+	case a5ginventory.ErrInsufficient:
+		return p.Inventory.APIErrs(err)
+	}
+	p.Logger.Error(err.Error())
+	return a5gapi.NewJSONMsgDefautlErrors(err)
+}
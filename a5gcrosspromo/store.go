@@ -0,0 +1,159 @@
+package a5gcrosspromo
+
+import (
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryStore struct {
+	mu       sync.Mutex
+	accounts map[string]uint64
+	grants   map[string]Grant
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{
+		accounts: make(map[string]uint64),
+		grants:   make(map[string]Grant)}
+}
+
+func (s *memoryStore) Link(sharedID string, accountID uint64) error {
+	s.mu.Lock()
+	s.accounts[sharedID] = accountID
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryStore) Account(sharedID string) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.accounts[sharedID], nil
+}
+
+func (s *memoryStore) Record(g *Grant) (*Grant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := g.Source + ":" + g.ClaimID
+	if x, ok := s.grants[k]; ok {
+		return &x, nil
+	}
+	s.grants[k] = *g
+	return nil, nil
+}
+
+func (s *memoryStore) Release(source, claimID string) error {
+	s.mu.Lock()
+	delete(s.grants, source+":"+claimID)
+	s.mu.Unlock()
+	return nil
+}
+
+// dbStore keeps links and grants in MySQL tables:
+//
+//	CREATE TABLE crosspromo_accounts (
+//	  shared_id VARCHAR(128) NOT NULL PRIMARY KEY,
+//	  account_id BIGINT UNSIGNED NOT NULL);
+//
+//	CREATE TABLE crosspromo_grants (
+//	  source VARCHAR(32) NOT NULL,
+//	  claim_id VARCHAR(64) NOT NULL,
+//	  action VARCHAR(64) NOT NULL,
+//	  account_id BIGINT UNSIGNED NOT NULL,
+//	  created_at DATETIME NOT NULL,
+//	  PRIMARY KEY (source, claim_id),
+//	  KEY (account_id));
+type dbStore struct {
+	pooler            a5gdb.Pooler
+	accountsTableName string
+	grantsTableName   string
+}
+
+type dbGrant struct {
+	Source    string    `db:"source"`
+	ClaimID   string    `db:"claim_id"`
+	Action    string    `db:"action"`
+	AccountID uint64    `db:"account_id"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+func NewDBStore(
+	p a5gdb.Pooler, accountsTableName, grantsTableName string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if accountsTableName == "" || grantsTableName == "" {
+		return nil, errors.New("empty cross-promotion table name")
+	}
+	return &dbStore{
+		pooler:            p,
+		accountsTableName: accountsTableName,
+		grantsTableName:   grantsTableName}, nil
+}
+
+func (s *dbStore) Link(sharedID string, accountID uint64) error {
+	_, err := s.pooler.WritePool().NewSession().InsertBySql("INSERT INTO "+
+		s.accountsTableName+" (shared_id, account_id) VALUES (?, ?)"+
+		" ON DUPLICATE KEY UPDATE account_id = VALUES(account_id)",
+		sharedID, accountID).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	return nil
+}
+
+func (s *dbStore) Account(sharedID string) (uint64, error) {
+	var id uint64
+	err := s.pooler.ReadPool().NewSession().Select("account_id").
+		From(s.accountsTableName).Where(dbr.Eq("shared_id", sharedID)).LoadOne(&id)
+	if err == dbr.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	return id, nil
+}
+
+func (s *dbStore) Record(g *Grant) (*Grant, error) {
+	sess := s.pooler.WritePool().NewSession()
+	res, err := sess.InsertBySql("INSERT IGNORE INTO "+s.grantsTableName+
+		" (source, claim_id, action, account_id, created_at) VALUES (?, ?, ?, ?, ?)",
+		g.Source, g.ClaimID, g.Action, g.AccountID, g.At).Exec()
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	if n == 1 {
+		return nil, nil
+	}
+	x := new(dbGrant)
+	err = sess.Select("source", "claim_id", "action", "account_id", "created_at").
+		From(s.grantsTableName).
+		Where(dbr.Eq("source", g.Source)).
+		Where(dbr.Eq("claim_id", g.ClaimID)).LoadOne(x)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	return &Grant{
+		Source:    x.Source,
+		ClaimID:   x.ClaimID,
+		Action:    x.Action,
+		AccountID: x.AccountID,
+		At:        x.CreatedAt}, nil
+}
+
+func (s *dbStore) Release(source, claimID string) error {
+	_, err := s.pooler.WritePool().NewSession().DeleteFrom(s.grantsTableName).
+		Where(dbr.Eq("source", source)).Where(dbr.Eq("claim_id", claimID)).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*DeleteStmt).Exec fn")
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package a5gcursor
+
+import (
+	"net/http"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCodeCursorInvalid = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4001,
+		Name:     "cursor_invalid",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "invalid cursor"})
+
+	ErrCodeCursorExpired = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4002,
+		Name:     "cursor_expired",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "cursor expired"})
+)
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeCursorInvalid, http.StatusBadRequest)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeCursorExpired, http.StatusBadRequest)
+}
+
+// APIErr converts Decode errors to public API errors.
+func APIErr(err error) *a5gapi.APIErr {
+	if errors.Cause(err) == ErrCursorExpired {
+		return a5gapi.NewErr(ErrCodeCursorExpired, "")
+	}
+	return a5gapi.NewErr(ErrCodeCursorInvalid, "")
+}
@@ -0,0 +1,102 @@
+package a5gcursor
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCursorInvalid = errors.New("invalid cursor")
+	ErrCursorExpired = errors.New("cursor expired")
+)
+
+type envelope struct {
+	Kind      string          `json:"k"`
+	OwnerID   uint64          `json:"o"`
+	ExpiresAt int64           `json:"e"`
+	State     json.RawMessage `json:"s"`
+}
+
+// Cursors encodes list iteration state into opaque tokens. A token is
+// signed and bound to its list kind and owner (player) id, so clients can
+// neither forge offsets nor replay a cursor of another list or player.
+type Cursors struct {
+	TTL time.Duration
+
+	secretKey []byte
+	now       func() time.Time
+}
+
+func NewCursors(secretKey []byte) (*Cursors, error) {
+	if len(secretKey) < 32 {
+		return nil, errors.New("cursor secret key is shorter than 32 bytes")
+	}
+	return &Cursors{
+		TTL:       time.Hour,
+		secretKey: append([]byte(nil), secretKey...),
+		now:       time.Now}, nil
+}
+
+// Encode serializes state (any JSON-marshalable value) for the next page
+// of kind list of ownerID.
+func (c *Cursors) Encode(
+	kind string, ownerID uint64, state interface{}) (string, error) {
+	s, err := json.Marshal(state)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	b, err := json.Marshal(&envelope{
+		Kind:      kind,
+		OwnerID:   ownerID,
+		ExpiresAt: c.now().Add(c.TTL).Unix(),
+		State:     s})
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	body := base64.RawURLEncoding.EncodeToString(b)
+	return body + "." + base64.RawURLEncoding.EncodeToString(c.sign(body)), nil
+}
+
+// Decode verifies the token and unmarshals its state into v.
+func (c *Cursors) Decode(
+	token, kind string, ownerID uint64, v interface{}) error {
+	i := strings.LastIndexByte(token, '.')
+	if i < 1 {
+		return ErrCursorInvalid
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(token[i+1:])
+	if err != nil || !hmac.Equal(sig, c.sign(token[:i])) {
+		return ErrCursorInvalid
+	}
+	b, err := base64.RawURLEncoding.DecodeString(token[:i])
+	if err != nil {
+		return ErrCursorInvalid
+	}
+	e := new(envelope)
+	if err = json.Unmarshal(b, e); err != nil {
+		return ErrCursorInvalid
+	}
+	if e.Kind != kind || e.OwnerID != ownerID {
+		return ErrCursorInvalid
+	}
+	if c.now().Unix() >= e.ExpiresAt {
+		return ErrCursorExpired
+	}
+	if err = json.Unmarshal(e.State, v); err != nil {
+		return errors.Wrap(ErrCursorInvalid, err.Error())
+	}
+	return nil
+}
+
+func (c *Cursors) sign(body string) []byte {
+	h := hmac.New(sha256.New, c.secretKey)
+	// hash.Hash writes never fail.
+	_, _ = h.Write([]byte(body))
+	return h.Sum(nil)
+}
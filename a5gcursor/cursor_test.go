@@ -0,0 +1,58 @@
+package a5gcursor
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+)
+
+type testState struct {
+	Offset int `json:"offset"`
+}
+
+func TestCursorsPage(t *testing.T) {
+	c, err := NewCursors(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	p, err := c.NextPage("inventory", 7, 20, true, nil, &testState{Offset: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := PageLimits{Default: 20, Max: 50}
+	var a = []struct {
+		page   *a5gapi.PageRequest
+		owner  uint64
+		after  time.Duration
+		limit  int
+		offset int
+		code   a5gapi.APIErrCode
+	}{
+		{nil, 7, 0, 20, 0, 0},
+		{&a5gapi.PageRequest{Limit: 100}, 7, 0, 50, 0, 0},
+		{&a5gapi.PageRequest{Limit: -1}, 7, 0, 0, 0, a5ghttp.ErrCodeRequestMalformed},
+		{&a5gapi.PageRequest{Cursor: p.Cursor, Limit: 10}, 7, 0, 10, 20, 0},
+		{&a5gapi.PageRequest{Cursor: p.Cursor}, 8, 0, 0, 0, ErrCodeCursorInvalid},
+		{&a5gapi.PageRequest{Cursor: p.Cursor + "x"}, 7, 0, 0, 0, ErrCodeCursorInvalid},
+		{&a5gapi.PageRequest{Cursor: p.Cursor}, 7, 2 * time.Hour, 0, 0, ErrCodeCursorExpired},
+	}
+	for i, v := range a {
+		c.now = func() time.Time { return now.Add(v.after) }
+		s := new(testState)
+		limit, _, e := c.ParsePage(
+			&a5gapi.APIMsgRequest{Page: v.page}, "inventory", v.owner, l, s)
+		var code a5gapi.APIErrCode
+		if e != nil {
+			code = a5gapi.APIErrCode(e.Code)
+		}
+		if limit != v.limit || s.Offset != v.offset || code != v.code {
+			t.Errorf("#%d: ParsePage => %d %d %d want %d %d %d",
+				i, limit, s.Offset, code, v.limit, v.offset, v.code)
+		}
+	}
+}
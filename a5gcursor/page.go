@@ -0,0 +1,63 @@
+package a5gcursor
+
+import (
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+)
+
+// PageLimits are page size bounds of a list endpoint, usually from the
+// server config.
+type PageLimits struct {
+	Default int
+	Max     int
+}
+
+// Limit returns the requested limit within bounds: missing means Default,
+// too large means Max, negative is malformed.
+func (l PageLimits) Limit(req *a5gapi.APIMsgRequest) (int, *a5gapi.APIErr) {
+	if req.Page == nil || req.Page.Limit == 0 {
+		return l.Default, nil
+	}
+	if req.Page.Limit < 0 {
+		return 0, a5gapi.NewErr(a5ghttp.ErrCodeRequestMalformed,
+			"negative page limit %d", req.Page.Limit)
+	}
+	if req.Page.Limit > l.Max {
+		return l.Max, nil
+	}
+	return req.Page.Limit, nil
+}
+
+// ParsePage reads page request of kind list of ownerID: the bounded limit
+// and, unless the first page is requested, the cursor state into state.
+func (c *Cursors) ParsePage(
+	req *a5gapi.APIMsgRequest, kind string, ownerID uint64, l PageLimits,
+	state interface{}) (limit int, isFirst bool, e *a5gapi.APIErr) {
+	if limit, e = l.Limit(req); e != nil {
+		return 0, false, e
+	}
+	if req.Page == nil || req.Page.Cursor == "" {
+		return limit, true, nil
+	}
+	if err := c.Decode(req.Page.Cursor, kind, ownerID, state); err != nil {
+		return 0, false, APIErr(err)
+	}
+	return limit, false, nil
+}
+
+// NextPage describes a served page; the cursor of state is encoded only
+// when there is more to serve. total may be nil.
+func (c *Cursors) NextPage(
+	kind string, ownerID uint64, limit int, hasMore bool, total *int64,
+	state interface{}) (*a5gapi.Page, error) {
+	p := &a5gapi.Page{Limit: limit, Total: total, HasMore: hasMore}
+	if !hasMore {
+		return p, nil
+	}
+	s, err := c.Encode(kind, ownerID, state)
+	if err != nil {
+		return nil, err
+	}
+	p.Cursor = s
+	return p, nil
+}
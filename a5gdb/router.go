@@ -0,0 +1,128 @@
+package a5gdb
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+var ErrResidency = errors.New("data residency violated")
+
+// Data categories of RouterConfig.Pinned.
+const (
+	CategoryPII       = "pii"
+	CategoryPayments  = "payments"
+	CategoryChat      = "chat"
+	CategoryGameplay  = "gameplay"
+	CategoryAnalytics = "analytics"
+)
+
+// RouterConfig lays out shards over regions. Regions lists shard names
+// of each region, a shard lives in a single region. Pinned lists
+// regions per data category whose players' data of that category must
+// stay in their region, e.g. {"pii": ["eu", "cn"]}; other data goes to
+// the shards of DefaultRegion.
+type RouterConfig struct {
+	DefaultRegion string              `json:"defaultRegion"`
+	Regions       map[string][]string `json:"regions"`
+	Pinned        map[string][]string `json:"pinned"`
+}
+
+// Router picks shards aware of data residency: data of a pinned category
+// of a player from a pinned region is only ever routed to shards of that
+// region.
+type Router struct {
+	DefaultRegion string
+
+	regions map[string][]Pooler
+	pinned  map[string]map[string]bool
+}
+
+// NewRouter builds a Router of c over shards by their names.
+func NewRouter(c *RouterConfig, shards map[string]Pooler) (*Router, error) {
+	if c == nil {
+		return nil, errors.New("router config missing")
+	}
+	r := &Router{
+		DefaultRegion: c.DefaultRegion,
+		regions:       make(map[string][]Pooler, len(c.Regions)),
+		pinned:        make(map[string]map[string]bool, len(c.Pinned))}
+	owner := make(map[string]string)
+	for region, names := range c.Regions {
+		if len(names) == 0 {
+			return nil, errors.Errorf("region %q without shards", region)
+		}
+		for _, name := range names {
+			p, ok := shards[name]
+			if !ok || p == nil {
+				return nil, errors.Errorf("region %q: shard %q missing", region, name)
+			}
+			if x, ok := owner[name]; ok {
+				return nil, errors.Errorf("shard %q in regions %q and %q", name, x, region)
+			}
+			owner[name] = region
+			r.regions[region] = append(r.regions[region], p)
+		}
+	}
+	if _, ok := r.regions[c.DefaultRegion]; !ok {
+		return nil, errors.Errorf("default region %q without shards", c.DefaultRegion)
+	}
+	for category, regions := range c.Pinned {
+		r.pinned[category] = make(map[string]bool, len(regions))
+		for _, region := range regions {
+			if _, ok := r.regions[region]; !ok {
+				return nil, errors.Wrapf(ErrResidency,
+					"category %q pinned to region %q without shards", category, region)
+			}
+			r.pinned[category][region] = true
+		}
+	}
+	return r, nil
+}
+
+// Region returns the region storing data of category of players from
+// region.
+func (r *Router) Region(category, region string) string {
+	if r.pinned[category][region] {
+		return region
+	}
+	return r.DefaultRegion
+}
+
+// Pooler returns the shard of key, e.g. an account ID, for data of
+// category of a player from region.
+func (r *Router) Pooler(category, region string, key uint64) (Pooler, error) {
+	a := r.regions[r.Region(category, region)]
+	if len(a) == 0 {
+		return nil, errors.Wrapf(ErrResidency, "category %q of region %q", category, region)
+	}
+	return a[key%uint64(len(a))], nil
+}
+
+// Shards returns every shard storing data of category of players from
+// region, e.g. to purge or export it.
+func (r *Router) Shards(category, region string) []Pooler {
+	return r.regions[r.Region(category, region)]
+}
+
+// Pinned lists regions category is pinned to.
+func (r *Router) Pinned(category string) []string {
+	a := make([]string, 0, len(r.pinned[category]))
+	for region := range r.pinned[category] {
+		a = append(a, region)
+	}
+	sort.Strings(a)
+	return a
+}
+
+// Validate validates every shard.
+func (r *Router) Validate() error {
+	for region, a := range r.regions {
+		for _, p := range a {
+			if err := p.Validate(); err != nil {
+				return errors.Wrapf(err, "region %q", region)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package a5gdb
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+type testPooler struct {
+	Connector
+	name string
+}
+
+func (p *testPooler) ReadPool() Connector  { return p.Connector }
+func (p *testPooler) WritePool() Connector { return p.Connector }
+func (p *testPooler) Validate() error      { return nil }
+
+func TestRouter(t *testing.T) {
+	shards := make(map[string]Pooler)
+	for _, name := range []string{"us-1", "us-2", "eu-1", "eu-2", "cn-1"} {
+		shards[name] = &testPooler{name: name}
+	}
+	c := &RouterConfig{
+		DefaultRegion: "us",
+		Regions: map[string][]string{
+			"us": {"us-1", "us-2"}, "eu": {"eu-1", "eu-2"}, "cn": {"cn-1"}},
+		Pinned: map[string][]string{
+			CategoryPII: {"eu", "cn"}, CategoryPayments: {"cn"}}}
+	r, err := NewRouter(c, shards)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		category, region string
+		key              uint64
+		shard            string
+	}{
+		{CategoryPII, "eu", 1, "eu-2"},
+		{CategoryPII, "eu", 2, "eu-1"},
+		{CategoryPII, "cn", 7, "cn-1"},
+		{CategoryPII, "br", 1, "us-2"},
+		{CategoryPayments, "eu", 2, "us-1"},
+		{CategoryPayments, "cn", 2, "cn-1"},
+		{CategoryGameplay, "cn", 3, "us-2"},
+	}
+	for _, test := range tests {
+		p, err := r.Pooler(test.category, test.region, test.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name := p.(*testPooler).name; name != test.shard {
+			t.Errorf("%s of %s: unexpected shard %q", test.category, test.region, name)
+		}
+	}
+
+	c.Pinned[CategoryChat] = []string{"ru"}
+	if _, err = NewRouter(c, shards); errors.Cause(err) != ErrResidency {
+		t.Errorf("unexpected error %v", err)
+	}
+	delete(c.Pinned, CategoryChat)
+	c.Regions["cn"] = []string{"cn-1", "eu-1"}
+	if _, err = NewRouter(c, shards); err == nil {
+		t.Error("unexpected shard shared by regions")
+	}
+}
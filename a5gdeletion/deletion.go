@@ -0,0 +1,295 @@
+package a5gdeletion
+
+import (
+	"context"
+	"time"
+
+	"github.com/armor5games/a5g/a5gjobs"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+// JobKind is the a5gjobs kind of purge runs, see Deletions.JobHandler.
+const JobKind = "account_deletion_purge"
+
+var (
+	ErrNotPending     = errors.New("account deletion not pending")
+	ErrAlreadyPending = errors.New("account deletion already pending")
+	ErrExpired        = errors.New("account deletion grace period expired")
+)
+
+// Statuses of a deletion. Restoring and purging claim a pending deletion
+// so a restore and a purge never run on the same account at once.
+const (
+	StatusPending   = "pending"
+	StatusRestoring = "restoring"
+	StatusRestored  = "restored"
+	StatusPurging   = "purging"
+	StatusPurged    = "purged"
+)
+
+// Deletion is an account deletion request, times are unix seconds.
+type Deletion struct {
+	AccountID   uint64 `json:"accountId" db:"account_id"`
+	Status      string `json:"status" db:"status"`
+	RequestedAt int64  `json:"requestedAt" db:"requested_at"`
+	PurgeAt     int64  `json:"purgeAt" db:"purge_at"`
+}
+
+// Module is the part of a module in account deletion. Deactivate hides
+// the account data, e.g. from leaderboards and friend lists, Restore
+// brings it back and Purge erases it for good. Every call is retried on
+// errors, so they must be idempotent.
+type Module interface {
+	Deactivate(ctx context.Context, accountID uint64) error
+	Restore(ctx context.Context, accountID uint64) error
+	Purge(ctx context.Context, accountID uint64) error
+}
+
+// ModuleFuncs adapts functions to Module, nil ones do nothing, e.g. for
+// modules having nothing to hide until the purge.
+type ModuleFuncs struct {
+	DeactivateFunc func(ctx context.Context, accountID uint64) error
+	RestoreFunc    func(ctx context.Context, accountID uint64) error
+	PurgeFunc      func(ctx context.Context, accountID uint64) error
+}
+
+func (m *ModuleFuncs) Deactivate(ctx context.Context, accountID uint64) error {
+	if m.DeactivateFunc == nil {
+		return nil
+	}
+	return m.DeactivateFunc(ctx, accountID)
+}
+
+func (m *ModuleFuncs) Restore(ctx context.Context, accountID uint64) error {
+	if m.RestoreFunc == nil {
+		return nil
+	}
+	return m.RestoreFunc(ctx, accountID)
+}
+
+func (m *ModuleFuncs) Purge(ctx context.Context, accountID uint64) error {
+	if m.PurgeFunc == nil {
+		return nil
+	}
+	return m.PurgeFunc(ctx, accountID)
+}
+
+// Store keeps deletions. Create stores d unless the account has a
+// deletion which is not restored and reports false then. Swap changes the
+// status of a deletion from one to another and reports false when it was
+// not in from. Due returns up to limit pending or purging deletions with
+// PurgeAt at or before now.
+type Store interface {
+	Create(d *Deletion) (bool, error)
+	Get(accountID uint64) (*Deletion, error)
+	Swap(accountID uint64, from, to string) (bool, error)
+	Due(now int64, limit int) ([]*Deletion, error)
+}
+
+type module struct {
+	name string
+	m    Module
+}
+
+// Deletions soft deletes accounts: a requested deletion deactivates the
+// account in every module right away and purges it after Grace unless it
+// is restored before.
+type Deletions struct {
+	Store  Store
+	Logger a5glogs.Logger
+	Grace  time.Duration
+
+	modules []*module
+	now     func() time.Time
+}
+
+func NewDeletions(s Store, l a5glogs.Logger) (*Deletions, error) {
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Deletions{Store: s, Logger: l, Grace: 30 * 24 * time.Hour, now: time.Now}, nil
+}
+
+// Register adds a module, modules are deactivated in the order they are
+// registered and restored in reverse.
+func (d *Deletions) Register(name string, m Module) error {
+	if name == "" || m == nil {
+		return errors.New("empty deletion module")
+	}
+	for _, x := range d.modules {
+		if x.name == name {
+			return errors.Errorf("duplicate deletion module %q", name)
+		}
+	}
+	d.modules = append(d.modules, &module{name: name, m: m})
+	return nil
+}
+
+// Get returns the deletion of an account, nil when there is none.
+func (d *Deletions) Get(accountID uint64) (*Deletion, error) {
+	return d.Store.Get(accountID)
+}
+
+// Request deletes an account softly. When a module fails to deactivate
+// it, the modules deactivated so far are restored and the request is
+// dropped, leaving the account as it was.
+func (d *Deletions) Request(ctx context.Context, accountID uint64) (*Deletion, error) {
+	now := d.now()
+	x := &Deletion{
+		AccountID:   accountID,
+		Status:      StatusPending,
+		RequestedAt: now.Unix(),
+		PurgeAt:     now.Add(d.Grace).Unix()}
+	ok, err := d.Store.Create(x)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.Wrapf(ErrAlreadyPending, "account %d", accountID)
+	}
+	if i, err := d.deactivate(ctx, accountID); err != nil {
+		if _, err := d.restore(ctx, accountID, i); err != nil {
+			d.Logger.Error(err.Error())
+		}
+		if _, err := d.Store.Swap(accountID, StatusPending, StatusRestored); err != nil {
+			d.Logger.Error(err.Error())
+		}
+		return nil, err
+	}
+	return x, nil
+}
+
+// Restore reactivates an account during its grace period. When a module
+// fails to restore it, the modules restored so far are deactivated
+// again and the deletion stays pending, so Restore may be retried.
+func (d *Deletions) Restore(ctx context.Context, accountID uint64) error {
+	x, err := d.Store.Get(accountID)
+	if err != nil {
+		return err
+	}
+	if x == nil || x.Status != StatusPending {
+		return errors.Wrapf(ErrNotPending, "account %d", accountID)
+	}
+	if x.PurgeAt <= d.now().Unix() {
+		return errors.Wrapf(ErrExpired, "account %d", accountID)
+	}
+	ok, err := d.Store.Swap(accountID, StatusPending, StatusRestoring)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.Wrapf(ErrNotPending, "account %d", accountID)
+	}
+	if i, err := d.restore(ctx, accountID, len(d.modules)); err != nil {
+		for _, m := range d.modules[i:] {
+			if err := m.m.Deactivate(ctx, accountID); err != nil {
+				d.Logger.Error(errors.Wrapf(err, "deactivate %s", m.name).Error())
+			}
+		}
+		if _, err := d.Store.Swap(accountID, StatusRestoring, StatusPending); err != nil {
+			d.Logger.Error(err.Error())
+		}
+		return err
+	}
+	_, err = d.Store.Swap(accountID, StatusRestoring, StatusRestored)
+	return err
+}
+
+// deactivate deactivates an account in every module and returns the
+// count of modules it did before failing.
+func (d *Deletions) deactivate(ctx context.Context, accountID uint64) (int, error) {
+	for i, m := range d.modules {
+		if err := m.m.Deactivate(ctx, accountID); err != nil {
+			return i, errors.Wrapf(err, "deactivate %s", m.name)
+		}
+	}
+	return len(d.modules), nil
+}
+
+// restore restores an account in the first n modules in reverse and
+// returns the index from which modules are restored, 0 on success.
+func (d *Deletions) restore(ctx context.Context, accountID uint64, n int) (int, error) {
+	for i := n - 1; i >= 0; i-- {
+		m := d.modules[i]
+		if err := m.m.Restore(ctx, accountID); err != nil {
+			return i + 1, errors.Wrapf(err, "restore %s", m.name)
+		}
+	}
+	return 0, nil
+}
+
+// Purge erases accounts whose grace period expired in batches of
+// batchSize. A failed purge stays due and is retried by the next run.
+func (d *Deletions) Purge(ctx context.Context, batchSize int) (int, error) {
+	var total int
+	now := d.now().Unix()
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, errors.WithStack(err)
+		}
+		a, err := d.Store.Due(now, batchSize)
+		if err != nil {
+			return total, err
+		}
+		var failed int
+		for _, x := range a {
+			ok, err := d.purge(ctx, x)
+			if err != nil {
+				d.Logger.Error(err.Error())
+				failed++
+				continue
+			}
+			if ok {
+				total++
+			}
+		}
+		if len(a) < batchSize || failed > 0 {
+			return total, nil
+		}
+	}
+}
+
+// purge erases an account in every module, reporting false when a
+// restore claimed it first.
+func (d *Deletions) purge(ctx context.Context, x *Deletion) (bool, error) {
+	if x.Status == StatusPending {
+		ok, err := d.Store.Swap(x.AccountID, StatusPending, StatusPurging)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	for _, m := range d.modules {
+		if err := m.m.Purge(ctx, x.AccountID); err != nil {
+			return false, errors.Wrapf(err, "purge %s of account %d", m.name, x.AccountID)
+		}
+	}
+	return d.Store.Swap(x.AccountID, StatusPurging, StatusPurged)
+}
+
+// NewJob makes a purge run for JobHandler, enqueue it daily.
+func NewJob(maxAttempts int) (*a5gjobs.Job, error) {
+	return a5gjobs.NewJob(JobKind, nil, a5gjobs.PriorityLow, maxAttempts)
+}
+
+// JobHandler purges due deletions in batches of batchSize, failing the
+// job when a purge failed so that it is retried.
+func (d *Deletions) JobHandler(batchSize int) a5gjobs.HandlerFunc {
+	return func(ctx context.Context, j *a5gjobs.Job) error {
+		_, err := d.Purge(ctx, batchSize)
+		if err != nil {
+			return err
+		}
+		a, err := d.Store.Due(d.now().Unix(), 1)
+		if err != nil {
+			return err
+		}
+		if len(a) > 0 {
+			return errors.Errorf("account %d purge failed", a[0].AccountID)
+		}
+		return nil
+	}
+}
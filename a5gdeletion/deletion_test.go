@@ -0,0 +1,132 @@
+package a5gdeletion
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// testModule keeps account states: "active", "inactive" or "purged".
+type testModule struct {
+	states map[uint64]string
+	fail   map[string]bool
+}
+
+func newTestModule() *testModule {
+	return &testModule{states: make(map[uint64]string), fail: make(map[string]bool)}
+}
+
+func (m *testModule) set(op string, accountID uint64, state string) error {
+	if m.fail[op] {
+		return errors.New(op + " failed")
+	}
+	m.states[accountID] = state
+	return nil
+}
+
+func (m *testModule) Deactivate(ctx context.Context, accountID uint64) error {
+	return m.set("deactivate", accountID, "inactive")
+}
+
+func (m *testModule) Restore(ctx context.Context, accountID uint64) error {
+	return m.set("restore", accountID, "active")
+}
+
+func (m *testModule) Purge(ctx context.Context, accountID uint64) error {
+	return m.set("purge", accountID, "purged")
+}
+
+func TestDeletions(t *testing.T) {
+	d, err := NewDeletions(NewMemoryStore(), a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1600000000, 0)
+	d.now = func() time.Time { return now }
+	d.Grace = 24 * time.Hour
+	wallet, chat := newTestModule(), newTestModule()
+	if err = d.Register("wallet", wallet); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Register("chat", chat); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	states := func(accountID uint64) string {
+		return wallet.states[accountID] + "," + chat.states[accountID]
+	}
+
+	// A failed deactivation leaves the account as it was.
+	chat.fail["deactivate"] = true
+	if _, err = d.Request(ctx, 1); err == nil {
+		t.Fatal("unexpected request success")
+	}
+	if s := states(1); s != "active," {
+		t.Errorf("unexpected states %q", s)
+	}
+	chat.fail["deactivate"] = false
+
+	if _, err = d.Request(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Request(ctx, 1); errors.Cause(err) != ErrAlreadyPending {
+		t.Errorf("unexpected error %v", err)
+	}
+	if s := states(1); s != "inactive,inactive" {
+		t.Errorf("unexpected states %q", s)
+	}
+
+	// A failed restore deactivates the restored modules again.
+	wallet.fail["restore"] = true
+	if err = d.Restore(ctx, 1); err == nil {
+		t.Fatal("unexpected restore success")
+	}
+	if s := states(1); s != "inactive,inactive" {
+		t.Errorf("unexpected states %q", s)
+	}
+	wallet.fail["restore"] = false
+	if err = d.Restore(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if s := states(1); s != "active,active" {
+		t.Errorf("unexpected states %q", s)
+	}
+	if err = d.Restore(ctx, 1); errors.Cause(err) != ErrNotPending {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// Deleted again, restores end with the grace period and purges start.
+	for _, id := range []uint64{1, 2} {
+		if _, err = d.Request(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now = now.Add(d.Grace)
+	if err = d.Restore(ctx, 1); errors.Cause(err) != ErrExpired {
+		t.Errorf("unexpected error %v", err)
+	}
+	chat.fail["purge"] = true
+	if err = d.JobHandler(1)(ctx, nil); err == nil {
+		t.Error("unexpected job success")
+	}
+	chat.fail["purge"] = false
+	if err = d.JobHandler(1)(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []uint64{1, 2} {
+		if s := states(id); s != "purged,purged" {
+			t.Errorf("%d: unexpected states %q", id, s)
+		}
+		x, err := d.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if x.Status != StatusPurged {
+			t.Errorf("%d: unexpected status %q", id, x.Status)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package a5gdeletion
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCodeNotPending = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4276,
+		Name:     "account_deletion_not_pending",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "account deletion is not pending"})
+
+	ErrCodeAlreadyPending = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4277,
+		Name:     "account_deletion_pending",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "account deletion is already pending"})
+
+	ErrCodeExpired = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4278,
+		Name:     "account_deletion_expired",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "account deletion grace period is over"})
+)
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeNotPending, http.StatusConflict)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeAlreadyPending, http.StatusConflict)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeExpired, http.StatusGone)
+}
+
+// RequestHandler deletes the account of the session player softly.
+func (d *Deletions) RequestHandler() a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		s, ok := a5gsession.FromContext(ctx)
+		if !ok {
+			return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+		}
+		x, err := d.Request(ctx, s.AccountID)
+		if err != nil {
+			return nil, d.apiErrs(err)
+		}
+		return x, nil
+	}
+}
+
+// RestoreHandler reactivates the account of the session player. Sessions
+// of accounts pending deletion should be limited to it and
+// StatusHandler.
+func (d *Deletions) RestoreHandler() a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		s, ok := a5gsession.FromContext(ctx)
+		if !ok {
+			return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+		}
+		if err := d.Restore(ctx, s.AccountID); err != nil {
+			return nil, d.apiErrs(err)
+		}
+		x, err := d.Get(s.AccountID)
+		if err != nil {
+			return nil, d.apiErrs(err)
+		}
+		return x, nil
+	}
+}
+
+// StatusHandler answers with the deletion of the session player account,
+// null when there is none.
+func (d *Deletions) StatusHandler() a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		s, ok := a5gsession.FromContext(ctx)
+		if !ok {
+			return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+		}
+		x, err := d.Get(s.AccountID)
+		if err != nil {
+			return nil, d.apiErrs(err)
+		}
+		return x, nil
+	}
+}
+
+func (d *Deletions) apiErrs(err error) []*a5gapi.APIErr {
+	switch errors.Cause(err) {
+	case ErrNotPending:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeNotPending, "")}
+	case ErrAlreadyPending:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeAlreadyPending, "")}
+	case ErrExpired:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeExpired, "")}
+	}
+	d.Logger.Error(err.Error())
+	return a5gapi.NewJSONMsgDefautlErrors(err)
+}
@@ -0,0 +1,162 @@
+package a5gdeletion
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryStore struct {
+	mu        sync.Mutex
+	deletions map[uint64]Deletion
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{deletions: make(map[uint64]Deletion)}
+}
+
+func (s *memoryStore) Create(d *Deletion) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if x, ok := s.deletions[d.AccountID]; ok && x.Status != StatusRestored {
+		return false, nil
+	}
+	s.deletions[d.AccountID] = *d
+	return true, nil
+}
+
+func (s *memoryStore) Get(accountID uint64) (*Deletion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	x, ok := s.deletions[accountID]
+	if !ok {
+		return nil, nil
+	}
+	return &x, nil
+}
+
+func (s *memoryStore) Swap(accountID uint64, from, to string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	x, ok := s.deletions[accountID]
+	if !ok || x.Status != from {
+		return false, nil
+	}
+	x.Status = to
+	s.deletions[accountID] = x
+	return true, nil
+}
+
+func (s *memoryStore) Due(now int64, limit int) ([]*Deletion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := []*Deletion{}
+	for _, x := range s.deletions {
+		if x.PurgeAt <= now &&
+			(x.Status == StatusPending || x.Status == StatusPurging) {
+			y := x
+			a = append(a, &y)
+		}
+	}
+	sort.Slice(a, func(i, j int) bool {
+		if a[i].PurgeAt != a[j].PurgeAt {
+			return a[i].PurgeAt < a[j].PurgeAt
+		}
+		return a[i].AccountID < a[j].AccountID
+	})
+	if len(a) > limit {
+		a = a[:limit]
+	}
+	return a, nil
+}
+
+// dbStore keeps deletions in a MySQL table:
+//
+//	CREATE TABLE account_deletions (
+//	  account_id BIGINT UNSIGNED NOT NULL PRIMARY KEY,
+//	  status VARCHAR(16) NOT NULL,
+//	  requested_at BIGINT NOT NULL,
+//	  purge_at BIGINT NOT NULL,
+//	  KEY due (status, purge_at));
+type dbStore struct {
+	pooler    a5gdb.Pooler
+	tableName string
+}
+
+func NewDBStore(p a5gdb.Pooler, tableName string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if tableName == "" {
+		return nil, errors.New("empty account deletions table name")
+	}
+	return &dbStore{pooler: p, tableName: tableName}, nil
+}
+
+// Create replaces a restored deletion only; status is assigned last since
+// MySQL evaluates the assignments in order.
+func (s *dbStore) Create(d *Deletion) (bool, error) {
+	res, err := s.pooler.WritePool().NewSession().InsertBySql("INSERT INTO "+
+		s.tableName+" (account_id, status, requested_at, purge_at)"+
+		" VALUES (?, ?, ?, ?) ON DUPLICATE KEY UPDATE"+
+		" requested_at = IF(status = ?, VALUES(requested_at), requested_at),"+
+		" purge_at = IF(status = ?, VALUES(purge_at), purge_at),"+
+		" status = IF(status = ?, VALUES(status), status)",
+		d.AccountID, d.Status, d.RequestedAt, d.PurgeAt,
+		StatusRestored, StatusRestored, StatusRestored).Exec()
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	return n > 0, nil
+}
+
+func (s *dbStore) Get(accountID uint64) (*Deletion, error) {
+	x := new(Deletion)
+	err := s.pooler.ReadPool().NewSession().
+		Select("account_id", "status", "requested_at", "purge_at").
+		From(s.tableName).Where(dbr.Eq("account_id", accountID)).LoadOne(x)
+	if err == dbr.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	return x, nil
+}
+
+func (s *dbStore) Swap(accountID uint64, from, to string) (bool, error) {
+	res, err := s.pooler.WritePool().NewSession().
+		Update(s.tableName).Set("status", to).
+		Where(dbr.Eq("account_id", accountID)).
+		Where(dbr.Eq("status", from)).Exec()
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.(*UpdateStmt).Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	return n > 0, nil
+}
+
+func (s *dbStore) Due(now int64, limit int) ([]*Deletion, error) {
+	a := []*Deletion{}
+	_, err := s.pooler.ReadPool().NewSession().
+		Select("account_id", "status", "requested_at", "purge_at").
+		From(s.tableName).
+		Where(dbr.Eq("status", []string{StatusPending, StatusPurging})).
+		Where(dbr.Lte("purge_at", now)).
+		OrderAsc("purge_at").OrderAsc("account_id").
+		Limit(uint64(limit)).Load(&a)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	return a, nil
+}
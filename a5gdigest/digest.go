@@ -0,0 +1,245 @@
+package a5gdigest
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+// Modes of low-priority notification delivery a player picks. Off drops
+// them, urgent notifications are sent in every mode.
+const (
+	ModeImmediate = "immediate"
+	ModeHourly    = "hourly"
+	ModeDaily     = "daily"
+	ModeOff       = "off"
+)
+
+// Notification is a push or mail item, At in unix seconds. Kind groups
+// items of a digest, e.g. "clan_donation". Urgent ones skip digesting.
+type Notification struct {
+	ID      int64           `json:"id,omitempty"`
+	Kind    string          `json:"kind"`
+	Urgent  bool            `json:"urgent,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	At      int64           `json:"at"`
+}
+
+// Digest is what a player receives: a single notification when sent
+// immediately, a summary otherwise. Counts are notifications per kind,
+// e.g. 12 clan donations.
+type Digest struct {
+	Counts        map[string]int  `json:"counts"`
+	Notifications []*Notification `json:"notifications"`
+}
+
+func newDigest(a []*Notification) *Digest {
+	d := &Digest{Counts: make(map[string]int), Notifications: a}
+	for _, n := range a {
+		d.Counts[n.Kind]++
+	}
+	return d
+}
+
+// Sender delivers a digest, e.g. renders a "12 clan donations" push.
+type Sender interface {
+	Send(ctx context.Context, accountID uint64, d *Digest) error
+}
+
+type SenderFunc func(ctx context.Context, accountID uint64, d *Digest) error
+
+func (fn SenderFunc) Send(ctx context.Context, accountID uint64, d *Digest) error {
+	return fn(ctx, accountID, d)
+}
+
+// Store keeps preferences and pending notifications. Mode returns "" for
+// players without a preference. Add holds a notification until dueAt; Due
+// returns players having one due, Pending their notifications in order
+// and Ack removes notifications up to lastID once sent.
+type Store interface {
+	Mode(accountID uint64) (string, error)
+	SetMode(accountID uint64, mode string) error
+	Add(accountID uint64, n *Notification, dueAt int64) error
+	Due(now int64, limit int) ([]uint64, error)
+	Pending(accountID uint64) ([]*Notification, error)
+	Ack(accountID uint64, lastID int64) error
+}
+
+// Digester sends notifications per preferences of players, holding
+// low-priority ones for the window of their mode. The first held
+// notification starts the window, ones arriving within it join its
+// digest.
+type Digester struct {
+	Store       Store
+	Sender      Sender
+	Logger      a5glogs.Logger
+	DefaultMode string
+	Windows     map[string]time.Duration
+	// Interval and BatchSize configure Start.
+	Interval  time.Duration
+	BatchSize int
+
+	now     func() time.Time
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+func NewDigester(s Store, snd Sender, l a5glogs.Logger) (*Digester, error) {
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if snd == nil {
+		return nil, errors.New("sender missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Digester{
+		Store:       s,
+		Sender:      snd,
+		Logger:      l,
+		DefaultMode: ModeHourly,
+		Windows: map[string]time.Duration{
+			ModeHourly: time.Hour,
+			ModeDaily:  24 * time.Hour},
+		Interval:  time.Minute,
+		BatchSize: 100,
+		now:       time.Now}, nil
+}
+
+// Mode returns the preference of a player or DefaultMode.
+func (x *Digester) Mode(accountID uint64) (string, error) {
+	mode, err := x.Store.Mode(accountID)
+	if err != nil {
+		return "", err
+	}
+	if mode == "" {
+		return x.DefaultMode, nil
+	}
+	return mode, nil
+}
+
+func (x *Digester) SetMode(accountID uint64, mode string) error {
+	if _, ok := x.Windows[mode]; !ok && mode != ModeImmediate && mode != ModeOff {
+		return errors.Errorf("unknown digest mode %q", mode)
+	}
+	return x.Store.SetMode(accountID, mode)
+}
+
+// Notify sends n or holds it for a digest.
+func (x *Digester) Notify(ctx context.Context, accountID uint64, n *Notification) error {
+	if n.Kind == "" {
+		return errors.New("empty notification kind")
+	}
+	now := x.now()
+	n.At = now.Unix()
+	if n.Urgent {
+		return x.Sender.Send(ctx, accountID, newDigest([]*Notification{n}))
+	}
+	mode, err := x.Mode(accountID)
+	if err != nil {
+		return err
+	}
+	if mode == ModeOff {
+		return nil
+	}
+	window, ok := x.Windows[mode]
+	if !ok {
+		return x.Sender.Send(ctx, accountID, newDigest([]*Notification{n}))
+	}
+	return x.Store.Add(accountID, n, now.Add(window).Unix())
+}
+
+// Flush sends digests due at now, BatchSize players at most. A player
+// whose digest fails keeps it for the next Flush.
+func (x *Digester) Flush(ctx context.Context, now time.Time) (int, error) {
+	ids, err := x.Store.Due(now.Unix(), x.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	for _, id := range ids {
+		if err := x.flush(ctx, id); err != nil {
+			x.Logger.With(a5gfields.String(
+				"accountId", strconv.FormatUint(id, 10))).Error(err.Error())
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+func (x *Digester) flush(ctx context.Context, accountID uint64) error {
+	a, err := x.Store.Pending(accountID)
+	if err != nil || len(a) == 0 {
+		return err
+	}
+	if err = x.Sender.Send(ctx, accountID, newDigest(a)); err != nil {
+		return err
+	}
+	return x.Store.Ack(accountID, a[len(a)-1].ID)
+}
+
+// Start runs Flush every Interval until Stop is called. Run a single
+// digester per cluster, e.g. on the leader instance, so digests are sent
+// once.
+func (x *Digester) Start() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.cancel != nil {
+		return errors.New("digester already started")
+	}
+	var ctx context.Context
+	ctx, x.cancel = context.WithCancel(context.Background())
+	x.stopped = make(chan struct{})
+	go x.run(ctx, x.stopped)
+	return nil
+}
+
+func (x *Digester) run(ctx context.Context, stopped chan struct{}) {
+	defer close(stopped)
+	t := time.NewTicker(x.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		// A full batch means more digests are due.
+		for {
+			n, err := x.Flush(ctx, x.now())
+			if err != nil {
+				x.Logger.Error(err.Error())
+			}
+			if err != nil || n < x.BatchSize || ctx.Err() != nil {
+				break
+			}
+		}
+	}
+}
+
+// Stop waits for the running Flush until ctx is done.
+func (x *Digester) Stop(ctx context.Context) error {
+	x.mu.Lock()
+	cancel, stopped := x.cancel, x.stopped
+	x.cancel = nil
+	x.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
@@ -0,0 +1,80 @@
+package a5gdigest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestDigester(t *testing.T) {
+	var sent []string
+	fail := false
+	x, err := NewDigester(NewMemoryStore(), SenderFunc(func(
+		ctx context.Context, accountID uint64, d *Digest) error {
+		if fail {
+			return errors.New("push provider down")
+		}
+		sent = append(sent, fmt.Sprintf("%d:%d:%d:%d", accountID,
+			d.Counts["donation"], d.Counts["gift"], len(d.Notifications)))
+		return nil
+	}), a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Unix(1000000, 0)
+	x.now = func() time.Time { return at }
+	if err = x.SetMode(2, ModeImmediate); err != nil {
+		t.Fatal(err)
+	}
+	if err = x.SetMode(3, ModeOff); err != nil {
+		t.Fatal(err)
+	}
+	if err = x.SetMode(3, "weekly"); err == nil {
+		t.Fatal("expected an unknown mode error")
+	}
+
+	ctx := context.Background()
+	tests := []struct {
+		name      string
+		after     time.Duration
+		accountID uint64
+		kind      string
+		urgent    bool
+		fail      bool
+		sent      string
+	}{
+		{"held", 0, 1, "donation", false, false, ""},
+		{"held again", 10 * time.Minute, 1, "donation", false, false, ""},
+		{"other kind", 20 * time.Minute, 1, "gift", false, false, ""},
+		{"urgent", 0, 1, "raid", true, false, "1:0:0:1"},
+		{"immediate", 0, 2, "donation", false, false, "2:1:0:1"},
+		{"off", 0, 3, "donation", false, false, ""},
+		{"off urgent", 0, 3, "raid", true, false, "3:0:0:1"},
+		{"sender down", 40 * time.Minute, 0, "", false, true, ""},
+		{"due", 0, 0, "", false, false, "1:2:1:3"},
+		{"window restarted", 0, 1, "donation", false, false, ""},
+		{"next window", time.Hour, 0, "", false, false, "1:1:0:1"},
+	}
+	for _, test := range tests {
+		at = at.Add(test.after)
+		sent, fail = nil, test.fail
+		if test.kind != "" {
+			err = x.Notify(ctx, test.accountID,
+				&Notification{Kind: test.kind, Urgent: test.urgent})
+			if err != nil {
+				t.Fatal(err)
+			}
+		} else if _, err = x.Flush(ctx, at); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(sent, " "); got != test.sent {
+			t.Errorf("%s: expected %q, got %q", test.name, test.sent, got)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package a5gdigest
+
+import (
+	"context"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/armor5games/a5g/a5gvalidate"
+)
+
+type ModeResponse struct {
+	Mode string `json:"mode"`
+}
+
+type ModeRequest struct {
+	Mode string `json:"mode" validate:"required,oneof=immediate hourly daily off"`
+}
+
+// ModeHandler answers with the preference of the a5gsession authenticated
+// player.
+func (x *Digester) ModeHandler() a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		sess, ok := a5gsession.FromContext(ctx)
+		if !ok {
+			return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+		}
+		mode, err := x.Mode(sess.AccountID)
+		if err != nil {
+			return nil, x.apiErrs(err)
+		}
+		return &ModeResponse{Mode: mode}, nil
+	}
+}
+
+// SetModeHandler changes the preference of the a5gsession authenticated
+// player, pending notifications keep their due time.
+func (x *Digester) SetModeHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(ModeRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			sess, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			mode := req.Payload.(*ModeRequest).Mode
+			if err := x.SetMode(sess.AccountID, mode); err != nil {
+				return nil, x.apiErrs(err)
+			}
+			return &ModeResponse{Mode: mode}, nil
+		})
+}
+
+func (x *Digester) apiErrs(err error) []*a5gapi.APIErr {
+	x.Logger.Error(err.Error())
+	return a5gapi.NewJSONMsgDefautlErrors(err)
+}
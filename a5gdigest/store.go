@@ -0,0 +1,226 @@
+package a5gdigest
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type pending struct {
+	n     *Notification
+	dueAt int64
+}
+
+type memoryStore struct {
+	mu      sync.Mutex
+	modes   map[uint64]string
+	pending map[uint64][]*pending
+	lastID  int64
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{
+		modes:   make(map[uint64]string),
+		pending: make(map[uint64][]*pending)}
+}
+
+func (s *memoryStore) Mode(accountID uint64) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.modes[accountID], nil
+}
+
+func (s *memoryStore) SetMode(accountID uint64, mode string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.modes[accountID] = mode
+	return nil
+}
+
+func (s *memoryStore) Add(accountID uint64, n *Notification, dueAt int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	x := *n
+	x.ID = s.lastID
+	s.pending[accountID] = append(s.pending[accountID], &pending{n: &x, dueAt: dueAt})
+	return nil
+}
+
+func (s *memoryStore) Due(now int64, limit int) ([]uint64, error) {
+	s.mu.Lock()
+	dueAt := make(map[uint64]int64)
+	var ids []uint64
+	for id, a := range s.pending {
+		if len(a) > 0 && a[0].dueAt <= now {
+			dueAt[id] = a[0].dueAt
+			ids = append(ids, id)
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(ids, func(i, j int) bool {
+		if dueAt[ids[i]] != dueAt[ids[j]] {
+			return dueAt[ids[i]] < dueAt[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	if limit > 0 && len(ids) > limit {
+		ids = ids[:limit]
+	}
+	return ids, nil
+}
+
+func (s *memoryStore) Pending(accountID uint64) ([]*Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := make([]*Notification, len(s.pending[accountID]))
+	for i, p := range s.pending[accountID] {
+		x := *p.n
+		a[i] = &x
+	}
+	return a, nil
+}
+
+func (s *memoryStore) Ack(accountID uint64, lastID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.pending[accountID]
+	for len(a) > 0 && a[0].n.ID <= lastID {
+		a = a[1:]
+	}
+	if len(a) == 0 {
+		delete(s.pending, accountID)
+		return nil
+	}
+	s.pending[accountID] = a
+	return nil
+}
+
+// dbStore keeps preferences and pending notifications in MySQL tables:
+//
+//	CREATE TABLE digest_modes (
+//	  account_id BIGINT UNSIGNED PRIMARY KEY,
+//	  mode VARCHAR(16) NOT NULL);
+//
+//	CREATE TABLE digest_pending (
+//	  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+//	  account_id BIGINT UNSIGNED NOT NULL,
+//	  kind VARCHAR(64) NOT NULL,
+//	  payload TEXT,
+//	  created_at BIGINT NOT NULL,
+//	  due_at BIGINT NOT NULL,
+//	  KEY due_at (due_at),
+//	  KEY account_id_id (account_id, id));
+type dbStore struct {
+	pooler           a5gdb.Pooler
+	modesTableName   string
+	pendingTableName string
+}
+
+type dbNotification struct {
+	ID        int64           `db:"id"`
+	Kind      string          `db:"kind"`
+	Payload   json.RawMessage `db:"payload"`
+	CreatedAt int64           `db:"created_at"`
+}
+
+func NewDBStore(
+	p a5gdb.Pooler, modesTableName, pendingTableName string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if modesTableName == "" || pendingTableName == "" {
+		return nil, errors.New("empty digest table name")
+	}
+	return &dbStore{
+		pooler:           p,
+		modesTableName:   modesTableName,
+		pendingTableName: pendingTableName}, nil
+}
+
+func (s *dbStore) Mode(accountID uint64) (string, error) {
+	var mode string
+	err := s.pooler.ReadPool().NewSession().
+		Select("mode").From(s.modesTableName).
+		Where(dbr.Eq("account_id", accountID)).LoadOne(&mode)
+	if err == dbr.ErrNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	return mode, nil
+}
+
+func (s *dbStore) SetMode(accountID uint64, mode string) error {
+	_, err := s.pooler.WritePool().NewSession().InsertBySql("INSERT INTO "+
+		s.modesTableName+" (account_id, mode) VALUES (?, ?)"+
+		" ON DUPLICATE KEY UPDATE mode = VALUES(mode)", accountID, mode).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	return nil
+}
+
+func (s *dbStore) Add(accountID uint64, n *Notification, dueAt int64) error {
+	_, err := s.pooler.WritePool().NewSession().
+		InsertInto(s.pendingTableName).
+		Pair("account_id", accountID).
+		Pair("kind", n.Kind).
+		Pair("payload", []byte(n.Payload)).
+		Pair("created_at", n.At).
+		Pair("due_at", dueAt).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	return nil
+}
+
+func (s *dbStore) Due(now int64, limit int) ([]uint64, error) {
+	stmt := s.pooler.ReadPool().NewSession().
+		Select("account_id").From(s.pendingTableName).
+		Where(dbr.Lte("due_at", now)).
+		GroupBy("account_id").OrderBy("MIN(due_at)")
+	if limit > 0 {
+		stmt.Limit(uint64(limit))
+	}
+	var ids []uint64
+	if _, err := stmt.Load(&ids); err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	return ids, nil
+}
+
+func (s *dbStore) Pending(accountID uint64) ([]*Notification, error) {
+	var rows []*dbNotification
+	_, err := s.pooler.ReadPool().NewSession().
+		Select("id", "kind", "payload", "created_at").From(s.pendingTableName).
+		Where(dbr.Eq("account_id", accountID)).OrderAsc("id").Load(&rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	a := make([]*Notification, len(rows))
+	for i, x := range rows {
+		a[i] = &Notification{
+			ID:      x.ID,
+			Kind:    x.Kind,
+			Payload: x.Payload,
+			At:      x.CreatedAt}
+	}
+	return a, nil
+}
+
+func (s *dbStore) Ack(accountID uint64, lastID int64) error {
+	_, err := s.pooler.WritePool().NewSession().
+		DeleteFrom(s.pendingTableName).
+		Where(dbr.Eq("account_id", accountID)).
+		Where(dbr.Lte("id", lastID)).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*DeleteStmt).Exec fn")
+	}
+	return nil
+}
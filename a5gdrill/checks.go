@@ -0,0 +1,100 @@
+package a5gdrill
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/pkg/errors"
+)
+
+// maxDrift caps violations reported by a check.
+const maxDrift = 100
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func tables(schema string, names ...string) ([]string, error) {
+	a := make([]string, 0, len(names))
+	for _, s := range append([]string{schema}, names...) {
+		if !identifier.MatchString(s) {
+			return nil, errors.Errorf("invalid identifier %q", s)
+		}
+	}
+	for _, s := range names {
+		a = append(a, schema+"."+s)
+	}
+	return a, nil
+}
+
+type walletDrift struct {
+	Kind     string `db:"kind"`
+	Key      string `db:"k"`
+	Currency string `db:"currency"`
+	Want     int64  `db:"want"`
+	Got      int64  `db:"got"`
+}
+
+// WalletCheck checks a5gwallet tables: every transaction of the ledger
+// sums to zero per currency and every balance equals the sum of its player
+// ledger entries.
+func WalletCheck(p a5gdb.Pooler, balancesTable, ledgerTable string) *Check {
+	return &Check{Name: "wallet", Run: func(ctx context.Context, schema string) ([]string, error) {
+		t, err := tables(schema, balancesTable, ledgerTable)
+		if err != nil {
+			return nil, err
+		}
+		var rows []*walletDrift
+		_, err = p.ReadPool().NewSession().SelectBySql(
+			"(SELECT 'tx' kind, tx_id k, currency, 0 want, SUM(amount) got"+
+				" FROM "+t[1]+" GROUP BY tx_id, currency HAVING got <> 0 LIMIT ?)"+
+				" UNION ALL (SELECT 'balance' kind, b.account_id k, b.currency,"+
+				" COALESCE(SUM(l.amount), 0) want, b.balance got FROM "+t[0]+" b"+
+				" LEFT JOIN "+t[1]+" l ON l.account = CONCAT('player:', b.account_id)"+
+				" AND l.currency = b.currency GROUP BY b.account_id, b.currency, b.balance"+
+				" HAVING want <> got LIMIT ?)", maxDrift, maxDrift).Load(&rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+		}
+		a := make([]string, 0, len(rows))
+		for _, r := range rows {
+			a = append(a, fmt.Sprintf("%s %s %s: want %d, got %d",
+				r.Kind, r.Key, r.Currency, r.Want, r.Got))
+		}
+		return a, nil
+	}}
+}
+
+type inventoryDrift struct {
+	AccountID uint64 `db:"account_id"`
+	ItemID    string `db:"item_id"`
+	Want      int64  `db:"want"`
+	Got       int64  `db:"got"`
+}
+
+// InventoryCheck checks a5ginventory tables: every stack holds a non-negative
+// quantity equal to the sum of its log deltas.
+func InventoryCheck(p a5gdb.Pooler, stacksTable, logTable string) *Check {
+	return &Check{Name: "inventory", Run: func(ctx context.Context, schema string) ([]string, error) {
+		t, err := tables(schema, stacksTable, logTable)
+		if err != nil {
+			return nil, err
+		}
+		var rows []*inventoryDrift
+		_, err = p.ReadPool().NewSession().SelectBySql(
+			"SELECT s.account_id, s.item_id, COALESCE(SUM(l.delta), 0) want,"+
+				" s.quantity got FROM "+t[0]+" s LEFT JOIN "+t[1]+" l"+
+				" ON l.account_id = s.account_id AND l.item_id = s.item_id"+
+				" GROUP BY s.account_id, s.item_id, s.quantity"+
+				" HAVING want <> got OR got < 0 LIMIT ?", maxDrift).Load(&rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+		}
+		a := make([]string, 0, len(rows))
+		for _, r := range rows {
+			a = append(a, fmt.Sprintf("stack %d %s: want %d, got %d",
+				r.AccountID, r.ItemID, r.Want, r.Got))
+		}
+		return a, nil
+	}}
+}
@@ -0,0 +1,256 @@
+package a5gdrill
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+// Restorer restores backups into scratch schemas. Restore restores the
+// state at the point in time at, e.g. a base backup with binlogs replayed
+// up to it, and returns the name of the backup used. Drop removes the
+// scratch schema.
+type Restorer interface {
+	Restore(ctx context.Context, schema string, at time.Time) (string, error)
+	Drop(ctx context.Context, schema string) error
+}
+
+// CommandRestorer runs backup tooling as commands with the scratch schema
+// in A5G_DRILL_SCHEMA and the point in time as RFC 3339 in A5G_DRILL_AT.
+// The restore command prints the name of the backup used.
+type CommandRestorer struct {
+	RestoreCmd []string
+	DropCmd    []string
+}
+
+func (r *CommandRestorer) Restore(
+	ctx context.Context, schema string, at time.Time) (string, error) {
+	out, err := run(ctx, r.RestoreCmd, schema, at)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+func (r *CommandRestorer) Drop(ctx context.Context, schema string) error {
+	_, err := run(ctx, r.DropCmd, schema, time.Time{})
+	return err
+}
+
+func run(ctx context.Context, args []string, schema string, at time.Time) (string, error) {
+	if len(args) == 0 {
+		return "", errors.New("empty drill command")
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), "A5G_DRILL_SCHEMA="+schema)
+	if !at.IsZero() {
+		cmd.Env = append(cmd.Env, "A5G_DRILL_AT="+at.UTC().Format(time.RFC3339))
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", errors.Wrapf(err, "%s: %s", args[0], strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// Check verifies an invariant of module data in a restored schema and
+// returns its violations, e.g. wallet balances which differ from their
+// ledger sums.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context, schema string) ([]string, error)
+}
+
+type CheckResult struct {
+	Name  string   `json:"name"`
+	Drift []string `json:"drift,omitempty"`
+	Err   string   `json:"err,omitempty"`
+}
+
+// Report is the outcome of a drill. OK is set when the backup restored
+// and every check passed with no drift.
+type Report struct {
+	Schema     string         `json:"schema"`
+	At         int64          `json:"at"`
+	Backup     string         `json:"backup"`
+	StartedAt  int64          `json:"startedAt"`
+	RestoredIn int64          `json:"restoredInMs"`
+	Checks     []*CheckResult `json:"checks"`
+	Err        string         `json:"err,omitempty"`
+	OK         bool           `json:"ok"`
+}
+
+// Driller restores the state of Lag ago into a scratch schema every
+// Interval, runs Checks against it and drops it. It is an a5gapp.Module.
+type Driller struct {
+	Restorer Restorer
+	Checks   []*Check
+	Logger   a5glogs.Logger
+	Interval time.Duration
+	Lag      time.Duration
+
+	now     func() time.Time
+	mu      sync.Mutex
+	last    *Report
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+func NewDriller(r Restorer, checks []*Check, l a5glogs.Logger) (*Driller, error) {
+	if r == nil {
+		return nil, errors.New("restorer missing")
+	}
+	for _, c := range checks {
+		if c == nil || c.Name == "" || c.Run == nil {
+			return nil, errors.New("invalid drill check")
+		}
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Driller{
+		Restorer: r,
+		Checks:   checks,
+		Logger:   l,
+		Interval: 24 * time.Hour,
+		now:      time.Now}, nil
+}
+
+// Drill restores the state at a point in time into a scratch schema and
+// runs the checks. The report is kept for Last; an error is returned when
+// the restore fails, drift is reported in the report only.
+func (d *Driller) Drill(ctx context.Context, at time.Time) (*Report, error) {
+	started := d.now()
+	r := &Report{
+		Schema:    "drill_" + at.UTC().Format("20060102150405"),
+		At:        at.Unix(),
+		StartedAt: started.Unix(),
+		Checks:    []*CheckResult{}}
+	defer d.keep(r)
+	backup, err := d.Restorer.Restore(ctx, r.Schema, at)
+	if err != nil {
+		r.Err = err.Error()
+		d.drop(r.Schema)
+		return r, errors.Wrap(err, "drill restore")
+	}
+	r.Backup = backup
+	r.RestoredIn = int64(d.now().Sub(started) / time.Millisecond)
+	defer d.drop(r.Schema)
+	r.OK = true
+	for _, c := range d.Checks {
+		x := &CheckResult{Name: c.Name}
+		x.Drift, err = c.Run(ctx, r.Schema)
+		if err != nil {
+			x.Err = err.Error()
+		}
+		if err != nil || len(x.Drift) > 0 {
+			r.OK = false
+			d.Logger.With(a5gfields.String("drillCheck", c.Name),
+				a5gfields.String("backup", backup),
+				a5gfields.Int("drift", len(x.Drift))).Warn("drill check failed")
+		}
+		r.Checks = append(r.Checks, x)
+	}
+	return r, nil
+}
+
+// drop removes a scratch schema on a context of its own, so drills
+// cancelled by Stop don't leave it behind.
+func (d *Driller) drop(schema string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := d.Restorer.Drop(ctx, schema); err != nil {
+		d.Logger.Error(errors.Wrapf(err, "drop drill schema %s", schema).Error())
+	}
+}
+
+func (d *Driller) keep(r *Report) {
+	d.mu.Lock()
+	d.last = r
+	d.mu.Unlock()
+}
+
+// Last returns the report of the last drill, nil before the first one.
+func (d *Driller) Last() *Report {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.last
+}
+
+// ReportHandler answers with the Last report for dashboards and alerts,
+// mount it on an admin route class.
+func (d *Driller) ReportHandler() a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		return d.Last(), nil
+	}
+}
+
+func (d *Driller) Name() string { return "drill" }
+
+// Start runs a drill every Interval until Stop is called.
+func (d *Driller) Start(context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cancel != nil {
+		return errors.New("driller already started")
+	}
+	var ctx context.Context
+	ctx, d.cancel = context.WithCancel(context.Background())
+	d.stopped = make(chan struct{})
+	go d.run(ctx, d.stopped)
+	return nil
+}
+
+func (d *Driller) run(ctx context.Context, stopped chan struct{}) {
+	defer close(stopped)
+	t := time.NewTicker(d.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		r, err := d.Drill(ctx, d.now().Add(-d.Lag))
+		if err != nil {
+			if ctx.Err() == nil {
+				d.Logger.Error(err.Error())
+			}
+			continue
+		}
+		if r.OK {
+			d.Logger.With(a5gfields.String("backup", r.Backup),
+				a5gfields.Int64("restoredInMs", r.RestoredIn)).Info("drill passed")
+		}
+	}
+}
+
+// Stop waits for the running drill until ctx is done.
+func (d *Driller) Stop(ctx context.Context) error {
+	d.mu.Lock()
+	cancel, stopped := d.cancel, d.stopped
+	d.cancel = nil
+	d.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
@@ -0,0 +1,83 @@
+package a5gdrill
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+type fakeRestorer struct {
+	err      error
+	restored []string
+	dropped  []string
+}
+
+func (r *fakeRestorer) Restore(
+	ctx context.Context, schema string, at time.Time) (string, error) {
+	if r.err != nil {
+		return "", r.err
+	}
+	r.restored = append(r.restored, schema)
+	return "full-20200309", nil
+}
+
+func (r *fakeRestorer) Drop(ctx context.Context, schema string) error {
+	r.dropped = append(r.dropped, schema)
+	return nil
+}
+
+func TestDriller(t *testing.T) {
+	at := time.Date(2020, 3, 10, 4, 0, 0, 0, time.UTC)
+	r := new(fakeRestorer)
+	var drift []string
+	checks := []*Check{
+		{Name: "wallet", Run: func(ctx context.Context, schema string) ([]string, error) {
+			return drift, nil
+		}},
+		{Name: "inventory", Run: func(ctx context.Context, schema string) ([]string, error) {
+			return nil, nil
+		}}}
+	d, err := NewDriller(r, checks, a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Last() != nil {
+		t.Fatal("unexpected report before a drill")
+	}
+
+	rep, err := d.Drill(context.Background(), at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rep.OK || rep.Schema != "drill_20200310040000" ||
+		rep.Backup != "full-20200309" || len(rep.Checks) != 2 {
+		t.Errorf("unexpected report %+v", rep)
+	}
+	if len(r.dropped) != 1 || r.dropped[0] != rep.Schema {
+		t.Errorf("scratch schema not dropped %v", r.dropped)
+	}
+
+	drift = []string{"balance 42 gold: want 100, got 150"}
+	if rep, err = d.Drill(context.Background(), at); err != nil {
+		t.Fatal(err)
+	}
+	if rep.OK || len(rep.Checks[0].Drift) != 1 || len(rep.Checks[1].Drift) != 0 {
+		t.Errorf("unexpected drift report %+v", rep.Checks[0])
+	}
+
+	r.err = errors.New("no backup before 2020-03-10")
+	if rep, err = d.Drill(context.Background(), at); err == nil {
+		t.Fatal("expected a restore error")
+	}
+	if rep.OK || rep.Err == "" || d.Last() != rep || len(r.dropped) != 3 {
+		t.Errorf("unexpected failed report %+v", rep)
+	}
+
+	if _, err = tables("drill_1", "wallet_ledger; DROP"); err == nil {
+		t.Error("expected an invalid identifier error")
+	}
+}
@@ -0,0 +1,416 @@
+package a5gevents
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5greset"
+	"github.com/pkg/errors"
+)
+
+// Layout of event times: wall clock, without a timezone.
+const Layout = "2006-01-02T15:04:05"
+
+// Statuses of an event for a player.
+const (
+	StatusAnnounced = "announced"
+	StatusActive    = "active"
+)
+
+var ErrEventUnknown = errors.New("event unknown")
+
+// Event is a time window, e.g. a double XP weekend. Start, End and Until
+// are wall clock times in the game location or, when Local, in the
+// timezone of each player, so a "Saturday 10:00" event starts at 10:00
+// for everyone. RepeatDays repeats the window until Until, e.g. 7 for a
+// weekly one. Announce is how long before the start players see the event
+// coming, e.g. "48h". Segments, when set, limit the event to players of
+// any of them. Payload is the event config for handlers.
+type Event struct {
+	ID         string          `json:"id"`
+	Start      string          `json:"start"`
+	End        string          `json:"end"`
+	Local      bool            `json:"local,omitempty"`
+	RepeatDays int             `json:"repeatDays,omitempty"`
+	Until      string          `json:"until,omitempty"`
+	Announce   string          `json:"announce,omitempty"`
+	Segments   []string        `json:"segments,omitempty"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+
+	start, end, until time.Time
+	announce          time.Duration
+}
+
+func (e *Event) parse() error {
+	if e.ID == "" {
+		return errors.New("empty event id")
+	}
+	var err error
+	if e.start, err = time.Parse(Layout, e.Start); err != nil {
+		return errors.Wrapf(err, "event %q start", e.ID)
+	}
+	if e.end, err = time.Parse(Layout, e.End); err != nil {
+		return errors.Wrapf(err, "event %q end", e.ID)
+	}
+	if !e.end.After(e.start) {
+		return errors.Errorf("event %q ends before it starts", e.ID)
+	}
+	if e.RepeatDays < 0 || e.RepeatDays > 0 &&
+		e.end.Sub(e.start) > time.Duration(e.RepeatDays)*24*time.Hour {
+		return errors.Errorf("event %q overlaps its repetition", e.ID)
+	}
+	if e.Until != "" {
+		if e.until, err = time.Parse(Layout, e.Until); err != nil {
+			return errors.Wrapf(err, "event %q until", e.ID)
+		}
+	}
+	if e.Announce != "" {
+		if e.announce, err = time.ParseDuration(e.Announce); err != nil {
+			return errors.Wrapf(err, "event %q announce", e.ID)
+		}
+	}
+	return nil
+}
+
+// Occurrence is a window of an event in a location.
+type Occurrence struct {
+	Event *Event
+	Start time.Time
+	End   time.Time
+}
+
+// AnnounceAt is when players start seeing the occurrence.
+func (o *Occurrence) AnnounceAt() time.Time {
+	return o.Start.Add(-o.Event.announce)
+}
+
+// occurrence returns the first occurrence of e in loc ending after t.
+func (e *Event) occurrence(loc *time.Location, t time.Time) (*Occurrence, bool) {
+	start, end := wall(e.start, loc), wall(e.end, loc)
+	if e.RepeatDays == 0 {
+		if !end.After(t) {
+			return nil, false
+		}
+		return &Occurrence{Event: e, Start: start, End: end}, true
+	}
+	k := 0
+	if t.After(start) {
+		// An estimate, DST shifts the exact repetition by an hour.
+		k = int(t.Sub(start).Hours()/24)/e.RepeatDays - 1
+		if k < 0 {
+			k = 0
+		}
+	}
+	for ; ; k++ {
+		s := start.AddDate(0, 0, k*e.RepeatDays)
+		if !e.until.IsZero() && !s.Before(wall(e.until, loc)) {
+			return nil, false
+		}
+		x := end.AddDate(0, 0, k*e.RepeatDays)
+		if x.After(t) {
+			return &Occurrence{Event: e, Start: s, End: x}, true
+		}
+	}
+}
+
+// next returns the first occurrence of e in loc starting after t.
+func (e *Event) next(loc *time.Location, t time.Time) (*Occurrence, bool) {
+	o, ok := e.occurrence(loc, t)
+	if !ok || o.Start.After(t) {
+		return o, ok
+	}
+	return e.occurrence(loc, o.End)
+}
+
+// wall is the wall clock of t in loc.
+func wall(t time.Time, loc *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(),
+		t.Hour(), t.Minute(), t.Second(), 0, loc)
+}
+
+func NewEventsJSON(b []byte) ([]*Event, error) {
+	var a []*Event
+	if err := json.Unmarshal(b, &a); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return a, nil
+}
+
+// SegmentFunc returns segments of a player, e.g. "payer" or "country:de".
+type SegmentFunc func(ctx context.Context, playerID int64) ([]string, error)
+
+// Notifier is told about occurrences when they are announced and when they
+// start, e.g. to send push notifications. Local events are notified per
+// location of Scheduler.Locations as their start reaches it.
+type Notifier interface {
+	Announced(ctx context.Context, o *Occurrence, loc *time.Location) error
+	Started(ctx context.Context, o *Occurrence, loc *time.Location) error
+}
+
+// Scheduler answers which events are active for a player at request time.
+// Location is the game one; PlayerLocation, when set, resolves timezones
+// of players for Local events, falling back to the game location.
+type Scheduler struct {
+	Location       *time.Location
+	PlayerLocation a5greset.LocationFunc
+	Segments       SegmentFunc
+	Logger         a5glogs.Logger
+	// Notifier, Locations and Interval configure Start.
+	Notifier  Notifier
+	Locations []*time.Location
+	Interval  time.Duration
+
+	now     func() time.Time
+	mu      sync.RWMutex
+	events  []*Event
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+func NewScheduler(
+	events []*Event, loc *time.Location, l a5glogs.Logger) (*Scheduler, error) {
+	if loc == nil {
+		return nil, errors.New("game location missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	s := &Scheduler{
+		Location: loc,
+		Logger:   l,
+		Interval: time.Minute,
+		now:      time.Now}
+	if err := s.Replace(events); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Replace swaps the events, e.g. on a config reload.
+func (s *Scheduler) Replace(events []*Event) error {
+	ids := make(map[string]bool, len(events))
+	for _, e := range events {
+		if e == nil {
+			return errors.New("nil event")
+		}
+		if err := e.parse(); err != nil {
+			return err
+		}
+		if ids[e.ID] {
+			return errors.Errorf("duplicate event %q", e.ID)
+		}
+		ids[e.ID] = true
+	}
+	s.mu.Lock()
+	s.events = events
+	s.mu.Unlock()
+	return nil
+}
+
+// State is an event as a player sees it, times in unix seconds.
+type State struct {
+	ID      string          `json:"id"`
+	Status  string          `json:"status"`
+	StartAt int64           `json:"startAt"`
+	EndAt   int64           `json:"endAt"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Events returns announced and active events of a player.
+func (s *Scheduler) Events(ctx context.Context, playerID int64) ([]*State, error) {
+	s.mu.RLock()
+	events := s.events
+	s.mu.RUnlock()
+	loc, err := s.playerLocation(playerID)
+	if err != nil {
+		return nil, err
+	}
+	var segments []string
+	segmented := false
+	now := s.now()
+	a := []*State{}
+	for _, e := range events {
+		l := s.Location
+		if e.Local {
+			l = loc
+		}
+		o, ok := e.occurrence(l, now)
+		if !ok || o.AnnounceAt().After(now) {
+			continue
+		}
+		if len(e.Segments) > 0 {
+			if !segmented {
+				if segments, err = s.segments(ctx, playerID); err != nil {
+					return nil, err
+				}
+				segmented = true
+			}
+			if !intersects(e.Segments, segments) {
+				continue
+			}
+		}
+		x := &State{
+			ID:      e.ID,
+			Status:  StatusActive,
+			StartAt: o.Start.Unix(),
+			EndAt:   o.End.Unix(),
+			Payload: e.Payload}
+		if o.Start.After(now) {
+			x.Status = StatusAnnounced
+		}
+		a = append(a, x)
+	}
+	return a, nil
+}
+
+// Active returns the event of a player when it is active, handlers check
+// it at request time, e.g. before doubling a reward.
+func (s *Scheduler) Active(
+	ctx context.Context, playerID int64, eventID string) (*State, bool, error) {
+	if !s.known(eventID) {
+		return nil, false, errors.Wrap(ErrEventUnknown, eventID)
+	}
+	a, err := s.Events(ctx, playerID)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, x := range a {
+		if x.ID == eventID && x.Status == StatusActive {
+			return x, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func (s *Scheduler) known(eventID string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, e := range s.events {
+		if e.ID == eventID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Scheduler) playerLocation(playerID int64) (*time.Location, error) {
+	if s.PlayerLocation == nil {
+		return s.Location, nil
+	}
+	loc, err := s.PlayerLocation(playerID)
+	if err != nil {
+		return nil, err
+	}
+	if loc == nil {
+		return s.Location, nil
+	}
+	return loc, nil
+}
+
+func (s *Scheduler) segments(ctx context.Context, playerID int64) ([]string, error) {
+	if s.Segments == nil {
+		return nil, nil
+	}
+	return s.Segments(ctx, playerID)
+}
+
+func intersects(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Tick notifies about occurrences announced or started in (from, to].
+func (s *Scheduler) Tick(ctx context.Context, from, to time.Time) error {
+	s.mu.RLock()
+	events := s.events
+	s.mu.RUnlock()
+	var err error
+	for _, e := range events {
+		locs := []*time.Location{s.Location}
+		if e.Local && len(s.Locations) > 0 {
+			locs = s.Locations
+		}
+		for _, loc := range locs {
+			if e.announce > 0 {
+				o, ok := e.next(loc, from.Add(e.announce))
+				if ok && !o.AnnounceAt().After(to) {
+					if y := s.Notifier.Announced(ctx, o, loc); y != nil && err == nil {
+						err = errors.Wrapf(y, "event %q", e.ID)
+					}
+				}
+			}
+			o, ok := e.next(loc, from)
+			if ok && !o.Start.After(to) {
+				if y := s.Notifier.Started(ctx, o, loc); y != nil && err == nil {
+					err = errors.Wrapf(y, "event %q", e.ID)
+				}
+			}
+		}
+	}
+	return err
+}
+
+// Start runs Tick every Interval until Stop is called. Run a single
+// scheduler per cluster, e.g. on the leader instance, so players are
+// notified once.
+func (s *Scheduler) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Notifier == nil {
+		return errors.New("notifier missing")
+	}
+	if s.cancel != nil {
+		return errors.New("scheduler already started")
+	}
+	var ctx context.Context
+	ctx, s.cancel = context.WithCancel(context.Background())
+	s.stopped = make(chan struct{})
+	go s.run(ctx, s.stopped)
+	return nil
+}
+
+func (s *Scheduler) run(ctx context.Context, stopped chan struct{}) {
+	defer close(stopped)
+	t := time.NewTicker(s.Interval)
+	defer t.Stop()
+	from := s.now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		to := s.now()
+		if err := s.Tick(ctx, from, to); err != nil {
+			s.Logger.Error(err.Error())
+		}
+		from = to
+	}
+}
+
+// Stop waits for the running Tick until ctx is done.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	cancel, stopped := s.cancel, s.stopped
+	s.cancel = nil
+	s.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
@@ -0,0 +1,111 @@
+package a5gevents
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/sirupsen/logrus"
+)
+
+type notifier []string
+
+func (n *notifier) Announced(
+	ctx context.Context, o *Occurrence, loc *time.Location) error {
+	*n = append(*n, "announced "+o.Event.ID+" "+loc.String())
+	return nil
+}
+
+func (n *notifier) Started(
+	ctx context.Context, o *Occurrence, loc *time.Location) error {
+	*n = append(*n, "started "+o.Event.ID+" "+loc.String())
+	return nil
+}
+
+func TestScheduler(t *testing.T) {
+	events, err := NewEventsJSON([]byte(`[
+		{"id": "weekend", "start": "2020-03-07T10:00:00",
+			"end": "2020-03-09T00:00:00", "local": true, "repeatDays": 7,
+			"announce": "24h"},
+		{"id": "sale", "start": "2020-03-08T00:00:00",
+			"end": "2020-03-10T00:00:00", "segments": ["payer"]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokyo := time.FixedZone("Tokyo", 9*3600)
+	s, err := NewScheduler(
+		events, time.UTC, a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.PlayerLocation = func(playerID int64) (*time.Location, error) {
+		if playerID == 2 {
+			return tokyo, nil
+		}
+		return nil, nil
+	}
+	s.Segments = func(ctx context.Context, playerID int64) ([]string, error) {
+		if playerID == 2 {
+			return []string{"payer"}, nil
+		}
+		return nil, nil
+	}
+	tests := []struct {
+		name     string
+		at       time.Time
+		playerID int64
+		states   string
+	}{
+		{"before", time.Date(2020, 3, 6, 9, 0, 0, 0, time.UTC), 1, ""},
+		{"announced", time.Date(2020, 3, 6, 11, 0, 0, 0, time.UTC), 1,
+			"weekend:announced"},
+		{"started in tokyo", time.Date(2020, 3, 7, 2, 0, 0, 0, time.UTC), 2,
+			"weekend:active"},
+		{"not yet in utc", time.Date(2020, 3, 7, 2, 0, 0, 0, time.UTC), 1,
+			"weekend:announced"},
+		// The weekend ends at midnight in Tokyo, 15:00 UTC.
+		{"segment", time.Date(2020, 3, 8, 12, 0, 0, 0, time.UTC), 2,
+			"weekend:active sale:active"},
+		{"segment missing", time.Date(2020, 3, 8, 12, 0, 0, 0, time.UTC), 1,
+			"weekend:active"},
+		{"repeated", time.Date(2020, 3, 14, 11, 0, 0, 0, time.UTC), 1,
+			"weekend:active"},
+	}
+	for _, test := range tests {
+		at := test.at
+		s.now = func() time.Time { return at }
+		a, err := s.Events(context.Background(), test.playerID)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		var x []string
+		for _, e := range a {
+			x = append(x, e.ID+":"+e.Status)
+		}
+		if s := strings.Join(x, " "); s != test.states {
+			t.Errorf("%s: unexpected events %q", test.name, s)
+		}
+	}
+	if _, _, err = s.Active(context.Background(), 1, "missing"); err == nil {
+		t.Error("expected an unknown event error")
+	}
+
+	n := new(notifier)
+	s.Notifier = n
+	s.Locations = []*time.Location{tokyo, time.UTC}
+	from := time.Date(2020, 3, 13, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 48; i++ {
+		to := from.Add(time.Hour)
+		if err := s.Tick(context.Background(), from, to); err != nil {
+			t.Fatal(err)
+		}
+		from = to
+	}
+	expected := "announced weekend Tokyo, announced weekend UTC, " +
+		"started weekend Tokyo, started weekend UTC"
+	if s := strings.Join(*n, ", "); s != expected {
+		t.Errorf("unexpected notifications %q", s)
+	}
+}
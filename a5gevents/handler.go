@@ -0,0 +1,31 @@
+package a5gevents
+
+import (
+	"context"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gsession"
+)
+
+type EventsResponse struct {
+	Events []*State `json:"events"`
+}
+
+// EventsHandler answers with announced and active events of the
+// a5gsession authenticated player.
+func (s *Scheduler) EventsHandler() a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		sess, ok := a5gsession.FromContext(ctx)
+		if !ok {
+			return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+		}
+		events, err := s.Events(ctx, int64(sess.AccountID))
+		if err != nil {
+			s.Logger.Error(err.Error())
+			return nil, a5gapi.NewJSONMsgDefautlErrors(err)
+		}
+		return &EventsResponse{Events: events}, nil
+	}
+}
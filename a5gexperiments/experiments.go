@@ -0,0 +1,160 @@
+package a5gexperiments
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+var ErrUnknown = errors.New("experiment not found")
+
+// buckets is the bucketing resolution, traffic is given in percents.
+const buckets = 10000
+
+// Variant gets Weight parts of the enrolled traffic.
+type Variant struct {
+	Name   string `json:"name"`
+	Weight int    `json:"weight"`
+}
+
+// Experiment enrolls Traffic percents of players. Salt defaults to ID;
+// changing it reshuffles every player, so keep it while the experiment
+// runs. Raising Traffic keeps variants of players already enrolled.
+type Experiment struct {
+	ID       string     `json:"id"`
+	Salt     string     `json:"salt,omitempty"`
+	Traffic  int        `json:"traffic"`
+	Variants []*Variant `json:"variants"`
+
+	weight int
+}
+
+func NewExperimentsJSON(b []byte) ([]*Experiment, error) {
+	var a []*Experiment
+	if err := json.Unmarshal(b, &a); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return a, nil
+}
+
+// Exposure is passed to listeners, e.g. the analytics pipeline, each time
+// an enrolled player's variant is looked up.
+type Exposure struct {
+	Experiment string `json:"experiment"`
+	Variant    string `json:"variant"`
+	At         int64  `json:"at"`
+}
+
+type ExposureFunc func(ctx context.Context, accountID uint64, e *Exposure)
+
+// Assigner buckets players into experiment variants deterministically by
+// account ID and experiment salt, so every game and instance agrees on
+// them without storing assignments.
+type Assigner struct {
+	Logger a5glogs.Logger
+
+	byID      map[string]*Experiment
+	listeners []ExposureFunc
+	now       func() time.Time
+}
+
+func NewAssigner(
+	experiments []*Experiment, l a5glogs.Logger, listeners ...ExposureFunc) (
+	*Assigner, error) {
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	m := make(map[string]*Experiment, len(experiments))
+	for _, e := range experiments {
+		if e == nil || e.ID == "" {
+			return nil, errors.New("empty experiment id")
+		}
+		if m[e.ID] != nil {
+			return nil, errors.Errorf("duplicate experiment %q", e.ID)
+		}
+		if e.Traffic < 0 || e.Traffic > 100 {
+			return nil, errors.Errorf("experiment %q traffic out of range", e.ID)
+		}
+		if e.Salt == "" {
+			e.Salt = e.ID
+		}
+		e.weight = 0
+		for _, v := range e.Variants {
+			if v == nil || v.Name == "" || v.Weight <= 0 {
+				return nil, errors.Errorf("experiment %q invalid variant", e.ID)
+			}
+			e.weight += v.Weight
+		}
+		if e.weight == 0 {
+			return nil, errors.Errorf("experiment %q has no variants", e.ID)
+		}
+		m[e.ID] = e
+	}
+	return &Assigner{
+		Logger:    l,
+		byID:      m,
+		listeners: listeners,
+		now:       time.Now}, nil
+}
+
+// Variant returns the variant of a player and emits an exposure, call it
+// where the player actually sees the difference. The variant is empty for
+// players outside the experiment traffic.
+func (a *Assigner) Variant(
+	ctx context.Context, accountID uint64, experimentID string) (string, error) {
+	v, err := a.Assign(accountID, experimentID)
+	if err != nil || v == "" {
+		return v, err
+	}
+	e := &Exposure{Experiment: experimentID, Variant: v, At: a.now().Unix()}
+	for _, fn := range a.listeners {
+		fn(ctx, accountID, e)
+	}
+	return v, nil
+}
+
+// Assign returns the variant like Variant does without emitting an
+// exposure, e.g. for reports.
+func (a *Assigner) Assign(accountID uint64, experimentID string) (string, error) {
+	e, ok := a.byID[experimentID]
+	if !ok {
+		return "", errors.Wrapf(ErrUnknown, "%q", experimentID)
+	}
+	// Separate buckets for traffic and variants keep variants stable as
+	// the traffic grows.
+	if bucket(e.Salt, "traffic", accountID) >= e.Traffic*buckets/100 {
+		return "", nil
+	}
+	n := bucket(e.Salt, "variant", accountID) * e.weight / buckets
+	for _, v := range e.Variants {
+		if n < v.Weight {
+			return v.Name, nil
+		}
+		n -= v.Weight
+	}
+	return e.Variants[len(e.Variants)-1].Name, nil
+}
+
+// Assignments returns variants of every experiment the player is enrolled
+// in, without exposures.
+func (a *Assigner) Assignments(accountID uint64) map[string]string {
+	m := make(map[string]string)
+	for id := range a.byID {
+		if v, _ := a.Assign(accountID, id); v != "" {
+			m[id] = v
+		}
+	}
+	return m
+}
+
+func bucket(salt, kind string, accountID uint64) int {
+	h := sha256.Sum256(
+		[]byte(salt + ":" + kind + ":" + strconv.FormatUint(accountID, 10)))
+	return int(binary.BigEndian.Uint64(h[:8]) % buckets)
+}
@@ -0,0 +1,77 @@
+package a5gexperiments
+
+import (
+	"context"
+	"testing"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestAssignerVariant(t *testing.T) {
+	experiments, err := NewExperimentsJSON([]byte(`[
+		{"id": "shop_layout", "traffic": 50, "variants": [
+			{"name": "control", "weight": 1}, {"name": "grid", "weight": 1}]},
+		{"id": "onboarding", "salt": "onb2", "traffic": 100, "variants": [
+			{"name": "control", "weight": 3}, {"name": "short", "weight": 1}]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exposures := make(map[string]int)
+	a, err := NewAssigner(experiments, a5glogs.NewLogrusWrapper(logrus.New()),
+		func(ctx context.Context, accountID uint64, e *Exposure) {
+			exposures[e.Experiment+":"+e.Variant]++
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := a.Variant(ctx, 1, "pvp"); errors.Cause(err) != ErrUnknown {
+		t.Errorf("unexpected error %v", err)
+	}
+	const n = 10000
+	for id := uint64(1); id <= n; id++ {
+		for _, e := range experiments {
+			v, err := a.Variant(ctx, id, e.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again, _ := a.Assign(id, e.ID); again != v {
+				t.Fatalf("%s: account %d bucketed %q and %q", e.ID, id, v, again)
+			}
+		}
+	}
+	tests := []struct {
+		key      string
+		expected int
+	}{
+		{"shop_layout:", n / 2},
+		{"shop_layout:control", n / 4},
+		{"shop_layout:grid", n / 4},
+		{"onboarding:control", n * 3 / 4},
+		{"onboarding:short", n / 4},
+	}
+	for _, test := range tests {
+		x := exposures[test.key]
+		if test.key == "shop_layout:" {
+			x = n - exposures["shop_layout:control"] - exposures["shop_layout:grid"]
+		}
+		if d := x - test.expected; d < -n/50 || d > n/50 {
+			t.Errorf("%s: expected about %d players, got %d",
+				test.key, test.expected, x)
+		}
+	}
+
+	// Raising the traffic keeps variants of enrolled players.
+	before := make(map[uint64]string)
+	for id := uint64(1); id <= 1000; id++ {
+		before[id], _ = a.Assign(id, "shop_layout")
+	}
+	experiments[0].Traffic = 100
+	for id, v := range before {
+		if x, _ := a.Assign(id, "shop_layout"); v != "" && x != v {
+			t.Fatalf("account %d moved from %q to %q", id, v, x)
+		}
+	}
+}
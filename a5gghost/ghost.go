@@ -0,0 +1,184 @@
+package a5gghost
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrGhostUnknown = errors.New("ghost unknown")
+	ErrTrackUnknown = errors.New("ghost track unknown")
+	ErrOutOfBounds  = errors.New("ghost result out of bounds")
+)
+
+// Track bounds results of a race track: runs faster than MinTime or
+// slower than MaxTime, in milliseconds, are rejected as are recordings
+// over MaxData bytes.
+type Track struct {
+	ID      string `json:"id"`
+	MinTime int64  `json:"minTime"`
+	MaxTime int64  `json:"maxTime"`
+	MaxData int    `json:"maxData"`
+}
+
+// Ghost is a recorded run others race against. Data is the recording
+// the client replays, it is left out of listings.
+type Ghost struct {
+	ID        string `json:"id" db:"id"`
+	Track     string `json:"track" db:"track"`
+	PlayerID  uint64 `json:"playerId" db:"player_id"`
+	Rating    int    `json:"rating" db:"rating"`
+	Time      int64  `json:"time" db:"time"`
+	Data      []byte `json:"data,omitempty" db:"data"`
+	CreatedAt int64  `json:"createdAt" db:"created_at"`
+}
+
+// ID is the ghost of a player on a track, a player keeps their best run.
+func ID(track string, playerID uint64) string {
+	return track + ":" + strconv.FormatUint(playerID, 10)
+}
+
+// Store keeps the best ghost of every player per track. Save keeps g
+// unless a faster run of the player is stored and reports whether it
+// did; Band lists the latest ghosts of a track with ratings in [lo, hi]
+// without their data.
+type Store interface {
+	Save(g *Ghost) (bool, error)
+	Get(id string) (*Ghost, error)
+	Band(track string, lo, hi int, limit int) ([]*Ghost, error)
+}
+
+// Band is the rating spread opponents are picked from: Initial first,
+// widened by Step up to Max while there are not enough ghosts.
+type Band struct {
+	Initial int
+	Step    int
+	Max     int
+}
+
+// Ghosts records runs and picks opponents of a similar skill for
+// asynchronous races.
+type Ghosts struct {
+	Store  Store
+	Tracks map[string]*Track
+	Band   Band
+	Logger a5glogs.Logger
+	// Scan is the number of latest ghosts of a band opponents are picked
+	// from.
+	Scan int
+
+	now  func() time.Time
+	perm func(n int) []int
+}
+
+func NewGhosts(s Store, tracks []*Track, l a5glogs.Logger) (*Ghosts, error) {
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	m := make(map[string]*Track, len(tracks))
+	for _, t := range tracks {
+		if t == nil || t.ID == "" {
+			return nil, errors.New("empty ghost track id")
+		}
+		if t.MinTime <= 0 || t.MaxTime < t.MinTime || t.MaxData <= 0 {
+			return nil, errors.Errorf("ghost track %q: unexpected bounds", t.ID)
+		}
+		if _, ok := m[t.ID]; ok {
+			return nil, errors.Errorf("duplicate ghost track %q", t.ID)
+		}
+		m[t.ID] = t
+	}
+	return &Ghosts{
+		Store:  s,
+		Tracks: m,
+		Band:   Band{Initial: 50, Step: 50, Max: 500},
+		Logger: l,
+		Scan:   100,
+		now:    time.Now,
+		perm:   rand.Perm}, nil
+}
+
+func (gs *Ghosts) track(id string) (*Track, error) {
+	t, ok := gs.Tracks[id]
+	if !ok {
+		return nil, errors.Wrap(ErrTrackUnknown, id)
+	}
+	return t, nil
+}
+
+// Submit validates a run against the bounds of its track and keeps it if
+// it is the best of the player. Rating comes from game data rather than
+// the client.
+func (gs *Ghosts) Submit(g *Ghost) (bool, error) {
+	t, err := gs.track(g.Track)
+	if err != nil {
+		return false, err
+	}
+	if g.Time < t.MinTime || g.Time > t.MaxTime {
+		return false, errors.Wrapf(ErrOutOfBounds, "time %d", g.Time)
+	}
+	if len(g.Data) == 0 || len(g.Data) > t.MaxData {
+		return false, errors.Wrapf(ErrOutOfBounds, "data of %d bytes", len(g.Data))
+	}
+	x := *g
+	x.ID = ID(g.Track, g.PlayerID)
+	x.CreatedAt = gs.now().Unix()
+	return gs.Store.Save(&x)
+}
+
+// Opponents picks up to n ghosts of other players on a track within the
+// Band around rating, at random so rematches vary.
+func (gs *Ghosts) Opponents(
+	track string, playerID uint64, rating, n int) ([]*Ghost, error) {
+	if _, err := gs.track(track); err != nil {
+		return nil, err
+	}
+	var a []*Ghost
+	for spread := gs.Band.Initial; ; spread += gs.Band.Step {
+		if spread > gs.Band.Max {
+			spread = gs.Band.Max
+		}
+		ghosts, err := gs.Store.Band(track, rating-spread, rating+spread, gs.Scan)
+		if err != nil {
+			return nil, err
+		}
+		a = a[:0]
+		for _, g := range ghosts {
+			if g.PlayerID != playerID {
+				a = append(a, g)
+			}
+		}
+		if len(a) >= n || spread >= gs.Band.Max || gs.Band.Step <= 0 {
+			break
+		}
+	}
+	picked := make([]*Ghost, 0, n)
+	for _, i := range gs.perm(len(a)) {
+		if len(picked) == n {
+			break
+		}
+		picked = append(picked, a[i])
+	}
+	sort.Slice(picked, func(i, j int) bool { return picked[i].Time < picked[j].Time })
+	return picked, nil
+}
+
+// Download returns a ghost with its recording.
+func (gs *Ghosts) Download(id string) (*Ghost, error) {
+	g, err := gs.Store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if g == nil {
+		return nil, errors.Wrap(ErrGhostUnknown, id)
+	}
+	return g, nil
+}
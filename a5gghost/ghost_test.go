@@ -0,0 +1,80 @@
+package a5gghost
+
+import (
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestGhosts(t *testing.T) {
+	gs, err := NewGhosts(NewMemoryStore(), []*Track{
+		{ID: "canyon", MinTime: 30000, MaxTime: 600000, MaxData: 16}},
+		a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1600000000, 0)
+	gs.now = func() time.Time { return now }
+	gs.perm = func(n int) []int {
+		a := make([]int, n)
+		for i := range a {
+			a[n-1-i] = i
+		}
+		return a
+	}
+	gs.Band = Band{Initial: 100, Step: 100, Max: 300}
+
+	tests := []struct {
+		name  string
+		g     *Ghost
+		err   error
+		saved bool
+	}{
+		{"unknown track", &Ghost{Track: "dunes", PlayerID: 1, Time: 40000,
+			Data: []byte("x")}, ErrTrackUnknown, false},
+		{"too fast", &Ghost{Track: "canyon", PlayerID: 1, Time: 29999,
+			Data: []byte("x")}, ErrOutOfBounds, false},
+		{"too much data", &Ghost{Track: "canyon", PlayerID: 1, Time: 40000,
+			Data: make([]byte, 17)}, ErrOutOfBounds, false},
+		{"first run", &Ghost{Track: "canyon", PlayerID: 1, Rating: 1000,
+			Time: 50000, Data: []byte("a")}, nil, true},
+		{"slower run", &Ghost{Track: "canyon", PlayerID: 1, Rating: 1000,
+			Time: 51000, Data: []byte("b")}, nil, false},
+		{"faster run", &Ghost{Track: "canyon", PlayerID: 1, Rating: 1000,
+			Time: 45000, Data: []byte("c")}, nil, true},
+	}
+	for _, test := range tests {
+		saved, err := gs.Submit(test.g)
+		if errors.Cause(err) != test.err || saved != test.saved {
+			t.Errorf("%s: unexpected result %v %v", test.name, saved, err)
+		}
+	}
+	g, err := gs.Download(ID("canyon", 1))
+	if err != nil || g.Time != 45000 || string(g.Data) != "c" {
+		t.Errorf("unexpected ghost %+v %v", g, err)
+	}
+	if _, err = gs.Download(ID("canyon", 2)); errors.Cause(err) != ErrGhostUnknown {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	for id, rating := range map[uint64]int{2: 1050, 3: 1150, 4: 1250, 5: 1400} {
+		if _, err = gs.Submit(&Ghost{Track: "canyon", PlayerID: id, Rating: rating,
+			Time: 40000 + int64(id), Data: []byte("g")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The band widens until there are enough ghosts, never past Max.
+	a, err := gs.Opponents("canyon", 1, 1000, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != 2 || a[0].PlayerID != 2 || a[1].PlayerID != 3 || a[0].Data != nil {
+		t.Errorf("unexpected opponents %+v %+v", a[0], a[len(a)-1])
+	}
+	if a, _ = gs.Opponents("canyon", 1, 1000, 5); len(a) != 3 {
+		t.Errorf("unexpected opponents %d", len(a))
+	}
+}
@@ -0,0 +1,143 @@
+package a5gghost
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCodeGhostUnknown = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4062,
+		Name:     "ghost_unknown",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "ghost not found"})
+
+	ErrCodeTrackUnknown = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4063,
+		Name:     "ghost_track_unknown",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "track not found"})
+
+	ErrCodeOutOfBounds = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4257,
+		Name:     "ghost_out_of_bounds",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "race result out of bounds"})
+)
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeGhostUnknown, http.StatusNotFound)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeTrackUnknown, http.StatusNotFound)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeOutOfBounds, http.StatusUnprocessableEntity)
+}
+
+// RatingFunc returns the rating of a player on a track from game data.
+type RatingFunc func(ctx context.Context, accountID uint64, track string) (int, error)
+
+type SubmitRequest struct {
+	Track string `json:"track" validate:"required,max=64"`
+	Time  int64  `json:"time" validate:"min=1"`
+	Data  []byte `json:"data" validate:"required"`
+}
+
+type SubmitResponse struct {
+	Ghost *Ghost `json:"ghost"`
+	Best  bool   `json:"best"`
+}
+
+type OpponentsRequest struct {
+	Track string `json:"track" validate:"required,max=64"`
+	Count int    `json:"count" validate:"min=1,max=10"`
+}
+
+type DownloadRequest struct {
+	ID string `json:"id" validate:"required"`
+}
+
+// SubmitHandler records a run of the session player, Best reports
+// whether it replaced their ghost.
+func (gs *Ghosts) SubmitHandler(fn RatingFunc) a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(SubmitRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			r := req.Payload.(*SubmitRequest)
+			rating, err := fn(ctx, s.AccountID, r.Track)
+			if err != nil {
+				return nil, gs.apiErrs(err)
+			}
+			g := &Ghost{Track: r.Track, PlayerID: s.AccountID, Rating: rating,
+				Time: r.Time, Data: r.Data}
+			best, err := gs.Submit(g)
+			if err != nil {
+				return nil, gs.apiErrs(err)
+			}
+			g.ID, g.Data = ID(g.Track, g.PlayerID), nil
+			return &SubmitResponse{Ghost: g, Best: best}, nil
+		})
+}
+
+// OpponentsHandler picks ghosts for the session player to race, the
+// client downloads their recordings with DownloadHandler.
+func (gs *Ghosts) OpponentsHandler(fn RatingFunc) a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(OpponentsRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			r := req.Payload.(*OpponentsRequest)
+			rating, err := fn(ctx, s.AccountID, r.Track)
+			if err != nil {
+				return nil, gs.apiErrs(err)
+			}
+			a, err := gs.Opponents(r.Track, s.AccountID, rating, r.Count)
+			if err != nil {
+				return nil, gs.apiErrs(err)
+			}
+			return a, nil
+		})
+}
+
+// DownloadHandler answers with a ghost and its recording.
+func (gs *Ghosts) DownloadHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(DownloadRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			g, err := gs.Download(req.Payload.(*DownloadRequest).ID)
+			if err != nil {
+				return nil, gs.apiErrs(err)
+			}
+			return g, nil
+		})
+}
+
+func (gs *Ghosts) apiErrs(err error) []*a5gapi.APIErr {
+	switch errors.Cause(err) {
+	case ErrGhostUnknown:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeGhostUnknown, "")}
+	case ErrTrackUnknown:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeTrackUnknown, "")}
+	case ErrOutOfBounds:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeOutOfBounds, "%s", err)}
+	}
+	gs.Logger.Error(err.Error())
+	return a5gapi.NewJSONMsgDefautlErrors(err)
+}
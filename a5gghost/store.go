@@ -0,0 +1,143 @@
+package a5gghost
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryStore struct {
+	mu     sync.Mutex
+	ghosts map[string]*Ghost
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{ghosts: make(map[string]*Ghost)}
+}
+
+func (s *memoryStore) Save(g *Ghost) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if x, ok := s.ghosts[g.ID]; ok && x.Time <= g.Time {
+		return false, nil
+	}
+	x := *g
+	x.Data = append([]byte(nil), g.Data...)
+	s.ghosts[g.ID] = &x
+	return true, nil
+}
+
+func (s *memoryStore) Get(id string) (*Ghost, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.ghosts[id]
+	if !ok {
+		return nil, nil
+	}
+	x := *g
+	x.Data = append([]byte(nil), g.Data...)
+	return &x, nil
+}
+
+func (s *memoryStore) Band(track string, lo, hi int, limit int) ([]*Ghost, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := []*Ghost{}
+	for _, g := range s.ghosts {
+		if g.Track == track && g.Rating >= lo && g.Rating <= hi {
+			x := *g
+			x.Data = nil
+			a = append(a, &x)
+		}
+	}
+	sort.Slice(a, func(i, j int) bool {
+		if a[i].CreatedAt != a[j].CreatedAt {
+			return a[i].CreatedAt > a[j].CreatedAt
+		}
+		return a[i].ID < a[j].ID
+	})
+	if len(a) > limit {
+		a = a[:limit]
+	}
+	return a, nil
+}
+
+// dbStore keeps ghosts in a MySQL table, a row per player and track:
+//
+//	CREATE TABLE ghosts (
+//	  id VARCHAR(128) NOT NULL PRIMARY KEY,
+//	  track VARCHAR(64) NOT NULL,
+//	  player_id BIGINT UNSIGNED NOT NULL,
+//	  rating INT NOT NULL,
+//	  time BIGINT NOT NULL,
+//	  data MEDIUMBLOB NOT NULL,
+//	  created_at BIGINT NOT NULL,
+//	  KEY band (track, rating));
+type dbStore struct {
+	pooler    a5gdb.Pooler
+	tableName string
+}
+
+func NewDBStore(p a5gdb.Pooler, tableName string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if tableName == "" {
+		return nil, errors.New("empty ghosts table name")
+	}
+	return &dbStore{pooler: p, tableName: tableName}, nil
+}
+
+// Save replaces a slower run only; time is assigned last as MySQL
+// evaluates the assignments in order.
+func (s *dbStore) Save(g *Ghost) (bool, error) {
+	res, err := s.pooler.WritePool().NewSession().InsertBySql("INSERT INTO "+
+		s.tableName+" (id, track, player_id, rating, time, data, created_at)"+
+		" VALUES (?, ?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE"+
+		" rating = IF(VALUES(time) < time, VALUES(rating), rating),"+
+		" data = IF(VALUES(time) < time, VALUES(data), data),"+
+		" created_at = IF(VALUES(time) < time, VALUES(created_at), created_at),"+
+		" time = LEAST(time, VALUES(time))",
+		g.ID, g.Track, g.PlayerID, g.Rating, g.Time, g.Data, g.CreatedAt).Exec()
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	// 1 for an insert, 2 for an update and 0 when nothing changed.
+	return n > 0, nil
+}
+
+func (s *dbStore) Get(id string) (*Ghost, error) {
+	g := new(Ghost)
+	err := s.pooler.ReadPool().NewSession().
+		Select("id", "track", "player_id", "rating", "time", "data", "created_at").
+		From(s.tableName).Where(dbr.Eq("id", id)).LoadOne(g)
+	if err == dbr.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	return g, nil
+}
+
+func (s *dbStore) Band(track string, lo, hi int, limit int) ([]*Ghost, error) {
+	a := []*Ghost{}
+	_, err := s.pooler.ReadPool().NewSession().
+		Select("id", "track", "player_id", "rating", "time", "created_at").
+		From(s.tableName).
+		Where(dbr.Eq("track", track)).
+		Where(dbr.Gte("rating", lo)).
+		Where(dbr.Lte("rating", hi)).
+		OrderDesc("created_at").Limit(uint64(limit)).Load(&a)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	return a, nil
+}
@@ -0,0 +1,273 @@
+package a5ggifts
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5greset"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrNotGiftable   = errors.New("not giftable")
+	ErrCapExceeded   = errors.New("gift cap exceeded")
+	ErrBlocked       = errors.New("gift between blocked players")
+	ErrGiftDuplicate = errors.New("gift already sent")
+)
+
+// Scopes of caps: gifts from one player to another one, all gifts a
+// player sends and all gifts a player receives per game day.
+const (
+	ScopePair      = "pair"
+	ScopeSent      = "sent"
+	ScopeReceived  = "received"
+	counterparty   = "gift"
+	reasonGift     = "gift"
+	reasonRefunded = "gift_refund"
+)
+
+// Gift moves Currencies and Items from one player to another one. ID is
+// made by the client, so a resent gift is not sent twice.
+type Gift struct {
+	ID         string           `json:"id"`
+	From       uint64           `json:"from"`
+	To         uint64           `json:"to"`
+	Currencies map[string]int64 `json:"currencies,omitempty"`
+	Items      map[string]int64 `json:"items,omitempty"`
+}
+
+// Cap limits gifts of a scope per game day, zero is uncapped.
+type Cap struct {
+	Count int64 `json:"count"`
+	Value int64 `json:"value"`
+}
+
+// Config prices giftable currencies and items per unit in a common value,
+// e.g. hard currency cents; the rest are not giftable.
+type Config struct {
+	Currencies map[string]int64 `json:"currencies"`
+	Items      map[string]int64 `json:"items"`
+	Caps       map[string]Cap   `json:"caps"`
+}
+
+// Counter is a daily counter of a scope, OtherID is the recipient of
+// pair counters.
+type Counter struct {
+	Scope     string
+	AccountID uint64
+	OtherID   uint64
+	Cap       Cap
+}
+
+// Store keeps daily counters. Reserve adds a gift of value to counters of
+// day unless it takes one over its cap, which it returns; it fails with
+// ErrGiftDuplicate when the gift ID was reserved before.
+type Store interface {
+	Reserve(giftID, day string, value int64, counters []*Counter) (*Counter, error)
+}
+
+// Violation is a gift rejected by a cap, a fraud signal of real money
+// trading funneled through gifts.
+type Violation struct {
+	Gift  *Gift
+	Value int64
+	Scope string
+	Cap   Cap
+	At    time.Time
+}
+
+type ViolationFunc func(ctx context.Context, v *Violation)
+
+// BlockedFunc reports whether either player blocked the other, e.g.
+// a5gblock.Lists.Blocked.
+type BlockedFunc func(ctx context.Context, a, b uint64) (bool, error)
+
+// Gifter sends gifts through the wallet and the inventory within caps.
+type Gifter struct {
+	Config    *Config
+	Store     Store
+	Wallet    *a5gwallet.Wallet
+	Inventory *a5ginventory.Inventory
+	Logger    a5glogs.Logger
+	// Reset is where game days start, UTC midnight when nil.
+	Reset       *a5greset.Reset
+	Blocked     BlockedFunc
+	OnViolation []ViolationFunc
+
+	now func() time.Time
+}
+
+func NewGifter(c *Config, s Store, w *a5gwallet.Wallet,
+	inv *a5ginventory.Inventory, l a5glogs.Logger) (*Gifter, error) {
+	if c == nil {
+		return nil, errors.New("nil gift config")
+	}
+	for scope := range c.Caps {
+		if scope != ScopePair && scope != ScopeSent && scope != ScopeReceived {
+			return nil, errors.Errorf("unknown gift cap scope %q", scope)
+		}
+	}
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if w == nil && len(c.Currencies) > 0 {
+		return nil, errors.New("wallet missing")
+	}
+	if inv == nil && len(c.Items) > 0 {
+		return nil, errors.New("inventory missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Gifter{
+		Config:    c,
+		Store:     s,
+		Wallet:    w,
+		Inventory: inv,
+		Logger:    l,
+		now:       time.Now}, nil
+}
+
+// Value prices a gift, failing with ErrNotGiftable on currencies and
+// items the config doesn't price.
+func (g *Gifter) Value(x *Gift) (int64, error) {
+	var v int64
+	for id, n := range x.Currencies {
+		price, ok := g.Config.Currencies[id]
+		if !ok || n <= 0 {
+			return 0, errors.Wrap(ErrNotGiftable, id)
+		}
+		v += price * n
+	}
+	for id, n := range x.Items {
+		price, ok := g.Config.Items[id]
+		if !ok || n <= 0 {
+			return 0, errors.Wrap(ErrNotGiftable, id)
+		}
+		v += price * n
+	}
+	return v, nil
+}
+
+// Send takes a gift from the sender and gives it to the recipient. Items
+// are taken first and given back when currencies can't be. A failure to
+// give is returned after the gift is taken; taken currencies stay booked
+// on the gift counterparty of the ledger for support.
+func (g *Gifter) Send(ctx context.Context, x *Gift) error {
+	if x.ID == "" || x.From == 0 || x.To == 0 || x.From == x.To {
+		return errors.New("invalid gift")
+	}
+	if len(x.Currencies)+len(x.Items) == 0 {
+		return errors.New("empty gift")
+	}
+	value, err := g.Value(x)
+	if err != nil {
+		return err
+	}
+	if g.Blocked != nil {
+		blocked, err := g.Blocked(ctx, x.From, x.To)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return ErrBlocked
+		}
+	}
+	now := g.now()
+	var counters []*Counter
+	for _, c := range []*Counter{
+		{Scope: ScopePair, AccountID: x.From, OtherID: x.To},
+		{Scope: ScopeSent, AccountID: x.From},
+		{Scope: ScopeReceived, AccountID: x.To}} {
+		c.Cap = g.Config.Caps[c.Scope]
+		if c.Cap.Count > 0 || c.Cap.Value > 0 {
+			counters = append(counters, c)
+		}
+	}
+	over, err := g.Store.Reserve(x.ID, g.Reset.Day(now).Key, value, counters)
+	if err != nil {
+		return err
+	}
+	if over != nil {
+		v := &Violation{Gift: x, Value: value, Scope: over.Scope, Cap: over.Cap, At: now}
+		for _, fn := range g.OnViolation {
+			fn(ctx, v)
+		}
+		return errors.Wrap(ErrCapExceeded, over.Scope)
+	}
+	if err = g.take(x); err != nil {
+		return err
+	}
+	return g.give(x)
+}
+
+func sorted(m map[string]int64) []string {
+	a := make([]string, 0, len(m))
+	for id := range m {
+		a = append(a, id)
+	}
+	sort.Strings(a)
+	return a
+}
+
+func (g *Gifter) take(x *Gift) error {
+	if len(x.Items) > 0 {
+		t := a5ginventory.NewTx(reasonGift, "gift:"+x.ID)
+		for _, id := range sorted(x.Items) {
+			t.Consume(id, x.Items[id])
+		}
+		if _, err := g.Inventory.Apply(x.From, t); err != nil {
+			return err
+		}
+	}
+	if len(x.Currencies) == 0 {
+		return nil
+	}
+	t := a5gwallet.NewTx("gift:"+x.ID+":from",
+		counterparty+":"+strconv.FormatUint(x.To, 10), reasonGift)
+	for _, id := range sorted(x.Currencies) {
+		t.Debit(id, x.Currencies[id])
+	}
+	_, err := g.Wallet.Apply(x.From, t)
+	if err == nil || len(x.Items) == 0 {
+		return err
+	}
+	refund := a5ginventory.NewTx(reasonRefunded, "gift:"+x.ID).MailOverflow()
+	for _, id := range sorted(x.Items) {
+		refund.Grant(id, x.Items[id])
+	}
+	if _, e := g.Inventory.Apply(x.From, refund); e != nil {
+		g.Logger.With(a5gfields.String("giftID", x.ID)).Error(
+			errors.Wrap(e, "gift items not refunded").Error())
+	}
+	return err
+}
+
+func (g *Gifter) give(x *Gift) error {
+	if len(x.Currencies) > 0 {
+		t := a5gwallet.NewTx("gift:"+x.ID+":to",
+			counterparty+":"+strconv.FormatUint(x.From, 10), reasonGift)
+		for _, id := range sorted(x.Currencies) {
+			t.Credit(id, x.Currencies[id])
+		}
+		if _, err := g.Wallet.Apply(x.To, t); err != nil {
+			return errors.Wrapf(err, "gift %s taken, not given", x.ID)
+		}
+	}
+	if len(x.Items) > 0 {
+		t := a5ginventory.NewTx(reasonGift, "gift:"+x.ID).MailOverflow()
+		for _, id := range sorted(x.Items) {
+			t.Grant(id, x.Items[id])
+		}
+		if _, err := g.Inventory.Apply(x.To, t); err != nil {
+			return errors.Wrapf(err, "gift %s taken, not given", x.ID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package a5ggifts
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestGifterSend(t *testing.T) {
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	c, _ := a5gwallet.NewCurrencies(a5gwallet.Currency{ID: "gold"})
+	w, _ := a5gwallet.NewWallet(a5gwallet.NewMemoryStore(), c, l)
+	catalog, _ := a5ginventory.NewCatalogJSON([]byte(`{"items": [{"id": "gem"}]}`))
+	inv, _ := a5ginventory.NewInventory(a5ginventory.NewMemoryStore(), catalog, l)
+	for id, gold := range map[uint64]int64{1: 1000, 2: 100} {
+		if _, err := w.Credit(id, fmt.Sprint("seed", id), "test", "seed", "gold", gold); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := inv.Apply(id, a5ginventory.NewTx("seed", "").Grant("gem", 10)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g, err := NewGifter(&Config{
+		Currencies: map[string]int64{"gold": 1},
+		Items:      map[string]int64{"gem": 50},
+		Caps: map[string]Cap{
+			ScopePair:     {Count: 2, Value: 300},
+			ScopeReceived: {Value: 400}}}, NewMemoryStore(), w, inv, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	g.now = func() time.Time { return now }
+	var violations []*Violation
+	g.OnViolation = append(g.OnViolation, func(ctx context.Context, v *Violation) {
+		violations = append(violations, v)
+	})
+	g.Blocked = func(ctx context.Context, a, b uint64) (bool, error) {
+		return a == 4 || b == 4, nil
+	}
+
+	tests := []struct {
+		name string
+		gift *Gift
+		err  error
+	}{
+		{"gold", &Gift{ID: "g1", From: 1, To: 3,
+			Currencies: map[string]int64{"gold": 100}}, nil},
+		{"duplicate", &Gift{ID: "g1", From: 1, To: 3,
+			Currencies: map[string]int64{"gold": 100}}, ErrGiftDuplicate},
+		{"pair value", &Gift{ID: "g2", From: 1, To: 3,
+			Items: map[string]int64{"gem": 5}}, ErrCapExceeded},
+		{"gems", &Gift{ID: "g3", From: 1, To: 3,
+			Currencies: map[string]int64{"gold": 50}, Items: map[string]int64{"gem": 2}}, nil},
+		{"pair count", &Gift{ID: "g4", From: 1, To: 3,
+			Currencies: map[string]int64{"gold": 1}}, ErrCapExceeded},
+		{"received value", &Gift{ID: "g5", From: 2, To: 3,
+			Currencies: map[string]int64{"gold": 201}}, ErrCapExceeded},
+		{"not giftable", &Gift{ID: "g6", From: 2, To: 3,
+			Currencies: map[string]int64{"gems": 1}}, ErrNotGiftable},
+		{"blocked", &Gift{ID: "g7", From: 2, To: 4,
+			Currencies: map[string]int64{"gold": 1}}, ErrBlocked},
+		{"insufficient", &Gift{ID: "g8", From: 2, To: 5,
+			Currencies: map[string]int64{"gold": 150}, Items: map[string]int64{"gem": 1}},
+			a5gwallet.ErrInsufficientFunds},
+	}
+	for _, test := range tests {
+		if err := g.Send(context.Background(), test.gift); errors.Cause(err) != test.err {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+	}
+	if len(violations) != 3 || violations[0].Scope != ScopePair ||
+		violations[2].Scope != ScopeReceived || violations[2].Value != 201 {
+		t.Errorf("unexpected violations %+v", violations)
+	}
+	balances := func(id uint64) (int64, int64) {
+		b, _ := w.Balances(id)
+		s, _ := inv.Stacks(id)
+		var gold, gems int64
+		if len(b) > 0 {
+			gold = b[0].Balance
+		}
+		if len(s) > 0 {
+			gems = s[0].Quantity
+		}
+		return gold, gems
+	}
+	for _, x := range []struct {
+		id         uint64
+		gold, gems int64
+	}{{1, 850, 8}, {2, 100, 10}, {3, 150, 2}, {5, 0, 0}} {
+		if gold, gems := balances(x.id); gold != x.gold || gems != x.gems {
+			t.Errorf("account %d: expected %d gold %d gems, got %d %d",
+				x.id, x.gold, x.gems, gold, gems)
+		}
+	}
+
+	// Caps start over on the next game day.
+	now = now.AddDate(0, 0, 1)
+	if err = g.Send(context.Background(), &Gift{ID: "g9", From: 1, To: 3,
+		Currencies: map[string]int64{"gold": 1}}); err != nil {
+		t.Fatal(err)
+	}
+}
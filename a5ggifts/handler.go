@@ -0,0 +1,103 @@
+package a5ggifts
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCodeBlocked = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4031,
+		Name:     "gift_blocked",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "gifts between these players are blocked"})
+
+	ErrCodeNotGiftable = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4244,
+		Name:     "gift_not_giftable",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "not giftable"})
+
+	ErrCodeDuplicate = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4245,
+		Name:     "gift_duplicate",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "gift already sent"})
+
+	ErrCodeCapExceeded = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4293,
+		Name:     "gift_cap_exceeded",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "daily gift limit reached"})
+)
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeBlocked, http.StatusForbidden)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeNotGiftable, http.StatusUnprocessableEntity)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeDuplicate, http.StatusConflict)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeCapExceeded, http.StatusTooManyRequests)
+}
+
+type SendRequest struct {
+	ID         string           `json:"id" validate:"required,max=64"`
+	To         uint64           `json:"to" validate:"required"`
+	Currencies map[string]int64 `json:"currencies"`
+	Items      map[string]int64 `json:"items"`
+}
+
+// SendHandler sends a gift from the session player.
+func (g *Gifter) SendHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(SendRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			r := req.Payload.(*SendRequest)
+			x := &Gift{
+				ID:         r.ID,
+				From:       s.AccountID,
+				To:         r.To,
+				Currencies: r.Currencies,
+				Items:      r.Items}
+			if err := g.Send(ctx, x); err != nil {
+				return nil, g.apiErrs(err)
+			}
+			return x, nil
+		})
+}
+
+func (g *Gifter) apiErrs(err error) []*a5gapi.APIErr {
+	switch errors.Cause(err) {
+	case ErrBlocked:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeBlocked, "")}
+	case ErrNotGiftable:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeNotGiftable, "%s", err)}
+	case ErrGiftDuplicate:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeDuplicate, "")}
+	case ErrCapExceeded:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeCapExceeded, "")}
+	case a5gwallet.ErrInsufficientFunds:
+		return g.Wallet.APIErrs(err)
+	case a5ginventory.ErrInsufficient:
+		return g.Inventory.APIErrs(err)
+	}
+	g.Logger.Error(err.Error())
+	return a5gapi.NewJSONMsgDefautlErrors(err)
+}
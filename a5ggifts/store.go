@@ -0,0 +1,164 @@
+package a5ggifts
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type count struct {
+	n     int64
+	value int64
+}
+
+type memoryStore struct {
+	mu       sync.Mutex
+	day      string
+	gifts    map[string]bool
+	counters map[string]*count
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{
+		gifts:    make(map[string]bool),
+		counters: make(map[string]*count)}
+}
+
+func (c *Counter) key() string {
+	return c.Scope + ":" + strconv.FormatUint(c.AccountID, 10) + ":" +
+		strconv.FormatUint(c.OtherID, 10)
+}
+
+func (c *Counter) over(n, value int64) bool {
+	return c.Cap.Count > 0 && n > c.Cap.Count ||
+		c.Cap.Value > 0 && value > c.Cap.Value
+}
+
+// Reserve keeps counters of the last day only, gift IDs are kept as long
+// as the process runs.
+func (s *memoryStore) Reserve(
+	giftID, day string, value int64, counters []*Counter) (*Counter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.gifts[giftID] {
+		return nil, ErrGiftDuplicate
+	}
+	if day != s.day {
+		s.day = day
+		s.counters = make(map[string]*count)
+	}
+	for _, c := range counters {
+		x := s.counters[c.key()]
+		if x == nil {
+			x = new(count)
+		}
+		if c.over(x.n+1, x.value+value) {
+			return c, nil
+		}
+	}
+	for _, c := range counters {
+		x := s.counters[c.key()]
+		if x == nil {
+			x = new(count)
+			s.counters[c.key()] = x
+		}
+		x.n++
+		x.value += value
+	}
+	s.gifts[giftID] = true
+	return nil, nil
+}
+
+// dbStore keeps counters and sent gifts in MySQL tables:
+//
+//	CREATE TABLE gift_counters (
+//	  day VARCHAR(16) NOT NULL,
+//	  scope VARCHAR(16) NOT NULL,
+//	  account_id BIGINT UNSIGNED NOT NULL,
+//	  other_id BIGINT UNSIGNED NOT NULL,
+//	  count BIGINT NOT NULL,
+//	  value BIGINT NOT NULL,
+//	  PRIMARY KEY (day, scope, account_id, other_id));
+//
+//	CREATE TABLE gifts (
+//	  id VARCHAR(128) NOT NULL PRIMARY KEY,
+//	  value BIGINT NOT NULL,
+//	  created_at DATETIME NOT NULL);
+//
+// Counters of past days may be dropped, e.g. by a5gretention.
+type dbStore struct {
+	pooler            a5gdb.Pooler
+	countersTableName string
+	giftsTableName    string
+}
+
+type dbCount struct {
+	Count int64 `db:"count"`
+	Value int64 `db:"value"`
+}
+
+func NewDBStore(
+	p a5gdb.Pooler, countersTableName, giftsTableName string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if countersTableName == "" || giftsTableName == "" {
+		return nil, errors.New("empty gifts table name")
+	}
+	return &dbStore{
+		pooler:            p,
+		countersTableName: countersTableName,
+		giftsTableName:    giftsTableName}, nil
+}
+
+// Reserve adds to counters first and checks them after, the transaction
+// is rolled back when one is over its cap.
+func (s *dbStore) Reserve(
+	giftID, day string, value int64, counters []*Counter) (*Counter, error) {
+	tx, err := s.pooler.WritePool().NewSession().Begin()
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*Session).Begin fn")
+	}
+	defer tx.RollbackUnlessCommitted()
+	res, err := tx.InsertBySql("INSERT IGNORE INTO "+s.giftsTableName+
+		" (id, value, created_at) VALUES (?, ?, ?)",
+		giftID, value, time.Now().UTC()).Exec()
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	if n == 0 {
+		return nil, ErrGiftDuplicate
+	}
+	for _, c := range counters {
+		_, err = tx.InsertBySql("INSERT INTO "+s.countersTableName+
+			" (day, scope, account_id, other_id, count, value) VALUES (?, ?, ?, ?, 1, ?)"+
+			" ON DUPLICATE KEY UPDATE count = count + 1, value = value + VALUES(value)",
+			day, c.Scope, c.AccountID, c.OtherID, value).Exec()
+		if err != nil {
+			return nil, errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+		}
+		x := new(dbCount)
+		err = tx.Select("count", "value").From(s.countersTableName).
+			Where(dbr.Eq("day", day)).Where(dbr.Eq("scope", c.Scope)).
+			Where(dbr.Eq("account_id", c.AccountID)).
+			Where(dbr.Eq("other_id", c.OtherID)).LoadOne(x)
+		if err != nil {
+			return nil, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+		}
+		if c.over(x.Count, x.Value) {
+			return c, nil
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "dbr.(*Tx).Commit fn")
+	}
+	return nil, nil
+}
@@ -0,0 +1,220 @@
+package a5ghttp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5gcodec"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+// HandlerFunc is an API handler free of transport concerns. The returned
+// payload and errors are wrapped into the a5gapi envelope by Adapter.
+type HandlerFunc func(
+	context.Context, *a5gapi.APIMsgRequest) (interface{}, []*a5gapi.APIErr)
+
+// Adapter turns HandlerFunc into http.Handler: decodes the request
+// envelope, applies debug level filtering through the Responder and
+// writes the response envelope with a status StatusMapper derives from
+// errors.
+type Adapter struct {
+	Responder    *a5gapi.Responder
+	Logger       a5glogs.Logger
+	StatusMapper *StatusMapper
+	MaxBodyBytes int64
+	// Versions, when set, negotiates the envelope version of every request.
+	Versions *Versions
+}
+
+func NewAdapter(r *a5gapi.Responder, l a5glogs.Logger) (*Adapter, error) {
+	if r == nil {
+		return nil, errors.New("responder missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Adapter{
+		Responder:    r,
+		Logger:       l,
+		StatusMapper: DefaultStatusMapper,
+		MaxBodyBytes: 1 << 20}, nil
+}
+
+func (a *Adapter) Handler(fn HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		req, err := a.decode(r)
+		if err != nil {
+			a.Logger.Warn(err.Error())
+			writeErr(w, r, a.Logger, http.StatusBadRequest,
+				a5gapi.NewErr(ErrCodeRequestMalformed, ""))
+			return
+		}
+		if req.RequestID != "" && a5gapi.RequestIDFromContext(ctx) == "" &&
+			requestIDRegexp.MatchString(req.RequestID) {
+			ctx = contextWithRequestID(ctx, req.RequestID)
+		}
+		if a5gapi.RouteFromContext(ctx) == "" {
+			ctx = a5gapi.ContextWithRoute(ctx, r.Method+" "+r.URL.Path)
+		}
+		if err = requestParams(r, req); err != nil {
+			a.Logger.Warn(err.Error())
+			writeErr(w, r, a.Logger, http.StatusBadRequest,
+				a5gapi.NewErr(ErrCodeRequestMalformed, ""))
+			return
+		}
+		if a.Versions != nil {
+			v, ok := a.Versions.Negotiate(req.APIVersion)
+			if !ok {
+				a.Versions.Reject(w, r.WithContext(ctx), req.APIVersion)
+				return
+			}
+			ctx = a5gapi.ContextWithAPIVersion(ctx, v)
+		}
+		payload, errs := fn(ctx, req)
+		payload, page := a5gapi.UnwrapPaged(payload)
+		severity := MaxSeverity(errs)
+		status := a.StatusMapper.Status(errs)
+		isSuccess := severity < a5gapi.ErrSeverityError &&
+			status < http.StatusBadRequest
+		if isSuccess {
+			payload, err = selectFields(r, req, payload)
+			if err != nil {
+				errs = append(errs, a5gapi.NewJSONMsgDefautlErrors(err)...)
+				status = a.StatusMapper.Status(errs)
+				isSuccess = false
+			}
+		}
+		res, err := a.Responder.NewResponse(
+			ctx, isSuccess, payload, nil, errs...)
+		if err != nil {
+			a.Logger.Error(err.Error())
+			http.Error(w, http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError)
+			return
+		}
+		if isSuccess {
+			res.Page = page
+		}
+		writeMsg(w, r, a.Logger, status, res)
+	})
+}
+
+// decode reads request envelope in the codec of its Content-Type leaving
+// the payload raw JSON, use DecodePayload to unmarshal it into a handler
+// specific type.
+func (a *Adapter) decode(r *http.Request) (*a5gapi.APIMsgRequest, error) {
+	raw := new(json.RawMessage)
+	req := &a5gapi.APIMsgRequest{Payload: raw}
+	if r.Body == nil {
+		return req, nil
+	}
+	var body io.Reader = r.Body
+	if a.MaxBodyBytes > 0 {
+		body = io.LimitReader(r.Body, a.MaxBodyBytes+1)
+	}
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if a.MaxBodyBytes > 0 && int64(len(b)) > a.MaxBodyBytes {
+		return nil, errors.New("request body too large")
+	}
+	if len(b) == 0 {
+		return req, nil
+	}
+	c, err := a5gcodec.ByContentType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	if err = c.Unmarshal(b, req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// requestParams fills envelope fields absent in the body from the
+// request: the version from X-API-Version, preconditions from If-Match (a version ETag) and
+// If-Unmodified-Since headers, page from cursor and limit query values.
+func requestParams(r *http.Request, req *a5gapi.APIMsgRequest) error {
+	if s := r.Header.Get(APIVersionHeader); s != "" && req.APIVersion == 0 {
+		i, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return errors.Wrap(err, "api version header")
+		}
+		req.APIVersion = i
+	}
+	if s := r.Header.Get("If-Match"); s != "" && req.IfVersion == 0 {
+		s = strings.Trim(strings.TrimPrefix(s, "W/"), `"`)
+		i, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return errors.Wrap(err, "if-match header")
+		}
+		req.IfVersion = i
+	}
+	if s := r.Header.Get("If-Unmodified-Since"); s != "" &&
+		req.IfUnmodifiedSince == 0 {
+		t, err := http.ParseTime(s)
+		if err != nil {
+			return errors.Wrap(err, "if-unmodified-since header")
+		}
+		req.IfUnmodifiedSince = uint64(t.Unix())
+	}
+	q := r.URL.Query()
+	if req.Page == nil && (q.Get("cursor") != "" || q.Get("limit") != "") {
+		req.Page = &a5gapi.PageRequest{Cursor: q.Get("cursor")}
+		if s := q.Get("limit"); s != "" {
+			i, err := strconv.Atoi(s)
+			if err != nil {
+				return errors.Wrap(err, "limit query value")
+			}
+			req.Page.Limit = i
+		}
+	}
+	return nil
+}
+
+// selectFields applies the "fields" of the envelope or, failing that, of
+// the query string.
+func selectFields(
+	r *http.Request, req *a5gapi.APIMsgRequest,
+	payload interface{}) (interface{}, error) {
+	fields := req.Fields
+	if len(fields) == 0 {
+		fields = a5gapi.ParseFields(r.URL.Query().Get("fields"))
+	}
+	return a5gapi.SelectFields(payload, fields)
+}
+
+// DecodePayload unmarshals payload of a request decoded by Adapter.
+func DecodePayload(r *a5gapi.APIMsgRequest, v interface{}) error {
+	raw, ok := r.Payload.(*json.RawMessage)
+	if !ok {
+		return errors.New("request payload is not raw json")
+	}
+	if raw == nil || len(*raw) == 0 {
+		return errors.New("empty request payload")
+	}
+	if err := json.Unmarshal(*raw, v); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// MaxSeverity returns the highest severity among errs.
+func MaxSeverity(errs []*a5gapi.APIErr) a5gapi.ErrSeverity {
+	var s a5gapi.ErrSeverity
+	for _, e := range errs {
+		if x := a5gapi.ErrSeverity(e.Severity); x > s {
+			s = x
+		}
+	}
+	return s
+}
@@ -0,0 +1,89 @@
+package a5ghttp
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5gcodec"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/sirupsen/logrus"
+)
+
+type testConfig struct{}
+
+func (testConfig) DebugLevel() int { return 0 }
+
+func TestAdapterCodecs(t *testing.T) {
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	r, err := a5gapi.NewResponder(testConfig{}, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewAdapter(r, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type account struct {
+		ID uint64 `json:"id"`
+	}
+	h := a.Handler(func(
+		ctx context.Context, req *a5gapi.APIMsgRequest) (interface{}, []*a5gapi.APIErr) {
+		v := new(account)
+		if err := DecodePayload(req, v); err != nil {
+			return nil, a5gapi.NewJSONMsgDefautlErrors(err)
+		}
+		return v, nil
+	})
+	tests := []struct {
+		contentType, accept string
+		want                a5gcodec.Codec
+	}{
+		{"", "", a5gcodec.JSON},
+		{a5gcodec.ContentTypeMsgpack, "", a5gcodec.Msgpack},
+		{a5gcodec.ContentTypeProtobuf, "", a5gcodec.Protobuf},
+		{a5gcodec.ContentTypeProtobuf, "application/json", a5gcodec.JSON},
+		{"", a5gcodec.ContentTypeMsgpack, a5gcodec.Msgpack},
+	}
+	for _, x := range tests {
+		in, err := a5gcodec.ByContentType(x.contentType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := in.Marshal(&a5gapi.APIMsgRequest{
+			Payload: &account{ID: math.MaxUint64}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/account", bytes.NewReader(b))
+		req.Header.Set("Content-Type", x.contentType)
+		req.Header.Set("Accept", x.accept)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if ct := w.Header().Get("Content-Type"); ct != x.want.ContentType() {
+			t.Errorf("%q %q: content type %q want %q",
+				x.contentType, x.accept, ct, x.want.ContentType())
+			continue
+		}
+		v := new(account)
+		res := &a5gapi.APIMsgResponse{Payload: v}
+		if err = x.want.Unmarshal(w.Body.Bytes(), res); err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != http.StatusOK || !res.Success || v.ID != math.MaxUint64 {
+			t.Errorf("%q %q: %d %+v %+v", x.contentType, x.accept, w.Code, res, v)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/account", bytes.NewBufferString("x"))
+	req.Header.Set("Content-Type", "text/plain")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unsupported content type answered %d", w.Code)
+	}
+}
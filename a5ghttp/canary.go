@@ -0,0 +1,305 @@
+package a5ghttp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+// Canary cohorts; CanaryHeader carries the cohort of a request to the
+// instances behind the gateway and CanaryCookie pins it on clients.
+const (
+	CohortStable = "stable"
+	CohortCanary = "canary"
+
+	CanaryHeader = "X-Canary-Cohort"
+	CanaryCookie = "a5g_canary"
+)
+
+// Canary routes a cohort of players to canary instances: accounts of
+// Accounts and Percent of the others by a stable hash, so a player stays
+// in a cohort while the percent only grows. With a Target, canary
+// requests are proxied there; without one only CanaryHeader is set for
+// the gateway to route on. Errors (5xx answers) and latencies are
+// recorded per cohort and Watch compares them, rolling back to no canary
+// traffic when the canary is worse.
+type Canary struct {
+	Target  *url.URL
+	Percent float64
+	// Accounts are always canary, e.g. of testers.
+	Accounts map[uint64]bool
+	Salt     string
+	// Account resolves the player of a request, e.g. from the session
+	// token; requests without one follow their cookie or stay stable.
+	Account func(r *http.Request) (uint64, bool)
+	Logger  a5glogs.Logger
+	// Watch rolls back when the canary error rate exceeds the stable one
+	// by MaxErrorRateDelta, or its p95 latency the stable one times
+	// MaxLatencyRatio, over windows of at least MinRequests per cohort.
+	MaxErrorRateDelta float64
+	MaxLatencyRatio   float64
+	MinRequests       int64
+
+	proxy http.Handler
+	now   func() time.Time
+
+	mu         sync.Mutex
+	rolledBack bool
+	stats      map[string]*cohortStats
+	since      time.Time
+}
+
+// maxLatencySamples bounds latencies kept per cohort and window.
+const maxLatencySamples = 4096
+
+type cohortStats struct {
+	requests  int64
+	errors    int64
+	latencies []time.Duration
+}
+
+func NewCanary(target string, percent float64, l a5glogs.Logger) (*Canary, error) {
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	if percent < 0 || percent > 100 {
+		return nil, errors.Errorf("canary percent %v out of range", percent)
+	}
+	c := &Canary{
+		Percent:           percent,
+		Logger:            l,
+		MaxErrorRateDelta: 0.01,
+		MaxLatencyRatio:   1.5,
+		MinRequests:       500,
+		now:               time.Now}
+	if target != "" {
+		u, err := url.Parse(target)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return nil, errors.Errorf("canary target %q is not absolute", target)
+		}
+		c.Target = u
+		c.proxy = httputil.NewSingleHostReverseProxy(u)
+	}
+	c.reset()
+	return c, nil
+}
+
+func (c *Canary) reset() {
+	c.stats = map[string]*cohortStats{CohortStable: {}, CohortCanary: {}}
+	c.since = c.now()
+}
+
+// Cohort returns the cohort of a request. Without an account the cookie
+// decides, which Middleware sets from an earlier authenticated request.
+func (c *Canary) Cohort(r *http.Request) string {
+	c.mu.Lock()
+	rolledBack := c.rolledBack
+	c.mu.Unlock()
+	if rolledBack {
+		return CohortStable
+	}
+	if c.Account != nil {
+		if id, ok := c.Account(r); ok {
+			return c.accountCohort(id)
+		}
+	}
+	if x, err := r.Cookie(CanaryCookie); err == nil && x.Value == CohortCanary {
+		return CohortCanary
+	}
+	return CohortStable
+}
+
+func (c *Canary) accountCohort(accountID uint64) string {
+	if c.Accounts[accountID] {
+		return CohortCanary
+	}
+	h := sha256.Sum256([]byte(c.Salt + ":canary:" + strconv.FormatUint(accountID, 10)))
+	if float64(binary.BigEndian.Uint64(h[:8])%10000) < c.Percent*100 {
+		return CohortCanary
+	}
+	return CohortStable
+}
+
+func (c *Canary) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cohort := c.Cohort(r)
+		r.Header.Set(CanaryHeader, cohort)
+		if x, err := r.Cookie(CanaryCookie); err != nil || x.Value != cohort {
+			http.SetCookie(w, &http.Cookie{Name: CanaryCookie, Value: cohort,
+				Path: "/", MaxAge: 86400, HttpOnly: true})
+		}
+		h := next
+		if cohort == CohortCanary && c.proxy != nil {
+			h = c.proxy
+		}
+		start := c.now()
+		x := &canaryWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(x, r)
+		c.Observe(cohort, c.now().Sub(start), x.status >= http.StatusInternalServerError)
+	})
+}
+
+type canaryWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *canaryWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Observe records a request of cohort, e.g. from instances which get the
+// cohort by CanaryHeader from the gateway.
+func (c *Canary) Observe(cohort string, d time.Duration, failed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.stats[cohort]
+	if !ok {
+		return
+	}
+	s.requests++
+	if failed {
+		s.errors++
+	}
+	if len(s.latencies) < maxLatencySamples {
+		s.latencies = append(s.latencies, d)
+	} else {
+		s.latencies[s.requests%maxLatencySamples] = d
+	}
+}
+
+// CohortReport sums a cohort over the window of a CanaryReport.
+type CohortReport struct {
+	Requests  int64   `json:"requests"`
+	Errors    int64   `json:"errors"`
+	ErrorRate float64 `json:"errorRate"`
+	P50Ms     float64 `json:"p50Ms"`
+	P95Ms     float64 `json:"p95Ms"`
+}
+
+// CanaryReport compares the cohorts; Verdict is "insufficient" while
+// a cohort has fewer than MinRequests, then "healthy" or "degraded".
+type CanaryReport struct {
+	Since      int64                    `json:"since"`
+	Cohorts    map[string]*CohortReport `json:"cohorts"`
+	Verdict    string                   `json:"verdict"`
+	RolledBack bool                     `json:"rolledBack"`
+}
+
+// Canary verdicts.
+const (
+	VerdictInsufficient = "insufficient"
+	VerdictHealthy      = "healthy"
+	VerdictDegraded     = "degraded"
+)
+
+// Report compares the cohorts since the last reset; reset starts a new
+// window.
+func (c *Canary) Report(reset bool) *CanaryReport {
+	c.mu.Lock()
+	r := &CanaryReport{Since: c.since.Unix(), RolledBack: c.rolledBack,
+		Cohorts: make(map[string]*CohortReport, len(c.stats))}
+	for k, s := range c.stats {
+		r.Cohorts[k] = s.report()
+	}
+	if reset {
+		c.reset()
+	}
+	c.mu.Unlock()
+	r.Verdict = c.verdict(r.Cohorts[CohortStable], r.Cohorts[CohortCanary])
+	return r
+}
+
+func (s *cohortStats) report() *CohortReport {
+	r := &CohortReport{Requests: s.requests, Errors: s.errors}
+	if s.requests > 0 {
+		r.ErrorRate = float64(s.errors) / float64(s.requests)
+	}
+	a := append([]time.Duration(nil), s.latencies...)
+	sort.Slice(a, func(i, j int) bool { return a[i] < a[j] })
+	r.P50Ms, r.P95Ms = percentileMs(a, 50), percentileMs(a, 95)
+	return r
+}
+
+func percentileMs(sorted []time.Duration, p int) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return float64(sorted[(len(sorted)-1)*p/100]) / float64(time.Millisecond)
+}
+
+func (c *Canary) verdict(stable, canary *CohortReport) string {
+	if stable.Requests < c.MinRequests || canary.Requests < c.MinRequests {
+		return VerdictInsufficient
+	}
+	if canary.ErrorRate-stable.ErrorRate > c.MaxErrorRateDelta ||
+		stable.P95Ms > 0 && canary.P95Ms > stable.P95Ms*c.MaxLatencyRatio {
+		return VerdictDegraded
+	}
+	return VerdictHealthy
+}
+
+// Watch reports each interval until ctx is done, starting a new window
+// when a verdict was reached, and rolls back on a degraded one.
+func (c *Canary) Watch(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		r := c.Report(false)
+		if r.Verdict == VerdictInsufficient {
+			continue
+		}
+		c.Report(true)
+		stable, canary := r.Cohorts[CohortStable], r.Cohorts[CohortCanary]
+		l := c.Logger.With(
+			a5gfields.String("verdict", r.Verdict),
+			a5gfields.Float64("stableErrorRate", stable.ErrorRate),
+			a5gfields.Float64("canaryErrorRate", canary.ErrorRate),
+			a5gfields.Float64("stableP95Ms", stable.P95Ms),
+			a5gfields.Float64("canaryP95Ms", canary.P95Ms))
+		if r.Verdict == VerdictHealthy {
+			l.Info("canary healthy")
+			continue
+		}
+		c.Rollback(true)
+		l.Error("canary degraded, rolled back")
+	}
+}
+
+// Rollback sends every player to stable while on, e.g. after a degraded
+// verdict until the canary is fixed.
+func (c *Canary) Rollback(on bool) {
+	c.mu.Lock()
+	c.rolledBack = on
+	c.mu.Unlock()
+}
+
+// ReportHandler answers with the current CanaryReport, mount it on an
+// admin route class.
+func (c *Canary) ReportHandler() HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		return c.Report(false), nil
+	}
+}
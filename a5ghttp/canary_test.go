@@ -0,0 +1,111 @@
+package a5ghttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/sirupsen/logrus"
+)
+
+func TestCanaryRouting(t *testing.T) {
+	canary := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Instance", "canary:"+r.Header.Get(CanaryHeader))
+		}))
+	defer canary.Close()
+	c, err := NewCanary(canary.URL, 10, a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Accounts = map[uint64]bool{42: true}
+	c.Account = func(r *http.Request) (uint64, bool) {
+		id, err := strconv.ParseUint(r.Header.Get("X-Account"), 10, 64)
+		return id, err == nil
+	}
+	h := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Instance", "stable:"+r.Header.Get(CanaryHeader))
+	}))
+	serve := func(account string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/profile", nil)
+		if account != "" {
+			r.Header.Set("X-Account", account)
+		}
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve("42", nil)
+	if got := w.Header().Get("X-Instance"); got != "canary:canary" {
+		t.Errorf("tester routed to %q", got)
+	}
+	cookie := w.Result().Cookies()[0]
+	if got := serve("", cookie).Header().Get("X-Instance"); got != "canary:canary" {
+		t.Errorf("cookie of a tester routed to %q", got)
+	}
+	if got := serve("", nil).Header().Get("X-Instance"); got != "stable:stable" {
+		t.Errorf("anonymous request routed to %q", got)
+	}
+
+	canaries := 0
+	for i := 1; i <= 1000; i++ {
+		if c.Cohort(httptest.NewRequest(http.MethodGet, "/", nil)) == CohortCanary {
+			t.Fatal("request without account or cookie is canary")
+		}
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-Account", strconv.Itoa(i))
+		if c.Cohort(r) == CohortCanary {
+			canaries++
+		}
+	}
+	if canaries < 70 || canaries > 130 {
+		t.Errorf("%d of 1000 accounts canary want about 100", canaries)
+	}
+
+	c.Rollback(true)
+	if got := serve("42", cookie).Header().Get("X-Instance"); got != "stable:stable" {
+		t.Errorf("tester routed to %q after rollback", got)
+	}
+}
+
+func TestCanaryVerdict(t *testing.T) {
+	c, err := NewCanary("", 10, a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.MinRequests = 100
+	observe := func(cohort string, n, failed int, d time.Duration) {
+		for i := 0; i < n; i++ {
+			c.Observe(cohort, d, i < failed)
+		}
+	}
+	observe(CohortStable, 1000, 5, 20*time.Millisecond)
+	observe(CohortCanary, 50, 0, 20*time.Millisecond)
+	if r := c.Report(false); r.Verdict != VerdictInsufficient {
+		t.Errorf("verdict %q want %q", r.Verdict, VerdictInsufficient)
+	}
+	observe(CohortCanary, 50, 1, 25*time.Millisecond)
+	r := c.Report(true)
+	if r.Verdict != VerdictHealthy || r.Cohorts[CohortCanary].ErrorRate != 0.01 ||
+		r.Cohorts[CohortStable].P95Ms != 20 {
+		t.Errorf("unexpected report %+v %+v", r, r.Cohorts[CohortCanary])
+	}
+
+	observe(CohortStable, 1000, 5, 20*time.Millisecond)
+	observe(CohortCanary, 100, 0, 40*time.Millisecond)
+	if r = c.Report(true); r.Verdict != VerdictDegraded {
+		t.Errorf("verdict %q want %q on latency", r.Verdict, VerdictDegraded)
+	}
+	observe(CohortStable, 1000, 5, 20*time.Millisecond)
+	observe(CohortCanary, 100, 3, 20*time.Millisecond)
+	if r = c.Report(true); r.Verdict != VerdictDegraded {
+		t.Errorf("verdict %q want %q on errors", r.Verdict, VerdictDegraded)
+	}
+}
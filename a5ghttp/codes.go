@@ -0,0 +1,34 @@
+package a5ghttp
+
+import "github.com/armor5games/a5g/a5gapi"
+
+var (
+	ErrCodeRequestMalformed = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4000,
+		Name:     "request_malformed",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "malformed request"})
+
+	ErrCodeRouteClassForbidden = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4030,
+		Name:     "route_class_forbidden",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "forbidden"})
+
+	ErrCodeAPIVersionUnsupported = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4260,
+		Name:     "api_version_unsupported",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "api version is not supported, update the client"})
+
+	// ErrCodeModuleUnavailable has no message of its own, KillSwitches
+	// provide one per module.
+	ErrCodeModuleUnavailable = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     5030,
+		Name:     "module_unavailable",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true})
+)
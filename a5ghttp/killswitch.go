@@ -0,0 +1,143 @@
+package a5ghttp
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+// KillSwitches disable modules (e.g. "chat", "shop") at runtime: their
+// routes answer with ErrCodeModuleUnavailable until enabled again, so a
+// misbehaving subsystem is isolated without a deploy. Switches come from
+// config reloads through Replace or from a command line flag:
+//
+//	flag.Var(switches, "disable", "comma separated modules to disable")
+//	r.With(switches.Middleware("chat")).Post("/chat/send", ...)
+type KillSwitches struct {
+	Logger a5glogs.Logger
+
+	mu       sync.RWMutex
+	disabled map[string]string
+}
+
+func NewKillSwitches(l a5glogs.Logger) (*KillSwitches, error) {
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &KillSwitches{Logger: l, disabled: make(map[string]string)}, nil
+}
+
+// Disable turns module off, message is shown to players instead of the
+// default "<module> temporarily unavailable".
+func (k *KillSwitches) Disable(module, message string) {
+	k.mu.Lock()
+	k.disabled[module] = message
+	k.mu.Unlock()
+	k.Logger.With(a5gfields.String("module", module)).Warn("module disabled")
+}
+
+func (k *KillSwitches) Enable(module string) {
+	k.mu.Lock()
+	_, ok := k.disabled[module]
+	delete(k.disabled, module)
+	k.mu.Unlock()
+	if ok {
+		k.Logger.With(a5gfields.String("module", module)).Warn("module enabled")
+	}
+}
+
+// Replace disables exactly the modules of disabled, mapped to their
+// messages, e.g. on a config reload.
+func (k *KillSwitches) Replace(disabled map[string]string) {
+	x := make(map[string]string, len(disabled))
+	for m, s := range disabled {
+		x[m] = s
+	}
+	k.mu.Lock()
+	old := k.disabled
+	k.disabled = x
+	k.mu.Unlock()
+	for m := range x {
+		if _, ok := old[m]; !ok {
+			k.Logger.With(a5gfields.String("module", m)).Warn("module disabled")
+		}
+	}
+	for m := range old {
+		if _, ok := x[m]; !ok {
+			k.Logger.With(a5gfields.String("module", m)).Warn("module enabled")
+		}
+	}
+}
+
+// Disabled reports whether module is off and the message to show.
+func (k *KillSwitches) Disabled(module string) (string, bool) {
+	k.mu.RLock()
+	s, ok := k.disabled[module]
+	k.mu.RUnlock()
+	if ok && s == "" {
+		s = module + " temporarily unavailable"
+	}
+	return s, ok
+}
+
+// String lists disabled modules, it implements flag.Value.
+func (k *KillSwitches) String() string {
+	if k == nil {
+		return ""
+	}
+	k.mu.RLock()
+	a := make([]string, 0, len(k.disabled))
+	for m := range k.disabled {
+		a = append(a, m)
+	}
+	k.mu.RUnlock()
+	sort.Strings(a)
+	return strings.Join(a, ",")
+}
+
+// Set disables comma separated modules, it implements flag.Value.
+func (k *KillSwitches) Set(s string) error {
+	for _, m := range strings.Split(s, ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			k.Disable(m, "")
+		}
+	}
+	return nil
+}
+
+// Wrap answers with ErrCodeModuleUnavailable instead of running fn while
+// module is disabled, e.g. for a5gws methods.
+func (k *KillSwitches) Wrap(module string, fn HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		if s, ok := k.Disabled(module); ok {
+			return nil, []*a5gapi.APIErr{
+				a5gapi.NewErr(ErrCodeModuleUnavailable, "%s", s)}
+		}
+		return fn(ctx, req)
+	}
+}
+
+func (k *KillSwitches) Middleware(module string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s, ok := k.Disabled(module)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			err := WriteErrResponse(w, r, a5gapi.KV{"module": module},
+				a5gapi.NewErr(ErrCodeModuleUnavailable, "%s", s))
+			if err != nil {
+				k.Logger.Error(err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package a5ghttp
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/sirupsen/logrus"
+)
+
+func TestKillSwitches(t *testing.T) {
+	k, err := NewKillSwitches(a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(k, "disable", "")
+	if err = fs.Parse([]string{"-disable", "chat, shop"}); err != nil {
+		t.Fatal(err)
+	}
+	if s := k.String(); s != "chat,shop" {
+		t.Errorf("unexpected disabled modules %q", s)
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		name     string
+		disabled map[string]string
+		module   string
+		status   int
+		message  string
+	}{
+		{"flag", nil, "chat", http.StatusServiceUnavailable,
+			"chat temporarily unavailable"},
+		{"enabled", map[string]string{"shop": ""}, "chat", http.StatusOK, ""},
+		{"message", map[string]string{"chat": "chat is under maintenance"},
+			"chat", http.StatusServiceUnavailable, "chat is under maintenance"},
+	}
+	for _, test := range tests {
+		if test.disabled != nil {
+			k.Replace(test.disabled)
+		}
+		w := httptest.NewRecorder()
+		k.Middleware(test.module)(ok).ServeHTTP(
+			w, httptest.NewRequest("POST", "/chat/send", nil))
+		if w.Code != test.status {
+			t.Errorf("%s: expected status %d, got %d",
+				test.name, test.status, w.Code)
+		}
+		_, errs := k.Wrap(test.module, func(context.Context,
+			*a5gapi.APIMsgRequest) (interface{}, []*a5gapi.APIErr) {
+			return nil, nil
+		})(context.Background(), new(a5gapi.APIMsgRequest))
+		var message string
+		if len(errs) > 0 {
+			message = errs[0].Err.Error()
+		}
+		if message != test.message {
+			t.Errorf("%s: expected message %q, got %q",
+				test.name, test.message, message)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package a5ghttp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/go-chi/chi/middleware"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+var requestIDRegexp = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID propagates X-Request-ID (or generates one) into the context
+// for a5gapi.Responder and chi's request logger, and echoes it in the
+// response header.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := r.Header.Get(RequestIDHeader)
+		if !requestIDRegexp.MatchString(s) {
+			s = NewRequestID()
+		}
+		w.Header().Set(RequestIDHeader, s)
+		next.ServeHTTP(w, r.WithContext(contextWithRequestID(r.Context(), s)))
+	})
+}
+
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand never fails on supported platforms.
+		panic(err.Error())
+	}
+	return hex.EncodeToString(b)
+}
+
+func contextWithRequestID(ctx context.Context, s string) context.Context {
+	ctx = context.WithValue(ctx, middleware.RequestIDKey, s)
+	return a5gapi.ContextWithRequestID(ctx, s)
+}
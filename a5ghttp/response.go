@@ -0,0 +1,57 @@
+package a5ghttp
+
+import (
+	"net/http"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5gcodec"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+// writeErr answers with an unsuccessful a5gapi envelope for requests
+// rejected before they reach a handler.
+func writeErr(
+	w http.ResponseWriter, r *http.Request, l a5glogs.Logger, httpStatus int,
+	errs ...*a5gapi.APIErr) {
+	res, err := a5gapi.NewMsgResponse(0, false, nil, nil, errs...)
+	if err != nil {
+		l.Error(err.Error())
+		http.Error(w, http.StatusText(httpStatus), httpStatus)
+		return
+	}
+	writeMsg(w, r, l, httpStatus, res)
+}
+
+// writeMsg encodes res with the codec the request negotiated.
+func writeMsg(
+	w http.ResponseWriter, r *http.Request, l a5glogs.Logger, httpStatus int,
+	res *a5gapi.APIMsgResponse) {
+	c := responseCodec(r)
+	b, err := c.Marshal(res)
+	if err != nil {
+		l.Error(err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", c.ContentType())
+	w.WriteHeader(httpStatus)
+	if _, err = w.Write(b); err != nil {
+		l.Error(errors.WithStack(err).Error())
+	}
+}
+
+// responseCodec picks the codec of the Accept header or, without one, of
+// the request body, so a client posting msgpack or protobuf is answered
+// in kind.
+func responseCodec(r *http.Request) a5gcodec.Codec {
+	if s := r.Header.Get("Accept"); s != "" {
+		return a5gcodec.Negotiate(s)
+	}
+	c, err := a5gcodec.ByContentType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return a5gcodec.JSON
+	}
+	return c
+}
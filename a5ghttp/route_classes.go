@@ -0,0 +1,128 @@
+package a5ghttp
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+type RouteClass string
+
+const (
+	RouteClassPublic   RouteClass = "public"
+	RouteClassInternal RouteClass = "internal"
+	RouteClassAdmin    RouteClass = "admin"
+)
+
+func (c RouteClass) String() string { return string(c) }
+
+// RouteClassPolicy restricts a class by client network and/or verified TLS
+// client certificate. An empty policy allows everyone to public routes and
+// no one to the other classes.
+type RouteClassPolicy struct {
+	AllowedNets       []*net.IPNet
+	RequireClientCert bool
+}
+
+// RouteClasses holds the central access policy per route class. Mount
+// chi's middleware.RealIP before it when running behind a trusted proxy,
+// the allowlist is checked against r.RemoteAddr.
+type RouteClasses struct {
+	Logger a5glogs.Logger
+
+	mu       sync.RWMutex
+	policies map[RouteClass]*RouteClassPolicy
+}
+
+func NewRouteClasses(l a5glogs.Logger) (*RouteClasses, error) {
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &RouteClasses{
+		Logger:   l,
+		policies: make(map[RouteClass]*RouteClassPolicy)}, nil
+}
+
+// Set replaces class policy; cidrs accept both "10.0.0.0/8" and plain
+// addresses. Classes other than public need cidrs or client certificates.
+func (c *RouteClasses) Set(
+	class RouteClass, cidrs []string, requireClientCert bool) error {
+	if class != RouteClassPublic && len(cidrs) == 0 && !requireClientCert {
+		return errors.Errorf("route class %q policy allows everyone", class)
+	}
+	p := &RouteClassPolicy{RequireClientCert: requireClientCert}
+	for _, s := range cidrs {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			if strings.Contains(s, ":") {
+				s += "/128"
+			} else {
+				s += "/32"
+			}
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		p.AllowedNets = append(p.AllowedNets, n)
+	}
+	c.mu.Lock()
+	c.policies[class] = p
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *RouteClasses) Allowed(class RouteClass, r *http.Request) bool {
+	c.mu.RLock()
+	p, ok := c.policies[class]
+	c.mu.RUnlock()
+	if !ok {
+		// Unconfigured internal and admin classes are closed by default.
+		return class == RouteClassPublic
+	}
+	if p.RequireClientCert &&
+		(r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+		return false
+	}
+	if len(p.AllowedNets) == 0 {
+		return class == RouteClassPublic || p.RequireClientCert
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range p.AllowedNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *RouteClasses) Middleware(class RouteClass) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if c.Allowed(class, r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			c.Logger.With(
+				a5gfields.String("routeClass", class.String()),
+				a5gfields.String("remoteAddr", r.RemoteAddr),
+				a5gfields.String("uri", r.RequestURI)).
+				Warn("route class forbidden")
+			writeErr(w, r, c.Logger, http.StatusForbidden,
+				a5gapi.NewErr(ErrCodeRouteClassForbidden, ""))
+		})
+	}
+}
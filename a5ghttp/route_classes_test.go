@@ -0,0 +1,61 @@
+package a5ghttp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/sirupsen/logrus"
+)
+
+func TestRouteClassesAllowed(t *testing.T) {
+	c, err := NewRouteClasses(a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Set(RouteClassAdmin, nil, false); err == nil {
+		t.Error("expected an open admin policy error")
+	}
+	if err = c.Set(RouteClassInternal, []string{"10.0.0.0/8"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Set(RouteClassPublic, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	type request struct {
+		class      RouteClass
+		remoteAddr string
+		cert       bool
+		allowed    bool
+	}
+	check := func(tests []request) {
+		for _, test := range tests {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = test.remoteAddr
+			if test.cert {
+				r.TLS = &tls.ConnectionState{
+					VerifiedChains: [][]*x509.Certificate{{{}}}}
+			}
+			if c.Allowed(test.class, r) != test.allowed {
+				t.Errorf("%s from %s: expected allowed %v",
+					test.class, test.remoteAddr, test.allowed)
+			}
+		}
+	}
+	check([]request{
+		{RouteClassPublic, "203.0.113.1:1000", false, true},
+		{RouteClassInternal, "10.1.2.3:1000", false, true},
+		{RouteClassInternal, "203.0.113.1:1000", false, false},
+		{RouteClassAdmin, "10.1.2.3:1000", false, false},
+	})
+	if err = c.Set(RouteClassAdmin, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	check([]request{
+		{RouteClassAdmin, "203.0.113.1:1000", true, true},
+		{RouteClassAdmin, "10.1.2.3:1000", false, false},
+	})
+}
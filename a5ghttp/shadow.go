@@ -0,0 +1,211 @@
+package a5ghttp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+// ShadowHeader marks mirrored requests so the staging deployment can tell
+// them apart (and must not mirror them again).
+const ShadowHeader = "X-Shadow-Request"
+
+// Shadow mirrors a sampled percentage of read (GET and HEAD) requests to
+// a staging deployment. Mirroring is asynchronous and best effort: staging
+// responses are discarded, requests are dropped while the in-flight limit
+// (see SetMaxInFlight) is reached.
+type Shadow struct {
+	Target *url.URL
+	// Percent of read requests to mirror, 0..100.
+	Percent float64
+	Client  *http.Client
+	Logger  a5glogs.Logger
+	// LogDiffs compares staging responses with production ones (status
+	// and up to MaxBodyBytes of body) and logs mismatches.
+	LogDiffs     bool
+	MaxBodyBytes int64
+	Timeout      time.Duration
+	// Headers copied to staging. Credentials (Authorization, Cookie,
+	// session tokens) stay in production unless listed here.
+	Headers []string
+
+	inFlight chan struct{}
+}
+
+// DefaultShadowHeaders carry no credentials.
+var DefaultShadowHeaders = []string{
+	"Accept", "Accept-Encoding", "Accept-Language", "Content-Type",
+	"User-Agent", APIVersionHeader}
+
+func NewShadow(target string, percent float64, l a5glogs.Logger) (*Shadow, error) {
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	if percent < 0 || percent > 100 {
+		return nil, errors.Errorf("shadow percent %v out of range", percent)
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, errors.Errorf("shadow target %q is not absolute", target)
+	}
+	return &Shadow{
+		Target:       u,
+		Percent:      percent,
+		Client:       &http.Client{},
+		Logger:       l,
+		MaxBodyBytes: 64 << 10,
+		Timeout:      5 * time.Second,
+		Headers:      DefaultShadowHeaders,
+		inFlight:     make(chan struct{}, 64)}, nil
+}
+
+// SetMaxInFlight limits concurrently running shadow requests; call it
+// before serving.
+func (s *Shadow) SetMaxInFlight(n int) {
+	if n < 1 {
+		n = 1
+	}
+	s.inFlight = make(chan struct{}, n)
+}
+
+func (s *Shadow) sampled(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if r.Header.Get(ShadowHeader) != "" {
+		return false
+	}
+	return s.Percent > 0 && rand.Float64()*100 < s.Percent
+}
+
+func (s *Shadow) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.sampled(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		req, err := s.newRequest(r)
+		if err != nil {
+			s.Logger.Warn(err.Error())
+			next.ServeHTTP(w, r)
+			return
+		}
+		var rec *shadowRecorder
+		if s.LogDiffs {
+			rec = &shadowRecorder{ResponseWriter: w, limit: s.MaxBodyBytes}
+			w = rec
+		}
+		next.ServeHTTP(w, r)
+		select {
+		case s.inFlight <- struct{}{}:
+		default:
+			s.Logger.Debug("shadow request dropped")
+			return
+		}
+		go func() {
+			defer func() { <-s.inFlight }()
+			s.do(req, rec)
+		}()
+	})
+}
+
+func (s *Shadow) newRequest(r *http.Request) (*http.Request, error) {
+	u := *s.Target
+	u.Path = strings.TrimSuffix(u.Path, "/") + r.URL.Path
+	u.RawPath = ""
+	u.RawQuery = r.URL.RawQuery
+	req, err := http.NewRequest(r.Method, u.String(), nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for _, k := range s.Headers {
+		k = http.CanonicalHeaderKey(k)
+		if v, ok := r.Header[k]; ok {
+			req.Header[k] = append([]string(nil), v...)
+		}
+	}
+	if id := a5gapi.RequestIDFromContext(r.Context()); id != "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
+	req.Header.Set(ShadowHeader, "1")
+	return req, nil
+}
+
+func (s *Shadow) do(req *http.Request, rec *shadowRecorder) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+	res, err := s.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		s.Logger.Debug(errors.Wrap(err, "shadow request failed").Error())
+		return
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			s.Logger.Debug(err.Error())
+		}
+	}()
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, s.MaxBodyBytes))
+	if err != nil {
+		s.Logger.Debug(errors.Wrap(err, "shadow response read failed").Error())
+		return
+	}
+	if rec == nil {
+		return
+	}
+	status := rec.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if status == res.StatusCode && bytes.Equal(rec.body.Bytes(), body) {
+		return
+	}
+	s.Logger.With(
+		a5gfields.String("method", req.Method),
+		a5gfields.String("uri", req.URL.RequestURI()),
+		a5gfields.String("requestId", req.Header.Get(RequestIDHeader)),
+		a5gfields.Int("status", status),
+		a5gfields.Int("shadowStatus", res.StatusCode),
+		a5gfields.Int("bodyBytes", rec.body.Len()),
+		a5gfields.Int("shadowBodyBytes", len(body))).
+		Warn("shadow response differs")
+}
+
+// shadowRecorder keeps a copy of the production response for diffing.
+type shadowRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+	limit  int64
+}
+
+func (w *shadowRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *shadowRecorder) Write(b []byte) (int, error) {
+	if n := w.limit - int64(w.body.Len()); n > 0 {
+		if int64(len(b)) < n {
+			n = int64(len(b))
+		}
+		// bytes.Buffer writes never fail.
+		_, _ = w.body.Write(b[:n])
+	}
+	return w.ResponseWriter.Write(b)
+}
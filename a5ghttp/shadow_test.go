@@ -0,0 +1,45 @@
+package a5ghttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/sirupsen/logrus"
+)
+
+func TestShadowHeaders(t *testing.T) {
+	got := make(chan http.Header, 1)
+	staging := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) { got <- r.Header }))
+	defer staging.Close()
+	s, err := NewShadow(staging.URL, 100, a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := s.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	r := httptest.NewRequest(http.MethodGet, "/profile?id=1", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	r.Header.Set("Cookie", "session=secret")
+	r.Header.Set("X-Session-Token", "secret")
+	r.Header.Set("Accept-Language", "de")
+	r.Header.Set(APIVersionHeader, "3")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	header := <-got
+	tests := []struct {
+		key, value string
+	}{
+		{"Authorization", ""},
+		{"Cookie", ""},
+		{"X-Session-Token", ""},
+		{"Accept-Language", "de"},
+		{APIVersionHeader, "3"},
+		{ShadowHeader, "1"},
+	}
+	for _, test := range tests {
+		if v := header.Get(test.key); v != test.value {
+			t.Errorf("%s: expected %q, got %q", test.key, test.value, v)
+		}
+	}
+}
@@ -0,0 +1,393 @@
+package a5ghttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/pkg/errors"
+)
+
+// Rename is a payload field renamed (or moved) from From to To. Paths are
+// dotted json names, "[]" steps into every element of an array, e.g.
+// "items[].count" or "[].nick" for array payloads; array steps of both
+// paths must be the same.
+type Rename struct {
+	From string
+	To   string
+}
+
+// Shim keeps clients older than Before working after a schema change:
+// their request payloads get fields renamed and Defaults filled in, and
+// response payloads get fields renamed back.
+type Shim struct {
+	Before   uint64
+	Renames  []Rename
+	Defaults map[string]interface{}
+
+	renames  []*shimRename
+	defaults []*shimDefault
+}
+
+type shimRename struct {
+	from, to []pathStep
+	split    int
+}
+
+type shimDefault struct {
+	path  []pathStep
+	split int
+	value json.RawMessage
+}
+
+type pathStep struct {
+	key  string
+	each bool
+}
+
+// Shims applies every shim newer than the client version in order, so a
+// schema may change in several versions:
+//
+//	shims, err := a5ghttp.NewShims(
+//		a5ghttp.Shim{Before: 2, Renames: []a5ghttp.Rename{{"nick", "name"}}},
+//		a5ghttp.Shim{Before: 3, Defaults: map[string]interface{}{"region": "eu"}})
+//	r.Post("/profile", adapter.Handler(shims.Wrap(updateProfile)).ServeHTTP)
+type Shims struct {
+	shims []*Shim
+}
+
+func NewShims(shims ...Shim) (*Shims, error) {
+	s := new(Shims)
+	for i := range shims {
+		x := shims[i]
+		if x.Before < 2 {
+			return nil, errors.Errorf(
+				"shim version %d has no older clients", x.Before)
+		}
+		for _, r := range x.Renames {
+			y, err := newShimRename(r)
+			if err != nil {
+				return nil, errors.Wrapf(err, "shim %d", x.Before)
+			}
+			x.renames = append(x.renames, y)
+		}
+		keys := make([]string, 0, len(x.Defaults))
+		for k := range x.Defaults {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			y, err := newShimDefault(k, x.Defaults[k])
+			if err != nil {
+				return nil, errors.Wrapf(err, "shim %d", x.Before)
+			}
+			x.defaults = append(x.defaults, y)
+		}
+		s.shims = append(s.shims, &x)
+	}
+	sort.Slice(s.shims, func(i, j int) bool {
+		return s.shims[i].Before < s.shims[j].Before
+	})
+	for i := 1; i < len(s.shims); i++ {
+		if s.shims[i].Before == s.shims[i-1].Before {
+			return nil, errors.Errorf(
+				"duplicate shim version %d", s.shims[i].Before)
+		}
+	}
+	return s, nil
+}
+
+// Wrap runs fn with the request payload upgraded to the current schema and
+// downgrades its response payload (and error fields) for the client.
+func (s *Shims) Wrap(fn HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		v := requestVersion(ctx, req)
+		if !s.applies(v) {
+			return fn(ctx, req)
+		}
+		x := *req
+		if raw, ok := req.Payload.(*json.RawMessage); ok {
+			b, err := s.UpgradeRequest(v, *raw)
+			if err != nil {
+				return nil, []*a5gapi.APIErr{
+					a5gapi.NewErr(ErrCodeRequestMalformed, "%s", err.Error())}
+			}
+			r := json.RawMessage(b)
+			x.Payload = &r
+		}
+		payload, errs := fn(ctx, &x)
+		for _, e := range errs {
+			e.Field = s.downgradeField(v, e.Field)
+		}
+		items, page := a5gapi.UnwrapPaged(payload)
+		items, err := s.DowngradeResponse(v, items)
+		if err != nil {
+			return nil, append(errs, a5gapi.NewJSONMsgDefautlErrors(err)...)
+		}
+		if page != nil {
+			return &a5gapi.Paged{Items: items, Page: page}, errs
+		}
+		return items, errs
+	}
+}
+
+func (s *Shims) applies(v uint64) bool {
+	return len(s.shims) > 0 && v < s.shims[len(s.shims)-1].Before
+}
+
+// UpgradeRequest converts a JSON request payload of a client at version v
+// to the current schema.
+func (s *Shims) UpgradeRequest(v uint64, payload []byte) ([]byte, error) {
+	if !s.applies(v) {
+		return payload, nil
+	}
+	var x interface{} = map[string]interface{}{}
+	if len(payload) > 0 {
+		if err := decodeJSON(payload, &x); err != nil {
+			return nil, err
+		}
+	}
+	for _, shim := range s.shims {
+		if v >= shim.Before {
+			continue
+		}
+		for _, r := range shim.renames {
+			r.apply(x, r.from, r.to)
+		}
+		for _, d := range shim.defaults {
+			if err := d.apply(x); err != nil {
+				return nil, err
+			}
+		}
+	}
+	b, err := json.Marshal(x)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return b, nil
+}
+
+// DowngradeResponse converts a response payload to the schema of a client
+// at version v, payloads of current clients are returned as is.
+func (s *Shims) DowngradeResponse(
+	v uint64, payload interface{}) (interface{}, error) {
+	if payload == nil || !s.applies(v) {
+		return payload, nil
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var x interface{}
+	if err = decodeJSON(b, &x); err != nil {
+		return nil, err
+	}
+	for i := len(s.shims) - 1; i >= 0; i-- {
+		if v >= s.shims[i].Before {
+			break
+		}
+		for _, r := range s.shims[i].renames {
+			r.apply(x, r.to, r.from)
+		}
+	}
+	return x, nil
+}
+
+// downgradeField renames validation error paths outside of arrays.
+func (s *Shims) downgradeField(v uint64, field string) string {
+	for i := len(s.shims) - 1; field != "" && i >= 0; i-- {
+		if v >= s.shims[i].Before {
+			break
+		}
+		for _, r := range s.shims[i].Renames {
+			if strings.Contains(r.To, "[]") {
+				continue
+			}
+			if field == r.To || strings.HasPrefix(field, r.To+".") ||
+				strings.HasPrefix(field, r.To+"[") {
+				field = r.From + field[len(r.To):]
+			}
+		}
+	}
+	return field
+}
+
+// requestVersion is the negotiated version of the request, the envelope
+// one without Versions; zero is the first version.
+func requestVersion(ctx context.Context, req *a5gapi.APIMsgRequest) uint64 {
+	v := a5gapi.APIVersionFromContext(ctx)
+	if v == 0 {
+		v = req.APIVersion
+	}
+	if v == 0 {
+		v = 1
+	}
+	return v
+}
+
+func newShimRename(r Rename) (*shimRename, error) {
+	from, err := parsePath(r.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := parsePath(r.To)
+	if err != nil {
+		return nil, err
+	}
+	k := lastEach(from)
+	ok := k == lastEach(to)
+	for i := 0; ok && i < k; i++ {
+		ok = from[i] == to[i]
+	}
+	if !ok {
+		return nil, errors.Errorf("rename %q to %q changes arrays", r.From, r.To)
+	}
+	return &shimRename{from: from, to: to, split: k}, nil
+}
+
+func (r *shimRename) apply(v interface{}, from, to []pathStep) {
+	eachObject(v, from[:r.split], func(m map[string]interface{}) {
+		if x, ok := takePath(m, from[r.split:]); ok {
+			putPath(m, to[r.split:], x)
+		}
+	})
+}
+
+func newShimDefault(path string, value interface{}) (*shimDefault, error) {
+	p, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &shimDefault{path: p, split: lastEach(p), value: b}, nil
+}
+
+func (d *shimDefault) apply(v interface{}) error {
+	var err error
+	eachObject(v, d.path[:d.split], func(m map[string]interface{}) {
+		if _, ok := getPath(m, d.path[d.split:]); ok || err != nil {
+			return
+		}
+		// Every object gets its own copy of the value.
+		var x interface{}
+		if err = decodeJSON(d.value, &x); err == nil {
+			putPath(m, d.path[d.split:], x)
+		}
+	})
+	return err
+}
+
+// decodeJSON keeps numbers as json.Number, so 64-bit ids survive the
+// round trip through interface{}.
+func decodeJSON(b []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	return errors.WithStack(d.Decode(v))
+}
+
+func parsePath(s string) ([]pathStep, error) {
+	var a []pathStep
+	for i, x := range strings.Split(s, ".") {
+		p := pathStep{key: x}
+		if strings.HasSuffix(x, "[]") {
+			p.key, p.each = x[:len(x)-2], true
+		}
+		if p.key == "" && (!p.each || i > 0) {
+			return nil, errors.Errorf("empty step in path %q", s)
+		}
+		a = append(a, p)
+	}
+	if a[len(a)-1].each {
+		return nil, errors.Errorf("path %q ends with an array step", s)
+	}
+	return a, nil
+}
+
+// lastEach is the number of steps up to and including the last array one.
+func lastEach(p []pathStep) int {
+	for i := len(p) - 1; i >= 0; i-- {
+		if p[i].each {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// eachObject calls fn with every object p leads to from v.
+func eachObject(v interface{}, p []pathStep, fn func(map[string]interface{})) {
+	if len(p) == 0 {
+		if m, ok := v.(map[string]interface{}); ok {
+			fn(m)
+		}
+		return
+	}
+	if p[0].key != "" {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return
+		}
+		v = m[p[0].key]
+	}
+	if !p[0].each {
+		eachObject(v, p[1:], fn)
+		return
+	}
+	a, _ := v.([]interface{})
+	for _, x := range a {
+		eachObject(x, p[1:], fn)
+	}
+}
+
+func getPath(m map[string]interface{}, p []pathStep) (interface{}, bool) {
+	for _, s := range p[:len(p)-1] {
+		x, ok := m[s.key].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		m = x
+	}
+	v, ok := m[p[len(p)-1].key]
+	return v, ok
+}
+
+// takePath removes the value and the objects it leaves empty, undoing
+// putPath.
+func takePath(m map[string]interface{}, p []pathStep) (interface{}, bool) {
+	if len(p) == 1 {
+		v, ok := m[p[0].key]
+		delete(m, p[0].key)
+		return v, ok
+	}
+	x, ok := m[p[0].key].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	v, ok := takePath(x, p[1:])
+	if ok && len(x) == 0 {
+		delete(m, p[0].key)
+	}
+	return v, ok
+}
+
+// putPath sets the value creating missing objects on the way, it leaves
+// paths through non-objects alone.
+func putPath(m map[string]interface{}, p []pathStep, v interface{}) {
+	for _, s := range p[:len(p)-1] {
+		x, ok := m[s.key]
+		if !ok {
+			x = map[string]interface{}{}
+			m[s.key] = x
+		}
+		if m, ok = x.(map[string]interface{}); !ok {
+			return
+		}
+	}
+	m[p[len(p)-1].key] = v
+}
@@ -0,0 +1,109 @@
+package a5ghttp
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/armor5games/a5g/a5gapi"
+)
+
+func TestShims(t *testing.T) {
+	shims, err := NewShims(
+		Shim{Before: 3, Renames: []Rename{{"items[].qty", "items[].count"}},
+			Defaults: map[string]interface{}{"region": "eu"}},
+		Shim{Before: 2, Renames: []Rename{{"nick", "profile.name"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	fn := func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		got = nil
+		if err := DecodePayload(req, &got); err != nil {
+			t.Fatal(err)
+		}
+		e := a5gapi.NewErr(ErrCodeRequestMalformed, "")
+		e.Field = "profile.name"
+		return got, []*a5gapi.APIErr{e}
+	}
+	tests := []struct {
+		version  uint64
+		payload  string
+		upgraded string
+		field    string
+	}{
+		{1, `{"nick":"x","items":[{"qty":1},{"qty":2}]}`,
+			`{"profile":{"name":"x"},"items":[{"count":1},{"count":2}],"region":"eu"}`,
+			"nick"},
+		{2, `{"profile":{"name":"x"},"items":[{"qty":1}],"region":"us"}`,
+			`{"profile":{"name":"x"},"items":[{"count":1}],"region":"us"}`,
+			"profile.name"},
+		{3, `{"profile":{"name":"x"},"items":[{"count":1}]}`,
+			`{"profile":{"name":"x"},"items":[{"count":1}]}`,
+			"profile.name"},
+	}
+	for _, x := range tests {
+		raw := json.RawMessage(x.payload)
+		ctx := a5gapi.ContextWithAPIVersion(context.Background(), x.version)
+		res, errs := shims.Wrap(fn)(ctx, &a5gapi.APIMsgRequest{Payload: &raw})
+		var upgraded, original, returned interface{}
+		if err = json.Unmarshal([]byte(x.upgraded), &upgraded); err != nil {
+			t.Fatal(err)
+		}
+		if err = json.Unmarshal([]byte(x.payload), &original); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(map[string]interface{}(got), upgraded) {
+			t.Errorf("v%d: expected request %s, got %v", x.version, x.upgraded, got)
+		}
+		b, _ := json.Marshal(res)
+		if err = json.Unmarshal(b, &returned); err != nil {
+			t.Fatal(err)
+		}
+		// Defaults stay in responses, renames are undone.
+		if m, ok := original.(map[string]interface{}); ok && x.version < 3 {
+			if _, ok = m["region"]; !ok {
+				m["region"] = "eu"
+			}
+		}
+		if !reflect.DeepEqual(returned, original) {
+			t.Errorf("v%d: expected response %s, got %s", x.version, x.payload, b)
+		}
+		if len(errs) != 1 || errs[0].Field != x.field {
+			t.Errorf("v%d: expected error field %q, got %v", x.version, x.field, errs)
+		}
+	}
+	if _, err = NewShims(Shim{Before: 2, Renames: []Rename{
+		{"items[].qty", "count"}}}); err == nil {
+		t.Error("expected array change error")
+	}
+}
+
+func TestShimsLargeIDs(t *testing.T) {
+	shims, err := NewShims(Shim{Before: 2, Renames: []Rename{{"nick", "name"}},
+		Defaults: map[string]interface{}{"ownerId": uint64(1<<63 + 1)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const id = "18446744073709551615"
+	b, err := shims.UpgradeRequest(1, []byte(`{"nick":"x","accountId":`+id+`}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"accountId":` + id + `,"name":"x","ownerId":9223372036854775809}`
+	if string(b) != expected {
+		t.Errorf("expected request %s, got %s", expected, b)
+	}
+	res, err := shims.DowngradeResponse(1, &struct {
+		Name      string `json:"name"`
+		AccountID uint64 `json:"accountId"`
+	}{"x", 1<<64 - 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ = json.Marshal(res); string(b) != `{"accountId":`+id+`,"nick":"x"}` {
+		t.Errorf("unexpected response %s", b)
+	}
+}
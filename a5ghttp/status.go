@@ -0,0 +1,120 @@
+package a5ghttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/pkg/errors"
+)
+
+// StatusMapper picks HTTP status of a response from its errors: the error
+// with the highest severity decides, its code mapping (if any) wins over
+// the severity mapping.
+type StatusMapper struct {
+	mu         sync.RWMutex
+	severities map[a5gapi.ErrSeverity]int
+	codes      map[a5gapi.APIErrCode]int
+}
+
+// DefaultStatusMapper is used by WriteMsgResponse and new Adapters.
+var DefaultStatusMapper = NewStatusMapper()
+
+func init() {
+	DefaultStatusMapper.SetCode(ErrCodeRequestMalformed, http.StatusBadRequest)
+	DefaultStatusMapper.SetCode(ErrCodeRouteClassForbidden, http.StatusForbidden)
+	DefaultStatusMapper.SetCode(
+		ErrCodeAPIVersionUnsupported, http.StatusUpgradeRequired)
+	DefaultStatusMapper.SetCode(
+		a5gapi.ErrCodePreconditionFailed, http.StatusPreconditionFailed)
+	DefaultStatusMapper.SetCode(
+		ErrCodeModuleUnavailable, http.StatusServiceUnavailable)
+}
+
+// NewStatusMapper maps warnings and below to 200 and errors and above to
+// 500.
+func NewStatusMapper() *StatusMapper {
+	return &StatusMapper{
+		severities: map[a5gapi.ErrSeverity]int{
+			a5gapi.ErrSeverityUnknown: http.StatusOK,
+			a5gapi.ErrSeverityDebug:   http.StatusOK,
+			a5gapi.ErrSeverityInfo:    http.StatusOK,
+			a5gapi.ErrSeverityWarn:    http.StatusOK,
+			a5gapi.ErrSeverityError:   http.StatusInternalServerError,
+			a5gapi.ErrSeverityFatal:   http.StatusInternalServerError,
+			a5gapi.ErrSeverityPanic:   http.StatusInternalServerError},
+		codes: make(map[a5gapi.APIErrCode]int)}
+}
+
+func (m *StatusMapper) SetSeverity(s a5gapi.ErrSeverity, httpStatus int) {
+	m.mu.Lock()
+	m.severities[s] = httpStatus
+	m.mu.Unlock()
+}
+
+func (m *StatusMapper) SetCode(c a5gapi.APIErrCode, httpStatus int) {
+	m.mu.Lock()
+	m.codes[c] = httpStatus
+	m.mu.Unlock()
+}
+
+func (m *StatusMapper) Status(errs []*a5gapi.APIErr) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	severity := MaxSeverity(errs)
+	for _, e := range errs {
+		if a5gapi.ErrSeverity(e.Severity) != severity {
+			continue
+		}
+		if x, ok := m.codes[a5gapi.APIErrCode(e.Code)]; ok {
+			return x
+		}
+	}
+	if x, ok := m.severities[severity]; ok {
+		return x
+	}
+	return http.StatusInternalServerError
+}
+
+// WriteMsgResponse writes res as JSON with the status DefaultStatusMapper
+// picks for its errors.
+func WriteMsgResponse(w http.ResponseWriter, res *a5gapi.APIMsgResponse) error {
+	return DefaultStatusMapper.WriteMsgResponse(w, res)
+}
+
+// WriteErrResponse answers r with an unsuccessful envelope of errs and
+// meta, e.g. from middleware rejecting a request before its handler.
+func WriteErrResponse(
+	w http.ResponseWriter, r *http.Request, meta a5gapi.KV,
+	errs ...*a5gapi.APIErr) error {
+	res, err := a5gapi.NewMsgResponse(0, false, nil, nil, errs...)
+	if err != nil {
+		return err
+	}
+	res.RequestID = a5gapi.RequestIDFromContext(r.Context())
+	res.APIVersion = a5gapi.APIVersionFromContext(r.Context())
+	res.Meta = meta
+	return WriteMsgResponse(w, res)
+}
+
+func (m *StatusMapper) WriteMsgResponse(
+	w http.ResponseWriter, res *a5gapi.APIMsgResponse) error {
+	if res == nil {
+		return errors.New("nil api response")
+	}
+	return writeJSON(w, m.Status(res.Errs), res)
+}
+
+func writeJSON(w http.ResponseWriter, httpStatus int, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	if _, err = w.Write(b); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package a5ghttp
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+// APIVersionHeader carries the envelope version for requests without a
+// body, e.g. GETs and websocket upgrades.
+const APIVersionHeader = "X-API-Version"
+
+// Versions is the range of envelope versions a server speaks. Clients
+// older than Min are rejected with ErrCodeAPIVersionUnsupported and the
+// minimum client build in the meta, so that they can prompt for an update;
+// newer clients are answered with Max.
+type Versions struct {
+	Min            uint64
+	Max            uint64
+	MinClientBuild string
+	Logger         a5glogs.Logger
+}
+
+func NewVersions(
+	min, max uint64, minClientBuild string, l a5glogs.Logger) (*Versions, error) {
+	if min == 0 || max < min {
+		return nil, errors.Errorf("invalid api versions %d..%d", min, max)
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Versions{
+		Min:            min,
+		Max:            max,
+		MinClientBuild: minClientBuild,
+		Logger:         l}, nil
+}
+
+// Negotiate returns the version to answer a client speaking v with, zero
+// (clients predating versioning) is the first version.
+func (v *Versions) Negotiate(x uint64) (uint64, bool) {
+	if x == 0 {
+		x = 1
+	}
+	switch {
+	case x < v.Min:
+		return 0, false
+	case x > v.Max:
+		return v.Max, true
+	}
+	return x, true
+}
+
+// Meta is the meta of responses rejecting unsupported versions.
+func (v *Versions) Meta() a5gapi.KV {
+	return a5gapi.KV{
+		"minApiVersion":  v.Min,
+		"maxApiVersion":  v.Max,
+		"minClientBuild": v.MinClientBuild}
+}
+
+// Reject logs and answers a client speaking an unsupported version.
+func (v *Versions) Reject(w http.ResponseWriter, r *http.Request, x uint64) {
+	v.Logger.With(
+		a5gfields.String("apiVersion", strconv.FormatUint(x, 10)),
+		a5gfields.String("requestId",
+			a5gapi.RequestIDFromContext(r.Context()))).
+		Debug("api version unsupported")
+	err := WriteErrResponse(w, r, v.Meta(),
+		a5gapi.NewErr(ErrCodeAPIVersionUnsupported, "%d", x))
+	if err != nil {
+		v.Logger.Error(err.Error())
+	}
+}
+
+// Middleware checks the X-API-Version header and puts the negotiated
+// version into the request context. Requests without the header pass, the
+// Adapter checks the version of their envelope.
+func (v *Versions) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := r.Header.Get(APIVersionHeader)
+		if s == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		x, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			v.Logger.Warn(errors.Wrap(err, "api version header").Error())
+			writeErr(w, r, v.Logger, http.StatusBadRequest,
+				a5gapi.NewErr(ErrCodeRequestMalformed, ""))
+			return
+		}
+		negotiated, ok := v.Negotiate(x)
+		if !ok {
+			v.Reject(w, r, x)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(
+			a5gapi.ContextWithAPIVersion(r.Context(), negotiated)))
+	})
+}
+
+// VersionRouter serves a request with the implementation registered for
+// the highest version not above the negotiated one, so a handler changed
+// in version 3 keeps serving versions 3 and up until changed again:
+//
+//	vr := a5ghttp.NewVersionRouter()
+//	vr.Handle(1, profileV1)
+//	vr.Handle(3, profileV3)
+//	r.Post("/profile", adapter.Handler(vr.Serve).ServeHTTP)
+type VersionRouter struct {
+	mu       sync.RWMutex
+	versions []uint64
+	handlers map[uint64]HandlerFunc
+}
+
+func NewVersionRouter() *VersionRouter {
+	return &VersionRouter{handlers: make(map[uint64]HandlerFunc)}
+}
+
+func (vr *VersionRouter) Handle(version uint64, fn HandlerFunc) error {
+	if version == 0 {
+		return errors.New("api version is zero")
+	}
+	if fn == nil {
+		return errors.New("nil handler")
+	}
+	vr.mu.Lock()
+	defer vr.mu.Unlock()
+	if _, ok := vr.handlers[version]; ok {
+		return errors.Errorf("api version %d already registered", version)
+	}
+	vr.handlers[version] = fn
+	vr.versions = append(vr.versions, version)
+	sort.Slice(vr.versions, func(i, j int) bool {
+		return vr.versions[i] < vr.versions[j]
+	})
+	return nil
+}
+
+// Serve is a HandlerFunc. The version is the one negotiated by Versions
+// or, without a policy, the one of the envelope.
+func (vr *VersionRouter) Serve(
+	ctx context.Context,
+	req *a5gapi.APIMsgRequest) (interface{}, []*a5gapi.APIErr) {
+	v := requestVersion(ctx, req)
+	vr.mu.RLock()
+	i := sort.Search(len(vr.versions), func(i int) bool {
+		return vr.versions[i] > v
+	})
+	var fn HandlerFunc
+	if i > 0 {
+		fn = vr.handlers[vr.versions[i-1]]
+	}
+	vr.mu.RUnlock()
+	if fn == nil {
+		return nil, []*a5gapi.APIErr{
+			a5gapi.NewErr(ErrCodeAPIVersionUnsupported, "%d", v)}
+	}
+	return fn(ctx, req)
+}
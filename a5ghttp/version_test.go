@@ -0,0 +1,58 @@
+package a5ghttp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/armor5games/a5g/a5gapi"
+)
+
+func TestVersionRouter(t *testing.T) {
+	vr := NewVersionRouter()
+	for _, v := range []uint64{3, 1} {
+		v := v
+		err := vr.Handle(v, func(
+			context.Context, *a5gapi.APIMsgRequest) (interface{}, []*a5gapi.APIErr) {
+			return v, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := vr.Handle(3, vr.Serve); err == nil {
+		t.Fatal("expected duplicate version error")
+	}
+	vs := &Versions{Min: 2, Max: 4}
+	tests := []struct {
+		requested uint64
+		served    uint64
+		rejected  bool
+	}{
+		{0, 0, true},
+		{1, 0, true},
+		{2, 1, false},
+		{3, 3, false},
+		{9, 3, false},
+	}
+	for _, x := range tests {
+		v, ok := vs.Negotiate(x.requested)
+		if ok == x.rejected {
+			t.Errorf("version %d: expected rejected %v", x.requested, x.rejected)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		ctx := a5gapi.ContextWithAPIVersion(context.Background(), v)
+		payload, errs := vr.Serve(ctx, &a5gapi.APIMsgRequest{APIVersion: x.requested})
+		if len(errs) != 0 || payload != x.served {
+			t.Errorf("version %d: expected v%d, got %v %v",
+				x.requested, x.served, payload, errs)
+		}
+	}
+	_, errs := NewVersionRouter().Serve(
+		context.Background(), &a5gapi.APIMsgRequest{})
+	if len(errs) != 1 || errs[0].Code != uint64(ErrCodeAPIVersionUnsupported) {
+		t.Errorf("expected unsupported version error, got %v", errs)
+	}
+}
@@ -0,0 +1,215 @@
+package a5giap
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+const (
+	AppleProductionURL = "https://buy.itunes.apple.com/verifyReceipt"
+	AppleSandboxURL    = "https://sandbox.itunes.apple.com/verifyReceipt"
+)
+
+// App Store verifyReceipt statuses handled apart from failures.
+const (
+	appleStatusOK             = 0
+	appleStatusUnavailable    = 21005
+	appleStatusSandboxReceipt = 21007
+	appleStatusRetry          = 21009
+)
+
+// AppleValidator checks App Store receipts with the verifyReceipt
+// endpoint. Receipts are sent to production first and, as Apple
+// recommends, to sandbox when production reports a sandbox receipt, so
+// TestFlight and review builds work against the production server.
+// Transient failures are retried Attempts times with a doubling Backoff.
+type AppleValidator struct {
+	BundleID      string
+	SharedSecret  string
+	Client        *http.Client
+	ProductionURL string
+	SandboxURL    string
+	Attempts      int
+	Backoff       time.Duration
+	Logger        a5glogs.Logger
+}
+
+func NewAppleValidator(
+	bundleID, sharedSecret string, l a5glogs.Logger) (*AppleValidator, error) {
+	if bundleID == "" {
+		return nil, errors.New("empty apple bundle id")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &AppleValidator{
+		BundleID:      bundleID,
+		SharedSecret:  sharedSecret,
+		Client:        &http.Client{Timeout: 10 * time.Second},
+		ProductionURL: AppleProductionURL,
+		SandboxURL:    AppleSandboxURL,
+		Attempts:      3,
+		Backoff:       500 * time.Millisecond,
+		Logger:        l}, nil
+}
+
+type appleRequest struct {
+	ReceiptData            string `json:"receipt-data"`
+	Password               string `json:"password,omitempty"`
+	ExcludeOldTransactions bool   `json:"exclude-old-transactions"`
+}
+
+type appleResponse struct {
+	Status      int    `json:"status"`
+	Environment string `json:"environment"`
+	IsRetryable bool   `json:"is-retryable"`
+	Receipt     struct {
+		BundleID string        `json:"bundle_id"`
+		InApp    []*appleInApp `json:"in_app"`
+	} `json:"receipt"`
+}
+
+type appleInApp struct {
+	Quantity       string `json:"quantity"`
+	ProductID      string `json:"product_id"`
+	TransactionID  string `json:"transaction_id"`
+	PurchaseDateMs string `json:"purchase_date_ms"`
+}
+
+func (v *AppleValidator) Validate(
+	ctx context.Context, r *Receipt) (*Purchase, error) {
+	res, err := v.verify(ctx, v.ProductionURL, r.Data)
+	if err == nil && res.Status == appleStatusSandboxReceipt {
+		res, err = v.verify(ctx, v.SandboxURL, r.Data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if res.Status != appleStatusOK {
+		return nil, errors.Wrapf(ErrReceiptInvalid, "apple status %d", res.Status)
+	}
+	if res.Receipt.BundleID != v.BundleID {
+		return nil, errors.Wrapf(ErrReceiptInvalid,
+			"apple bundle id %q", res.Receipt.BundleID)
+	}
+	x := latestInApp(res.Receipt.InApp, r.TransactionID)
+	if x == nil {
+		return nil, errors.Wrap(ErrReceiptInvalid, "apple transaction missing")
+	}
+	q, err := strconv.ParseInt(x.Quantity, 10, 64)
+	if err != nil || q < 1 {
+		q = 1
+	}
+	ms, _ := strconv.ParseInt(x.PurchaseDateMs, 10, 64)
+	p := &Purchase{
+		Platform:      PlatformApple,
+		TransactionID: x.TransactionID,
+		ProductID:     x.ProductID,
+		Quantity:      q,
+		Environment:   EnvironmentProduction,
+		PurchasedAt:   time.Unix(0, ms*int64(time.Millisecond)).UTC()}
+	if res.Environment == "Sandbox" {
+		p.Environment = EnvironmentSandbox
+	}
+	return p, nil
+}
+
+// latestInApp picks the purchase of transactionID or, without one, the
+// latest purchase of the receipt.
+func latestInApp(a []*appleInApp, transactionID string) *appleInApp {
+	var x *appleInApp
+	for _, y := range a {
+		if transactionID != "" {
+			if y.TransactionID == transactionID {
+				return y
+			}
+			continue
+		}
+		if x == nil || len(y.PurchaseDateMs) > len(x.PurchaseDateMs) ||
+			len(y.PurchaseDateMs) == len(x.PurchaseDateMs) &&
+				y.PurchaseDateMs > x.PurchaseDateMs {
+			x = y
+		}
+	}
+	return x
+}
+
+// verify posts the receipt to url until a final answer, returning
+// ErrStoreUnavailable once attempts run out.
+func (v *AppleValidator) verify(
+	ctx context.Context, url, data string) (*appleResponse, error) {
+	b, err := json.Marshal(&appleRequest{
+		ReceiptData:            data,
+		Password:               v.SharedSecret,
+		ExcludeOldTransactions: true})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	backoff := v.Backoff
+	for attempt := 1; ; attempt++ {
+		res, err := v.post(ctx, url, b)
+		if err == nil && !res.transient() {
+			return res, nil
+		}
+		if err == nil {
+			err = errors.Errorf("apple status %d", res.Status)
+		}
+		if attempt >= v.Attempts {
+			return nil, errors.Wrap(ErrStoreUnavailable, err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return nil, errors.WithStack(ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (res *appleResponse) transient() bool {
+	switch {
+	case res.Status == appleStatusUnavailable, res.Status == appleStatusRetry:
+		return true
+	case res.Status >= 21100 && res.Status <= 21199:
+		return res.IsRetryable
+	}
+	return false
+}
+
+func (v *AppleValidator) post(
+	ctx context.Context, url string, b []byte) (*appleResponse, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := v.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			v.Logger.Error(err.Error())
+		}
+	}()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("apple http status %d", res.StatusCode)
+	}
+	x := new(appleResponse)
+	if err = json.Unmarshal(body, x); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return x, nil
+}
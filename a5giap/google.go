@@ -0,0 +1,68 @@
+package a5giap
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/armor5games/a5g/a5ggooglepayments"
+	"github.com/pkg/errors"
+)
+
+// googlePurchased is the purchaseState of a paid purchase.
+const googlePurchased = 0
+
+// GoogleValidator checks Google Play purchases by the signature made with
+// the app license key, no network call is involved. Purchases of license
+// testers have no order id and are reported as sandbox ones.
+type GoogleValidator struct {
+	PackageName string
+	// PublicKey is the base64 encoded license key of the app.
+	PublicKey string
+}
+
+func NewGoogleValidator(packageName, publicKey string) (*GoogleValidator, error) {
+	if packageName == "" {
+		return nil, errors.New("empty google package name")
+	}
+	if publicKey == "" {
+		return nil, errors.New("empty google public key")
+	}
+	return &GoogleValidator{PackageName: packageName, PublicKey: publicKey}, nil
+}
+
+func (v *GoogleValidator) Validate(
+	ctx context.Context, r *Receipt) (*Purchase, error) {
+	ok, err := a5ggooglepayments.IsValid(
+		v.PublicKey, r.Signature, []byte(r.Data))
+	if err != nil || !ok {
+		return nil, errors.Wrap(ErrReceiptInvalid, "google signature")
+	}
+	x := new(a5ggooglepayments.GoogleInappPurchaseReceipt)
+	if err = json.Unmarshal([]byte(r.Data), x); err != nil {
+		return nil, errors.Wrap(ErrReceiptInvalid, err.Error())
+	}
+	if x.PackageName != v.PackageName {
+		return nil, errors.Wrapf(ErrReceiptInvalid,
+			"google package name %q", x.PackageName)
+	}
+	if x.PurchaseState != googlePurchased {
+		return nil, errors.Wrapf(ErrReceiptInvalid,
+			"google purchase state %d", x.PurchaseState)
+	}
+	if x.ProductID == "" || x.PurchaseToken == "" {
+		return nil, errors.Wrap(ErrReceiptInvalid, "google purchase incomplete")
+	}
+	p := &Purchase{
+		Platform:      PlatformGoogle,
+		TransactionID: x.OrderID,
+		ProductID:     x.ProductID,
+		Quantity:      1,
+		Environment:   EnvironmentProduction,
+		PurchasedAt: time.Unix(
+			0, int64(x.PurchaseTime)*int64(time.Millisecond)).UTC()}
+	if x.OrderID == "" {
+		p.TransactionID, p.Environment = x.PurchaseToken, EnvironmentSandbox
+	}
+	return p, nil
+}
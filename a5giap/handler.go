@@ -0,0 +1,106 @@
+package a5giap
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCodeReceiptInvalid = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4227,
+		Name:     "iap_receipt_invalid",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "purchase receipt is invalid"})
+
+	ErrCodeProductUnknown = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4228,
+		Name:     "iap_product_unknown",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "purchased product not found"})
+
+	ErrCodeReceiptReplayed = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4098,
+		Name:     "iap_receipt_replayed",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "purchase already redeemed"})
+
+	ErrCodePurchasePending = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4099,
+		Name:     "iap_purchase_pending",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "purchase is being processed"})
+
+	ErrCodeStoreUnavailable = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     5032,
+		Name:     "iap_store_unavailable",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "store is unavailable, try again later"})
+)
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeReceiptInvalid, http.StatusUnprocessableEntity)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeProductUnknown, http.StatusUnprocessableEntity)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeReceiptReplayed, http.StatusConflict)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodePurchasePending, http.StatusConflict)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeStoreUnavailable, http.StatusServiceUnavailable)
+}
+
+// RedeemHandler redeems a Receipt of the a5gsession authenticated player
+// and answers with the Result.
+func (s *Service) RedeemHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(Receipt) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			sess, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			res, err := s.Redeem(ctx, sess.AccountID, req.Payload.(*Receipt))
+			if err != nil {
+				return nil, s.apiErrs(err)
+			}
+			return res, nil
+		})
+}
+
+func (s *Service) apiErrs(err error) []*a5gapi.APIErr {
+	var c a5gapi.APIErrCode
+	switch errors.Cause(err) {
+	case ErrReceiptInvalid:
+		c = ErrCodeReceiptInvalid
+	case ErrProductUnknown:
+		c = ErrCodeProductUnknown
+	case ErrReceiptReplayed:
+		c = ErrCodeReceiptReplayed
+	case ErrPurchasePending:
+		c = ErrCodePurchasePending
+	case ErrStoreUnavailable:
+		c = ErrCodeStoreUnavailable
+	case a5gwallet.ErrBalanceCapExceeded:
+		return s.Wallet.APIErrs(err)
+	case a5ginventory.ErrCapExceeded, a5ginventory.ErrTabFull:
+		return s.Inventory.APIErrs(err)
+	default:
+		s.Logger.Error(err.Error())
+		return a5gapi.NewJSONMsgDefautlErrors(err)
+	}
+	s.Logger.Warn(err.Error())
+	return []*a5gapi.APIErr{a5gapi.NewErr(c, "")}
+}
@@ -0,0 +1,98 @@
+package a5giap
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	PlatformApple  = "apple"
+	PlatformGoogle = "google"
+
+	EnvironmentProduction = "production"
+	EnvironmentSandbox    = "sandbox"
+)
+
+var (
+	ErrReceiptInvalid = errors.New("purchase receipt invalid")
+	// ErrStoreUnavailable is a transient store failure, worth retrying
+	// later.
+	ErrStoreUnavailable = errors.New("purchase store unavailable")
+	ErrProductUnknown   = errors.New("purchase product unknown")
+	// ErrReceiptReplayed is a purchase redeemed by another account.
+	ErrReceiptReplayed = errors.New("purchase receipt already redeemed")
+	// ErrPurchasePending is a purchase being granted by another request or
+	// left half granted, see Service.Redeem.
+	ErrPurchasePending = errors.New("purchase grant pending")
+)
+
+// Receipt is what the client got from the store. Data is the base64 App
+// Store receipt or the Google Play purchase JSON, Signature is the Google
+// Play one; TransactionID picks a purchase of an App Store receipt holding
+// several.
+type Receipt struct {
+	Platform      string `json:"platform" validate:"required,oneof=apple google"`
+	Data          string `json:"data" validate:"required,max=65536"`
+	Signature     string `json:"signature,omitempty" validate:"max=1024"`
+	TransactionID string `json:"transactionId,omitempty" validate:"max=128"`
+}
+
+// Purchase is a validated purchase, TransactionID is unique per store.
+type Purchase struct {
+	Platform      string    `json:"platform"`
+	TransactionID string    `json:"transactionId"`
+	ProductID     string    `json:"productId"`
+	Quantity      int64     `json:"quantity"`
+	Environment   string    `json:"environment"`
+	PurchasedAt   time.Time `json:"purchasedAt"`
+}
+
+// Validator checks receipts of a store server-side.
+type Validator interface {
+	Validate(ctx context.Context, r *Receipt) (*Purchase, error)
+}
+
+// Product is what a store product grants per purchased unit: wallet
+// currencies and inventory items.
+type Product struct {
+	ID         string           `json:"id"`
+	Currencies map[string]int64 `json:"currencies,omitempty"`
+	Items      map[string]int64 `json:"items,omitempty"`
+}
+
+type Products struct {
+	m map[string]*Product
+}
+
+func NewProducts(a []*Product) (*Products, error) {
+	p := &Products{m: make(map[string]*Product, len(a))}
+	for _, x := range a {
+		if x == nil || x.ID == "" {
+			return nil, errors.New("empty product id")
+		}
+		if _, ok := p.m[x.ID]; ok {
+			return nil, errors.Errorf("duplicate product %q", x.ID)
+		}
+		if len(x.Currencies) == 0 && len(x.Items) == 0 {
+			return nil, errors.Errorf("product %q grants nothing", x.ID)
+		}
+		p.m[x.ID] = x
+	}
+	return p, nil
+}
+
+func NewProductsJSON(b []byte) (*Products, error) {
+	var a []*Product
+	if err := json.Unmarshal(b, &a); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return NewProducts(a)
+}
+
+func (p *Products) Product(id string) (*Product, bool) {
+	x, ok := p.m[id]
+	return x, ok
+}
@@ -0,0 +1,181 @@
+package a5giap
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestAppleValidator(t *testing.T) {
+	calls := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			calls[r.URL.Path]++
+			res := map[string]interface{}{"status": 21007}
+			switch {
+			case r.URL.Path == "/sandbox" && calls[r.URL.Path] == 1:
+				res["status"] = 21005
+			case r.URL.Path == "/sandbox":
+				res = map[string]interface{}{
+					"status": 0, "environment": "Sandbox",
+					"receipt": map[string]interface{}{
+						"bundle_id": "com.example.game",
+						"in_app": []map[string]string{
+							{"product_id": "gems", "transaction_id": "1",
+								"quantity": "1", "purchase_date_ms": "900"},
+							{"product_id": "gems", "transaction_id": "2",
+								"quantity": "2", "purchase_date_ms": "1000"}}}}
+			}
+			json.NewEncoder(w).Encode(res)
+		}))
+	defer srv.Close()
+	v, err := NewAppleValidator("com.example.game", "secret",
+		a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.ProductionURL, v.SandboxURL, v.Backoff = srv.URL+"/prod", srv.URL+"/sandbox", 0
+	p, err := v.Validate(context.Background(), &Receipt{Data: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.TransactionID != "2" || p.Quantity != 2 ||
+		p.Environment != EnvironmentSandbox || calls["/sandbox"] != 2 {
+		t.Errorf("unexpected purchase %+v after calls %v", p, calls)
+	}
+	v.BundleID = "com.example.other"
+	_, err = v.Validate(context.Background(), &Receipt{Data: "x"})
+	if errors.Cause(err) != ErrReceiptInvalid {
+		t.Errorf("expected invalid receipt, got %v", err)
+	}
+}
+
+func TestServiceRedeem(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipt := func(data string) *Receipt {
+		h := sha1.Sum([]byte(data))
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, h[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &Receipt{Platform: PlatformGoogle, Data: data,
+			Signature: base64.StdEncoding.EncodeToString(sig)}
+	}
+	google, err := NewGoogleValidator(
+		"com.example.game", base64.StdEncoding.EncodeToString(pub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	products, err := NewProductsJSON([]byte(`[
+		{"id": "starter", "currencies": {"hard": 100}, "items": {"sword": 1}}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := a5gsession.NewHMACSigner(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	s, err := NewService(products, NewMemoryStore(), signer, l,
+		map[string]Validator{PlatformGoogle: google})
+	if err != nil {
+		t.Fatal(err)
+	}
+	currencies, _ := a5gwallet.NewCurrencies(a5gwallet.Currency{ID: "hard"})
+	s.Wallet, _ = a5gwallet.NewWallet(a5gwallet.NewMemoryStore(), currencies, l)
+	items, _ := a5ginventory.NewCatalog(&a5ginventory.Config{
+		Items: []a5ginventory.Item{
+			{ID: "sword", MaxStack: 1, Tab: "gear"}, {ID: "axe", Tab: "gear"}},
+		Tabs: []a5ginventory.Tab{{ID: "gear", Slots: 1}}})
+	s.Inventory, _ = a5ginventory.NewInventory(
+		a5ginventory.NewMemoryStore(), items, l)
+
+	paid := receipt(`{"orderId":"GPA.1","packageName":"com.example.game",` +
+		`"productId":"starter","purchaseTime":1000,"purchaseState":0,` +
+		`"purchaseToken":"t1"}`)
+	tampered := *paid
+	tampered.Data = paid.Data[:len(paid.Data)-1] + ` }`
+	tests := []struct {
+		name      string
+		accountID uint64
+		receipt   *Receipt
+		err       error
+		replayed  bool
+	}{
+		{"tampered", 1, &tampered, ErrReceiptInvalid, false},
+		{"sandbox", 1, receipt(`{"packageName":"com.example.game",` +
+			`"productId":"starter","purchaseTime":1000,"purchaseToken":"t2"}`),
+			ErrReceiptInvalid, false},
+		{"unknown product", 1, receipt(`{"orderId":"GPA.2",` +
+			`"packageName":"com.example.game","productId":"gold",` +
+			`"purchaseTime":1000,"purchaseToken":"t3"}`), ErrProductUnknown, false},
+		{"redeem", 1, paid, nil, false},
+		{"retry", 1, paid, nil, true},
+		{"replayed by another account", 2, paid, ErrReceiptReplayed, false},
+		{"grant failed", 1, receipt(`{"orderId":"GPA.4",` +
+			`"packageName":"com.example.game","productId":"starter",` +
+			`"purchaseTime":1000,"purchaseToken":"t4"}`),
+			a5ginventory.ErrCapExceeded, false},
+	}
+	for _, test := range tests {
+		res, err := s.Redeem(context.Background(), test.accountID, test.receipt)
+		if errors.Cause(err) != test.err {
+			t.Fatalf("%s: unexpected error %v", test.name, err)
+		}
+		if res != nil && res.Replayed != test.replayed {
+			t.Errorf("%s: expected replayed %v", test.name, test.replayed)
+		}
+	}
+	// The failed grant keeps its idempotent wallet credit for a retry.
+	b, err := s.Wallet.Balances(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != 1 || b[0].Balance != 200 {
+		t.Errorf("unexpected balances %+v", b)
+	}
+
+	// With a Mailer the items of a paid purchase reach a full tab by mail.
+	var mailed []*a5ginventory.Stack
+	s.Inventory.Mailer = a5ginventory.MailerFunc(func(
+		accountID uint64, t *a5ginventory.Tx, overflow []*a5ginventory.Stack) error {
+		mailed = append(mailed, overflow...)
+		return nil
+	})
+	if _, err = s.Inventory.Apply(
+		3, a5ginventory.NewTx("test", "").Grant("axe", 1)); err != nil {
+		t.Fatal(err)
+	}
+	res, err := s.Redeem(context.Background(), 3, receipt(`{"orderId":"GPA.5",`+
+		`"packageName":"com.example.game","productId":"starter",`+
+		`"purchaseTime":1000,"purchaseToken":"t5"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Inventory.Overflow) != 1 || len(mailed) != 1 ||
+		mailed[0].ItemID != "sword" || mailed[0].Quantity != 1 {
+		t.Errorf("unexpected overflow %+v, mailed %+v", res.Inventory, mailed)
+	}
+}
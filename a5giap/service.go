@@ -0,0 +1,195 @@
+package a5giap
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+)
+
+// Counterparty and reason of wallet and inventory transactions of
+// purchases.
+const (
+	Counterparty = "iap"
+	Reason       = "purchase"
+)
+
+// Result is the payload of a redeemed purchase; a purchase redeemed again
+// by the same account is Replayed and has no changes, the client resyncs.
+type Result struct {
+	Purchase  *Purchase             `json:"purchase"`
+	Wallet    *a5gwallet.Result     `json:"wallet,omitempty"`
+	Inventory *a5ginventory.Changes `json:"inventory,omitempty"`
+	Replayed  bool                  `json:"replayed,omitempty"`
+}
+
+// Service redeems store purchases: validates the receipt, claims its
+// transaction so it is redeemed once, grants the product through the
+// wallet and the inventory and completes the signed audit record.
+type Service struct {
+	Validators map[string]Validator
+	Products   *Products
+	Store      Store
+	Signer     a5gsession.Signer
+	Logger     a5glogs.Logger
+	// Wallet and Inventory grant currencies and items of products, each
+	// may be nil when no product grants them.
+	Wallet    *a5gwallet.Wallet
+	Inventory *a5ginventory.Inventory
+	// AllowSandbox accepts sandbox purchases, e.g. on staging servers.
+	AllowSandbox bool
+
+	now func() time.Time
+}
+
+func NewService(
+	p *Products, s Store, signer a5gsession.Signer, l a5glogs.Logger,
+	validators map[string]Validator) (*Service, error) {
+	if p == nil {
+		return nil, errors.New("products missing")
+	}
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if signer == nil {
+		return nil, errors.New("signer missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	if len(validators) == 0 {
+		return nil, errors.New("validators missing")
+	}
+	return &Service{
+		Validators: validators,
+		Products:   p,
+		Store:      s,
+		Signer:     signer,
+		Logger:     l,
+		now:        time.Now}, nil
+}
+
+// Redeem grants the purchase of a receipt to an account. A failed grant
+// releases the claim, so the client may retry: wallet transactions are
+// idempotent by the purchase and inventory ones are atomic. A record
+// failing to complete after the grant stays pending and is reported with
+// ErrPurchasePending until resolved by support.
+func (s *Service) Redeem(
+	ctx context.Context, accountID uint64, r *Receipt) (*Result, error) {
+	v, ok := s.Validators[r.Platform]
+	if !ok {
+		return nil, errors.Wrapf(ErrReceiptInvalid, "platform %q", r.Platform)
+	}
+	p, err := v.Validate(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	if p.Environment == EnvironmentSandbox && !s.AllowSandbox {
+		return nil, errors.Wrap(ErrReceiptInvalid, "sandbox purchase")
+	}
+	product, ok := s.Products.Product(p.ProductID)
+	if !ok {
+		return nil, errors.Wrap(ErrProductUnknown, p.ProductID)
+	}
+	rec := &Record{
+		Platform:      p.Platform,
+		TransactionID: p.TransactionID,
+		AccountID:     accountID,
+		ProductID:     p.ProductID,
+		Quantity:      p.Quantity,
+		Environment:   p.Environment,
+		Status:        StatusPending,
+		PurchasedAt:   p.PurchasedAt,
+		CreatedAt:     s.now().UTC().Truncate(time.Second)}
+	if err = rec.Sign(s.Signer); err != nil {
+		return nil, err
+	}
+	x, err := s.Store.Claim(rec)
+	if err != nil {
+		return nil, err
+	}
+	if x != nil {
+		return s.replay(accountID, p, x)
+	}
+	res, err := s.grant(accountID, p, product)
+	if err != nil {
+		if x := s.Store.Release(rec); x != nil {
+			s.Logger.Error(x.Error())
+		}
+		return nil, err
+	}
+	rec.Status = StatusGranted
+	if err = rec.Sign(s.Signer); err == nil {
+		err = s.Store.Complete(rec)
+	}
+	if err != nil {
+		s.log(rec).Error(err.Error())
+		return nil, errors.Wrap(ErrPurchasePending, err.Error())
+	}
+	return res, nil
+}
+
+func (s *Service) replay(
+	accountID uint64, p *Purchase, x *Record) (*Result, error) {
+	if !x.Verify(s.Signer) {
+		s.log(x).Error("purchase record signature mismatch")
+		return nil, errors.Wrap(ErrPurchasePending, "record signature")
+	}
+	if x.AccountID != accountID {
+		s.log(x).With(a5gfields.String("replayedBy",
+			strconv.FormatUint(accountID, 10))).Warn("purchase replayed")
+		return nil, errors.Wrap(ErrReceiptReplayed, p.TransactionID)
+	}
+	if x.Status != StatusGranted {
+		return nil, errors.Wrap(ErrPurchasePending, p.TransactionID)
+	}
+	return &Result{Purchase: p, Replayed: true}, nil
+}
+
+func (s *Service) grant(
+	accountID uint64, p *Purchase, product *Product) (*Result, error) {
+	res := &Result{Purchase: p}
+	ref := p.Platform + ":" + p.TransactionID
+	if len(product.Currencies) > 0 {
+		if s.Wallet == nil {
+			return nil, errors.New("wallet missing")
+		}
+		t := a5gwallet.NewTx("iap:"+ref, Counterparty, Reason)
+		for c, n := range product.Currencies {
+			t.Credit(c, n*p.Quantity)
+		}
+		x, err := s.Wallet.Apply(accountID, t)
+		if err != nil {
+			return nil, err
+		}
+		res.Wallet = x
+	}
+	if len(product.Items) > 0 {
+		if s.Inventory == nil {
+			return nil, errors.New("inventory missing")
+		}
+		t := a5ginventory.NewTx(Reason, ref).MailOverflow()
+		for id, n := range product.Items {
+			t.Grant(id, n*p.Quantity)
+		}
+		x, err := s.Inventory.Apply(accountID, t)
+		if err != nil {
+			return nil, err
+		}
+		res.Inventory = x
+	}
+	return res, nil
+}
+
+func (s *Service) log(r *Record) a5glogs.Logger {
+	return s.Logger.With(
+		a5gfields.String("platform", r.Platform),
+		a5gfields.String("transactionId", r.TransactionID),
+		a5gfields.String("accountId", strconv.FormatUint(r.AccountID, 10)))
+}
@@ -0,0 +1,195 @@
+package a5giap
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+const (
+	StatusPending = "pending"
+	StatusGranted = "granted"
+)
+
+// Record is the audit record of a redeemed purchase, signed so that
+// records edited in storage are told apart.
+type Record struct {
+	Platform      string    `db:"platform"`
+	TransactionID string    `db:"transaction_id"`
+	AccountID     uint64    `db:"account_id"`
+	ProductID     string    `db:"product_id"`
+	Quantity      int64     `db:"quantity"`
+	Environment   string    `db:"environment"`
+	Status        string    `db:"status"`
+	PurchasedAt   time.Time `db:"purchased_at"`
+	CreatedAt     time.Time `db:"created_at"`
+	Signature     string    `db:"signature"`
+}
+
+func (r *Record) signed() []byte {
+	return []byte(strings.Join([]string{
+		r.Platform,
+		r.TransactionID,
+		strconv.FormatUint(r.AccountID, 10),
+		r.ProductID,
+		strconv.FormatInt(r.Quantity, 10),
+		r.Environment,
+		r.Status,
+		strconv.FormatInt(r.PurchasedAt.Unix(), 10),
+		strconv.FormatInt(r.CreatedAt.Unix(), 10)}, "\n"))
+}
+
+func (r *Record) Sign(s a5gsession.Signer) error {
+	b, err := s.Sign(r.signed())
+	if err != nil {
+		return err
+	}
+	r.Signature = base64.RawURLEncoding.EncodeToString(b)
+	return nil
+}
+
+func (r *Record) Verify(s a5gsession.Signer) bool {
+	b, err := base64.RawURLEncoding.DecodeString(r.Signature)
+	return err == nil && s.Verify(r.signed(), b)
+}
+
+// Store keeps purchase records unique per platform and transaction id.
+// Claim adds a pending record or returns the one already there; Release
+// drops a pending record of a failed grant.
+type Store interface {
+	Claim(r *Record) (*Record, error)
+	Complete(r *Record) error
+	Release(r *Record) error
+}
+
+type memoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{records: make(map[string]Record)}
+}
+
+func recordKey(r *Record) string { return r.Platform + ":" + r.TransactionID }
+
+func (s *memoryStore) Claim(r *Record) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if x, ok := s.records[recordKey(r)]; ok {
+		return &x, nil
+	}
+	s.records[recordKey(r)] = *r
+	return nil, nil
+}
+
+func (s *memoryStore) Complete(r *Record) error {
+	s.mu.Lock()
+	s.records[recordKey(r)] = *r
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryStore) Release(r *Record) error {
+	s.mu.Lock()
+	if x, ok := s.records[recordKey(r)]; ok && x.Status == StatusPending {
+		delete(s.records, recordKey(r))
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// dbStore keeps purchase records in a MySQL table:
+//
+//	CREATE TABLE iap_purchases (
+//	  platform VARCHAR(16) NOT NULL,
+//	  transaction_id VARCHAR(191) NOT NULL,
+//	  account_id BIGINT UNSIGNED NOT NULL,
+//	  product_id VARCHAR(128) NOT NULL,
+//	  quantity BIGINT NOT NULL,
+//	  environment VARCHAR(16) NOT NULL,
+//	  status VARCHAR(16) NOT NULL,
+//	  purchased_at DATETIME NOT NULL,
+//	  created_at DATETIME NOT NULL,
+//	  signature VARCHAR(128) NOT NULL,
+//	  PRIMARY KEY (platform, transaction_id),
+//	  KEY account_id (account_id));
+type dbStore struct {
+	pooler    a5gdb.Pooler
+	tableName string
+}
+
+var recordColumns = []string{
+	"platform", "transaction_id", "account_id", "product_id", "quantity",
+	"environment", "status", "purchased_at", "created_at", "signature"}
+
+func NewDBStore(p a5gdb.Pooler, tableName string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if tableName == "" {
+		return nil, errors.New("empty iap table name")
+	}
+	return &dbStore{pooler: p, tableName: tableName}, nil
+}
+
+func (s *dbStore) Claim(r *Record) (*Record, error) {
+	sess := s.pooler.WritePool().NewSession()
+	res, err := sess.InsertBySql("INSERT IGNORE INTO "+s.tableName+
+		" ("+strings.Join(recordColumns, ", ")+")"+
+		" VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		r.Platform, r.TransactionID, r.AccountID, r.ProductID, r.Quantity,
+		r.Environment, r.Status, r.PurchasedAt, r.CreatedAt, r.Signature).Exec()
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	if n == 1 {
+		return nil, nil
+	}
+	x := new(Record)
+	err = sess.Select(recordColumns...).From(s.tableName).
+		Where(dbr.Eq("platform", r.Platform)).
+		Where(dbr.Eq("transaction_id", r.TransactionID)).LoadOne(x)
+	if err == dbr.ErrNotFound {
+		// Released in between, the caller may retry.
+		return nil, errors.Wrap(ErrPurchasePending, r.TransactionID)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	return x, nil
+}
+
+func (s *dbStore) Complete(r *Record) error {
+	_, err := s.pooler.WritePool().NewSession().Update(s.tableName).
+		Set("status", r.Status).
+		Set("signature", r.Signature).
+		Where(dbr.Eq("platform", r.Platform)).
+		Where(dbr.Eq("transaction_id", r.TransactionID)).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*UpdateStmt).Exec fn")
+	}
+	return nil
+}
+
+func (s *dbStore) Release(r *Record) error {
+	_, err := s.pooler.WritePool().NewSession().DeleteFrom(s.tableName).
+		Where(dbr.Eq("platform", r.Platform)).
+		Where(dbr.Eq("transaction_id", r.TransactionID)).
+		Where(dbr.Eq("status", StatusPending)).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*DeleteStmt).Exec fn")
+	}
+	return nil
+}
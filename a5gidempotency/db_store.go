@@ -0,0 +1,103 @@
+package a5gidempotency
+
+import (
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+// dbStore keeps records in a MySQL table:
+//
+//	CREATE TABLE idempotency_keys (
+//	  idempotency_key VARCHAR(191) PRIMARY KEY,
+//	  fingerprint CHAR(64) NOT NULL,
+//	  done TINYINT NOT NULL,
+//	  status INT NOT NULL,
+//	  content_type VARCHAR(128) NOT NULL,
+//	  body MEDIUMBLOB,
+//	  expires_at DATETIME NOT NULL,
+//	  KEY expires_at (expires_at));
+type dbStore struct {
+	pooler    a5gdb.Pooler
+	tableName string
+}
+
+type dbRecord struct {
+	Fingerprint string `db:"fingerprint"`
+	Done        bool   `db:"done"`
+	Status      int    `db:"status"`
+	ContentType string `db:"content_type"`
+	Body        []byte `db:"body"`
+}
+
+func NewDBStore(p a5gdb.Pooler, tableName string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if tableName == "" {
+		return nil, errors.New("empty idempotency table name")
+	}
+	return &dbStore{pooler: p, tableName: tableName}, nil
+}
+
+func (s *dbStore) Reserve(
+	key, fingerprint string, ttl time.Duration) (*Record, error) {
+	sess := s.pooler.WritePool().NewSession()
+	now := time.Now().UTC()
+	_, err := sess.DeleteFrom(s.tableName).
+		Where(dbr.Eq("idempotency_key", key)).
+		Where(dbr.Lt("expires_at", now)).Exec()
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*DeleteStmt).Exec fn")
+	}
+	res, err := sess.InsertBySql("INSERT IGNORE INTO "+s.tableName+
+		" (idempotency_key, fingerprint, done, status, content_type, expires_at)"+
+		" VALUES (?, ?, 0, 0, '', ?)", key, fingerprint, now.Add(ttl)).Exec()
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if n == 1 {
+		return nil, nil
+	}
+	x := new(dbRecord)
+	err = sess.Select("fingerprint", "done", "status", "content_type", "body").
+		From(s.tableName).Where(dbr.Eq("idempotency_key", key)).LoadOne(x)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	return &Record{
+		Fingerprint: x.Fingerprint,
+		Done:        x.Done,
+		Status:      x.Status,
+		ContentType: x.ContentType,
+		Body:        x.Body}, nil
+}
+
+func (s *dbStore) Complete(key string, r *Record, ttl time.Duration) error {
+	_, err := s.pooler.WritePool().NewSession().Update(s.tableName).
+		Set("done", r.Done).
+		Set("status", r.Status).
+		Set("content_type", r.ContentType).
+		Set("body", r.Body).
+		Set("expires_at", time.Now().UTC().Add(ttl)).
+		Where(dbr.Eq("idempotency_key", key)).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*UpdateStmt).Exec fn")
+	}
+	return nil
+}
+
+func (s *dbStore) Release(key string) error {
+	_, err := s.pooler.WritePool().NewSession().DeleteFrom(s.tableName).
+		Where(dbr.Eq("idempotency_key", key)).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*DeleteStmt).Exec fn")
+	}
+	return nil
+}
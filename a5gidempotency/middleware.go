@@ -0,0 +1,257 @@
+package a5gidempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5gcodec"
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/pkg/errors"
+)
+
+const (
+	KeyHeader      = "Idempotency-Key"
+	ReplayedHeader = "Idempotent-Replayed"
+)
+
+var (
+	ErrCodeInProgress = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4090,
+		Name:     "idempotency_in_progress",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "request with this idempotency key is in progress"})
+
+	ErrCodeKeyReused = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4091,
+		Name:     "idempotency_key_reused",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "idempotency key was used for another request"})
+)
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeInProgress, http.StatusConflict)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeKeyReused, http.StatusUnprocessableEntity)
+}
+
+// EventReceiver is the part of gocraft/health.EventReceiver (and
+// a5glogs.DummyHealth) used for replay metrics.
+type EventReceiver interface {
+	EventKv(eventName string, m map[string]string)
+}
+
+// Idempotency replays the first response of a mutating request to its
+// retries carrying the same Idempotency-Key. Keys are scoped per account
+// (or per client address for anonymous requests), 5xx responses are not
+// stored so that retries run again. A request in flight holds its key for
+// LockTTL, so keys of crashed processes free up soon; responses are kept
+// for TTL.
+type Idempotency struct {
+	Store        Store
+	Logger       a5glogs.Logger
+	Events       EventReceiver
+	TTL          time.Duration
+	LockTTL      time.Duration
+	MaxBodyBytes int64
+}
+
+func NewIdempotency(s Store, l a5glogs.Logger) (*Idempotency, error) {
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Idempotency{
+		Store:        s,
+		Logger:       l,
+		TTL:          24 * time.Hour,
+		LockTTL:      time.Minute,
+		MaxBodyBytes: 1 << 20}, nil
+}
+
+func (m *Idempotency) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		k := r.Header.Get(KeyHeader)
+		if k == "" || r.Method == http.MethodGet || r.Method == http.MethodHead ||
+			r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(k) > 128 {
+			m.writeErr(w, r, a5gapi.NewErr(
+				a5ghttp.ErrCodeRequestMalformed, "idempotency key too long"))
+			return
+		}
+		body, err := m.readBody(r)
+		if err != nil {
+			m.Logger.Warn(err.Error())
+			m.writeErr(w, r, a5gapi.NewErr(a5ghttp.ErrCodeRequestMalformed, ""))
+			return
+		}
+		key := scope(r) + ":" + k
+		fingerprint := fingerprint(r, body)
+		x, err := m.Store.Reserve(key, fingerprint, m.LockTTL)
+		if err != nil {
+			// A broken store must not block purchases, run unprotected.
+			m.Logger.Error(err.Error())
+			m.event("idempotency.store_error")
+			next.ServeHTTP(w, r)
+			return
+		}
+		switch {
+		case x != nil && x.Fingerprint != fingerprint:
+			m.event("idempotency.key_reused")
+			m.writeErr(w, r, a5gapi.NewErr(ErrCodeKeyReused, ""))
+			return
+		case x != nil && !x.Done:
+			m.event("idempotency.in_progress")
+			m.writeErr(w, r, a5gapi.NewErr(ErrCodeInProgress, ""))
+			return
+		case x != nil:
+			m.event("idempotency.replay")
+			if x.ContentType != "" {
+				w.Header().Set("Content-Type", x.ContentType)
+			}
+			w.Header().Set(ReplayedHeader, "true")
+			w.WriteHeader(x.Status)
+			if _, err = w.Write(x.Body); err != nil {
+				m.Logger.Debug(err.Error())
+			}
+			return
+		}
+		m.event("idempotency.miss")
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+			if err := m.Store.Release(key); err != nil {
+				m.Logger.Error(err.Error())
+			}
+		}()
+		next.ServeHTTP(rec, r)
+		if rec.status >= http.StatusInternalServerError {
+			return
+		}
+		err = m.Store.Complete(key, &Record{
+			Fingerprint: fingerprint,
+			Done:        true,
+			Status:      rec.status,
+			ContentType: rec.Header().Get("Content-Type"),
+			Body:        rec.body.Bytes()}, m.TTL)
+		if err != nil {
+			m.Logger.With(a5gfields.String("idempotencyKey", key)).
+				Error(err.Error())
+			return
+		}
+		completed = true
+	})
+}
+
+func (m *Idempotency) readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(r.Body, m.MaxBodyBytes+1))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if int64(len(b)) > m.MaxBodyBytes {
+		return nil, errors.New("request body too large")
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(b))
+	return b, nil
+}
+
+func (m *Idempotency) writeErr(
+	w http.ResponseWriter, r *http.Request, e *a5gapi.APIErr) {
+	if err := a5ghttp.WriteErrResponse(w, r, nil, e); err != nil {
+		m.Logger.Error(err.Error())
+	}
+}
+
+func (m *Idempotency) event(name string) {
+	if m.Events != nil {
+		m.Events.EventKv(name, nil)
+	}
+}
+
+func scope(r *http.Request) string {
+	if s, ok := a5gsession.FromContext(r.Context()); ok {
+		return "account:" + strconv.FormatUint(s.AccountID, 10)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// fingerprint hashes the request envelope without its time and request
+// id, which clients renew on every retry, so only the payload and the
+// other envelope fields tell requests apart. Bodies which are not an
+// envelope are hashed as they are.
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	// hash.Hash writes never fail.
+	_, _ = io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	_, _ = h.Write(envelope(r, body))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func envelope(r *http.Request, body []byte) []byte {
+	if len(body) == 0 {
+		return body
+	}
+	c, err := a5gcodec.ByContentType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return body
+	}
+	req := &a5gapi.APIMsgRequest{Payload: new(json.RawMessage)}
+	if err = c.Unmarshal(body, req); err != nil {
+		return body
+	}
+	req.Time, req.RequestID = 0, ""
+	b, err := json.Marshal(req)
+	if err != nil {
+		return body
+	}
+	return b
+}
+
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (w *recorder) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status, w.wroteHeader = status, true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recorder) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	// bytes.Buffer writes never fail.
+	_, _ = w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
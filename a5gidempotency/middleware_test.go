@@ -0,0 +1,108 @@
+package a5gidempotency
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/sirupsen/logrus"
+)
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	s := NewMemoryStore()
+	now := time.Unix(1000, 0)
+	s.(*memoryStore).now = func() time.Time { return now }
+	m, err := NewIdempotency(s, a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := 0
+	h := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch r.URL.Path {
+		case "/panic":
+			panic("handler failed")
+		case "/unavailable":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("call " + strconv.Itoa(calls)))
+	}))
+	tests := []struct {
+		name     string
+		path     string
+		key      string
+		body     string
+		after    time.Duration
+		crashed  bool
+		status   int
+		response string
+		replayed bool
+	}{
+		{"first", "/buy", "k1", "a", 0, false, http.StatusOK, "call 1", false},
+		{"replay", "/buy", "k1", "a", 0, false, http.StatusOK, "call 1", true},
+		{"other body", "/buy", "k1", "b", 0, false,
+			http.StatusUnprocessableEntity, "", false},
+		{"5xx", "/unavailable", "k2", "a", 0, false,
+			http.StatusServiceUnavailable, "", false},
+		{"5xx retry", "/unavailable", "k2", "a", 0, false,
+			http.StatusServiceUnavailable, "", false},
+		{"panic", "/panic", "k3", "a", 0, false, 0, "", false},
+		{"panic retry", "/buy", "k3", "a", 0, false,
+			http.StatusOK, "call 5", false},
+		{"without key", "/buy", "", "a", 0, false,
+			http.StatusOK, "call 6", false},
+		// A process died holding the key.
+		{"locked", "/buy", "k4", "a", 0, true, http.StatusConflict, "", false},
+		{"lock expired", "/buy", "k4", "a", 2 * time.Minute, false,
+			http.StatusOK, "call 7", false},
+		{"envelope", "/buy", "k5", `{"requestId": "r1", "time": 1000,
+			"payload": {"sku": "gem"}}`, 0, false, http.StatusOK, "call 8", false},
+		// Clients renew the time and request id of a retry.
+		{"envelope retry", "/buy", "k5", `{"payload": {"sku": "gem"},
+			"time": 1005, "requestId": "r2"}`, 0, false, http.StatusOK, "call 8", true},
+		{"envelope other payload", "/buy", "k5", `{"time": 1010,
+			"payload": {"sku": "gold"}}`, 0, false, http.StatusUnprocessableEntity, "", false},
+	}
+	for _, test := range tests {
+		now = now.Add(test.after)
+		r := httptest.NewRequest(http.MethodPost, test.path,
+			strings.NewReader(test.body))
+		r.RemoteAddr = "192.0.2.1:1000"
+		if test.key != "" {
+			r.Header.Set(KeyHeader, test.key)
+		}
+		if test.crashed {
+			_, err := s.Reserve("ip:192.0.2.1:"+test.key,
+				fingerprint(r, []byte(test.body)), m.LockTTL)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		w := httptest.NewRecorder()
+		func() {
+			defer func() {
+				if v := recover(); v != nil && test.path != "/panic" {
+					t.Fatalf("%s: unexpected panic %v", test.name, v)
+				}
+			}()
+			h.ServeHTTP(w, r)
+		}()
+		if test.status == 0 {
+			continue
+		}
+		replayed := w.Header().Get(ReplayedHeader) == "true"
+		if w.Code != test.status || replayed != test.replayed ||
+			(test.response != "" && w.Body.String() != test.response) {
+			t.Errorf("%s: unexpected response %d %q, replayed %v",
+				test.name, w.Code, w.Body.String(), replayed)
+		}
+	}
+	if calls != 8 {
+		t.Errorf("expected 8 handler calls, got %d", calls)
+	}
+}
@@ -0,0 +1,68 @@
+package a5gidempotency
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+)
+
+type redisStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisStore keeps records as JSON strings under prefix+key.
+func NewRedisStore(c redis.UniversalClient, prefix string) (Store, error) {
+	if c == nil {
+		return nil, errors.New("redis client missing")
+	}
+	return &redisStore{client: c, prefix: prefix}, nil
+}
+
+func (s *redisStore) Reserve(
+	key, fingerprint string, ttl time.Duration) (*Record, error) {
+	b, err := json.Marshal(&Record{Fingerprint: fingerprint})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	ok, err := s.client.SetNX(s.prefix+key, b, ttl).Result()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if ok {
+		return nil, nil
+	}
+	b, err = s.client.Get(s.prefix + key).Bytes()
+	if err == redis.Nil {
+		// Expired in between, the caller may retry.
+		return nil, errors.New("idempotency record vanished")
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	r := new(Record)
+	if err = json.Unmarshal(b, r); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return r, nil
+}
+
+func (s *redisStore) Complete(key string, r *Record, ttl time.Duration) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err = s.client.Set(s.prefix+key, b, ttl).Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+func (s *redisStore) Release(key string) error {
+	if err := s.client.Del(s.prefix + key).Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
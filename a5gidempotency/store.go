@@ -0,0 +1,76 @@
+package a5gidempotency
+
+import (
+	"sync"
+	"time"
+)
+
+// Record is the first response given for an idempotency key. Until it is
+// Done the key is only reserved by a request in flight.
+type Record struct {
+	Fingerprint string `json:"fingerprint"`
+	Done        bool   `json:"done"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// Store keeps records for ttl.
+type Store interface {
+	// Reserve atomically claims key for a new request for ttl. If the key
+	// is taken, its record is returned and nothing changes.
+	Reserve(key, fingerprint string, ttl time.Duration) (*Record, error)
+	Complete(key string, r *Record, ttl time.Duration) error
+	// Release drops a reservation, e.g. after a failure worth retrying.
+	Release(key string) error
+}
+
+type memoryRecord struct {
+	record    Record
+	expiresAt time.Time
+}
+
+type memoryStore struct {
+	mu      sync.Mutex
+	records map[string]*memoryRecord
+	now     func() time.Time
+}
+
+// NewMemoryStore is a single-process Store.
+func NewMemoryStore() Store {
+	return &memoryStore{records: make(map[string]*memoryRecord), now: time.Now}
+}
+
+func (s *memoryStore) Reserve(
+	key, fingerprint string, ttl time.Duration) (*Record, error) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, x := range s.records {
+		if now.After(x.expiresAt) {
+			delete(s.records, k)
+		}
+	}
+	if x, ok := s.records[key]; ok {
+		r := x.record
+		return &r, nil
+	}
+	s.records[key] = &memoryRecord{
+		record:    Record{Fingerprint: fingerprint},
+		expiresAt: now.Add(ttl)}
+	return nil, nil
+}
+
+func (s *memoryStore) Complete(key string, r *Record, ttl time.Duration) error {
+	s.mu.Lock()
+	s.records[key] = &memoryRecord{record: *r, expiresAt: s.now().Add(ttl)}
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryStore) Release(key string) error {
+	s.mu.Lock()
+	delete(s.records, key)
+	s.mu.Unlock()
+	return nil
+}
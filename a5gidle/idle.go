@@ -0,0 +1,90 @@
+package a5gidle
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Rate is an resource accrued per hour while the player is away.
+type Rate struct {
+	Resource string `json:"resource"`
+	PerHour  uint64 `json:"perHour"`
+}
+
+type Config struct {
+	Rates []Rate `json:"rates"`
+	// MaxAwaySeconds caps the accrual window, e.g. 8 hours of "storage".
+	MaxAwaySeconds int64 `json:"maxAwaySeconds"`
+	// MinAwaySeconds is the absence below which nothing is accrued.
+	MinAwaySeconds int64 `json:"minAwaySeconds,omitempty"`
+	// PremiumBonusPercent is added on top of base earnings for premium
+	// players (100 doubles the earnings).
+	PremiumBonusPercent uint64 `json:"premiumBonusPercent,omitempty"`
+}
+
+// Earning is an per resource breakdown the client can animate
+// (base first, then bonus).
+type Earning struct {
+	Resource string `json:"resource"`
+	Base     uint64 `json:"base"`
+	Bonus    uint64 `json:"bonus,omitempty"`
+	Total    uint64 `json:"total"`
+}
+
+type Earnings struct {
+	AwaySeconds    int64     `json:"awaySeconds"`
+	CountedSeconds int64     `json:"countedSeconds"`
+	Capped         bool      `json:"capped,omitempty"`
+	Premium        bool      `json:"premium,omitempty"`
+	Items          []Earning `json:"items,omitempty"`
+}
+
+func (c *Config) Validate() error {
+	if c.MaxAwaySeconds <= 0 {
+		return errors.New("unexpected idle max away duration")
+	}
+	if c.MinAwaySeconds < 0 || c.MinAwaySeconds > c.MaxAwaySeconds {
+		return errors.New("unexpected idle min away duration")
+	}
+	for _, r := range c.Rates {
+		if r.Resource == "" {
+			return errors.New("empty idle rate resource")
+		}
+	}
+	return nil
+}
+
+// Compute returns earnings accrued between lastSeen and now. A lastSeen in
+// the future (clock skew) yields nothing.
+func (c *Config) Compute(lastSeen, now time.Time, isPremium bool) *Earnings {
+	away := now.Sub(lastSeen)
+	if away < 0 {
+		away = 0
+	}
+	e := &Earnings{
+		AwaySeconds: int64(away / time.Second),
+		Premium:     isPremium}
+	if away == 0 || away < time.Duration(c.MinAwaySeconds)*time.Second {
+		return e
+	}
+	counted := away
+	if x := time.Duration(c.MaxAwaySeconds) * time.Second; counted > x {
+		counted = x
+		e.Capped = true
+	}
+	seconds := uint64(counted / time.Second)
+	e.CountedSeconds = int64(seconds)
+	for _, r := range c.Rates {
+		x := Earning{Resource: r.Resource, Base: r.PerHour * seconds / 3600}
+		if isPremium {
+			x.Bonus = x.Base * c.PremiumBonusPercent / 100
+		}
+		x.Total = x.Base + x.Bonus
+		if x.Total == 0 {
+			continue
+		}
+		e.Items = append(e.Items, x)
+	}
+	return e
+}
@@ -0,0 +1,48 @@
+package a5gidle
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCompute(t *testing.T) {
+	c := &Config{
+		Rates:               []Rate{{Resource: "gold", PerHour: 100}, {Resource: "gems", PerHour: 1}},
+		MaxAwaySeconds:      8 * 3600,
+		MinAwaySeconds:      60,
+		PremiumBonusPercent: 50}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1500000000, 0)
+
+	// Accrual stops at the cap however long the player is away.
+	for _, away := range []time.Duration{8 * time.Hour, 9 * time.Hour, 30 * 24 * time.Hour} {
+		e := c.Compute(now.Add(-away), now, false)
+		want := []Earning{{Resource: "gold", Base: 800, Total: 800},
+			{Resource: "gems", Base: 8, Total: 8}}
+		if e.AwaySeconds != int64(away/time.Second) || e.CountedSeconds != 8*3600 ||
+			e.Capped != (away > 8*time.Hour) || !reflect.DeepEqual(e.Items, want) {
+			t.Errorf("unexpected earnings after %s: %+v", away, e)
+		}
+	}
+
+	e := c.Compute(now.Add(-90*time.Minute), now, true)
+	want := []Earning{{Resource: "gold", Base: 150, Bonus: 75, Total: 225},
+		{Resource: "gems", Base: 1, Total: 1}}
+	if e.Capped || e.CountedSeconds != 5400 || !reflect.DeepEqual(e.Items, want) {
+		t.Errorf("unexpected premium earnings %+v", e)
+	}
+
+	for _, lastSeen := range []time.Time{now.Add(-59 * time.Second), now.Add(time.Hour)} {
+		if e = c.Compute(lastSeen, now, false); e.CountedSeconds != 0 || e.Items != nil {
+			t.Errorf("unexpected earnings since %s: %+v", lastSeen, e)
+		}
+	}
+
+	c.MinAwaySeconds = c.MaxAwaySeconds + 1
+	if c.Validate() == nil {
+		t.Error("expected a min away duration error")
+	}
+}
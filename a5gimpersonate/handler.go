@@ -0,0 +1,47 @@
+package a5gimpersonate
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gvalidate"
+)
+
+var ErrCodeForbidden = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+	Code:     4036,
+	Name:     "impersonation_forbidden",
+	Severity: a5gapi.ErrSeverityWarn,
+	Public:   true,
+	Message:  "impersonation forbidden"})
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeForbidden, http.StatusForbidden)
+}
+
+type RecordsRequest struct {
+	AccountID uint64 `json:"accountId" validate:"required"`
+	Limit     int    `json:"limit" validate:"min=1,max=500"`
+}
+
+type RecordsResponse struct {
+	Records []*Record `json:"records"`
+}
+
+// RecordsHandler answers with the latest impersonated calls of an
+// account, mount it on an admin route class.
+func (x *Impersonator) RecordsHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return &RecordsRequest{Limit: 50} },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			r := req.Payload.(*RecordsRequest)
+			a, err := x.Store.Records(r.AccountID, r.Limit)
+			if err != nil {
+				x.Logger.Error(err.Error())
+				return nil, a5gapi.NewJSONMsgDefautlErrors(err)
+			}
+			return &RecordsResponse{Records: a}, nil
+		})
+}
@@ -0,0 +1,183 @@
+package a5gimpersonate
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/pkg/errors"
+)
+
+// Header carries the ID of the account support staff acts as.
+const Header = "X-A5g-Impersonate"
+
+// PermImpersonate allows a role to view endpoints as a player.
+const PermImpersonate = "impersonate"
+
+// Staff is an authenticated support staff member.
+type Staff struct {
+	ID    string
+	Roles []string
+}
+
+// StaffFunc authenticates the staff member making r.
+type StaffFunc func(r *http.Request) (*Staff, bool)
+
+// ClientCertStaff authenticates staff by verified TLS client
+// certificates: the common name is the ID, organizational units are the
+// roles.
+func ClientCertStaff(r *http.Request) (*Staff, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 ||
+		len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+	c := r.TLS.VerifiedChains[0][0]
+	if c.Subject.CommonName == "" {
+		return nil, false
+	}
+	return &Staff{
+		ID:    c.Subject.CommonName,
+		Roles: c.Subject.OrganizationalUnit}, true
+}
+
+// Record audits an impersonated call.
+type Record struct {
+	Staff      string    `json:"staff"`
+	AccountID  uint64    `json:"accountId"`
+	Route      string    `json:"route"`
+	RequestID  string    `json:"requestId,omitempty"`
+	RemoteAddr string    `json:"remoteAddr"`
+	At         time.Time `json:"at"`
+}
+
+// Store keeps the audit log, Records serves the latest ones of an
+// account, newest first.
+type Store interface {
+	Append(r *Record) error
+	Records(accountID uint64, limit int) ([]*Record, error)
+}
+
+// Impersonator lets staff of roles granted PermImpersonate call Routes,
+// "METHOD /path" of read-only player endpoints, as the account in Header.
+// Every call is audited before it is served and refused when it can't be.
+type Impersonator struct {
+	// Roles are permissions by role.
+	Roles  map[string][]string
+	Routes map[string]bool
+	Staff  StaffFunc
+	Store  Store
+	Logger a5glogs.Logger
+
+	now func() time.Time
+}
+
+func NewImpersonator(roles map[string][]string, routes []string,
+	staff StaffFunc, s Store, l a5glogs.Logger) (*Impersonator, error) {
+	if len(routes) == 0 {
+		return nil, errors.New("no read-only routes")
+	}
+	if staff == nil {
+		return nil, errors.New("staff fn missing")
+	}
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	x := &Impersonator{
+		Roles:  roles,
+		Routes: make(map[string]bool, len(routes)),
+		Staff:  staff,
+		Store:  s,
+		Logger: l,
+		now:    time.Now}
+	for _, r := range routes {
+		x.Routes[r] = true
+	}
+	return x, nil
+}
+
+// Can reports whether a role of s is granted perm.
+func (x *Impersonator) Can(s *Staff, perm string) bool {
+	for _, role := range s.Roles {
+		for _, p := range x.Roles[role] {
+			if p == perm {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type ctxKey int
+
+const ctxKeyRecord ctxKey = iota
+
+// FromContext returns the audit record of an impersonated call, handlers
+// shared with players may hide what staff must not see.
+func FromContext(ctx context.Context) (*Record, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	r, ok := ctx.Value(ctxKeyRecord).(*Record)
+	return r, ok && r != nil
+}
+
+// Middleware serves impersonated calls with an a5gsession of the account,
+// so player handlers run unchanged; mount it on an admin route class in
+// place of the session middleware.
+func (x *Impersonator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := r.Method + " " + r.URL.Path
+		l := x.Logger.With(a5gfields.String("route", route),
+			a5gfields.String("remoteAddr", r.RemoteAddr))
+		staff, ok := x.Staff(r)
+		if !ok || !x.Can(staff, PermImpersonate) || !x.Routes[route] {
+			l.Warn("impersonation forbidden")
+			x.writeErr(w, r, a5gapi.NewErr(ErrCodeForbidden, ""))
+			return
+		}
+		accountID, err := strconv.ParseUint(r.Header.Get(Header), 10, 64)
+		if err != nil || accountID == 0 {
+			x.writeErr(w, r, a5gapi.NewErr(a5ghttp.ErrCodeRequestMalformed,
+				"invalid %s header", Header))
+			return
+		}
+		rec := &Record{
+			Staff:      staff.ID,
+			AccountID:  accountID,
+			Route:      route,
+			RequestID:  a5gapi.RequestIDFromContext(r.Context()),
+			RemoteAddr: r.RemoteAddr,
+			At:         x.now().UTC()}
+		if err = x.Store.Append(rec); err != nil {
+			l.Error(err.Error())
+			x.writeErr(w, r, a5gapi.NewJSONMsgDefautlErrors(err)...)
+			return
+		}
+		l.With(a5gfields.String("staff", staff.ID),
+			a5gfields.String("accountId", strconv.FormatUint(accountID, 10))).
+			Info("impersonated call")
+		s := &a5gsession.Session{
+			ID:        "impersonation:" + staff.ID,
+			Kind:      a5gsession.KindAccess,
+			AccountID: accountID}
+		ctx := context.WithValue(r.Context(), ctxKeyRecord, rec)
+		ctx = a5gapi.ContextWithAccountID(a5gsession.ContextWithSession(ctx, s), accountID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (x *Impersonator) writeErr(
+	w http.ResponseWriter, r *http.Request, errs ...*a5gapi.APIErr) {
+	if err := a5ghttp.WriteErrResponse(w, r, nil, errs...); err != nil {
+		x.Logger.Error(err.Error())
+	}
+}
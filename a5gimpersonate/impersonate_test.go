@@ -0,0 +1,67 @@
+package a5gimpersonate
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/sirupsen/logrus"
+)
+
+func TestImpersonatorMiddleware(t *testing.T) {
+	s := NewMemoryStore()
+	x, err := NewImpersonator(
+		map[string][]string{"support": {PermImpersonate}, "viewer": {"dashboards"}},
+		[]string{"GET /inventory"},
+		func(r *http.Request) (*Staff, bool) {
+			id := r.Header.Get("X-Staff")
+			return &Staff{ID: id, Roles: []string{id}}, id != ""
+		}, s, a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var served []uint64
+	h := x.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, ok := a5gsession.FromContext(r.Context())
+		if _, audited := FromContext(r.Context()); !ok || !audited {
+			t.Error("impersonated call without a session or record")
+			return
+		}
+		served = append(served, session.AccountID)
+	}))
+
+	var a = []struct {
+		method, path, staff, account string
+		status                       int
+	}{
+		{http.MethodGet, "/inventory", "support", "7", http.StatusOK},
+		{http.MethodPost, "/inventory", "support", "7", http.StatusForbidden},
+		{http.MethodGet, "/wallet", "support", "7", http.StatusForbidden},
+		{http.MethodGet, "/inventory", "viewer", "7", http.StatusForbidden},
+		{http.MethodGet, "/inventory", "", "7", http.StatusForbidden},
+		{http.MethodGet, "/inventory", "support", "x", http.StatusBadRequest},
+	}
+	for i, v := range a {
+		r := httptest.NewRequest(v.method, v.path, nil)
+		r.Header.Set("X-Staff", v.staff)
+		r.Header.Set(Header, v.account)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != v.status {
+			t.Errorf("%d: unexpected status %d", i, w.Code)
+		}
+	}
+	if len(served) != 1 || served[0] != 7 {
+		t.Errorf("unexpected served calls %v", served)
+	}
+	records, err := s.Records(7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Staff != "support" ||
+		records[0].Route != "GET /inventory" {
+		t.Errorf("unexpected audit records %+v", records)
+	}
+}
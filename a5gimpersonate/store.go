@@ -0,0 +1,110 @@
+package a5gimpersonate
+
+import (
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryStore struct {
+	mu      sync.Mutex
+	records []Record
+}
+
+func NewMemoryStore() Store {
+	return new(memoryStore)
+}
+
+func (s *memoryStore) Append(r *Record) error {
+	s.mu.Lock()
+	s.records = append(s.records, *r)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryStore) Records(accountID uint64, limit int) ([]*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := []*Record{}
+	for i := len(s.records) - 1; i >= 0; i-- {
+		if limit > 0 && len(a) >= limit {
+			break
+		}
+		if r := s.records[i]; r.AccountID == accountID {
+			a = append(a, &r)
+		}
+	}
+	return a, nil
+}
+
+// dbStore keeps the audit log in a MySQL table:
+//
+//	CREATE TABLE impersonation_log (
+//	  id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+//	  staff VARCHAR(64) NOT NULL,
+//	  account_id BIGINT UNSIGNED NOT NULL,
+//	  route VARCHAR(255) NOT NULL,
+//	  request_id VARCHAR(64) NOT NULL,
+//	  remote_addr VARCHAR(64) NOT NULL,
+//	  created_at DATETIME NOT NULL,
+//	  KEY (account_id, id));
+type dbStore struct {
+	pooler    a5gdb.Pooler
+	tableName string
+}
+
+type dbRecord struct {
+	Staff      string    `db:"staff"`
+	AccountID  uint64    `db:"account_id"`
+	Route      string    `db:"route"`
+	RequestID  string    `db:"request_id"`
+	RemoteAddr string    `db:"remote_addr"`
+	At         time.Time `db:"created_at"`
+}
+
+func NewDBStore(p a5gdb.Pooler, tableName string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if tableName == "" {
+		return nil, errors.New("empty impersonation table name")
+	}
+	return &dbStore{pooler: p, tableName: tableName}, nil
+}
+
+func (s *dbStore) Append(r *Record) error {
+	_, err := s.pooler.WritePool().NewSession().InsertInto(s.tableName).
+		Pair("staff", r.Staff).
+		Pair("account_id", r.AccountID).
+		Pair("route", r.Route).
+		Pair("request_id", r.RequestID).
+		Pair("remote_addr", r.RemoteAddr).
+		Pair("created_at", r.At).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	return nil
+}
+
+func (s *dbStore) Records(accountID uint64, limit int) ([]*Record, error) {
+	stmt := s.pooler.ReadPool().NewSession().
+		Select("staff", "account_id", "route", "request_id", "remote_addr",
+			"created_at").
+		From(s.tableName).Where(dbr.Eq("account_id", accountID)).OrderDesc("id")
+	if limit > 0 {
+		stmt.Limit(uint64(limit))
+	}
+	var a []*dbRecord
+	if _, err := stmt.Load(&a); err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	records := make([]*Record, len(a))
+	for i, x := range a {
+		r := Record(*x)
+		records[i] = &r
+	}
+	return records, nil
+}
@@ -0,0 +1,68 @@
+package a5gintegrity
+
+import (
+	"context"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gvalidate"
+)
+
+// FindingsRequest pages through findings of an account, of every account
+// when AccountID is zero.
+type FindingsRequest struct {
+	AccountID uint64 `json:"accountId"`
+	AfterID   int64  `json:"afterId"`
+	Limit     int    `json:"limit" validate:"min=0,max=500"`
+}
+
+type FindingsResponse struct {
+	Findings []*Finding `json:"findings"`
+}
+
+// CheckRequest checks a player now, Fix repairs every fixable issue.
+type CheckRequest struct {
+	AccountID uint64 `json:"accountId" validate:"required"`
+	Fix       bool   `json:"fix"`
+}
+
+// FindingsHandler lists findings and fixes, mount it on an admin route
+// class.
+func (c *Checker) FindingsHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(FindingsRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			r := req.Payload.(*FindingsRequest)
+			limit := r.Limit
+			if limit == 0 {
+				limit = 100
+			}
+			a, err := c.Store.Findings(r.AccountID, r.AfterID, limit)
+			if err != nil {
+				c.Logger.Error(err.Error())
+				return nil, a5gapi.NewJSONMsgDefautlErrors(err)
+			}
+			return &FindingsResponse{Findings: a}, nil
+		})
+}
+
+// CheckHandler checks a player on demand, e.g. from a support ticket,
+// mount it on an admin route class.
+func (c *Checker) CheckHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(CheckRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			r := req.Payload.(*CheckRequest)
+			a, err := c.Check(ctx, r.AccountID, r.Fix)
+			if err != nil {
+				c.Logger.Error(err.Error())
+				return nil, a5gapi.NewJSONMsgDefautlErrors(err)
+			}
+			if a == nil {
+				a = []*Finding{}
+			}
+			return &FindingsResponse{Findings: a}, nil
+		})
+}
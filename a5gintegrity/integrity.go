@@ -0,0 +1,167 @@
+package a5gintegrity
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+// Issue is a corruption a rule found in the state of a player. Fix
+// repairs it, nil when it can't be repaired automatically.
+type Issue struct {
+	Detail string
+	Fix    func(ctx context.Context) error
+}
+
+// Rule checks an invariant of player state, e.g. no negative balances.
+type Rule struct {
+	Name  string
+	Check func(ctx context.Context, accountID uint64) ([]*Issue, error)
+}
+
+// Finding is a reported issue, an audit entry of its fix when Fixed.
+type Finding struct {
+	ID        int64  `json:"id"`
+	Rule      string `json:"rule"`
+	AccountID uint64 `json:"accountId"`
+	Detail    string `json:"detail"`
+	Fixable   bool   `json:"fixable"`
+	Fixed     bool   `json:"fixed"`
+	FixErr    string `json:"fixErr,omitempty"`
+	At        int64  `json:"at"`
+}
+
+// Store keeps findings. Add assigns IDs; Findings lists findings of an
+// account, of every account when zero, after afterID in ID order.
+type Store interface {
+	Add(f *Finding) error
+	Findings(accountID uint64, afterID int64, limit int) ([]*Finding, error)
+}
+
+// AccountsFunc pages account IDs above afterID in ascending order.
+type AccountsFunc func(afterID uint64, limit int) ([]uint64, error)
+
+// Summary counts a scan.
+type Summary struct {
+	Accounts int64 `json:"accounts"`
+	Findings int64 `json:"findings"`
+	Fixed    int64 `json:"fixed"`
+}
+
+// Checker runs Rules over players. Issues of rules named in AutoFix are
+// fixed as they are found; the others are only reported.
+type Checker struct {
+	Rules     []*Rule
+	Accounts  AccountsFunc
+	Store     Store
+	Logger    a5glogs.Logger
+	AutoFix   map[string]bool
+	BatchSize int
+
+	now func() time.Time
+}
+
+func NewChecker(
+	rules []*Rule, accounts AccountsFunc, s Store, l a5glogs.Logger) (*Checker, error) {
+	names := make(map[string]bool, len(rules))
+	for _, r := range rules {
+		if r == nil || r.Name == "" || r.Check == nil {
+			return nil, errors.New("invalid integrity rule")
+		}
+		if names[r.Name] {
+			return nil, errors.Errorf("duplicate integrity rule %q", r.Name)
+		}
+		names[r.Name] = true
+	}
+	if accounts == nil {
+		return nil, errors.New("accounts missing")
+	}
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Checker{
+		Rules:     rules,
+		Accounts:  accounts,
+		Store:     s,
+		Logger:    l,
+		AutoFix:   map[string]bool{},
+		BatchSize: 500,
+		now:       time.Now}, nil
+}
+
+// Check runs every rule against a player, stores and returns findings.
+// fix overrides AutoFix, e.g. for a support agent repairing an account.
+func (c *Checker) Check(
+	ctx context.Context, accountID uint64, fix bool) ([]*Finding, error) {
+	var a []*Finding
+	for _, r := range c.Rules {
+		issues, err := r.Check(ctx, accountID)
+		if err != nil {
+			return a, errors.Wrapf(err, "integrity rule %q", r.Name)
+		}
+		for _, i := range issues {
+			f := &Finding{
+				Rule:      r.Name,
+				AccountID: accountID,
+				Detail:    i.Detail,
+				Fixable:   i.Fix != nil,
+				At:        c.now().Unix()}
+			if f.Fixable && (fix || c.AutoFix[r.Name]) {
+				if err = i.Fix(ctx); err != nil {
+					f.FixErr = err.Error()
+				} else {
+					f.Fixed = true
+				}
+			}
+			if err = c.Store.Add(f); err != nil {
+				return a, err
+			}
+			c.Logger.With(a5gfields.String("rule", r.Name),
+				a5gfields.String("accountID", strconv.FormatUint(accountID, 10)),
+				a5gfields.String("detail", f.Detail)).Warn("player state corrupted")
+			a = append(a, f)
+		}
+	}
+	return a, nil
+}
+
+// Scan checks players above afterID in batches until every one is done
+// or ctx is done, and returns the last checked account ID as a cursor to
+// resume from.
+func (c *Checker) Scan(
+	ctx context.Context, afterID uint64) (uint64, *Summary, error) {
+	sum := new(Summary)
+	for {
+		ids, err := c.Accounts(afterID, c.BatchSize)
+		if err != nil {
+			return afterID, sum, err
+		}
+		for _, id := range ids {
+			if err = ctx.Err(); err != nil {
+				return afterID, sum, errors.WithStack(err)
+			}
+			a, err := c.Check(ctx, id, false)
+			if err != nil {
+				return afterID, sum, err
+			}
+			sum.Accounts++
+			for _, f := range a {
+				sum.Findings++
+				if f.Fixed {
+					sum.Fixed++
+				}
+			}
+			afterID = id
+		}
+		if len(ids) < c.BatchSize {
+			return afterID, sum, nil
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package a5gintegrity
+
+import (
+	"context"
+	"testing"
+
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/armor5games/a5g/a5gxp"
+	"github.com/sirupsen/logrus"
+)
+
+func TestChecker(t *testing.T) {
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	ws := a5gwallet.NewMemoryStore()
+	// A wallet of a broken release let balances go below zero.
+	loose, _ := a5gwallet.NewCurrencies(a5gwallet.Currency{ID: "gold", Floor: -100})
+	broken, err := a5gwallet.NewWallet(ws, loose, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = broken.Debit(2, "t1", "shop", "buy", "gold", 30); err != nil {
+		t.Fatal(err)
+	}
+	strict, _ := a5gwallet.NewCurrencies(a5gwallet.Currency{ID: "gold"})
+	w, _ := a5gwallet.NewWallet(ws, strict, l)
+
+	is := a5ginventory.NewMemoryStore()
+	old, _ := a5ginventory.NewCatalogJSON([]byte(`{"items": [{"id": "wood"}, {"id": "axe"}]}`))
+	inv, _ := a5ginventory.NewInventory(is, old, l)
+	if _, err = inv.Apply(3, a5ginventory.NewTx("quest", "").Grant("axe", 1)); err != nil {
+		t.Fatal(err)
+	}
+	inv.Catalog, _ = a5ginventory.NewCatalogJSON([]byte(`{"items": [{"id": "wood"}]}`))
+
+	curve, err := a5gxp.NewCurveJSON([]byte(`[{"level": 1, "xp": 0},
+		{"level": 2, "xp": 100}, {"level": 3, "xp": 300}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	progress := map[uint64][2]uint64{1: {150, 2}, 2: {150, 2}, 3: {900, 3}, 4: {0, 1}}
+	rules := []*Rule{NegativeBalances(w), OrphanedItems(inv), ImpossibleLevels(curve,
+		func(id uint64) (uint64, uint64, error) {
+			return progress[id][0], progress[id][1], nil
+		}, func(id, xp, level uint64) error {
+			progress[id] = [2]uint64{xp, level}
+			return nil
+		})}
+	accounts := func(afterID uint64, limit int) ([]uint64, error) {
+		var a []uint64
+		for id := afterID + 1; id <= 4 && len(a) < limit; id++ {
+			a = append(a, id)
+		}
+		return a, nil
+	}
+	s := NewMemoryStore()
+	c, err := NewChecker(rules, accounts, s, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.AutoFix["negative_balance"] = true
+	c.BatchSize = 3
+
+	ctx := context.Background()
+	cursor, sum, err := c.Scan(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor != 4 || sum.Accounts != 4 || sum.Findings != 3 || sum.Fixed != 1 {
+		t.Errorf("unexpected scan %d %+v", cursor, sum)
+	}
+	b, _ := w.Balances(2)
+	if len(b) != 1 || b[0].Balance != 0 {
+		t.Errorf("negative balance not fixed %v", b)
+	}
+	a, _ := s.Findings(3, 0, 0)
+	if len(a) != 2 || a[0].Rule != "orphaned_item" || a[0].Fixable ||
+		a[1].Rule != "impossible_level" || !a[1].Fixable || a[1].Fixed {
+		t.Errorf("unexpected findings %+v %+v", a[0], a[1])
+	}
+
+	// Support repairs the level on demand, a second check finds nothing.
+	if a, err = c.Check(ctx, 3, true); err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != 2 || !a[1].Fixed || progress[3] != [2]uint64{300, 3} {
+		t.Errorf("level not fixed %+v %v", a[1], progress[3])
+	}
+	if a, _ = c.Check(ctx, 2, false); len(a) != 0 {
+		t.Errorf("unexpected findings after fix %+v", a)
+	}
+}
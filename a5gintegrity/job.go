@@ -0,0 +1,44 @@
+package a5gintegrity
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5gjobs"
+	"github.com/pkg/errors"
+)
+
+// JobKind is the a5gjobs kind of scans, see Checker.JobHandler.
+const JobKind = "integrity_scan"
+
+type jobPayload struct {
+	AfterID uint64 `json:"afterId"`
+}
+
+// NewJob makes a job scanning players above afterID, e.g. a nightly one.
+func NewJob(afterID uint64, maxAttempts int) (*a5gjobs.Job, error) {
+	b, err := json.Marshal(&jobPayload{AfterID: afterID})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return a5gjobs.NewJob(JobKind, b, a5gjobs.PriorityLow, maxAttempts)
+}
+
+// JobHandler scans players of a NewJob job; a retry scans again from the
+// start, players have to be rechecked anyway after fixes of other ones.
+func (c *Checker) JobHandler() a5gjobs.HandlerFunc {
+	return func(ctx context.Context, j *a5gjobs.Job) error {
+		x := new(jobPayload)
+		if err := json.Unmarshal(j.Payload, x); err != nil {
+			return errors.WithStack(err)
+		}
+		cursor, sum, err := c.Scan(ctx, x.AfterID)
+		c.Logger.With(a5gfields.String("cursor", strconv.FormatUint(cursor, 10)),
+			a5gfields.Int64("accounts", sum.Accounts),
+			a5gfields.Int64("findings", sum.Findings),
+			a5gfields.Int64("fixed", sum.Fixed)).Info("integrity scan")
+		return err
+	}
+}
@@ -0,0 +1,100 @@
+package a5gintegrity
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/armor5games/a5g/a5gxp"
+)
+
+// FixReason is the wallet reason and counterparty of integrity fixes.
+const FixReason = "integrity_fix"
+
+// NegativeBalances finds wallet balances below the floor of their
+// currency, zero for most; fixes credit them back to the floor.
+func NegativeBalances(w *a5gwallet.Wallet) *Rule {
+	return &Rule{Name: "negative_balance", Check: func(
+		ctx context.Context, accountID uint64) ([]*Issue, error) {
+		balances, err := w.Balances(accountID)
+		if err != nil {
+			return nil, err
+		}
+		var a []*Issue
+		for _, b := range balances {
+			c, _ := w.Currencies.Currency(b.Currency)
+			if b.Balance >= c.Floor {
+				continue
+			}
+			currency, amount := b.Currency, c.Floor-b.Balance
+			// The transaction ID is bound to the balance found, so a
+			// repeated fix of the same corruption is booked once.
+			txID := "integrity:" + strconv.FormatUint(accountID, 10) + ":" +
+				currency + ":" + strconv.FormatInt(b.Balance, 10)
+			a = append(a, &Issue{
+				Detail: fmt.Sprintf("%s balance %d", currency, b.Balance),
+				Fix: func(context.Context) error {
+					_, err := w.Credit(accountID, txID, FixReason, FixReason,
+						currency, amount)
+					return err
+				}})
+		}
+		return a, nil
+	}}
+}
+
+// OrphanedItems finds stacks of items missing from the inventory catalog,
+// e.g. of removed items. They are left for a designer to replace.
+func OrphanedItems(inv *a5ginventory.Inventory) *Rule {
+	return &Rule{Name: "orphaned_item", Check: func(
+		ctx context.Context, accountID uint64) ([]*Issue, error) {
+		stacks, err := inv.Stacks(accountID)
+		if err != nil {
+			return nil, err
+		}
+		var a []*Issue
+		for _, s := range stacks {
+			if _, ok := inv.Catalog.Item(s.ItemID); !ok {
+				a = append(a, &Issue{
+					Detail: fmt.Sprintf("%d of unknown item %s", s.Quantity, s.ItemID)})
+			}
+		}
+		return a, nil
+	}}
+}
+
+// ProgressFunc reads the XP and the stored level of a player.
+type ProgressFunc func(accountID uint64) (xp, level uint64, err error)
+
+// SetLevelFunc stores the XP and the level of a player.
+type SetLevelFunc func(accountID uint64, xp, level uint64) error
+
+// ImpossibleLevels finds levels which don't match XP on the curve, or XP
+// past its end. Fixes cap XP at the end of the curve and set the level it
+// gives, they are off when set is nil.
+func ImpossibleLevels(
+	c *a5gxp.Curve, progress ProgressFunc, set SetLevelFunc) *Rule {
+	return &Rule{Name: "impossible_level", Check: func(
+		ctx context.Context, accountID uint64) ([]*Issue, error) {
+		xp, level, err := progress(accountID)
+		if err != nil {
+			return nil, err
+		}
+		x := xp
+		if x > c.MaxXP() {
+			x = c.MaxXP()
+		}
+		want := c.Level(x)
+		if x == xp && level == want {
+			return nil, nil
+		}
+		i := &Issue{Detail: fmt.Sprintf("level %d at %d xp, want %d at %d xp",
+			level, xp, want, x)}
+		if set != nil {
+			i.Fix = func(context.Context) error { return set(accountID, x, want) }
+		}
+		return []*Issue{i}, nil
+	}}
+}
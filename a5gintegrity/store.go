@@ -0,0 +1,134 @@
+package a5gintegrity
+
+import (
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryStore struct {
+	mu       sync.Mutex
+	findings []*Finding
+}
+
+func NewMemoryStore() Store {
+	return new(memoryStore)
+}
+
+func (s *memoryStore) Add(f *Finding) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f.ID = int64(len(s.findings) + 1)
+	x := *f
+	s.findings = append(s.findings, &x)
+	return nil
+}
+
+func (s *memoryStore) Findings(
+	accountID uint64, afterID int64, limit int) ([]*Finding, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := []*Finding{}
+	for _, f := range s.findings {
+		if limit > 0 && len(a) >= limit {
+			break
+		}
+		if f.ID > afterID && (accountID == 0 || f.AccountID == accountID) {
+			x := *f
+			a = append(a, &x)
+		}
+	}
+	return a, nil
+}
+
+// dbStore keeps findings in a MySQL table:
+//
+//	CREATE TABLE integrity_findings (
+//	  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+//	  rule VARCHAR(64) NOT NULL,
+//	  account_id BIGINT UNSIGNED NOT NULL,
+//	  detail VARCHAR(255) NOT NULL,
+//	  fixable TINYINT(1) NOT NULL,
+//	  fixed TINYINT(1) NOT NULL,
+//	  fix_err VARCHAR(255) NOT NULL,
+//	  created_at DATETIME NOT NULL,
+//	  KEY account_id (account_id, id));
+type dbStore struct {
+	pooler    a5gdb.Pooler
+	tableName string
+}
+
+type dbFinding struct {
+	ID        int64     `db:"id"`
+	Rule      string    `db:"rule"`
+	AccountID uint64    `db:"account_id"`
+	Detail    string    `db:"detail"`
+	Fixable   bool      `db:"fixable"`
+	Fixed     bool      `db:"fixed"`
+	FixErr    string    `db:"fix_err"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+var dbFindingColumns = []string{
+	"rule", "account_id", "detail", "fixable", "fixed", "fix_err", "created_at"}
+
+func NewDBStore(p a5gdb.Pooler, tableName string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if tableName == "" {
+		return nil, errors.New("empty integrity findings table name")
+	}
+	return &dbStore{pooler: p, tableName: tableName}, nil
+}
+
+func (s *dbStore) Add(f *Finding) error {
+	x := &dbFinding{
+		Rule:      f.Rule,
+		AccountID: f.AccountID,
+		Detail:    f.Detail,
+		Fixable:   f.Fixable,
+		Fixed:     f.Fixed,
+		FixErr:    f.FixErr,
+		CreatedAt: time.Unix(f.At, 0).UTC()}
+	_, err := s.pooler.WritePool().NewSession().InsertInto(s.tableName).
+		Columns(dbFindingColumns...).Record(x).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	f.ID = x.ID
+	return nil
+}
+
+func (s *dbStore) Findings(
+	accountID uint64, afterID int64, limit int) ([]*Finding, error) {
+	stmt := s.pooler.ReadPool().NewSession().
+		Select(append([]string{"id"}, dbFindingColumns...)...).
+		From(s.tableName).Where(dbr.Gt("id", afterID)).OrderAsc("id")
+	if accountID != 0 {
+		stmt.Where(dbr.Eq("account_id", accountID))
+	}
+	if limit > 0 {
+		stmt.Limit(uint64(limit))
+	}
+	var rows []*dbFinding
+	if _, err := stmt.Load(&rows); err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	a := make([]*Finding, 0, len(rows))
+	for _, r := range rows {
+		a = append(a, &Finding{
+			ID:        r.ID,
+			Rule:      r.Rule,
+			AccountID: r.AccountID,
+			Detail:    r.Detail,
+			Fixable:   r.Fixable,
+			Fixed:     r.Fixed,
+			FixErr:    r.FixErr,
+			At:        r.CreatedAt.Unix()})
+	}
+	return a, nil
+}
@@ -0,0 +1,139 @@
+package a5ginventory
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCodeInsufficient = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4093,
+		Name:     "inventory_insufficient",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "not enough items"})
+
+	ErrCodeCapExceeded = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4094,
+		Name:     "inventory_cap_exceeded",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "item stack is full"})
+
+	ErrCodeTabUnknown = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4048,
+		Name:     "inventory_tab_unknown",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "inventory tab not found"})
+
+	ErrCodeTabFull = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4231,
+		Name:     "inventory_tab_full",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "inventory tab is full"})
+
+	ErrCodeExpansionsExhausted = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4232,
+		Name:     "inventory_expansions_exhausted",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "no inventory expansions left"})
+
+	ErrCodeConflict = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4233,
+		Name:     "inventory_conflict",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "inventory changed, sync and retry"})
+)
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeInsufficient, http.StatusConflict)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeCapExceeded, http.StatusConflict)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeTabUnknown, http.StatusNotFound)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeTabFull, http.StatusConflict)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeExpansionsExhausted, http.StatusUnprocessableEntity)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeConflict, http.StatusConflict)
+}
+
+// StacksResponse is the inventory sync payload, Capacity lists every tab.
+type StacksResponse struct {
+	Stacks   []*Stack    `json:"stacks"`
+	Capacity []*Capacity `json:"capacity,omitempty"`
+}
+
+type ExpandRequest struct {
+	Tab string `json:"tab" validate:"required"`
+}
+
+// StacksHandler answers with the inventory of the a5gsession authenticated
+// player. Game handlers change inventories through Apply and answer with
+// its Changes.
+func (inv *Inventory) StacksHandler() a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		s, ok := a5gsession.FromContext(ctx)
+		if !ok {
+			return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+		}
+		stacks, err := inv.Stacks(s.AccountID)
+		if err != nil {
+			return nil, inv.APIErrs(err)
+		}
+		return &StacksResponse{
+			Stacks: stacks, Capacity: inv.Catalog.Capacity(stacks)}, nil
+	}
+}
+
+// ExpandHandler buys the next expansion of a tab for the a5gsession
+// authenticated player.
+func (inv *Inventory) ExpandHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(ExpandRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			p := req.Payload.(*ExpandRequest)
+			res, err := inv.Expand(s.AccountID, p.Tab)
+			if err != nil {
+				return nil, inv.APIErrs(err)
+			}
+			return res, nil
+		})
+}
+
+// APIErrs converts an Apply error, the item is named in the message.
+func (inv *Inventory) APIErrs(err error) []*a5gapi.APIErr {
+	switch errors.Cause(err) {
+	case ErrInsufficient:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeInsufficient, "%s", err)}
+	case ErrCapExceeded:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeCapExceeded, "%s", err)}
+	case ErrTabUnknown:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeTabUnknown, "%s", err)}
+	case ErrTabFull:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeTabFull, "%s", err)}
+	case ErrExpansionsExhausted:
+		return []*a5gapi.APIErr{
+			a5gapi.NewErr(ErrCodeExpansionsExhausted, "%s", err)}
+	case ErrConflict:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeConflict, "%s", err)}
+	case a5gwallet.ErrInsufficientFunds:
+		return inv.Wallet.APIErrs(err)
+	}
+	inv.Logger.Error(err.Error())
+	return a5gapi.NewJSONMsgDefautlErrors(err)
+}
@@ -0,0 +1,589 @@
+package a5ginventory
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/armor5games/a5g/a5gjobs"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrItemUnknown  = errors.New("inventory item unknown")
+	ErrInsufficient = errors.New("not enough inventory items")
+	ErrCapExceeded  = errors.New("inventory stack cap exceeded")
+	ErrTabUnknown   = errors.New("inventory tab unknown")
+	ErrTabFull      = errors.New("inventory tab full")
+	ErrConflict     = errors.New("inventory quantity changed")
+
+	ErrExpansionsExhausted = errors.New("no inventory expansions left")
+
+	// ErrOverflowUndelivered is overflow neither enqueued nor mailed; the
+	// transaction is stored and must not be retried.
+	ErrOverflowUndelivered = errors.New("inventory overflow undelivered")
+)
+
+// Item is an item definition; MaxStack caps the quantity a player may
+// hold, zero is uncapped. Each stack of an item with a Tab takes one slot
+// of the tab.
+type Item struct {
+	ID       string `json:"id"`
+	MaxStack int64  `json:"maxStack,omitempty"`
+	Tab      string `json:"tab,omitempty"`
+}
+
+// Tab limits the number of stacks of its items to Slots, zero is
+// uncapped, plus slots of the Expansions a player has. The number of
+// expansions is the quantity of ExpansionItem, so rewards may grant them
+// too; the catalog caps it at the number of Expansions.
+type Tab struct {
+	ID            string      `json:"id"`
+	Slots         int64       `json:"slots"`
+	ExpansionItem string      `json:"expansionItem,omitempty"`
+	Expansions    []Expansion `json:"expansions,omitempty"`
+}
+
+// Expansion adds Slots to a tab for Price of Currency, zero Price is free.
+type Expansion struct {
+	Slots    int64  `json:"slots"`
+	Currency string `json:"currency,omitempty"`
+	Price    int64  `json:"price,omitempty"`
+}
+
+func (t *Tab) slots(expansions int64) int64 {
+	n := t.Slots
+	for i := 0; int64(i) < expansions && i < len(t.Expansions); i++ {
+		n += t.Expansions[i].Slots
+	}
+	return n
+}
+
+// Config is an balance data of inventory items.
+type Config struct {
+	Items []Item `json:"items"`
+	Tabs  []Tab  `json:"tabs,omitempty"`
+}
+
+type Catalog struct {
+	items map[string]Item
+	tabs  map[string]*Tab
+	// tabIDs keeps the config order of tabs for capacity reports.
+	tabIDs []string
+}
+
+func NewCatalog(c *Config) (*Catalog, error) {
+	if c == nil {
+		return nil, errors.New("nil inventory config")
+	}
+	x := &Catalog{items: make(map[string]Item, len(c.Items))}
+	for _, i := range c.Items {
+		if i.ID == "" {
+			return nil, errors.New("empty inventory item id")
+		}
+		if _, ok := x.items[i.ID]; ok {
+			return nil, errors.Errorf("duplicate inventory item %q", i.ID)
+		}
+		if i.MaxStack < 0 {
+			return nil, errors.Errorf("negative max stack of item %q", i.ID)
+		}
+		x.items[i.ID] = i
+	}
+	x.tabs = make(map[string]*Tab, len(c.Tabs))
+	for i := range c.Tabs {
+		t := c.Tabs[i]
+		if t.ID == "" {
+			return nil, errors.New("empty inventory tab id")
+		}
+		if _, ok := x.tabs[t.ID]; ok {
+			return nil, errors.Errorf("duplicate inventory tab %q", t.ID)
+		}
+		if t.Slots < 0 {
+			return nil, errors.Errorf("negative slots of tab %q", t.ID)
+		}
+		if len(t.Expansions) > 0 {
+			if t.Slots == 0 {
+				return nil, errors.Errorf("uncapped tab %q has expansions", t.ID)
+			}
+			i, ok := x.items[t.ExpansionItem]
+			if !ok || i.Tab != "" {
+				return nil, errors.Errorf(
+					"tab %q expansion item %q unknown or in a tab",
+					t.ID, t.ExpansionItem)
+			}
+			for _, e := range t.Expansions {
+				if e.Slots <= 0 || e.Price < 0 ||
+					(e.Price > 0) == (e.Currency == "") {
+					return nil, errors.Errorf("invalid expansion of tab %q", t.ID)
+				}
+			}
+			i.MaxStack = int64(len(t.Expansions))
+			x.items[i.ID] = i
+		}
+		x.tabs[t.ID] = &t
+		x.tabIDs = append(x.tabIDs, t.ID)
+	}
+	for _, i := range x.items {
+		if _, ok := x.tabs[i.Tab]; i.Tab != "" && !ok {
+			return nil, errors.Errorf("item %q tab %q unknown", i.ID, i.Tab)
+		}
+	}
+	return x, nil
+}
+
+func NewCatalogJSON(b []byte) (*Catalog, error) {
+	c := new(Config)
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return NewCatalog(c)
+}
+
+func (c *Catalog) Item(id string) (Item, bool) {
+	i, ok := c.items[id]
+	return i, ok
+}
+
+func (c *Catalog) Tab(id string) (*Tab, bool) {
+	t, ok := c.tabs[id]
+	return t, ok
+}
+
+// Resolve computes changes of t against quantities of all stacks of the
+// player, failing the whole transaction when an item would go below zero,
+// above its MaxStack or a tab would run out of slots. Grants that do not
+// fit go to Overflow instead when t allows it. It is meant for Store
+// implementations.
+func (c *Catalog) Resolve(quantities map[string]int64, t *Tx) (*Changes, error) {
+	m := make(map[string]int64, len(quantities)+len(t.Changes))
+	for id, n := range quantities {
+		m[id] = n
+	}
+	for id, n := range t.Expected {
+		if quantities[id] != n {
+			return nil, errors.Wrap(ErrConflict, id)
+		}
+	}
+	overflow := make(map[string]int64)
+	for _, x := range t.Changes {
+		i, ok := c.items[x.ItemID]
+		if !ok {
+			return nil, errors.Wrap(ErrItemUnknown, x.ItemID)
+		}
+		n := m[x.ItemID] + x.Delta
+		if n < 0 {
+			return nil, errors.Wrap(ErrInsufficient, x.ItemID)
+		}
+		// Stacks over a lowered cap may still be consumed.
+		if i.MaxStack > 0 && n > i.MaxStack && x.Delta > 0 {
+			if !t.Overflow {
+				return nil, errors.Wrap(ErrCapExceeded, x.ItemID)
+			}
+			fit := i.MaxStack - m[x.ItemID]
+			if fit < 0 {
+				fit = 0
+			}
+			overflow[x.ItemID] = x.Delta - fit
+			n = m[x.ItemID] + fit
+		}
+		m[x.ItemID] = n
+	}
+	var touched []string
+	for _, tabID := range c.tabIDs {
+		tab := c.tabs[tabID]
+		hit := false
+		var created []string
+		for _, x := range t.Changes {
+			if x.ItemID == tab.ExpansionItem {
+				hit = true
+			}
+			if c.items[x.ItemID].Tab != tabID {
+				continue
+			}
+			hit = true
+			if quantities[x.ItemID] == 0 && m[x.ItemID] > 0 {
+				created = append(created, x.ItemID)
+			}
+		}
+		if !hit {
+			continue
+		}
+		touched = append(touched, tabID)
+		if tab.Slots == 0 || len(created) == 0 {
+			continue
+		}
+		var used int64
+		for id, n := range m {
+			if n > 0 && c.items[id].Tab == tabID {
+				used++
+			}
+		}
+		// Tabs over lowered capacity only refuse new stacks.
+		free := tab.slots(m[tab.ExpansionItem]) - used + int64(len(created))
+		for i := len(created) - 1; int64(i) >= free && i >= 0; i-- {
+			if !t.Overflow {
+				return nil, errors.Wrap(ErrTabFull, tabID)
+			}
+			id := created[i]
+			overflow[id] += m[id]
+			m[id] = 0
+		}
+	}
+	res := &Changes{Changes: make([]*Delta, 0, len(t.Changes))}
+	for _, x := range t.Changes {
+		if d := m[x.ItemID] - quantities[x.ItemID]; d != 0 {
+			res.Changes = append(res.Changes, &Delta{
+				ItemID: x.ItemID, Delta: d, Quantity: m[x.ItemID]})
+		}
+	}
+	for _, x := range t.Changes {
+		if n := overflow[x.ItemID]; n > 0 {
+			res.Overflow = append(res.Overflow, &Stack{ItemID: x.ItemID, Quantity: n})
+		}
+	}
+	res.Capacity = c.capacity(m, touched)
+	return res, nil
+}
+
+// Capacity is the slot usage of a tab. Next is the expansion a player may
+// buy, if any.
+type Capacity struct {
+	Tab        string     `json:"tab"`
+	Used       int64      `json:"used"`
+	Slots      int64      `json:"slots"`
+	Expansions int64      `json:"expansions,omitempty"`
+	Next       *Expansion `json:"next,omitempty"`
+}
+
+// Capacity reports slot usage of every tab with the stacks of a player.
+func (c *Catalog) Capacity(stacks []*Stack) []*Capacity {
+	m := make(map[string]int64, len(stacks))
+	for _, s := range stacks {
+		m[s.ItemID] = s.Quantity
+	}
+	return c.capacity(m, c.tabIDs)
+}
+
+func (c *Catalog) capacity(quantities map[string]int64, tabIDs []string) []*Capacity {
+	a := make([]*Capacity, 0, len(tabIDs))
+	for _, id := range tabIDs {
+		t := c.tabs[id]
+		x := &Capacity{Tab: id, Expansions: quantities[t.ExpansionItem]}
+		x.Slots = t.slots(x.Expansions)
+		if x.Expansions < int64(len(t.Expansions)) {
+			e := t.Expansions[x.Expansions]
+			x.Next = &e
+		}
+		for itemID, n := range quantities {
+			if n > 0 && c.items[itemID].Tab == id {
+				x.Used++
+			}
+		}
+		a = append(a, x)
+	}
+	return a
+}
+
+// Change grants (positive Delta) or consumes (negative Delta) items.
+type Change struct {
+	ItemID string
+	Delta  int64
+}
+
+// Tx is a set of changes applied all at once or not at all, e.g. a craft
+// consuming materials and granting the result. Reason and RefID (e.g. a
+// purchase or quest id) go to the audit log.
+type Tx struct {
+	Reason  string
+	RefID   string
+	Changes []Change
+	At      time.Time
+	// Overflow sends grants over stack caps or tab slots to the Mailer
+	// instead of failing; without a Mailer they fail as usual.
+	Overflow bool
+	// Expected quantities fail the transaction with ErrConflict when the
+	// items are held in other quantities.
+	Expected map[string]int64
+}
+
+func NewTx(reason, refID string) *Tx {
+	return &Tx{Reason: reason, RefID: refID}
+}
+
+func (t *Tx) Grant(itemID string, n int64) *Tx {
+	t.Changes = append(t.Changes, Change{ItemID: itemID, Delta: n})
+	return t
+}
+
+func (t *Tx) Consume(itemID string, n int64) *Tx {
+	t.Changes = append(t.Changes, Change{ItemID: itemID, Delta: -n})
+	return t
+}
+
+// MailOverflow sets Overflow, e.g. for purchases and rewards which must
+// not be lost.
+func (t *Tx) MailOverflow() *Tx {
+	t.Overflow = true
+	return t
+}
+
+func (t *Tx) Expect(itemID string, n int64) *Tx {
+	if t.Expected == nil {
+		t.Expected = make(map[string]int64)
+	}
+	t.Expected[itemID] = n
+	return t
+}
+
+// merged sums changes of the same item, sorted by item id so stores lock
+// rows in the same order.
+func (t *Tx) merged() []Change {
+	m := make(map[string]int64, len(t.Changes))
+	for _, x := range t.Changes {
+		m[x.ItemID] += x.Delta
+	}
+	a := make([]Change, 0, len(m))
+	for id, n := range m {
+		if n != 0 {
+			a = append(a, Change{ItemID: id, Delta: n})
+		}
+	}
+	sort.Slice(a, func(i, j int) bool { return a[i].ItemID < a[j].ItemID })
+	return a
+}
+
+type Stack struct {
+	ItemID   string `json:"itemId"`
+	Quantity int64  `json:"quantity"`
+}
+
+// Delta is a change applied to a stack, Quantity is the resulting one.
+type Delta struct {
+	ItemID   string `json:"itemId"`
+	Delta    int64  `json:"delta"`
+	Quantity int64  `json:"quantity"`
+}
+
+// Changes is the standard payload of handlers changing inventories, the
+// client applies it to its copy of the inventory. Overflow lists items
+// mailed to the player, Capacity the tabs the changes touched.
+type Changes struct {
+	Changes  []*Delta    `json:"changes"`
+	Overflow []*Stack    `json:"overflow,omitempty"`
+	Capacity []*Capacity `json:"capacity,omitempty"`
+}
+
+// LogEntry is an audit log record of a single stack change.
+type LogEntry struct {
+	AccountID uint64
+	ItemID    string
+	Delta     int64
+	Quantity  int64
+	Reason    string
+	RefID     string
+	CreatedAt time.Time
+}
+
+// Store keeps stacks and the audit log. Apply gets merged changes of known
+// items, resolves them with the Catalog and persists the deltas and their
+// log entries atomically.
+type Store interface {
+	Stacks(accountID uint64) ([]*Stack, error)
+	Apply(accountID uint64, t *Tx, c *Catalog) (*Changes, error)
+	Log(accountID uint64, limit int) ([]*LogEntry, error)
+}
+
+// Mailer delivers overflow of a transaction, e.g. as a mail with
+// attachments. It is called after the transaction is stored and again on
+// retries of its job, so it should be idempotent on the account and
+// t.RefID.
+type Mailer interface {
+	Mail(accountID uint64, t *Tx, overflow []*Stack) error
+}
+
+type MailerFunc func(accountID uint64, t *Tx, overflow []*Stack) error
+
+func (fn MailerFunc) Mail(accountID uint64, t *Tx, overflow []*Stack) error {
+	return fn(accountID, t, overflow)
+}
+
+type Inventory struct {
+	Store   Store
+	Catalog *Catalog
+	// Wallet pays for tab expansions, Mailer takes overflow. With Jobs
+	// overflow is delivered by an OverflowJobKind job retried until the
+	// Mailer succeeds, see OverflowJobHandler.
+	Wallet *a5gwallet.Wallet
+	Mailer Mailer
+	Jobs   a5gjobs.Storer
+	Logger a5glogs.Logger
+
+	now func() time.Time
+}
+
+func NewInventory(s Store, c *Catalog, l a5glogs.Logger) (*Inventory, error) {
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if c == nil {
+		return nil, errors.New("catalog missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Inventory{Store: s, Catalog: c, Logger: l, now: time.Now}, nil
+}
+
+// Apply runs a transaction against the inventory of a player and returns
+// the changes to send to the client. Along with ErrOverflowUndelivered it
+// returns the changes stored.
+func (inv *Inventory) Apply(accountID uint64, t *Tx) (*Changes, error) {
+	if t == nil {
+		return nil, errors.New("nil inventory transaction")
+	}
+	if t.Reason == "" {
+		return nil, errors.New("empty inventory transaction reason")
+	}
+	x := *t
+	x.Changes = t.merged()
+	x.Overflow = t.Overflow && inv.Mailer != nil
+	for _, c := range x.Changes {
+		if _, ok := inv.Catalog.Item(c.ItemID); !ok {
+			return nil, errors.Wrap(ErrItemUnknown, c.ItemID)
+		}
+	}
+	if x.At.IsZero() {
+		x.At = inv.now().UTC()
+	}
+	if len(x.Changes) == 0 {
+		return &Changes{Changes: []*Delta{}}, nil
+	}
+	res, err := inv.Store.Apply(accountID, &x, inv.Catalog)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Overflow) == 0 {
+		return res, nil
+	}
+	if err = inv.deliver(accountID, &x, res.Overflow); err != nil {
+		inv.Logger.Error(errors.Wrapf(err,
+			"inventory overflow %v of account %d undelivered", res.Overflow, accountID).
+			Error())
+		return res, errors.Wrap(ErrOverflowUndelivered, err.Error())
+	}
+	return res, nil
+}
+
+// OverflowJobKind is the a5gjobs kind of overflow deliveries.
+const OverflowJobKind = "inventory_overflow"
+
+type overflowPayload struct {
+	AccountID uint64    `json:"accountId"`
+	Reason    string    `json:"reason"`
+	RefID     string    `json:"refId"`
+	At        time.Time `json:"at"`
+	Overflow  []*Stack  `json:"overflow"`
+}
+
+// deliver enqueues a delivery of overflow, mailing it right away when
+// there are no Jobs or the job is not stored.
+func (inv *Inventory) deliver(accountID uint64, t *Tx, overflow []*Stack) error {
+	if inv.Jobs == nil {
+		return inv.Mailer.Mail(accountID, t, overflow)
+	}
+	b, err := json.Marshal(&overflowPayload{
+		AccountID: accountID,
+		Reason:    t.Reason,
+		RefID:     t.RefID,
+		At:        t.At,
+		Overflow:  overflow})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	j, err := a5gjobs.NewJob(OverflowJobKind, b, a5gjobs.PriorityHigh, 10)
+	if err != nil {
+		return err
+	}
+	if err = inv.Jobs.Enqueue(j); err == nil {
+		return nil
+	}
+	inv.Logger.Error(err.Error())
+	return inv.Mailer.Mail(accountID, t, overflow)
+}
+
+// OverflowJobHandler mails overflow of OverflowJobKind jobs, register it
+// on the pool of Jobs. Exhausted jobs stay failed for a5gjobs replays.
+func (inv *Inventory) OverflowJobHandler() a5gjobs.HandlerFunc {
+	return func(ctx context.Context, j *a5gjobs.Job) error {
+		if inv.Mailer == nil {
+			return errors.New("inventory mailer missing")
+		}
+		p := new(overflowPayload)
+		if err := json.Unmarshal(j.Payload, p); err != nil {
+			return errors.WithStack(err)
+		}
+		t := &Tx{Reason: p.Reason, RefID: p.RefID, At: p.At, Overflow: true}
+		return inv.Mailer.Mail(p.AccountID, t, p.Overflow)
+	}
+}
+
+func (inv *Inventory) Stacks(accountID uint64) ([]*Stack, error) {
+	return inv.Store.Stacks(accountID)
+}
+
+// ExpansionReason is the reason of expansion transactions.
+const ExpansionReason = "inventory_expansion"
+
+// ExpansionResult is the payload of expansion purchases.
+type ExpansionResult struct {
+	Wallet    *a5gwallet.Result `json:"wallet,omitempty"`
+	Inventory *Changes          `json:"inventory"`
+}
+
+// Expand buys the next expansion of a tab. The wallet transaction id
+// names the expansion, so retries after a failed grant do not charge
+// twice.
+func (inv *Inventory) Expand(accountID uint64, tabID string) (
+	*ExpansionResult, error) {
+	t, ok := inv.Catalog.Tab(tabID)
+	if !ok {
+		return nil, errors.Wrap(ErrTabUnknown, tabID)
+	}
+	stacks, err := inv.Stacks(accountID)
+	if err != nil {
+		return nil, err
+	}
+	var n int64
+	for _, s := range stacks {
+		if s.ItemID == t.ExpansionItem {
+			n = s.Quantity
+		}
+	}
+	if n >= int64(len(t.Expansions)) {
+		return nil, errors.Wrap(ErrExpansionsExhausted, tabID)
+	}
+	e := t.Expansions[n]
+	ref := strconv.FormatUint(accountID, 10) + ":" + tabID + ":" +
+		strconv.FormatInt(n+1, 10)
+	res := new(ExpansionResult)
+	if e.Price > 0 {
+		if inv.Wallet == nil {
+			return nil, errors.New("wallet missing")
+		}
+		res.Wallet, err = inv.Wallet.Debit(accountID, "inventory:"+ref,
+			"shop", ExpansionReason, e.Currency, e.Price)
+		if err != nil {
+			return nil, err
+		}
+	}
+	res.Inventory, err = inv.Apply(accountID, NewTx(ExpansionReason, ref).
+		Expect(t.ExpansionItem, n).Grant(t.ExpansionItem, 1))
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,240 @@
+package a5ginventory
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5gjobs"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestInventoryApply(t *testing.T) {
+	c, err := NewCatalogJSON([]byte(`{"items": [
+		{"id": "gold"}, {"id": "wood", "maxStack": 10}, {"id": "sword"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		tx       *Tx
+		err      error
+		expected []Delta
+		stacks   []Stack
+	}{
+		{"grant", NewTx("quest", "q1").Grant("wood", 8).Grant("gold", 5), nil,
+			[]Delta{{"gold", 5, 5}, {"wood", 8, 8}},
+			[]Stack{{"gold", 5}, {"wood", 8}}},
+		{"over cap", NewTx("quest", "q2").Grant("wood", 3), ErrCapExceeded,
+			nil, []Stack{{"gold", 5}, {"wood", 8}}},
+		{"all or nothing", NewTx("craft", "").
+			Consume("wood", 4).Consume("gold", 6).Grant("sword", 1),
+			ErrInsufficient, nil, []Stack{{"gold", 5}, {"wood", 8}}},
+		{"craft", NewTx("craft", "").
+			Consume("wood", 4).Consume("gold", 5).Grant("sword", 1), nil,
+			[]Delta{{"gold", -5, 0}, {"sword", 1, 1}, {"wood", -4, 4}},
+			[]Stack{{"sword", 1}, {"wood", 4}}},
+		{"merged", NewTx("trade", "").Grant("wood", 6).Consume("wood", 2), nil,
+			[]Delta{{"wood", 4, 8}}, []Stack{{"sword", 1}, {"wood", 8}}},
+		{"unknown item", NewTx("quest", "").Grant("axe", 1), ErrItemUnknown,
+			nil, []Stack{{"sword", 1}, {"wood", 8}}},
+	}
+	inv, err := NewInventory(
+		NewMemoryStore(), c, a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		res, err := inv.Apply(1, test.tx)
+		if errors.Cause(err) != test.err {
+			t.Fatalf("%s: unexpected error %v", test.name, err)
+		}
+		var deltas []Delta
+		if res != nil {
+			for _, d := range res.Changes {
+				deltas = append(deltas, *d)
+			}
+		}
+		if !reflect.DeepEqual(deltas, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, deltas)
+		}
+		a, err := inv.Stacks(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var stacks []Stack
+		for _, s := range a {
+			stacks = append(stacks, *s)
+		}
+		if !reflect.DeepEqual(stacks, test.stacks) {
+			t.Errorf("%s: expected stacks %v, got %v",
+				test.name, test.stacks, stacks)
+		}
+	}
+	l, err := inv.Store.Log(1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l) != 6 || l[0].Reason != "trade" || l[5].RefID != "q1" {
+		t.Errorf("unexpected audit log %v", l)
+	}
+}
+
+func TestInventoryTabs(t *testing.T) {
+	c, err := NewCatalogJSON([]byte(`{
+		"items": [{"id": "gold"}, {"id": "gear_slots"},
+			{"id": "axe", "tab": "gear"}, {"id": "bow", "tab": "gear"},
+			{"id": "shield", "tab": "gear"}, {"id": "sword", "tab": "gear"}],
+		"tabs": [{"id": "gear", "slots": 2, "expansionItem": "gear_slots",
+			"expansions": [
+				{"slots": 1, "currency": "soft", "price": 100},
+				{"slots": 2, "currency": "soft", "price": 300}]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	inv, err := NewInventory(NewMemoryStore(), c, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	currencies, _ := a5gwallet.NewCurrencies(a5gwallet.Currency{ID: "soft"})
+	inv.Wallet, _ = a5gwallet.NewWallet(a5gwallet.NewMemoryStore(), currencies, l)
+	if _, err = inv.Wallet.Credit(1, "seed", "rewards", "test", "soft", 150); err != nil {
+		t.Fatal(err)
+	}
+	var mailed []Stack
+	inv.Mailer = MailerFunc(func(accountID uint64, t *Tx, overflow []*Stack) error {
+		for _, s := range overflow {
+			mailed = append(mailed, *s)
+		}
+		return nil
+	})
+	apply := func(t *Tx) func() (*Changes, error) {
+		return func() (*Changes, error) { return inv.Apply(1, t) }
+	}
+	expand := func() (*Changes, error) {
+		res, err := inv.Expand(1, "gear")
+		if err != nil {
+			return nil, err
+		}
+		return res.Inventory, nil
+	}
+	tests := []struct {
+		name     string
+		fn       func() (*Changes, error)
+		err      error
+		capacity Capacity
+		mailed   int
+	}{
+		{"fill", apply(NewTx("quest", "q1").Grant("sword", 1).Grant("axe", 1)),
+			nil, Capacity{"gear", 2, 2, 0, &Expansion{1, "soft", 100}}, 0},
+		{"full", apply(NewTx("quest", "q2").Grant("bow", 1)), ErrTabFull,
+			Capacity{}, 0},
+		{"existing stack", apply(NewTx("quest", "q3").Grant("axe", 1)),
+			nil, Capacity{"gear", 2, 2, 0, &Expansion{1, "soft", 100}}, 0},
+		{"overflow", apply(NewTx("quest", "q4").
+			Grant("bow", 1).Grant("shield", 2).Grant("gold", 5).MailOverflow()),
+			nil, Capacity{"gear", 2, 2, 0, &Expansion{1, "soft", 100}}, 2},
+		{"expand", expand,
+			nil, Capacity{"gear", 2, 3, 1, &Expansion{2, "soft", 300}}, 2},
+		{"insufficient funds", expand, a5gwallet.ErrInsufficientFunds,
+			Capacity{}, 2},
+		{"expanded", apply(NewTx("quest", "q5").Grant("bow", 1)),
+			nil, Capacity{"gear", 3, 3, 1, &Expansion{2, "soft", 300}}, 2},
+	}
+	for _, test := range tests {
+		res, err := test.fn()
+		if errors.Cause(err) != test.err {
+			t.Fatalf("%s: unexpected error %v", test.name, err)
+		}
+		if res != nil && (len(res.Capacity) != 1 ||
+			!reflect.DeepEqual(*res.Capacity[0], test.capacity)) {
+			t.Errorf("%s: unexpected capacity %+v", test.name, res.Capacity)
+		}
+		if len(mailed) != test.mailed {
+			t.Errorf("%s: unexpected mail %v", test.name, mailed)
+		}
+	}
+	if !reflect.DeepEqual(mailed, []Stack{{"bow", 1}, {"shield", 2}}) {
+		t.Errorf("unexpected overflow %v", mailed)
+	}
+	stacks, err := inv.Stacks(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := c.Capacity(stacks)
+	if len(a) != 1 || a[0].Used != 3 || a[0].Slots != 3 {
+		t.Errorf("unexpected capacity %+v", a)
+	}
+}
+
+type failingJobs struct{ a5gjobs.Storer }
+
+func (failingJobs) Enqueue(*a5gjobs.Job) error { return errors.New("jobs down") }
+
+func TestInventoryOverflow(t *testing.T) {
+	c, err := NewCatalogJSON([]byte(`{"items": [{"id": "wood", "maxStack": 10}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv, err := NewInventory(NewMemoryStore(), c, a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mailed []Stack
+	mailErr := errors.New("mail down")
+	inv.Mailer = MailerFunc(func(accountID uint64, t *Tx, overflow []*Stack) error {
+		if mailErr != nil {
+			return mailErr
+		}
+		for _, s := range overflow {
+			mailed = append(mailed, *s)
+		}
+		return nil
+	})
+	jobs := a5gjobs.NewMemoryStore()
+	inv.Jobs = jobs
+
+	// A failing mailer leaves the delivery to the job.
+	res, err := inv.Apply(1, NewTx("quest", "q1").Grant("wood", 12).MailOverflow())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Overflow) != 1 || len(mailed) != 0 {
+		t.Errorf("unexpected overflow %+v, mailed %v", res.Overflow, mailed)
+	}
+	j, err := jobs.Acquire(time.Now().Add(time.Second), time.Minute)
+	if err != nil || j == nil || j.Kind != OverflowJobKind {
+		t.Fatalf("Acquire() => %+v, %v", j, err)
+	}
+	h := inv.OverflowJobHandler()
+	if err = h(context.Background(), j); errors.Cause(err) != mailErr {
+		t.Errorf("job => %v want %v", err, mailErr)
+	}
+	mailErr = nil
+	if err = h(context.Background(), j); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(mailed, []Stack{{"wood", 2}}) {
+		t.Errorf("unexpected mail %v", mailed)
+	}
+
+	// Without stored jobs it is mailed right away, failing that is
+	// reported along with the stored changes.
+	inv.Jobs = failingJobs{jobs}
+	if _, err = inv.Apply(1, NewTx("quest", "q2").Grant("wood", 1).MailOverflow()); err != nil {
+		t.Fatal(err)
+	}
+	if len(mailed) != 2 {
+		t.Errorf("unexpected mail %v", mailed)
+	}
+	mailErr = errors.New("mail down")
+	res, err = inv.Apply(1, NewTx("quest", "q3").Grant("wood", 3).MailOverflow())
+	if errors.Cause(err) != ErrOverflowUndelivered || res == nil || len(res.Overflow) != 1 {
+		t.Errorf("Apply() => %+v, %v want %v", res, err, ErrOverflowUndelivered)
+	}
+}
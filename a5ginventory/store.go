@@ -0,0 +1,238 @@
+package a5ginventory
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryStore struct {
+	mu     sync.Mutex
+	stacks map[uint64]map[string]int64
+	log    map[uint64][]*LogEntry
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{
+		stacks: make(map[uint64]map[string]int64),
+		log:    make(map[uint64][]*LogEntry)}
+}
+
+func (s *memoryStore) Stacks(accountID uint64) ([]*Stack, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := make([]*Stack, 0, len(s.stacks[accountID]))
+	for id, n := range s.stacks[accountID] {
+		a = append(a, &Stack{ItemID: id, Quantity: n})
+	}
+	sort.Slice(a, func(i, j int) bool { return a[i].ItemID < a[j].ItemID })
+	return a, nil
+}
+
+func (s *memoryStore) Apply(
+	accountID uint64, t *Tx, c *Catalog) (*Changes, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.stacks[accountID]
+	res, err := c.Resolve(m, t)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		m = make(map[string]int64)
+		s.stacks[accountID] = m
+	}
+	for _, d := range res.Changes {
+		if d.Quantity == 0 {
+			delete(m, d.ItemID)
+		} else {
+			m[d.ItemID] = d.Quantity
+		}
+		s.log[accountID] = append(s.log[accountID], newLogEntry(accountID, t, d))
+	}
+	return res, nil
+}
+
+func (s *memoryStore) Log(accountID uint64, limit int) ([]*LogEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l := s.log[accountID]
+	a := make([]*LogEntry, 0, len(l))
+	for i := len(l) - 1; i >= 0 && (limit <= 0 || len(a) < limit); i-- {
+		x := *l[i]
+		a = append(a, &x)
+	}
+	return a, nil
+}
+
+func newLogEntry(accountID uint64, t *Tx, d *Delta) *LogEntry {
+	return &LogEntry{
+		AccountID: accountID,
+		ItemID:    d.ItemID,
+		Delta:     d.Delta,
+		Quantity:  d.Quantity,
+		Reason:    t.Reason,
+		RefID:     t.RefID,
+		CreatedAt: t.At}
+}
+
+// dbStore keeps stacks and the audit log in MySQL tables:
+//
+//	CREATE TABLE inventory_stacks (
+//	  account_id BIGINT UNSIGNED NOT NULL,
+//	  item_id VARCHAR(64) NOT NULL,
+//	  quantity BIGINT NOT NULL,
+//	  PRIMARY KEY (account_id, item_id));
+//
+//	CREATE TABLE inventory_log (
+//	  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+//	  account_id BIGINT UNSIGNED NOT NULL,
+//	  item_id VARCHAR(64) NOT NULL,
+//	  delta BIGINT NOT NULL,
+//	  quantity BIGINT NOT NULL,
+//	  reason VARCHAR(64) NOT NULL,
+//	  ref_id VARCHAR(191) NOT NULL,
+//	  created_at DATETIME NOT NULL,
+//	  KEY account_id (account_id, id));
+type dbStore struct {
+	pooler          a5gdb.Pooler
+	stacksTableName string
+	logTableName    string
+}
+
+type dbStack struct {
+	ItemID   string `db:"item_id"`
+	Quantity int64  `db:"quantity"`
+}
+
+type dbLogEntry struct {
+	AccountID uint64    `db:"account_id"`
+	ItemID    string    `db:"item_id"`
+	Delta     int64     `db:"delta"`
+	Quantity  int64     `db:"quantity"`
+	Reason    string    `db:"reason"`
+	RefID     string    `db:"ref_id"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+var logColumns = []string{
+	"account_id", "item_id", "delta", "quantity",
+	"reason", "ref_id", "created_at"}
+
+func NewDBStore(
+	p a5gdb.Pooler, stacksTableName, logTableName string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if stacksTableName == "" {
+		return nil, errors.New("empty inventory stacks table name")
+	}
+	if logTableName == "" {
+		return nil, errors.New("empty inventory log table name")
+	}
+	return &dbStore{
+		pooler:          p,
+		stacksTableName: stacksTableName,
+		logTableName:    logTableName}, nil
+}
+
+func (s *dbStore) Stacks(accountID uint64) ([]*Stack, error) {
+	var a []*dbStack
+	_, err := s.pooler.ReadPool().NewSession().
+		Select("item_id", "quantity").From(s.stacksTableName).
+		Where(dbr.Eq("account_id", accountID)).
+		Where(dbr.Gt("quantity", 0)).
+		OrderAsc("item_id").Load(&a)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	stacks := make([]*Stack, len(a))
+	for i, x := range a {
+		stacks[i] = &Stack{ItemID: x.ItemID, Quantity: x.Quantity}
+	}
+	return stacks, nil
+}
+
+// Apply locks the stacks of the player, so concurrent transactions of the
+// same player are serialized; all of them are needed to count tab slots.
+func (s *dbStore) Apply(
+	accountID uint64, t *Tx, c *Catalog) (*Changes, error) {
+	tx, err := s.pooler.WritePool().NewSession().Begin()
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*Session).Begin fn")
+	}
+	defer tx.RollbackUnlessCommitted()
+	var a []*dbStack
+	_, err = tx.Select("item_id", "quantity").From(s.stacksTableName).
+		Where(dbr.Eq("account_id", accountID)).
+		Suffix("FOR UPDATE").Load(&a)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	m := make(map[string]int64, len(a))
+	for _, x := range a {
+		m[x.ItemID] = x.Quantity
+	}
+	res, err := c.Resolve(m, t)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Changes) == 0 {
+		return res, nil
+	}
+	stmt := tx.InsertInto(s.logTableName).Columns(logColumns...)
+	for _, d := range res.Changes {
+		_, err = tx.InsertBySql("INSERT INTO "+s.stacksTableName+
+			" (account_id, item_id, quantity) VALUES (?, ?, ?)"+
+			" ON DUPLICATE KEY UPDATE quantity = VALUES(quantity)",
+			accountID, d.ItemID, d.Quantity).Exec()
+		if err != nil {
+			return nil, errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+		}
+		e := newLogEntry(accountID, t, d)
+		stmt.Record(&dbLogEntry{
+			AccountID: e.AccountID,
+			ItemID:    e.ItemID,
+			Delta:     e.Delta,
+			Quantity:  e.Quantity,
+			Reason:    e.Reason,
+			RefID:     e.RefID,
+			CreatedAt: e.CreatedAt})
+	}
+	if _, err = stmt.Exec(); err != nil {
+		return nil, errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "dbr.(*Tx).Commit fn")
+	}
+	return res, nil
+}
+
+func (s *dbStore) Log(accountID uint64, limit int) ([]*LogEntry, error) {
+	stmt := s.pooler.ReadPool().NewSession().
+		Select(logColumns...).From(s.logTableName).
+		Where(dbr.Eq("account_id", accountID)).OrderDesc("id")
+	if limit > 0 {
+		stmt.Limit(uint64(limit))
+	}
+	var a []*dbLogEntry
+	if _, err := stmt.Load(&a); err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	l := make([]*LogEntry, len(a))
+	for i, x := range a {
+		l[i] = &LogEntry{
+			AccountID: x.AccountID,
+			ItemID:    x.ItemID,
+			Delta:     x.Delta,
+			Quantity:  x.Quantity,
+			Reason:    x.Reason,
+			RefID:     x.RefID,
+			CreatedAt: x.CreatedAt}
+	}
+	return l, nil
+}
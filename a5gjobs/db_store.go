@@ -0,0 +1,222 @@
+package a5gjobs
+
+import (
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+// dbStore keeps jobs in a MySQL table:
+//
+//	CREATE TABLE jobs (
+//	  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+//	  kind VARCHAR(64) NOT NULL,
+//	  payload BLOB,
+//	  priority INT NOT NULL,
+//	  status VARCHAR(16) NOT NULL,
+//	  attempts INT NOT NULL,
+//	  max_attempts INT NOT NULL,
+//	  run_at DATETIME NOT NULL,
+//	  last_error TEXT,
+//	  locked_until DATETIME NULL,
+//	  KEY status_run_at (status, run_at),
+//	  KEY status_locked_until (status, locked_until));
+type dbStore struct {
+	pooler    a5gdb.Pooler
+	tableName string
+}
+
+var jobColumns = []string{
+	"kind", "payload", "priority", "status",
+	"attempts", "max_attempts", "run_at", "last_error"}
+
+func NewDBStore(p a5gdb.Pooler, tableName string) (Storer, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if tableName == "" {
+		return nil, errors.New("empty jobs table name")
+	}
+	return &dbStore{pooler: p, tableName: tableName}, nil
+}
+
+func (s *dbStore) Enqueue(j *Job) error {
+	if j == nil {
+		return errors.New("nil job")
+	}
+	j.Status = StatusPending
+	_, err := s.pooler.WritePool().NewSession().
+		InsertInto(s.tableName).Columns(jobColumns...).Record(j).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	return nil
+}
+
+// Acquire skips rows other workers have locked instead of waiting for
+// them, which needs MySQL 8.0.
+func (s *dbStore) Acquire(now time.Time, lease time.Duration) (*Job, error) {
+	tx, err := s.pooler.WritePool().NewSession().Begin()
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*Session).Begin fn")
+	}
+	defer tx.RollbackUnlessCommitted()
+	j := new(Job)
+	err = tx.Select(append([]string{"id"}, jobColumns...)...).
+		From(s.tableName).
+		Where(dbr.Or(
+			dbr.And(
+				dbr.Eq("status", []string{
+					StatusPending.String(), StatusRetrying.String()}),
+				dbr.Lte("run_at", now)),
+			dbr.And(
+				dbr.Eq("status", StatusRunning.String()),
+				dbr.Lte("locked_until", now)))).
+		OrderDesc("priority").OrderAsc("run_at").OrderAsc("id").
+		Limit(1).Suffix("FOR UPDATE SKIP LOCKED").LoadOne(j)
+	if err == dbr.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	j.Status = StatusRunning
+	j.Attempts++
+	_, err = tx.Update(s.tableName).
+		Set("status", j.Status).
+		Set("attempts", j.Attempts).
+		Set("locked_until", now.Add(lease)).
+		Where(dbr.Eq("id", j.ID)).Exec()
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*UpdateStmt).Exec fn")
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "dbr.(*Tx).Commit fn")
+	}
+	return j, nil
+}
+
+func (s *dbStore) Complete(j *Job) error {
+	return s.set(j, StatusDone, time.Time{})
+}
+
+func (s *dbStore) Retry(j *Job, runAt time.Time) error {
+	return s.set(j, StatusRetrying, runAt)
+}
+
+func (s *dbStore) Fail(j *Job) error {
+	return s.set(j, StatusFailed, time.Time{})
+}
+
+func (s *dbStore) set(j *Job, status Status, runAt time.Time) error {
+	if j == nil {
+		return errors.New("nil job")
+	}
+	stmt := s.pooler.WritePool().NewSession().Update(s.tableName).
+		Set("status", status).
+		Set("last_error", j.LastErr).
+		Set("locked_until", nil).
+		Where(dbr.Eq("id", j.ID)).
+		Where(dbr.Eq("status", StatusRunning.String())).
+		Where(dbr.Eq("attempts", j.Attempts))
+	if !runAt.IsZero() {
+		stmt.Set("run_at", runAt)
+	}
+	res, err := stmt.Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*UpdateStmt).Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	if n == 0 {
+		return errors.Wrapf(ErrLeaseLost, "job %d attempt %d", j.ID, j.Attempts)
+	}
+	return nil
+}
+
+func (s *dbStore) Get(id int64) (*Job, error) {
+	j := new(Job)
+	err := s.pooler.ReadPool().NewSession().
+		Select(append([]string{"id"}, jobColumns...)...).From(s.tableName).
+		Where(dbr.Eq("id", id)).LoadOne(j)
+	if err == dbr.ErrNotFound {
+		return nil, errors.Wrapf(ErrJobUnknown, "job %d", id)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	return j, nil
+}
+
+func (s *dbStore) Failed(kind string, afterID int64, limit int) (
+	[]*Job, error) {
+	stmt := s.pooler.ReadPool().NewSession().
+		Select(append([]string{"id"}, jobColumns...)...).From(s.tableName).
+		Where(dbr.Eq("status", StatusFailed.String())).
+		Where(dbr.Gt("id", afterID)).OrderAsc("id")
+	if kind != "" {
+		stmt.Where(dbr.Eq("kind", kind))
+	}
+	if limit > 0 {
+		stmt.Limit(uint64(limit))
+	}
+	var a []*Job
+	if _, err := stmt.Load(&a); err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	return a, nil
+}
+
+// Replay tells an unknown job from a job which is not failed only when
+// the update misses, which is the rare case.
+func (s *dbStore) Replay(id int64, payload []byte, runAt time.Time) error {
+	stmt := s.pooler.WritePool().NewSession().Update(s.tableName).
+		Set("status", StatusPending).
+		Set("attempts", 0).
+		Set("run_at", runAt).
+		Where(dbr.Eq("id", id)).
+		Where(dbr.Eq("status", StatusFailed.String()))
+	if payload != nil {
+		stmt.Set("payload", payload)
+	}
+	res, err := stmt.Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*UpdateStmt).Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	if n == 1 {
+		return nil
+	}
+	j, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	return errors.Wrapf(ErrJobNotFailed, "job %d is %s", id, j.Status)
+}
+
+func (s *dbStore) ReplayFailed(kind string, runAt time.Time) (int64, error) {
+	if kind == "" {
+		return 0, errors.WithStack(ErrJobKindEmpty)
+	}
+	res, err := s.pooler.WritePool().NewSession().Update(s.tableName).
+		Set("status", StatusPending).
+		Set("attempts", 0).
+		Set("run_at", runAt).
+		Where(dbr.Eq("status", StatusFailed.String())).
+		Where(dbr.Eq("kind", kind)).Exec()
+	if err != nil {
+		return 0, errors.Wrap(err, "dbr.(*UpdateStmt).Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	return n, nil
+}
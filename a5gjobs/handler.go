@@ -0,0 +1,149 @@
+package a5gjobs
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCodeJobUnknown = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4053,
+		Name:     "job_unknown",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "job not found"})
+
+	ErrCodeJobNotFailed = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4243,
+		Name:     "job_not_failed",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "only failed jobs can be replayed"})
+)
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeJobUnknown, http.StatusNotFound)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeJobNotFailed, http.StatusUnprocessableEntity)
+}
+
+// FailedRequest pages through failed jobs, the next page starts after
+// the last ID of the previous one.
+type FailedRequest struct {
+	Kind    string `json:"kind"`
+	AfterID int64  `json:"afterId"`
+	Limit   int    `json:"limit" validate:"min=0,max=500"`
+}
+
+type FailedResponse struct {
+	Jobs []*Job `json:"jobs"`
+}
+
+type JobRequest struct {
+	JobID int64 `json:"jobId" validate:"required"`
+}
+
+// ReplayRequest re-drives a failed job. Payload, when set, replaces the
+// job payload and is base64 encoded like the one of Job.
+type ReplayRequest struct {
+	JobID   int64  `json:"jobId" validate:"required"`
+	Payload []byte `json:"payload"`
+}
+
+type ReplayFailedRequest struct {
+	Kind string `json:"kind" validate:"required"`
+}
+
+type ReplayFailedResponse struct {
+	Replayed int64 `json:"replayed"`
+}
+
+// FailedHandler lists dead letters, mount it on an admin route class.
+func (p *Pool) FailedHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(FailedRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			r := req.Payload.(*FailedRequest)
+			limit := r.Limit
+			if limit == 0 {
+				limit = 100
+			}
+			jobs, err := p.Store.Failed(r.Kind, r.AfterID, limit)
+			if err != nil {
+				return nil, p.apiErrs(err)
+			}
+			if jobs == nil {
+				jobs = []*Job{}
+			}
+			return &FailedResponse{Jobs: jobs}, nil
+		})
+}
+
+// JobHandler answers with a job including its last error, mount it on an
+// admin route class.
+func (p *Pool) JobHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(JobRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			j, err := p.Store.Get(req.Payload.(*JobRequest).JobID)
+			if err != nil {
+				return nil, p.apiErrs(err)
+			}
+			return j, nil
+		})
+}
+
+// ReplayHandler re-drives a failed job and answers with it, mount it on
+// an admin route class.
+func (p *Pool) ReplayHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(ReplayRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			r := req.Payload.(*ReplayRequest)
+			err := p.Store.Replay(r.JobID, r.Payload, time.Now().UTC())
+			if err != nil {
+				return nil, p.apiErrs(err)
+			}
+			j, err := p.Store.Get(r.JobID)
+			if err != nil {
+				return nil, p.apiErrs(err)
+			}
+			return j, nil
+		})
+}
+
+// ReplayFailedHandler re-drives every failed job of a kind, mount it on
+// an admin route class.
+func (p *Pool) ReplayFailedHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(ReplayFailedRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			n, err := p.Store.ReplayFailed(
+				req.Payload.(*ReplayFailedRequest).Kind, time.Now().UTC())
+			if err != nil {
+				return nil, p.apiErrs(err)
+			}
+			return &ReplayFailedResponse{Replayed: n}, nil
+		})
+}
+
+func (p *Pool) apiErrs(err error) []*a5gapi.APIErr {
+	switch errors.Cause(err) {
+	case ErrJobUnknown:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeJobUnknown, "")}
+	case ErrJobNotFailed:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeJobNotFailed, "")}
+	}
+	p.Logger.Error(err.Error())
+	return a5gapi.NewJSONMsgDefautlErrors(err)
+}
@@ -0,0 +1,94 @@
+package a5gjobs
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrJobKindEmpty = errors.New("empty job kind")
+	// ErrLeaseLost is returned when the outcome of a job is stored by a
+	// worker whose lease expired and the job was acquired again.
+	ErrLeaseLost  = errors.New("job lease lost")
+	ErrJobUnknown = errors.New("job unknown")
+	// ErrJobNotFailed is returned when replaying a job which is not dead.
+	ErrJobNotFailed = errors.New("job not failed")
+)
+
+type Priority int
+
+const (
+	PriorityLow Priority = iota - 1
+	PriorityNormal
+	PriorityHigh
+)
+
+type Status string
+
+const (
+	StatusPending  Status = "pending"
+	StatusRunning  Status = "running"
+	StatusDone     Status = "done"
+	StatusFailed   Status = "failed"
+	StatusRetrying Status = "retrying"
+)
+
+func (s Status) String() string { return string(s) }
+
+// Job is an unit of deferred work. Payload is opaque to the queue and
+// decoded by the handler registered for Kind.
+type Job struct {
+	ID          int64     `json:"id" db:"id"`
+	Kind        string    `json:"kind" db:"kind"`
+	Payload     []byte    `json:"payload,omitempty" db:"payload"`
+	Priority    Priority  `json:"priority" db:"priority"`
+	Status      Status    `json:"status" db:"status"`
+	Attempts    int       `json:"attempts" db:"attempts"`
+	MaxAttempts int       `json:"maxAttempts" db:"max_attempts"`
+	RunAt       time.Time `json:"runAt" db:"run_at"`
+	LastErr     string    `json:"lastError,omitempty" db:"last_error"`
+}
+
+// NewJob makes a job which is due immediately. Use RunAt to schedule it.
+func NewJob(kind string, payload []byte, p Priority, maxAttempts int) (
+	*Job, error) {
+	if kind == "" {
+		return nil, errors.WithStack(ErrJobKindEmpty)
+	}
+	if maxAttempts < 1 {
+		return nil, errors.New("unexpected job max attempts")
+	}
+	return &Job{
+		Kind:        kind,
+		Payload:     payload,
+		Priority:    p,
+		Status:      StatusPending,
+		MaxAttempts: maxAttempts,
+		RunAt:       time.Now().UTC()}, nil
+}
+
+func (j *Job) IsExhausted() bool { return j.Attempts >= j.MaxAttempts }
+
+// Backoff is an exponential retry delay: Base*2^(attempt-1) limited by Max.
+type Backoff struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+func (b Backoff) Duration(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	d := b.Base
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if b.Max > 0 && d >= b.Max {
+			return b.Max
+		}
+	}
+	if b.Max > 0 && d > b.Max {
+		return b.Max
+	}
+	return d
+}
@@ -0,0 +1,202 @@
+package a5gjobs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+type HandlerFunc func(context.Context, *Job) error
+
+// Pool polls a Storer and runs due jobs on a fixed number of workers. It
+// is an a5gapp.Module. Lease must exceed the longest handler run, jobs
+// held longer may be acquired by another worker.
+type Pool struct {
+	Store        Storer
+	Logger       a5glogs.Logger
+	Backoff      Backoff
+	PollInterval time.Duration
+	Workers      int
+	Lease        time.Duration
+
+	mu       sync.RWMutex
+	handlers map[string]HandlerFunc
+	quit     chan struct{}
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+func NewPool(s Storer, l a5glogs.Logger) (*Pool, error) {
+	if s == nil {
+		return nil, errors.New("job store missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Pool{
+		Store:        s,
+		Logger:       l,
+		Backoff:      Backoff{Base: time.Second, Max: time.Hour},
+		PollInterval: time.Second,
+		Workers:      1,
+		Lease:        10 * time.Minute,
+		handlers:     make(map[string]HandlerFunc)}, nil
+}
+
+func (p *Pool) Handle(kind string, fn HandlerFunc) error {
+	if kind == "" {
+		return errors.WithStack(ErrJobKindEmpty)
+	}
+	if fn == nil {
+		return errors.New("nil job handler")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.handlers[kind]; ok {
+		return errors.Errorf("job handler %q already registered", kind)
+	}
+	p.handlers[kind] = fn
+	return nil
+}
+
+func (p *Pool) Name() string { return "jobs" }
+
+// Start runs Workers until Stop is called.
+func (p *Pool) Start(context.Context) error {
+	if p.Workers < 1 {
+		return errors.New("unexpected workers count")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.quit != nil {
+		return errors.New("job pool already started")
+	}
+	// Handlers get ctx which outlives Start's one and is only cancelled
+	// when Stop gives up waiting for them.
+	var ctx context.Context
+	ctx, p.cancel = context.WithCancel(context.Background())
+	p.quit = make(chan struct{})
+	for i := 0; i < p.Workers; i++ {
+		p.wg.Add(1)
+		go p.work(ctx, p.quit)
+	}
+	return nil
+}
+
+// Stop stops polling and waits for workers to finish their current jobs.
+// When ctx is done first, ctx of the running handlers is cancelled.
+func (p *Pool) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	quit, cancel := p.quit, p.cancel
+	p.quit, p.cancel = nil, nil
+	p.mu.Unlock()
+	if quit == nil {
+		return nil
+	}
+	close(quit)
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		cancel()
+		return nil
+	case <-ctx.Done():
+		cancel()
+		return errors.WithStack(ctx.Err())
+	}
+}
+
+func (p *Pool) work(ctx context.Context, quit chan struct{}) {
+	defer p.wg.Done()
+	t := time.NewTicker(p.PollInterval)
+	defer t.Stop()
+	for {
+		for p.runOne(ctx) {
+			select {
+			case <-quit:
+				return
+			default:
+			}
+		}
+		select {
+		case <-quit:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// runOne reports whether a job was taken so the worker can drain the queue
+// without waiting for the next tick.
+func (p *Pool) runOne(ctx context.Context) bool {
+	j, err := p.Store.Acquire(time.Now().UTC(), p.Lease)
+	if err != nil {
+		p.Logger.Error(err.Error())
+		return false
+	}
+	if j == nil {
+		return false
+	}
+	l := p.Logger.With(
+		a5gfields.Int64("jobID", j.ID),
+		a5gfields.String("jobKind", j.Kind),
+		a5gfields.Int("jobAttempt", j.Attempts))
+	// A lease expired during the last attempt, e.g. the worker crashed.
+	if j.Attempts > j.MaxAttempts {
+		j.LastErr = "job lease expired"
+		l.Error(j.LastErr)
+		p.stored(l, p.Store.Fail(j))
+		return true
+	}
+	p.mu.RLock()
+	fn, ok := p.handlers[j.Kind]
+	p.mu.RUnlock()
+	if !ok {
+		err = errors.Errorf("unknown job kind %q", j.Kind)
+	} else {
+		err = p.call(ctx, fn, j)
+	}
+	if err == nil {
+		p.stored(l, p.Store.Complete(j))
+		return true
+	}
+	j.LastErr = err.Error()
+	if j.IsExhausted() {
+		l.Error(err.Error())
+		err = p.Store.Fail(j)
+	} else {
+		l.Warn(err.Error())
+		err = p.Store.Retry(j, time.Now().UTC().Add(p.Backoff.Duration(j.Attempts)))
+	}
+	p.stored(l, err)
+	return true
+}
+
+// stored logs a failure to store the outcome of a job. A lost lease means
+// the handler outran Lease and another worker runs the job again.
+func (p *Pool) stored(l a5glogs.Logger, err error) {
+	if err == nil {
+		return
+	}
+	if errors.Cause(err) == ErrLeaseLost {
+		l.Warn(err.Error())
+		return
+	}
+	l.Error(err.Error())
+}
+
+func (p *Pool) call(ctx context.Context, fn HandlerFunc, j *Job) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = errors.Errorf("job handler panic: %v", v)
+		}
+	}()
+	return fn(ctx, j)
+}
@@ -0,0 +1,57 @@
+package a5gjobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/sirupsen/logrus"
+)
+
+func TestPoolStop(t *testing.T) {
+	var a = []struct {
+		name     string
+		timeout  time.Duration
+		canceled bool
+	}{
+		{"finished", time.Second, false},
+		{"timed out", 50 * time.Millisecond, true},
+	}
+	for _, v := range a {
+		s := NewMemoryStore()
+		p, err := NewPool(s, a5glogs.NewLogrusWrapper(logrus.New()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.PollInterval = 10 * time.Millisecond
+		started, canceled := make(chan struct{}), make(chan bool, 1)
+		err = p.Handle("slow", func(ctx context.Context, j *Job) error {
+			close(started)
+			select {
+			case <-ctx.Done():
+				canceled <- true
+			case <-time.After(200 * time.Millisecond):
+				canceled <- false
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		j, _ := NewJob("slow", nil, PriorityNormal, 1)
+		if err = s.Enqueue(j); err != nil {
+			t.Fatal(err)
+		}
+		if err = p.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		<-started
+		ctx, cancel := context.WithTimeout(context.Background(), v.timeout)
+		err = p.Stop(ctx)
+		cancel()
+		if (err != nil) != v.canceled || <-canceled != v.canceled {
+			t.Errorf("%s: unexpected stop %v", v.name, err)
+		}
+	}
+}
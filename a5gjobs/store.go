@@ -0,0 +1,207 @@
+package a5gjobs
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Storer persists jobs. Acquire must hand a due job to exactly one worker
+// and returns nil job (without error) when there is nothing to run. The
+// worker holds the job for lease; running jobs whose lease expired, e.g.
+// after a crash, are acquired again. Complete, Retry and Fail store the
+// outcome of the attempt the job was acquired for and fail with
+// ErrLeaseLost once a later attempt acquired it.
+type Storer interface {
+	Enqueue(*Job) error
+	Acquire(now time.Time, lease time.Duration) (*Job, error)
+	Complete(*Job) error
+	Retry(j *Job, runAt time.Time) error
+	Fail(*Job) error
+	DeadLetters
+}
+
+// DeadLetters inspects and re-drives failed jobs. Failed lists them by
+// ascending ID after afterID, all kinds when kind is empty. Replay makes a
+// failed job pending again with fresh attempts at runAt, replacing its
+// payload unless payload is nil, e.g. to recover a poison message.
+// ReplayFailed replays every failed job of kind and returns their count.
+type DeadLetters interface {
+	Get(id int64) (*Job, error)
+	Failed(kind string, afterID int64, limit int) ([]*Job, error)
+	Replay(id int64, payload []byte, runAt time.Time) error
+	ReplayFailed(kind string, runAt time.Time) (int64, error)
+}
+
+type memoryStore struct {
+	mu          sync.Mutex
+	lastID      int64
+	jobs        map[int64]*Job
+	lockedUntil map[int64]time.Time
+}
+
+// NewMemoryStore is an non-persistent Storer for tests and single node
+// development setups.
+func NewMemoryStore() Storer {
+	return &memoryStore{
+		jobs:        make(map[int64]*Job),
+		lockedUntil: make(map[int64]time.Time)}
+}
+
+func (s *memoryStore) Enqueue(j *Job) error {
+	if j == nil {
+		return errors.New("nil job")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	j.ID = s.lastID
+	j.Status = StatusPending
+	x := *j
+	s.jobs[j.ID] = &x
+	return nil
+}
+
+func (s *memoryStore) Acquire(now time.Time, lease time.Duration) (
+	*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var a []*Job
+	for _, j := range s.jobs {
+		switch j.Status {
+		case StatusPending, StatusRetrying:
+			if j.RunAt.After(now) {
+				continue
+			}
+		case StatusRunning:
+			if s.lockedUntil[j.ID].After(now) {
+				continue
+			}
+		default:
+			continue
+		}
+		a = append(a, j)
+	}
+	if len(a) == 0 {
+		return nil, nil
+	}
+	sort.Slice(a, func(i, k int) bool {
+		if a[i].Priority != a[k].Priority {
+			return a[i].Priority > a[k].Priority
+		}
+		if !a[i].RunAt.Equal(a[k].RunAt) {
+			return a[i].RunAt.Before(a[k].RunAt)
+		}
+		return a[i].ID < a[k].ID
+	})
+	a[0].Status = StatusRunning
+	a[0].Attempts++
+	s.lockedUntil[a[0].ID] = now.Add(lease)
+	x := *a[0]
+	return &x, nil
+}
+
+func (s *memoryStore) Complete(j *Job) error {
+	return s.set(j, StatusDone, time.Time{})
+}
+
+func (s *memoryStore) Retry(j *Job, runAt time.Time) error {
+	return s.set(j, StatusRetrying, runAt)
+}
+
+func (s *memoryStore) Fail(j *Job) error {
+	return s.set(j, StatusFailed, time.Time{})
+}
+
+func (s *memoryStore) set(j *Job, status Status, runAt time.Time) error {
+	if j == nil {
+		return errors.New("nil job")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	x, ok := s.jobs[j.ID]
+	if !ok {
+		return errors.Errorf("unknown job %d", j.ID)
+	}
+	if x.Status != StatusRunning || x.Attempts != j.Attempts {
+		return errors.Wrapf(ErrLeaseLost, "job %d attempt %d", j.ID, j.Attempts)
+	}
+	x.Status = status
+	x.LastErr = j.LastErr
+	delete(s.lockedUntil, j.ID)
+	if !runAt.IsZero() {
+		x.RunAt = runAt
+	}
+	return nil
+}
+
+func (s *memoryStore) Get(id int64) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		return nil, errors.Wrapf(ErrJobUnknown, "job %d", id)
+	}
+	x := *j
+	return &x, nil
+}
+
+func (s *memoryStore) Failed(kind string, afterID int64, limit int) (
+	[]*Job, error) {
+	s.mu.Lock()
+	var a []*Job
+	for _, j := range s.jobs {
+		if j.Status == StatusFailed && j.ID > afterID &&
+			(kind == "" || j.Kind == kind) {
+			x := *j
+			a = append(a, &x)
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(a, func(i, k int) bool { return a[i].ID < a[k].ID })
+	if limit > 0 && len(a) > limit {
+		a = a[:limit]
+	}
+	return a, nil
+}
+
+func (s *memoryStore) Replay(id int64, payload []byte, runAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		return errors.Wrapf(ErrJobUnknown, "job %d", id)
+	}
+	if j.Status != StatusFailed {
+		return errors.Wrapf(ErrJobNotFailed, "job %d is %s", id, j.Status)
+	}
+	if payload != nil {
+		j.Payload = payload
+	}
+	replay(j, runAt)
+	return nil
+}
+
+func (s *memoryStore) ReplayFailed(kind string, runAt time.Time) (int64, error) {
+	if kind == "" {
+		return 0, errors.WithStack(ErrJobKindEmpty)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for _, j := range s.jobs {
+		if j.Status == StatusFailed && j.Kind == kind {
+			replay(j, runAt)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func replay(j *Job, runAt time.Time) {
+	j.Status = StatusPending
+	j.Attempts = 0
+	j.RunAt = runAt
+}
@@ -0,0 +1,214 @@
+package a5gjobs
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestBackoffDuration(t *testing.T) {
+	b := Backoff{Base: time.Second, Max: 10 * time.Second}
+	var a = []struct {
+		in   int
+		want time.Duration
+	}{
+		{0, time.Second},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{64, 10 * time.Second},
+	}
+	for _, v := range a {
+		if d := b.Duration(v.in); d != v.want {
+			t.Errorf("Backoff.Duration(%d) => %v want %v", v.in, d, v.want)
+		}
+	}
+}
+
+func TestMemoryStoreAcquire(t *testing.T) {
+	s := NewMemoryStore()
+	now := time.Now().UTC()
+	var a = []struct {
+		kind string
+		p    Priority
+		at   time.Time
+	}{
+		{"low", PriorityLow, now.Add(-time.Minute)},
+		{"high", PriorityHigh, now},
+		{"future", PriorityHigh, now.Add(time.Hour)},
+		{"normal", PriorityNormal, now.Add(-time.Minute)},
+	}
+	for _, v := range a {
+		j, err := NewJob(v.kind, nil, v.p, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		j.RunAt = v.at
+		if err = s.Enqueue(j); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []string{"high", "normal", "low", ""} {
+		j, err := s.Acquire(now, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got string
+		if j != nil {
+			got = j.Kind
+			if err = s.Complete(j); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got != want {
+			t.Errorf("Acquire() => %q want %q", got, want)
+		}
+	}
+}
+
+func TestMemoryStoreLease(t *testing.T) {
+	s := NewMemoryStore()
+	now := time.Now().UTC()
+	j, err := NewJob("mail", nil, PriorityNormal, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.RunAt = now
+	if err = s.Enqueue(j); err != nil {
+		t.Fatal(err)
+	}
+	var a = []struct {
+		after    time.Duration
+		attempts int
+	}{
+		{0, 1},
+		{30 * time.Second, 0},
+		{2 * time.Minute, 2},
+		{2*time.Minute + 30*time.Second, 0},
+	}
+	for _, v := range a {
+		j, err := s.Acquire(now.Add(v.after), time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got int
+		if j != nil {
+			got = j.Attempts
+		}
+		if got != v.attempts {
+			t.Errorf("Acquire() after %v => attempt %d want %d",
+				v.after, got, v.attempts)
+		}
+	}
+}
+
+func TestMemoryStoreLeaseLost(t *testing.T) {
+	s := NewMemoryStore()
+	now := time.Now().UTC()
+	j, err := NewJob("mail", nil, PriorityNormal, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.RunAt = now
+	if err = s.Enqueue(j); err != nil {
+		t.Fatal(err)
+	}
+	stale, err := s.Acquire(now, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := s.Acquire(now.Add(2*time.Minute), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Complete(stale); errors.Cause(err) != ErrLeaseLost {
+		t.Errorf("Complete() of an expired lease => %v want %v", err, ErrLeaseLost)
+	}
+	if err = s.Complete(current); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Fail(current); errors.Cause(err) != ErrLeaseLost {
+		t.Errorf("Fail() of a done job => %v want %v", err, ErrLeaseLost)
+	}
+}
+
+func TestMemoryStoreDeadLetters(t *testing.T) {
+	s := NewMemoryStore()
+	now := time.Now().UTC()
+	for _, kind := range []string{"mail", "mail", "push", "mail"} {
+		j, err := NewJob(kind, []byte("poison"), PriorityNormal, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		j.RunAt = now
+		if err = s.Enqueue(j); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		j, err := s.Acquire(now, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		j.LastErr = "bad payload"
+		if err = s.Fail(j); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Replay(4, nil, now); errors.Cause(err) != ErrJobNotFailed {
+		t.Errorf("Replay() of a pending job => %v want %v", err, ErrJobNotFailed)
+	}
+	if err := s.Replay(9, nil, now); errors.Cause(err) != ErrJobUnknown {
+		t.Errorf("Replay() of an unknown job => %v want %v", err, ErrJobUnknown)
+	}
+
+	var a = []struct {
+		kind    string
+		afterID int64
+		limit   int
+		want    []int64
+	}{
+		{"", 0, 0, []int64{1, 2, 3}},
+		{"mail", 0, 0, []int64{1, 2}},
+		{"", 1, 1, []int64{2}},
+		{"push", 3, 0, nil},
+	}
+	for _, v := range a {
+		jobs, err := s.Failed(v.kind, v.afterID, v.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int64
+		for _, j := range jobs {
+			got = append(got, j.ID)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(v.want) {
+			t.Errorf("Failed(%q, %d, %d) => %v want %v",
+				v.kind, v.afterID, v.limit, got, v.want)
+		}
+	}
+
+	if err := s.Replay(3, []byte("fixed"), now); err != nil {
+		t.Fatal(err)
+	}
+	j, err := s.Get(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.Status != StatusPending || j.Attempts != 0 || string(j.Payload) != "fixed" {
+		t.Errorf("Replay() => %+v", j)
+	}
+	n, err := s.ReplayFailed("mail", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("ReplayFailed() => %d want 2", n)
+	}
+	if jobs, _ := s.Failed("", 0, 0); len(jobs) != 0 {
+		t.Errorf("Failed() after replay => %d jobs", len(jobs))
+	}
+}
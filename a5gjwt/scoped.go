@@ -0,0 +1,168 @@
+package a5gjwt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"strconv"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// CompanionAudience marks limited-scope tokens issued for the companion
+// (web) app. Such tokens are never accepted as full game sessions: they
+// carry the CompanionType header and are signed with a key derived from
+// the session secret, so even verifiers unaware of them reject them.
+const (
+	CompanionAudience = "companion"
+	CompanionType     = "companion+jwt"
+)
+
+var (
+	ErrTokenInvalid   = errors.New("invalid token")
+	ErrTokenScoped    = errors.New("scoped token is not a game session")
+	ErrTokenNotScoped = errors.New("game session is not a scoped token")
+	ErrScopeMissing   = errors.New("token scope missing")
+)
+
+type Scope string
+
+const (
+	ScopeProfileRead Scope = "profile:read"
+	ScopeClanRead    Scope = "clan:read"
+	ScopeMailRead    Scope = "mail:read"
+	ScopeMailCollect Scope = "mail:collect"
+)
+
+func (s Scope) String() string { return string(s) }
+
+type ScopedClaims struct {
+	jwt.StandardClaims
+	Scopes []Scope `json:"scopes"`
+}
+
+func (c *ScopedClaims) HasScope(s Scope) bool {
+	for _, x := range c.Scopes {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// UserID is the inverse of NewSession/NewScopedSession issuer encoding.
+func (c *ScopedClaims) UserID() (int64, error) {
+	i, err := strconv.ParseInt(c.Issuer, 10, 64)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return i, nil
+}
+
+func NewScopedSession(
+	secretKey string, userID int64, scopes []Scope,
+	issuedAt time.Time, lifeTime time.Duration) (
+	string, *ScopedClaims, error) {
+	if secretKey == "" {
+		return "", nil, errors.WithStack(ErrSecretKeyEmpty)
+	}
+	if len(scopes) == 0 {
+		return "", nil, errors.WithStack(ErrScopeMissing)
+	}
+
+	sessionClaims := &ScopedClaims{
+		StandardClaims: jwt.StandardClaims{
+			Audience:  CompanionAudience,
+			ExpiresAt: issuedAt.Add(lifeTime).Unix(),
+			IssuedAt:  issuedAt.Unix(),
+			Issuer:    strconv.FormatInt(userID, 10),
+		},
+		Scopes: scopes,
+	}
+
+	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, sessionClaims)
+	jwtToken.Header["typ"] = CompanionType
+	accessToken, err := jwtToken.SignedString(companionKey(secretKey))
+	if err != nil {
+		return "", nil, errors.Wrap(err, "jwt.(*Token).SignedString fn")
+	}
+
+	return accessToken, sessionClaims, nil
+}
+
+func companionKey(secretKey string) []byte {
+	h := hmac.New(sha256.New, []byte(secretKey))
+	_, _ = h.Write([]byte(CompanionType))
+	return h.Sum(nil)
+}
+
+// ParseScopedSession validates an companion token and checks that it
+// carries every required scope.
+func ParseScopedSession(
+	secretKey, accessToken string, required ...Scope) (*ScopedClaims, error) {
+	if secretKey == "" {
+		return nil, errors.WithStack(ErrSecretKeyEmpty)
+	}
+	sessionClaims := new(ScopedClaims)
+	err := parse(companionKey(secretKey), CompanionType, accessToken, sessionClaims)
+	if err != nil {
+		return nil, err
+	}
+	if !sessionClaims.VerifyAudience(CompanionAudience, true) {
+		return nil, errors.WithStack(ErrTokenNotScoped)
+	}
+	for _, s := range required {
+		if !sessionClaims.HasScope(s) {
+			return nil, errors.Wrap(ErrScopeMissing, s.String())
+		}
+	}
+	return sessionClaims, nil
+}
+
+// ParseSession validates a full game session made by NewSession and
+// rejects companion tokens.
+func ParseSession(secretKey, accessToken string) (*jwt.StandardClaims, error) {
+	if secretKey == "" {
+		return nil, errors.WithStack(ErrSecretKeyEmpty)
+	}
+	sessionClaims := new(jwt.StandardClaims)
+	if err := parse([]byte(secretKey), "", accessToken, sessionClaims); err != nil {
+		return nil, err
+	}
+	if sessionClaims.VerifyAudience(CompanionAudience, true) {
+		return nil, errors.WithStack(ErrTokenScoped)
+	}
+	return sessionClaims, nil
+}
+
+// parse checks the signature by key and that the typ header is
+// CompanionType exactly for companion tokens.
+func parse(key []byte, typ, accessToken string, c jwt.Claims) error {
+	jwtToken, err := jwt.ParseWithClaims(accessToken, c,
+		func(t *jwt.Token) (interface{}, error) {
+			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, errors.Errorf(
+					"unexpected signing method %v", t.Header["alg"])
+			}
+			x, _ := t.Header["typ"].(string)
+			if typ == CompanionType && x != CompanionType {
+				return nil, ErrTokenNotScoped
+			}
+			if typ != CompanionType && x == CompanionType {
+				return nil, ErrTokenScoped
+			}
+			return key, nil
+		})
+	if e, ok := err.(*jwt.ValidationError); ok &&
+		(e.Inner == ErrTokenScoped || e.Inner == ErrTokenNotScoped) {
+		return errors.WithStack(e.Inner)
+	}
+	if err != nil {
+		return errors.Wrap(err, "jwt.ParseWithClaims fn")
+	}
+	if !jwtToken.Valid {
+		return errors.WithStack(ErrTokenInvalid)
+	}
+	return nil
+}
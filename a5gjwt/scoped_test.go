@@ -0,0 +1,52 @@
+package a5gjwt
+
+import (
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+func TestScopedSession(t *testing.T) {
+	const secretKey = "secret"
+	now := time.Now()
+	companion, _, err := NewScopedSession(
+		secretKey, 42, []Scope{ScopeMailRead}, now, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, _, err := NewSession(secretKey, 42, now, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := ParseScopedSession(secretKey, companion, ScopeMailRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := c.UserID(); err != nil || id != 42 {
+		t.Errorf("unexpected user id %d, %v", id, err)
+	}
+	if _, err = ParseScopedSession(
+		secretKey, companion, ScopeMailCollect); errors.Cause(err) != ErrScopeMissing {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err = ParseScopedSession(secretKey, session); errors.Cause(err) != ErrTokenNotScoped {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	if _, err = ParseSession(secretKey, session); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ParseSession(secretKey, companion); errors.Cause(err) != ErrTokenScoped {
+		t.Errorf("unexpected error %v", err)
+	}
+	// Verifiers unaware of companion tokens reject them by the signature.
+	_, err = jwt.Parse(companion, func(*jwt.Token) (interface{}, error) {
+		return []byte(secretKey), nil
+	})
+	if err == nil {
+		t.Error("companion token accepted as a session")
+	}
+}
@@ -0,0 +1,79 @@
+package a5gleaderboard
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/pkg/errors"
+)
+
+var ErrCodeBoardUnknown = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+	Code:     4043,
+	Name:     "leaderboard_unknown",
+	Severity: a5gapi.ErrSeverityWarn,
+	Public:   true,
+	Message:  "leaderboard not found"})
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeBoardUnknown, http.StatusNotFound)
+}
+
+type TopRequest struct {
+	Board    string `json:"board" validate:"required"`
+	Limit    int64  `json:"limit" validate:"min=1,max=100"`
+	Previous bool   `json:"previous"`
+}
+
+type AroundRequest struct {
+	Board     string `json:"board" validate:"required"`
+	Neighbors int64  `json:"neighbors" validate:"min=0,max=50"`
+	Previous  bool   `json:"previous"`
+}
+
+// TopHandler answers with the top entries of a board Season. Scores are
+// submitted by game logic through Submit, never by clients.
+func (lb *Leaderboards) TopHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return &TopRequest{Limit: 10} },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			p := req.Payload.(*TopRequest)
+			s, err := lb.Top(p.Board, p.Limit, p.Previous)
+			if err != nil {
+				return nil, lb.apiErrs(err)
+			}
+			return s, nil
+		})
+}
+
+// AroundHandler answers with the a5gsession authenticated player and
+// their neighbors on a board Season.
+func (lb *Leaderboards) AroundHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return &AroundRequest{Neighbors: 5} },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			sess, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			p := req.Payload.(*AroundRequest)
+			s, err := lb.Around(p.Board, sess.AccountID, p.Neighbors, p.Previous)
+			if err != nil {
+				return nil, lb.apiErrs(err)
+			}
+			return s, nil
+		})
+}
+
+func (lb *Leaderboards) apiErrs(err error) []*a5gapi.APIErr {
+	if errors.Cause(err) == ErrBoardUnknown {
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeBoardUnknown, "")}
+	}
+	lb.Logger.Error(err.Error())
+	return a5gapi.NewJSONMsgDefautlErrors(err)
+}
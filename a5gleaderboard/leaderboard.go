@@ -0,0 +1,291 @@
+package a5gleaderboard
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gcoalesce"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+var ErrBoardUnknown = errors.New("leaderboard unknown")
+
+type Order int
+
+const (
+	// OrderDesc ranks higher scores first.
+	OrderDesc Order = iota
+	OrderAsc
+)
+
+// Tie decides the order of equal scores.
+type Tie int
+
+const (
+	// TieEarlierFirst ranks whoever reached the score first higher.
+	TieEarlierFirst Tie = iota
+	TieLaterFirst
+	// TiePlayerID ranks lower player ids higher.
+	TiePlayerID
+)
+
+// Mode is how a submitted score combines with the stored one.
+type Mode int
+
+const (
+	// ModeBest keeps the best score of the season.
+	ModeBest Mode = iota
+	// ModeLatest replaces the score.
+	ModeLatest
+	// ModeIncrement adds the submitted score, e.g. season points.
+	ModeIncrement
+)
+
+// Board is a leaderboard definition. Seasons of Schedule are kept for
+// Retain after their end (one more season length when zero), so that the
+// previous season stays readable. Scores are exact up to 2^53.
+type Board struct {
+	ID       string
+	Order    Order
+	Tie      Tie
+	Mode     Mode
+	Schedule Schedule
+	Retain   time.Duration
+}
+
+type Entry struct {
+	PlayerID uint64 `json:"playerId"`
+	Score    int64  `json:"score"`
+	// Rank is 1-based.
+	Rank int64 `json:"rank"`
+}
+
+// Season is a page of a board season.
+type Season struct {
+	Board   string   `json:"board"`
+	Season  string   `json:"season"`
+	EndsAt  int64    `json:"endsAt,omitempty"`
+	Entries []*Entry `json:"entries"`
+}
+
+// Store keeps scores of a board season under key. Members are ordered by
+// score and then by member bytes, member carries the tie-breaking prefix
+// built by Leaderboards.
+type Store interface {
+	// Submit stores score of playerID combined by b.Mode and returns the
+	// stored score; expireAt is zero for seasons kept forever.
+	Submit(b *Board, key string, expireAt time.Time,
+		playerID uint64, score int64, member string) (int64, error)
+	// Range returns entries from 0-based offset in rank order.
+	Range(b *Board, key string, offset, n int64) ([]*Entry, error)
+	// Rank returns the entry of playerID or nil when not ranked.
+	Rank(b *Board, key string, playerID uint64) (*Entry, error)
+}
+
+// Leaderboards serves the registered boards over Store. Coalesce, when
+// set, makes concurrent identical Top reads share a single Store query.
+type Leaderboards struct {
+	Store    Store
+	Logger   a5glogs.Logger
+	Coalesce *a5gcoalesce.Group
+	now      func() time.Time
+
+	mu     sync.RWMutex
+	boards map[string]*Board
+}
+
+func NewLeaderboards(s Store, l a5glogs.Logger) (*Leaderboards, error) {
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Leaderboards{
+		Store:  s,
+		Logger: l,
+		now:    time.Now,
+		boards: make(map[string]*Board)}, nil
+}
+
+func (lb *Leaderboards) Register(b *Board) error {
+	if b == nil || b.ID == "" || strings.ContainsAny(b.ID, ":{}") {
+		return errors.New("invalid leaderboard id")
+	}
+	if b.Schedule == nil {
+		return errors.Errorf("leaderboard %q schedule missing", b.ID)
+	}
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	if _, ok := lb.boards[b.ID]; ok {
+		return errors.Errorf("leaderboard %q already registered", b.ID)
+	}
+	lb.boards[b.ID] = b
+	return nil
+}
+
+func (lb *Leaderboards) board(id string) (*Board, error) {
+	lb.mu.RLock()
+	b, ok := lb.boards[id]
+	lb.mu.RUnlock()
+	if !ok {
+		return nil, errors.Wrap(ErrBoardUnknown, id)
+	}
+	return b, nil
+}
+
+// season resolves the current season or, when previous, the one before.
+func (lb *Leaderboards) season(
+	b *Board, previous bool) (id string, end time.Time, ok bool) {
+	id, start, end := b.Schedule.Season(lb.now())
+	if !previous {
+		return id, end, true
+	}
+	if start.IsZero() {
+		return "", time.Time{}, false
+	}
+	id, _, end = b.Schedule.Season(start.Add(-time.Nanosecond))
+	return id, end, true
+}
+
+// Submit records score of playerID in the current season and returns the
+// resulting entry.
+func (lb *Leaderboards) Submit(
+	boardID string, playerID uint64, score int64) (*Entry, error) {
+	b, err := lb.board(boardID)
+	if err != nil {
+		return nil, err
+	}
+	now := lb.now()
+	id, start, end := b.Schedule.Season(now)
+	var expireAt time.Time
+	if !end.IsZero() {
+		retain := b.Retain
+		if retain == 0 {
+			retain = end.Sub(start)
+		}
+		expireAt = end.Add(retain)
+	}
+	key := b.ID + ":" + id
+	if _, err = lb.Store.Submit(b, key, expireAt, playerID, score,
+		member(b, playerID, now)); err != nil {
+		return nil, err
+	}
+	return lb.Store.Rank(b, key, playerID)
+}
+
+// Top returns the first n entries of the current or previous season.
+// Entries may be shared with concurrent callers and must not be modified.
+func (lb *Leaderboards) Top(
+	boardID string, n int64, previous bool) (*Season, error) {
+	b, err := lb.board(boardID)
+	if err != nil {
+		return nil, err
+	}
+	s, key, ok := lb.newSeason(b, previous)
+	if !ok || n < 1 {
+		return s, nil
+	}
+	if lb.Coalesce == nil {
+		s.Entries, err = lb.Store.Range(b, key, 0, n)
+	} else {
+		var x interface{}
+		x, _, err = lb.Coalesce.Do(
+			"leaderboard:"+key+":"+strconv.FormatInt(n, 10),
+			func() (interface{}, error) { return lb.Store.Range(b, key, 0, n) })
+		s.Entries, _ = x.([]*Entry)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Around returns the entry of playerID with up to n neighbors on either
+// side, Entries are empty when the player is not ranked.
+func (lb *Leaderboards) Around(
+	boardID string, playerID uint64, n int64, previous bool) (*Season, error) {
+	b, err := lb.board(boardID)
+	if err != nil {
+		return nil, err
+	}
+	s, key, ok := lb.newSeason(b, previous)
+	if !ok || n < 0 {
+		return s, nil
+	}
+	e, err := lb.Store.Rank(b, key, playerID)
+	if err != nil || e == nil {
+		return s, err
+	}
+	offset := e.Rank - 1 - n
+	if offset < 0 {
+		offset = 0
+	}
+	if s.Entries, err = lb.Store.Range(
+		b, key, offset, e.Rank+n-offset); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Standings returns n entries of season from 0-based offset, e.g. to pay
+// out the final standings of an ended season before its Retain passes.
+func (lb *Leaderboards) Standings(
+	boardID, season string, offset, n int64) ([]*Entry, error) {
+	b, err := lb.board(boardID)
+	if err != nil {
+		return nil, err
+	}
+	if season == "" {
+		return nil, errors.Errorf("leaderboard %q season missing", boardID)
+	}
+	return lb.Store.Range(b, b.ID+":"+season, offset, n)
+}
+
+func (lb *Leaderboards) newSeason(
+	b *Board, previous bool) (*Season, string, bool) {
+	s := &Season{Board: b.ID, Entries: []*Entry{}}
+	id, end, ok := lb.season(b, previous)
+	if !ok {
+		return s, "", false
+	}
+	s.Season = id
+	if !end.IsZero() {
+		s.EndsAt = end.Unix()
+	}
+	return s, b.ID + ":" + id, true
+}
+
+// member is the sort key of a score: stores order equal scores by member
+// bytes in the direction of b.Order, so the tie prefix is inverted where
+// the direction disagrees with b.Tie.
+func member(b *Board, playerID uint64, at time.Time) string {
+	var tie uint64
+	switch b.Tie {
+	case TieEarlierFirst, TieLaterFirst:
+		tie = uint64(at.UnixNano() / int64(time.Millisecond))
+		if (b.Order == OrderDesc) == (b.Tie == TieEarlierFirst) {
+			tie = math.MaxInt64 - tie
+		}
+	case TiePlayerID:
+		tie = playerID
+		if b.Order == OrderDesc {
+			tie = math.MaxUint64 - tie
+		}
+	}
+	return fmt.Sprintf("%016x:%d", tie, playerID)
+}
+
+func memberPlayerID(m string) (uint64, error) {
+	i := strings.IndexByte(m, ':')
+	id, err := strconv.ParseUint(m[i+1:], 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "leaderboard member %q", m)
+	}
+	return id, nil
+}
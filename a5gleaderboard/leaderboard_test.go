@@ -0,0 +1,92 @@
+package a5gleaderboard
+
+import (
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5gcoalesce"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/sirupsen/logrus"
+)
+
+func TestLeaderboards(t *testing.T) {
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.(*memoryStore).now = func() time.Time { return now }
+	lb, err := NewLeaderboards(store, a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lb.now = func() time.Time { return now }
+	lb.Coalesce = a5gcoalesce.NewGroup()
+	boards := []*Board{
+		{ID: "best", Schedule: Daily(nil)},
+		{ID: "later", Tie: TieLaterFirst, Schedule: Daily(nil)},
+		{ID: "asc", Order: OrderAsc, Mode: ModeLatest, Schedule: Forever},
+		{ID: "points", Mode: ModeIncrement, Tie: TiePlayerID, Schedule: Weekly(nil)},
+	}
+	for _, b := range boards {
+		if err = lb.Register(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	submits := []struct {
+		player uint64
+		score  int64
+	}{{1, 50}, {2, 70}, {3, 50}, {1, 40}, {4, 90}, {2, 30}}
+	for _, s := range submits {
+		for _, b := range boards {
+			if _, err = lb.Submit(b.ID, s.player, s.score); err != nil {
+				t.Fatal(err)
+			}
+		}
+		now = now.Add(time.Second)
+	}
+	tests := []struct {
+		board   string
+		players []uint64
+		scores  []int64
+	}{
+		{"best", []uint64{4, 2, 1, 3}, []int64{90, 70, 50, 50}},
+		{"later", []uint64{4, 2, 3, 1}, []int64{90, 70, 50, 50}},
+		{"asc", []uint64{2, 1, 3, 4}, []int64{30, 40, 50, 90}},
+		{"points", []uint64{2, 1, 4, 3}, []int64{100, 90, 90, 50}},
+	}
+	for _, x := range tests {
+		s, err := lb.Top(x.board, 10, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(s.Entries) != len(x.players) {
+			t.Errorf("%s: expected %d entries, got %d",
+				x.board, len(x.players), len(s.Entries))
+			continue
+		}
+		for i, e := range s.Entries {
+			if e.PlayerID != x.players[i] || e.Score != x.scores[i] ||
+				e.Rank != int64(i+1) {
+				t.Errorf("%s: expected #%d player %d with %d, got %+v",
+					x.board, i+1, x.players[i], x.scores[i], e)
+			}
+		}
+	}
+	s, err := lb.Around("best", 1, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Entries) != 3 || s.Entries[0].PlayerID != 2 ||
+		s.Entries[2].PlayerID != 3 {
+		t.Errorf("unexpected neighbors %+v", s.Entries)
+	}
+	now = now.Add(24 * time.Hour)
+	if s, err = lb.Top("best", 10, false); err != nil || len(s.Entries) != 0 {
+		t.Errorf("expected empty new season, got %+v %v", s, err)
+	}
+	if s, err = lb.Top("best", 10, true); err != nil || len(s.Entries) != 4 ||
+		s.Season != "20200310" {
+		t.Errorf("expected previous season, got %+v %v", s, err)
+	}
+	if _, err = lb.Top("missing", 10, false); err == nil {
+		t.Error("expected unknown board error")
+	}
+}
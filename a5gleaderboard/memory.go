@@ -0,0 +1,128 @@
+package a5gleaderboard
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type memoryScore struct {
+	score  int64
+	member string
+}
+
+type memorySeason struct {
+	expireAt time.Time
+	scores   map[uint64]*memoryScore
+}
+
+type memoryStore struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	seasons map[string]*memorySeason
+}
+
+// NewMemoryStore is a single-process Store for tests and tools; ranking
+// sorts the season on every read.
+func NewMemoryStore() Store {
+	return &memoryStore{now: time.Now, seasons: make(map[string]*memorySeason)}
+}
+
+func (s *memoryStore) season(key string, create bool) *memorySeason {
+	x, ok := s.seasons[key]
+	if ok && !x.expireAt.IsZero() && !s.now().Before(x.expireAt) {
+		delete(s.seasons, key)
+		ok = false
+	}
+	if !ok && create {
+		x = &memorySeason{scores: make(map[uint64]*memoryScore)}
+		s.seasons[key] = x
+	}
+	return x
+}
+
+func (s *memoryStore) Submit(
+	b *Board, key string, expireAt time.Time,
+	playerID uint64, score int64, member string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	x := s.season(key, true)
+	x.expireAt = expireAt
+	if old, ok := x.scores[playerID]; ok {
+		switch b.Mode {
+		case ModeBest:
+			if !better(b.Order, score, old.score) {
+				return old.score, nil
+			}
+		case ModeIncrement:
+			score += old.score
+		}
+	}
+	x.scores[playerID] = &memoryScore{score: score, member: member}
+	return score, nil
+}
+
+func (s *memoryStore) Range(
+	b *Board, key string, offset, n int64) ([]*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.sorted(b, key)
+	if offset >= int64(len(a)) {
+		return []*Entry{}, nil
+	}
+	a = a[offset:]
+	if n < int64(len(a)) {
+		a = a[:n]
+	}
+	return a, nil
+}
+
+func (s *memoryStore) Rank(
+	b *Board, key string, playerID uint64) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.sorted(b, key) {
+		if e.PlayerID == playerID {
+			return e, nil
+		}
+	}
+	return nil, nil
+}
+
+// sorted ranks the season the way redis sorted sets do.
+func (s *memoryStore) sorted(b *Board, key string) []*Entry {
+	x := s.season(key, false)
+	if x == nil {
+		return nil
+	}
+	type item struct {
+		id uint64
+		*memoryScore
+	}
+	a := make([]item, 0, len(x.scores))
+	for id, v := range x.scores {
+		a = append(a, item{id, v})
+	}
+	sort.Slice(a, func(i, j int) bool {
+		if a[i].score != a[j].score {
+			return better(b.Order, a[i].score, a[j].score)
+		}
+		if b.Order == OrderDesc {
+			return a[i].member > a[j].member
+		}
+		return a[i].member < a[j].member
+	})
+	entries := make([]*Entry, len(a))
+	for i, v := range a {
+		entries[i] = &Entry{PlayerID: v.id, Score: v.score, Rank: int64(i + 1)}
+	}
+	return entries
+}
+
+func better(o Order, score, than int64) bool {
+	if o == OrderAsc {
+		return score < than
+	}
+	return score > than
+}
@@ -0,0 +1,149 @@
+package a5gleaderboard
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+)
+
+// A season is a sorted set of members and a hash of player id to member,
+// both under one hash tag.
+var submitScript = redis.NewScript(`
+local score = tonumber(ARGV[2])
+local old = redis.call("HGET", KEYS[2], ARGV[1])
+if old then
+  local s = tonumber(redis.call("ZSCORE", KEYS[1], old))
+  if s then
+    if ARGV[4] == "best" then
+      if (ARGV[5] == "desc" and score <= s) or
+        (ARGV[5] == "asc" and score >= s) then
+        return tostring(s)
+      end
+    elseif ARGV[4] == "incr" then
+      score = score + s
+    end
+  end
+  redis.call("ZREM", KEYS[1], old)
+end
+redis.call("ZADD", KEYS[1], score, ARGV[3])
+redis.call("HSET", KEYS[2], ARGV[1], ARGV[3])
+if ARGV[6] ~= "0" then
+  redis.call("PEXPIREAT", KEYS[1], ARGV[6])
+  redis.call("PEXPIREAT", KEYS[2], ARGV[6])
+end
+return tostring(score)
+`)
+
+type redisStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisStore keeps board seasons as sorted sets under prefix.
+func NewRedisStore(c redis.UniversalClient, prefix string) (Store, error) {
+	if c == nil {
+		return nil, errors.New("redis client missing")
+	}
+	return &redisStore{client: c, prefix: prefix}, nil
+}
+
+func (s *redisStore) keys(key string) (string, string) {
+	k := "{" + s.prefix + key + "}"
+	return k, k + ":m"
+}
+
+func (s *redisStore) Submit(
+	b *Board, key string, expireAt time.Time,
+	playerID uint64, score int64, member string) (int64, error) {
+	z, h := s.keys(key)
+	mode := "latest"
+	switch b.Mode {
+	case ModeBest:
+		mode = "best"
+	case ModeIncrement:
+		mode = "incr"
+	}
+	order := "desc"
+	if b.Order == OrderAsc {
+		order = "asc"
+	}
+	var at int64
+	if !expireAt.IsZero() {
+		at = expireAt.UnixNano() / int64(time.Millisecond)
+	}
+	x, err := submitScript.Run(s.client, []string{z, h},
+		strconv.FormatUint(playerID, 10), score, member, mode, order, at).Result()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	str, _ := x.(string)
+	f, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return int64(f), nil
+}
+
+func (s *redisStore) Range(
+	b *Board, key string, offset, n int64) ([]*Entry, error) {
+	if n < 1 {
+		return []*Entry{}, nil
+	}
+	z, _ := s.keys(key)
+	var (
+		a   []redis.Z
+		err error
+	)
+	if b.Order == OrderAsc {
+		a, err = s.client.ZRangeWithScores(z, offset, offset+n-1).Result()
+	} else {
+		a, err = s.client.ZRevRangeWithScores(z, offset, offset+n-1).Result()
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	entries := make([]*Entry, 0, len(a))
+	for i, x := range a {
+		m, _ := x.Member.(string)
+		id, err := memberPlayerID(m)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &Entry{
+			PlayerID: id,
+			Score:    int64(x.Score),
+			Rank:     offset + int64(i) + 1})
+	}
+	return entries, nil
+}
+
+func (s *redisStore) Rank(
+	b *Board, key string, playerID uint64) (*Entry, error) {
+	z, h := s.keys(key)
+	m, err := s.client.HGet(h, strconv.FormatUint(playerID, 10)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	p := s.client.TxPipeline()
+	score := p.ZScore(z, m)
+	var rank *redis.IntCmd
+	if b.Order == OrderAsc {
+		rank = p.ZRank(z, m)
+	} else {
+		rank = p.ZRevRank(z, m)
+	}
+	if _, err = p.Exec(); err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &Entry{
+		PlayerID: playerID,
+		Score:    int64(score.Val()),
+		Rank:     rank.Val() + 1}, nil
+}
@@ -0,0 +1,106 @@
+package a5gleaderboard
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/armor5games/a5g/a5greset"
+)
+
+// Schedule splits time into seasons, a board starts empty every season.
+// Season returns the id and bounds of the season t belongs to; a zero end
+// means the season never ends.
+type Schedule interface {
+	Season(t time.Time) (id string, start, end time.Time)
+}
+
+// Forever is the schedule of boards that never reset.
+var Forever Schedule = forever{}
+
+type forever struct{}
+
+func (forever) Season(time.Time) (string, time.Time, time.Time) {
+	return "all", time.Time{}, time.Time{}
+}
+
+type calendar struct {
+	loc    *time.Location
+	period func(time.Time) (string, time.Time, time.Time)
+}
+
+func (c *calendar) Season(t time.Time) (string, time.Time, time.Time) {
+	return c.period(t.In(c.loc))
+}
+
+// Daily resets at midnight of loc (UTC when nil).
+func Daily(loc *time.Location) Schedule {
+	return &calendar{loc: location(loc), period: func(t time.Time) (
+		string, time.Time, time.Time) {
+		start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		return start.Format("20060102"), start, start.AddDate(0, 0, 1)
+	}}
+}
+
+// Weekly resets on Monday midnight of loc (UTC when nil), seasons are
+// named by ISO weeks.
+func Weekly(loc *time.Location) Schedule {
+	return &calendar{loc: location(loc), period: func(t time.Time) (
+		string, time.Time, time.Time) {
+		days := (int(t.Weekday()) + 6) % 7
+		start := time.Date(
+			t.Year(), t.Month(), t.Day()-days, 0, 0, 0, 0, t.Location())
+		y, w := start.ISOWeek()
+		return fmt.Sprintf("%dw%02d", y, w), start, start.AddDate(0, 0, 7)
+	}}
+}
+
+// Monthly resets on the first day of month in loc (UTC when nil).
+func Monthly(loc *time.Location) Schedule {
+	return &calendar{loc: location(loc), period: func(t time.Time) (
+		string, time.Time, time.Time) {
+		start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+		return start.Format("200601"), start, start.AddDate(0, 1, 0)
+	}}
+}
+
+func location(loc *time.Location) *time.Location {
+	if loc == nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Every is a rolling schedule of seasons lasting period each, counted from
+// epoch, e.g. three day tournaments.
+func Every(epoch time.Time, period time.Duration) Schedule {
+	return &rolling{epoch: epoch, period: period}
+}
+
+type rolling struct {
+	epoch  time.Time
+	period time.Duration
+}
+
+func (r *rolling) Season(t time.Time) (string, time.Time, time.Time) {
+	d := t.Sub(r.epoch)
+	n := int64(d / r.period)
+	if d < 0 && d%r.period != 0 {
+		n--
+	}
+	start := r.epoch.Add(time.Duration(n) * r.period)
+	return strconv.FormatInt(n, 10), start, start.Add(r.period)
+}
+
+// DailyReset and WeeklyReset follow the game reset shared with other daily
+// features, see a5greset.
+func DailyReset(r *a5greset.Reset) Schedule { return periodSchedule(r.Day) }
+
+func WeeklyReset(r *a5greset.Reset) Schedule { return periodSchedule(r.Week) }
+
+type periodSchedule func(time.Time) a5greset.Period
+
+func (fn periodSchedule) Season(t time.Time) (string, time.Time, time.Time) {
+	p := fn(t)
+	return p.Key, p.Start, p.End
+}
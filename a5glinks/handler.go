@@ -0,0 +1,40 @@
+package a5glinks
+
+import (
+	"context"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gvalidate"
+)
+
+type ClusterRequest struct {
+	AccountID uint64 `json:"accountId" validate:"required"`
+}
+
+// ClusterResponse shows support the cluster of an account, Links are the
+// direct ones with the signals they share.
+type ClusterResponse struct {
+	Accounts []uint64 `json:"accounts"`
+	Links    []*Link  `json:"links"`
+}
+
+// ClusterHandler answers with the cluster of an account, mount it on an
+// admin route class.
+func (d *Detector) ClusterHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(ClusterRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			id := req.Payload.(*ClusterRequest).AccountID
+			links, err := d.Links(id)
+			if err != nil {
+				return nil, a5gapi.NewJSONMsgDefautlErrors(err)
+			}
+			cluster, err := d.Cluster(id)
+			if err != nil {
+				return nil, a5gapi.NewJSONMsgDefautlErrors(err)
+			}
+			return &ClusterResponse{Accounts: cluster, Links: links}, nil
+		})
+}
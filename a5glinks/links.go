@@ -0,0 +1,210 @@
+package a5glinks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Signal kinds accounts are linked by. Behavior is a fingerprint the
+// caller derives, e.g. of play hours and input timings.
+const (
+	KindDevice   = "device"
+	KindIP       = "ip"
+	KindPayment  = "payment"
+	KindBehavior = "behavior"
+)
+
+var ErrKindUnknown = errors.New("link signal kind unknown")
+
+// Signal is a normalized and hashed value an account was seen with.
+type Signal struct {
+	Kind   string `json:"kind"`
+	Value  string `json:"value"`
+	SeenAt int64  `json:"seenAt"`
+}
+
+// Store keeps signals of accounts and claims of rewards. Observe is
+// idempotent and refreshes SeenAt; Accounts lists accounts seen with a
+// signal, up to limit.
+type Store interface {
+	Observe(accountID uint64, s *Signal) error
+	Signals(accountID uint64) ([]*Signal, error)
+	Accounts(kind, value string, limit int) ([]uint64, error)
+	Claimed(accountIDs []uint64, reward string) (bool, error)
+	Claim(accountID uint64, reward string) (bool, error)
+}
+
+// Link is an account sharing signals with another one.
+type Link struct {
+	AccountID uint64   `json:"accountId"`
+	Score     int      `json:"score"`
+	Kinds     []string `json:"kinds"`
+}
+
+// Detector links accounts which share signals. The score of a pair is the
+// sum of Weights of kinds of signals they share; pairs scoring at least
+// Threshold are linked and linked accounts make a cluster, e.g. one
+// household or one farmer.
+type Detector struct {
+	Weights   map[string]int
+	Threshold int
+	Store     Store
+	// MaxShared skips signals shared by more accounts, e.g. a carrier NAT
+	// address, MaxCluster caps clusters.
+	MaxShared  int
+	MaxCluster int
+
+	now func() time.Time
+}
+
+func NewDetector(s Store) (*Detector, error) {
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	return &Detector{
+		Weights: map[string]int{
+			KindDevice: 10, KindPayment: 10, KindIP: 3, KindBehavior: 4},
+		Threshold:  10,
+		Store:      s,
+		MaxShared:  50,
+		MaxCluster: 200,
+		now:        time.Now}, nil
+}
+
+// normalize keeps networks of addresses, /24 for IPv4 and /64 for IPv6,
+// and hashes values, so raw instruments are never stored.
+func normalize(kind, value string) (string, error) {
+	if kind == KindIP {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return "", errors.Errorf("invalid ip %q", value)
+		}
+		if v4 := ip.To4(); v4 != nil {
+			value = v4.Mask(net.CIDRMask(24, 32)).String() + "/24"
+		} else {
+			value = ip.Mask(net.CIDRMask(64, 128)).String() + "/64"
+		}
+	}
+	h := sha256.Sum256([]byte(kind + ":" + strings.ToLower(value)))
+	return hex.EncodeToString(h[:16]), nil
+}
+
+// Observe records a signal of an account, e.g. a device ID on login or a
+// payment instrument fingerprint on purchase.
+func (d *Detector) Observe(accountID uint64, kind, value string) error {
+	if _, ok := d.Weights[kind]; !ok {
+		return errors.Wrap(ErrKindUnknown, kind)
+	}
+	if value == "" {
+		return errors.Errorf("empty %s signal", kind)
+	}
+	v, err := normalize(kind, value)
+	if err != nil {
+		return err
+	}
+	return d.Store.Observe(accountID, &Signal{Kind: kind, Value: v, SeenAt: d.now().Unix()})
+}
+
+// Links returns accounts linked to an account, by score descending.
+func (d *Detector) Links(accountID uint64) ([]*Link, error) {
+	signals, err := d.Store.Signals(accountID)
+	if err != nil {
+		return nil, err
+	}
+	links := make(map[uint64]*Link)
+	for _, s := range signals {
+		ids, err := d.Store.Accounts(s.Kind, s.Value, d.MaxShared+1)
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) > d.MaxShared {
+			continue
+		}
+		for _, id := range ids {
+			if id == accountID {
+				continue
+			}
+			l, ok := links[id]
+			if !ok {
+				l = &Link{AccountID: id}
+				links[id] = l
+			}
+			if !contains(l.Kinds, s.Kind) {
+				l.Kinds = append(l.Kinds, s.Kind)
+				l.Score += d.Weights[s.Kind]
+			}
+		}
+	}
+	a := []*Link{}
+	for _, l := range links {
+		if l.Score >= d.Threshold {
+			sort.Strings(l.Kinds)
+			a = append(a, l)
+		}
+	}
+	sort.Slice(a, func(i, j int) bool {
+		if a[i].Score != a[j].Score {
+			return a[i].Score > a[j].Score
+		}
+		return a[i].AccountID < a[j].AccountID
+	})
+	return a, nil
+}
+
+func contains(a []string, s string) bool {
+	for _, x := range a {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Cluster returns accounts linked to an account directly or through
+// others, including the account, sorted by ID.
+func (d *Detector) Cluster(accountID uint64) ([]uint64, error) {
+	seen := map[uint64]bool{accountID: true}
+	queue := []uint64{accountID}
+	for len(queue) > 0 && len(seen) < d.MaxCluster {
+		id := queue[0]
+		queue = queue[1:]
+		links, err := d.Links(id)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range links {
+			if !seen[l.AccountID] && len(seen) < d.MaxCluster {
+				seen[l.AccountID] = true
+				queue = append(queue, l.AccountID)
+			}
+		}
+	}
+	a := make([]uint64, 0, len(seen))
+	for id := range seen {
+		a = append(a, id)
+	}
+	sort.Slice(a, func(i, j int) bool { return a[i] < a[j] })
+	return a, nil
+}
+
+// ClaimOnce claims a reward for an account unless an account of its
+// cluster claimed it, e.g. one referral reward per household. Concurrent
+// claims of two linked accounts may both pass, rewards like these are
+// rare enough to accept that.
+func (d *Detector) ClaimOnce(accountID uint64, reward string) (bool, error) {
+	cluster, err := d.Cluster(accountID)
+	if err != nil {
+		return false, err
+	}
+	claimed, err := d.Store.Claimed(cluster, reward)
+	if err != nil || claimed {
+		return false, err
+	}
+	return d.Store.Claim(accountID, reward)
+}
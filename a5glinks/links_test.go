@@ -0,0 +1,78 @@
+package a5glinks
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestDetector(t *testing.T) {
+	d, err := NewDetector(NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.MaxShared = 3
+	observe := func(id uint64, kind, value string) {
+		if err := d.Observe(id, kind, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 1 and 2 share a device, 2 and 3 a card, 4 shares only a network
+	// with 1 and behaves like it, 5-8 share a carrier NAT address.
+	observe(1, KindDevice, "ABC")
+	observe(2, KindDevice, "abc")
+	observe(2, KindPayment, "card-1")
+	observe(3, KindPayment, "card-1")
+	observe(1, KindIP, "10.0.0.1")
+	observe(4, KindIP, "10.0.0.200")
+	observe(1, KindBehavior, "night-owl")
+	observe(4, KindBehavior, "night-owl")
+	for id := uint64(5); id <= 8; id++ {
+		observe(id, KindDevice, "nat")
+		observe(id, KindIP, "2001:db8::1")
+	}
+	if err = d.Observe(1, "email", "x"); errors.Cause(err) != ErrKindUnknown {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err = d.Observe(1, KindIP, "not an ip"); err == nil {
+		t.Error("expected an invalid ip error")
+	}
+
+	links, err := d.Links(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 2 || links[0].AccountID != 1 || links[0].Kinds[0] != KindDevice {
+		t.Errorf("unexpected links %+v", links)
+	}
+	tests := []struct {
+		accountID uint64
+		expected  []uint64
+	}{
+		{1, []uint64{1, 2, 3}},
+		{3, []uint64{1, 2, 3}},
+		{4, []uint64{4}},
+		{5, []uint64{5}},
+	}
+	for _, test := range tests {
+		cluster, err := d.Cluster(test.accountID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(cluster, test.expected) {
+			t.Errorf("cluster of %d: expected %v, got %v",
+				test.accountID, test.expected, cluster)
+		}
+	}
+
+	for _, c := range []struct {
+		accountID uint64
+		ok        bool
+	}{{3, true}, {1, false}, {3, false}, {4, true}} {
+		ok, err := d.ClaimOnce(c.accountID, "referral")
+		if err != nil || ok != c.ok {
+			t.Errorf("ClaimOnce(%d) => %v %v", c.accountID, ok, err)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package a5glinks
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryStore struct {
+	mu       sync.Mutex
+	signals  map[uint64]map[[2]string]int64
+	accounts map[[2]string]map[uint64]bool
+	claims   map[string]map[uint64]bool
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{
+		signals:  make(map[uint64]map[[2]string]int64),
+		accounts: make(map[[2]string]map[uint64]bool),
+		claims:   make(map[string]map[uint64]bool)}
+}
+
+func (s *memoryStore) Observe(accountID uint64, x *Signal) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := [2]string{x.Kind, x.Value}
+	if s.signals[accountID] == nil {
+		s.signals[accountID] = make(map[[2]string]int64)
+	}
+	s.signals[accountID][k] = x.SeenAt
+	if s.accounts[k] == nil {
+		s.accounts[k] = make(map[uint64]bool)
+	}
+	s.accounts[k][accountID] = true
+	return nil
+}
+
+func (s *memoryStore) Signals(accountID uint64) ([]*Signal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := []*Signal{}
+	for k, at := range s.signals[accountID] {
+		a = append(a, &Signal{Kind: k[0], Value: k[1], SeenAt: at})
+	}
+	sort.Slice(a, func(i, j int) bool {
+		if a[i].Kind != a[j].Kind {
+			return a[i].Kind < a[j].Kind
+		}
+		return a[i].Value < a[j].Value
+	})
+	return a, nil
+}
+
+func (s *memoryStore) Accounts(kind, value string, limit int) ([]uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := []uint64{}
+	for id := range s.accounts[[2]string{kind, value}] {
+		a = append(a, id)
+	}
+	sort.Slice(a, func(i, j int) bool { return a[i] < a[j] })
+	if len(a) > limit {
+		a = a[:limit]
+	}
+	return a, nil
+}
+
+func (s *memoryStore) Claimed(accountIDs []uint64, reward string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range accountIDs {
+		if s.claims[reward][id] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *memoryStore) Claim(accountID uint64, reward string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.claims[reward] == nil {
+		s.claims[reward] = make(map[uint64]bool)
+	}
+	if s.claims[reward][accountID] {
+		return false, nil
+	}
+	s.claims[reward][accountID] = true
+	return true, nil
+}
+
+// dbStore keeps signals and claims in MySQL tables:
+//
+//	CREATE TABLE account_signals (
+//	  kind VARCHAR(16) NOT NULL,
+//	  value CHAR(32) NOT NULL,
+//	  account_id BIGINT UNSIGNED NOT NULL,
+//	  seen_at DATETIME NOT NULL,
+//	  PRIMARY KEY (kind, value, account_id),
+//	  KEY account_id (account_id));
+//
+//	CREATE TABLE account_link_claims (
+//	  reward VARCHAR(64) NOT NULL,
+//	  account_id BIGINT UNSIGNED NOT NULL,
+//	  created_at DATETIME NOT NULL,
+//	  PRIMARY KEY (reward, account_id));
+type dbStore struct {
+	pooler           a5gdb.Pooler
+	signalsTableName string
+	claimsTableName  string
+}
+
+type dbSignal struct {
+	Kind   string    `db:"kind"`
+	Value  string    `db:"value"`
+	SeenAt time.Time `db:"seen_at"`
+}
+
+func NewDBStore(
+	p a5gdb.Pooler, signalsTableName, claimsTableName string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if signalsTableName == "" || claimsTableName == "" {
+		return nil, errors.New("empty account links table name")
+	}
+	return &dbStore{
+		pooler:           p,
+		signalsTableName: signalsTableName,
+		claimsTableName:  claimsTableName}, nil
+}
+
+func (s *dbStore) Observe(accountID uint64, x *Signal) error {
+	_, err := s.pooler.WritePool().NewSession().InsertBySql(
+		"INSERT INTO "+s.signalsTableName+
+			" (kind, value, account_id, seen_at) VALUES (?, ?, ?, ?)"+
+			" ON DUPLICATE KEY UPDATE seen_at = VALUES(seen_at)",
+		x.Kind, x.Value, accountID, time.Unix(x.SeenAt, 0).UTC()).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	return nil
+}
+
+func (s *dbStore) Signals(accountID uint64) ([]*Signal, error) {
+	var rows []*dbSignal
+	_, err := s.pooler.ReadPool().NewSession().
+		Select("kind", "value", "seen_at").From(s.signalsTableName).
+		Where(dbr.Eq("account_id", accountID)).
+		OrderAsc("kind").OrderAsc("value").Load(&rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	a := make([]*Signal, 0, len(rows))
+	for _, r := range rows {
+		a = append(a, &Signal{Kind: r.Kind, Value: r.Value, SeenAt: r.SeenAt.Unix()})
+	}
+	return a, nil
+}
+
+func (s *dbStore) Accounts(kind, value string, limit int) ([]uint64, error) {
+	var a []uint64
+	_, err := s.pooler.ReadPool().NewSession().
+		Select("account_id").From(s.signalsTableName).
+		Where(dbr.Eq("kind", kind)).Where(dbr.Eq("value", value)).
+		OrderAsc("account_id").Limit(uint64(limit)).Load(&a)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	return a, nil
+}
+
+func (s *dbStore) Claimed(accountIDs []uint64, reward string) (bool, error) {
+	if len(accountIDs) == 0 {
+		return false, nil
+	}
+	var n int64
+	err := s.pooler.WritePool().NewSession().
+		Select("COUNT(*)").From(s.claimsTableName).
+		Where(dbr.Eq("reward", reward)).
+		Where(dbr.Eq("account_id", accountIDs)).LoadOne(&n)
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	return n > 0, nil
+}
+
+func (s *dbStore) Claim(accountID uint64, reward string) (bool, error) {
+	res, err := s.pooler.WritePool().NewSession().InsertBySql(
+		"INSERT IGNORE INTO "+s.claimsTableName+
+			" (reward, account_id, created_at) VALUES (?, ?, ?)",
+		reward, accountID, time.Now().UTC()).Exec()
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	return n == 1, nil
+}
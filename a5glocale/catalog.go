@@ -0,0 +1,68 @@
+package a5glocale
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/pkg/errors"
+)
+
+// Catalog holds messages by locale and key. Error messages are keyed by
+// "error." + the registered code name, e.g. "error.rate_limited".
+type Catalog struct {
+	Supported []string
+	Default   string
+
+	messages map[string]map[string]string
+}
+
+func NewCatalog(
+	m map[string]map[string]string, defaultLocale string) (*Catalog, error) {
+	if _, ok := m[defaultLocale]; !ok {
+		return nil, errors.Errorf("missing default locale %q messages",
+			defaultLocale)
+	}
+	c := &Catalog{Default: defaultLocale, messages: m}
+	for k := range m {
+		c.Supported = append(c.Supported, k)
+	}
+	sort.Strings(c.Supported)
+	return c, nil
+}
+
+// T returns the message of key in locale, falling back to the locale's
+// language and then to Default.
+func (c *Catalog) T(locale, key string) (string, bool) {
+	for _, x := range []string{Match(c.Supported, locale), c.Default} {
+		if s, ok := c.messages[x][key]; ok {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+// LocalizeErr implements a5gapi.ErrLocalizer for the locale of ctx, so
+// that a5gapi.Responder translates registered error messages keeping the
+// details appended to them.
+func (c *Catalog) LocalizeErr(
+	ctx context.Context, e *a5gapi.APIErr) (string, bool) {
+	locale := FromContext(ctx)
+	if locale == "" {
+		return "", false
+	}
+	d, ok := a5gapi.DefaultErrCodes.Lookup(a5gapi.APIErrCode(e.Code))
+	if !ok {
+		return "", false
+	}
+	s, ok := c.T(locale, "error."+d.Name)
+	if !ok {
+		return "", false
+	}
+	msg := e.Error()
+	if d.Message != "" && strings.HasPrefix(msg, d.Message+": ") {
+		s += msg[len(d.Message):]
+	}
+	return s, true
+}
@@ -0,0 +1,190 @@
+package a5glocale
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/pkg/errors"
+)
+
+// LocaleHeader carries the language picked in the client settings, it
+// wins over Accept-Language.
+const LocaleHeader = "X-Locale"
+
+var ErrLocaleUnsupported = errors.New("locale unsupported")
+
+// DeviceRegistry knows locales of devices reported at registration, e.g.
+// by push token registration.
+type DeviceRegistry interface {
+	DeviceLocale(deviceID string) (string, error)
+}
+
+// CountryFunc resolves an ISO 3166 country code of a client address,
+// usually from a GeoIP database; empty when unknown.
+type CountryFunc func(net.IP) (string, error)
+
+// Detector picks the locale of a request: the one the player chose
+// explicitly, then the client headers, the device registry, the client
+// country and the one detected last time, and Default at last. Detected
+// locales of signed in players are persisted, so that mail, push and news
+// built outside of requests use PlayerLocale.
+type Detector struct {
+	Supported []string
+	Default   string
+	Logger    a5glogs.Logger
+	Store     Store
+	Devices   DeviceRegistry
+	Country   CountryFunc
+	// CountryLocales maps upper case country codes to locales.
+	CountryLocales map[string]string
+}
+
+func NewDetector(
+	supported []string, defaultLocale string,
+	l a5glogs.Logger) (*Detector, error) {
+	if Match(supported, defaultLocale) != defaultLocale {
+		return nil, errors.Errorf(
+			"default locale %q is not supported", defaultLocale)
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Detector{
+		Supported:      supported,
+		Default:        defaultLocale,
+		Logger:         l,
+		CountryLocales: make(map[string]string)}, nil
+}
+
+func (d *Detector) Detect(r *http.Request) string {
+	ctx := r.Context()
+	accountID := a5gapi.AccountIDFromContext(ctx)
+	var p *Preference
+	if accountID != 0 && d.Store != nil {
+		var err error
+		if p, err = d.Store.Get(accountID); err != nil {
+			d.Logger.Error(err.Error())
+		}
+		if p != nil && p.Explicit {
+			if s := Match(d.Supported, p.Locale); s != "" {
+				return s
+			}
+		}
+	}
+	s := d.fromHeaders(r)
+	if s == "" {
+		s = d.fromDevice(r)
+	}
+	if s == "" {
+		s = d.fromCountry(r)
+	}
+	if s == "" && p != nil {
+		s = Match(d.Supported, p.Locale)
+	}
+	if s == "" {
+		s = d.Default
+	}
+	if accountID != 0 && d.Store != nil && (p == nil || p.Locale != s) {
+		if err := d.Store.Set(accountID, &Preference{Locale: s}); err != nil {
+			d.Logger.Error(err.Error())
+		}
+	}
+	return s
+}
+
+func (d *Detector) fromHeaders(r *http.Request) string {
+	if s := Match(d.Supported, r.Header.Get(LocaleHeader)); s != "" {
+		return s
+	}
+	for _, tag := range ParseAcceptLanguage(r.Header.Get("Accept-Language")) {
+		if s := Match(d.Supported, tag); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+func (d *Detector) fromDevice(r *http.Request) string {
+	if d.Devices == nil {
+		return ""
+	}
+	sess, ok := a5gsession.FromContext(r.Context())
+	if !ok || sess.DeviceID == "" {
+		return ""
+	}
+	s, err := d.Devices.DeviceLocale(sess.DeviceID)
+	if err != nil {
+		d.Logger.With(a5gfields.String("deviceId", sess.DeviceID)).
+			Warn(err.Error())
+		return ""
+	}
+	return Match(d.Supported, s)
+}
+
+func (d *Detector) fromCountry(r *http.Request) string {
+	if d.Country == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return ""
+	}
+	c, err := d.Country(ip)
+	if err != nil {
+		d.Logger.Warn(err.Error())
+		return ""
+	}
+	return Match(d.Supported, d.CountryLocales[strings.ToUpper(c)])
+}
+
+// Middleware puts the detected locale into the request context. Mount it
+// after the a5gsession middleware so that players' locales persist.
+func (d *Detector) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(
+			ContextWithLocale(r.Context(), d.Detect(r))))
+	})
+}
+
+// PlayerLocale is the persisted locale of a player or Default.
+func (d *Detector) PlayerLocale(accountID uint64) (string, error) {
+	if d.Store == nil {
+		return d.Default, nil
+	}
+	p, err := d.Store.Get(accountID)
+	if err != nil {
+		return "", err
+	}
+	if p != nil {
+		if s := Match(d.Supported, p.Locale); s != "" {
+			return s, nil
+		}
+	}
+	return d.Default, nil
+}
+
+// SetLocale persists the locale the player chose, it wins over detection
+// from then on.
+func (d *Detector) SetLocale(accountID uint64, locale string) (string, error) {
+	s := Match(d.Supported, locale)
+	if s == "" {
+		return "", errors.Wrap(ErrLocaleUnsupported, locale)
+	}
+	if d.Store == nil {
+		return "", errors.New("locale store missing")
+	}
+	if err := d.Store.Set(
+		accountID, &Preference{Locale: s, Explicit: true}); err != nil {
+		return "", err
+	}
+	return s, nil
+}
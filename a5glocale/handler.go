@@ -0,0 +1,48 @@
+package a5glocale
+
+import (
+	"context"
+	"strings"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/pkg/errors"
+)
+
+type SetLocaleRequest struct {
+	Locale string `json:"locale" validate:"required,max=16"`
+}
+
+type SetLocaleResponse struct {
+	Locale string `json:"locale"`
+}
+
+// SetLocaleHandler stores the language a5gsession authenticated players
+// pick, e.g. on the welcome screen; unsupported locales fail validation of
+// the "locale" field.
+func (d *Detector) SetLocaleHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(SetLocaleRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			p := req.Payload.(*SetLocaleRequest)
+			locale, err := d.SetLocale(s.AccountID, p.Locale)
+			if errors.Cause(err) == ErrLocaleUnsupported {
+				e := a5gapi.NewErr(
+					a5gvalidate.ErrCodeOneOf, "%s", strings.Join(d.Supported, " "))
+				e.Field = "locale"
+				return nil, []*a5gapi.APIErr{e}
+			}
+			if err != nil {
+				d.Logger.Error(err.Error())
+				return nil, a5gapi.NewJSONMsgDefautlErrors(err)
+			}
+			return &SetLocaleResponse{Locale: locale}, nil
+		})
+}
@@ -0,0 +1,93 @@
+package a5glocale
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type ctxKey int
+
+const ctxKeyLocale ctxKey = iota
+
+// ContextWithLocale stores the locale Detector picked for the request.
+func ContextWithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, ctxKeyLocale, locale)
+}
+
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	s, _ := ctx.Value(ctxKeyLocale).(string)
+	return s
+}
+
+// Match returns the supported locale for a language tag: the exact one or
+// one of the same language, e.g. "pt-BR" for "pt" and "pt" for "pt_PT".
+// It is empty when nothing matches.
+func Match(supported []string, tag string) string {
+	tag = normalize(tag)
+	if tag == "" {
+		return ""
+	}
+	for _, x := range supported {
+		if normalize(x) == tag {
+			return x
+		}
+	}
+	lang := language(tag)
+	for _, x := range supported {
+		if language(normalize(x)) == lang {
+			return x
+		}
+	}
+	return ""
+}
+
+// ParseAcceptLanguage returns tags of an Accept-Language header by
+// descending quality, skipping "*" and refused ones.
+func ParseAcceptLanguage(s string) []string {
+	type tag struct {
+		name string
+		q    float64
+	}
+	var a []tag
+	for _, x := range strings.Split(s, ",") {
+		parts := strings.Split(x, ";")
+		t := tag{name: strings.TrimSpace(parts[0]), q: 1}
+		for _, p := range parts[1:] {
+			p = strings.TrimSpace(p)
+			if !strings.HasPrefix(p, "q=") {
+				continue
+			}
+			q, err := strconv.ParseFloat(p[2:], 64)
+			if err != nil {
+				q = 0
+			}
+			t.q = q
+		}
+		if t.name == "" || t.name == "*" || t.q <= 0 {
+			continue
+		}
+		a = append(a, t)
+	}
+	sort.SliceStable(a, func(i, j int) bool { return a[i].q > a[j].q })
+	tags := make([]string, len(a))
+	for i, t := range a {
+		tags[i] = t.name
+	}
+	return tags
+}
+
+func normalize(tag string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(tag), "_", "-", -1))
+}
+
+func language(tag string) string {
+	if i := strings.IndexByte(tag, '-'); i >= 0 {
+		return tag[:i]
+	}
+	return tag
+}
@@ -0,0 +1,87 @@
+package a5glocale
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/sirupsen/logrus"
+)
+
+func TestDetector(t *testing.T) {
+	d, err := NewDetector([]string{"en", "ru", "pt-BR"}, "en",
+		a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Store = NewMemoryStore()
+	d.Country = func(ip net.IP) (string, error) { return "by", nil }
+	d.CountryLocales["BY"] = "ru"
+	tests := []struct {
+		accountID uint64
+		locale    string
+		accept    string
+		expected  string
+	}{
+		{0, "", "de-DE, pt;q=0.9, ru;q=0.5", "pt-BR"},
+		{0, "RU", "pt", "ru"},
+		{0, "", "de, *", "ru"},
+		{7, "", "en-GB;q=0.8, de", "en"},
+		{7, "", "", "ru"},
+	}
+	for _, x := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set(LocaleHeader, x.locale)
+		r.Header.Set("Accept-Language", x.accept)
+		if x.accountID != 0 {
+			r = r.WithContext(
+				a5gapi.ContextWithAccountID(r.Context(), x.accountID))
+		}
+		if s := d.Detect(r); s != x.expected {
+			t.Errorf("%q %q: expected %q, got %q", x.locale, x.accept, x.expected, s)
+		}
+	}
+	if s, err := d.PlayerLocale(7); err != nil || s != "ru" {
+		t.Errorf("expected persisted ru, got %q %v", s, err)
+	}
+	if _, err = d.SetLocale(7, "pt_br"); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(LocaleHeader, "en")
+	if s := d.Detect(r.WithContext(
+		a5gapi.ContextWithAccountID(r.Context(), 7))); s != "pt-BR" {
+		t.Errorf("expected explicit pt-BR, got %q", s)
+	}
+	if _, err = d.SetLocale(7, "de"); err == nil {
+		t.Error("expected unsupported locale error")
+	}
+}
+
+var testErrCode = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+	Code:     9401,
+	Name:     "test_locale",
+	Severity: a5gapi.ErrSeverityWarn,
+	Public:   true,
+	Message:  "not enough gems"})
+
+func TestCatalogLocalizeErr(t *testing.T) {
+	c, err := NewCatalog(map[string]map[string]string{
+		"en": {},
+		"ru": {"error.test_locale": "недостаточно кристаллов"}}, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := ContextWithLocale(context.Background(), "ru-RU")
+	s, ok := c.LocalizeErr(ctx, a5gapi.NewErr(testErrCode, "%d", 5))
+	if !ok || s != "недостаточно кристаллов: 5" {
+		t.Errorf("unexpected translation %q", s)
+	}
+	if _, ok = c.LocalizeErr(
+		ContextWithLocale(context.Background(), "en"), a5gapi.NewErr(testErrCode, "")); ok {
+		t.Error("expected no english translation")
+	}
+}
@@ -0,0 +1,102 @@
+package a5glocale
+
+import (
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+// Preference is the persisted locale of a player, Explicit when chosen by
+// the player rather than detected.
+type Preference struct {
+	Locale   string
+	Explicit bool
+}
+
+// Store persists player locales, Get returns nil for unknown players.
+type Store interface {
+	Get(accountID uint64) (*Preference, error)
+	Set(accountID uint64, p *Preference) error
+}
+
+type memoryStore struct {
+	mu sync.RWMutex
+	m  map[uint64]Preference
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{m: make(map[uint64]Preference)}
+}
+
+func (s *memoryStore) Get(accountID uint64) (*Preference, error) {
+	s.mu.RLock()
+	p, ok := s.m[accountID]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, nil
+	}
+	return &p, nil
+}
+
+func (s *memoryStore) Set(accountID uint64, p *Preference) error {
+	s.mu.Lock()
+	s.m[accountID] = *p
+	s.mu.Unlock()
+	return nil
+}
+
+// dbStore keeps player locales in a MySQL table:
+//
+//	CREATE TABLE player_locales (
+//	  account_id BIGINT UNSIGNED PRIMARY KEY,
+//	  locale VARCHAR(16) NOT NULL,
+//	  explicit TINYINT NOT NULL,
+//	  updated_at DATETIME NOT NULL);
+type dbStore struct {
+	pooler    a5gdb.Pooler
+	tableName string
+}
+
+type dbPreference struct {
+	Locale   string `db:"locale"`
+	Explicit bool   `db:"explicit"`
+}
+
+func NewDBStore(p a5gdb.Pooler, tableName string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if tableName == "" {
+		return nil, errors.New("empty locale table name")
+	}
+	return &dbStore{pooler: p, tableName: tableName}, nil
+}
+
+func (s *dbStore) Get(accountID uint64) (*Preference, error) {
+	x := new(dbPreference)
+	err := s.pooler.ReadPool().NewSession().Select("locale", "explicit").
+		From(s.tableName).Where(dbr.Eq("account_id", accountID)).LoadOne(x)
+	if err == dbr.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	return &Preference{Locale: x.Locale, Explicit: x.Explicit}, nil
+}
+
+func (s *dbStore) Set(accountID uint64, p *Preference) error {
+	_, err := s.pooler.WritePool().NewSession().InsertBySql(
+		"INSERT INTO "+s.tableName+
+			" (account_id, locale, explicit, updated_at) VALUES (?, ?, ?, ?)"+
+			" ON DUPLICATE KEY UPDATE locale = VALUES(locale),"+
+			" explicit = VALUES(explicit), updated_at = VALUES(updated_at)",
+		accountID, p.Locale, p.Explicit, time.Now().UTC()).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+//go:build go1.21
+// +build go1.21
+
+// Package a5gslog adapts log/slog (Go 1.21+) to a5glogs.Logger.
+package a5gslog
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5glogs"
+)
+
+// NewWrapper adapts l. Panic and Fatal log at error level before
+// panicking or exiting, as logrus and zap do.
+func NewWrapper(l *slog.Logger) a5glogs.Logger {
+	return &slogWrapper{logger: l}
+}
+
+type slogWrapper struct{ logger *slog.Logger }
+
+func slogAttrs(a []a5gfields.Field) []slog.Attr {
+	x := make([]slog.Attr, len(a))
+	for i, v := range a {
+		x[i] = slog.String(v.Key(), v.Value())
+	}
+	return x
+}
+
+func (l *slogWrapper) log(level slog.Level, s string, a []a5gfields.Field) {
+	l.logger.LogAttrs(context.Background(), level, s, slogAttrs(a)...)
+}
+
+func (l *slogWrapper) With(a ...a5gfields.Field) a5glogs.Logger {
+	x := make([]interface{}, len(a))
+	for i, v := range slogAttrs(a) {
+		x[i] = v
+	}
+	return &slogWrapper{logger: l.logger.With(x...)}
+}
+
+func (l *slogWrapper) Debug(s string, a ...a5gfields.Field) {
+	l.log(slog.LevelDebug, s, a)
+}
+
+func (l *slogWrapper) Info(s string, a ...a5gfields.Field) {
+	l.log(slog.LevelInfo, s, a)
+}
+
+func (l *slogWrapper) Warn(s string, a ...a5gfields.Field) {
+	l.log(slog.LevelWarn, s, a)
+}
+
+func (l *slogWrapper) Error(s string, a ...a5gfields.Field) {
+	l.log(slog.LevelError, s, a)
+}
+
+func (l *slogWrapper) Panic(s string, a ...a5gfields.Field) {
+	l.log(slog.LevelError, s, a)
+	panic(s)
+}
+
+func (l *slogWrapper) Fatal(s string, a ...a5gfields.Field) {
+	l.log(slog.LevelError, s, a)
+	os.Exit(1)
+}
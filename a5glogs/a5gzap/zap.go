@@ -0,0 +1,51 @@
+// Package a5gzap adapts go.uber.org/zap to a5glogs.Logger. It lives apart
+// from a5glogs so that importers of the latter do not pull zap in.
+package a5gzap
+
+import (
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5glogs"
+	"go.uber.org/zap"
+)
+
+func NewWrapper(l *zap.Logger) a5glogs.Logger {
+	return &zapWrapper{logger: l}
+}
+
+type zapWrapper struct{ logger *zap.Logger }
+
+func zapFields(a []a5gfields.Field) []zap.Field {
+	f := make([]zap.Field, len(a))
+	for i, v := range a {
+		f[i] = zap.String(v.Key(), v.Value())
+	}
+	return f
+}
+
+func (l *zapWrapper) With(a ...a5gfields.Field) a5glogs.Logger {
+	return &zapWrapper{logger: l.logger.With(zapFields(a)...)}
+}
+
+func (l *zapWrapper) Debug(s string, a ...a5gfields.Field) {
+	l.logger.Debug(s, zapFields(a)...)
+}
+
+func (l *zapWrapper) Info(s string, a ...a5gfields.Field) {
+	l.logger.Info(s, zapFields(a)...)
+}
+
+func (l *zapWrapper) Warn(s string, a ...a5gfields.Field) {
+	l.logger.Warn(s, zapFields(a)...)
+}
+
+func (l *zapWrapper) Error(s string, a ...a5gfields.Field) {
+	l.logger.Error(s, zapFields(a)...)
+}
+
+func (l *zapWrapper) Panic(s string, a ...a5gfields.Field) {
+	l.logger.Panic(s, zapFields(a)...)
+}
+
+func (l *zapWrapper) Fatal(s string, a ...a5gfields.Field) {
+	l.logger.Fatal(s, zapFields(a)...)
+}
@@ -0,0 +1,63 @@
+package a5gmatchmaking
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+var ErrCrossPlayDenied = errors.New("cross-play not allowed")
+
+// Device is what a player plays on. NoCrossPlay opts the player out of
+// matches with other platforms.
+type Device struct {
+	Platform    string `json:"platform,omitempty"`
+	Input       string `json:"input,omitempty"`
+	NoCrossPlay bool   `json:"noCrossPlay,omitempty"`
+}
+
+// CrossPlay restricts who plays together by Device per pool. Platforms
+// lists the platforms a pool admits, e.g. console-only pools, unlisted
+// pools admit any; SameInput lists pools where everyone uses the same
+// input, e.g. no gamepads against mice. Opt-outs apply in every pool.
+type CrossPlay struct {
+	Platforms map[string][]string `json:"platforms,omitempty"`
+	SameInput []string            `json:"sameInput,omitempty"`
+}
+
+func NewCrossPlayJSON(b []byte) (*CrossPlay, error) {
+	c := new(CrossPlay)
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return c, nil
+}
+
+// Admits reports whether a pool admits players on d, a nil CrossPlay
+// admits anyone.
+func (c *CrossPlay) Admits(pool string, d Device) bool {
+	if c == nil {
+		return true
+	}
+	platforms, ok := c.Platforms[pool]
+	return !ok || contains(platforms, d.Platform)
+}
+
+// Compatible reports whether players on a and b may play together in a
+// pool.
+func (c *CrossPlay) Compatible(pool string, a, b Device) bool {
+	if (a.NoCrossPlay || b.NoCrossPlay) && a.Platform != b.Platform {
+		return false
+	}
+	return c == nil || a.Input == b.Input || !contains(c.SameInput, pool)
+}
+
+// compatible reports whether t may join every member of group.
+func (c *CrossPlay) compatible(group []*Ticket, t *Ticket) bool {
+	for _, x := range group {
+		if !c.Compatible(t.Pool, x.Device, t.Device) {
+			return false
+		}
+	}
+	return true
+}
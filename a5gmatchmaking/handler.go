@@ -0,0 +1,303 @@
+package a5gmatchmaking
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCodePoolUnknown = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4044,
+		Name:     "matchmaking_pool_unknown",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "matchmaking pool not found"})
+
+	ErrCodeAlreadyQueued = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4092,
+		Name:     "matchmaking_already_queued",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "already in matchmaking queue"})
+
+	ErrCodeCrossPlayDenied = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4039,
+		Name:     "matchmaking_cross_play_denied",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "not allowed to play with these platforms"})
+
+	ErrCodeNotHost = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4038,
+		Name:     "lobby_not_host",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "only the lobby host may do this"})
+
+	ErrCodeLobbyUnknown = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4064,
+		Name:     "lobby_unknown",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "lobby not found or expired"})
+
+	ErrCodeLobbyFull = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4258,
+		Name:     "lobby_full",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "lobby full"})
+
+	ErrCodeLobbyBusy = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4259,
+		Name:     "lobby_busy",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "lobby changed, try again"})
+
+	ErrCodeLobbyShort = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4261,
+		Name:     "lobby_short",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "not enough players in lobby"})
+
+	ErrCodeLobbyCapacity = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4262,
+		Name:     "lobby_capacity",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "lobby capacity out of bounds"})
+)
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodePoolUnknown, http.StatusNotFound)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeAlreadyQueued, http.StatusConflict)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeCrossPlayDenied, http.StatusForbidden)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeNotHost, http.StatusForbidden)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeLobbyUnknown, http.StatusNotFound)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeLobbyFull, http.StatusConflict)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeLobbyBusy, http.StatusConflict)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeLobbyShort, http.StatusUnprocessableEntity)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeLobbyCapacity, http.StatusUnprocessableEntity)
+}
+
+// TicketFunc builds the ticket of a player entering pool from game data:
+// rating and constraints never come from the client.
+type TicketFunc func(
+	ctx context.Context, accountID uint64, pool string) (*Ticket, error)
+
+// DeviceFunc returns the device of a player, e.g. from the platform of
+// their login and their settings.
+type DeviceFunc func(ctx context.Context, accountID uint64) (Device, error)
+
+type EnqueueRequest struct {
+	Pool string `json:"pool" validate:"required,max=64"`
+}
+
+type CancelResponse struct {
+	Canceled bool `json:"canceled"`
+}
+
+// EnqueueHandler queues the a5gsession authenticated player and answers
+// with the ticket; the match arrives through the Notifier.
+func (m *Matchmaker) EnqueueHandler(fn TicketFunc) a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(EnqueueRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			p := req.Payload.(*EnqueueRequest)
+			t, err := fn(ctx, s.AccountID, p.Pool)
+			if err == nil {
+				t.PlayerID, t.Pool = s.AccountID, p.Pool
+				err = m.Enqueue(t)
+			}
+			switch errors.Cause(err) {
+			case nil:
+				return t, nil
+			case ErrPoolUnknown:
+				return nil, []*a5gapi.APIErr{a5gapi.NewErr(ErrCodePoolUnknown, "")}
+			case ErrAlreadyQueued:
+				return nil, []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeAlreadyQueued, "")}
+			case ErrCrossPlayDenied:
+				return nil, []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeCrossPlayDenied, "")}
+			}
+			m.Logger.Error(err.Error())
+			return nil, a5gapi.NewJSONMsgDefautlErrors(err)
+		})
+}
+
+// CancelHandler dequeues the a5gsession authenticated player.
+func (m *Matchmaker) CancelHandler() a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		s, ok := a5gsession.FromContext(ctx)
+		if !ok {
+			return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+		}
+		canceled, err := m.Cancel(s.AccountID)
+		if err != nil {
+			m.Logger.Error(err.Error())
+			return nil, a5gapi.NewJSONMsgDefautlErrors(err)
+		}
+		return &CancelResponse{Canceled: canceled}, nil
+	}
+}
+
+type CreateLobbyRequest struct {
+	Pool     string            `json:"pool" validate:"required,max=64"`
+	Capacity int               `json:"capacity" validate:"min=2"`
+	Rules    map[string]string `json:"rules" validate:"max=32"`
+}
+
+type LobbyRequest struct {
+	Code string `json:"code" validate:"required,pattern=^[A-Za-z0-9]{6}$"`
+}
+
+type LobbyRulesRequest struct {
+	Code  string            `json:"code" validate:"required,pattern=^[A-Za-z0-9]{6}$"`
+	Rules map[string]string `json:"rules" validate:"max=32"`
+}
+
+type KickRequest struct {
+	Code     string `json:"code" validate:"required,pattern=^[A-Za-z0-9]{6}$"`
+	PlayerID uint64 `json:"playerId" validate:"min=1"`
+}
+
+type LeaveResponse struct {
+	Left bool `json:"left"`
+}
+
+// lobbyHandler runs fn for the a5gsession authenticated player.
+func (ls *Lobbies) lobbyHandler(newReq func() interface{}, fn func(
+	ctx context.Context, accountID uint64, req interface{}) (interface{}, error),
+) a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(newReq,
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			res, err := fn(ctx, s.AccountID, req.Payload)
+			if err != nil {
+				return nil, ls.apiErrs(err)
+			}
+			return res, nil
+		})
+}
+
+// CreateLobbyHandler opens a lobby hosted by the session player, the
+// answer carries its join code.
+func (ls *Lobbies) CreateLobbyHandler(fn DeviceFunc) a5ghttp.HandlerFunc {
+	return ls.lobbyHandler(
+		func() interface{} { return new(CreateLobbyRequest) },
+		func(ctx context.Context, accountID uint64, req interface{}) (
+			interface{}, error) {
+			d, err := fn(ctx, accountID)
+			if err != nil {
+				return nil, err
+			}
+			r := req.(*CreateLobbyRequest)
+			return ls.Create(accountID, d, r.Pool, r.Capacity, r.Rules)
+		})
+}
+
+// JoinLobbyHandler adds the session player to a lobby by code.
+func (ls *Lobbies) JoinLobbyHandler(fn DeviceFunc) a5ghttp.HandlerFunc {
+	return ls.lobbyHandler(
+		func() interface{} { return new(LobbyRequest) },
+		func(ctx context.Context, accountID uint64, req interface{}) (
+			interface{}, error) {
+			d, err := fn(ctx, accountID)
+			if err != nil {
+				return nil, err
+			}
+			return ls.Join(strings.ToUpper(req.(*LobbyRequest).Code), accountID, d)
+		})
+}
+
+// LeaveLobbyHandler removes the session player from a lobby, closing it
+// when they host it.
+func (ls *Lobbies) LeaveLobbyHandler() a5ghttp.HandlerFunc {
+	return ls.lobbyHandler(
+		func() interface{} { return new(LobbyRequest) },
+		func(ctx context.Context, accountID uint64, req interface{}) (
+			interface{}, error) {
+			err := ls.Leave(strings.ToUpper(req.(*LobbyRequest).Code), accountID)
+			if err != nil {
+				return nil, err
+			}
+			return &LeaveResponse{Left: true}, nil
+		})
+}
+
+// LobbyRulesHandler replaces the rules of a lobby the session player
+// hosts.
+func (ls *Lobbies) LobbyRulesHandler() a5ghttp.HandlerFunc {
+	return ls.lobbyHandler(
+		func() interface{} { return new(LobbyRulesRequest) },
+		func(ctx context.Context, accountID uint64, req interface{}) (
+			interface{}, error) {
+			r := req.(*LobbyRulesRequest)
+			return ls.SetRules(strings.ToUpper(r.Code), accountID, r.Rules)
+		})
+}
+
+// KickHandler removes a member from a lobby the session player hosts.
+func (ls *Lobbies) KickHandler() a5ghttp.HandlerFunc {
+	return ls.lobbyHandler(
+		func() interface{} { return new(KickRequest) },
+		func(ctx context.Context, accountID uint64, req interface{}) (
+			interface{}, error) {
+			r := req.(*KickRequest)
+			return ls.Kick(strings.ToUpper(r.Code), accountID, r.PlayerID)
+		})
+}
+
+// StartLobbyHandler starts a lobby the session player hosts, members
+// receive the match through the Notifier.
+func (ls *Lobbies) StartLobbyHandler() a5ghttp.HandlerFunc {
+	return ls.lobbyHandler(
+		func() interface{} { return new(LobbyRequest) },
+		func(ctx context.Context, accountID uint64, req interface{}) (
+			interface{}, error) {
+			return ls.Start(strings.ToUpper(req.(*LobbyRequest).Code), accountID)
+		})
+}
+
+func (ls *Lobbies) apiErrs(err error) []*a5gapi.APIErr {
+	switch errors.Cause(err) {
+	case ErrPoolUnknown:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodePoolUnknown, "")}
+	case ErrCrossPlayDenied:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeCrossPlayDenied, "")}
+	case ErrNotHost:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeNotHost, "")}
+	case ErrLobbyUnknown:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeLobbyUnknown, "")}
+	case ErrLobbyFull:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeLobbyFull, "")}
+	case ErrLobbyBusy:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeLobbyBusy, "")}
+	case ErrLobbyShort:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeLobbyShort, "")}
+	case ErrLobbyCapacity:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeLobbyCapacity, "%s", err)}
+	}
+	ls.Logger.Error(err.Error())
+	return a5gapi.NewJSONMsgDefautlErrors(err)
+}
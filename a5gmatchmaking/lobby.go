@@ -0,0 +1,298 @@
+package a5gmatchmaking
+
+import (
+	"crypto/rand"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrLobbyUnknown = errors.New("lobby unknown")
+	ErrLobbyFull    = errors.New("lobby full")
+	ErrLobbyBusy    = errors.New("lobby changed concurrently")
+	ErrNotHost      = errors.New("not the lobby host")
+	ErrLobbyShort   = errors.New("not enough lobby members")
+
+	ErrLobbyCapacity = errors.New("lobby capacity out of bounds")
+)
+
+// codeAlphabet leaves out look-alike characters, codes are read aloud and
+// typed on gamepads.
+const codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// Lobby is a private match players join by Code. The Host sets its Rules
+// and starts it; ExpiresAt is in unix seconds. Devices are those of
+// Members, checked against the CrossPlay of the Matchmaker on joins.
+type Lobby struct {
+	Code      string            `json:"code"`
+	Host      uint64            `json:"host"`
+	Pool      string            `json:"pool"`
+	Capacity  int               `json:"capacity"`
+	Rules     map[string]string `json:"rules,omitempty"`
+	Members   []uint64          `json:"members"`
+	Devices   map[uint64]Device `json:"devices"`
+	ExpiresAt int64             `json:"expiresAt"`
+	Version   int64             `json:"version"`
+}
+
+func (l *Lobby) clone() *Lobby {
+	x := *l
+	x.Members = append([]uint64(nil), l.Members...)
+	x.Devices = make(map[uint64]Device, len(l.Devices))
+	for id, d := range l.Devices {
+		x.Devices[id] = d
+	}
+	if l.Rules != nil {
+		x.Rules = make(map[string]string, len(l.Rules))
+		for k, v := range l.Rules {
+			x.Rules[k] = v
+		}
+	}
+	return &x
+}
+
+// LobbyStore keeps lobbies until they expire. Update replaces prev with
+// next unless the lobby changed since prev was read, nil prev creates it
+// unless the code is taken and nil next deletes it.
+type LobbyStore interface {
+	Get(code string) (*Lobby, error)
+	Update(prev, next *Lobby) (bool, error)
+}
+
+// Lobbies runs private lobbies; started ones become matches delivered by
+// the Notifier of Matchmaker like queued ones.
+type Lobbies struct {
+	Store       LobbyStore
+	Matchmaker  *Matchmaker
+	Logger      a5glogs.Logger
+	TTL         time.Duration
+	MaxCapacity int
+
+	now     func() time.Time
+	newCode func() (string, error)
+}
+
+func NewLobbies(s LobbyStore, m *Matchmaker, l a5glogs.Logger) (*Lobbies, error) {
+	if s == nil {
+		return nil, errors.New("lobby store missing")
+	}
+	if m == nil {
+		return nil, errors.New("matchmaker missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Lobbies{
+		Store:       s,
+		Matchmaker:  m,
+		Logger:      l,
+		TTL:         30 * time.Minute,
+		MaxCapacity: 16,
+		now:         time.Now,
+		newCode:     randomCode}, nil
+}
+
+func randomCode() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.WithStack(err)
+	}
+	for i := range b {
+		b[i] = codeAlphabet[int(b[i])%len(codeAlphabet)]
+	}
+	return string(b), nil
+}
+
+// Create opens a lobby of host, retrying codes taken by other lobbies.
+func (ls *Lobbies) Create(host uint64, d Device, pool string, capacity int,
+	rules map[string]string) (*Lobby, error) {
+	if len(ls.Matchmaker.Pools) > 0 && !contains(ls.Matchmaker.Pools, pool) {
+		return nil, errors.Wrap(ErrPoolUnknown, pool)
+	}
+	if !ls.Matchmaker.CrossPlay.Admits(pool, d) {
+		return nil, errors.Wrap(ErrCrossPlayDenied, d.Platform)
+	}
+	if capacity < 2 || capacity > ls.MaxCapacity {
+		return nil, errors.Wrapf(ErrLobbyCapacity, "%d out of [2, %d]",
+			capacity, ls.MaxCapacity)
+	}
+	l := &Lobby{
+		Host:      host,
+		Pool:      pool,
+		Capacity:  capacity,
+		Rules:     rules,
+		Members:   []uint64{host},
+		Devices:   map[uint64]Device{host: d},
+		ExpiresAt: ls.now().Add(ls.TTL).Unix(),
+		Version:   1}
+	for i := 0; i < 5; i++ {
+		code, err := ls.newCode()
+		if err != nil {
+			return nil, err
+		}
+		l.Code = code
+		ok, err := ls.Store.Update(nil, l)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return l, nil
+		}
+	}
+	return nil, errors.New("no free lobby code")
+}
+
+// Get returns a lobby unless it is gone or expired.
+func (ls *Lobbies) Get(code string) (*Lobby, error) {
+	l, err := ls.Store.Get(code)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil || l.ExpiresAt <= ls.now().Unix() {
+		return nil, errors.Wrap(ErrLobbyUnknown, code)
+	}
+	return l, nil
+}
+
+func (ls *Lobbies) save(prev, next *Lobby) (*Lobby, error) {
+	if next != nil {
+		next.Version = prev.Version + 1
+	}
+	ok, err := ls.Store.Update(prev, next)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.Wrap(ErrLobbyBusy, prev.Code)
+	}
+	return next, nil
+}
+
+// Join adds a player on d to a lobby if the pool admits d and every
+// member plays with it; joining again is a no-op.
+func (ls *Lobbies) Join(code string, playerID uint64, d Device) (*Lobby, error) {
+	l, err := ls.Get(code)
+	if err != nil {
+		return nil, err
+	}
+	if containsID(l.Members, playerID) {
+		return l, nil
+	}
+	if len(l.Members) >= l.Capacity {
+		return nil, ErrLobbyFull
+	}
+	c := ls.Matchmaker.CrossPlay
+	if !c.Admits(l.Pool, d) {
+		return nil, errors.Wrap(ErrCrossPlayDenied, d.Platform)
+	}
+	for _, id := range l.Members {
+		if !c.Compatible(l.Pool, l.Devices[id], d) {
+			return nil, errors.Wrap(ErrCrossPlayDenied, d.Platform)
+		}
+	}
+	x := l.clone()
+	x.Members = append(x.Members, playerID)
+	x.Devices[playerID] = d
+	return ls.save(l, x)
+}
+
+// Leave removes a player from a lobby; the lobby closes when its host
+// leaves.
+func (ls *Lobbies) Leave(code string, playerID uint64) error {
+	l, err := ls.Get(code)
+	if err != nil {
+		return err
+	}
+	if l.Host == playerID {
+		_, err = ls.save(l, nil)
+		return err
+	}
+	if !containsID(l.Members, playerID) {
+		return nil
+	}
+	_, err = ls.save(l, without(l, playerID))
+	return err
+}
+
+func without(l *Lobby, playerID uint64) *Lobby {
+	x := l.clone()
+	x.Members = x.Members[:0]
+	delete(x.Devices, playerID)
+	for _, id := range l.Members {
+		if id != playerID {
+			x.Members = append(x.Members, id)
+		}
+	}
+	return x
+}
+
+func (ls *Lobbies) hosted(code string, host uint64) (*Lobby, error) {
+	l, err := ls.Get(code)
+	if err != nil {
+		return nil, err
+	}
+	if l.Host != host {
+		return nil, ErrNotHost
+	}
+	return l, nil
+}
+
+// SetRules replaces the rules of a lobby of host.
+func (ls *Lobbies) SetRules(
+	code string, host uint64, rules map[string]string) (*Lobby, error) {
+	l, err := ls.hosted(code, host)
+	if err != nil {
+		return nil, err
+	}
+	x := l.clone()
+	x.Rules = rules
+	return ls.save(l, x)
+}
+
+// Kick removes a member from a lobby of host.
+func (ls *Lobbies) Kick(code string, host, playerID uint64) (*Lobby, error) {
+	l, err := ls.hosted(code, host)
+	if err != nil {
+		return nil, err
+	}
+	if playerID == host || !containsID(l.Members, playerID) {
+		return l, nil
+	}
+	return ls.save(l, without(l, playerID))
+}
+
+// Start closes a lobby of host and delivers its members as a match with
+// the lobby rules.
+func (ls *Lobbies) Start(code string, host uint64) (*Match, error) {
+	l, err := ls.hosted(code, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(l.Members) < 2 {
+		return nil, ErrLobbyShort
+	}
+	if _, err = ls.save(l, nil); err != nil {
+		return nil, err
+	}
+	now := ls.now()
+	group := make([]*Ticket, len(l.Members))
+	for i, id := range l.Members {
+		group[i] = &Ticket{PlayerID: id, Pool: l.Pool, Device: l.Devices[id],
+			EnqueuedAt: now.UnixNano() / int64(time.Millisecond)}
+	}
+	m, err := ls.Matchmaker.newMatch(group, now)
+	if err == nil {
+		m.Rules = l.Rules
+		err = ls.Matchmaker.Notifier.Matched(m)
+	}
+	if err != nil {
+		// The lobby is reopened for the host to start again.
+		if _, e := ls.Store.Update(nil, l); e != nil {
+			ls.Logger.Error(errors.Wrapf(e, "lobby %s not reopened", l.Code).Error())
+		}
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,104 @@
+package a5gmatchmaking
+
+import (
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestLobbies(t *testing.T) {
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	var matched []*Match
+	var notifyErr error
+	m, _ := NewMatchmaker(NewMemoryStore(), NotifierFunc(func(x *Match) error {
+		if notifyErr != nil {
+			return notifyErr
+		}
+		matched = append(matched, x)
+		return nil
+	}), 2, l)
+	m.Pools = []string{"duel"}
+	ls, err := NewLobbies(NewMemoryLobbyStore(), m, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc := Device{Platform: "pc", Input: "mouse"}
+	now := time.Unix(1600000000, 0)
+	ls.now = func() time.Time { return now }
+	codes := []string{"AAAAAA", "AAAAAA", "BBBBBB", "CCCCCC"}
+	ls.newCode = func() (string, error) {
+		c := codes[0]
+		codes = codes[1:]
+		return c, nil
+	}
+
+	if _, err = ls.Create(1, pc, "squad", 2, nil); errors.Cause(err) != ErrPoolUnknown {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err = ls.Create(1, pc, "duel", 17, nil); errors.Cause(err) != ErrLobbyCapacity {
+		t.Errorf("unexpected error %v", err)
+	}
+	a, err := ls.Create(1, pc, "duel", 3, map[string]string{"map": "dust"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A taken code is retried.
+	b, err := ls.Create(2, pc, "duel", 2, nil)
+	if err != nil || a.Code != "AAAAAA" || b.Code != "BBBBBB" {
+		t.Fatalf("unexpected lobbies %+v %+v %v", a, b, err)
+	}
+
+	if _, err = ls.Start(a.Code, 1); errors.Cause(err) != ErrLobbyShort {
+		t.Errorf("unexpected error %v", err)
+	}
+	for _, id := range []uint64{3, 4, 4} {
+		if _, err = ls.Join(a.Code, id, pc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = ls.Join(a.Code, 5, pc); errors.Cause(err) != ErrLobbyFull {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err = ls.Kick(a.Code, 3, 4); errors.Cause(err) != ErrNotHost {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err = ls.Kick(a.Code, 1, 4); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ls.SetRules(a.Code, 1, map[string]string{"map": "nuke"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// An undelivered match reopens the lobby.
+	notifyErr = errors.New("allocator down")
+	if _, err = ls.Start(a.Code, 1); errors.Cause(err) != notifyErr {
+		t.Errorf("unexpected error %v", err)
+	}
+	notifyErr = nil
+	x, err := ls.Start(a.Code, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matched) != 1 || x.Rules["map"] != "nuke" || len(x.Tickets) != 2 ||
+		x.Tickets[1].PlayerID != 3 || x.Tokens[3] == "" {
+		t.Errorf("unexpected match %+v", x)
+	}
+	if _, err = ls.Join(a.Code, 5, pc); errors.Cause(err) != ErrLobbyUnknown {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	if err = ls.Leave(b.Code, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ls.Get(b.Code); errors.Cause(err) != ErrLobbyUnknown {
+		t.Errorf("unexpected error %v", err)
+	}
+	c, _ := ls.Create(1, pc, "duel", 2, nil)
+	now = now.Add(ls.TTL)
+	if _, err = ls.Join(c.Code, 2, pc); errors.Cause(err) != ErrLobbyUnknown {
+		t.Errorf("unexpected error %v", err)
+	}
+}
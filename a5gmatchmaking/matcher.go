@@ -0,0 +1,157 @@
+package a5gmatchmaking
+
+import (
+	"sort"
+	"time"
+)
+
+// Window is the rating spread a ticket accepts: Initial right after
+// enqueueing, growing by Growth every second of waiting up to Max.
+type Window struct {
+	Initial int
+	Growth  float64
+	Max     int
+}
+
+// width is the spread t accepts at now.
+func (w Window) width(t *Ticket, now time.Time) int {
+	wait := now.Sub(t.enqueuedAt()).Seconds()
+	if wait < 0 {
+		wait = 0
+	}
+	x := w.Initial + int(w.Growth*wait)
+	if x > w.Max {
+		x = w.Max
+	}
+	if t.MaxSpread > 0 && x > t.MaxSpread {
+		x = t.MaxSpread
+	}
+	return x
+}
+
+// match groups tickets into matches of size. Longest waiting tickets pick
+// first, taking the closest ratings that every member's window accepts,
+// no member avoids and every member's device plays with. The result
+// depends on tickets and now only.
+func match(
+	tickets []*Ticket, size int, w Window, c *CrossPlay, now time.Time) [][]*Ticket {
+	pools := make(map[string][]*Ticket)
+	var names []string
+	for _, t := range tickets {
+		if _, ok := pools[t.Pool]; !ok {
+			names = append(names, t.Pool)
+		}
+		pools[t.Pool] = append(pools[t.Pool], t)
+	}
+	sort.Strings(names)
+	var groups [][]*Ticket
+	for _, name := range names {
+		groups = append(groups, matchPool(pools[name], size, w, c, now)...)
+	}
+	return groups
+}
+
+func matchPool(
+	tickets []*Ticket, size int, w Window, c *CrossPlay, now time.Time) [][]*Ticket {
+	if len(tickets) < size {
+		return nil
+	}
+	a := make([]*Ticket, len(tickets))
+	copy(a, tickets)
+	sort.Slice(a, func(i, j int) bool { return earlier(a[i], a[j]) })
+	widths := make(map[uint64]int, len(a))
+	for _, t := range a {
+		widths[t.PlayerID] = w.width(t, now)
+	}
+	taken := make(map[uint64]bool, len(a))
+	var groups [][]*Ticket
+	for _, first := range a {
+		if taken[first.PlayerID] {
+			continue
+		}
+		var candidates []*Ticket
+		for _, t := range a {
+			if t != first && !taken[t.PlayerID] {
+				candidates = append(candidates, t)
+			}
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			di := abs(candidates[i].Rating - first.Rating)
+			dj := abs(candidates[j].Rating - first.Rating)
+			if di != dj {
+				return di < dj
+			}
+			return earlier(candidates[i], candidates[j])
+		})
+		group := []*Ticket{first}
+		lo, hi, limit := first.Rating, first.Rating, widths[first.PlayerID]
+		for _, t := range candidates {
+			if len(group) == size {
+				break
+			}
+			if avoided(group, t) || !c.compatible(group, t) {
+				continue
+			}
+			l, h := min(lo, t.Rating), max(hi, t.Rating)
+			if x := min(limit, widths[t.PlayerID]); h-l <= x {
+				group = append(group, t)
+				lo, hi, limit = l, h, x
+			}
+		}
+		if len(group) < size {
+			continue
+		}
+		for _, t := range group {
+			taken[t.PlayerID] = true
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// avoided reports whether t and a member of group avoid each other.
+func avoided(group []*Ticket, t *Ticket) bool {
+	for _, x := range group {
+		if containsID(x.Avoid, t.PlayerID) || containsID(t.Avoid, x.PlayerID) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsID(a []uint64, id uint64) bool {
+	for _, x := range a {
+		if x == id {
+			return true
+		}
+	}
+	return false
+}
+
+func earlier(a, b *Ticket) bool {
+	if a.EnqueuedAt != b.EnqueuedAt {
+		return a.EnqueuedAt < b.EnqueuedAt
+	}
+	return a.PlayerID < b.PlayerID
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
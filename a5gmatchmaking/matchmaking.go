@@ -0,0 +1,304 @@
+package a5gmatchmaking
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrAlreadyQueued = errors.New("player already queued")
+	ErrPoolUnknown   = errors.New("matchmaking pool unknown")
+)
+
+// Ticket is a queued player. Only tickets of the same Pool (e.g.
+// "duel:eu") play together.
+type Ticket struct {
+	PlayerID uint64 `json:"playerId"`
+	Rating   int    `json:"rating"`
+	Pool     string `json:"pool"`
+	Device
+	// MaxSpread caps the window of this player, e.g. for newcomers.
+	MaxSpread int `json:"maxSpread,omitempty"`
+	// Avoid lists players this one is never matched with, see
+	// Matchmaker.Avoid.
+	Avoid []uint64 `json:"avoid,omitempty"`
+	// EnqueuedAt is in unix milliseconds.
+	EnqueuedAt int64 `json:"enqueuedAt"`
+}
+
+func (t *Ticket) enqueuedAt() time.Time {
+	return time.Unix(0, t.EnqueuedAt*int64(time.Millisecond))
+}
+
+// Match is a formed group; Tokens holds a secret per player to present to
+// the game server hosting the match. Rules are set by hosts of lobbies.
+type Match struct {
+	ID        string            `json:"id"`
+	Pool      string            `json:"pool"`
+	Rules     map[string]string `json:"rules,omitempty"`
+	Tickets   []*Ticket         `json:"tickets"`
+	Tokens    map[uint64]string `json:"-"`
+	CreatedAt int64             `json:"createdAt"`
+}
+
+// Store keeps the queue. Claim removes all tickets of players or, when
+// some of them are gone (e.g. canceled), none and reports false.
+type Store interface {
+	Add(t *Ticket) error
+	Remove(playerID uint64) (bool, error)
+	List() ([]*Ticket, error)
+	Claim(playerIDs []uint64) (bool, error)
+}
+
+// Notifier delivers formed matches, e.g. to the game server allocator and
+// to players over a5gws pushes.
+type Notifier interface {
+	Matched(*Match) error
+}
+
+type NotifierFunc func(*Match) error
+
+func (fn NotifierFunc) Matched(m *Match) error { return fn(m) }
+
+// PushNotifier pushes every player of a match the "match" event with
+// their token, push is usually an a5gws.Conn lookup by account.
+func PushNotifier(
+	push func(accountID uint64, event string, payload interface{}) error) Notifier {
+	return NotifierFunc(func(m *Match) error {
+		var err error
+		for _, t := range m.Tickets {
+			x := push(t.PlayerID, "match", &MatchPush{
+				MatchID: m.ID,
+				Pool:    m.Pool,
+				Token:   m.Tokens[t.PlayerID],
+				Rules:   m.Rules,
+				Players: m.Tickets})
+			if x != nil && err == nil {
+				err = errors.Wrapf(x, "player %d", t.PlayerID)
+			}
+		}
+		return err
+	})
+}
+
+type MatchPush struct {
+	MatchID string            `json:"matchId"`
+	Pool    string            `json:"pool"`
+	Token   string            `json:"token"`
+	Rules   map[string]string `json:"rules,omitempty"`
+	Players []*Ticket         `json:"players"`
+}
+
+// AvoidFunc returns players a player avoids, e.g. a5gblock.Lists.Avoided.
+type AvoidFunc func(playerID uint64) ([]uint64, error)
+
+// Matchmaker forms matches of MatchSize players out of the Store queue
+// every Interval.
+type Matchmaker struct {
+	Store     Store
+	Notifier  Notifier
+	Logger    a5glogs.Logger
+	MatchSize int
+	Window    Window
+	Interval  time.Duration
+	// Pools, when set, limits pools players may enqueue into.
+	Pools []string
+	// Avoid, when set, fills Ticket.Avoid on Enqueue.
+	Avoid AvoidFunc
+	// CrossPlay, when set, restricts platforms and inputs per pool.
+	CrossPlay *CrossPlay
+
+	now     func() time.Time
+	newID   func() (string, error)
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+func NewMatchmaker(
+	s Store, n Notifier, matchSize int, l a5glogs.Logger) (*Matchmaker, error) {
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if n == nil {
+		return nil, errors.New("notifier missing")
+	}
+	if matchSize < 2 {
+		return nil, errors.Errorf("invalid match size %d", matchSize)
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Matchmaker{
+		Store:     s,
+		Notifier:  n,
+		Logger:    l,
+		MatchSize: matchSize,
+		Window:    Window{Initial: 50, Growth: 10, Max: 500},
+		Interval:  time.Second,
+		now:       time.Now,
+		newID:     randomID}, nil
+}
+
+// Enqueue stamps and queues a ticket, its rating comes from game data
+// rather than the client.
+func (m *Matchmaker) Enqueue(t *Ticket) error {
+	if len(m.Pools) > 0 && !contains(m.Pools, t.Pool) {
+		return errors.Wrap(ErrPoolUnknown, t.Pool)
+	}
+	if !m.CrossPlay.Admits(t.Pool, t.Device) {
+		return errors.Wrap(ErrCrossPlayDenied, t.Platform)
+	}
+	if m.Avoid != nil {
+		avoid, err := m.Avoid(t.PlayerID)
+		if err != nil {
+			return err
+		}
+		t.Avoid = avoid
+	}
+	t.EnqueuedAt = m.now().UnixNano() / int64(time.Millisecond)
+	return m.Store.Add(t)
+}
+
+// Cancel dequeues a player, reporting whether one was queued.
+func (m *Matchmaker) Cancel(playerID uint64) (bool, error) {
+	return m.Store.Remove(playerID)
+}
+
+// Tick forms and delivers matches once, returning them.
+func (m *Matchmaker) Tick() ([]*Match, error) {
+	tickets, err := m.Store.List()
+	if err != nil {
+		return nil, err
+	}
+	now := m.now()
+	var matches []*Match
+	for _, group := range match(tickets, m.MatchSize, m.Window, m.CrossPlay, now) {
+		ids := make([]uint64, len(group))
+		for i, t := range group {
+			ids[i] = t.PlayerID
+		}
+		ok, err := m.Store.Claim(ids)
+		if err != nil {
+			return matches, err
+		}
+		if !ok {
+			continue
+		}
+		x, err := m.newMatch(group, now)
+		if err == nil {
+			err = m.Notifier.Matched(x)
+		}
+		if err != nil {
+			m.Logger.With(a5gfields.String("pool", group[0].Pool)).
+				Error(err.Error())
+			m.requeue(group)
+			continue
+		}
+		matches = append(matches, x)
+	}
+	return matches, nil
+}
+
+func (m *Matchmaker) newMatch(group []*Ticket, now time.Time) (*Match, error) {
+	id, err := m.newID()
+	if err != nil {
+		return nil, err
+	}
+	x := &Match{
+		ID:        id,
+		Pool:      group[0].Pool,
+		Tickets:   group,
+		Tokens:    make(map[uint64]string, len(group)),
+		CreatedAt: now.UnixNano() / int64(time.Millisecond)}
+	for _, t := range group {
+		if x.Tokens[t.PlayerID], err = m.newID(); err != nil {
+			return nil, err
+		}
+	}
+	return x, nil
+}
+
+// requeue returns tickets of an undelivered match keeping their waiting
+// time.
+func (m *Matchmaker) requeue(group []*Ticket) {
+	for _, t := range group {
+		if err := m.Store.Add(t); err != nil &&
+			errors.Cause(err) != ErrAlreadyQueued {
+			m.Logger.Error(err.Error())
+		}
+	}
+}
+
+// Start runs Tick every Interval until Stop is called. Run a single
+// matchmaker per Store, e.g. on the leader instance.
+func (m *Matchmaker) Start() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cancel != nil {
+		return errors.New("matchmaker already started")
+	}
+	var ctx context.Context
+	ctx, m.cancel = context.WithCancel(context.Background())
+	m.stopped = make(chan struct{})
+	go m.run(ctx, m.stopped)
+	return nil
+}
+
+func (m *Matchmaker) run(ctx context.Context, stopped chan struct{}) {
+	defer close(stopped)
+	t := time.NewTicker(m.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if _, err := m.Tick(); err != nil {
+			m.Logger.Error(err.Error())
+		}
+	}
+}
+
+// Stop waits for the running Tick until ctx is done.
+func (m *Matchmaker) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	cancel, stopped := m.cancel, m.stopped
+	m.cancel = nil
+	m.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
+
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func contains(a []string, s string) bool {
+	for _, x := range a {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
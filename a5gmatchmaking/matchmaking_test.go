@@ -0,0 +1,171 @@
+package a5gmatchmaking
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestMatch(t *testing.T) {
+	w := Window{Initial: 50, Growth: 10, Max: 200}
+	now := time.Unix(100, 0)
+	ticket := func(id uint64, rating int, waited time.Duration) *Ticket {
+		return &Ticket{PlayerID: id, Rating: rating, Pool: "duel",
+			EnqueuedAt: now.Add(-waited).UnixNano() / int64(time.Millisecond)}
+	}
+	tests := []struct {
+		name     string
+		size     int
+		tickets  []*Ticket
+		expected [][]uint64
+	}{
+		{"closest first", 2, []*Ticket{
+			ticket(1, 1000, 0), ticket(2, 1040, 0), ticket(3, 1010, 0)},
+			[][]uint64{{1, 3}}},
+		{"window too narrow", 2, []*Ticket{
+			ticket(1, 1000, 0), ticket(2, 1100, 0)}, nil},
+		{"window grown", 2, []*Ticket{
+			ticket(1, 1000, 10*time.Second), ticket(2, 1100, 5*time.Second)},
+			[][]uint64{{1, 2}}},
+		{"capped by max spread", 2, []*Ticket{
+			{PlayerID: 1, Rating: 1000, Pool: "duel", MaxSpread: 20},
+			ticket(2, 1030, time.Minute)}, nil},
+		{"pools apart", 2, []*Ticket{
+			ticket(1, 1000, 0), {PlayerID: 2, Rating: 1000, Pool: "squad"}}, nil},
+		{"longest waiting picks", 3, []*Ticket{
+			ticket(4, 1300, 0), ticket(1, 1000, 20*time.Second),
+			ticket(2, 1040, 0), ticket(3, 1020, 0), ticket(5, 1290, 0),
+			ticket(6, 1310, 0)},
+			[][]uint64{{1, 3, 2}, {4, 5, 6}}},
+		{"avoided", 2, []*Ticket{
+			{PlayerID: 1, Rating: 1000, Pool: "duel", Avoid: []uint64{3}},
+			ticket(2, 1040, 0), ticket(3, 1010, 0)},
+			[][]uint64{{1, 2}}},
+	}
+	for _, x := range tests {
+		var got [][]uint64
+		for _, g := range match(x.tickets, x.size, w, nil, now) {
+			var ids []uint64
+			for _, t := range g {
+				ids = append(ids, t.PlayerID)
+			}
+			got = append(got, ids)
+		}
+		if !reflect.DeepEqual(got, x.expected) {
+			t.Errorf("%s: expected %v, got %v", x.name, x.expected, got)
+		}
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	var arrivals []Arrival
+	for i := 0; i < 200; i++ {
+		arrivals = append(arrivals, Arrival{
+			At:       time.Duration(i*37%60) * time.Second,
+			PlayerID: uint64(i + 1),
+			Rating:   800 + i*97%800,
+			Pool:     "duel"})
+	}
+	w := Window{Initial: 30, Growth: 5, Max: 300}
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	r1, err := Simulate(2, w, arrivals, time.Second, 2*time.Minute, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := Simulate(2, w, arrivals, time.Second, 2*time.Minute, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r1, r2) {
+		t.Error("simulation is not deterministic")
+	}
+	if r1.Matched+r1.Unmatched != len(arrivals) || r1.Matched == 0 {
+		t.Errorf("unexpected report %+v", r1)
+	}
+	if r1.MaxSpread > w.Max {
+		t.Errorf("spread %d exceeds window", r1.MaxSpread)
+	}
+}
+
+func TestCrossPlay(t *testing.T) {
+	c, err := NewCrossPlayJSON([]byte(`{
+		"platforms": {"console": ["ps", "xbox"]},
+		"sameInput": ["ranked"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := Window{Initial: 100, Max: 100}
+	now := time.Unix(100, 0)
+	ticket := func(id uint64, pool, platform, input string, optOut bool) *Ticket {
+		return &Ticket{PlayerID: id, Rating: 1000, Pool: pool, EnqueuedAt: int64(id),
+			Device: Device{Platform: platform, Input: input, NoCrossPlay: optOut}}
+	}
+	tests := []struct {
+		name     string
+		tickets  []*Ticket
+		expected [][]uint64
+	}{
+		{"cross-play", []*Ticket{
+			ticket(1, "casual", "pc", "mouse", false),
+			ticket(2, "casual", "ps", "gamepad", false)},
+			[][]uint64{{1, 2}}},
+		{"opted out", []*Ticket{
+			ticket(1, "casual", "pc", "mouse", true),
+			ticket(2, "casual", "ps", "gamepad", false),
+			ticket(3, "casual", "pc", "gamepad", false)},
+			[][]uint64{{1, 3}}},
+		{"same input", []*Ticket{
+			ticket(1, "ranked", "pc", "gamepad", false),
+			ticket(2, "ranked", "pc", "mouse", false),
+			ticket(3, "ranked", "xbox", "gamepad", false)},
+			[][]uint64{{1, 3}}},
+	}
+	for _, x := range tests {
+		var got [][]uint64
+		for _, g := range match(x.tickets, 2, w, c, now) {
+			var ids []uint64
+			for _, t := range g {
+				ids = append(ids, t.PlayerID)
+			}
+			got = append(got, ids)
+		}
+		if !reflect.DeepEqual(got, x.expected) {
+			t.Errorf("%s: expected %v, got %v", x.name, x.expected, got)
+		}
+	}
+
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	m, _ := NewMatchmaker(NewMemoryStore(), NotifierFunc(func(*Match) error {
+		return nil
+	}), 2, l)
+	m.CrossPlay = c
+	if err = m.Enqueue(ticket(1, "console", "pc", "mouse", false)); errors.Cause(err) != ErrCrossPlayDenied {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err = m.Enqueue(ticket(1, "console", "ps", "gamepad", false)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Room joins are held to the same rules.
+	ls, _ := NewLobbies(NewMemoryLobbyStore(), m, l)
+	lobby, err := ls.Create(1, Device{Platform: "ps", Input: "gamepad"}, "ranked", 4, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ls.Join(lobby.Code, 2, Device{Platform: "pc", Input: "mouse"}); errors.Cause(err) != ErrCrossPlayDenied {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err = ls.Join(lobby.Code, 3, Device{Platform: "xbox", Input: "gamepad", NoCrossPlay: true}); errors.Cause(err) != ErrCrossPlayDenied {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err = ls.Join(lobby.Code, 4, Device{Platform: "pc", Input: "gamepad"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ls.Create(5, Device{Platform: "pc"}, "console", 2, nil); errors.Cause(err) != ErrCrossPlayDenied {
+		t.Errorf("unexpected error %v", err)
+	}
+}
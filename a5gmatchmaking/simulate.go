@@ -0,0 +1,106 @@
+package a5gmatchmaking
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+// Arrival is a simulated player entering the queue At after the start.
+type Arrival struct {
+	At       time.Duration
+	PlayerID uint64
+	Rating   int
+	Pool     string
+}
+
+// Report measures matcher quality: waiting time of matched players and
+// rating spread of matches.
+type Report struct {
+	Matches   []*Match
+	Matched   int
+	Unmatched int
+	AvgWait   time.Duration
+	MaxWait   time.Duration
+	AvgSpread float64
+	MaxSpread int
+}
+
+// Simulate replays arrivals against an in-memory queue on a simulated
+// clock, ticking every step for duration; equal inputs give equal reports,
+// so matcher settings can be tuned by tests.
+func Simulate(
+	matchSize int, w Window, arrivals []Arrival,
+	step, duration time.Duration, l a5glogs.Logger) (*Report, error) {
+	if step <= 0 {
+		return nil, errors.New("non-positive simulation step")
+	}
+	a := make([]Arrival, len(arrivals))
+	copy(a, arrivals)
+	sort.SliceStable(a, func(i, j int) bool { return a[i].At < a[j].At })
+	r := new(Report)
+	m, err := NewMatchmaker(NewMemoryStore(), NotifierFunc(func(x *Match) error {
+		r.Matches = append(r.Matches, x)
+		return nil
+	}), matchSize, l)
+	if err != nil {
+		return nil, err
+	}
+	m.Window = w
+	start := time.Unix(0, 0)
+	var now time.Time
+	m.now = func() time.Time { return now }
+	seq := 0
+	m.newID = func() (string, error) {
+		seq++
+		return strconv.Itoa(seq), nil
+	}
+	for at := time.Duration(0); at <= duration; at += step {
+		now = start.Add(at)
+		for len(a) > 0 && a[0].At <= at {
+			x := a[0]
+			a = a[1:]
+			// Arrivals join at their own time, not at the tick.
+			now = start.Add(x.At)
+			err = m.Enqueue(&Ticket{
+				PlayerID: x.PlayerID, Rating: x.Rating, Pool: x.Pool})
+			if err != nil {
+				return nil, err
+			}
+		}
+		now = start.Add(at)
+		if _, err = m.Tick(); err != nil {
+			return nil, err
+		}
+	}
+	var spreads int
+	for _, x := range r.Matches {
+		lo, hi := x.Tickets[0].Rating, x.Tickets[0].Rating
+		for _, t := range x.Tickets {
+			lo, hi = min(lo, t.Rating), max(hi, t.Rating)
+			wait := time.Duration(x.CreatedAt-t.EnqueuedAt) * time.Millisecond
+			r.AvgWait += wait
+			if wait > r.MaxWait {
+				r.MaxWait = wait
+			}
+			r.Matched++
+		}
+		spreads += hi - lo
+		if hi-lo > r.MaxSpread {
+			r.MaxSpread = hi - lo
+		}
+	}
+	if r.Matched > 0 {
+		r.AvgWait /= time.Duration(r.Matched)
+		r.AvgSpread = float64(spreads) / float64(len(r.Matches))
+	}
+	left, err := m.Store.List()
+	if err != nil {
+		return nil, err
+	}
+	r.Unmatched = len(left) + len(a)
+	return r, nil
+}
@@ -0,0 +1,259 @@
+package a5gmatchmaking
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+)
+
+type memoryStore struct {
+	mu      sync.Mutex
+	tickets map[uint64]*Ticket
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{tickets: make(map[uint64]*Ticket)}
+}
+
+func (s *memoryStore) Add(t *Ticket) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tickets[t.PlayerID]; ok {
+		return errors.WithStack(ErrAlreadyQueued)
+	}
+	x := *t
+	s.tickets[t.PlayerID] = &x
+	return nil
+}
+
+func (s *memoryStore) Remove(playerID uint64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.tickets[playerID]
+	delete(s.tickets, playerID)
+	return ok, nil
+}
+
+func (s *memoryStore) List() ([]*Ticket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := make([]*Ticket, 0, len(s.tickets))
+	for _, t := range s.tickets {
+		x := *t
+		a = append(a, &x)
+	}
+	return a, nil
+}
+
+func (s *memoryStore) Claim(playerIDs []uint64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range playerIDs {
+		if _, ok := s.tickets[id]; !ok {
+			return false, nil
+		}
+	}
+	for _, id := range playerIDs {
+		delete(s.tickets, id)
+	}
+	return true, nil
+}
+
+var claimScript = redis.NewScript(`
+for _, id in ipairs(ARGV) do
+  if redis.call("HEXISTS", KEYS[1], id) == 0 then
+    return 0
+  end
+end
+redis.call("HDEL", KEYS[1], unpack(ARGV))
+return 1
+`)
+
+type redisStore struct {
+	client redis.UniversalClient
+	key    string
+}
+
+// NewRedisStore keeps the queue as a hash of ticket JSONs by player id.
+func NewRedisStore(c redis.UniversalClient, key string) (Store, error) {
+	if c == nil {
+		return nil, errors.New("redis client missing")
+	}
+	if key == "" {
+		return nil, errors.New("empty matchmaking queue key")
+	}
+	return &redisStore{client: c, key: key}, nil
+}
+
+func (s *redisStore) Add(t *Ticket) error {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	ok, err := s.client.HSetNX(
+		s.key, strconv.FormatUint(t.PlayerID, 10), b).Result()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !ok {
+		return errors.WithStack(ErrAlreadyQueued)
+	}
+	return nil
+}
+
+func (s *redisStore) Remove(playerID uint64) (bool, error) {
+	n, err := s.client.HDel(s.key, strconv.FormatUint(playerID, 10)).Result()
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	return n == 1, nil
+}
+
+func (s *redisStore) List() ([]*Ticket, error) {
+	m, err := s.client.HGetAll(s.key).Result()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	a := make([]*Ticket, 0, len(m))
+	for _, v := range m {
+		t := new(Ticket)
+		if err = json.Unmarshal([]byte(v), t); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		a = append(a, t)
+	}
+	return a, nil
+}
+
+func (s *redisStore) Claim(playerIDs []uint64) (bool, error) {
+	args := make([]interface{}, len(playerIDs))
+	for i, id := range playerIDs {
+		args[i] = strconv.FormatUint(id, 10)
+	}
+	n, err := claimScript.Run(s.client, []string{s.key}, args...).Int64()
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	return n == 1, nil
+}
+
+type memoryLobbyStore struct {
+	mu      sync.Mutex
+	lobbies map[string]*Lobby
+}
+
+// NewMemoryLobbyStore keeps lobbies until they are deleted, Lobbies
+// skips expired ones.
+func NewMemoryLobbyStore() LobbyStore {
+	return &memoryLobbyStore{lobbies: make(map[string]*Lobby)}
+}
+
+func (s *memoryLobbyStore) Get(code string) (*Lobby, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.lobbies[code]
+	if !ok {
+		return nil, nil
+	}
+	return l.clone(), nil
+}
+
+func (s *memoryLobbyStore) Update(prev, next *Lobby) (bool, error) {
+	code := lobbyCode(prev, next)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	x, ok := s.lobbies[code]
+	if ok != (prev != nil) || ok && x.Version != prev.Version {
+		return false, nil
+	}
+	if next == nil {
+		delete(s.lobbies, code)
+		return true, nil
+	}
+	s.lobbies[code] = next.clone()
+	return true, nil
+}
+
+func lobbyCode(prev, next *Lobby) string {
+	if prev != nil {
+		return prev.Code
+	}
+	return next.Code
+}
+
+// updateLobbyScript replaces the lobby of KEYS[1] stored at version
+// ARGV[1], 0 for none, with ARGV[2] expiring at ARGV[3] unix seconds or
+// deletes it when ARGV[2] is empty.
+var updateLobbyScript = redis.NewScript(`
+local v = redis.call("GET", KEYS[1])
+local version = 0
+if v then
+  version = cjson.decode(v).version
+end
+if version ~= tonumber(ARGV[1]) then
+  return 0
+end
+if ARGV[2] == "" then
+  redis.call("DEL", KEYS[1])
+  return 1
+end
+redis.call("SET", KEYS[1], ARGV[2])
+redis.call("EXPIREAT", KEYS[1], ARGV[3])
+return 1
+`)
+
+type redisLobbyStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisLobbyStore keeps a lobby JSON by code under prefix, expiring
+// with the lobby.
+func NewRedisLobbyStore(c redis.UniversalClient, prefix string) (LobbyStore, error) {
+	if c == nil {
+		return nil, errors.New("redis client missing")
+	}
+	if prefix == "" {
+		return nil, errors.New("empty lobby key prefix")
+	}
+	return &redisLobbyStore{client: c, prefix: prefix}, nil
+}
+
+func (s *redisLobbyStore) Get(code string) (*Lobby, error) {
+	b, err := s.client.Get(s.prefix + code).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	l := new(Lobby)
+	if err = json.Unmarshal(b, l); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return l, nil
+}
+
+func (s *redisLobbyStore) Update(prev, next *Lobby) (bool, error) {
+	var version, expiresAt int64
+	if prev != nil {
+		version = prev.Version
+	}
+	var b []byte
+	if next != nil {
+		var err error
+		if b, err = json.Marshal(next); err != nil {
+			return false, errors.WithStack(err)
+		}
+		expiresAt = next.ExpiresAt
+	}
+	n, err := updateLobbyScript.Run(s.client,
+		[]string{s.prefix + lobbyCode(prev, next)}, version, b, expiresAt).Int64()
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	return n == 1, nil
+}
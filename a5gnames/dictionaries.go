@@ -0,0 +1,40 @@
+package a5gnames
+
+// DefaultDictionaries are small built-in word lists reviewed to be neutral
+// on their own; pair them with a Filter for the assembled names.
+func DefaultDictionaries() map[string]*Dictionary {
+	return map[string]*Dictionary{
+		"en": {
+			Adjectives: []string{
+				"brave", "calm", "clever", "swift", "bold", "bright", "lucky",
+				"mighty", "quiet", "rapid", "silver", "golden", "happy", "noble",
+				"wild", "wise"},
+			Nouns: []string{
+				"fox", "falcon", "wolf", "otter", "tiger", "comet", "knight",
+				"ranger", "pilot", "wizard", "badger", "panda", "raven", "hawk",
+				"lynx", "bear"}},
+		"ru": {
+			Adjectives: []string{
+				"смелый", "быстрый", "мудрый", "тихий", "яркий", "ловкий",
+				"добрый", "храбрый", "северный", "золотой"},
+			Nouns: []string{
+				"лис", "волк", "сокол", "медведь", "тигр", "рыцарь", "пилот",
+				"ворон", "барсук", "следопыт"}},
+	}
+}
+
+// DefaultBlocklists are lowercase fragments rejected anywhere in an
+// assembled name, per locale. They back the Generator when its Filter is
+// nil and are meant as a floor, not as a replacement for a moderated
+// list.
+func DefaultBlocklists() map[string][]string {
+	return map[string][]string{
+		"en": {
+			"anal", "anus", "cock", "cum", "cunt", "dick", "fag", "fuck",
+			"hitler", "kkk", "nazi", "nigg", "porn", "rape", "sex", "shit",
+			"slut", "whore"},
+		"ru": {
+			"бля", "гитлер", "еба", "ебл", "ёб", "жоп", "нацист", "пидор",
+			"пизд", "сука", "хер", "хуй", "хуе"},
+	}
+}
@@ -0,0 +1,160 @@
+package a5gnames
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+var ErrNamesExhausted = errors.New("no free name found")
+
+// Dictionary is an locale's word lists; names are built as
+// adjective + noun + number.
+type Dictionary struct {
+	Adjectives []string `json:"adjectives"`
+	Nouns      []string `json:"nouns"`
+}
+
+// Filter reports whether the assembled name is acceptable. Combining two
+// clean words may still produce an offensive name, so the whole name is
+// checked, not the words.
+type Filter func(locale, name string) bool
+
+// BlocklistFilter rejects names containing a fragment of their locale's
+// list, case-insensitively.
+func BlocklistFilter(lists map[string][]string) Filter {
+	m := make(map[string][]string, len(lists))
+	for locale, a := range lists {
+		for _, s := range a {
+			m[locale] = append(m[locale], strings.ToLower(s))
+		}
+	}
+	return func(locale, name string) bool {
+		name = strings.ToLower(name)
+		for _, s := range m[locale] {
+			if strings.Contains(name, s) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+var defaultFilter = BlocklistFilter(DefaultBlocklists())
+
+// Exister reports whether a name is already taken.
+type Exister func(name string) (bool, error)
+
+// Generator builds guest names. A nil Filter falls back to a
+// BlocklistFilter of DefaultBlocklists.
+type Generator struct {
+	DefaultLocale string
+	Filter        Filter
+	Exister       Exister
+	MaxAttempts   int
+
+	dictionaries map[string]*Dictionary
+	mu           sync.Mutex
+	rand         *rand.Rand
+}
+
+func NewGenerator(m map[string]*Dictionary, defaultLocale string) (
+	*Generator, error) {
+	if _, ok := m[defaultLocale]; !ok {
+		return nil, errors.Errorf("missing default locale %q dictionary",
+			defaultLocale)
+	}
+	for k, d := range m {
+		if d == nil || len(d.Adjectives) == 0 || len(d.Nouns) == 0 {
+			return nil, errors.Errorf("empty locale %q dictionary", k)
+		}
+	}
+	return &Generator{
+		DefaultLocale: defaultLocale,
+		MaxAttempts:   20,
+		dictionaries:  m,
+		rand:          rand.New(rand.NewSource(time.Now().UnixNano()))}, nil
+}
+
+// Generate returns a filter-safe name which is free according to Exister.
+// Unknown locales fall back to DefaultLocale.
+func (g *Generator) Generate(locale string) (string, error) {
+	d, ok := g.dictionaries[locale]
+	if !ok {
+		locale = g.DefaultLocale
+		d = g.dictionaries[locale]
+	}
+	filter := g.Filter
+	if filter == nil {
+		filter = defaultFilter
+	}
+	digits := 3
+	for i := 0; i < g.MaxAttempts; i++ {
+		// Widen the numeric suffix as attempts collide.
+		if i > 0 && i%5 == 0 {
+			digits++
+		}
+		s := g.name(d, digits)
+		if !filter(locale, s) {
+			continue
+		}
+		if g.Exister != nil {
+			taken, err := g.Exister(s)
+			if err != nil {
+				return "", errors.WithStack(err)
+			}
+			if taken {
+				continue
+			}
+		}
+		return s, nil
+	}
+	return "", errors.WithStack(ErrNamesExhausted)
+}
+
+// Suggest returns up to n distinct names for a rename dialog.
+func (g *Generator) Suggest(locale string, n int) ([]string, error) {
+	seen := make(map[string]bool)
+	var a []string
+	for i := 0; i < n*2 && len(a) < n; i++ {
+		s, err := g.Generate(locale)
+		if err != nil {
+			return a, err
+		}
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+		a = append(a, s)
+	}
+	return a, nil
+}
+
+func (g *Generator) name(d *Dictionary, digits int) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	max := 1
+	for i := 0; i < digits; i++ {
+		max *= 10
+	}
+	return fmt.Sprintf("%s%s%0*d",
+		title(d.Adjectives[g.rand.Intn(len(d.Adjectives))]),
+		title(d.Nouns[g.rand.Intn(len(d.Nouns))]),
+		digits, g.rand.Intn(max))
+}
+
+// title upper-cases the first letter of a word. Unlike strings.Title it
+// leaves the rest of the word alone and does not guess word boundaries.
+func title(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError {
+		return s
+	}
+	return string(unicode.ToTitle(r)) + s[n:]
+}
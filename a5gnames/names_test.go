@@ -0,0 +1,79 @@
+package a5gnames
+
+import (
+	"math/rand"
+	"regexp"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestGenerate(t *testing.T) {
+	g, err := NewGenerator(DefaultDictionaries(), "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.rand = rand.New(rand.NewSource(1))
+	tests := []struct {
+		locale string
+		re     *regexp.Regexp
+	}{
+		{"en", regexp.MustCompile(`^[A-Z][a-z]+[A-Z][a-z]+[0-9]{3}$`)},
+		{"ru", regexp.MustCompile(`^[А-Я][а-я]+[А-Я][а-я]+[0-9]{3}$`)},
+		{"xx", regexp.MustCompile(`^[A-Z][a-z]+[A-Z][a-z]+[0-9]{3}$`)},
+	}
+	for _, test := range tests {
+		s, err := g.Generate(test.locale)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !test.re.MatchString(s) {
+			t.Errorf("%s: unexpected name %q", test.locale, s)
+		}
+	}
+}
+
+func TestDefaultFilter(t *testing.T) {
+	// The default lists must not reject names built of default words.
+	for locale, d := range DefaultDictionaries() {
+		for _, a := range d.Adjectives {
+			for _, n := range d.Nouns {
+				if s := title(a) + title(n); !defaultFilter(locale, s) {
+					t.Errorf("%s: %q rejected", locale, s)
+				}
+			}
+		}
+	}
+
+	g, err := NewGenerator(map[string]*Dictionary{
+		"en": {Adjectives: []string{"big"}, Nouns: []string{"shitake"}},
+		"ru": {Adjectives: []string{"злая"}, Nouns: []string{"сука"}},
+	}, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, locale := range []string{"en", "ru"} {
+		if _, err = g.Generate(locale); errors.Cause(err) != ErrNamesExhausted {
+			t.Errorf("%s: unexpected error %v", locale, err)
+		}
+	}
+
+	g.Filter = func(locale, name string) bool { return true }
+	if _, err = g.Generate("en"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestTitle(t *testing.T) {
+	for s, want := range map[string]string{
+		"":       "",
+		"fox":    "Fox",
+		"o'neil": "O'neil",
+		"ёж":     "Ёж",
+		"dž":     "Dž",
+	} {
+		if got := title(s); got != want {
+			t.Errorf("title(%q) = %q, want %q", s, got, want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package a5gops
+
+import (
+	"context"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gprobe"
+)
+
+// Paths are the routes the handlers of Ops are mounted on.
+type Paths struct {
+	Maintenance string
+	Compensate  string
+	Inspect     string
+	Drain       string
+	Logs        string
+}
+
+var DefaultPaths = Paths{
+	Maintenance: "/ops/maintenance",
+	Compensate:  "/ops/compensate",
+	Inspect:     "/ops/inspect",
+	Drain:       "/ops/drain",
+	Logs:        "/ops/logs"}
+
+// Client calls the ops endpoints of one node with the request and
+// response types of the handlers, over the a5gprobe envelope client;
+// Token is an admin session token.
+type Client struct {
+	*a5gprobe.Client
+	Paths Paths
+}
+
+func NewClient(baseURL, token string, l a5glogs.Logger) *Client {
+	c := a5gprobe.NewClient(baseURL, l)
+	c.Token = token
+	return &Client{Client: c, Paths: DefaultPaths}
+}
+
+func (c *Client) Maintenance(
+	ctx context.Context, r *MaintenanceRequest) (*MaintenanceStatus, error) {
+	x := new(MaintenanceStatus)
+	if err := c.Call(ctx, c.Paths.Maintenance, r, x); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+func (c *Client) Compensate(
+	ctx context.Context, r *CompensateRequest) (*CompensateResponse, error) {
+	x := new(CompensateResponse)
+	if err := c.Call(ctx, c.Paths.Compensate, r, x); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+func (c *Client) Inspect(ctx context.Context, accountID uint64) (*Inspection, error) {
+	x := new(Inspection)
+	err := c.Call(ctx, c.Paths.Inspect, &InspectRequest{AccountID: accountID}, x)
+	if err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+func (c *Client) Drain(ctx context.Context, resume bool) (*DrainStatus, error) {
+	x := new(DrainStatus)
+	if err := c.Call(ctx, c.Paths.Drain, &DrainRequest{Resume: resume}, x); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+func (c *Client) Logs(ctx context.Context, r *LogsRequest) (*LogsResponse, error) {
+	x := new(LogsResponse)
+	if err := c.Call(ctx, c.Paths.Logs, r, x); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
@@ -0,0 +1,122 @@
+package a5gops
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+// Drainer takes a node out of rotation before it is stopped: once
+// draining, ReadyHandler fails for the load balancer and Middleware
+// refuses new requests while those in flight finish.
+//
+//	r.Get("/ready", drainer.ReadyHandler)
+//	r.With(drainer.Middleware).Post("/shop/buy", ...)
+type Drainer struct {
+	Logger a5glogs.Logger
+
+	mu       sync.Mutex
+	draining bool
+	inFlight int64
+}
+
+func NewDrainer(l a5glogs.Logger) (*Drainer, error) {
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Drainer{Logger: l}, nil
+}
+
+type DrainStatus struct {
+	Draining bool  `json:"draining"`
+	InFlight int64 `json:"inFlight"`
+}
+
+func (d *Drainer) Drain() {
+	d.mu.Lock()
+	ok := !d.draining
+	d.draining = true
+	d.mu.Unlock()
+	if ok {
+		d.Logger.Warn("node draining")
+	}
+}
+
+// Resume takes a drained node back into rotation.
+func (d *Drainer) Resume() {
+	d.mu.Lock()
+	ok := d.draining
+	d.draining = false
+	d.mu.Unlock()
+	if ok {
+		d.Logger.Warn("node resumed")
+	}
+}
+
+func (d *Drainer) Status() *DrainStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return &DrainStatus{Draining: d.draining, InFlight: d.inFlight}
+}
+
+// Wait blocks until a draining node has no requests in flight.
+func (d *Drainer) Wait(ctx context.Context) error {
+	t := time.NewTicker(50 * time.Millisecond)
+	defer t.Stop()
+	for {
+		if s := d.Status(); s.Draining && s.InFlight == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return errors.WithStack(ctx.Err())
+		case <-t.C:
+		}
+	}
+}
+
+func (d *Drainer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.mu.Lock()
+		draining := d.draining
+		if !draining {
+			d.inFlight++
+		}
+		d.mu.Unlock()
+		if draining {
+			w.Header().Set("Connection", "close")
+			err := a5ghttp.WriteErrResponse(w, r, nil,
+				a5gapi.NewErr(ErrCodeDraining, "node draining"))
+			if err != nil {
+				d.Logger.Error(err.Error())
+			}
+			return
+		}
+		defer func() {
+			d.mu.Lock()
+			d.inFlight--
+			d.mu.Unlock()
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ReadyHandler answers 503 while draining, for load balancer readiness
+// checks.
+func (d *Drainer) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	s := d.Status()
+	status := http.StatusOK
+	if s.Draining {
+		status = http.StatusServiceUnavailable
+	}
+	w.WriteHeader(status)
+	if _, err := w.Write([]byte(http.StatusText(status))); err != nil {
+		d.Logger.Error(err.Error())
+	}
+}
@@ -0,0 +1,198 @@
+package a5gops
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCodePlayerUnknown = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4072,
+		Name:     "ops_player_unknown",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "player not found"})
+
+	ErrCodeRequestInvalid = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4286,
+		Name:     "ops_request_invalid",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "invalid ops request"})
+
+	ErrCodeDraining = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     5031,
+		Name:     "node_draining",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "server is restarting, retry"})
+)
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodePlayerUnknown, http.StatusNotFound)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeRequestInvalid, http.StatusUnprocessableEntity)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeDraining, http.StatusServiceUnavailable)
+}
+
+type MaintenanceRequest struct {
+	On      bool   `json:"on"`
+	Message string `json:"message,omitempty" validate:"max=128"`
+}
+
+// CompensateRequest grants Amount of Currency to every player of
+// AccountIDs; GrantID names the grant so repeating it pays nobody twice.
+type CompensateRequest struct {
+	GrantID    string   `json:"grantId" validate:"required,max=64"`
+	Reason     string   `json:"reason" validate:"required,max=64"`
+	Currency   string   `json:"currency" validate:"required,max=32"`
+	Amount     int64    `json:"amount" validate:"min=1"`
+	AccountIDs []uint64 `json:"accountIds" validate:"min=1,max=1000"`
+}
+
+type CompensateResponse struct {
+	Grants []*Grant `json:"grants"`
+}
+
+type InspectRequest struct {
+	AccountID uint64 `json:"accountId" validate:"required"`
+}
+
+type DrainRequest struct {
+	Resume bool `json:"resume,omitempty"`
+}
+
+// LogsRequest asks for up to Limit entries matching the filter; a
+// follower passes the LastSeq it got as AfterSeq.
+type LogsRequest struct {
+	LogFilter
+	Limit int `json:"limit,omitempty" validate:"min=0,max=500"`
+}
+
+type LogsResponse struct {
+	Entries []*LogEntry `json:"entries"`
+	LastSeq uint64      `json:"lastSeq"`
+}
+
+// MaintenanceHandler turns maintenance of the node on or off, mount it
+// on an admin route class.
+func (o *Ops) MaintenanceHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(MaintenanceRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			r, ok := req.Payload.(*MaintenanceRequest)
+			if !ok {
+				return nil, o.apiErrs(errors.New("unexpected maintenance request"))
+			}
+			s, err := o.SetMaintenance(r.On, r.Message)
+			if err != nil {
+				return nil, o.apiErrs(err)
+			}
+			return s, nil
+		})
+}
+
+// CompensateHandler grants compensation, mount it on an admin route
+// class. Failures of single players are reported in their grants.
+func (o *Ops) CompensateHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(CompensateRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			r, ok := req.Payload.(*CompensateRequest)
+			if !ok {
+				return nil, o.apiErrs(errors.New("unexpected compensate request"))
+			}
+			a, err := o.Compensate(r.GrantID, r.Reason, r.Currency, r.Amount, r.AccountIDs)
+			if err != nil {
+				return nil, o.apiErrs(err)
+			}
+			return &CompensateResponse{Grants: a}, nil
+		})
+}
+
+// InspectHandler answers a player with balances, mount it on an admin
+// route class.
+func (o *Ops) InspectHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(InspectRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			r, ok := req.Payload.(*InspectRequest)
+			if !ok {
+				return nil, o.apiErrs(errors.New("unexpected inspect request"))
+			}
+			x, err := o.Inspect(r.AccountID)
+			if err != nil {
+				return nil, o.apiErrs(err)
+			}
+			return x, nil
+		})
+}
+
+// DrainHandler drains or resumes the node and answers its status, mount
+// it on an admin route class outside Drainer.Middleware.
+func (o *Ops) DrainHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(DrainRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			r, ok := req.Payload.(*DrainRequest)
+			if !ok {
+				return nil, o.apiErrs(errors.New("unexpected drain request"))
+			}
+			if o.Drainer == nil {
+				return nil, o.apiErrs(errors.New("drainer is not configured"))
+			}
+			if r.Resume {
+				o.Drainer.Resume()
+			} else {
+				o.Drainer.Drain()
+			}
+			return o.Drainer.Status(), nil
+		})
+}
+
+// LogsHandler answers the log entries of the node, mount it on an admin
+// route class.
+func (o *Ops) LogsHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(LogsRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			r, ok := req.Payload.(*LogsRequest)
+			if !ok {
+				return nil, o.apiErrs(errors.New("unexpected logs request"))
+			}
+			if o.Logs == nil {
+				return nil, o.apiErrs(errors.New("log tail is not configured"))
+			}
+			if err := r.Validate(); err != nil {
+				return nil, o.apiErrs(err)
+			}
+			if r.Limit == 0 {
+				r.Limit = 100
+			}
+			a, seq := o.Logs.Tail(&r.LogFilter, r.Limit)
+			return &LogsResponse{Entries: a, LastSeq: seq}, nil
+		})
+}
+
+func (o *Ops) apiErrs(err error) []*a5gapi.APIErr {
+	switch errors.Cause(err) {
+	case ErrPlayerUnknown:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodePlayerUnknown, "%s", err)}
+	case ErrRequestInvalid:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeRequestInvalid, "%s", err)}
+	default:
+		o.Logger.Error(err.Error())
+		return a5gapi.NewJSONMsgDefautlErrors(err)
+	}
+}
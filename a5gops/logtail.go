@@ -0,0 +1,159 @@
+package a5gops
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+var levels = map[string]int{
+	"debug": 0, "info": 1, "warn": 2, "error": 3, "panic": 4, "fatal": 5}
+
+// LogEntry is a structured log record; Seq grows by one per record, so a
+// tail follows from the last Seq it got.
+type LogEntry struct {
+	Seq     uint64            `json:"seq"`
+	Time    time.Time         `json:"time"`
+	Level   string            `json:"level"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// LogFilter selects entries after AfterSeq of Level or above with Fields
+// equal and Contains in the message; zero fields match everything.
+type LogFilter struct {
+	AfterSeq uint64            `json:"afterSeq,omitempty"`
+	Level    string            `json:"level,omitempty"`
+	Contains string            `json:"contains,omitempty"`
+	Fields   map[string]string `json:"fields,omitempty"`
+}
+
+func (f *LogFilter) Validate() error {
+	if _, ok := levels[f.Level]; f.Level != "" && !ok {
+		return errors.Wrap(ErrRequestInvalid, "unknown log level "+f.Level)
+	}
+	return nil
+}
+
+func (f *LogFilter) Match(e *LogEntry) bool {
+	if e.Seq <= f.AfterSeq || f.Level != "" && levels[e.Level] < levels[f.Level] ||
+		!strings.Contains(e.Message, f.Contains) {
+		return false
+	}
+	for k, v := range f.Fields {
+		if e.Fields[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+type logRing struct {
+	mu      sync.Mutex
+	entries []*LogEntry
+	next    int
+	seq     uint64
+}
+
+// LogTail is a logger keeping the last records of a node for tailing
+// besides passing them on; wrap the logger of the service with it.
+type LogTail struct {
+	logger a5glogs.Logger
+	ring   *logRing
+	fields []a5gfields.Field
+	now    func() time.Time
+}
+
+func NewLogTail(l a5glogs.Logger, size int) (*LogTail, error) {
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	if size <= 0 {
+		return nil, errors.Errorf("non-positive log tail size %d", size)
+	}
+	return &LogTail{
+		logger: l,
+		ring:   &logRing{entries: make([]*LogEntry, size)},
+		now:    time.Now}, nil
+}
+
+func (t *LogTail) With(fs ...a5gfields.Field) a5glogs.Logger {
+	x := *t
+	x.logger = t.logger.With(fs...)
+	x.fields = append(append([]a5gfields.Field(nil), t.fields...), fs...)
+	return &x
+}
+
+func (t *LogTail) Debug(s string, fs ...a5gfields.Field) {
+	t.add("debug", s, fs)
+	t.logger.Debug(s, fs...)
+}
+
+func (t *LogTail) Info(s string, fs ...a5gfields.Field) {
+	t.add("info", s, fs)
+	t.logger.Info(s, fs...)
+}
+
+func (t *LogTail) Warn(s string, fs ...a5gfields.Field) {
+	t.add("warn", s, fs)
+	t.logger.Warn(s, fs...)
+}
+
+func (t *LogTail) Error(s string, fs ...a5gfields.Field) {
+	t.add("error", s, fs)
+	t.logger.Error(s, fs...)
+}
+
+func (t *LogTail) Panic(s string, fs ...a5gfields.Field) {
+	t.add("panic", s, fs)
+	t.logger.Panic(s, fs...)
+}
+
+func (t *LogTail) Fatal(s string, fs ...a5gfields.Field) {
+	t.add("fatal", s, fs)
+	t.logger.Fatal(s, fs...)
+}
+
+func (t *LogTail) add(level, s string, fs []a5gfields.Field) {
+	e := &LogEntry{Time: t.now().UTC(), Level: level, Message: s}
+	if n := len(t.fields) + len(fs); n > 0 {
+		e.Fields = make(map[string]string, n)
+		for _, f := range t.fields {
+			e.Fields[f.Key()] = f.Value()
+		}
+		for _, f := range fs {
+			e.Fields[f.Key()] = f.Value()
+		}
+	}
+	r := t.ring
+	r.mu.Lock()
+	r.seq++
+	e.Seq = r.seq
+	r.entries[r.next] = e
+	r.next = (r.next + 1) % len(r.entries)
+	r.mu.Unlock()
+}
+
+// Tail returns up to limit oldest entries matching f, and the last Seq
+// logged so a follower without matches skips ahead.
+func (t *LogTail) Tail(f *LogFilter, limit int) ([]*LogEntry, uint64) {
+	r := t.ring
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	a := []*LogEntry{}
+	for i := range r.entries {
+		e := r.entries[(r.next+i)%len(r.entries)]
+		if e == nil || !f.Match(e) {
+			continue
+		}
+		if len(a) == limit {
+			return a, a[len(a)-1].Seq
+		}
+		a = append(a, e)
+	}
+	return a, r.seq
+}
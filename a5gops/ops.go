@@ -0,0 +1,138 @@
+// Package a5gops serves the endpoints of everyday operations: toggling
+// maintenance, granting compensation, inspecting a player, draining a
+// node and tailing its logs. cmd/gameserverctl calls them through Client.
+package a5gops
+
+import (
+	"strconv"
+
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gplayers"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+)
+
+// Maintenance is the kill switch module of maintenance, mount its
+// middleware on player routes:
+//
+//	r.With(switches.Middleware(a5gops.Maintenance)).Post("/shop/buy", ...)
+const Maintenance = "maintenance"
+
+var (
+	ErrPlayerUnknown  = errors.New("unknown player")
+	ErrRequestInvalid = errors.New("invalid ops request")
+)
+
+// Ops acts on the node that answers: maintenance and drain are per node,
+// gameserverctl toggles every node it is given. Unset subsystems answer
+// "not configured".
+type Ops struct {
+	Switches *a5ghttp.KillSwitches
+	Wallet   *a5gwallet.Wallet
+	Players  a5gplayers.Store
+	Drainer  *Drainer
+	Logs     *LogTail
+	Logger   a5glogs.Logger
+}
+
+func NewOps(l a5glogs.Logger) (*Ops, error) {
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Ops{Logger: l}, nil
+}
+
+type MaintenanceStatus struct {
+	On      bool   `json:"on"`
+	Message string `json:"message,omitempty"`
+}
+
+// SetMaintenance turns maintenance on with message shown to players, or
+// off.
+func (o *Ops) SetMaintenance(on bool, message string) (*MaintenanceStatus, error) {
+	if o.Switches == nil {
+		return nil, errors.New("kill switches are not configured")
+	}
+	if on {
+		o.Switches.Disable(Maintenance, message)
+		o.Logger.With(a5gfields.String("message", message)).Warn("maintenance on")
+	} else {
+		o.Switches.Enable(Maintenance)
+		o.Logger.Warn("maintenance off")
+	}
+	s, ok := o.Switches.Disabled(Maintenance)
+	return &MaintenanceStatus{On: ok, Message: s}, nil
+}
+
+// Grant is the outcome of a compensation for one player.
+type Grant struct {
+	AccountID uint64            `json:"accountId"`
+	Result    *a5gwallet.Result `json:"result,omitempty"`
+	Error     string            `json:"error,omitempty"`
+}
+
+// Compensate credits amount of currency to every player; the wallet
+// transaction of a player is named after grantID, so repeating a grant
+// replays it instead of paying twice.
+func (o *Ops) Compensate(grantID, reason, currency string, amount int64,
+	accountIDs []uint64) ([]*Grant, error) {
+	if o.Wallet == nil {
+		return nil, errors.New("wallet is not configured")
+	}
+	if grantID == "" || amount <= 0 || len(accountIDs) == 0 {
+		return nil, errors.Wrap(ErrRequestInvalid, "compensation")
+	}
+	a := make([]*Grant, len(accountIDs))
+	failed := 0
+	for i, id := range accountIDs {
+		a[i] = &Grant{AccountID: id}
+		r, err := o.Wallet.Credit(id,
+			"compensation:"+grantID+":"+strconv.FormatUint(id, 10),
+			"ops:compensation", reason, currency, amount)
+		if err != nil {
+			a[i].Error = err.Error()
+			failed++
+			continue
+		}
+		a[i].Result = r
+	}
+	o.Logger.With(a5gfields.String("grant", grantID),
+		a5gfields.String("currency", currency),
+		a5gfields.Int64("amount", amount),
+		a5gfields.Int("players", len(accountIDs)),
+		a5gfields.Int("failed", failed)).Warn("compensation granted")
+	return a, nil
+}
+
+// Inspection is what support looks at first about a player.
+type Inspection struct {
+	Player   *a5gplayers.Player   `json:"player"`
+	Balances []*a5gwallet.Balance `json:"balances,omitempty"`
+}
+
+func (o *Ops) Inspect(accountID uint64) (*Inspection, error) {
+	if o.Players == nil {
+		return nil, errors.New("players are not configured")
+	}
+	if accountID == 0 {
+		return nil, errors.Wrap(ErrPlayerUnknown, "0")
+	}
+	a, err := o.Players.Find(&a5gplayers.Query{}, accountID-1, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(a) == 0 || a[0].AccountID != accountID {
+		return nil, errors.Wrap(ErrPlayerUnknown,
+			strconv.FormatUint(accountID, 10))
+	}
+	x := &Inspection{Player: a[0]}
+	if o.Wallet == nil {
+		return x, nil
+	}
+	if x.Balances, err = o.Wallet.Balances(accountID); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
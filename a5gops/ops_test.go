@@ -0,0 +1,221 @@
+package a5gops
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gplayers"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/sirupsen/logrus"
+)
+
+type testConfig struct{}
+
+func (testConfig) DebugLevel() int { return 0 }
+
+func newTestServer(t *testing.T) (*Ops, *Client, func()) {
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	tail, err := NewLogTail(l, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := NewOps(tail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.Logs = tail
+	if o.Switches, err = a5ghttp.NewKillSwitches(tail); err != nil {
+		t.Fatal(err)
+	}
+	if o.Drainer, err = NewDrainer(tail); err != nil {
+		t.Fatal(err)
+	}
+	c, err := a5gwallet.NewCurrencies(a5gwallet.Currency{ID: "gems"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Wallet, err = a5gwallet.NewWallet(a5gwallet.NewMemoryStore(), c, tail); err != nil {
+		t.Fatal(err)
+	}
+	o.Players = a5gplayers.NewMemoryStore()
+	for _, id := range []uint64{1, 3} {
+		if err = o.Players.Upsert(&a5gplayers.Player{AccountID: id, Level: 5}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := a5gapi.NewResponder(testConfig{}, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := a5ghttp.NewAdapter(r, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(DefaultPaths.Maintenance, a.Handler(o.MaintenanceHandler()))
+	mux.Handle(DefaultPaths.Compensate, a.Handler(o.CompensateHandler()))
+	mux.Handle(DefaultPaths.Inspect, a.Handler(o.InspectHandler()))
+	mux.Handle(DefaultPaths.Drain, a.Handler(o.DrainHandler()))
+	mux.Handle(DefaultPaths.Logs, a.Handler(o.LogsHandler()))
+	srv := httptest.NewServer(mux)
+	return o, NewClient(srv.URL, "token", l), srv.Close
+}
+
+func TestClient(t *testing.T) {
+	o, c, stop := newTestServer(t)
+	defer stop()
+	ctx := context.Background()
+
+	s, err := c.Maintenance(ctx, &MaintenanceRequest{On: true, Message: "back at 10:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *s != (MaintenanceStatus{On: true, Message: "back at 10:00"}) {
+		t.Errorf("unexpected maintenance %+v", s)
+	}
+	if _, ok := o.Switches.Disabled(Maintenance); !ok {
+		t.Error("maintenance is off")
+	}
+	if s, err = c.Maintenance(ctx, &MaintenanceRequest{}); err != nil || s.On {
+		t.Errorf("Maintenance() => %+v, %v", s, err)
+	}
+
+	// A repeated grant replays instead of paying twice.
+	req := &CompensateRequest{GrantID: "outage-1", Reason: "outage",
+		Currency: "gems", Amount: 50, AccountIDs: []uint64{1, 3}}
+	for i := 0; i < 2; i++ {
+		res, err := c.Compensate(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Grants) != 2 || res.Grants[1].Result == nil ||
+			res.Grants[1].Result.Replayed != (i == 1) {
+			t.Errorf("%d: unexpected grants %+v", i, res.Grants)
+		}
+	}
+	req.Currency = "gold"
+	res, err := c.Compensate(ctx, req)
+	if err != nil || res.Grants[0].Error == "" {
+		t.Errorf("Compensate() of an unknown currency => %+v, %v", res, err)
+	}
+	if _, err = c.Compensate(ctx, &CompensateRequest{GrantID: "x"}); err == nil {
+		t.Error("Compensate() without players succeeded")
+	}
+
+	x, err := c.Inspect(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.Player.AccountID != 3 || len(x.Balances) != 1 || x.Balances[0].Balance != 50 {
+		t.Errorf("unexpected inspection %+v %+v", x.Player, x.Balances)
+	}
+	if _, err = c.Inspect(ctx, 2); err == nil ||
+		!strings.Contains(err.Error(), "status 404") {
+		t.Errorf("Inspect() of an unknown player => %v", err)
+	}
+
+	d, err := c.Drain(ctx, false)
+	if err != nil || !d.Draining {
+		t.Errorf("Drain() => %+v, %v", d, err)
+	}
+	if d, err = c.Drain(ctx, true); err != nil || d.Draining {
+		t.Errorf("Drain() resume => %+v, %v", d, err)
+	}
+
+	logs, err := c.Logs(ctx, &LogsRequest{LogFilter: LogFilter{Level: "warn"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs.Entries) == 0 || logs.Entries[len(logs.Entries)-1].Message != "node resumed" {
+		t.Errorf("unexpected logs %+v", logs)
+	}
+	if _, err = c.Logs(ctx, &LogsRequest{LogFilter: LogFilter{Level: "loud"}}); err == nil ||
+		!strings.Contains(err.Error(), "status 422") {
+		t.Errorf("Logs() of an unknown level => %v", err)
+	}
+}
+
+func TestDrainer(t *testing.T) {
+	d, err := NewDrainer(a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := make(chan struct{})
+	started := make(chan struct{})
+	h := d.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	go h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+	<-started
+	d.Drain()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("request while draining => %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	d.ReadyHandler(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("ready while draining => %d", w.Code)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err = d.Wait(ctx); err == nil {
+		t.Error("Wait() returned with a request in flight")
+	}
+	close(release)
+	if err = d.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if s := d.Status(); !s.Draining || s.InFlight != 0 {
+		t.Errorf("unexpected status %+v", s)
+	}
+}
+
+func TestLogTail(t *testing.T) {
+	tail, err := NewLogTail(a5glogs.NewLogrusWrapper(logrus.New()), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := tail.With(a5gfields.String("module", "shop"))
+	tail.Info("started")
+	l.Debug("cart", a5gfields.Int64("items", 2))
+	l.Warn("slow purchase")
+	l.Error("purchase failed")
+	tests := []struct {
+		name string
+		f    LogFilter
+		want []string
+	}{
+		{"ring", LogFilter{}, []string{"cart", "slow purchase", "purchase failed"}},
+		{"level", LogFilter{Level: "warn"}, []string{"slow purchase", "purchase failed"}},
+		{"field", LogFilter{Fields: map[string]string{"items": "2"}}, []string{"cart"}},
+		{"contains", LogFilter{Contains: "purchase"}, []string{"slow purchase", "purchase failed"}},
+		{"after", LogFilter{AfterSeq: 3}, []string{"purchase failed"}},
+	}
+	for _, x := range tests {
+		a, seq := tail.Tail(&x.f, 10)
+		var got []string
+		for _, e := range a {
+			got = append(got, e.Message)
+		}
+		if strings.Join(got, "|") != strings.Join(x.want, "|") || seq != 4 {
+			t.Errorf("%s: %q, %d want %q, 4", x.name, got, seq, x.want)
+		}
+	}
+	a, seq := tail.Tail(&LogFilter{}, 1)
+	if len(a) != 1 || a[0].Fields["module"] != "shop" || seq != 2 {
+		t.Errorf("limited tail %+v, %d", a, seq)
+	}
+}
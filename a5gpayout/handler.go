@@ -0,0 +1,52 @@
+package a5gpayout
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/pkg/errors"
+)
+
+var ErrCodeRunUnknown = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+	Code:     4054,
+	Name:     "payout_run_unknown",
+	Severity: a5gapi.ErrSeverityWarn,
+	Public:   true,
+	Message:  "payout run not found"})
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeRunUnknown, http.StatusNotFound)
+}
+
+type RunRequest struct {
+	Board  string `json:"board" validate:"required"`
+	Season string `json:"season" validate:"required"`
+}
+
+// RunHandler answers with the progress of a payout run, mount it on an
+// admin route class.
+func (p *Processor) RunHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(RunRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			r := req.Payload.(*RunRequest)
+			run, err := p.Run(r.Board, r.Season)
+			if err != nil {
+				return nil, p.apiErrs(err)
+			}
+			return run, nil
+		})
+}
+
+func (p *Processor) apiErrs(err error) []*a5gapi.APIErr {
+	switch errors.Cause(err) {
+	case ErrRunUnknown, ErrBoardUnknown:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeRunUnknown, "")}
+	}
+	p.Logger.Error(err.Error())
+	return a5gapi.NewJSONMsgDefautlErrors(err)
+}
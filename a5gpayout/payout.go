@@ -0,0 +1,290 @@
+package a5gpayout
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/armor5games/a5g/a5gjobs"
+	"github.com/armor5games/a5g/a5gleaderboard"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+// JobKind is the a5gjobs kind of payout runs, see Processor.JobHandler.
+const JobKind = "payout"
+
+var (
+	ErrBoardUnknown = errors.New("payout board unknown")
+	ErrRunUnknown   = errors.New("payout run unknown")
+)
+
+// Statuses of a run.
+const (
+	StatusRunning = "running"
+	StatusDone    = "done"
+)
+
+// Reward is what a tier pays: wallet currencies and inventory items.
+type Reward struct {
+	Currencies map[string]int64 `json:"currencies,omitempty"`
+	Items      map[string]int64 `json:"items,omitempty"`
+}
+
+// Tier pays Reward to ranks From to To, both 1-based and inclusive.
+type Tier struct {
+	From   int64   `json:"from"`
+	To     int64   `json:"to"`
+	Reward *Reward `json:"reward"`
+}
+
+// Run is the payout of a board season, ID is "board:season" so a season
+// is paid by a single run however many times it is started. Cursor is the
+// count of ranks processed, Paid the count of delivered payouts; times
+// are unix seconds.
+type Run struct {
+	ID        string `json:"id"`
+	Board     string `json:"board"`
+	Season    string `json:"season"`
+	Status    string `json:"status"`
+	Cursor    int64  `json:"cursor"`
+	Total     int64  `json:"total"`
+	Paid      int64  `json:"paid"`
+	CreatedAt int64  `json:"createdAt"`
+	UpdatedAt int64  `json:"updatedAt"`
+}
+
+// Payout is the reward of a player in a run.
+type Payout struct {
+	RunID     string  `json:"runId"`
+	AccountID uint64  `json:"accountId"`
+	Rank      int64   `json:"rank"`
+	Reward    *Reward `json:"reward"`
+}
+
+// Mailer delivers a payout, e.g. as a mail with attachments. A payout is
+// mailed again when a run crashed between mailing and recording it, so
+// mailers must be idempotent per RunID and AccountID.
+type Mailer interface {
+	Mail(ctx context.Context, p *Payout) error
+}
+
+type MailerFunc func(ctx context.Context, p *Payout) error
+
+func (fn MailerFunc) Mail(ctx context.Context, p *Payout) error {
+	return fn(ctx, p)
+}
+
+// Standings reads final standings, *a5gleaderboard.Leaderboards is one.
+type Standings interface {
+	Standings(boardID, season string, offset, n int64) (
+		[]*a5gleaderboard.Entry, error)
+}
+
+// Store keeps runs and delivered payouts. CreateRun stores r unless a run
+// with its ID exists and returns the stored run. Deliver records a
+// payout and reports false when it was recorded before.
+type Store interface {
+	Run(id string) (*Run, error)
+	CreateRun(r *Run) (*Run, error)
+	UpdateRun(r *Run) error
+	Delivered(runID string, accountID uint64) (bool, error)
+	Deliver(p *Payout, at int64) (bool, error)
+}
+
+// Processor pays final standings of seasons by Tiers of their boards in
+// chunks of ChunkSize ranks. Progress is stored after every chunk, so a
+// run started again, e.g. by a retried job, resumes where it stopped and
+// never pays a player twice.
+type Processor struct {
+	Tiers     map[string][]*Tier
+	Store     Store
+	Standings Standings
+	Mailer    Mailer
+	Logger    a5glogs.Logger
+	ChunkSize int64
+
+	now func() time.Time
+}
+
+func NewProcessor(tiers map[string][]*Tier, s Store, st Standings, m Mailer,
+	l a5glogs.Logger) (*Processor, error) {
+	for board, a := range tiers {
+		if err := validate(a); err != nil {
+			return nil, errors.Wrapf(err, "payout board %q", board)
+		}
+	}
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if st == nil {
+		return nil, errors.New("standings missing")
+	}
+	if m == nil {
+		return nil, errors.New("mailer missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Processor{
+		Tiers:     tiers,
+		Store:     s,
+		Standings: st,
+		Mailer:    m,
+		Logger:    l,
+		ChunkSize: 100,
+		now:       time.Now}, nil
+}
+
+func validate(tiers []*Tier) error {
+	if len(tiers) == 0 {
+		return errors.New("no tiers")
+	}
+	a := make([]*Tier, len(tiers))
+	copy(a, tiers)
+	sort.Slice(a, func(i, j int) bool { return a[i].From < a[j].From })
+	for i, t := range a {
+		if t.From < 1 || t.To < t.From || t.Reward == nil {
+			return errors.Errorf("invalid tier %d-%d", t.From, t.To)
+		}
+		if i > 0 && t.From <= a[i-1].To {
+			return errors.Errorf("tier %d-%d overlaps", t.From, t.To)
+		}
+	}
+	return nil
+}
+
+func tier(tiers []*Tier, rank int64) *Tier {
+	for _, t := range tiers {
+		if rank >= t.From && rank <= t.To {
+			return t
+		}
+	}
+	return nil
+}
+
+// Pay runs or resumes the payout of an ended season of a board.
+func (p *Processor) Pay(ctx context.Context, boardID, season string) (*Run, error) {
+	tiers, ok := p.Tiers[boardID]
+	if !ok {
+		return nil, errors.Wrap(ErrBoardUnknown, boardID)
+	}
+	var total int64
+	for _, t := range tiers {
+		if t.To > total {
+			total = t.To
+		}
+	}
+	now := p.now().Unix()
+	r, err := p.Store.CreateRun(&Run{
+		ID:        boardID + ":" + season,
+		Board:     boardID,
+		Season:    season,
+		Status:    StatusRunning,
+		Total:     total,
+		CreatedAt: now,
+		UpdatedAt: now})
+	if err != nil {
+		return nil, err
+	}
+	for r.Status != StatusDone {
+		if err = ctx.Err(); err != nil {
+			return r, errors.WithStack(err)
+		}
+		if err = p.chunk(ctx, tiers, r); err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+// chunk pays the next ChunkSize ranks of r and stores the progress.
+func (p *Processor) chunk(ctx context.Context, tiers []*Tier, r *Run) error {
+	n := p.ChunkSize
+	if r.Cursor+n > r.Total {
+		n = r.Total - r.Cursor
+	}
+	entries, err := p.Standings.Standings(r.Board, r.Season, r.Cursor, n)
+	if err != nil {
+		return err
+	}
+	var paid int64
+	for _, e := range entries {
+		t := tier(tiers, e.Rank)
+		if t == nil {
+			continue
+		}
+		if err = p.pay(ctx, &Payout{
+			RunID:     r.ID,
+			AccountID: e.PlayerID,
+			Rank:      e.Rank,
+			Reward:    t.Reward}); err != nil {
+			return err
+		}
+		paid++
+	}
+	x := *r
+	x.Cursor += n
+	if int64(len(entries)) < n || x.Cursor >= x.Total {
+		x.Status = StatusDone
+	}
+	x.Paid += paid
+	x.UpdatedAt = p.now().Unix()
+	if err = p.Store.UpdateRun(&x); err != nil {
+		return err
+	}
+	*r = x
+	return nil
+}
+
+func (p *Processor) pay(ctx context.Context, x *Payout) error {
+	ok, err := p.Store.Delivered(x.RunID, x.AccountID)
+	if err != nil || ok {
+		return err
+	}
+	if err = p.Mailer.Mail(ctx, x); err != nil {
+		return errors.Wrapf(err, "payout %s account %d", x.RunID, x.AccountID)
+	}
+	_, err = p.Store.Deliver(x, p.now().Unix())
+	return err
+}
+
+// Run returns the progress of the payout of a season.
+func (p *Processor) Run(boardID, season string) (*Run, error) {
+	r, err := p.Store.Run(boardID + ":" + season)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return nil, errors.Wrapf(ErrRunUnknown, "%s:%s", boardID, season)
+	}
+	return r, nil
+}
+
+type jobPayload struct {
+	Board  string `json:"board"`
+	Season string `json:"season"`
+}
+
+// NewJob makes an a5gjobs job paying a season, run it by a pool with
+// Processor.JobHandler registered for JobKind.
+func NewJob(boardID, season string, maxAttempts int) (*a5gjobs.Job, error) {
+	b, err := json.Marshal(&jobPayload{Board: boardID, Season: season})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return a5gjobs.NewJob(JobKind, b, a5gjobs.PriorityNormal, maxAttempts)
+}
+
+// JobHandler pays the season of a NewJob job; retries resume the run.
+func (p *Processor) JobHandler() a5gjobs.HandlerFunc {
+	return func(ctx context.Context, j *a5gjobs.Job) error {
+		x := new(jobPayload)
+		if err := json.Unmarshal(j.Payload, x); err != nil {
+			return errors.WithStack(err)
+		}
+		_, err := p.Pay(ctx, x.Board, x.Season)
+		return err
+	}
+}
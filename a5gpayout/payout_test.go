@@ -0,0 +1,86 @@
+package a5gpayout
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/armor5games/a5g/a5gleaderboard"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestProcessor(t *testing.T) {
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	lb, err := a5gleaderboard.NewLeaderboards(a5gleaderboard.NewMemoryStore(), l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = lb.Register(&a5gleaderboard.Board{
+		ID: "arena", Tie: a5gleaderboard.TiePlayerID,
+		Schedule: a5gleaderboard.Forever})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id := uint64(1); id <= 7; id++ {
+		if _, err = lb.Submit("arena", id, int64(100-id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mailed := make(map[uint64]int)
+	down := uint64(4)
+	m := MailerFunc(func(ctx context.Context, p *Payout) error {
+		if p.AccountID == down {
+			return errors.New("mail down")
+		}
+		mailed[p.AccountID]++
+		return nil
+	})
+	if _, err = NewProcessor(map[string][]*Tier{"arena": {
+		{From: 1, To: 3, Reward: &Reward{}}, {From: 3, To: 4, Reward: &Reward{}}}},
+		NewMemoryStore(), lb, m, l); err == nil {
+		t.Fatal("expected an overlapping tiers error")
+	}
+	p, err := NewProcessor(map[string][]*Tier{"arena": {
+		{From: 1, To: 1, Reward: &Reward{Currencies: map[string]int64{"gems": 100}}},
+		{From: 2, To: 5, Reward: &Reward{Items: map[string]int64{"chest": 1}}}}},
+		NewMemoryStore(), lb, m, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.ChunkSize = 2
+
+	ctx := context.Background()
+	if _, err = p.Pay(ctx, "duel", "all"); errors.Cause(err) != ErrBoardUnknown {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err = p.Pay(ctx, "arena", "all"); err == nil {
+		t.Fatal("expected a mail error")
+	}
+	r, err := p.Run("arena", "all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != StatusRunning || r.Cursor != 2 || r.Paid != 2 {
+		t.Errorf("unexpected interrupted run %+v", r)
+	}
+
+	down = 0
+	j, err := NewJob("arena", "all", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.JobHandler()(ctx, j); err != nil {
+		t.Fatal(err)
+	}
+	if r, err = p.Pay(ctx, "arena", "all"); err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != StatusDone || r.Cursor != 5 || r.Paid != 5 {
+		t.Errorf("unexpected run %+v", r)
+	}
+	if got := fmt.Sprint(mailed); got != "map[1:1 2:1 3:1 4:1 5:1]" {
+		t.Errorf("unexpected mails %s", got)
+	}
+}
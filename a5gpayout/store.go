@@ -0,0 +1,218 @@
+package a5gpayout
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryStore struct {
+	mu        sync.Mutex
+	runs      map[string]*Run
+	delivered map[string]map[uint64]bool
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{
+		runs:      make(map[string]*Run),
+		delivered: make(map[string]map[uint64]bool)}
+}
+
+func (s *memoryStore) Run(id string) (*Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.runs[id]
+	if !ok {
+		return nil, nil
+	}
+	x := *r
+	return &x, nil
+}
+
+func (s *memoryStore) CreateRun(r *Run) (*Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if x, ok := s.runs[r.ID]; ok {
+		y := *x
+		return &y, nil
+	}
+	x := *r
+	s.runs[r.ID] = &x
+	y := x
+	return &y, nil
+}
+
+func (s *memoryStore) UpdateRun(r *Run) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.runs[r.ID]; !ok {
+		return errors.Wrap(ErrRunUnknown, r.ID)
+	}
+	x := *r
+	s.runs[r.ID] = &x
+	return nil
+}
+
+func (s *memoryStore) Delivered(runID string, accountID uint64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.delivered[runID][accountID], nil
+}
+
+func (s *memoryStore) Deliver(p *Payout, at int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.delivered[p.RunID]
+	if !ok {
+		m = make(map[uint64]bool)
+		s.delivered[p.RunID] = m
+	}
+	if m[p.AccountID] {
+		return false, nil
+	}
+	m[p.AccountID] = true
+	return true, nil
+}
+
+// dbStore keeps runs and delivered payouts in MySQL tables:
+//
+//	CREATE TABLE payout_runs (
+//	  id VARCHAR(128) NOT NULL PRIMARY KEY,
+//	  board VARCHAR(64) NOT NULL,
+//	  season VARCHAR(64) NOT NULL,
+//	  status VARCHAR(16) NOT NULL,
+//	  cursor_rank BIGINT NOT NULL,
+//	  total BIGINT NOT NULL,
+//	  paid BIGINT NOT NULL,
+//	  created_at BIGINT NOT NULL,
+//	  updated_at BIGINT NOT NULL);
+//
+//	CREATE TABLE payouts (
+//	  run_id VARCHAR(128) NOT NULL,
+//	  account_id BIGINT UNSIGNED NOT NULL,
+//	  rank BIGINT NOT NULL,
+//	  reward TEXT NOT NULL,
+//	  delivered_at BIGINT NOT NULL,
+//	  PRIMARY KEY (run_id, account_id));
+type dbStore struct {
+	pooler           a5gdb.Pooler
+	runsTableName    string
+	payoutsTableName string
+}
+
+type dbRun struct {
+	ID        string `db:"id"`
+	Board     string `db:"board"`
+	Season    string `db:"season"`
+	Status    string `db:"status"`
+	Cursor    int64  `db:"cursor_rank"`
+	Total     int64  `db:"total"`
+	Paid      int64  `db:"paid"`
+	CreatedAt int64  `db:"created_at"`
+	UpdatedAt int64  `db:"updated_at"`
+}
+
+var runColumns = []string{
+	"id", "board", "season", "status", "cursor_rank", "total", "paid",
+	"created_at", "updated_at"}
+
+func NewDBStore(
+	p a5gdb.Pooler, runsTableName, payoutsTableName string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if runsTableName == "" || payoutsTableName == "" {
+		return nil, errors.New("empty payout table name")
+	}
+	return &dbStore{
+		pooler:           p,
+		runsTableName:    runsTableName,
+		payoutsTableName: payoutsTableName}, nil
+}
+
+func (s *dbStore) Run(id string) (*Run, error) {
+	return s.run(s.pooler.WritePool().NewSession(), id)
+}
+
+func (s *dbStore) run(sess *dbr.Session, id string) (*Run, error) {
+	x := new(dbRun)
+	err := sess.Select(runColumns...).From(s.runsTableName).
+		Where(dbr.Eq("id", id)).LoadOne(x)
+	if err == dbr.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	r := Run(*x)
+	return &r, nil
+}
+
+func (s *dbStore) CreateRun(r *Run) (*Run, error) {
+	sess := s.pooler.WritePool().NewSession()
+	x := dbRun(*r)
+	_, err := sess.InsertBySql("INSERT IGNORE INTO "+s.runsTableName+
+		" (id, board, season, status, cursor_rank, total, paid, created_at,"+
+		" updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		x.ID, x.Board, x.Season, x.Status, x.Cursor, x.Total, x.Paid,
+		x.CreatedAt, x.UpdatedAt).Exec()
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	y, err := s.run(sess, r.ID)
+	if err != nil {
+		return nil, err
+	}
+	if y == nil {
+		return nil, errors.Wrap(ErrRunUnknown, r.ID)
+	}
+	return y, nil
+}
+
+func (s *dbStore) UpdateRun(r *Run) error {
+	_, err := s.pooler.WritePool().NewSession().Update(s.runsTableName).
+		Set("status", r.Status).
+		Set("cursor_rank", r.Cursor).
+		Set("paid", r.Paid).
+		Set("updated_at", r.UpdatedAt).
+		Where(dbr.Eq("id", r.ID)).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*UpdateStmt).Exec fn")
+	}
+	return nil
+}
+
+func (s *dbStore) Delivered(runID string, accountID uint64) (bool, error) {
+	var n int64
+	err := s.pooler.WritePool().NewSession().
+		Select("COUNT(*)").From(s.payoutsTableName).
+		Where(dbr.Eq("run_id", runID)).
+		Where(dbr.Eq("account_id", accountID)).LoadOne(&n)
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	return n > 0, nil
+}
+
+func (s *dbStore) Deliver(p *Payout, at int64) (bool, error) {
+	reward, err := json.Marshal(p.Reward)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	res, err := s.pooler.WritePool().NewSession().InsertBySql(
+		"INSERT IGNORE INTO "+s.payoutsTableName+
+			" (run_id, account_id, rank, reward, delivered_at)"+
+			" VALUES (?, ?, ?, ?, ?)",
+		p.RunID, p.AccountID, p.Rank, string(reward), at).Exec()
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	return n == 1, nil
+}
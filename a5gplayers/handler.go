@@ -0,0 +1,87 @@
+package a5gplayers
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5gcursor"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/pkg/errors"
+)
+
+const cursorKind = "players"
+
+type findState struct {
+	AfterID uint64 `json:"afterId"`
+}
+
+type FindRequest struct {
+	Query
+}
+
+// ExportResponse names the export a job writes.
+type ExportResponse struct {
+	JobID int64  `json:"jobId"`
+	Name  string `json:"name"`
+}
+
+// FindHandler answers with a page of players of a query, mount it on an
+// admin route class.
+func (x *Players) FindHandler(
+	c *a5gcursor.Cursors, l a5gcursor.PageLimits) a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(FindRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			r := req.Payload.(*FindRequest)
+			state := new(findState)
+			limit, _, e := c.ParsePage(req, cursorKind, 0, l, state)
+			if e != nil {
+				return nil, []*a5gapi.APIErr{e}
+			}
+			a, err := x.Store.Find(&r.Query, state.AfterID, limit+1)
+			if err != nil {
+				return nil, x.apiErrs(err)
+			}
+			hasMore := len(a) > limit
+			if hasMore {
+				a = a[:limit]
+				state.AfterID = a[limit-1].AccountID
+			}
+			page, err := c.NextPage(cursorKind, 0, limit, hasMore, nil, state)
+			if err != nil {
+				return nil, x.apiErrs(err)
+			}
+			return &a5gapi.Paged{Items: a, Page: page}, nil
+		})
+}
+
+// ExportHandler enqueues a CSV export of every player of a query into
+// Jobs, mount it on an admin route class.
+func (x *Players) ExportHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(FindRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			if x.Jobs == nil {
+				return nil, x.apiErrs(errors.New("players export jobs missing"))
+			}
+			name := "players-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+			j, err := NewJob(name, &req.Payload.(*FindRequest).Query, 3)
+			if err != nil {
+				return nil, x.apiErrs(err)
+			}
+			if err = x.Jobs.Enqueue(j); err != nil {
+				return nil, x.apiErrs(err)
+			}
+			return &ExportResponse{JobID: j.ID, Name: name}, nil
+		})
+}
+
+func (x *Players) apiErrs(err error) []*a5gapi.APIErr {
+	x.Logger.Error(err.Error())
+	return a5gapi.NewJSONMsgDefautlErrors(err)
+}
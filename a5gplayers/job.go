@@ -0,0 +1,51 @@
+package a5gplayers
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5gjobs"
+	"github.com/pkg/errors"
+)
+
+// JobKind is the a5gjobs kind of exports, see Players.JobHandler.
+const JobKind = "players_export"
+
+type jobPayload struct {
+	Name  string `json:"name"`
+	Query *Query `json:"query"`
+}
+
+// NewJob makes a job exporting players of q as the export name.
+func NewJob(name string, q *Query, maxAttempts int) (*a5gjobs.Job, error) {
+	if !exportName.MatchString(name) {
+		return nil, errors.Errorf("invalid export name %q", name)
+	}
+	b, err := json.Marshal(&jobPayload{Name: name, Query: q})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return a5gjobs.NewJob(JobKind, b, a5gjobs.PriorityLow, maxAttempts)
+}
+
+// JobHandler exports players of a NewJob job, a retry writes the export
+// anew.
+func (x *Players) JobHandler() a5gjobs.HandlerFunc {
+	return func(ctx context.Context, j *a5gjobs.Job) error {
+		p := new(jobPayload)
+		if err := json.Unmarshal(j.Payload, p); err != nil {
+			return errors.WithStack(err)
+		}
+		if p.Query == nil {
+			p.Query = new(Query)
+		}
+		n, err := x.Export(ctx, p.Name, p.Query)
+		if err != nil {
+			return err
+		}
+		x.Logger.With(a5gfields.String("export", p.Name),
+			a5gfields.Int64("players", n)).Info("players exported")
+		return nil
+	}
+}
@@ -0,0 +1,162 @@
+package a5gplayers
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/armor5games/a5g/a5gjobs"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+// Player is a row of the player index the game keeps up to date, e.g.
+// on level ups and purchases. Spend is the lifetime spend in cents.
+type Player struct {
+	AccountID uint64    `json:"accountId"`
+	Level     int64     `json:"level"`
+	Spend     int64     `json:"spend"`
+	Segments  []string  `json:"segments"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// Query selects players, zero fields match everyone. Players of any of
+// Segments match; MaxLevel and MaxSpend are inclusive.
+type Query struct {
+	Segments []string `json:"segments,omitempty"`
+	MinLevel int64    `json:"minLevel,omitempty"`
+	MaxLevel int64    `json:"maxLevel,omitempty"`
+	MinSpend int64    `json:"minSpend,omitempty"`
+	MaxSpend int64    `json:"maxSpend,omitempty"`
+}
+
+func (q *Query) Match(p *Player) bool {
+	if p.Level < q.MinLevel || q.MaxLevel > 0 && p.Level > q.MaxLevel ||
+		p.Spend < q.MinSpend || q.MaxSpend > 0 && p.Spend > q.MaxSpend {
+		return false
+	}
+	if len(q.Segments) == 0 {
+		return true
+	}
+	for _, s := range q.Segments {
+		for _, x := range p.Segments {
+			if s == x {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Store keeps the player index. Find serves players of q with account
+// IDs above afterID in ascending order, up to limit.
+type Store interface {
+	Upsert(p *Player) error
+	Find(q *Query, afterID uint64, limit int) ([]*Player, error)
+}
+
+// Sink stores exports, Create truncates an export of the same name so
+// retried jobs write it anew.
+type Sink interface {
+	Create(name string) (io.WriteCloser, error)
+}
+
+type dirSink string
+
+var exportName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// NewDirSink writes exports as files of dir.
+func NewDirSink(dir string) (Sink, error) {
+	if dir == "" {
+		return nil, errors.New("empty export dir")
+	}
+	return dirSink(dir), nil
+}
+
+func (d dirSink) Create(name string) (io.WriteCloser, error) {
+	if !exportName.MatchString(name) {
+		return nil, errors.Errorf("invalid export name %q", name)
+	}
+	f, err := os.Create(filepath.Join(string(d), name+".csv"))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return f, nil
+}
+
+// Players queries the index for liveops, e.g. to target compensation and
+// test cohorts.
+type Players struct {
+	Store  Store
+	Sink   Sink
+	Logger a5glogs.Logger
+	// Jobs queues exports of ExportHandler.
+	Jobs a5gjobs.Storer
+	// BatchSize is the page size exports read the index with.
+	BatchSize int
+}
+
+func NewPlayers(s Store, sink Sink, l a5glogs.Logger) (*Players, error) {
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if sink == nil {
+		return nil, errors.New("sink missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Players{Store: s, Sink: sink, Logger: l, BatchSize: 1000}, nil
+}
+
+// Export writes every player of q as CSV to the sink and returns their
+// count; it stops between batches when ctx is done.
+func (x *Players) Export(ctx context.Context, name string, q *Query) (n int64, err error) {
+	f, err := x.Sink.Create(name)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if e := f.Close(); err == nil && e != nil {
+			err = errors.WithStack(e)
+		}
+	}()
+	w := csv.NewWriter(f)
+	if err = w.Write([]string{
+		"account_id", "level", "spend", "segments", "last_seen"}); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	var afterID uint64
+	var a []*Player
+	for {
+		if err = ctx.Err(); err != nil {
+			return n, errors.WithStack(err)
+		}
+		if a, err = x.Store.Find(q, afterID, x.BatchSize); err != nil {
+			return n, err
+		}
+		for _, p := range a {
+			if err = w.Write([]string{
+				strconv.FormatUint(p.AccountID, 10),
+				strconv.FormatInt(p.Level, 10),
+				strconv.FormatInt(p.Spend, 10),
+				strings.Join(p.Segments, " "),
+				p.LastSeen.UTC().Format(time.RFC3339)}); err != nil {
+				return n, errors.WithStack(err)
+			}
+			afterID = p.AccountID
+			n++
+		}
+		if len(a) < x.BatchSize {
+			break
+		}
+	}
+	w.Flush()
+	return n, errors.WithStack(w.Error())
+}
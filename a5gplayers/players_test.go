@@ -0,0 +1,81 @@
+package a5gplayers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/sirupsen/logrus"
+)
+
+type buffer struct{ bytes.Buffer }
+
+func (b *buffer) Close() error { return nil }
+
+type memorySink map[string]*buffer
+
+func (s memorySink) Create(name string) (io.WriteCloser, error) {
+	s[name] = new(buffer)
+	return s[name], nil
+}
+
+func TestPlayersExport(t *testing.T) {
+	s := NewMemoryStore()
+	seen := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	for _, p := range []*Player{
+		{AccountID: 3, Level: 12, Spend: 999, Segments: []string{"payer", "country:de"}},
+		{AccountID: 1, Level: 5, Segments: []string{"country:de"}},
+		{AccountID: 2, Level: 30, Spend: 5000, Segments: []string{"payer"}},
+		{AccountID: 4, Level: 15, Spend: 0, Segments: []string{"tester"}},
+	} {
+		p.LastSeen = seen
+		if err := s.Upsert(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sink := make(memorySink)
+	x, err := NewPlayers(s, sink, a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.BatchSize = 1
+
+	var a = []struct {
+		q   Query
+		ids string
+	}{
+		{Query{}, "1 2 3 4"},
+		{Query{Segments: []string{"payer", "tester"}}, "2 3 4"},
+		{Query{MinLevel: 10, MaxLevel: 15}, "3 4"},
+		{Query{MinSpend: 1, MaxSpend: 999}, "3"},
+		{Query{Segments: []string{"country:de"}, MinLevel: 10}, "3"},
+	}
+	for i, v := range a {
+		j, err := NewJob("export", &v.q, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = x.JobHandler()(context.Background(), j); err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(sink["export"].String()), "\n")
+		var ids []string
+		for _, l := range lines[1:] {
+			ids = append(ids, strings.SplitN(l, ",", 2)[0])
+		}
+		if got := strings.Join(ids, " "); got != v.ids {
+			t.Errorf("%d: unexpected players %q", i, got)
+		}
+	}
+	want := "3,12,999,payer country:de,2020-02-01T00:00:00Z"
+	if got := strings.Split(sink["export"].String(), "\n")[1]; got != want {
+		t.Errorf("unexpected row %q", got)
+	}
+	if _, err = NewJob("../export", nil, 1); err == nil {
+		t.Error("expected an invalid export name error")
+	}
+}
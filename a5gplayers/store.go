@@ -0,0 +1,166 @@
+package a5gplayers
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryStore struct {
+	mu      sync.Mutex
+	players map[uint64]*Player
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{players: make(map[uint64]*Player)}
+}
+
+func clone(p *Player) *Player {
+	x := *p
+	x.Segments = append([]string(nil), p.Segments...)
+	return &x
+}
+
+func (s *memoryStore) Upsert(p *Player) error {
+	s.mu.Lock()
+	s.players[p.AccountID] = clone(p)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryStore) Find(q *Query, afterID uint64, limit int) ([]*Player, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := []*Player{}
+	for _, p := range s.players {
+		if p.AccountID > afterID && q.Match(p) {
+			a = append(a, clone(p))
+		}
+	}
+	sort.Slice(a, func(i, j int) bool { return a[i].AccountID < a[j].AccountID })
+	if limit > 0 && len(a) > limit {
+		a = a[:limit]
+	}
+	return a, nil
+}
+
+// dbStore keeps the index in MySQL tables, segments in one of their own
+// to be indexed:
+//
+//	CREATE TABLE players_index (
+//	  account_id BIGINT UNSIGNED NOT NULL PRIMARY KEY,
+//	  level BIGINT NOT NULL,
+//	  spend BIGINT NOT NULL,
+//	  segments VARCHAR(1024) NOT NULL,
+//	  last_seen DATETIME NOT NULL,
+//	  KEY (level), KEY (spend));
+//
+//	CREATE TABLE players_segments (
+//	  segment VARCHAR(64) NOT NULL,
+//	  account_id BIGINT UNSIGNED NOT NULL,
+//	  PRIMARY KEY (segment, account_id));
+type dbStore struct {
+	pooler            a5gdb.Pooler
+	tableName         string
+	segmentsTableName string
+}
+
+type dbPlayer struct {
+	AccountID uint64    `db:"account_id"`
+	Level     int64     `db:"level"`
+	Spend     int64     `db:"spend"`
+	Segments  string    `db:"segments"`
+	LastSeen  time.Time `db:"last_seen"`
+}
+
+func NewDBStore(p a5gdb.Pooler, tableName, segmentsTableName string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if tableName == "" || segmentsTableName == "" {
+		return nil, errors.New("empty players table name")
+	}
+	return &dbStore{
+		pooler:            p,
+		tableName:         tableName,
+		segmentsTableName: segmentsTableName}, nil
+}
+
+func (s *dbStore) Upsert(p *Player) error {
+	tx, err := s.pooler.WritePool().NewSession().Begin()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*Session).Begin fn")
+	}
+	defer tx.RollbackUnlessCommitted()
+	_, err = tx.InsertBySql("INSERT INTO "+s.tableName+
+		" (account_id, level, spend, segments, last_seen) VALUES (?, ?, ?, ?, ?)"+
+		" ON DUPLICATE KEY UPDATE level = VALUES(level), spend = VALUES(spend),"+
+		" segments = VALUES(segments), last_seen = VALUES(last_seen)",
+		p.AccountID, p.Level, p.Spend, strings.Join(p.Segments, " "),
+		p.LastSeen.UTC()).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	_, err = tx.DeleteFrom(s.segmentsTableName).
+		Where(dbr.Eq("account_id", p.AccountID)).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*DeleteStmt).Exec fn")
+	}
+	if len(p.Segments) > 0 {
+		stmt := tx.InsertInto(s.segmentsTableName).Columns("segment", "account_id")
+		for _, segment := range p.Segments {
+			stmt.Values(segment, p.AccountID)
+		}
+		if _, err = stmt.Exec(); err != nil {
+			return errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return errors.Wrap(err, "dbr.(*Tx).Commit fn")
+	}
+	return nil
+}
+
+func (s *dbStore) Find(q *Query, afterID uint64, limit int) ([]*Player, error) {
+	stmt := s.pooler.ReadPool().NewSession().
+		Select("account_id", "level", "spend", "segments", "last_seen").
+		From(s.tableName).Where(dbr.Gt("account_id", afterID)).OrderAsc("account_id")
+	if limit > 0 {
+		stmt.Limit(uint64(limit))
+	}
+	if q.MinLevel > 0 {
+		stmt.Where(dbr.Gte("level", q.MinLevel))
+	}
+	if q.MaxLevel > 0 {
+		stmt.Where(dbr.Lte("level", q.MaxLevel))
+	}
+	if q.MinSpend > 0 {
+		stmt.Where(dbr.Gte("spend", q.MinSpend))
+	}
+	if q.MaxSpend > 0 {
+		stmt.Where(dbr.Lte("spend", q.MaxSpend))
+	}
+	if len(q.Segments) > 0 {
+		stmt.Where("account_id IN (SELECT account_id FROM "+s.segmentsTableName+
+			" WHERE segment IN ?)", q.Segments)
+	}
+	var a []*dbPlayer
+	if _, err := stmt.Load(&a); err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	players := make([]*Player, len(a))
+	for i, x := range a {
+		players[i] = &Player{
+			AccountID: x.AccountID,
+			Level:     x.Level,
+			Spend:     x.Spend,
+			Segments:  strings.Fields(x.Segments),
+			LastSeen:  x.LastSeen.UTC()}
+	}
+	return players, nil
+}
@@ -0,0 +1,51 @@
+package a5gpricing
+
+import (
+	"context"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gvalidate"
+)
+
+type PricesResponse struct {
+	Prices map[string]int64 `json:"prices"`
+}
+
+type ChangesRequest struct {
+	SinkID string `json:"sinkId"`
+	Limit  int    `json:"limit" validate:"min=0,max=500"`
+}
+
+type ChangesResponse struct {
+	Changes []*Change `json:"changes"`
+}
+
+// PricesHandler answers with current sink prices for clients.
+func (e *Engine) PricesHandler() a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		return &PricesResponse{Prices: e.Prices()}, nil
+	}
+}
+
+// ChangesHandler answers with the price change log, mount it on an admin
+// route class.
+func (e *Engine) ChangesHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(ChangesRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			r := req.Payload.(*ChangesRequest)
+			limit := r.Limit
+			if limit == 0 {
+				limit = 100
+			}
+			a, err := e.Store.Changes(r.SinkID, limit)
+			if err != nil {
+				e.Logger.Error(err.Error())
+				return nil, a5gapi.NewJSONMsgDefautlErrors(err)
+			}
+			return &ChangesResponse{Changes: a}, nil
+		})
+}
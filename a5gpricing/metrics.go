@@ -0,0 +1,55 @@
+package a5gpricing
+
+import (
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/pkg/errors"
+)
+
+// ledgerMetrics derives inflation from a5gwallet tables: the net amount
+// booked on player accounts over the window against the supply before it.
+type ledgerMetrics struct {
+	pooler            a5gdb.Pooler
+	balancesTableName string
+	ledgerTableName   string
+}
+
+func NewLedgerMetrics(
+	p a5gdb.Pooler, balancesTableName, ledgerTableName string) (Metrics, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if balancesTableName == "" || ledgerTableName == "" {
+		return nil, errors.New("empty wallet table name")
+	}
+	return &ledgerMetrics{
+		pooler:            p,
+		balancesTableName: balancesTableName,
+		ledgerTableName:   ledgerTableName}, nil
+}
+
+func (m *ledgerMetrics) Inflation(currency string, window time.Duration) (float64, error) {
+	sess := m.pooler.ReadPool().NewSession()
+	var supply, net int64
+	err := sess.Select("COALESCE(SUM(balance), 0)").From(m.balancesTableName).
+		Where("currency = ?", currency).LoadOne(&supply)
+	if err != nil {
+		return 0, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	err = sess.Select("COALESCE(SUM(amount), 0)").From(m.ledgerTableName).
+		Where("currency = ? AND account LIKE 'player:%' AND created_at >= ?",
+			currency, time.Now().Add(-window).UTC()).LoadOne(&net)
+	if err != nil {
+		return 0, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	return inflation(supply, net), nil
+}
+
+func inflation(supply, net int64) float64 {
+	before := supply - net
+	if before <= 0 {
+		return 0
+	}
+	return float64(net) / float64(before)
+}
@@ -0,0 +1,283 @@
+package a5gpricing
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+var ErrSinkUnknown = errors.New("sink unknown")
+
+// Sink is a priced currency sink, e.g. a speed-up or a shop refresh.
+// Prices follow inflation of Currency: a price is Base times one plus
+// Sensitivity times inflation, moves by MaxStep of the current price at
+// most per adjustment and stays within designer-set Min and Max.
+type Sink struct {
+	ID          string  `json:"id"`
+	Currency    string  `json:"currency"`
+	Base        int64   `json:"base"`
+	Min         int64   `json:"min"`
+	Max         int64   `json:"max"`
+	Sensitivity float64 `json:"sensitivity"`
+	MaxStep     float64 `json:"maxStep"`
+}
+
+func (s *Sink) validate() error {
+	if s.ID == "" || s.Currency == "" {
+		return errors.New("empty sink id or currency")
+	}
+	if s.Min <= 0 || s.Min > s.Base || s.Base > s.Max {
+		return errors.Errorf("sink %q: base %d out of bounds [%d, %d]",
+			s.ID, s.Base, s.Min, s.Max)
+	}
+	if s.Sensitivity < 0 || s.MaxStep <= 0 {
+		return errors.Errorf("sink %q: negative sensitivity or no step", s.ID)
+	}
+	return nil
+}
+
+// Metrics reports inflation of a currency over a window: the growth of
+// its money supply, e.g. 0.05 for 5%.
+type Metrics interface {
+	Inflation(currency string, window time.Duration) (float64, error)
+}
+
+// Change is a logged price change.
+type Change struct {
+	SinkID    string  `json:"sinkId"`
+	From      int64   `json:"from"`
+	To        int64   `json:"to"`
+	Inflation float64 `json:"inflation"`
+	At        int64   `json:"at"`
+}
+
+// Store keeps current prices and their change log. Set stores a price
+// with its change atomically; Changes lists changes of a sink, of all
+// when empty, newest first.
+type Store interface {
+	Prices() (map[string]int64, error)
+	Set(c *Change) error
+	Changes(sinkID string, limit int) ([]*Change, error)
+}
+
+// Engine adjusts prices of Sinks every Interval by inflation over Window.
+// It is an a5gapp.Module; Start loads current prices. Adjust on a single
+// server of a cluster, Follower engines of the others only reload prices
+// every Interval.
+type Engine struct {
+	Sinks    []*Sink
+	Metrics  Metrics
+	Store    Store
+	Logger   a5glogs.Logger
+	Window   time.Duration
+	Interval time.Duration
+	Follower bool
+
+	now     func() time.Time
+	mu      sync.RWMutex
+	prices  map[string]int64
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+func NewEngine(sinks []*Sink, m Metrics, s Store, l a5glogs.Logger) (*Engine, error) {
+	ids := make(map[string]bool, len(sinks))
+	for _, x := range sinks {
+		if x == nil {
+			return nil, errors.New("nil sink")
+		}
+		if err := x.validate(); err != nil {
+			return nil, err
+		}
+		if ids[x.ID] {
+			return nil, errors.Errorf("duplicate sink %q", x.ID)
+		}
+		ids[x.ID] = true
+	}
+	if m == nil {
+		return nil, errors.New("metrics missing")
+	}
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Engine{
+		Sinks:    sinks,
+		Metrics:  m,
+		Store:    s,
+		Logger:   l,
+		Window:   7 * 24 * time.Hour,
+		Interval: time.Hour,
+		now:      time.Now,
+		prices:   map[string]int64{}}, nil
+}
+
+func (e *Engine) sink(id string) (*Sink, bool) {
+	for _, s := range e.Sinks {
+		if s.ID == id {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// Price is the current price of a sink, its Base until adjusted.
+func (e *Engine) Price(id string) (int64, error) {
+	s, ok := e.sink(id)
+	if !ok {
+		return 0, errors.Wrap(ErrSinkUnknown, id)
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if p, ok := e.prices[id]; ok {
+		return clamp(p, s.Min, s.Max), nil
+	}
+	return s.Base, nil
+}
+
+// Prices returns current prices of every sink.
+func (e *Engine) Prices() map[string]int64 {
+	m := make(map[string]int64, len(e.Sinks))
+	for _, s := range e.Sinks {
+		m[s.ID], _ = e.Price(s.ID)
+	}
+	return m
+}
+
+// Load reads current prices from the store, e.g. on other servers of
+// the cluster after an adjustment.
+func (e *Engine) Load() error {
+	m, err := e.Store.Prices()
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.prices = m
+	e.mu.Unlock()
+	return nil
+}
+
+func clamp(n, min, max int64) int64 {
+	if n < min {
+		return min
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
+
+// target is the price a sink moves to from current under inflation.
+func (s *Sink) target(current int64, inflation float64) int64 {
+	want := float64(s.Base) * (1 + s.Sensitivity*inflation)
+	step := float64(current) * s.MaxStep
+	want = math.Max(float64(current)-step, math.Min(float64(current)+step, want))
+	return clamp(int64(math.Floor(want+0.5)), s.Min, s.Max)
+}
+
+// Adjust moves prices towards their targets and returns the changes.
+// Inflation is read once per currency.
+func (e *Engine) Adjust(ctx context.Context) ([]*Change, error) {
+	inflation := make(map[string]float64)
+	var a []*Change
+	for _, s := range e.Sinks {
+		if err := ctx.Err(); err != nil {
+			return a, errors.WithStack(err)
+		}
+		infl, ok := inflation[s.Currency]
+		if !ok {
+			var err error
+			if infl, err = e.Metrics.Inflation(s.Currency, e.Window); err != nil {
+				return a, errors.Wrapf(err, "inflation of %s", s.Currency)
+			}
+			inflation[s.Currency] = infl
+		}
+		current, _ := e.Price(s.ID)
+		next := s.target(current, infl)
+		if next == current {
+			continue
+		}
+		c := &Change{SinkID: s.ID, From: current, To: next,
+			Inflation: infl, At: e.now().Unix()}
+		if err := e.Store.Set(c); err != nil {
+			return a, err
+		}
+		e.mu.Lock()
+		e.prices[s.ID] = next
+		e.mu.Unlock()
+		e.Logger.With(a5gfields.String("sink", s.ID),
+			a5gfields.Int64("from", current),
+			a5gfields.Int64("to", next)).Info("sink price changed")
+		a = append(a, c)
+	}
+	sort.Slice(a, func(i, j int) bool { return a[i].SinkID < a[j].SinkID })
+	return a, nil
+}
+
+func (e *Engine) Name() string { return "pricing" }
+
+// Start loads prices and adjusts them every Interval until Stop is
+// called.
+func (e *Engine) Start(context.Context) error {
+	if err := e.Load(); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.cancel != nil {
+		return errors.New("pricing engine already started")
+	}
+	var ctx context.Context
+	ctx, e.cancel = context.WithCancel(context.Background())
+	e.stopped = make(chan struct{})
+	go e.run(ctx, e.stopped)
+	return nil
+}
+
+func (e *Engine) run(ctx context.Context, stopped chan struct{}) {
+	defer close(stopped)
+	t := time.NewTicker(e.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		var err error
+		if e.Follower {
+			err = e.Load()
+		} else {
+			_, err = e.Adjust(ctx)
+		}
+		if err != nil && ctx.Err() == nil {
+			e.Logger.Error(err.Error())
+		}
+	}
+}
+
+// Stop waits for the running adjustment until ctx is done.
+func (e *Engine) Stop(ctx context.Context) error {
+	e.mu.Lock()
+	cancel, stopped := e.cancel, e.stopped
+	e.cancel = nil
+	e.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
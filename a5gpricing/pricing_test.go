@@ -0,0 +1,73 @@
+package a5gpricing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+type metricsFunc func(currency string) float64
+
+func (fn metricsFunc) Inflation(currency string, window time.Duration) (float64, error) {
+	return fn(currency), nil
+}
+
+func TestEngineAdjust(t *testing.T) {
+	infl := map[string]float64{"soft": 0.5, "hard": -0.2}
+	sinks := []*Sink{
+		{ID: "speedup", Currency: "soft", Base: 100, Min: 50, Max: 130,
+			Sensitivity: 1, MaxStep: 0.1},
+		{ID: "refresh", Currency: "hard", Base: 20, Min: 18, Max: 40,
+			Sensitivity: 1, MaxStep: 0.5}}
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	if _, err := NewEngine([]*Sink{{ID: "x", Currency: "soft", Base: 10,
+		Min: 20, Max: 30, MaxStep: 1}}, metricsFunc(nil), NewMemoryStore(), l); err == nil {
+		t.Fatal("expected a bounds error")
+	}
+	s := NewMemoryStore()
+	e, err := NewEngine(sinks, metricsFunc(func(c string) float64 { return infl[c] }), s, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	// Prices move by 10% per step up to the max of 130.
+	for _, expected := range []int64{110, 121, 130, 130} {
+		if _, err = e.Adjust(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if p, _ := e.Price("speedup"); p != expected {
+			t.Errorf("expected %d, got %d", expected, p)
+		}
+	}
+	// Deflation lowers the price to the floor of 18, not 16.
+	if p, _ := e.Price("refresh"); p != 18 {
+		t.Errorf("unexpected refresh price %d", p)
+	}
+	changes, _ := s.Changes("speedup", 0)
+	if len(changes) != 3 || changes[0].From != 121 || changes[0].To != 130 ||
+		changes[0].Inflation != 0.5 {
+		t.Errorf("unexpected changes %+v", changes[0])
+	}
+
+	// A follower picks adjusted prices up on Load.
+	f, _ := NewEngine(sinks, metricsFunc(nil), s, l)
+	if p, _ := f.Price("speedup"); p != 100 {
+		t.Errorf("unexpected price before load %d", p)
+	}
+	if err = f.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := f.Price("speedup"); p != 130 {
+		t.Errorf("unexpected price after load %d", p)
+	}
+	if _, err = f.Price("gacha"); errors.Cause(err) != ErrSinkUnknown {
+		t.Errorf("unexpected error %v", err)
+	}
+	if x := inflation(1100, 100); x != 0.1 {
+		t.Errorf("unexpected inflation %v", x)
+	}
+}
@@ -0,0 +1,163 @@
+package a5gpricing
+
+import (
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryStore struct {
+	mu      sync.Mutex
+	prices  map[string]int64
+	changes []*Change
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{prices: make(map[string]int64)}
+}
+
+func (s *memoryStore) Prices() (map[string]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := make(map[string]int64, len(s.prices))
+	for id, p := range s.prices {
+		m[id] = p
+	}
+	return m, nil
+}
+
+func (s *memoryStore) Set(c *Change) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prices[c.SinkID] = c.To
+	x := *c
+	s.changes = append(s.changes, &x)
+	return nil
+}
+
+func (s *memoryStore) Changes(sinkID string, limit int) ([]*Change, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := []*Change{}
+	for i := len(s.changes) - 1; i >= 0 && (limit <= 0 || len(a) < limit); i-- {
+		if sinkID == "" || s.changes[i].SinkID == sinkID {
+			x := *s.changes[i]
+			a = append(a, &x)
+		}
+	}
+	return a, nil
+}
+
+// dbStore keeps prices and their changes in MySQL tables:
+//
+//	CREATE TABLE sink_prices (
+//	  sink_id VARCHAR(64) NOT NULL PRIMARY KEY,
+//	  price BIGINT NOT NULL,
+//	  updated_at DATETIME NOT NULL);
+//
+//	CREATE TABLE sink_price_changes (
+//	  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+//	  sink_id VARCHAR(64) NOT NULL,
+//	  from_price BIGINT NOT NULL,
+//	  to_price BIGINT NOT NULL,
+//	  inflation DOUBLE NOT NULL,
+//	  created_at DATETIME NOT NULL,
+//	  KEY sink_id (sink_id, id));
+type dbStore struct {
+	pooler           a5gdb.Pooler
+	pricesTableName  string
+	changesTableName string
+}
+
+type dbPrice struct {
+	SinkID string `db:"sink_id"`
+	Price  int64  `db:"price"`
+}
+
+type dbChange struct {
+	SinkID    string    `db:"sink_id"`
+	From      int64     `db:"from_price"`
+	To        int64     `db:"to_price"`
+	Inflation float64   `db:"inflation"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+func NewDBStore(
+	p a5gdb.Pooler, pricesTableName, changesTableName string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if pricesTableName == "" || changesTableName == "" {
+		return nil, errors.New("empty sink prices table name")
+	}
+	return &dbStore{
+		pooler:           p,
+		pricesTableName:  pricesTableName,
+		changesTableName: changesTableName}, nil
+}
+
+func (s *dbStore) Prices() (map[string]int64, error) {
+	var rows []*dbPrice
+	_, err := s.pooler.ReadPool().NewSession().
+		Select("sink_id", "price").From(s.pricesTableName).Load(&rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	m := make(map[string]int64, len(rows))
+	for _, r := range rows {
+		m[r.SinkID] = r.Price
+	}
+	return m, nil
+}
+
+func (s *dbStore) Set(c *Change) error {
+	tx, err := s.pooler.WritePool().NewSession().Begin()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*Session).Begin fn")
+	}
+	defer tx.RollbackUnlessCommitted()
+	at := time.Unix(c.At, 0).UTC()
+	_, err = tx.InsertBySql("INSERT INTO "+s.pricesTableName+
+		" (sink_id, price, updated_at) VALUES (?, ?, ?)"+
+		" ON DUPLICATE KEY UPDATE price = VALUES(price), updated_at = VALUES(updated_at)",
+		c.SinkID, c.To, at).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	_, err = tx.InsertInto(s.changesTableName).
+		Columns("sink_id", "from_price", "to_price", "inflation", "created_at").
+		Record(&dbChange{SinkID: c.SinkID, From: c.From, To: c.To,
+			Inflation: c.Inflation, CreatedAt: at}).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	if err = tx.Commit(); err != nil {
+		return errors.Wrap(err, "dbr.(*Tx).Commit fn")
+	}
+	return nil
+}
+
+func (s *dbStore) Changes(sinkID string, limit int) ([]*Change, error) {
+	stmt := s.pooler.ReadPool().NewSession().
+		Select("sink_id", "from_price", "to_price", "inflation", "created_at").
+		From(s.changesTableName).OrderDesc("id")
+	if sinkID != "" {
+		stmt.Where(dbr.Eq("sink_id", sinkID))
+	}
+	if limit > 0 {
+		stmt.Limit(uint64(limit))
+	}
+	var rows []*dbChange
+	if _, err := stmt.Load(&rows); err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	a := make([]*Change, 0, len(rows))
+	for _, r := range rows {
+		a = append(a, &Change{SinkID: r.SinkID, From: r.From, To: r.To,
+			Inflation: r.Inflation, At: r.CreatedAt.Unix()})
+	}
+	return a, nil
+}
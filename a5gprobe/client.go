@@ -0,0 +1,108 @@
+package a5gprobe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+// Client calls the game API the way the game client does: envelopes
+// posted with the a5gsession bearer Token. Vars carries values between
+// steps, e.g. the test account ID.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	Token      string
+	Vars       map[string]string
+	Logger     a5glogs.Logger
+}
+
+func NewClient(baseURL string, l a5glogs.Logger) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: &http.Client{},
+		Vars:       make(map[string]string),
+		Logger:     l}
+}
+
+// Call posts payload to path and decodes the response payload into out,
+// when not nil. Unsuccessful responses fail with their messages.
+func (c *Client) Call(
+	ctx context.Context, path string, payload, out interface{}) error {
+	b, err := json.Marshal(&a5gapi.APIMsgRequest{
+		Payload: payload,
+		Time:    uint64(time.Now().Unix())})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, c.BaseURL+path, bytes.NewReader(b))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	res, err := c.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			c.Logger.Error(err.Error())
+		}
+	}()
+	b, err = ioutil.ReadAll(res.Body)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	x := &struct {
+		Success bool             `json:"success"`
+		Errs    []*a5gapi.APIErr `json:"messages"`
+		Payload json.RawMessage  `json:"payload"`
+	}{}
+	if err := json.Unmarshal(b, x); err != nil {
+		return errors.Wrapf(err, "%s: status %d", path, res.StatusCode)
+	}
+	if !x.Success {
+		var a []string
+		for _, e := range x.Errs {
+			if e.Err != nil {
+				a = append(a, e.Error())
+			}
+		}
+		return errors.Errorf("%s: status %d: %s",
+			path, res.StatusCode, strings.Join(a, "; "))
+	}
+	if out != nil && len(x.Payload) > 0 {
+		if err := json.Unmarshal(x.Payload, out); err != nil {
+			return errors.Wrap(err, path)
+		}
+	}
+	return nil
+}
+
+// CallStep is a step calling path with payload; check, when set,
+// validates the decoded response payload and may keep values of it in
+// the client, e.g. the session token of a guest login.
+func CallStep(name, path string, payload interface{},
+	check func(c *Client, res map[string]interface{}) error) *Step {
+	return &Step{Name: name, Run: func(ctx context.Context, c *Client) error {
+		var res map[string]interface{}
+		if err := c.Call(ctx, path, payload, &res); err != nil {
+			return err
+		}
+		if check == nil {
+			return nil
+		}
+		return check(c, res)
+	}}
+}
@@ -0,0 +1,295 @@
+package a5gprobe
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5gcost"
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+// ResourceProbe is the a5gcost resource probe steps are metered as, the
+// feature being the probe name.
+const ResourceProbe = "probe"
+
+// Step is a part of a flow, e.g. a guest login. Steps of a run share the
+// Client, so a login step sets its Token for the following ones.
+type Step struct {
+	Name string
+	Run  func(ctx context.Context, c *Client) error
+}
+
+// Probe is an end-to-end flow run every Interval against a deployment at
+// BaseURL with a test account, e.g. guest login, sync and store fetch.
+// A run fails when it is not done within Timeout.
+type Probe struct {
+	Name     string
+	BaseURL  string
+	Steps    []*Step
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+// StepResult is a finished step, LatencyMs in milliseconds.
+type StepResult struct {
+	Name      string  `json:"name"`
+	LatencyMs float64 `json:"latencyMs"`
+	Err       string  `json:"error,omitempty"`
+}
+
+// Result is a run of a probe: Step is the failed step, if any; At is the
+// start time in unix seconds.
+type Result struct {
+	Probe     string        `json:"probe"`
+	OK        bool          `json:"ok"`
+	Step      string        `json:"step,omitempty"`
+	Err       string        `json:"error,omitempty"`
+	LatencyMs float64       `json:"latencyMs"`
+	Steps     []*StepResult `json:"steps"`
+	At        int64         `json:"at"`
+}
+
+// Alert is raised when a probe failed Threshold runs in a row and, with
+// Resolved, when it passes again.
+type Alert struct {
+	Probe    string  `json:"probe"`
+	Failures int     `json:"failures"`
+	Resolved bool    `json:"resolved,omitempty"`
+	Last     *Result `json:"last"`
+}
+
+// Alerter delivers alerts, e.g. to the on-call chat.
+type Alerter interface {
+	Alert(*Alert) error
+}
+
+type AlerterFunc func(*Alert) error
+
+func (fn AlerterFunc) Alert(a *Alert) error { return fn(a) }
+
+// Status is the record of a probe: run counts, latencies of passed runs in
+// milliseconds and the last result.
+type Status struct {
+	Probe        string  `json:"probe"`
+	Runs         int64   `json:"runs"`
+	Failures     int64   `json:"failures"`
+	Consecutive  int     `json:"consecutive"`
+	Alerting     bool    `json:"alerting"`
+	AvgLatencyMs float64 `json:"avgLatencyMs"`
+	MaxLatencyMs float64 `json:"maxLatencyMs"`
+	Last         *Result `json:"last,omitempty"`
+
+	latency time.Duration
+}
+
+// Prober runs probes on their own intervals. Threshold consecutive
+// failures raise an alert, so a single network blip does not page anyone;
+// Meter, when set, meters every step.
+type Prober struct {
+	Probes    []*Probe
+	Alerter   Alerter
+	Logger    a5glogs.Logger
+	Meter     *a5gcost.Meter
+	Threshold int
+
+	now     func() time.Time
+	mu      sync.Mutex
+	status  map[string]*Status
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+func NewProber(a Alerter, l a5glogs.Logger, probes ...*Probe) (*Prober, error) {
+	if a == nil {
+		return nil, errors.New("alerter missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	names := make(map[string]bool, len(probes))
+	for _, p := range probes {
+		switch {
+		case p == nil:
+			return nil, errors.New("nil probe")
+		case p.Name == "":
+			return nil, errors.New("empty probe name")
+		case names[p.Name]:
+			return nil, errors.Errorf("duplicate probe %q", p.Name)
+		case len(p.Steps) == 0:
+			return nil, errors.Errorf("probe %q has no steps", p.Name)
+		case p.Interval <= 0:
+			return nil, errors.Errorf("probe %q has no interval", p.Name)
+		}
+		names[p.Name] = true
+	}
+	return &Prober{
+		Probes:    probes,
+		Alerter:   a,
+		Logger:    l,
+		Threshold: 2,
+		now:       time.Now,
+		status:    make(map[string]*Status)}, nil
+}
+
+// Run runs a probe once and records its result.
+func (p *Prober) Run(ctx context.Context, x *Probe) *Result {
+	if x.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, x.Timeout)
+		defer cancel()
+	}
+	c := NewClient(x.BaseURL, p.Logger)
+	start := p.now()
+	res := &Result{Probe: x.Name, OK: true, At: start.Unix()}
+	for _, s := range x.Steps {
+		t := p.now()
+		err := s.Run(ctx, c)
+		d := p.now().Sub(t)
+		if p.Meter != nil {
+			p.Meter.Observe(x.Name, ResourceProbe, d, err)
+		}
+		y := &StepResult{Name: s.Name, LatencyMs: ms(d)}
+		res.Steps = append(res.Steps, y)
+		if err != nil {
+			y.Err = err.Error()
+			res.OK, res.Step, res.Err = false, s.Name, y.Err
+			break
+		}
+	}
+	d := p.now().Sub(start)
+	res.LatencyMs = ms(d)
+	p.record(res, d)
+	return res
+}
+
+func (p *Prober) record(res *Result, d time.Duration) {
+	p.mu.Lock()
+	s, ok := p.status[res.Probe]
+	if !ok {
+		s = &Status{Probe: res.Probe}
+		p.status[res.Probe] = s
+	}
+	s.Runs++
+	s.Last = res
+	var a *Alert
+	if res.OK {
+		s.latency += d
+		s.AvgLatencyMs = ms(s.latency) / float64(s.Runs-s.Failures)
+		if x := ms(d); x > s.MaxLatencyMs {
+			s.MaxLatencyMs = x
+		}
+		if s.Alerting {
+			a = &Alert{Probe: res.Probe, Failures: s.Consecutive,
+				Resolved: true, Last: res}
+		}
+		s.Consecutive, s.Alerting = 0, false
+	} else {
+		s.Failures++
+		s.Consecutive++
+		if !s.Alerting && s.Consecutive >= p.Threshold {
+			s.Alerting = true
+			a = &Alert{Probe: res.Probe, Failures: s.Consecutive, Last: res}
+		}
+	}
+	p.mu.Unlock()
+	if !res.OK {
+		p.Logger.With(
+			a5gfields.String("probe", res.Probe),
+			a5gfields.String("step", res.Step)).Warn(res.Err)
+	}
+	if a != nil {
+		if err := p.Alerter.Alert(a); err != nil {
+			p.Logger.Error(err.Error())
+		}
+	}
+}
+
+// Report returns statuses of probes which ran, sorted by name.
+func (p *Prober) Report() []*Status {
+	p.mu.Lock()
+	a := make([]*Status, 0, len(p.status))
+	for _, s := range p.status {
+		x := *s
+		a = append(a, &x)
+	}
+	p.mu.Unlock()
+	sort.Slice(a, func(i, j int) bool { return a[i].Probe < a[j].Probe })
+	return a
+}
+
+// ReportHandler answers with the Report for dashboards, mount it on an
+// admin route class.
+func (p *Prober) ReportHandler() a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		return p.Report(), nil
+	}
+}
+
+// Start runs every probe on its interval until Stop is called. Run a
+// single prober per deployment, so test accounts are not used
+// concurrently.
+func (p *Prober) Start() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cancel != nil {
+		return errors.New("prober already started")
+	}
+	var ctx context.Context
+	ctx, p.cancel = context.WithCancel(context.Background())
+	p.stopped = make(chan struct{})
+	var wg sync.WaitGroup
+	for _, x := range p.Probes {
+		wg.Add(1)
+		go func(x *Probe) {
+			defer wg.Done()
+			p.run(ctx, x)
+		}(x)
+	}
+	go func(stopped chan struct{}) {
+		wg.Wait()
+		close(stopped)
+	}(p.stopped)
+	return nil
+}
+
+func (p *Prober) run(ctx context.Context, x *Probe) {
+	t := time.NewTicker(x.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		p.Run(ctx, x)
+	}
+}
+
+// Stop waits for running probes until ctx is done.
+func (p *Prober) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	cancel, stopped := p.cancel, p.stopped
+	p.cancel = nil
+	p.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
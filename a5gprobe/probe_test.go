@@ -0,0 +1,84 @@
+package a5gprobe
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestProberRun(t *testing.T) {
+	down := false
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			res := map[string]interface{}{"success": true}
+			switch {
+			case r.URL.Path == "/login":
+				res["payload"] = map[string]string{"token": "t1"}
+			case r.Header.Get("Authorization") != "Bearer t1":
+				w.WriteHeader(http.StatusUnauthorized)
+				res = map[string]interface{}{"success": false,
+					"messages": []map[string]interface{}{
+						{"code": 4010, "message": "unauthorized"}}}
+			case down:
+				w.WriteHeader(http.StatusServiceUnavailable)
+				res = map[string]interface{}{"success": false}
+			}
+			json.NewEncoder(w).Encode(res)
+		}))
+	defer srv.Close()
+	var alerts []*Alert
+	p, err := NewProber(AlerterFunc(func(a *Alert) error {
+		alerts = append(alerts, a)
+		return nil
+	}), a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	login := CallStep("login", "/login", nil,
+		func(c *Client, res map[string]interface{}) error {
+			s, _ := res["token"].(string)
+			if s == "" {
+				return errors.New("token missing")
+			}
+			c.Token = s
+			return nil
+		})
+	x := &Probe{Name: "store", BaseURL: srv.URL,
+		Steps: []*Step{login, CallStep("store", "/store", nil, nil)}}
+	tests := []struct {
+		name   string
+		down   bool
+		ok     bool
+		alerts int
+	}{
+		{"passed", false, true, 0},
+		{"failed once", true, false, 0},
+		{"failed twice", true, false, 1},
+		{"failed again", true, false, 1},
+		{"recovered", false, true, 2},
+	}
+	for _, test := range tests {
+		down = test.down
+		res := p.Run(context.Background(), x)
+		if res.OK != test.ok || len(alerts) != test.alerts {
+			t.Errorf("%s: unexpected result %+v, alerts %d",
+				test.name, res, len(alerts))
+		}
+		if !res.OK && res.Step != "store" {
+			t.Errorf("%s: unexpected failed step %q", test.name, res.Step)
+		}
+	}
+	if !alerts[1].Resolved || alerts[1].Failures != 3 {
+		t.Errorf("unexpected resolved alert %+v", alerts[1])
+	}
+	r := p.Report()
+	if len(r) != 1 || r[0].Runs != 5 || r[0].Failures != 3 || r[0].Alerting {
+		t.Errorf("unexpected report %+v", r)
+	}
+}
@@ -0,0 +1,98 @@
+package a5gpseudonyms
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type Kind string
+
+const (
+	KindAccount Kind = "account"
+	KindDevice  Kind = "device"
+)
+
+func (k Kind) String() string { return string(k) }
+
+// Pseudonymizer replaces identifiers with salted HMAC-SHA256 digests before
+// they reach the analytics sink. The same id always maps to the same
+// pseudonym, so events can still be joined, but the mapping cannot be
+// reversed without the escrow key.
+type Pseudonymizer struct {
+	salt   []byte
+	escrow *rsa.PublicKey
+}
+
+// NewPseudonymizer takes the secret salt and, optionally, the escrow public
+// key used by Seal. Only the holder of the matching private key (see
+// Reidentifier) can turn pseudonyms back into ids.
+func NewPseudonymizer(salt string, escrow *rsa.PublicKey) (
+	*Pseudonymizer, error) {
+	if salt == "" {
+		return nil, errors.New("empty pseudonym salt")
+	}
+	return &Pseudonymizer{salt: []byte(salt), escrow: escrow}, nil
+}
+
+func (p *Pseudonymizer) Pseudonym(k Kind, id string) string {
+	h := hmac.New(sha256.New, p.salt)
+	// hash.Hash never returns an error on Write.
+	_, _ = h.Write([]byte(k.String() + ":" + id))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (p *Pseudonymizer) AccountID(id int64) string {
+	return p.Pseudonym(KindAccount, strconv.FormatInt(id, 10))
+}
+
+func (p *Pseudonymizer) DeviceID(id string) string {
+	return p.Pseudonym(KindDevice, id)
+}
+
+// Seal returns the pseudonym and an escrow record (RSA-OAEP encrypted
+// "kind:id") which may be stored next to it for later re-identification.
+func (p *Pseudonymizer) Seal(k Kind, id string) (string, []byte, error) {
+	if p.escrow == nil {
+		return "", nil, errors.New("escrow key missing")
+	}
+	b, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, p.escrow,
+		[]byte(k.String()+":"+id), []byte(p.Pseudonym(k, id)))
+	if err != nil {
+		return "", nil, errors.Wrap(err, "rsa.EncryptOAEP fn")
+	}
+	return p.Pseudonym(k, id), b, nil
+}
+
+// Reidentifier opens escrow records. Construct it only in the restricted
+// (DPO/support) service that is allowed to hold the escrow private key.
+type Reidentifier struct{ escrow *rsa.PrivateKey }
+
+func NewReidentifier(k *rsa.PrivateKey) (*Reidentifier, error) {
+	if k == nil {
+		return nil, errors.New("escrow key missing")
+	}
+	return &Reidentifier{escrow: k}, nil
+}
+
+// Open returns the original kind and id of a sealed record; pseudonym must
+// be the one the record was stored with.
+func (r *Reidentifier) Open(pseudonym string, sealed []byte) (
+	Kind, string, error) {
+	b, err := rsa.DecryptOAEP(
+		sha256.New(), rand.Reader, r.escrow, sealed, []byte(pseudonym))
+	if err != nil {
+		return "", "", errors.Wrap(err, "rsa.DecryptOAEP fn")
+	}
+	x := strings.SplitN(string(b), ":", 2)
+	if len(x) != 2 {
+		return "", "", errors.New("bad escrow record format")
+	}
+	return Kind(x[0]), x[1], nil
+}
@@ -0,0 +1,78 @@
+package a5gpseudonyms
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+)
+
+func TestPseudonymizer(t *testing.T) {
+	if _, err := NewPseudonymizer("", nil); err == nil {
+		t.Error("expected an empty salt error")
+	}
+	p, err := NewPseudonymizer("salt", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := NewPseudonymizer("salt2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		a, b     string
+		expected bool
+	}{
+		{"deterministic", p.AccountID(42), p.AccountID(42), true},
+		{"ids", p.AccountID(42), p.AccountID(43), false},
+		{"kinds", p.AccountID(42), p.DeviceID("42"), false},
+		{"rotated salt", p.AccountID(42), rotated.AccountID(42), false},
+		{"raw", p.AccountID(42), "42", false},
+	}
+	for _, test := range tests {
+		if (test.a == test.b) != test.expected {
+			t.Errorf("%s: unexpected pseudonyms %q and %q",
+				test.name, test.a, test.b)
+		}
+	}
+}
+
+func TestSeal(t *testing.T) {
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewPseudonymizer("salt", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = p.Seal(KindDevice, "d1"); err == nil {
+		t.Error("expected an escrow key missing error")
+	}
+	p, err = NewPseudonymizer("salt", &k.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pseudonym, sealed, err := p.Seal(KindDevice, "d1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pseudonym != p.DeviceID("d1") {
+		t.Errorf("unexpected pseudonym %q", pseudonym)
+	}
+	r, err := NewReidentifier(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kind, id, err := r.Open(pseudonym, sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kind != KindDevice || id != "d1" {
+		t.Errorf("unexpected record %s:%s", kind, id)
+	}
+	// Records are bound to their pseudonym.
+	if _, _, err = r.Open(p.DeviceID("d2"), sealed); err == nil {
+		t.Error("expected an error opening a record with another pseudonym")
+	}
+}
@@ -0,0 +1,98 @@
+package a5gquest
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCodeQuestUnknown = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4045,
+		Name:     "quest_unknown",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "quest not found"})
+
+	ErrCodeNotCompleted = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4229,
+		Name:     "quest_not_completed",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "quest is not completed"})
+)
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeQuestUnknown, http.StatusNotFound)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeNotCompleted, http.StatusUnprocessableEntity)
+}
+
+type ListResponse struct {
+	Quests []*QuestView `json:"quests"`
+}
+
+type ClaimRequest struct {
+	QuestID string `json:"questId" validate:"required"`
+}
+
+// ListHandler answers with quests of the a5gsession authenticated player.
+func (q *Quests) ListHandler() a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		sess, ok := a5gsession.FromContext(ctx)
+		if !ok {
+			return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+		}
+		quests, err := q.List(ctx, sess.AccountID)
+		if err != nil {
+			return nil, q.apiErrs(err)
+		}
+		return &ListResponse{Quests: quests}, nil
+	}
+}
+
+// ClaimHandler claims a completed quest of the a5gsession authenticated
+// player and answers with the ClaimResult.
+func (q *Quests) ClaimHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(ClaimRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			sess, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			p := req.Payload.(*ClaimRequest)
+			res, err := q.Claim(ctx, sess.AccountID, p.QuestID)
+			if err != nil {
+				return nil, q.apiErrs(err)
+			}
+			return res, nil
+		})
+}
+
+func (q *Quests) apiErrs(err error) []*a5gapi.APIErr {
+	var c a5gapi.APIErrCode
+	switch errors.Cause(err) {
+	case ErrQuestUnknown:
+		c = ErrCodeQuestUnknown
+	case ErrNotCompleted:
+		c = ErrCodeNotCompleted
+	case a5gwallet.ErrBalanceCapExceeded:
+		return q.Wallet.APIErrs(err)
+	case a5ginventory.ErrCapExceeded, a5ginventory.ErrTabFull:
+		return q.Inventory.APIErrs(err)
+	default:
+		q.Logger.Error(err.Error())
+		return a5gapi.NewJSONMsgDefautlErrors(err)
+	}
+	return []*a5gapi.APIErr{a5gapi.NewErr(c, "")}
+}
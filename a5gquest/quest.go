@@ -0,0 +1,479 @@
+package a5gquest
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+)
+
+// Reason of wallet and inventory transactions of quest rewards.
+const Reason = "quest"
+
+var (
+	ErrQuestUnknown = errors.New("quest unknown")
+	ErrNotCompleted = errors.New("quest not completed")
+)
+
+// Statuses of a quest for a player; StatusLocked quests wait for their
+// prerequisites and have no progress yet.
+const (
+	StatusLocked    = "locked"
+	StatusActive    = "active"
+	StatusCompleted = "completed"
+	StatusClaimed   = "claimed"
+)
+
+// Event types passed to listeners.
+const (
+	EventProgressed = "progressed"
+	EventCompleted  = "completed"
+	EventClaimed    = "claimed"
+)
+
+// casAttempts bounds retries of progress updates raced by concurrent
+// reports of the same player.
+const casAttempts = 5
+
+// Objective counts Event reports up to Target, e.g. 10 "kill_zombie".
+type Objective struct {
+	ID     string `json:"id"`
+	Event  string `json:"event"`
+	Target int64  `json:"target"`
+}
+
+// Reward is what claiming a quest grants: wallet currencies and inventory
+// items.
+type Reward struct {
+	Currencies map[string]int64 `json:"currencies,omitempty"`
+	Items      map[string]int64 `json:"items,omitempty"`
+}
+
+// Quest is completed once every objective reached its target; Requires
+// lists quests to claim before this one unlocks and Rule, when set, a
+// rule players must match for it to unlock, see Quests.Rules.
+type Quest struct {
+	ID         string       `json:"id"`
+	Objectives []*Objective `json:"objectives"`
+	Requires   []string     `json:"requires,omitempty"`
+	Rule       string       `json:"rule,omitempty"`
+	Reward     *Reward      `json:"reward,omitempty"`
+}
+
+// Config is an balance data of quests. Quest and objective IDs key the
+// stored progress, so they must not be reused for something else;
+// objectives may be added or retargeted without migrating progress.
+type Config struct {
+	quests  []*Quest
+	byID    map[string]*Quest
+	byEvent map[string][]*Quest
+}
+
+func NewConfig(quests []*Quest) (*Config, error) {
+	c := &Config{
+		quests:  quests,
+		byID:    make(map[string]*Quest, len(quests)),
+		byEvent: make(map[string][]*Quest)}
+	for _, q := range quests {
+		if q == nil || q.ID == "" {
+			return nil, errors.New("empty quest id")
+		}
+		if c.byID[q.ID] != nil {
+			return nil, errors.Errorf("duplicate quest %q", q.ID)
+		}
+		if len(q.Objectives) == 0 {
+			return nil, errors.Errorf("quest %q has no objectives", q.ID)
+		}
+		c.byID[q.ID] = q
+		events := make(map[string]bool)
+		ids := make(map[string]bool)
+		for _, o := range q.Objectives {
+			switch {
+			case o == nil || o.ID == "" || o.Event == "":
+				return nil, errors.Errorf("quest %q has an empty objective", q.ID)
+			case ids[o.ID]:
+				return nil, errors.Errorf(
+					"quest %q has duplicate objective %q", q.ID, o.ID)
+			case o.Target <= 0:
+				return nil, errors.Errorf(
+					"quest %q objective %q has no target", q.ID, o.ID)
+			}
+			ids[o.ID] = true
+			if !events[o.Event] {
+				events[o.Event] = true
+				c.byEvent[o.Event] = append(c.byEvent[o.Event], q)
+			}
+		}
+	}
+	for _, q := range quests {
+		for _, id := range q.Requires {
+			if c.byID[id] == nil {
+				return nil, errors.Errorf(
+					"quest %q requires unknown quest %q", q.ID, id)
+			}
+		}
+	}
+	return c, nil
+}
+
+func NewConfigJSON(b []byte) (*Config, error) {
+	var quests []*Quest
+	if err := json.Unmarshal(b, &quests); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return NewConfig(quests)
+}
+
+func (c *Config) Quest(id string) (*Quest, bool) {
+	q, ok := c.byID[id]
+	return q, ok
+}
+
+// Progress is the state of a quest for a player, Counters are keyed by
+// objective ID. Version is bumped by every update.
+type Progress struct {
+	QuestID  string           `json:"questId"`
+	Status   string           `json:"status"`
+	Counters map[string]int64 `json:"counters"`
+	Version  int64            `json:"version"`
+}
+
+func (p *Progress) clone() *Progress {
+	x := *p
+	x.Counters = make(map[string]int64, len(p.Counters))
+	for k, v := range p.Counters {
+		x.Counters[k] = v
+	}
+	return &x
+}
+
+// Store keeps quest progress. Update replaces the progress of a quest
+// only while its version is still that of prev, reporting whether it did;
+// nil prev stands for no progress.
+type Store interface {
+	List(accountID uint64) (map[string]*Progress, error)
+	Get(accountID uint64, questID string) (*Progress, error)
+	Update(accountID uint64, prev, next *Progress) (bool, error)
+}
+
+// Event is passed to listeners, e.g. analytics, after progress is stored.
+type Event struct {
+	Type     string    `json:"type"`
+	QuestID  string    `json:"questId"`
+	Progress *Progress `json:"progress"`
+	At       int64     `json:"at"`
+}
+
+type EventFunc func(ctx context.Context, accountID uint64, e *Event)
+
+// RuleFunc tells whether a player matches a rule, e.g.
+// (*a5grules.Engine).Match.
+type RuleFunc func(ctx context.Context, accountID uint64, rule string) (bool, error)
+
+// Quests tracks progress other modules report, e.g.
+//
+//	quests.Report(ctx, accountID, "kill_zombie", 3)
+//
+// and grants rewards of completed quests on claim.
+type Quests struct {
+	Config    *Config
+	Store     Store
+	Wallet    *a5gwallet.Wallet
+	Inventory *a5ginventory.Inventory
+	// Rules evaluates Rule of quests; quests with a rule stay locked
+	// without it.
+	Rules  RuleFunc
+	Logger a5glogs.Logger
+
+	listeners []EventFunc
+	now       func() time.Time
+}
+
+func NewQuests(
+	c *Config, s Store, l a5glogs.Logger, listeners ...EventFunc) (*Quests, error) {
+	if c == nil {
+		return nil, errors.New("nil quest config")
+	}
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Quests{
+		Config:    c,
+		Store:     s,
+		Logger:    l,
+		listeners: listeners,
+		now:       time.Now}, nil
+}
+
+// Report counts n occurrences of event towards objectives of unlocked
+// quests and completes quests whose objectives are all done, returning
+// the changed progress.
+func (q *Quests) Report(
+	ctx context.Context, accountID uint64, event string, n int64) ([]*Progress, error) {
+	quests := q.Config.byEvent[event]
+	if n <= 0 || len(quests) == 0 {
+		return nil, nil
+	}
+	all, err := q.Store.List(accountID)
+	if err != nil {
+		return nil, err
+	}
+	var changed []*Progress
+	for _, x := range quests {
+		if !q.unlocked(ctx, accountID, x, all) {
+			continue
+		}
+		prev := all[x.ID]
+		for i := 0; ; i++ {
+			next := q.advance(x, prev, event, n)
+			if next == nil {
+				break
+			}
+			ok, err := q.Store.Update(accountID, prev, next)
+			if err != nil {
+				return changed, err
+			}
+			if ok {
+				changed = append(changed, next)
+				q.emit(ctx, accountID, EventProgressed, next)
+				if next.Status == StatusCompleted {
+					q.emit(ctx, accountID, EventCompleted, next)
+				}
+				break
+			}
+			if i == casAttempts-1 {
+				return changed, errors.Errorf(
+					"quest %q progress update conflict", x.ID)
+			}
+			if prev, err = q.Store.Get(accountID, x.ID); err != nil {
+				return changed, err
+			}
+		}
+	}
+	return changed, nil
+}
+
+// advance returns the progress after the report or nil when the quest is
+// not active or has no objective left to count the event.
+func (q *Quests) advance(x *Quest, prev *Progress, event string, n int64) *Progress {
+	var next *Progress
+	if prev == nil {
+		next = &Progress{QuestID: x.ID, Status: StatusActive,
+			Counters: make(map[string]int64)}
+	} else if prev.Status == StatusActive {
+		next = prev.clone()
+		next.Version++
+	} else {
+		return nil
+	}
+	counted := false
+	for _, o := range x.Objectives {
+		if o.Event != event || next.Counters[o.ID] >= o.Target {
+			continue
+		}
+		next.Counters[o.ID] += n
+		if next.Counters[o.ID] > o.Target {
+			next.Counters[o.ID] = o.Target
+		}
+		counted = true
+	}
+	if !counted {
+		return nil
+	}
+	if done(x, next) {
+		next.Status = StatusCompleted
+	}
+	return next
+}
+
+// done reports whether counters reach current targets, so retargeted
+// objectives are judged by the config in effect.
+func done(x *Quest, p *Progress) bool {
+	for _, o := range x.Objectives {
+		if p.Counters[o.ID] < o.Target {
+			return false
+		}
+	}
+	return true
+}
+
+func (q *Quests) unlocked(
+	ctx context.Context, accountID uint64, x *Quest, all map[string]*Progress) bool {
+	for _, id := range x.Requires {
+		if p := all[id]; p == nil || p.Status != StatusClaimed {
+			return false
+		}
+	}
+	if x.Rule == "" {
+		return true
+	}
+	if q.Rules == nil {
+		q.Logger.Error("quest " + strconv.Quote(x.ID) + " rule func missing")
+		return false
+	}
+	ok, err := q.Rules(ctx, accountID, x.Rule)
+	if err != nil {
+		q.Logger.Error(errors.Wrapf(err, "quest %q", x.ID).Error())
+		return false
+	}
+	return ok
+}
+
+func (q *Quests) emit(ctx context.Context, accountID uint64, typ string, p *Progress) {
+	e := &Event{Type: typ, QuestID: p.QuestID, Progress: p, At: q.now().Unix()}
+	for _, fn := range q.listeners {
+		fn(ctx, accountID, e)
+	}
+}
+
+// ObjectiveView is an objective with the player counter.
+type ObjectiveView struct {
+	ID     string `json:"id"`
+	Event  string `json:"event"`
+	Target int64  `json:"target"`
+	Count  int64  `json:"count"`
+}
+
+// QuestView is a quest of the player for the client UI.
+type QuestView struct {
+	ID         string           `json:"id"`
+	Status     string           `json:"status"`
+	Objectives []*ObjectiveView `json:"objectives"`
+	Reward     *Reward          `json:"reward,omitempty"`
+}
+
+// List returns quests of a player in config order.
+func (q *Quests) List(ctx context.Context, accountID uint64) ([]*QuestView, error) {
+	all, err := q.Store.List(accountID)
+	if err != nil {
+		return nil, err
+	}
+	a := make([]*QuestView, 0, len(q.Config.quests))
+	for _, x := range q.Config.quests {
+		p := all[x.ID]
+		v := &QuestView{ID: x.ID, Status: StatusActive, Reward: x.Reward}
+		switch {
+		case p != nil && p.Status == StatusClaimed:
+			v.Status = StatusClaimed
+		case p != nil && done(x, p):
+			v.Status = StatusCompleted
+		case p == nil && !q.unlocked(ctx, accountID, x, all):
+			v.Status = StatusLocked
+		}
+		for _, o := range x.Objectives {
+			y := &ObjectiveView{ID: o.ID, Event: o.Event, Target: o.Target}
+			if p != nil {
+				y.Count = p.Counters[o.ID]
+			}
+			v.Objectives = append(v.Objectives, y)
+		}
+		a = append(a, v)
+	}
+	return a, nil
+}
+
+// ClaimResult is the payload of a claim. A repeated claim is Replayed:
+// nothing is granted again.
+type ClaimResult struct {
+	Progress  *Progress             `json:"progress"`
+	Reward    *Reward               `json:"reward,omitempty"`
+	Wallet    *a5gwallet.Result     `json:"wallet,omitempty"`
+	Inventory *a5ginventory.Changes `json:"inventory,omitempty"`
+	Replayed  bool                  `json:"replayed,omitempty"`
+}
+
+// Claim grants the reward of a completed quest. A failed grant reverts
+// the claim so the player may retry: wallet transactions are idempotent
+// by the quest and inventory ones are atomic.
+func (q *Quests) Claim(
+	ctx context.Context, accountID uint64, questID string) (*ClaimResult, error) {
+	x, ok := q.Config.Quest(questID)
+	if !ok {
+		return nil, errors.Wrap(ErrQuestUnknown, questID)
+	}
+	prev, err := q.Store.Get(accountID, questID)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case prev != nil && prev.Status == StatusClaimed:
+		return &ClaimResult{Progress: prev, Replayed: true}, nil
+	case prev == nil || !done(x, prev):
+		return nil, errors.Wrap(ErrNotCompleted, questID)
+	}
+	next := prev.clone()
+	next.Status = StatusClaimed
+	next.Version++
+	ok, err = q.Store.Update(accountID, prev, next)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		// Claimed or progressed concurrently, answer from the stored state.
+		if prev, err = q.Store.Get(accountID, questID); err != nil {
+			return nil, err
+		}
+		if prev != nil && prev.Status == StatusClaimed {
+			return &ClaimResult{Progress: prev, Replayed: true}, nil
+		}
+		return nil, errors.Errorf("quest %q claim conflict", questID)
+	}
+	res, err := q.grant(accountID, x)
+	if err != nil {
+		revert := prev.clone()
+		revert.Version = next.Version + 1
+		if _, x := q.Store.Update(accountID, next, revert); x != nil {
+			q.Logger.Error(x.Error())
+		}
+		return nil, err
+	}
+	res.Progress = next
+	res.Reward = x.Reward
+	q.emit(ctx, accountID, EventClaimed, next)
+	return res, nil
+}
+
+func (q *Quests) grant(accountID uint64, x *Quest) (*ClaimResult, error) {
+	res := new(ClaimResult)
+	if x.Reward == nil {
+		return res, nil
+	}
+	ref := strconv.FormatUint(accountID, 10) + ":" + x.ID
+	if len(x.Reward.Currencies) > 0 {
+		if q.Wallet == nil {
+			return nil, errors.New("wallet missing")
+		}
+		t := a5gwallet.NewTx("quest:"+ref, Reason, Reason)
+		for c, n := range x.Reward.Currencies {
+			t.Credit(c, n)
+		}
+		y, err := q.Wallet.Apply(accountID, t)
+		if err != nil {
+			return nil, err
+		}
+		res.Wallet = y
+	}
+	if len(x.Reward.Items) > 0 {
+		if q.Inventory == nil {
+			return nil, errors.New("inventory missing")
+		}
+		t := a5ginventory.NewTx(Reason, ref).MailOverflow()
+		for id, n := range x.Reward.Items {
+			t.Grant(id, n)
+		}
+		y, err := q.Inventory.Apply(accountID, t)
+		if err != nil {
+			return nil, err
+		}
+		res.Inventory = y
+	}
+	return res, nil
+}
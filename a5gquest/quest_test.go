@@ -0,0 +1,140 @@
+package a5gquest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestQuests(t *testing.T) {
+	c, err := NewConfigJSON([]byte(`[
+		{"id": "hunter", "reward": {"currencies": {"soft": 50}},
+			"objectives": [{"id": "zombies", "event": "kill_zombie", "target": 5},
+				{"id": "bosses", "event": "kill_boss", "target": 1}]},
+		{"id": "collector", "requires": ["hunter"],
+			"reward": {"items": {"sword": 2}},
+			"objectives": [{"id": "zombies", "event": "kill_zombie", "target": 2}]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []string
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	q, err := NewQuests(c, NewMemoryStore(), l,
+		func(ctx context.Context, accountID uint64, e *Event) {
+			events = append(events, e.QuestID+":"+e.Type)
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	currencies, _ := a5gwallet.NewCurrencies(a5gwallet.Currency{ID: "soft"})
+	q.Wallet, _ = a5gwallet.NewWallet(a5gwallet.NewMemoryStore(), currencies, l)
+	items, _ := a5ginventory.NewCatalog(&a5ginventory.Config{
+		Items: []a5ginventory.Item{{ID: "sword", MaxStack: 1}}})
+	q.Inventory, _ = a5ginventory.NewInventory(
+		a5ginventory.NewMemoryStore(), items, l)
+
+	ctx := context.Background()
+	tests := []struct {
+		name     string
+		event    string
+		n        int64
+		claim    string
+		err      error
+		replayed bool
+		statuses string
+	}{
+		{"claim unknown", "", 0, "miner", ErrQuestUnknown, false,
+			"active locked"},
+		{"progress", "kill_zombie", 3, "hunter", ErrNotCompleted, false,
+			"active locked"},
+		{"capped", "kill_zombie", 9, "", nil, false, "active locked"},
+		{"completed", "kill_boss", 1, "hunter", nil, false, "claimed active"},
+		{"claim again", "", 0, "hunter", nil, true, "claimed active"},
+		{"unlocked", "kill_zombie", 4, "collector", a5ginventory.ErrCapExceeded,
+			false, "claimed completed"},
+	}
+	for _, test := range tests {
+		if test.event != "" {
+			if _, err := q.Report(ctx, 1, test.event, test.n); err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+		}
+		if test.claim != "" {
+			res, err := q.Claim(ctx, 1, test.claim)
+			if errors.Cause(err) != test.err {
+				t.Fatalf("%s: unexpected error %v", test.name, err)
+			}
+			if res != nil && res.Replayed != test.replayed {
+				t.Errorf("%s: expected replayed %v", test.name, test.replayed)
+			}
+		}
+		quests, err := q.List(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		statuses := quests[0].Status + " " + quests[1].Status
+		if statuses != test.statuses {
+			t.Errorf("%s: unexpected statuses %q", test.name, statuses)
+		}
+	}
+	quests, _ := q.List(ctx, 1)
+	if n := quests[0].Objectives[0].Count; n != 5 {
+		t.Errorf("expected a capped counter, got %d", n)
+	}
+	expected := "hunter:progressed hunter:progressed hunter:progressed " +
+		"hunter:completed hunter:claimed collector:progressed collector:completed"
+	var s string
+	for i, e := range events {
+		if i > 0 {
+			s += " "
+		}
+		s += e
+	}
+	if s != expected {
+		t.Errorf("unexpected events %q", s)
+	}
+}
+
+func TestQuestRule(t *testing.T) {
+	c, err := NewConfigJSON([]byte(`[{"id": "comeback", "rule": "lapsed",
+		"objectives": [{"id": "logins", "event": "login", "target": 3}]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewQuests(c, NewMemoryStore(), a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, test := range []struct {
+		rules  RuleFunc
+		status string
+	}{
+		{nil, StatusLocked},
+		{func(ctx context.Context, accountID uint64, rule string) (bool, error) {
+			return false, errors.New("facts unavailable")
+		}, StatusLocked},
+		{func(ctx context.Context, accountID uint64, rule string) (bool, error) {
+			return rule == "lapsed" && accountID == 1, nil
+		}, StatusActive},
+	} {
+		q.Rules = test.rules
+		changed, err := q.Report(ctx, 1, "login", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		quests, err := q.List(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if quests[0].Status != test.status ||
+			(len(changed) == 1) != (test.status == StatusActive) {
+			t.Errorf("unexpected status %q, %d changed", quests[0].Status, len(changed))
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package a5gquest
+
+import (
+	"database/sql"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryStore struct {
+	mu       sync.Mutex
+	progress map[uint64]map[string]*Progress
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{progress: make(map[uint64]map[string]*Progress)}
+}
+
+func (s *memoryStore) List(accountID uint64) (map[string]*Progress, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := make(map[string]*Progress, len(s.progress[accountID]))
+	for id, p := range s.progress[accountID] {
+		m[id] = p.clone()
+	}
+	return m, nil
+}
+
+func (s *memoryStore) Get(accountID uint64, questID string) (*Progress, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.progress[accountID][questID]
+	if !ok {
+		return nil, nil
+	}
+	return p.clone(), nil
+}
+
+func (s *memoryStore) Update(accountID uint64, prev, next *Progress) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.progress[accountID]
+	if !ok {
+		m = make(map[string]*Progress)
+		s.progress[accountID] = m
+	}
+	x, ok := m[next.QuestID]
+	if ok != (prev != nil) || ok && x.Version != prev.Version {
+		return false, nil
+	}
+	m[next.QuestID] = next.clone()
+	return true, nil
+}
+
+// dbStore keeps quest progress in a MySQL table, a row per started quest:
+//
+//	CREATE TABLE quest_progress (
+//	  account_id BIGINT UNSIGNED NOT NULL,
+//	  quest_id VARCHAR(64) NOT NULL,
+//	  status VARCHAR(16) NOT NULL,
+//	  counters TEXT NOT NULL,
+//	  version BIGINT NOT NULL,
+//	  updated_at DATETIME NOT NULL,
+//	  PRIMARY KEY (account_id, quest_id));
+//
+// Counters are a JSON object keyed by objective ID, so config changes need
+// no schema migration; rows of removed quests are ignored.
+type dbStore struct {
+	pooler    a5gdb.Pooler
+	tableName string
+}
+
+type dbProgress struct {
+	QuestID  string `db:"quest_id"`
+	Status   string `db:"status"`
+	Counters string `db:"counters"`
+	Version  int64  `db:"version"`
+}
+
+func (x *dbProgress) progress() (*Progress, error) {
+	p := &Progress{QuestID: x.QuestID, Status: x.Status, Version: x.Version}
+	if err := json.Unmarshal([]byte(x.Counters), &p.Counters); err != nil {
+		return nil, errors.Wrapf(err, "quest %q counters", x.QuestID)
+	}
+	if p.Counters == nil {
+		p.Counters = make(map[string]int64)
+	}
+	return p, nil
+}
+
+func NewDBStore(p a5gdb.Pooler, tableName string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if tableName == "" {
+		return nil, errors.New("empty quest progress table name")
+	}
+	return &dbStore{pooler: p, tableName: tableName}, nil
+}
+
+func (s *dbStore) List(accountID uint64) (map[string]*Progress, error) {
+	var rows []*dbProgress
+	_, err := s.pooler.ReadPool().NewSession().
+		Select("quest_id", "status", "counters", "version").From(s.tableName).
+		Where(dbr.Eq("account_id", accountID)).Load(&rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	m := make(map[string]*Progress, len(rows))
+	for _, x := range rows {
+		p, err := x.progress()
+		if err != nil {
+			return nil, err
+		}
+		m[p.QuestID] = p
+	}
+	return m, nil
+}
+
+func (s *dbStore) Get(accountID uint64, questID string) (*Progress, error) {
+	x := new(dbProgress)
+	err := s.pooler.ReadPool().NewSession().
+		Select("quest_id", "status", "counters", "version").From(s.tableName).
+		Where(dbr.Eq("account_id", accountID)).
+		Where(dbr.Eq("quest_id", questID)).LoadOne(x)
+	if err == dbr.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	return x.progress()
+}
+
+func (s *dbStore) Update(accountID uint64, prev, next *Progress) (bool, error) {
+	b, err := json.Marshal(next.Counters)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	sess := s.pooler.WritePool().NewSession()
+	var res sql.Result
+	if prev == nil {
+		res, err = sess.InsertBySql("INSERT IGNORE INTO "+s.tableName+
+			" (account_id, quest_id, status, counters, version, updated_at)"+
+			" VALUES (?, ?, ?, ?, ?, ?)",
+			accountID, next.QuestID, next.Status, string(b), next.Version,
+			time.Now().UTC()).Exec()
+	} else {
+		res, err = sess.Update(s.tableName).
+			Set("status", next.Status).
+			Set("counters", string(b)).
+			Set("version", next.Version).
+			Set("updated_at", time.Now().UTC()).
+			Where(dbr.Eq("account_id", accountID)).
+			Where(dbr.Eq("quest_id", next.QuestID)).
+			Where(dbr.Eq("version", prev.Version)).Exec()
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	return n == 1, nil
+}
@@ -0,0 +1,218 @@
+package a5graid
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCodeNotJoined = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4037,
+		Name:     "raid_not_joined",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "raid not joined"})
+
+	ErrCodeRaidUnknown = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4061,
+		Name:     "raid_unknown",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "raid not found"})
+
+	ErrCodeRaidOver = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4252,
+		Name:     "raid_over",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "raid over"})
+
+	ErrCodeRaidActive = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4253,
+		Name:     "raid_active",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "raid still active"})
+
+	ErrCodeDamageInvalid = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4254,
+		Name:     "raid_damage_invalid",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "raid damage out of bounds"})
+
+	ErrCodeNoReward = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4255,
+		Name:     "raid_no_reward",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "no raid reward"})
+
+	ErrCodeRewardClaimed = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4256,
+		Name:     "raid_reward_claimed",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "raid reward already claimed"})
+)
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeNotJoined, http.StatusForbidden)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeRaidUnknown, http.StatusNotFound)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeRaidOver, http.StatusConflict)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeRaidActive, http.StatusConflict)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeDamageInvalid, http.StatusUnprocessableEntity)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeNoReward, http.StatusUnprocessableEntity)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeRewardClaimed, http.StatusConflict)
+}
+
+type RaidRequest struct {
+	ID string `json:"id" validate:"required"`
+}
+
+type AttackRequest struct {
+	ID     string `json:"id" validate:"required"`
+	Damage int64  `json:"damage" validate:"min=1"`
+}
+
+type RankingRequest struct {
+	ID    string `json:"id" validate:"required"`
+	Limit int    `json:"limit" validate:"min=1,max=100"`
+}
+
+// RankingResponse carries the top contributors and the session player.
+type RankingResponse struct {
+	Raid    *Raid           `json:"raid"`
+	Ranking []*Contribution `json:"ranking"`
+	Own     *Contribution   `json:"own,omitempty"`
+}
+
+// CreateHandler schedules a raid, mount it on an admin route class.
+func (rs *Raids) CreateHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(Raid) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			r, err := rs.Create(req.Payload.(*Raid))
+			if err != nil {
+				return nil, rs.apiErrs(err)
+			}
+			return r, nil
+		})
+}
+
+// JoinHandler spends a raid ticket of the session player.
+func (rs *Raids) JoinHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(RaidRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			r, err := rs.Join(req.Payload.(*RaidRequest).ID, s.AccountID)
+			if err != nil {
+				return nil, rs.apiErrs(err)
+			}
+			return r, nil
+		})
+}
+
+// AttackHandler deals damage of the session player to a raid boss.
+func (rs *Raids) AttackHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(AttackRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			r := req.Payload.(*AttackRequest)
+			h, err := rs.Attack(r.ID, s.AccountID, r.Damage)
+			if err != nil {
+				return nil, rs.apiErrs(err)
+			}
+			return h, nil
+		})
+}
+
+// RankingHandler answers with the damage ranking of a raid.
+func (rs *Raids) RankingHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(RankingRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			r := req.Payload.(*RankingRequest)
+			raid, err := rs.Get(r.ID)
+			if err != nil {
+				return nil, rs.apiErrs(err)
+			}
+			res := &RankingResponse{Raid: raid}
+			if res.Ranking, err = rs.Store.Ranking(raid.ID, r.Limit); err != nil {
+				return nil, rs.apiErrs(err)
+			}
+			if res.Own, err = rs.Store.Contribution(raid.ID, s.AccountID); err != nil {
+				return nil, rs.apiErrs(err)
+			}
+			return res, nil
+		})
+}
+
+// ClaimHandler pays the raid reward of the session player.
+func (rs *Raids) ClaimHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(RaidRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			c, err := rs.Claim(req.Payload.(*RaidRequest).ID, s.AccountID)
+			if err != nil {
+				return nil, rs.apiErrs(err)
+			}
+			return c, nil
+		})
+}
+
+func (rs *Raids) apiErrs(err error) []*a5gapi.APIErr {
+	switch errors.Cause(err) {
+	case ErrNotJoined:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeNotJoined, "")}
+	case ErrRaidUnknown:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeRaidUnknown, "")}
+	case ErrRaidOver:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeRaidOver, "")}
+	case ErrRaidActive:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeRaidActive, "")}
+	case ErrDamageInvalid:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeDamageInvalid, "%s", err)}
+	case ErrNoReward:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeNoReward, "%s", err)}
+	case ErrRewardClaimed:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeRewardClaimed, "")}
+	case a5gwallet.ErrInsufficientFunds:
+		return rs.Wallet.APIErrs(err)
+	case a5ginventory.ErrItemUnknown:
+		return rs.Inventory.APIErrs(err)
+	}
+	rs.Logger.Error(err.Error())
+	return a5gapi.NewJSONMsgDefautlErrors(err)
+}
@@ -0,0 +1,309 @@
+package a5graid
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrRaidUnknown   = errors.New("raid unknown")
+	ErrRaidExists    = errors.New("raid exists")
+	ErrRaidOver      = errors.New("raid over")
+	ErrRaidActive    = errors.New("raid still active")
+	ErrNotJoined     = errors.New("raid not joined")
+	ErrDamageInvalid = errors.New("raid damage invalid")
+	ErrNoReward      = errors.New("no raid reward")
+	ErrRewardClaimed = errors.New("raid reward claimed")
+)
+
+type Reward struct {
+	ItemID   string `json:"itemId"`
+	Quantity int64  `json:"quantity"`
+}
+
+// Tier rewards players who dealt at least MinPercent of the boss HP.
+type Tier struct {
+	MinPercent int64    `json:"minPercent"`
+	Rewards    []Reward `json:"rewards"`
+}
+
+// Raid is a boss of MaxHP shared by every player who joined it between
+// StartAt and EndAt, unix seconds. HP is what is left of it.
+type Raid struct {
+	ID      string `json:"id"`
+	BossID  string `json:"bossId"`
+	MaxHP   int64  `json:"maxHp"`
+	HP      int64  `json:"hp"`
+	StartAt int64  `json:"startAt"`
+	EndAt   int64  `json:"endAt"`
+	Tiers   []Tier `json:"tiers"`
+}
+
+func (r *Raid) clone() *Raid {
+	x := *r
+	return &x
+}
+
+func (r *Raid) validate() error {
+	if r.ID == "" || r.BossID == "" {
+		return errors.New("empty raid or boss id")
+	}
+	// Damage is at most MaxHP, percents of it must not overflow.
+	if r.MaxHP <= 0 || r.MaxHP > math.MaxInt64/100 || r.StartAt >= r.EndAt {
+		return errors.Errorf("raid %q: no HP or time window", r.ID)
+	}
+	for _, t := range r.Tiers {
+		if t.MinPercent <= 0 || t.MinPercent > 100 || len(t.Rewards) == 0 {
+			return errors.Errorf("raid %q: unexpected reward tier", r.ID)
+		}
+		for _, x := range t.Rewards {
+			if x.ItemID == "" || x.Quantity <= 0 {
+				return errors.Errorf("raid %q: unexpected tier reward", r.ID)
+			}
+		}
+	}
+	return nil
+}
+
+// Running reports whether the raid takes hits at now.
+func (r *Raid) Running(now int64) bool {
+	return r.HP > 0 && now >= r.StartAt && now < r.EndAt
+}
+
+// Tier is the best tier reached by damage, nil if none.
+func (r *Raid) Tier(damage int64) *Tier {
+	var best *Tier
+	for i, t := range r.Tiers {
+		if damage*100 < r.MaxHP*t.MinPercent {
+			continue
+		}
+		if best == nil || t.MinPercent > best.MinPercent {
+			best = &r.Tiers[i]
+		}
+	}
+	return best
+}
+
+// Contribution is the damage of a player to a raid boss, Rank is 1 for
+// the top contributor.
+type Contribution struct {
+	AccountID uint64 `json:"accountId"`
+	Damage    int64  `json:"damage"`
+	Rank      int64  `json:"rank"`
+}
+
+// rank sorts contributions by damage, ties by account, and numbers them.
+func rank(a []*Contribution) {
+	sort.Slice(a, func(i, j int) bool {
+		if a[i].Damage != a[j].Damage {
+			return a[i].Damage > a[j].Damage
+		}
+		return a[i].AccountID < a[j].AccountID
+	})
+	for i, c := range a {
+		c.Rank = int64(i + 1)
+	}
+}
+
+// Store keeps raids and contributions. Hit takes up to damage from the
+// HP of the raid atomically, so concurrent hits never take more than is
+// left, and adds what it took to the contribution of a joined player; it
+// returns the damage taken and the HP left. Claim marks the reward of a
+// player as paid once, Release undoes it.
+type Store interface {
+	Create(r *Raid) (bool, error)
+	Get(id string) (*Raid, error)
+	Join(raidID string, accountID uint64) error
+	Hit(raidID string, accountID uint64, damage int64) (int64, int64, error)
+	Ranking(raidID string, limit int) ([]*Contribution, error)
+	Contribution(raidID string, accountID uint64) (*Contribution, error)
+	Claim(raidID string, accountID uint64) (bool, error)
+	Release(raidID string, accountID uint64) error
+}
+
+// Hit is the outcome of an attack, Defeated is set for the hit which
+// took the last HP.
+type Hit struct {
+	Damage   int64 `json:"damage"`
+	HP       int64 `json:"hp"`
+	Defeated bool  `json:"defeated,omitempty"`
+}
+
+// Raids runs cooperative boss raids. Joining costs a TicketCurrency
+// ticket, attacks deal up to MaxDamage each, and players of defeated
+// bosses claim the rewards of their Tier by contribution.
+type Raids struct {
+	Store          Store
+	Wallet         *a5gwallet.Wallet
+	Inventory      *a5ginventory.Inventory
+	Logger         a5glogs.Logger
+	TicketCurrency string
+	MaxDamage      int64
+
+	now func() time.Time
+}
+
+func NewRaids(s Store, w *a5gwallet.Wallet, inv *a5ginventory.Inventory,
+	l a5glogs.Logger) (*Raids, error) {
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if w == nil || inv == nil {
+		return nil, errors.New("wallet or inventory missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Raids{
+		Store:          s,
+		Wallet:         w,
+		Inventory:      inv,
+		Logger:         l,
+		TicketCurrency: "raid_ticket",
+		MaxDamage:      1000000,
+		now:            time.Now}, nil
+}
+
+func ref(raidID string, accountID uint64, step string) string {
+	return "raid:" + raidID + ":" + strconv.FormatUint(accountID, 10) + ":" + step
+}
+
+// Create schedules a raid at full HP.
+func (rs *Raids) Create(r *Raid) (*Raid, error) {
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+	x := r.clone()
+	x.HP = x.MaxHP
+	ok, err := rs.Store.Create(x)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.Wrap(ErrRaidExists, x.ID)
+	}
+	return x, nil
+}
+
+func (rs *Raids) Get(id string) (*Raid, error) {
+	r, err := rs.Store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return nil, errors.Wrap(ErrRaidUnknown, id)
+	}
+	return r, nil
+}
+
+// Join spends a ticket of the player on a running raid. The ticket is
+// debited under an ID of the raid and player, so joining again is free.
+func (rs *Raids) Join(raidID string, accountID uint64) (*Raid, error) {
+	r, err := rs.Get(raidID)
+	if err != nil {
+		return nil, err
+	}
+	if !r.Running(rs.now().Unix()) {
+		return nil, ErrRaidOver
+	}
+	_, err = rs.Wallet.Debit(accountID, ref(r.ID, accountID, "ticket"),
+		"raid:"+r.ID, "raid_ticket", rs.TicketCurrency, 1)
+	if err != nil {
+		return nil, err
+	}
+	if err = rs.Store.Join(r.ID, accountID); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Attack deals damage of a joined player to the boss of a raid.
+func (rs *Raids) Attack(raidID string, accountID uint64, damage int64) (*Hit, error) {
+	if damage <= 0 || damage > rs.MaxDamage {
+		return nil, errors.Wrapf(ErrDamageInvalid, "%d", damage)
+	}
+	r, err := rs.Get(raidID)
+	if err != nil {
+		return nil, err
+	}
+	if !r.Running(rs.now().Unix()) {
+		return nil, ErrRaidOver
+	}
+	taken, hp, err := rs.Store.Hit(r.ID, accountID, damage)
+	if err != nil {
+		return nil, err
+	}
+	if taken == 0 {
+		return nil, ErrRaidOver
+	}
+	return &Hit{Damage: taken, HP: hp, Defeated: hp == 0}, nil
+}
+
+func (rs *Raids) Ranking(raidID string, limit int) ([]*Contribution, error) {
+	if _, err := rs.Get(raidID); err != nil {
+		return nil, err
+	}
+	return rs.Store.Ranking(raidID, limit)
+}
+
+// Claimed is a paid raid reward.
+type Claimed struct {
+	Contribution *Contribution         `json:"contribution"`
+	Tier         *Tier                 `json:"tier"`
+	Changes      *a5ginventory.Changes `json:"changes"`
+}
+
+// Claim pays the reward tier of a player once the boss is defeated.
+func (rs *Raids) Claim(raidID string, accountID uint64) (*Claimed, error) {
+	r, err := rs.Get(raidID)
+	if err != nil {
+		return nil, err
+	}
+	if r.Running(rs.now().Unix()) {
+		return nil, ErrRaidActive
+	}
+	if r.HP > 0 {
+		return nil, errors.Wrap(ErrNoReward, "boss survived")
+	}
+	c, err := rs.Store.Contribution(r.ID, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, ErrNotJoined
+	}
+	t := r.Tier(c.Damage)
+	if t == nil {
+		return nil, errors.Wrap(ErrNoReward, "no tier reached")
+	}
+	ok, err := rs.Store.Claim(r.ID, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrRewardClaimed
+	}
+	tx := a5ginventory.NewTx("raid_reward", ref(r.ID, accountID, "reward"))
+	for _, x := range t.Rewards {
+		tx.Grant(x.ItemID, x.Quantity)
+	}
+	changes, err := rs.Inventory.Apply(accountID, tx.MailOverflow())
+	if errors.Cause(err) == a5ginventory.ErrOverflowUndelivered {
+		// The rewards are stored, releasing the claim would grant twice.
+		return nil, err
+	}
+	if err != nil {
+		if e := rs.Store.Release(r.ID, accountID); e != nil {
+			rs.Logger.Error(errors.Wrap(e, "raid reward claim not released").Error())
+		}
+		return nil, err
+	}
+	return &Claimed{Contribution: c, Tier: t, Changes: changes}, nil
+}
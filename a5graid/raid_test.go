@@ -0,0 +1,133 @@
+package a5graid
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestRaids(t *testing.T) {
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	c, _ := a5gwallet.NewCurrencies(a5gwallet.Currency{ID: "raid_ticket"})
+	w, _ := a5gwallet.NewWallet(a5gwallet.NewMemoryStore(), c, l)
+	catalog, _ := a5ginventory.NewCatalogJSON(
+		[]byte(`{"items": [{"id": "chest"}, {"id": "crown"}]}`))
+	inv, _ := a5ginventory.NewInventory(a5ginventory.NewMemoryStore(), catalog, l)
+	rs, err := NewRaids(NewMemoryStore(), w, inv, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.MaxDamage = 100
+	now := time.Unix(1600000000, 0)
+	rs.now = func() time.Time { return now }
+	for id := uint64(1); id <= 20; id++ {
+		if _, err = w.Credit(id, fmt.Sprint("seed", id), "test", "seed", "raid_ticket", 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err = rs.Create(&Raid{ID: "r1", BossID: "dragon", MaxHP: 2000,
+		StartAt: now.Unix(), EndAt: now.Add(time.Hour).Unix(), Tiers: []Tier{
+			{MinPercent: 1, Rewards: []Reward{{ItemID: "chest", Quantity: 1}}},
+			{MinPercent: 10, Rewards: []Reward{{ItemID: "crown", Quantity: 1}}}}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = rs.Attack("r1", 1, 50); errors.Cause(err) != ErrNotJoined {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err = rs.Attack("r1", 1, 101); errors.Cause(err) != ErrDamageInvalid {
+		t.Errorf("unexpected error %v", err)
+	}
+	for id := uint64(1); id <= 20; id++ {
+		if _, err = rs.Join("r1", id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Joining again replays the ticket debit.
+	if _, err = rs.Join("r1", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = rs.Join("r1", 21); errors.Cause(err) != a5gwallet.ErrInsufficientFunds {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// Concurrent hits of players add up.
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var taken, defeated int64
+	for id := uint64(1); id <= 20; id++ {
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func(id uint64) {
+				defer wg.Done()
+				h, err := rs.Attack("r1", id, int64(id))
+				if err != nil {
+					return
+				}
+				mu.Lock()
+				taken += h.Damage
+				if h.Defeated {
+					defeated++
+				}
+				mu.Unlock()
+			}(id)
+		}
+	}
+	wg.Wait()
+	if r, _ := rs.Get("r1"); r.HP != 950 || taken != 1050 || defeated != 0 {
+		t.Fatalf("unexpected raid %+v after %d damage", r, taken)
+	}
+	if _, err = rs.Claim("r1", 20); errors.Cause(err) != ErrRaidActive {
+		t.Errorf("unexpected error %v", err)
+	}
+	// The last hit takes what is left.
+	h := new(Hit)
+	for i := 0; i < 9; i++ {
+		if h, err = rs.Attack("r1", 20, 100); err != nil || h.Defeated {
+			t.Fatalf("unexpected hit %+v %v", h, err)
+		}
+	}
+	if h, err = rs.Attack("r1", 20, 100); err != nil || h.Damage != 50 || !h.Defeated {
+		t.Fatalf("unexpected hit %+v %v", h, err)
+	}
+	if _, err = rs.Attack("r1", 20, 1); errors.Cause(err) != ErrRaidOver {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	ranking, err := rs.Ranking("r1", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ranking) != 3 || *ranking[0] != (Contribution{20, 1050, 1}) ||
+		*ranking[2] != (Contribution{18, 90, 3}) {
+		t.Errorf("unexpected ranking %v %v %v", ranking[0], ranking[1], ranking[2])
+	}
+	own, _ := rs.Store.Contribution("r1", 1)
+	if own.Rank != 20 || own.Damage != 5 {
+		t.Errorf("unexpected contribution %+v", own)
+	}
+
+	claimed, err := rs.Claim("r1", 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claimed.Tier.MinPercent != 10 || claimed.Changes.Changes[0].ItemID != "crown" {
+		t.Errorf("unexpected claim %+v %+v", claimed.Tier, claimed.Changes.Changes[0])
+	}
+	if _, err = rs.Claim("r1", 20); errors.Cause(err) != ErrRewardClaimed {
+		t.Errorf("unexpected error %v", err)
+	}
+	if claimed, err = rs.Claim("r1", 10); err != nil || claimed.Tier.MinPercent != 1 {
+		t.Errorf("unexpected claim %+v %v", claimed, err)
+	}
+	if _, err = rs.Claim("r1", 1); errors.Cause(err) != ErrNoReward {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,364 @@
+package a5graid
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryRaid struct {
+	raid     *Raid
+	damage   map[uint64]int64
+	rewarded map[uint64]bool
+}
+
+type memoryStore struct {
+	mu    sync.Mutex
+	raids map[string]*memoryRaid
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{raids: make(map[string]*memoryRaid)}
+}
+
+func (s *memoryStore) Create(r *Raid) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.raids[r.ID]; ok {
+		return false, nil
+	}
+	s.raids[r.ID] = &memoryRaid{
+		raid:     r.clone(),
+		damage:   make(map[uint64]int64),
+		rewarded: make(map[uint64]bool)}
+	return true, nil
+}
+
+func (s *memoryStore) Get(id string) (*Raid, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.raids[id]
+	if !ok {
+		return nil, nil
+	}
+	return m.raid.clone(), nil
+}
+
+func (s *memoryStore) get(id string) (*memoryRaid, error) {
+	m, ok := s.raids[id]
+	if !ok {
+		return nil, errors.Wrap(ErrRaidUnknown, id)
+	}
+	return m, nil
+}
+
+func (s *memoryStore) Join(raidID string, accountID uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, err := s.get(raidID)
+	if err != nil {
+		return err
+	}
+	if _, ok := m.damage[accountID]; !ok {
+		m.damage[accountID] = 0
+	}
+	return nil
+}
+
+func (s *memoryStore) Hit(
+	raidID string, accountID uint64, damage int64) (int64, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, err := s.get(raidID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, ok := m.damage[accountID]; !ok {
+		return 0, 0, ErrNotJoined
+	}
+	if damage > m.raid.HP {
+		damage = m.raid.HP
+	}
+	m.raid.HP -= damage
+	m.damage[accountID] += damage
+	return damage, m.raid.HP, nil
+}
+
+func (s *memoryStore) contributions(m *memoryRaid) []*Contribution {
+	a := make([]*Contribution, 0, len(m.damage))
+	for id, n := range m.damage {
+		a = append(a, &Contribution{AccountID: id, Damage: n})
+	}
+	rank(a)
+	return a
+}
+
+func (s *memoryStore) Ranking(raidID string, limit int) ([]*Contribution, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, err := s.get(raidID)
+	if err != nil {
+		return nil, err
+	}
+	a := s.contributions(m)
+	if len(a) > limit {
+		a = a[:limit]
+	}
+	return a, nil
+}
+
+func (s *memoryStore) Contribution(
+	raidID string, accountID uint64) (*Contribution, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, err := s.get(raidID)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range s.contributions(m) {
+		if c.AccountID == accountID {
+			return c, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *memoryStore) Claim(raidID string, accountID uint64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, err := s.get(raidID)
+	if err != nil {
+		return false, err
+	}
+	if m.rewarded[accountID] {
+		return false, nil
+	}
+	m.rewarded[accountID] = true
+	return true, nil
+}
+
+func (s *memoryStore) Release(raidID string, accountID uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, err := s.get(raidID)
+	if err != nil {
+		return err
+	}
+	delete(m.rewarded, accountID)
+	return nil
+}
+
+// dbStore keeps raids and contributions in MySQL tables; hits lock the
+// raid row, so they queue on it rather than overdraw the HP:
+//
+//	CREATE TABLE raids (
+//	  id VARCHAR(64) NOT NULL PRIMARY KEY,
+//	  hp BIGINT NOT NULL,
+//	  data TEXT NOT NULL,
+//	  created_at DATETIME NOT NULL);
+//
+//	CREATE TABLE raid_contributions (
+//	  raid_id VARCHAR(64) NOT NULL,
+//	  account_id BIGINT UNSIGNED NOT NULL,
+//	  damage BIGINT NOT NULL,
+//	  rewarded TINYINT(1) NOT NULL,
+//	  updated_at DATETIME NOT NULL,
+//	  PRIMARY KEY (raid_id, account_id),
+//	  KEY ranking (raid_id, damage));
+type dbStore struct {
+	pooler             a5gdb.Pooler
+	raidsTable         string
+	contributionsTable string
+}
+
+type dbRaid struct {
+	HP   int64  `db:"hp"`
+	Data string `db:"data"`
+}
+
+type dbContribution struct {
+	AccountID uint64 `db:"account_id"`
+	Damage    int64  `db:"damage"`
+}
+
+func NewDBStore(p a5gdb.Pooler, raidsTable, contributionsTable string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if raidsTable == "" || contributionsTable == "" {
+		return nil, errors.New("empty raid table name")
+	}
+	return &dbStore{
+		pooler:             p,
+		raidsTable:         raidsTable,
+		contributionsTable: contributionsTable}, nil
+}
+
+func (s *dbStore) Create(r *Raid) (bool, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	res, err := s.pooler.WritePool().NewSession().InsertBySql(
+		"INSERT IGNORE INTO "+s.raidsTable+" (id, hp, data, created_at)"+
+			" VALUES (?, ?, ?, ?)", r.ID, r.HP, string(b), time.Now().UTC()).Exec()
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	return n == 1, nil
+}
+
+func (s *dbStore) Get(id string) (*Raid, error) {
+	x := new(dbRaid)
+	err := s.pooler.WritePool().NewSession().Select("hp", "data").
+		From(s.raidsTable).Where(dbr.Eq("id", id)).LoadOne(x)
+	if err == dbr.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	r := new(Raid)
+	if err = json.Unmarshal([]byte(x.Data), r); err != nil {
+		return nil, errors.Wrap(err, "raid data")
+	}
+	r.HP = x.HP
+	return r, nil
+}
+
+func (s *dbStore) Join(raidID string, accountID uint64) error {
+	_, err := s.pooler.WritePool().NewSession().InsertBySql(
+		"INSERT IGNORE INTO "+s.contributionsTable+
+			" (raid_id, account_id, damage, rewarded, updated_at)"+
+			" VALUES (?, ?, 0, 0, ?)", raidID, accountID, time.Now().UTC()).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	return nil
+}
+
+func (s *dbStore) Hit(
+	raidID string, accountID uint64, damage int64) (int64, int64, error) {
+	tx, err := s.pooler.WritePool().NewSession().Begin()
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "dbr.(*Session).Begin fn")
+	}
+	defer tx.RollbackUnlessCommitted()
+	var hp []int64
+	_, err = tx.Select("hp").From(s.raidsTable).Where(dbr.Eq("id", raidID)).
+		Suffix("FOR UPDATE").Load(&hp)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	if len(hp) == 0 {
+		return 0, 0, errors.Wrap(ErrRaidUnknown, raidID)
+	}
+	if damage > hp[0] {
+		damage = hp[0]
+	}
+	if damage == 0 {
+		return 0, 0, nil
+	}
+	res, err := tx.UpdateBySql("UPDATE "+s.contributionsTable+
+		" SET damage = damage + ?, updated_at = ?"+
+		" WHERE raid_id = ? AND account_id = ?",
+		damage, time.Now().UTC(), raidID, accountID).Exec()
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "dbr.(*UpdateStmt).Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	if n == 0 {
+		return 0, 0, ErrNotJoined
+	}
+	_, err = tx.Update(s.raidsTable).Set("hp", hp[0]-damage).
+		Where(dbr.Eq("id", raidID)).Exec()
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "dbr.(*UpdateStmt).Exec fn")
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, 0, errors.Wrap(err, "dbr.(*Tx).Commit fn")
+	}
+	return damage, hp[0] - damage, nil
+}
+
+func (s *dbStore) Ranking(raidID string, limit int) ([]*Contribution, error) {
+	var rows []*dbContribution
+	_, err := s.pooler.ReadPool().NewSession().
+		Select("account_id", "damage").From(s.contributionsTable).
+		Where(dbr.Eq("raid_id", raidID)).
+		OrderDesc("damage").OrderAsc("account_id").
+		Limit(uint64(limit)).Load(&rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	a := make([]*Contribution, 0, len(rows))
+	for i, r := range rows {
+		a = append(a, &Contribution{
+			AccountID: r.AccountID, Damage: r.Damage, Rank: int64(i + 1)})
+	}
+	return a, nil
+}
+
+func (s *dbStore) Contribution(
+	raidID string, accountID uint64) (*Contribution, error) {
+	sess := s.pooler.ReadPool().NewSession()
+	var damage []int64
+	_, err := sess.Select("damage").From(s.contributionsTable).
+		Where(dbr.Eq("raid_id", raidID)).
+		Where(dbr.Eq("account_id", accountID)).Load(&damage)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	if len(damage) == 0 {
+		return nil, nil
+	}
+	c := &Contribution{AccountID: accountID, Damage: damage[0]}
+	err = sess.Select("COUNT(*)").From(s.contributionsTable).
+		Where(dbr.Eq("raid_id", raidID)).
+		Where(dbr.Or(dbr.Gt("damage", c.Damage), dbr.And(
+			dbr.Eq("damage", c.Damage), dbr.Lt("account_id", accountID)))).
+		LoadOne(&c.Rank)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	c.Rank++
+	return c, nil
+}
+
+func (s *dbStore) setRewarded(
+	raidID string, accountID uint64, from, to bool) (bool, error) {
+	res, err := s.pooler.WritePool().NewSession().Update(s.contributionsTable).
+		Set("rewarded", to).
+		Set("updated_at", time.Now().UTC()).
+		Where(dbr.Eq("raid_id", raidID)).
+		Where(dbr.Eq("account_id", accountID)).
+		Where(dbr.Eq("rewarded", from)).Exec()
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.(*UpdateStmt).Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	return n == 1, nil
+}
+
+func (s *dbStore) Claim(raidID string, accountID uint64) (bool, error) {
+	return s.setRewarded(raidID, accountID, false, true)
+}
+
+func (s *dbStore) Release(raidID string, accountID uint64) error {
+	_, err := s.setRewarded(raidID, accountID, true, false)
+	return err
+}
@@ -0,0 +1,206 @@
+package a5gratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Limit allows Requests per Window. Token buckets refill at that rate and
+// hold up to Burst tokens (Requests when zero).
+type Limit struct {
+	Requests int
+	Window   time.Duration
+	Burst    int
+}
+
+func (l Limit) validate() error {
+	if l.Requests < 1 || l.Window <= 0 || l.Burst < 0 {
+		return errors.Errorf("invalid rate limit %+v", l)
+	}
+	return nil
+}
+
+func (l Limit) capacity() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Requests
+}
+
+// ratePerNano is a token bucket refill rate.
+func (l Limit) ratePerNano() float64 {
+	return float64(l.Requests) / float64(l.Window)
+}
+
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+// Limiter takes one request of key's budget.
+type Limiter interface {
+	Allow(key string) (*Result, error)
+}
+
+func tokenBucketResult(l Limit, tokens float64, allowed bool) *Result {
+	res := &Result{
+		Allowed:   allowed,
+		Limit:     l.capacity(),
+		Remaining: int(math.Floor(tokens))}
+	if !allowed {
+		res.RetryAfter = time.Duration(math.Ceil((1 - tokens) / l.ratePerNano()))
+	}
+	return res
+}
+
+// slidingWindowResult approximates a sliding window by weighting the
+// previous fixed window count by its share still inside the window; curr
+// already includes the request when allowed.
+func slidingWindowResult(
+	l Limit, now time.Time, curr, prev int64, allowed bool) *Result {
+	into := time.Duration(now.UnixNano() % int64(l.Window))
+	f := float64(into) / float64(l.Window)
+	count := float64(prev)*(1-f) + float64(curr)
+	res := &Result{Allowed: allowed, Limit: l.Requests}
+	if x := float64(l.Requests) - count; x > 0 {
+		res.Remaining = int(math.Floor(x))
+	}
+	if allowed {
+		return res
+	}
+	free := int64(l.Requests) - curr - 1
+	if free < 0 || prev == 0 {
+		res.RetryAfter = l.Window - into
+		return res
+	}
+	need := 1 - float64(free)/float64(prev)
+	res.RetryAfter = time.Duration(math.Ceil((need - f) * float64(l.Window)))
+	if res.RetryAfter <= 0 {
+		res.RetryAfter = time.Millisecond
+	}
+	return res
+}
+
+func slidingWindowAllowed(
+	l Limit, now time.Time, curr, prev int64) bool {
+	f := float64(now.UnixNano()%int64(l.Window)) / float64(l.Window)
+	return float64(prev)*(1-f)+float64(curr)+1 <= float64(l.Requests)
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type memoryTokenBucket struct {
+	limit Limit
+	now   func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	calls   int
+}
+
+// NewMemoryTokenBucket is a single-process token bucket limiter.
+func NewMemoryTokenBucket(l Limit) (Limiter, error) {
+	if err := l.validate(); err != nil {
+		return nil, err
+	}
+	return &memoryTokenBucket{
+		limit:   l,
+		now:     time.Now,
+		buckets: make(map[string]*bucket)}, nil
+}
+
+func (m *memoryTokenBucket) Allow(key string) (*Result, error) {
+	now := m.now()
+	capacity := float64(m.limit.capacity())
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	if m.calls%1024 == 0 {
+		// Buckets idle for the full refill time are equal to new ones.
+		full := time.Duration(capacity / m.limit.ratePerNano())
+		for k, b := range m.buckets {
+			if now.Sub(b.last) > full {
+				delete(m.buckets, k)
+			}
+		}
+	}
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		m.buckets[key] = b
+	}
+	if d := now.Sub(b.last); d > 0 {
+		b.tokens = math.Min(capacity,
+			b.tokens+float64(d)*m.limit.ratePerNano())
+		b.last = now
+	}
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	return tokenBucketResult(m.limit, b.tokens, allowed), nil
+}
+
+type window struct {
+	index      int64
+	curr, prev int64
+}
+
+type memorySlidingWindow struct {
+	limit Limit
+	now   func() time.Time
+
+	mu      sync.Mutex
+	windows map[string]*window
+	calls   int
+}
+
+// NewMemorySlidingWindow is a single-process sliding window limiter.
+func NewMemorySlidingWindow(l Limit) (Limiter, error) {
+	if err := l.validate(); err != nil {
+		return nil, err
+	}
+	return &memorySlidingWindow{
+		limit:   l,
+		now:     time.Now,
+		windows: make(map[string]*window)}, nil
+}
+
+func (m *memorySlidingWindow) Allow(key string) (*Result, error) {
+	now := m.now()
+	i := now.UnixNano() / int64(m.limit.Window)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	if m.calls%1024 == 0 {
+		for k, w := range m.windows {
+			if w.index < i-1 {
+				delete(m.windows, k)
+			}
+		}
+	}
+	w, ok := m.windows[key]
+	if !ok {
+		w = &window{index: i}
+		m.windows[key] = w
+	}
+	switch {
+	case w.index == i-1:
+		w.index, w.prev, w.curr = i, w.curr, 0
+	case w.index < i-1:
+		w.index, w.prev, w.curr = i, 0, 0
+	}
+	allowed := slidingWindowAllowed(m.limit, now, w.curr, w.prev)
+	if allowed {
+		w.curr++
+	}
+	return slidingWindowResult(m.limit, now, w.curr, w.prev, allowed), nil
+}
@@ -0,0 +1,56 @@
+package a5gratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryLimiters(t *testing.T) {
+	l := Limit{Requests: 2, Window: time.Second}
+	now := time.Unix(1000, 0)
+	tb, err := NewMemoryTokenBucket(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tb.(*memoryTokenBucket).now = func() time.Time { return now }
+	sw, err := NewMemorySlidingWindow(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sw.(*memorySlidingWindow).now = func() time.Time { return now }
+	// The bucket refills a token every 500ms, the sliding window still
+	// counts the whole previous second at its start.
+	var a = []struct {
+		after   time.Duration
+		allowed [2]bool
+	}{
+		{0, [2]bool{true, true}},
+		{0, [2]bool{true, true}},
+		{0, [2]bool{false, false}},
+		{500 * time.Millisecond, [2]bool{true, false}},
+		{time.Second, [2]bool{true, false}},
+		{1500 * time.Millisecond, [2]bool{true, true}},
+		{1500 * time.Millisecond, [2]bool{false, false}},
+	}
+	for k, lim := range []Limiter{tb, sw} {
+		start := now
+		for i, v := range a {
+			now = start.Add(v.after)
+			res, err := lim.Allow("player")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Allowed != v.allowed[k] {
+				t.Errorf("%T #%d: allowed %t want %t",
+					lim, i, res.Allowed, v.allowed[k])
+			}
+			if !res.Allowed && res.RetryAfter <= 0 {
+				t.Errorf("%T #%d: retry after %v", lim, i, res.RetryAfter)
+			}
+		}
+		if res, err := lim.Allow("other"); err != nil || !res.Allowed {
+			t.Errorf("%T: other key is limited: %v", lim, err)
+		}
+		now = start.Add(10 * time.Second)
+	}
+}
@@ -0,0 +1,100 @@
+package a5gratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/pkg/errors"
+)
+
+var ErrCodeRateLimited = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+	Code:     4290,
+	Name:     "rate_limited",
+	Severity: a5gapi.ErrSeverityWarn,
+	Public:   true,
+	Message:  "too many requests"})
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeRateLimited, http.StatusTooManyRequests)
+}
+
+// KeyFunc picks whose budget a request spends.
+type KeyFunc func(*http.Request) string
+
+// KeyByIP keys by client address; mount chi's middleware.RealIP first
+// when running behind a trusted proxy.
+func KeyByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// KeyByAccount keys by the a5gsession account and falls back to KeyByIP
+// for anonymous requests.
+func KeyByAccount(r *http.Request) string {
+	if s, ok := a5gsession.FromContext(r.Context()); ok {
+		return "account:" + strconv.FormatUint(s.AccountID, 10)
+	}
+	return KeyByIP(r)
+}
+
+// Middleware limits a route (or a group of routes sharing the name).
+// Rejected requests get 429 with Retry-After both as a header and as
+// "retryAfter" seconds in the envelope meta. Limiter failures let the
+// request through.
+func Middleware(
+	name string, lim Limiter, key KeyFunc,
+	l a5glogs.Logger) (func(http.Handler) http.Handler, error) {
+	if name == "" {
+		return nil, errors.New("limit name missing")
+	}
+	if lim == nil {
+		return nil, errors.New("limiter missing")
+	}
+	if key == nil {
+		return nil, errors.New("key func missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			k := key(r)
+			res, err := lim.Allow(name + ":" + k)
+			if err != nil {
+				l.Error(err.Error())
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			if res.Allowed {
+				next.ServeHTTP(w, r)
+				return
+			}
+			retryAfter := int(math.Ceil(res.RetryAfter.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			l.With(
+				a5gfields.String("limit", name),
+				a5gfields.String("key", k),
+				a5gfields.String("requestId",
+					a5gapi.RequestIDFromContext(r.Context()))).
+				Debug("rate limited")
+			err = a5ghttp.WriteErrResponse(w, r,
+				a5gapi.KV{"retryAfter": retryAfter},
+				a5gapi.NewErr(ErrCodeRateLimited, ""))
+			if err != nil {
+				l.Error(err.Error())
+			}
+		})
+	}, nil
+}
@@ -0,0 +1,138 @@
+package a5gratelimit
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+)
+
+// Both scripts take time from the caller so that every instance agrees on
+// bucket state regardless of redis server clock.
+
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local b = redis.call("HMGET", KEYS[1], "t", "l")
+local tokens = tonumber(b[1]) or capacity
+local last = tonumber(b[2]) or now
+if now > last then
+  tokens = math.min(capacity, tokens + (now - last) * rate)
+  last = now
+end
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+redis.call("HMSET", KEYS[1], "t", tostring(tokens), "l", last)
+redis.call("PEXPIRE", KEYS[1], math.ceil(capacity / rate))
+return {allowed, tostring(tokens)}
+`)
+
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local weight = tonumber(ARGV[2])
+local ttl = tonumber(ARGV[3])
+local curr = tonumber(redis.call("GET", KEYS[1]) or "0")
+local prev = tonumber(redis.call("GET", KEYS[2]) or "0")
+local allowed = 0
+if prev * weight + curr + 1 <= limit then
+  curr = redis.call("INCR", KEYS[1])
+  redis.call("PEXPIRE", KEYS[1], ttl)
+  allowed = 1
+end
+return {allowed, curr, prev}
+`)
+
+type redisTokenBucket struct {
+	client redis.UniversalClient
+	prefix string
+	limit  Limit
+	now    func() time.Time
+}
+
+// NewRedisTokenBucket is a token bucket limiter shared by all instances
+// using the same redis and prefix.
+func NewRedisTokenBucket(
+	c redis.UniversalClient, prefix string, l Limit) (Limiter, error) {
+	if c == nil {
+		return nil, errors.New("redis client missing")
+	}
+	if err := l.validate(); err != nil {
+		return nil, err
+	}
+	return &redisTokenBucket{client: c, prefix: prefix, limit: l, now: time.Now}, nil
+}
+
+func (m *redisTokenBucket) Allow(key string) (*Result, error) {
+	// Milliseconds keep the script arithmetic within Lua number precision.
+	rate := m.limit.ratePerNano() * float64(time.Millisecond)
+	a, err := tokenBucketScript.Run(m.client, []string{m.prefix + key},
+		m.limit.capacity(),
+		strconv.FormatFloat(rate, 'g', -1, 64),
+		m.now().UnixNano()/int64(time.Millisecond)).Result()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	x, ok := a.([]interface{})
+	if !ok || len(x) != 2 {
+		return nil, errors.Errorf("unexpected token bucket reply %v", a)
+	}
+	allowed, _ := x[0].(int64)
+	s, _ := x[1].(string)
+	tokens, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return tokenBucketResult(m.limit, tokens, allowed == 1), nil
+}
+
+type redisSlidingWindow struct {
+	client redis.UniversalClient
+	prefix string
+	limit  Limit
+	now    func() time.Time
+}
+
+// NewRedisSlidingWindow is a sliding window limiter shared by all
+// instances using the same redis and prefix.
+func NewRedisSlidingWindow(
+	c redis.UniversalClient, prefix string, l Limit) (Limiter, error) {
+	if c == nil {
+		return nil, errors.New("redis client missing")
+	}
+	if err := l.validate(); err != nil {
+		return nil, err
+	}
+	if l.Window < time.Millisecond {
+		return nil, errors.New("redis sliding window is shorter than 1ms")
+	}
+	return &redisSlidingWindow{client: c, prefix: prefix, limit: l, now: time.Now}, nil
+}
+
+func (m *redisSlidingWindow) Allow(key string) (*Result, error) {
+	now := m.now()
+	i := now.UnixNano() / int64(m.limit.Window)
+	f := float64(now.UnixNano()%int64(m.limit.Window)) / float64(m.limit.Window)
+	// The hash tag keeps both windows of a key in one cluster slot.
+	k := "{" + m.prefix + key + "}:"
+	a, err := slidingWindowScript.Run(m.client,
+		[]string{k + strconv.FormatInt(i, 10), k + strconv.FormatInt(i-1, 10)},
+		m.limit.Requests,
+		strconv.FormatFloat(1-f, 'g', -1, 64),
+		int64(2*m.limit.Window/time.Millisecond)).Result()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	x, ok := a.([]interface{})
+	if !ok || len(x) != 3 {
+		return nil, errors.Errorf("unexpected sliding window reply %v", a)
+	}
+	allowed, _ := x[0].(int64)
+	curr, _ := x[1].(int64)
+	prev, _ := x[2].(int64)
+	return slidingWindowResult(m.limit, now, curr, prev, allowed == 1), nil
+}
@@ -0,0 +1,51 @@
+package a5gremote
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gsession"
+)
+
+// SnapshotRequest carries the version the client has cached, if any.
+type SnapshotRequest struct {
+	Version string `json:"version"`
+}
+
+// SnapshotResponse omits values the client already has.
+type SnapshotResponse struct {
+	Version     string                     `json:"version"`
+	Values      map[string]json.RawMessage `json:"values,omitempty"`
+	NotModified bool                       `json:"notModified,omitempty"`
+}
+
+// SnapshotHandler answers with public flags of the a5gsession
+// authenticated player; the payload is optional.
+func (c *Config) SnapshotHandler() a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		sess, ok := a5gsession.FromContext(ctx)
+		if !ok {
+			return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+		}
+		p := new(SnapshotRequest)
+		if raw, ok := req.Payload.(*json.RawMessage); ok && raw != nil &&
+			len(*raw) > 0 {
+			if err := a5ghttp.DecodePayload(req, p); err != nil {
+				return nil, []*a5gapi.APIErr{a5gapi.NewErr(
+					a5ghttp.ErrCodeRequestMalformed, "%s", err.Error())}
+			}
+		}
+		s, err := c.Resolve(ctx, int64(sess.AccountID), true)
+		if err != nil {
+			c.Logger.Error(err.Error())
+			return nil, a5gapi.NewJSONMsgDefautlErrors(err)
+		}
+		if p.Version == s.Version {
+			return &SnapshotResponse{Version: s.Version, NotModified: true}, nil
+		}
+		return &SnapshotResponse{Version: s.Version, Values: s.Values}, nil
+	}
+}
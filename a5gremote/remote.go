@@ -0,0 +1,300 @@
+package a5gremote
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+// Types of flag values.
+const (
+	TypeBool   = "bool"
+	TypeInt    = "int"
+	TypeFloat  = "float"
+	TypeString = "string"
+	TypeJSON   = "json"
+)
+
+// Flag is a feature flag or a tuning value. Public flags are sent to
+// clients, the others are read by the server only.
+type Flag struct {
+	Key         string          `json:"key"`
+	Type        string          `json:"type"`
+	Default     json.RawMessage `json:"default"`
+	Public      bool            `json:"public,omitempty"`
+	Description string          `json:"description,omitempty"`
+}
+
+// Override replaces values for players of Segment; overrides apply in
+// order, so later ones win.
+type Override struct {
+	Segment string                     `json:"segment"`
+	Values  map[string]json.RawMessage `json:"values"`
+}
+
+// Document is the remote config as stored, e.g. in a file the liveops
+// tools publish.
+type Document struct {
+	Flags     []*Flag     `json:"flags"`
+	Overrides []*Override `json:"overrides,omitempty"`
+
+	byKey map[string]*Flag
+}
+
+// ParseDocument decodes a document checking values against flag types.
+func ParseDocument(b []byte) (*Document, error) {
+	d := new(Document)
+	if err := json.Unmarshal(b, d); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	d.byKey = make(map[string]*Flag, len(d.Flags))
+	for _, f := range d.Flags {
+		if f == nil || f.Key == "" {
+			return nil, errors.New("empty flag key")
+		}
+		if d.byKey[f.Key] != nil {
+			return nil, errors.Errorf("duplicate flag %q", f.Key)
+		}
+		if err := check(f.Type, f.Default); err != nil {
+			return nil, errors.Wrapf(err, "flag %q default", f.Key)
+		}
+		d.byKey[f.Key] = f
+	}
+	for _, o := range d.Overrides {
+		if o == nil || o.Segment == "" {
+			return nil, errors.New("override segment missing")
+		}
+		for k, v := range o.Values {
+			f, ok := d.byKey[k]
+			if !ok {
+				return nil, errors.Errorf(
+					"segment %q overrides unknown flag %q", o.Segment, k)
+			}
+			if err := check(f.Type, v); err != nil {
+				return nil, errors.Wrapf(err, "segment %q flag %q", o.Segment, k)
+			}
+		}
+	}
+	return d, nil
+}
+
+func check(typ string, v json.RawMessage) error {
+	if len(v) == 0 {
+		return errors.New("value missing")
+	}
+	var x interface{}
+	switch typ {
+	case TypeBool:
+		x = new(bool)
+	case TypeInt:
+		x = new(int64)
+	case TypeFloat:
+		x = new(float64)
+	case TypeString:
+		x = new(string)
+	case TypeJSON:
+		x = new(interface{})
+	default:
+		return errors.Errorf("unknown type %q", typ)
+	}
+	if err := json.Unmarshal(v, x); err != nil {
+		return errors.Wrapf(err, "not a %s", typ)
+	}
+	return nil
+}
+
+// Source loads the document, e.g. from a file or a config service.
+type Source interface {
+	Load(ctx context.Context) ([]byte, error)
+}
+
+type SourceFunc func(ctx context.Context) ([]byte, error)
+
+func (fn SourceFunc) Load(ctx context.Context) ([]byte, error) { return fn(ctx) }
+
+// FileSource reads the document from a file.
+func FileSource(name string) Source {
+	return SourceFunc(func(context.Context) ([]byte, error) {
+		b, err := ioutil.ReadFile(name)
+		return b, errors.WithStack(err)
+	})
+}
+
+// SegmentFunc returns segments of a player, e.g. "payer" or "country:de".
+type SegmentFunc func(ctx context.Context, playerID int64) ([]string, error)
+
+// Config serves flags of the current document, reloaded without restart
+// by Reload or Watch. It complements a5gapi.Configer, which is fixed at
+// startup.
+type Config struct {
+	Source   Source
+	Segments SegmentFunc
+	Logger   a5glogs.Logger
+
+	mu  sync.RWMutex
+	doc *Document
+	raw []byte
+}
+
+func NewConfig(ctx context.Context, s Source, l a5glogs.Logger) (*Config, error) {
+	if s == nil {
+		return nil, errors.New("source missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	c := &Config{Source: s, Logger: l}
+	if _, err := c.Reload(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload loads the document and reports whether it changed. Invalid
+// documents keep the previous one.
+func (c *Config) Reload(ctx context.Context) (bool, error) {
+	b, err := c.Source.Load(ctx)
+	if err != nil {
+		return false, err
+	}
+	c.mu.RLock()
+	same := bytes.Equal(b, c.raw)
+	c.mu.RUnlock()
+	if same {
+		return false, nil
+	}
+	d, err := ParseDocument(b)
+	if err != nil {
+		return false, err
+	}
+	c.mu.Lock()
+	c.doc, c.raw = d, b
+	c.mu.Unlock()
+	return true, nil
+}
+
+// Watch reloads the document each interval until ctx is done.
+func (c *Config) Watch(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		changed, err := c.Reload(ctx)
+		if err != nil {
+			c.Logger.Error(err.Error())
+			continue
+		}
+		if changed {
+			c.Logger.Info("remote config reloaded")
+		}
+	}
+}
+
+// Snapshot is the config resolved for a player. Version is a hash of the
+// values, so clients holding it may skip downloading them again.
+type Snapshot struct {
+	Version string                     `json:"version"`
+	Values  map[string]json.RawMessage `json:"values"`
+}
+
+// Resolve returns every flag for a player, public returns only the ones
+// sent to clients.
+func (c *Config) Resolve(
+	ctx context.Context, playerID int64, public bool) (*Snapshot, error) {
+	c.mu.RLock()
+	d := c.doc
+	c.mu.RUnlock()
+	m := make(map[string]json.RawMessage, len(d.Flags))
+	for _, f := range d.Flags {
+		if !public || f.Public {
+			m[f.Key] = f.Default
+		}
+	}
+	if len(d.Overrides) > 0 && c.Segments != nil {
+		segments, err := c.Segments(ctx, playerID)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range d.Overrides {
+			if !contains(segments, o.Segment) {
+				continue
+			}
+			for k, v := range o.Values {
+				if _, ok := m[k]; ok {
+					m[k] = v
+				}
+			}
+		}
+	}
+	return newSnapshot(m)
+}
+
+func newSnapshot(m map[string]json.RawMessage) (*Snapshot, error) {
+	// Map keys are marshaled sorted, so equal values hash equally.
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	h := sha256.Sum256(b)
+	return &Snapshot{Version: hex.EncodeToString(h[:8]), Values: m}, nil
+}
+
+func contains(a []string, s string) bool {
+	for _, x := range a {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Decode unmarshals the value of key into v, reporting whether there is
+// one.
+func (s *Snapshot) Decode(key string, v interface{}) (bool, error) {
+	raw, ok := s.Values[key]
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return false, errors.Wrapf(err, "flag %q", key)
+	}
+	return true, nil
+}
+
+// Bool, Int, Float and String return a value of key or the zero value for
+// missing keys and other types.
+func (s *Snapshot) Bool(key string) bool {
+	var v bool
+	s.Decode(key, &v)
+	return v
+}
+
+func (s *Snapshot) Int(key string) int64 {
+	var v int64
+	s.Decode(key, &v)
+	return v
+}
+
+func (s *Snapshot) Float(key string) float64 {
+	var v float64
+	s.Decode(key, &v)
+	return v
+}
+
+func (s *Snapshot) String(key string) string {
+	var v string
+	s.Decode(key, &v)
+	return v
+}
@@ -0,0 +1,76 @@
+package a5gremote
+
+import (
+	"context"
+	"testing"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/sirupsen/logrus"
+)
+
+func TestConfigResolve(t *testing.T) {
+	doc := `{"flags": [
+		{"key": "pvp", "type": "bool", "default": false, "public": true},
+		{"key": "energy_max", "type": "int", "default": 100, "public": true},
+		{"key": "drop_rate", "type": "float", "default": 0.1}],
+		"overrides": [
+			{"segment": "beta", "values": {"pvp": true}},
+			{"segment": "payer", "values": {"energy_max": 120, "drop_rate": 0.2}}]}`
+	ctx := context.Background()
+	c, err := NewConfig(ctx, SourceFunc(func(context.Context) ([]byte, error) {
+		return []byte(doc), nil
+	}), a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Segments = func(ctx context.Context, playerID int64) ([]string, error) {
+		if playerID == 2 {
+			return []string{"payer", "beta"}, nil
+		}
+		return nil, nil
+	}
+	tests := []struct {
+		name      string
+		playerID  int64
+		public    bool
+		pvp       bool
+		energyMax int64
+		dropRate  float64
+		values    int
+	}{
+		{"default", 1, false, false, 100, 0.1, 3},
+		{"overridden", 2, false, true, 120, 0.2, 3},
+		{"public", 2, true, true, 120, 0, 2},
+	}
+	versions := make(map[string]bool)
+	for _, test := range tests {
+		s, err := c.Resolve(ctx, test.playerID, test.public)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Bool("pvp") != test.pvp || s.Int("energy_max") != test.energyMax ||
+			s.Float("drop_rate") != test.dropRate || len(s.Values) != test.values {
+			t.Errorf("%s: unexpected snapshot %+v", test.name, s)
+		}
+		versions[s.Version] = true
+	}
+	if len(versions) != 3 {
+		t.Errorf("expected distinct versions, got %v", versions)
+	}
+
+	before, _ := c.Resolve(ctx, 1, true)
+	doc = `{"flags": [{"key": "pvp", "type": "bool", "default": "yes"}]}`
+	if _, err = c.Reload(ctx); err == nil {
+		t.Error("expected an invalid document error")
+	}
+	doc = `{"flags": [
+		{"key": "pvp", "type": "bool", "default": false, "public": true},
+		{"key": "energy_max", "type": "int", "default": 150, "public": true}]}`
+	if changed, err := c.Reload(ctx); err != nil || !changed {
+		t.Fatalf("unexpected reload %v, %v", changed, err)
+	}
+	after, _ := c.Resolve(ctx, 1, true)
+	if after.Version == before.Version || after.Int("energy_max") != 150 {
+		t.Errorf("unexpected snapshot %+v after a reload", after)
+	}
+}
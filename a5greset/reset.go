@@ -0,0 +1,106 @@
+package a5greset
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Period is a game day or week; Key names it, e.g. for storage keys and
+// seeds, and is the date of the period start in the reset location.
+type Period struct {
+	Key   string
+	Start time.Time
+	End   time.Time
+}
+
+func (p Period) Contains(t time.Time) bool {
+	return !t.Before(p.Start) && t.Before(p.End)
+}
+
+// Reset is where game days and weeks start: at Offset past midnight in
+// Location, weeks on WeekStart. A nil Reset is the UTC midnight every
+// package used before, with weeks starting on Monday.
+type Reset struct {
+	Location  *time.Location
+	Offset    time.Duration
+	WeekStart time.Weekday
+}
+
+func NewReset(
+	loc *time.Location, offset time.Duration,
+	weekStart time.Weekday) (*Reset, error) {
+	if loc == nil {
+		return nil, errors.New("reset location missing")
+	}
+	if offset < 0 || offset >= 24*time.Hour {
+		return nil, errors.Errorf("reset offset %s is out of a day", offset)
+	}
+	return &Reset{Location: loc, Offset: offset, WeekStart: weekStart}, nil
+}
+
+// In is the reset at the same local time in another location, for the
+// per-player timezone mode.
+func (r *Reset) In(loc *time.Location) *Reset {
+	x := r.orDefault()
+	x.Location = loc
+	return &x
+}
+
+func (r *Reset) orDefault() Reset {
+	if r == nil {
+		return Reset{Location: time.UTC, WeekStart: time.Monday}
+	}
+	x := *r
+	if x.Location == nil {
+		x.Location = time.UTC
+	}
+	return x
+}
+
+// Day is the game day t belongs to. Days follow calendar dates, so they
+// last 23 or 25 hours around DST changes.
+func (r *Reset) Day(t time.Time) Period {
+	x := r.orDefault()
+	start := x.dayStart(t)
+	return Period{
+		Key:   start.Format("2006-01-02"),
+		Start: start,
+		End:   x.at(start.AddDate(0, 0, 1))}
+}
+
+// Week is the game week t belongs to, keyed by the date it starts on.
+func (r *Reset) Week(t time.Time) Period {
+	x := r.orDefault()
+	day := x.dayStart(t)
+	days := (int(day.Weekday()) - int(x.WeekStart) + 7) % 7
+	start := x.at(day.AddDate(0, 0, -days))
+	return Period{
+		Key:   fmt.Sprintf("w%s", start.Format("2006-01-02")),
+		Start: start,
+		End:   x.at(start.AddDate(0, 0, 7))}
+}
+
+// NextDay is the start of the game day after t.
+func (r *Reset) NextDay(t time.Time) time.Time {
+	return r.Day(t).End
+}
+
+// dayStart is the reset moment of the day t belongs to; like at, it needs
+// the Location orDefault guarantees.
+func (r *Reset) dayStart(t time.Time) time.Time {
+	local := t.In(r.Location).Add(-r.Offset)
+	start := r.at(local)
+	if start.After(t) {
+		start = r.at(local.AddDate(0, 0, -1))
+	}
+	return start
+}
+
+// at is the reset moment of the calendar date of t.
+func (r *Reset) at(t time.Time) time.Time {
+	t = t.In(r.Location)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, r.Location).
+		Add(r.Offset)
+}
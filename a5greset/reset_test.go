@@ -0,0 +1,60 @@
+package a5greset
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReset(t *testing.T) {
+	msk := time.FixedZone("MSK", 3*60*60)
+	r, err := NewReset(msk, 4*time.Hour, time.Monday)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		reset *Reset
+		t     time.Time
+		day   string
+		week  string
+		next  time.Time
+	}{
+		{nil, time.Date(2020, 3, 11, 23, 59, 0, 0, time.UTC),
+			"2020-03-11", "w2020-03-09",
+			time.Date(2020, 3, 12, 0, 0, 0, 0, time.UTC)},
+		{r, time.Date(2020, 3, 11, 0, 59, 0, 0, time.UTC),
+			"2020-03-10", "w2020-03-09",
+			time.Date(2020, 3, 11, 1, 0, 0, 0, time.UTC)},
+		{r, time.Date(2020, 3, 11, 1, 0, 0, 0, time.UTC),
+			"2020-03-11", "w2020-03-09",
+			time.Date(2020, 3, 12, 1, 0, 0, 0, time.UTC)},
+		{r, time.Date(2020, 3, 9, 0, 30, 0, 0, time.UTC),
+			"2020-03-08", "w2020-03-02",
+			time.Date(2020, 3, 9, 1, 0, 0, 0, time.UTC)},
+		{r.In(time.UTC), time.Date(2020, 3, 11, 3, 0, 0, 0, time.UTC),
+			"2020-03-10", "w2020-03-09",
+			time.Date(2020, 3, 11, 4, 0, 0, 0, time.UTC)},
+	}
+	for _, x := range tests {
+		d, w := x.reset.Day(x.t), x.reset.Week(x.t)
+		if d.Key != x.day || w.Key != x.week || !d.End.Equal(x.next) ||
+			!d.Contains(x.t) || !w.Contains(x.t) {
+			t.Errorf("%s: expected %s %s till %s, got %+v %+v",
+				x.t, x.day, x.week, x.next, d, w)
+		}
+	}
+	s, err := NewService(r, ModePlayer, func(id int64) (*time.Location, error) {
+		if id == 1 {
+			return time.UTC, nil
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2020, 3, 11, 2, 0, 0, 0, time.UTC)
+	for id, expected := range map[int64]string{1: "2020-03-10", 2: "2020-03-11"} {
+		if d, err := s.Day(id, at); err != nil || d.Key != expected {
+			t.Errorf("player %d: expected %s, got %+v %v", id, expected, d, err)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package a5greset
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type Mode int
+
+const (
+	// ModeGame resets every player at the game reset.
+	ModeGame Mode = iota
+	// ModePlayer resets players at the game reset local time of their own
+	// timezone, falling back to the game one when unknown.
+	ModePlayer
+)
+
+// LocationFunc returns the timezone of a player, nil when unknown.
+type LocationFunc func(playerID int64) (*time.Location, error)
+
+// Service hands out the Reset quests, shop rotation, energy and other
+// daily features of a player use, so that they all agree on the day.
+type Service struct {
+	Game     *Reset
+	Mode     Mode
+	Location LocationFunc
+}
+
+func NewService(game *Reset, mode Mode, fn LocationFunc) (*Service, error) {
+	if game == nil {
+		return nil, errors.New("game reset missing")
+	}
+	if mode == ModePlayer && fn == nil {
+		return nil, errors.New("player location func missing")
+	}
+	return &Service{Game: game, Mode: mode, Location: fn}, nil
+}
+
+func (s *Service) For(playerID int64) (*Reset, error) {
+	if s.Mode != ModePlayer {
+		return s.Game, nil
+	}
+	loc, err := s.Location(playerID)
+	if err != nil {
+		return nil, err
+	}
+	if loc == nil {
+		return s.Game, nil
+	}
+	return s.Game.In(loc), nil
+}
+
+// Day is the game day of playerID at t.
+func (s *Service) Day(playerID int64, t time.Time) (Period, error) {
+	r, err := s.For(playerID)
+	if err != nil {
+		return Period{}, err
+	}
+	return r.Day(t), nil
+}
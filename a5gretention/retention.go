@@ -0,0 +1,321 @@
+package a5gretention
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Period is the span of time a partition holds.
+type Period int
+
+const (
+	Daily Period = iota
+	Monthly
+)
+
+func (p Period) start(t time.Time) time.Time {
+	t = t.UTC()
+	if p == Monthly {
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func (p Period) next(t time.Time) time.Time {
+	if p == Monthly {
+		return t.AddDate(0, 1, 0)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+// Policy keeps rows of Table for Retention in partitions of Period,
+// creating Ahead partitions in advance, e.g. audit for two years,
+// chat for 90 days and hot analytics for 30 days:
+//
+//	[]*Policy{
+//		{Name: "audit", Table: "audit", Period: Monthly, Retention: 2 * 365 * 24 * time.Hour, Ahead: 2},
+//		{Name: "chat", Table: "chat_messages", Period: Daily, Retention: 90 * 24 * time.Hour, Ahead: 7},
+//		{Name: "analytics", Table: "analytics_events", Period: Daily, Retention: 30 * 24 * time.Hour, Ahead: 7}}
+type Policy struct {
+	Name      string
+	Table     string
+	Period    Period
+	Retention time.Duration
+	Ahead     int
+}
+
+func (p *Policy) validate() error {
+	if p.Name == "" {
+		return errors.New("empty retention policy name")
+	}
+	if !identifier.MatchString(p.Table) {
+		return errors.Errorf("retention policy %q: invalid table %q", p.Name, p.Table)
+	}
+	if p.Period != Daily && p.Period != Monthly {
+		return errors.Errorf("retention policy %q: unknown period %d", p.Name, p.Period)
+	}
+	if p.Retention <= 0 || p.Ahead < 1 {
+		return errors.Errorf("retention policy %q: no retention or partitions ahead", p.Name)
+	}
+	return nil
+}
+
+// Partition holds rows from Start until Before. Partitions are named by
+// their start, e.g. p20200310.
+type Partition struct {
+	Name   string
+	Start  time.Time
+	Before time.Time
+}
+
+const nameLayout = "20060102"
+
+func partition(p Period, start time.Time) *Partition {
+	return &Partition{
+		Name:   "p" + start.Format(nameLayout),
+		Start:  start,
+		Before: p.next(start)}
+}
+
+// Store manages partitions of tables. Partitions lists the partitions
+// of table ordered by Start, Add appends partitions after the last one and
+// Drop drops partitions with their rows.
+type Store interface {
+	Partitions(table string) ([]*Partition, error)
+	Add(table string, a []*Partition) error
+	Drop(table string, names []string) error
+}
+
+// Stats are the enforcement metrics of a policy.
+type Stats struct {
+	Policy     string `json:"policy"`
+	Partitions int    `json:"partitions"`
+	Oldest     int64  `json:"oldest"`
+	Created    int64  `json:"created"`
+	Dropped    int64  `json:"dropped"`
+	Runs       int64  `json:"runs"`
+	Errors     int64  `json:"errors"`
+	LastRunAt  int64  `json:"lastRunAt"`
+	LastErr    string `json:"lastErr,omitempty"`
+}
+
+// Manager enforces Policies every Interval, it is an a5gapp.Module.
+type Manager struct {
+	Policies []*Policy
+	Store    Store
+	Logger   a5glogs.Logger
+	Interval time.Duration
+
+	now     func() time.Time
+	mu      sync.Mutex
+	stats   map[string]*Stats
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+func NewManager(policies []*Policy, s Store, l a5glogs.Logger) (*Manager, error) {
+	stats := make(map[string]*Stats, len(policies))
+	for _, p := range policies {
+		if p == nil {
+			return nil, errors.New("nil retention policy")
+		}
+		if err := p.validate(); err != nil {
+			return nil, err
+		}
+		if stats[p.Name] != nil {
+			return nil, errors.Errorf("duplicate retention policy %q", p.Name)
+		}
+		stats[p.Name] = &Stats{Policy: p.Name}
+	}
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Manager{
+		Policies: policies,
+		Store:    s,
+		Logger:   l,
+		Interval: time.Hour,
+		now:      time.Now,
+		stats:    stats}, nil
+}
+
+// Enforce creates missing partitions ahead and drops partitions past
+// retention of every policy, a failing policy does not stop the others.
+func (m *Manager) Enforce(ctx context.Context) error {
+	var first error
+	for _, p := range m.Policies {
+		if err := ctx.Err(); err != nil {
+			return errors.WithStack(err)
+		}
+		created, dropped, parts, err := m.enforce(p)
+		m.record(p, created, dropped, parts, err)
+		if err != nil {
+			err = errors.Wrapf(err, "retention policy %q", p.Name)
+			m.Logger.Error(err.Error())
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		if created+dropped > 0 {
+			m.Logger.With(a5gfields.String("retentionPolicy", p.Name),
+				a5gfields.Int64("created", created),
+				a5gfields.Int64("dropped", dropped)).Info("retention enforced")
+		}
+	}
+	return first
+}
+
+func (m *Manager) enforce(p *Policy) (created, dropped int64, parts []*Partition, err error) {
+	parts, err = m.Store.Partitions(p.Table)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	now := m.now()
+	horizon := p.Period.start(now)
+	for i := 0; i < p.Ahead; i++ {
+		horizon = p.Period.next(horizon)
+	}
+	start := p.Period.start(now)
+	if len(parts) > 0 {
+		start = parts[len(parts)-1].Before
+	}
+	var add []*Partition
+	for ; start.Before(horizon); start = p.Period.next(start) {
+		add = append(add, partition(p.Period, start))
+	}
+	if len(add) > 0 {
+		if err = m.Store.Add(p.Table, add); err != nil {
+			return 0, 0, parts, err
+		}
+		parts = append(parts, add...)
+	}
+	// The partition being written to is kept even with a short retention.
+	expired := now.Add(-p.Retention)
+	var drop []string
+	for _, x := range parts[:len(parts)-1] {
+		if x.Before.After(expired) || !x.Before.Before(now) {
+			break
+		}
+		drop = append(drop, x.Name)
+	}
+	if len(drop) > 0 {
+		if err = m.Store.Drop(p.Table, drop); err != nil {
+			return int64(len(add)), 0, parts, err
+		}
+		parts = parts[len(drop):]
+	}
+	return int64(len(add)), int64(len(drop)), parts, nil
+}
+
+func (m *Manager) record(
+	p *Policy, created, dropped int64, parts []*Partition, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.stats[p.Name]
+	s.Runs++
+	s.Created += created
+	s.Dropped += dropped
+	s.LastRunAt = m.now().Unix()
+	s.LastErr = ""
+	if err != nil {
+		s.Errors++
+		s.LastErr = err.Error()
+	}
+	if parts != nil {
+		s.Partitions = len(parts)
+		s.Oldest = 0
+		if len(parts) > 0 {
+			s.Oldest = parts[0].Start.Unix()
+		}
+	}
+}
+
+// Report returns stats of policies sorted by name.
+func (m *Manager) Report() []*Stats {
+	m.mu.Lock()
+	a := make([]*Stats, 0, len(m.stats))
+	for _, s := range m.stats {
+		x := *s
+		a = append(a, &x)
+	}
+	m.mu.Unlock()
+	sort.Slice(a, func(i, j int) bool { return a[i].Policy < a[j].Policy })
+	return a
+}
+
+// ReportHandler answers with the Report for dashboards, mount it on an
+// admin route class.
+func (m *Manager) ReportHandler() a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		return m.Report(), nil
+	}
+}
+
+func (m *Manager) Name() string { return "retention" }
+
+// Start enforces policies at once, so partitions exist before writes
+// begin, and then every Interval until Stop is called.
+func (m *Manager) Start(ctx context.Context) error {
+	if err := m.Enforce(ctx); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cancel != nil {
+		return errors.New("retention manager already started")
+	}
+	var runCtx context.Context
+	runCtx, m.cancel = context.WithCancel(context.Background())
+	m.stopped = make(chan struct{})
+	go m.run(runCtx, m.stopped)
+	return nil
+}
+
+func (m *Manager) run(ctx context.Context, stopped chan struct{}) {
+	defer close(stopped)
+	t := time.NewTicker(m.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		// Enforce logs failures of policies itself.
+		_ = m.Enforce(ctx)
+	}
+}
+
+// Stop waits for the running enforcement until ctx is done.
+func (m *Manager) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	cancel, stopped := m.cancel, m.stopped
+	m.cancel = nil
+	m.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
@@ -0,0 +1,87 @@
+package a5gretention
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+type failingStore struct {
+	Store
+}
+
+func (failingStore) Drop(string, []string) error {
+	return errors.New("metadata lock wait timeout")
+}
+
+func names(a []*Partition) []string {
+	var s []string
+	for _, p := range a {
+		s = append(s, p.Name)
+	}
+	return s
+}
+
+func TestManager(t *testing.T) {
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	s := NewMemoryStore()
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	chat := &Policy{Name: "chat", Table: "chat_messages", Period: Daily,
+		Retention: 3 * 24 * time.Hour, Ahead: 2}
+	audit := &Policy{Name: "audit", Table: "audit", Period: Monthly,
+		Retention: 2 * 365 * 24 * time.Hour, Ahead: 1}
+	if _, err := NewManager([]*Policy{{Name: "x", Table: "a b",
+		Retention: time.Hour, Ahead: 1}}, s, l); err == nil {
+		t.Fatal("expected an invalid table error")
+	}
+	m, err := NewManager([]*Policy{chat, audit}, s, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	if err = m.Enforce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	a, _ := s.Partitions("chat_messages")
+	if got := names(a); len(got) != 2 || got[0] != "p20200310" || got[1] != "p20200311" {
+		t.Errorf("unexpected partitions %v", got)
+	}
+	a, _ = s.Partitions("audit")
+	if got := names(a); len(got) != 1 || got[0] != "p20200301" ||
+		!a[0].Before.Equal(time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected partitions %v", got)
+	}
+
+	// A week later partitions past three days of retention are dropped.
+	now = now.AddDate(0, 0, 7)
+	if err = m.Enforce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	a, _ = s.Partitions("chat_messages")
+	if got := names(a); len(got) != 5 || got[0] != "p20200314" || got[4] != "p20200318" {
+		t.Errorf("unexpected partitions %v", got)
+	}
+	r := m.Report()
+	if len(r) != 2 || r[1].Policy != "chat" || r[1].Created != 9 ||
+		r[1].Dropped != 4 || r[1].Runs != 2 || r[1].Partitions != 5 ||
+		r[1].Oldest != time.Date(2020, 3, 14, 0, 0, 0, 0, time.UTC).Unix() {
+		t.Errorf("unexpected report %+v", r[1])
+	}
+
+	// A failing policy is reported and does not stop the others.
+	m.Store = failingStore{s}
+	now = now.AddDate(0, 0, 2)
+	if err = m.Enforce(ctx); err == nil {
+		t.Fatal("expected a drop error")
+	}
+	r = m.Report()
+	if r[1].Errors != 1 || r[1].LastErr == "" || r[0].Errors != 0 || r[0].Runs != 3 {
+		t.Errorf("unexpected report %+v %+v", r[0], r[1])
+	}
+}
@@ -0,0 +1,155 @@
+package a5gretention
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryStore struct {
+	mu     sync.Mutex
+	tables map[string][]*Partition
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{tables: make(map[string][]*Partition)}
+}
+
+func (s *memoryStore) Partitions(table string) ([]*Partition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := make([]*Partition, 0, len(s.tables[table]))
+	for _, p := range s.tables[table] {
+		x := *p
+		a = append(a, &x)
+	}
+	return a, nil
+}
+
+func (s *memoryStore) Add(table string, a []*Partition) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	parts := s.tables[table]
+	for _, p := range a {
+		if n := len(parts); n > 0 && !parts[n-1].Before.Before(p.Before) {
+			return errors.Errorf("partition %s of %s out of order", p.Name, table)
+		}
+		x := *p
+		parts = append(parts, &x)
+	}
+	s.tables[table] = parts
+	return nil
+}
+
+func (s *memoryStore) Drop(table string, names []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	drop := make(map[string]bool, len(names))
+	for _, name := range names {
+		drop[name] = true
+	}
+	var kept []*Partition
+	for _, p := range s.tables[table] {
+		if !drop[p.Name] {
+			kept = append(kept, p)
+		}
+	}
+	s.tables[table] = kept
+	return nil
+}
+
+// dbStore manages MySQL tables partitioned by range of a DATETIME
+// column, with no MAXVALUE partition as partitions are added past the last
+// one, e.g.
+//
+//	CREATE TABLE chat_messages (
+//	  id BIGINT NOT NULL AUTO_INCREMENT,
+//	  created_at DATETIME NOT NULL,
+//	  ...
+//	  PRIMARY KEY (id, created_at))
+//	PARTITION BY RANGE COLUMNS (created_at) (
+//	  PARTITION p20200310 VALUES LESS THAN ('2020-03-11'));
+type dbStore struct {
+	pooler a5gdb.Pooler
+}
+
+func NewDBStore(p a5gdb.Pooler) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	return &dbStore{pooler: p}, nil
+}
+
+type dbPartition struct {
+	Name        string `db:"PARTITION_NAME"`
+	Description string `db:"PARTITION_DESCRIPTION"`
+}
+
+const dateLayout = "2006-01-02"
+
+func (s *dbStore) Partitions(table string) ([]*Partition, error) {
+	var rows []*dbPartition
+	_, err := s.pooler.WritePool().NewSession().
+		Select("PARTITION_NAME", "PARTITION_DESCRIPTION").
+		From("information_schema.PARTITIONS").
+		Where("TABLE_SCHEMA = DATABASE()").
+		Where(dbr.Eq("TABLE_NAME", table)).
+		Where("PARTITION_NAME IS NOT NULL").
+		OrderAsc("PARTITION_ORDINAL_POSITION").Load(&rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	a := make([]*Partition, 0, len(rows))
+	for _, r := range rows {
+		start, err := time.Parse(nameLayout, strings.TrimPrefix(r.Name, "p"))
+		if err != nil {
+			return nil, errors.Errorf("unmanaged partition %s of %s", r.Name, table)
+		}
+		d := strings.Trim(r.Description, "'")
+		if len(d) < len(dateLayout) {
+			return nil, errors.Errorf("partition %s of %s: bad bound %q",
+				r.Name, table, r.Description)
+		}
+		before, err := time.Parse(dateLayout, d[:len(dateLayout)])
+		if err != nil {
+			return nil, errors.Wrapf(err, "partition %s of %s", r.Name, table)
+		}
+		a = append(a, &Partition{Name: r.Name, Start: start, Before: before})
+	}
+	sort.Slice(a, func(i, j int) bool { return a[i].Start.Before(a[j].Start) })
+	return a, nil
+}
+
+// Add and Drop run DDL, table and partition names are checked by policies
+// and built by this package, bounds are dates.
+func (s *dbStore) Add(table string, a []*Partition) error {
+	var b bytes.Buffer
+	b.WriteString("ALTER TABLE " + table + " ADD PARTITION (")
+	for i, p := range a {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("PARTITION " + p.Name + " VALUES LESS THAN ('" +
+			p.Before.Format(dateLayout) + "')")
+	}
+	b.WriteString(")")
+	if _, err := s.pooler.WritePool().NewSession().Exec(b.String()); err != nil {
+		return errors.Wrap(err, "dbr.(*Session).Exec fn")
+	}
+	return nil
+}
+
+func (s *dbStore) Drop(table string, names []string) error {
+	_, err := s.pooler.WritePool().NewSession().Exec(
+		"ALTER TABLE " + table + " DROP PARTITION " + strings.Join(names, ", "))
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*Session).Exec fn")
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package a5grotation
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/armor5games/a5g/a5greset"
+	"github.com/pkg/errors"
+)
+
+// Entry is an shop slot candidate. Weight overrides the rarity weight when
+// set.
+type Entry struct {
+	ID     string `json:"id"`
+	Rarity string `json:"rarity,omitempty"`
+	Weight uint64 `json:"weight,omitempty"`
+}
+
+// Config is an balance data of a rotating shop.
+type Config struct {
+	Slots    int               `json:"slots"`
+	Rarities map[string]uint64 `json:"rarities,omitempty"`
+	Entries  []Entry           `json:"entries"`
+}
+
+// Generator picks slots deterministically: the same salt, player, day and
+// refresh number always produce the same rotation, so nothing has to be
+// stored except the number of refreshes bought.
+type Generator struct {
+	// Reset is where rotation days start, UTC midnight when nil.
+	Reset *a5greset.Reset
+
+	salt    string
+	slots   int
+	entries []Entry
+	weights []uint64
+}
+
+func NewGenerator(c *Config, salt string) (*Generator, error) {
+	if c == nil {
+		return nil, errors.New("nil rotation config")
+	}
+	if c.Slots < 1 {
+		return nil, errors.New("unexpected rotation slots count")
+	}
+	g := &Generator{salt: salt, slots: c.Slots}
+	ids := make(map[string]bool)
+	var total uint64
+	for _, e := range c.Entries {
+		if e.ID == "" {
+			return nil, errors.New("empty rotation entry id")
+		}
+		if ids[e.ID] {
+			return nil, errors.Errorf("duplicate rotation entry %q", e.ID)
+		}
+		ids[e.ID] = true
+		w := e.Weight
+		if w == 0 {
+			w = c.Rarities[e.Rarity]
+		}
+		if w == 0 {
+			continue
+		}
+		// Rotation draws from the total with rand.Int63n.
+		if w > math.MaxInt64-total {
+			return nil, errors.New("rotation weights total overflows int64")
+		}
+		total += w
+		g.entries = append(g.entries, e)
+		g.weights = append(g.weights, w)
+	}
+	if len(g.entries) < g.slots {
+		return nil, errors.New("not enough weighted rotation entries")
+	}
+	return g, nil
+}
+
+func NewGeneratorJSON(b []byte, salt string) (*Generator, error) {
+	c := new(Config)
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return NewGenerator(c, salt)
+}
+
+// Rotation returns slots for the game day of t after refreshes purchased
+// refreshes.
+func (g *Generator) Rotation(playerID int64, t time.Time, refreshes int) []Entry {
+	r := rand.New(rand.NewSource(g.seed(playerID, t, refreshes)))
+	weights := make([]uint64, len(g.weights))
+	copy(weights, g.weights)
+	var total uint64
+	for _, w := range weights {
+		total += w
+	}
+	a := make([]Entry, 0, g.slots)
+	for len(a) < g.slots {
+		n := uint64(r.Int63n(int64(total)))
+		for i, w := range weights {
+			if n >= w {
+				n -= w
+				continue
+			}
+			a = append(a, g.entries[i])
+			total -= w
+			weights[i] = 0
+			break
+		}
+	}
+	return a
+}
+
+// Preview returns tomorrow's first rotation, for QA tooling.
+func (g *Generator) Preview(playerID int64, t time.Time) []Entry {
+	return g.Rotation(playerID, g.Reset.NextDay(t), 0)
+}
+
+func (g *Generator) seed(playerID int64, t time.Time, refreshes int) int64 {
+	a := []string{
+		g.salt,
+		strconv.FormatInt(playerID, 10),
+		g.Reset.Day(t).Key,
+		strconv.Itoa(refreshes)}
+	h := sha256.Sum256([]byte(strings.Join(a, "\x00")))
+	return int64(binary.BigEndian.Uint64(h[:]) >> 1)
+}
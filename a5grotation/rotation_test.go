@@ -0,0 +1,76 @@
+package a5grotation
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5greset"
+)
+
+func TestGeneratorRotation(t *testing.T) {
+	c := &Config{Slots: 3, Rarities: map[string]uint64{"common": 10, "rare": 1}}
+	for _, id := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		c.Entries = append(c.Entries, Entry{ID: id, Rarity: "common"})
+	}
+	c.Entries = append(c.Entries, Entry{ID: "x", Rarity: "rare"},
+		Entry{ID: "none", Rarity: "unknown"})
+	g, err := NewGenerator(c, "salt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Reset, err = a5greset.NewReset(time.UTC, 4*time.Hour, time.Monday)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The game day runs from 04:00 to 04:00.
+	morning := time.Date(2020, 5, 1, 4, 0, 0, 0, time.UTC)
+	night := time.Date(2020, 5, 2, 3, 59, 59, 0, time.UTC)
+	next := time.Date(2020, 5, 2, 4, 0, 0, 0, time.UTC)
+	a := g.Rotation(7, morning, 0)
+	if len(a) != 3 {
+		t.Fatalf("unexpected rotation %v", a)
+	}
+	seen := make(map[string]bool)
+	for _, e := range a {
+		if seen[e.ID] || e.ID == "none" {
+			t.Errorf("unexpected rotation %v", a)
+		}
+		seen[e.ID] = true
+	}
+	if !reflect.DeepEqual(a, g.Rotation(7, night, 0)) {
+		t.Error("rotation changed within the game day")
+	}
+	if !reflect.DeepEqual(g.Preview(7, morning), g.Rotation(7, next, 0)) {
+		t.Error("preview differs from the next day rotation")
+	}
+	// Rotations may repeat by chance, a few days make it unlikely.
+	differs := 0
+	for i := 0; i < 5; i++ {
+		day := morning.AddDate(0, 0, i)
+		base := g.Rotation(7, day, 0)
+		if !reflect.DeepEqual(base, g.Rotation(7, day.AddDate(0, 0, 1), 0)) {
+			differs |= 1
+		}
+		if !reflect.DeepEqual(base, g.Rotation(7, day, 1)) {
+			differs |= 2
+		}
+		if !reflect.DeepEqual(base, g.Rotation(8, day, 0)) {
+			differs |= 4
+		}
+	}
+	if differs != 7 {
+		t.Errorf("rotations don't vary by day, refresh and player: %b", differs)
+	}
+
+	if _, err = NewGenerator(&Config{Slots: 1, Entries: []Entry{
+		{ID: "a", Weight: math.MaxInt64}, {ID: "b", Weight: 1}}}, ""); err == nil {
+		t.Error("expected a weights overflow error")
+	}
+	if _, err = NewGenerator(&Config{Slots: 1, Entries: []Entry{
+		{ID: "a", Weight: math.MaxUint64}}}, ""); err == nil {
+		t.Error("expected a weight overflow error")
+	}
+}
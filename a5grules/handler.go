@@ -0,0 +1,104 @@
+package a5grules
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCodeRuleUnknown = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4070,
+		Name:     "rule_unknown",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "rule not found"})
+
+	ErrCodeConditionInvalid = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4283,
+		Name:     "rule_condition_invalid",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "rule condition invalid"})
+)
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeRuleUnknown, http.StatusNotFound)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeConditionInvalid, http.StatusUnprocessableEntity)
+}
+
+// DryRunRequest evaluates rule RuleID, or the draft condition When, for
+// the facts of AccountID when set, overridden by Facts, e.g. to try what
+// a player at level 20 would get.
+type DryRunRequest struct {
+	RuleID    string     `json:"ruleId" validate:"max=128"`
+	When      *Condition `json:"when"`
+	AccountID uint64     `json:"accountId"`
+	Facts     Facts      `json:"facts"`
+}
+
+type DryRunResponse struct {
+	Match bool   `json:"match"`
+	Facts Facts  `json:"facts"`
+	Trace *Trace `json:"trace"`
+}
+
+// DryRunHandler evaluates a rule without side effects and answers with
+// the trace of every condition, mount it on an admin route class for
+// designers.
+func (e *Engine) DryRunHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(DryRunRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			res, err := e.DryRun(ctx, req.Payload.(*DryRunRequest))
+			if err != nil {
+				return nil, e.apiErrs(err)
+			}
+			return res, nil
+		})
+}
+
+func (e *Engine) DryRun(ctx context.Context, r *DryRunRequest) (*DryRunResponse, error) {
+	c := r.When
+	if r.RuleID != "" {
+		x, ok := e.Rule(r.RuleID)
+		if !ok {
+			return nil, errors.Wrap(ErrRuleUnknown, r.RuleID)
+		}
+		c = x.When
+	} else if err := e.Compile(c); err != nil {
+		return nil, err
+	}
+	facts := make(Facts)
+	if r.AccountID != 0 {
+		x, err := e.Facts(ctx, r.AccountID)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range x {
+			facts[k] = v
+		}
+	}
+	for k, v := range r.Facts {
+		facts[k] = v
+	}
+	t := Explain(c, facts)
+	return &DryRunResponse{Match: t.Match, Facts: facts, Trace: t}, nil
+}
+
+func (e *Engine) apiErrs(err error) []*a5gapi.APIErr {
+	switch errors.Cause(err) {
+	case ErrRuleUnknown:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeRuleUnknown, "")}
+	case ErrConditionInvalid:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeConditionInvalid, "%s", err)}
+	}
+	e.Logger.Error(err.Error())
+	return a5gapi.NewJSONMsgDefautlErrors(err)
+}
@@ -0,0 +1,416 @@
+// Package a5grules evaluates declarative rules, conditions over player
+// attributes and request context expressed in JSON, e.g.
+//
+//	{"id": "segment:lapsed_payer", "when": {"all": [
+//	  {"attr": "player.spend", "op": "gt", "value": 0},
+//	  {"attr": "player.daysAway", "op": "gte", "value": 14}]}}
+//
+// Offers, quests and segments name rules instead of hardcoding targeting,
+// so designers change who gets what with a balance data reload.
+package a5grules
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/armor5games/a5g/a5gevents"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gscript"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrRuleUnknown      = errors.New("rule unknown")
+	ErrConditionInvalid = errors.New("rule condition invalid")
+)
+
+// Ops of attribute conditions. Between takes a [min, max] value, in a
+// list; contains matches list attributes holding value and strings
+// containing it.
+const (
+	OpEq       = "eq"
+	OpNe       = "ne"
+	OpLt       = "lt"
+	OpLte      = "lte"
+	OpGt       = "gt"
+	OpGte      = "gte"
+	OpIn       = "in"
+	OpContains = "contains"
+	OpExists   = "exists"
+	OpBetween  = "between"
+)
+
+// Condition is exactly one of: All (every child matches), Any (a child
+// matches), Not, an attribute test Attr Op Value, or Expr, an a5gscript
+// condition over the same facts for what the ops can't say.
+type Condition struct {
+	All   []*Condition `json:"all,omitempty"`
+	Any   []*Condition `json:"any,omitempty"`
+	Not   *Condition   `json:"not,omitempty"`
+	Attr  string       `json:"attr,omitempty"`
+	Op    string       `json:"op,omitempty"`
+	Value interface{}  `json:"value,omitempty"`
+	Expr  string       `json:"expr,omitempty"`
+
+	program *a5gscript.Program
+}
+
+type Rule struct {
+	ID          string     `json:"id"`
+	Description string     `json:"description,omitempty"`
+	When        *Condition `json:"when"`
+}
+
+// Facts are attributes of a player and the request, keyed by dotted
+// names like "player.level" or "ctx.platform". Numbers of any Go type
+// compare as float64.
+type Facts map[string]interface{}
+
+// FactsFunc loads facts of a player.
+type FactsFunc func(ctx context.Context, accountID uint64) (Facts, error)
+
+// Engine keeps rules by ID; Replace swaps them on a balance data reload.
+type Engine struct {
+	Facts  FactsFunc
+	Limits a5gscript.Limits
+	Logger a5glogs.Logger
+
+	mu    sync.RWMutex
+	rules map[string]*Rule
+}
+
+func NewEngine(rules []*Rule, facts FactsFunc, l a5glogs.Logger) (*Engine, error) {
+	if facts == nil {
+		return nil, errors.New("facts func missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	e := &Engine{Facts: facts, Logger: l}
+	if err := e.Replace(rules); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func NewRulesJSON(b []byte) ([]*Rule, error) {
+	var a []*Rule
+	if err := json.Unmarshal(b, &a); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return a, nil
+}
+
+// Replace validates rules and swaps them in, invalid rules keep the
+// previous ones.
+func (e *Engine) Replace(rules []*Rule) error {
+	m := make(map[string]*Rule, len(rules))
+	for _, r := range rules {
+		if r == nil || r.ID == "" {
+			return errors.New("empty rule id")
+		}
+		if m[r.ID] != nil {
+			return errors.Errorf("duplicate rule %q", r.ID)
+		}
+		if err := e.Compile(r.When); err != nil {
+			return errors.Wrapf(err, "rule %q", r.ID)
+		}
+		m[r.ID] = r
+	}
+	e.mu.Lock()
+	e.rules = m
+	e.mu.Unlock()
+	return nil
+}
+
+func (e *Engine) Rule(id string) (*Rule, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	r, ok := e.rules[id]
+	return r, ok
+}
+
+// IDs returns rule IDs with prefix in order.
+func (e *Engine) IDs(prefix string) []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	var a []string
+	for id := range e.rules {
+		if strings.HasPrefix(id, prefix) {
+			a = append(a, id)
+		}
+	}
+	sort.Strings(a)
+	return a
+}
+
+// Compile validates c and compiles its expressions.
+func (e *Engine) Compile(c *Condition) error {
+	if c == nil {
+		return errors.Wrap(ErrConditionInvalid, "empty condition")
+	}
+	kinds := 0
+	for _, ok := range []bool{c.All != nil, c.Any != nil, c.Not != nil,
+		c.Attr != "", c.Expr != ""} {
+		if ok {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return errors.Wrap(ErrConditionInvalid,
+			"condition needs exactly one of all, any, not, attr, expr")
+	}
+	switch {
+	case c.Not != nil:
+		return e.Compile(c.Not)
+	case c.Attr != "":
+		return checkOp(c)
+	case c.Expr != "":
+		p, err := a5gscript.Compile(c.Expr, e.Limits)
+		if err != nil {
+			return errors.Wrap(ErrConditionInvalid, err.Error())
+		}
+		c.program = p
+		return nil
+	}
+	for _, x := range append(c.All, c.Any...) {
+		if err := e.Compile(x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkOp(c *Condition) error {
+	switch c.Op {
+	case OpEq, OpNe, OpContains, OpExists:
+	case OpLt, OpLte, OpGt, OpGte:
+		if _, ok := number(c.Value); !ok {
+			return errors.Wrapf(ErrConditionInvalid, "%s %s needs a number", c.Attr, c.Op)
+		}
+	case OpIn:
+		if _, ok := c.Value.([]interface{}); !ok {
+			return errors.Wrapf(ErrConditionInvalid, "%s in needs a list", c.Attr)
+		}
+	case OpBetween:
+		a, ok := c.Value.([]interface{})
+		if ok = ok && len(a) == 2; ok {
+			_, x := number(a[0])
+			_, y := number(a[1])
+			ok = x && y
+		}
+		if !ok {
+			return errors.Wrapf(ErrConditionInvalid, "%s between needs [min, max]", c.Attr)
+		}
+	default:
+		return errors.Wrapf(ErrConditionInvalid, "%s: unknown op %q", c.Attr, c.Op)
+	}
+	return nil
+}
+
+// Trace explains an evaluation node by node for dry runs.
+type Trace struct {
+	Condition string      `json:"condition"`
+	Actual    interface{} `json:"actual,omitempty"`
+	Match     bool        `json:"match"`
+	Error     string      `json:"error,omitempty"`
+	Children  []*Trace    `json:"children,omitempty"`
+}
+
+// Evaluate tells whether facts match rule id.
+func (e *Engine) Evaluate(id string, facts Facts) (bool, error) {
+	r, ok := e.Rule(id)
+	if !ok {
+		return false, errors.Wrap(ErrRuleUnknown, id)
+	}
+	t := Explain(r.When, facts)
+	if t.Error != "" {
+		return false, errors.Errorf("rule %q: %s", id, t.Error)
+	}
+	return t.Match, nil
+}
+
+// Match loads facts of a player with Facts and evaluates rule id; offers
+// and quests take it as their rule func.
+func (e *Engine) Match(ctx context.Context, accountID uint64, id string) (bool, error) {
+	facts, err := e.Facts(ctx, accountID)
+	if err != nil {
+		return false, err
+	}
+	return e.Evaluate(id, facts)
+}
+
+// SegmentFunc makes rules with prefix, e.g. "segment:", segments of
+// players for a5gevents. Segments are named by rule ID without prefix.
+// Rules which fail to evaluate are logged and skipped.
+func (e *Engine) SegmentFunc(prefix string) a5gevents.SegmentFunc {
+	return func(ctx context.Context, playerID int64) ([]string, error) {
+		facts, err := e.Facts(ctx, uint64(playerID))
+		if err != nil {
+			return nil, err
+		}
+		var a []string
+		for _, id := range e.IDs(prefix) {
+			ok, err := e.Evaluate(id, facts)
+			if err != nil {
+				e.Logger.Error(err.Error())
+				continue
+			}
+			if ok {
+				a = append(a, strings.TrimPrefix(id, prefix))
+			}
+		}
+		return a, nil
+	}
+}
+
+// Explain evaluates a compiled condition and traces why it matched or
+// not. Errors, e.g. comparing a string with a number, fail the node and
+// are reported in its trace.
+func Explain(c *Condition, facts Facts) *Trace {
+	switch {
+	case c.All != nil || c.Any != nil:
+		return explainGroup(c, facts)
+	case c.Not != nil:
+		x := Explain(c.Not, facts)
+		return &Trace{Condition: "not", Match: x.Error == "" && !x.Match,
+			Error: x.Error, Children: []*Trace{x}}
+	case c.Expr != "":
+		t := &Trace{Condition: c.Expr}
+		var err error
+		if t.Match, err = c.program.Bool(map[string]interface{}(facts)); err != nil {
+			t.Error = err.Error()
+		}
+		return t
+	}
+	v, ok := facts[c.Attr]
+	t := &Trace{Condition: fmt.Sprintf("%s %s %v", c.Attr, c.Op, c.Value), Actual: v}
+	var err error
+	if t.Match, err = test(c, v, ok); err != nil {
+		t.Match, t.Error = false, err.Error()
+	}
+	return t
+}
+
+// explainGroup evaluates every child, so dry runs show all of them.
+func explainGroup(c *Condition, facts Facts) *Trace {
+	t := &Trace{Condition: "all", Match: true}
+	children := c.All
+	if c.Any != nil {
+		t.Condition, t.Match, children = "any", false, c.Any
+	}
+	for _, x := range children {
+		y := Explain(x, facts)
+		t.Children = append(t.Children, y)
+		if y.Error != "" && t.Error == "" {
+			t.Error = y.Error
+		}
+		if c.Any != nil {
+			t.Match = t.Match || y.Match
+		} else {
+			t.Match = t.Match && y.Match
+		}
+	}
+	if t.Error != "" {
+		t.Match = false
+	}
+	return t
+}
+
+func test(c *Condition, v interface{}, ok bool) (bool, error) {
+	switch c.Op {
+	case OpExists:
+		want, _ := c.Value.(bool)
+		return ok == (want || c.Value == nil), nil
+	case OpNe:
+		return !ok || !equal(v, c.Value), nil
+	}
+	if !ok {
+		return false, nil
+	}
+	switch c.Op {
+	case OpEq:
+		return equal(v, c.Value), nil
+	case OpIn:
+		return contains(c.Value, v), nil
+	case OpContains:
+		if s, ok := v.(string); ok {
+			t, _ := c.Value.(string)
+			return strings.Contains(s, t), nil
+		}
+		return contains(v, c.Value), nil
+	case OpBetween:
+		a, ok := c.Value.([]interface{})
+		if !ok || len(a) != 2 {
+			return false, errors.New("between needs [min, max]")
+		}
+		return compare(v, OpGte, a[0], OpLte, a[1])
+	}
+	return compare(v, c.Op, c.Value)
+}
+
+// compare tests v against pairs of op and value.
+func compare(v interface{}, pairs ...interface{}) (bool, error) {
+	x, ok := number(v)
+	if !ok {
+		return false, errors.Errorf("%v (%T) is not a number", v, v)
+	}
+	for i := 0; i < len(pairs); i += 2 {
+		y, _ := number(pairs[i+1])
+		var ok bool
+		switch pairs[i] {
+		case OpLt:
+			ok = x < y
+		case OpLte:
+			ok = x <= y
+		case OpGt:
+			ok = x > y
+		case OpGte:
+			ok = x >= y
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func equal(x, y interface{}) bool {
+	if a, ok := number(x); ok {
+		b, ok := number(y)
+		return ok && a == b
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+// contains tells whether list holds v.
+func contains(list, v interface{}) bool {
+	r := reflect.ValueOf(list)
+	if r.Kind() != reflect.Slice && r.Kind() != reflect.Array {
+		return false
+	}
+	for i := 0; i < r.Len(); i++ {
+		if equal(r.Index(i).Interface(), v) {
+			return true
+		}
+	}
+	return false
+}
+
+func number(v interface{}) (float64, bool) {
+	r := reflect.ValueOf(v)
+	switch r.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(r.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(r.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return r.Float(), true
+	}
+	return 0, false
+}
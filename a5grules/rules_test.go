@@ -0,0 +1,137 @@
+package a5grules
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const testRules = `[
+	{"id": "segment:lapsed_payer", "when": {"all": [
+		{"attr": "player.spend", "op": "gt", "value": 0},
+		{"attr": "player.daysAway", "op": "gte", "value": 14}]}},
+	{"id": "segment:eu", "when": {"attr": "player.country", "op": "in",
+		"value": ["de", "fr", "pl"]}},
+	{"id": "starter_offer", "when": {"all": [
+		{"attr": "player.level", "op": "between", "value": [3, 10]},
+		{"not": {"attr": "player.tags", "op": "contains", "value": "bought_starter"}},
+		{"any": [
+			{"attr": "ctx.platform", "op": "eq", "value": "android"},
+			{"expr": "player.level * 2 >= 18"}]}]}},
+	{"id": "guild_member", "when": {"attr": "player.guild", "op": "exists"}}]`
+
+func newTestEngine(t *testing.T, players map[uint64]Facts) *Engine {
+	rules, err := NewRulesJSON([]byte(testRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := NewEngine(rules, func(ctx context.Context, accountID uint64) (Facts, error) {
+		f, ok := players[accountID]
+		if !ok {
+			return nil, errors.New("player not found")
+		}
+		return f, nil
+	}, a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestEvaluate(t *testing.T) {
+	e := newTestEngine(t, nil)
+	var tests = []struct {
+		rule  string
+		facts Facts
+		match bool
+		err   bool
+	}{
+		{"starter_offer", Facts{"player.level": 5, "ctx.platform": "android",
+			"player.tags": []string{"tutorial_done"}}, true, false},
+		{"starter_offer", Facts{"player.level": int64(9), "ctx.platform": "ios"}, true, false},
+		{"starter_offer", Facts{"player.level": 5, "ctx.platform": "ios"}, false, false},
+		{"starter_offer", Facts{"player.level": 5, "ctx.platform": "android",
+			"player.tags": []string{"bought_starter"}}, false, false},
+		{"starter_offer", Facts{"player.level": 11, "ctx.platform": "android"}, false, false},
+		{"starter_offer", Facts{"player.level": "5", "ctx.platform": "android"}, false, true},
+		{"segment:lapsed_payer", Facts{"player.spend": uint64(499),
+			"player.daysAway": 30.0}, true, false},
+		{"segment:lapsed_payer", Facts{"player.daysAway": 30}, false, false},
+		{"guild_member", Facts{"player.guild": "wolves"}, true, false},
+		{"guild_member", Facts{}, false, false},
+	}
+	for i, test := range tests {
+		match, err := e.Evaluate(test.rule, test.facts)
+		if (err != nil) != test.err || match != test.match {
+			t.Errorf("%d: Evaluate(%q) => %v, %v want %v", i, test.rule, match, err, test.match)
+		}
+	}
+	if _, err := e.Evaluate("missing", Facts{}); errors.Cause(err) != ErrRuleUnknown {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestReplaceInvalid(t *testing.T) {
+	e := newTestEngine(t, nil)
+	var tests = []string{
+		`[{"id": "a", "when": {}}]`,
+		`[{"id": "a"}]`,
+		`[{"id": "a", "when": {"attr": "x", "op": "like", "value": 1}}]`,
+		`[{"id": "a", "when": {"attr": "x", "op": "gt", "value": "1"}}]`,
+		`[{"id": "a", "when": {"attr": "x", "op": "between", "value": [1]}}]`,
+		`[{"id": "a", "when": {"attr": "x", "op": "eq", "value": 1, "expr": "true"}}]`,
+		`[{"id": "a", "when": {"any": [{"expr": "player.level >"}]}}]`,
+		`[{"id": "a", "when": {"expr": "true"}}, {"id": "a", "when": {"expr": "true"}}]`,
+	}
+	for _, test := range tests {
+		rules, err := NewRulesJSON([]byte(test))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = e.Replace(rules); err == nil {
+			t.Errorf("Replace(%s) => <nil> want error", test)
+		}
+	}
+	if _, ok := e.Rule("starter_offer"); !ok {
+		t.Error("failed Replace dropped the previous rules")
+	}
+}
+
+func TestSegmentsAndDryRun(t *testing.T) {
+	e := newTestEngine(t, map[uint64]Facts{
+		7: {"player.spend": 100, "player.daysAway": 20, "player.country": "de",
+			"player.level": 4}})
+	segments, err := e.SegmentFunc("segment:")(context.Background(), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"eu", "lapsed_payer"}; !reflect.DeepEqual(segments, want) {
+		t.Errorf("segments => %q want %q", segments, want)
+	}
+
+	res, err := e.DryRun(context.Background(), &DryRunRequest{
+		RuleID: "starter_offer", AccountID: 7, Facts: Facts{"ctx.platform": "ios"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Match || len(res.Trace.Children) != 3 || !res.Trace.Children[0].Match ||
+		!res.Trace.Children[1].Match || res.Trace.Children[2].Match ||
+		len(res.Trace.Children[2].Children) != 2 {
+		t.Errorf("unexpected dry run %+v", res.Trace)
+	}
+
+	res, err = e.DryRun(context.Background(), &DryRunRequest{
+		When:  &Condition{Attr: "player.level", Op: OpLt, Value: 10.0},
+		Facts: Facts{"player.level": 4}})
+	if err != nil || !res.Match {
+		t.Errorf("unexpected draft dry run %+v %v", res, err)
+	}
+	_, err = e.DryRun(context.Background(), &DryRunRequest{When: &Condition{}})
+	if errors.Cause(err) != ErrConditionInvalid {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,435 @@
+package a5gscript
+
+import (
+	"math"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// Values of scripts are float64, string, bool or []interface{} of them.
+type node interface {
+	eval(e *env) (interface{}, error)
+}
+
+type env struct {
+	vars  map[string]interface{}
+	steps int
+	limit int
+}
+
+func (e *env) step() error {
+	e.steps++
+	if e.steps > e.limit {
+		return errors.Wrapf(ErrLimit, "over %d steps", e.limit)
+	}
+	return nil
+}
+
+type (
+	constNode struct {
+		v interface{}
+	}
+	varNode struct {
+		name string
+	}
+	unaryNode struct {
+		op string
+		x  node
+	}
+	binaryNode struct {
+		op   string
+		l, r node
+	}
+	condNode struct {
+		c, a, b node
+	}
+	callNode struct {
+		name string
+		fn   func(args []interface{}) (interface{}, error)
+		args []node
+	}
+	listNode struct {
+		items []node
+	}
+)
+
+func (n *constNode) eval(e *env) (interface{}, error) {
+	return n.v, e.step()
+}
+
+func (n *varNode) eval(e *env) (interface{}, error) {
+	if err := e.step(); err != nil {
+		return nil, err
+	}
+	v, ok := e.vars[n.name]
+	if !ok {
+		return nil, errors.Wrapf(ErrEval, "undefined %q", n.name)
+	}
+	return value(n.name, v)
+}
+
+// value converts Go values of variables into script values.
+func value(name string, v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case float64, string, bool:
+		return x, nil
+	case nil:
+		return nil, errors.Wrapf(ErrEval, "%q is nil", name)
+	}
+	r := reflect.ValueOf(v)
+	switch r.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(r.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(r.Uint()), nil
+	case reflect.Float32:
+		return r.Float(), nil
+	case reflect.String:
+		return r.String(), nil
+	case reflect.Bool:
+		return r.Bool(), nil
+	case reflect.Slice, reflect.Array:
+		a := make([]interface{}, r.Len())
+		for i := range a {
+			x, err := value(name, r.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			a[i] = x
+		}
+		return a, nil
+	}
+	return nil, errors.Wrapf(ErrEval, "%q of unsupported type %T", name, v)
+}
+
+func (n *unaryNode) eval(e *env) (interface{}, error) {
+	if err := e.step(); err != nil {
+		return nil, err
+	}
+	v, err := n.x.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		b, err := toBool(v)
+		return !b, err
+	}
+	f, err := toFloat(v)
+	return -f, err
+}
+
+func (n *binaryNode) eval(e *env) (interface{}, error) {
+	if err := e.step(); err != nil {
+		return nil, err
+	}
+	l, err := n.l.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "&&" || n.op == "||" {
+		return n.logic(e, l)
+	}
+	r, err := n.r.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return equal(l, r), nil
+	case "!=":
+		return !equal(l, r), nil
+	case "in":
+		return in(l, r)
+	case "+":
+		if s, ok := l.(string); ok {
+			t, ok := r.(string)
+			if !ok {
+				return nil, errors.Wrapf(ErrEval, "string + %T", r)
+			}
+			return s + t, nil
+		}
+	}
+	return arith(n.op, l, r)
+}
+
+// logic short-circuits && and || so guards like "n > 0 && x / n > 2" work.
+func (n *binaryNode) logic(e *env, l interface{}) (interface{}, error) {
+	b, err := toBool(l)
+	if err != nil {
+		return nil, err
+	}
+	if b == (n.op == "||") {
+		return b, nil
+	}
+	r, err := n.r.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	return toBool(r)
+}
+
+func arith(op string, l, r interface{}) (interface{}, error) {
+	if s, ok := l.(string); ok {
+		if t, ok := r.(string); ok {
+			return compare(op, stringCmp(s, t))
+		}
+	}
+	x, err := toFloat(l)
+	if err != nil {
+		return nil, err
+	}
+	y, err := toFloat(r)
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/", "%":
+		if y == 0 {
+			return nil, errors.Wrap(ErrEval, "division by zero")
+		}
+		if op == "%" {
+			return math.Mod(x, y), nil
+		}
+		return x / y, nil
+	}
+	switch {
+	case x < y:
+		return compare(op, -1)
+	case x > y:
+		return compare(op, 1)
+	}
+	return compare(op, 0)
+}
+
+func stringCmp(s, t string) int {
+	switch {
+	case s < t:
+		return -1
+	case s > t:
+		return 1
+	}
+	return 0
+}
+
+func compare(op string, c int) (interface{}, error) {
+	switch op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	case ">=":
+		return c >= 0, nil
+	}
+	return nil, errors.Wrapf(ErrEval, "%q on strings", op)
+}
+
+func equal(l, r interface{}) bool {
+	if a, ok := l.([]interface{}); ok {
+		b, ok := r.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	if _, ok := r.([]interface{}); ok {
+		return false
+	}
+	return l == r
+}
+
+func in(l, r interface{}) (interface{}, error) {
+	a, ok := r.([]interface{})
+	if !ok {
+		return nil, errors.Wrapf(ErrEval, "in %T", r)
+	}
+	for _, x := range a {
+		if equal(l, x) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (n *condNode) eval(e *env) (interface{}, error) {
+	if err := e.step(); err != nil {
+		return nil, err
+	}
+	c, err := n.c.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	b, err := toBool(c)
+	if err != nil {
+		return nil, err
+	}
+	if b {
+		return n.a.eval(e)
+	}
+	return n.b.eval(e)
+}
+
+func (n *callNode) eval(e *env) (interface{}, error) {
+	if err := e.step(); err != nil {
+		return nil, err
+	}
+	args := make([]interface{}, len(n.args))
+	for i, x := range n.args {
+		v, err := x.eval(e)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	v, err := n.fn(args)
+	if err != nil {
+		return nil, errors.Wrap(err, n.name)
+	}
+	return v, nil
+}
+
+func (n *listNode) eval(e *env) (interface{}, error) {
+	if err := e.step(); err != nil {
+		return nil, err
+	}
+	a := make([]interface{}, len(n.items))
+	for i, x := range n.items {
+		v, err := x.eval(e)
+		if err != nil {
+			return nil, err
+		}
+		a[i] = v
+	}
+	return a, nil
+}
+
+func toFloat(v interface{}) (float64, error) {
+	f, ok := v.(float64)
+	if !ok {
+		return 0, errors.Wrapf(ErrEval, "%T is not a number", v)
+	}
+	return f, nil
+}
+
+func toBool(v interface{}) (bool, error) {
+	b, ok := v.(bool)
+	if !ok {
+		return false, errors.Wrapf(ErrEval, "%T is not a bool", v)
+	}
+	return b, nil
+}
+
+type function struct {
+	min, max int
+	fn       func(args []interface{}) (interface{}, error)
+}
+
+// functions is all scripts may call; max -1 is variadic.
+var functions = map[string]function{
+	"min":      {1, -1, fold(math.Min)},
+	"max":      {1, -1, fold(math.Max)},
+	"abs":      {1, 1, unary(math.Abs)},
+	"floor":    {1, 1, unary(math.Floor)},
+	"ceil":     {1, 1, unary(math.Ceil)},
+	"round":    {1, 1, unary(round)},
+	"clamp":    {3, 3, clamp},
+	"contains": {2, 2, func(a []interface{}) (interface{}, error) { return in(a[1], a[0]) }},
+	"len":      {1, 1, length},
+}
+
+func fold(fn func(x, y float64) float64) func([]interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		v, err := toFloat(args[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, x := range args[1:] {
+			f, err := toFloat(x)
+			if err != nil {
+				return nil, err
+			}
+			v = fn(v, f)
+		}
+		return v, nil
+	}
+}
+
+func unary(fn func(float64) float64) func([]interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		f, err := toFloat(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return fn(f), nil
+	}
+}
+
+// round rounds half away from zero, math.Round is not in Go 1.8.
+func round(f float64) float64 {
+	if f < 0 {
+		return -math.Floor(-f + 0.5)
+	}
+	return math.Floor(f + 0.5)
+}
+
+func clamp(args []interface{}) (interface{}, error) {
+	var f [3]float64
+	for i := range f {
+		var err error
+		if f[i], err = toFloat(args[i]); err != nil {
+			return nil, err
+		}
+	}
+	return math.Max(f[1], math.Min(f[2], f[0])), nil
+}
+
+func length(args []interface{}) (interface{}, error) {
+	switch x := args[0].(type) {
+	case string:
+		return float64(len(x)), nil
+	case []interface{}:
+		return float64(len(x)), nil
+	}
+	return nil, errors.Wrapf(ErrEval, "len of %T", args[0])
+}
+
+// Eval runs the program with variables vars; numeric variables of any Go
+// type are float64 in scripts.
+func (p *Program) Eval(vars map[string]interface{}) (interface{}, error) {
+	return p.root.eval(&env{vars: vars, limit: p.limits.Steps})
+}
+
+// Float evaluates a formula, e.g. a reward amount.
+func (p *Program) Float(vars map[string]interface{}) (float64, error) {
+	v, err := p.Eval(vars)
+	if err != nil {
+		return 0, err
+	}
+	f, err := toFloat(v)
+	if err == nil && (math.IsNaN(f) || math.IsInf(f, 0)) {
+		err = errors.Wrap(ErrEval, "not a finite number")
+	}
+	return f, err
+}
+
+// Bool evaluates a condition, e.g. of offer eligibility.
+func (p *Program) Bool(vars map[string]interface{}) (bool, error) {
+	v, err := p.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+	return toBool(v)
+}
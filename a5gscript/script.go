@@ -0,0 +1,359 @@
+// Package a5gscript is a sandboxed expression language for designer
+// editable logic: reward formulas, event conditions, offer eligibility.
+//
+// Expressions have numbers, strings, booleans and lists, variables
+// (dotted names like player.level), arithmetic + - * / %, comparisons,
+// && || !, "x in [a, b]", "c ? a : b" and a fixed set of functions.
+// There are no loops, assignments or I/O, and Limits bound the source,
+// the syntax tree and every evaluation.
+package a5gscript
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrSyntax = errors.New("script syntax error")
+	ErrLimit  = errors.New("script limit exceeded")
+	ErrEval   = errors.New("script evaluation error")
+)
+
+// Limits bound what a script may cost. Steps is per evaluation.
+type Limits struct {
+	Length int
+	Nodes  int
+	Depth  int
+	Steps  int
+}
+
+// DefaultLimits fit formulas and conditions designers write by hand.
+var DefaultLimits = Limits{Length: 4096, Nodes: 512, Depth: 32, Steps: 2048}
+
+const (
+	tokEOF = iota
+	tokNum
+	tokStr
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind int
+	text string
+	num  float64
+	pos  int
+}
+
+var ops = []string{"==", "!=", "<=", ">=", "&&", "||",
+	"(", ")", "[", "]", ",", "?", ":", "+", "-", "*", "/", "%", "!", "<", ">"}
+
+func lex(src string) ([]token, error) {
+	var a []token
+	for i := 0; i < len(src); {
+		r, n := utf8.DecodeRuneInString(src[i:])
+		var (
+			t   token
+			err error
+		)
+		switch {
+		case unicode.IsSpace(r):
+			i += n
+			continue
+		case r >= '0' && r <= '9' || r == '.':
+			t, n, err = lexNum(src, i)
+		case r == '"' || r == '\'':
+			t, n, err = lexStr(src, i, byte(r))
+		case r == '_' || unicode.IsLetter(r):
+			t, n = lexIdent(src, i)
+		default:
+			t, n, err = lexOp(src, i)
+		}
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, t)
+		i += n
+	}
+	return append(a, token{kind: tokEOF, pos: len(src)}), nil
+}
+
+func lexNum(src string, i int) (token, int, error) {
+	j := i
+	for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.') {
+		j++
+	}
+	v, err := strconv.ParseFloat(src[i:j], 64)
+	if err != nil {
+		return token{}, 0, errors.Wrapf(ErrSyntax, "number %q at %d", src[i:j], i)
+	}
+	return token{kind: tokNum, text: src[i:j], num: v, pos: i}, j - i, nil
+}
+
+func lexStr(src string, i int, quote byte) (token, int, error) {
+	var b bytes.Buffer
+	for j := i + 1; j < len(src); j++ {
+		switch c := src[j]; {
+		case c == quote:
+			return token{kind: tokStr, text: b.String(), pos: i}, j + 1 - i, nil
+		case c == '\\' && j+1 < len(src):
+			j++
+			if src[j] == 'n' {
+				b.WriteByte('\n')
+			} else {
+				b.WriteByte(src[j])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return token{}, 0, errors.Wrapf(ErrSyntax, "unterminated string at %d", i)
+}
+
+func lexIdent(src string, i int) (token, int) {
+	j := i
+	for j < len(src) {
+		r, n := utf8.DecodeRuneInString(src[j:])
+		if r != '_' && r != '.' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			break
+		}
+		j += n
+	}
+	return token{kind: tokIdent, text: src[i:j], pos: i}, j - i
+}
+
+func lexOp(src string, i int) (token, int, error) {
+	for _, op := range ops {
+		if strings.HasPrefix(src[i:], op) {
+			return token{kind: tokOp, text: op, pos: i}, len(op), nil
+		}
+	}
+	return token{}, 0, errors.Wrapf(ErrSyntax, "unexpected %q at %d", src[i:i+1], i)
+}
+
+// Binary operator precedences, higher binds tighter.
+var precedence = map[string]int{
+	"||": 1, "&&": 2,
+	"==": 3, "!=": 3,
+	"<": 4, "<=": 4, ">": 4, ">=": 4, "in": 4,
+	"+": 5, "-": 5,
+	"*": 6, "/": 6, "%": 6,
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	nodes  int
+	limits Limits
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) is(text string) bool {
+	t := p.peek()
+	return (t.kind == tokOp || t.kind == tokIdent) && t.text == text
+}
+
+func (p *parser) expect(text string) error {
+	if t := p.next(); !(t.kind == tokOp && t.text == text) {
+		return errors.Wrapf(ErrSyntax, "expected %q at %d", text, t.pos)
+	}
+	return nil
+}
+
+func (p *parser) node(depth int) error {
+	p.nodes++
+	if p.nodes > p.limits.Nodes {
+		return errors.Wrapf(ErrLimit, "over %d nodes", p.limits.Nodes)
+	}
+	if depth > p.limits.Depth {
+		return errors.Wrapf(ErrLimit, "over %d levels", p.limits.Depth)
+	}
+	return nil
+}
+
+// expr parses a ternary expression.
+func (p *parser) expr(depth int) (node, error) {
+	c, err := p.binary(depth, 1)
+	if err != nil || !p.is("?") {
+		return c, err
+	}
+	p.next()
+	if err = p.node(depth); err != nil {
+		return nil, err
+	}
+	a, err := p.expr(depth + 1)
+	if err != nil {
+		return nil, err
+	}
+	if err = p.expect(":"); err != nil {
+		return nil, err
+	}
+	b, err := p.expr(depth + 1)
+	if err != nil {
+		return nil, err
+	}
+	return &condNode{c: c, a: a, b: b}, nil
+}
+
+func (p *parser) binary(depth, min int) (node, error) {
+	l, err := p.unary(depth)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		prec, ok := precedence[t.text]
+		if !ok || t.kind != tokOp && t.text != "in" || prec < min {
+			return l, nil
+		}
+		p.next()
+		if err = p.node(depth); err != nil {
+			return nil, err
+		}
+		r, err := p.binary(depth+1, prec+1)
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryNode{op: t.text, l: l, r: r}
+	}
+}
+
+func (p *parser) unary(depth int) (node, error) {
+	if !p.is("!") && !p.is("-") {
+		return p.primary(depth)
+	}
+	op := p.next().text
+	if err := p.node(depth); err != nil {
+		return nil, err
+	}
+	x, err := p.unary(depth + 1)
+	if err != nil {
+		return nil, err
+	}
+	return &unaryNode{op: op, x: x}, nil
+}
+
+func (p *parser) primary(depth int) (node, error) {
+	if err := p.node(depth); err != nil {
+		return nil, err
+	}
+	t := p.next()
+	switch {
+	case t.kind == tokNum:
+		return &constNode{v: t.num}, nil
+	case t.kind == tokStr:
+		return &constNode{v: t.text}, nil
+	case t.kind == tokIdent && (t.text == "true" || t.text == "false"):
+		return &constNode{v: t.text == "true"}, nil
+	case t.kind == tokIdent && p.is("("):
+		return p.call(depth, t)
+	case t.kind == tokIdent && t.text != "in":
+		return &varNode{name: t.text}, nil
+	case t.kind == tokOp && t.text == "(":
+		x, err := p.expr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return x, p.expect(")")
+	case t.kind == tokOp && t.text == "[":
+		items, err := p.list(depth, "]")
+		if err != nil {
+			return nil, err
+		}
+		return &listNode{items: items}, nil
+	}
+	if t.kind == tokEOF {
+		return nil, errors.Wrap(ErrSyntax, "unexpected end")
+	}
+	return nil, errors.Wrapf(ErrSyntax, "unexpected %q at %d", t.text, t.pos)
+}
+
+func (p *parser) call(depth int, t token) (node, error) {
+	fn, ok := functions[t.text]
+	if !ok {
+		return nil, errors.Wrapf(ErrSyntax, "unknown function %q at %d", t.text, t.pos)
+	}
+	p.next()
+	args, err := p.list(depth, ")")
+	if err != nil {
+		return nil, err
+	}
+	if len(args) < fn.min || fn.max >= 0 && len(args) > fn.max {
+		return nil, errors.Wrapf(ErrSyntax, "%s: %d arguments at %d", t.text, len(args), t.pos)
+	}
+	return &callNode{name: t.text, fn: fn.fn, args: args}, nil
+}
+
+// list parses comma separated expressions up to end.
+func (p *parser) list(depth int, end string) ([]node, error) {
+	var a []node
+	for !p.is(end) {
+		if len(a) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		x, err := p.expr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, x)
+	}
+	p.next()
+	return a, nil
+}
+
+// Program is a compiled script, safe for concurrent use.
+type Program struct {
+	Source string
+
+	root   node
+	limits Limits
+}
+
+// Compile parses src within limits, zero limits take DefaultLimits.
+func Compile(src string, limits Limits) (*Program, error) {
+	if limits == (Limits{}) {
+		limits = DefaultLimits
+	}
+	if len(src) > limits.Length {
+		return nil, errors.Wrapf(ErrLimit, "over %d bytes", limits.Length)
+	}
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, limits: limits}
+	root, err := p.expr(0)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, errors.Wrapf(ErrSyntax, "unexpected %q at %d", t.text, t.pos)
+	}
+	return &Program{Source: src, root: root, limits: limits}, nil
+}
+
+// MustCompile is Compile with DefaultLimits panicking on errors, for
+// scripts in code.
+func MustCompile(src string) *Program {
+	p, err := Compile(src, Limits{})
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
@@ -0,0 +1,158 @@
+package a5gscript
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestEval(t *testing.T) {
+	vars := map[string]interface{}{
+		"player.level": 12,
+		"player.tier":  "gold",
+		"player.tags":  []string{"whale", "eu"},
+		"event.streak": uint8(3),
+		"spent":        0,
+	}
+	var tests = []struct {
+		src  string
+		want interface{}
+		err  error
+	}{
+		{"100 + player.level * 10", 220.0, nil},
+		{"(1 + 2) * 3 - 4 / 2", 7.0, nil},
+		{"-2 * -3 % 4", 2.0, nil},
+		{"min(player.level, 10) + max(1, 2, 3)", 13.0, nil},
+		{"clamp(event.streak * 50, 100, 120)", 120.0, nil},
+		{"round(2.5) + round(-2.5) + floor(1.9) + ceil(1.1) + abs(-1)", 4.0, nil},
+		{"player.level >= 10 && player.tier in ['gold', 'platinum']", true, nil},
+		{"contains(player.tags, 'whale') && !contains(player.tags, 'us')", true, nil},
+		{"spent > 0 && 100 / spent > 1", false, nil},
+		{"spent == 0 || 100 / spent > 1", true, nil},
+		{"player.level > 20 ? 'veteran' : 'player.' + player.tier", "player.gold", nil},
+		{"len(player.tags) == 2 && [1, 2] == [1, 2] && 'a' < 'b'", true, nil},
+		{"100 / spent", nil, ErrEval},
+		{"player.missing + 1", nil, ErrEval},
+		{"player.tier + 1", nil, ErrEval},
+		{"1 && true", nil, ErrEval},
+		{"'a' - 'b'", nil, ErrEval},
+	}
+	for _, test := range tests {
+		p, err := Compile(test.src, Limits{})
+		if err != nil {
+			t.Errorf("Compile(%q) => %v", test.src, err)
+			continue
+		}
+		v, err := p.Eval(vars)
+		if errors.Cause(err) != test.err {
+			t.Errorf("Eval(%q) => error %v want %v", test.src, err, test.err)
+			continue
+		}
+		if test.err == nil && v != test.want {
+			t.Errorf("Eval(%q) => %v want %v", test.src, v, test.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	var tests = []struct {
+		src    string
+		limits Limits
+		err    error
+	}{
+		{"1 +", Limits{}, ErrSyntax},
+		{"(1 + 2", Limits{}, ErrSyntax},
+		{"1 2", Limits{}, ErrSyntax},
+		{"'open", Limits{}, ErrSyntax},
+		{"os.exit(1)", Limits{}, ErrSyntax},
+		{"clamp(1, 2)", Limits{}, ErrSyntax},
+		{"a = 1", Limits{}, ErrSyntax},
+		{strings.Repeat("1 + ", 10) + "1", Limits{Length: 10, Nodes: 100, Depth: 100}, ErrLimit},
+		{strings.Repeat("1 + ", 10) + "1", Limits{Length: 100, Nodes: 10, Depth: 100}, ErrLimit},
+		{strings.Repeat("(", 10) + "1" + strings.Repeat(")", 10),
+			Limits{Length: 100, Nodes: 100, Depth: 5}, ErrLimit},
+	}
+	for _, test := range tests {
+		if _, err := Compile(test.src, test.limits); errors.Cause(err) != test.err {
+			t.Errorf("Compile(%q) => %v want %v", test.src, err, test.err)
+		}
+	}
+
+	p, err := Compile("max(1, 2, 3, 4, 5, 6)", Limits{Length: 100, Nodes: 100, Depth: 10, Steps: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.Float(nil); errors.Cause(err) != ErrLimit {
+		t.Errorf("Float() => %v want %v", err, ErrLimit)
+	}
+}
+
+func TestScripts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "a5gscript")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+	write := func(name, src string, modTime time.Time) {
+		name = filepath.Join(dir, name)
+		if err := ioutil.WriteFile(name, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Now().Add(-time.Hour)
+	write("daily_reward.a5gs", "100 + streak * 10", start)
+	write("notes.txt", "not a script", start)
+
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	s, err := NewScripts(dir, Limits{}, a5glogs.NewLogrusWrapper(l))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reward := func() float64 {
+		f, err := s.Get("daily_reward").Float(map[string]interface{}{"streak": 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	if f := reward(); f != 120 {
+		t.Errorf("daily_reward => %v want 120", f)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Watch(ctx, 5*time.Millisecond)
+
+	write("daily_reward.a5gs", "100 + streak *", start.Add(time.Minute))
+	time.Sleep(50 * time.Millisecond)
+	if f := reward(); f != 120 {
+		t.Errorf("daily_reward after broken edit => %v want 120", f)
+	}
+	write("daily_reward.a5gs", "100 + streak * 20", start.Add(2*time.Minute))
+	write("vip_offer.a5gs", "level >= 10", start.Add(2*time.Minute))
+	for i := 0; i < 100 && s.Get("vip_offer") == nil; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if f := reward(); f != 140 {
+		t.Errorf("daily_reward after reload => %v want 140", f)
+	}
+	if s.Get("notes") != nil {
+		t.Error("notes.txt loaded as a script")
+	}
+}
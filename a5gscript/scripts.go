@@ -0,0 +1,143 @@
+package a5gscript
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+// Ext is the extension of script files, the rest of a file name is the
+// script name.
+const Ext = ".a5gs"
+
+// Scripts keeps compiled scripts of a directory, re-reading it when files
+// change on disk so designers can edit formulas without a deploy.
+type Scripts struct {
+	Dir    string
+	Limits Limits
+	Logger a5glogs.Logger
+
+	mu       sync.RWMutex
+	programs map[string]*Program
+	modTime  time.Time
+	count    int
+}
+
+func NewScripts(dir string, limits Limits, l a5glogs.Logger) (*Scripts, error) {
+	if dir == "" {
+		return nil, errors.New("empty scripts dir")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	s := &Scripts{Dir: dir, Limits: limits, Logger: l}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get returns the script name, nil when there is none.
+func (s *Scripts) Get(name string) *Program {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.programs[name]
+}
+
+// Reload compiles every script of Dir. Scripts are swapped all at once
+// and only when all of them compile, a broken edit keeps the previous set.
+func (s *Scripts) Reload() error {
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+	programs := make(map[string]*Program, len(files))
+	var modTime time.Time
+	for _, fileInfo := range files {
+		b, err := ioutil.ReadFile(filepath.Join(s.Dir, fileInfo.Name()))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		p, err := Compile(string(b), s.Limits)
+		if err != nil {
+			return errors.Wrapf(err, "script %q", fileInfo.Name())
+		}
+		programs[strings.TrimSuffix(fileInfo.Name(), Ext)] = p
+		if fileInfo.ModTime().After(modTime) {
+			modTime = fileInfo.ModTime()
+		}
+	}
+	s.mu.Lock()
+	s.programs = programs
+	s.modTime = modTime
+	s.count = len(files)
+	s.mu.Unlock()
+	return nil
+}
+
+// Watch polls the directory each interval and reloads scripts until ctx
+// is done. Failed reloads keep the previous scripts.
+func (s *Scripts) Watch(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		changed, err := s.changed()
+		if err != nil {
+			s.Logger.Error(err.Error())
+			continue
+		}
+		if !changed {
+			continue
+		}
+		if err = s.Reload(); err != nil {
+			s.Logger.Error(err.Error())
+			continue
+		}
+		s.Logger.Info("scripts reloaded")
+	}
+}
+
+// changed reports edits, new and removed files.
+func (s *Scripts) changed() (bool, error) {
+	files, err := s.files()
+	if err != nil {
+		return false, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(files) != s.count {
+		return true, nil
+	}
+	for _, fileInfo := range files {
+		if fileInfo.ModTime().After(s.modTime) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *Scripts) files() ([]os.FileInfo, error) {
+	a, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	files := a[:0]
+	for _, fileInfo := range a {
+		if !fileInfo.IsDir() && strings.HasSuffix(fileInfo.Name(), Ext) {
+			files = append(files, fileInfo)
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,75 @@
+package a5gseason
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/pkg/errors"
+)
+
+var ErrCodeRolloverUnknown = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+	Code:     4055,
+	Name:     "season_rollover_unknown",
+	Severity: a5gapi.ErrSeverityWarn,
+	Public:   true,
+	Message:  "season rollover not found"})
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeRolloverUnknown, http.StatusNotFound)
+}
+
+type RolloverRequest struct {
+	Season string `json:"season" validate:"required"`
+}
+
+// StartResponse carries the ID of the enqueued rollover job.
+type StartResponse struct {
+	JobID int64 `json:"jobId"`
+}
+
+// RolloverHandler answers with the progress of closing a season, mount
+// it on an admin route class.
+func (p *Pipeline) RolloverHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(RolloverRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			r, err := p.Rollover(req.Payload.(*RolloverRequest).Season)
+			if err != nil {
+				return nil, p.apiErrs(err)
+			}
+			return r, nil
+		})
+}
+
+// StartHandler enqueues the rollover of a season into Jobs, also to
+// resume a failed one, mount it on an admin route class.
+func (p *Pipeline) StartHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(RolloverRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			if p.Jobs == nil {
+				return nil, p.apiErrs(errors.New("season rollover jobs missing"))
+			}
+			j, err := NewJob(req.Payload.(*RolloverRequest).Season, 5)
+			if err != nil {
+				return nil, p.apiErrs(err)
+			}
+			if err = p.Jobs.Enqueue(j); err != nil {
+				return nil, p.apiErrs(err)
+			}
+			return &StartResponse{JobID: j.ID}, nil
+		})
+}
+
+func (p *Pipeline) apiErrs(err error) []*a5gapi.APIErr {
+	if errors.Cause(err) == ErrRolloverUnknown {
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeRolloverUnknown, "")}
+	}
+	p.Logger.Error(err.Error())
+	return a5gapi.NewJSONMsgDefautlErrors(err)
+}
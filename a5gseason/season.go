@@ -0,0 +1,261 @@
+package a5gseason
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/armor5games/a5g/a5gjobs"
+	"github.com/armor5games/a5g/a5gleaderboard"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gpayout"
+	"github.com/pkg/errors"
+)
+
+// JobKind is the a5gjobs kind of rollovers, see Pipeline.JobHandler.
+const JobKind = "season_rollover"
+
+var (
+	ErrRolloverUnknown = errors.New("season rollover unknown")
+	// ErrRolloverBusy is returned when another runner stored progress of
+	// the same rollover first.
+	ErrRolloverBusy = errors.New("season rollover busy")
+	// ErrSeasonOpen is returned by FreezeStep while the season still
+	// takes scores.
+	ErrSeasonOpen = errors.New("season still open")
+)
+
+// Statuses of rollovers and their steps.
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+// StepFunc runs a step for the season being closed. Steps are run again
+// after a failure or a crash, so they must be idempotent.
+type StepFunc func(ctx context.Context, season string) error
+
+// Step is a named stage of the pipeline, e.g. "freeze", "payout",
+// "archive", "reset" and "open".
+type Step struct {
+	Name string
+	Run  StepFunc
+}
+
+// StepState is the progress of a step, times in unix seconds.
+type StepState struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	Attempts  int    `json:"attempts"`
+	LastErr   string `json:"lastError,omitempty"`
+	StartedAt int64  `json:"startedAt,omitempty"`
+	DoneAt    int64  `json:"doneAt,omitempty"`
+}
+
+// Rollover is the progress of closing a season.
+type Rollover struct {
+	Season  string       `json:"season"`
+	Status  string       `json:"status"`
+	Steps   []*StepState `json:"steps"`
+	Version int64        `json:"version"`
+}
+
+func (r *Rollover) clone() *Rollover {
+	x := *r
+	x.Steps = make([]*StepState, len(r.Steps))
+	for i, s := range r.Steps {
+		y := *s
+		x.Steps[i] = &y
+	}
+	return &x
+}
+
+// Store keeps rollovers. Update stores next if the stored rollover still
+// has the version of prev, nil prev means none is stored yet.
+type Store interface {
+	Get(season string) (*Rollover, error)
+	Update(season string, prev, next *Rollover) (bool, error)
+}
+
+// Pipeline closes seasons by running Steps in order. A failed rollover
+// resumes from its failed step when run again; run it through a5gjobs, so
+// failures are retried with backoff and a single worker runs it.
+type Pipeline struct {
+	Steps  []*Step
+	Store  Store
+	Logger a5glogs.Logger
+	// Jobs, when set, lets StartHandler enqueue rollovers.
+	Jobs a5gjobs.Storer
+
+	now func() time.Time
+}
+
+func NewPipeline(steps []*Step, s Store, l a5glogs.Logger) (*Pipeline, error) {
+	if len(steps) == 0 {
+		return nil, errors.New("no season rollover steps")
+	}
+	names := make(map[string]bool, len(steps))
+	for _, x := range steps {
+		if x == nil || x.Name == "" || x.Run == nil {
+			return nil, errors.New("invalid season rollover step")
+		}
+		if names[x.Name] {
+			return nil, errors.Errorf("duplicate season rollover step %q", x.Name)
+		}
+		names[x.Name] = true
+	}
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Pipeline{Steps: steps, Store: s, Logger: l, now: time.Now}, nil
+}
+
+// Run closes season or resumes closing it and returns its progress.
+func (p *Pipeline) Run(ctx context.Context, season string) (*Rollover, error) {
+	if season == "" {
+		return nil, errors.New("empty season")
+	}
+	r, err := p.Store.Get(season)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		next := &Rollover{Season: season, Status: StatusPending, Version: 1}
+		for _, x := range p.Steps {
+			next.Steps = append(next.Steps,
+				&StepState{Name: x.Name, Status: StatusPending})
+		}
+		if r, err = p.save(season, nil, next); err != nil {
+			return nil, err
+		}
+	}
+	for i, x := range p.Steps {
+		if i >= len(r.Steps) || r.Steps[i].Name != x.Name {
+			return r, errors.Errorf(
+				"season %q rollover steps changed at %q", season, x.Name)
+		}
+		if r.Steps[i].Status == StatusDone {
+			continue
+		}
+		if r, err = p.step(ctx, r, i, x); err != nil {
+			return r, err
+		}
+	}
+	if r.Status != StatusDone {
+		next := r.clone()
+		next.Status = StatusDone
+		return p.save(season, r, next)
+	}
+	return r, nil
+}
+
+func (p *Pipeline) step(
+	ctx context.Context, r *Rollover, i int, x *Step) (*Rollover, error) {
+	next := r.clone()
+	next.Status = StatusRunning
+	s := next.Steps[i]
+	s.Status, s.StartedAt = StatusRunning, p.now().Unix()
+	s.Attempts++
+	r, err := p.save(r.Season, r, next)
+	if err != nil {
+		return nil, err
+	}
+	runErr := x.Run(ctx, r.Season)
+	next = r.clone()
+	s = next.Steps[i]
+	if runErr != nil {
+		next.Status = StatusFailed
+		s.Status, s.LastErr = StatusFailed, runErr.Error()
+	} else {
+		s.Status, s.LastErr, s.DoneAt = StatusDone, "", p.now().Unix()
+	}
+	if r, err = p.save(r.Season, r, next); err != nil {
+		return nil, err
+	}
+	if runErr != nil {
+		return r, errors.Wrapf(runErr, "season %q step %q", r.Season, x.Name)
+	}
+	return r, nil
+}
+
+func (p *Pipeline) save(season string, prev, next *Rollover) (*Rollover, error) {
+	if prev != nil {
+		next.Version = prev.Version + 1
+	}
+	ok, err := p.Store.Update(season, prev, next)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.Wrap(ErrRolloverBusy, season)
+	}
+	return next, nil
+}
+
+// Rollover returns the progress of closing season.
+func (p *Pipeline) Rollover(season string) (*Rollover, error) {
+	r, err := p.Store.Get(season)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return nil, errors.Wrap(ErrRolloverUnknown, season)
+	}
+	return r, nil
+}
+
+// FreezeStep fails with ErrSeasonOpen until the current season of the
+// board is past the one being closed, so later steps read final scores.
+func FreezeStep(lb *a5gleaderboard.Leaderboards, boardID string) *Step {
+	return &Step{Name: "freeze:" + boardID,
+		Run: func(ctx context.Context, season string) error {
+			s, err := lb.Top(boardID, 0, false)
+			if err != nil {
+				return err
+			}
+			if s.Season == season {
+				return errors.Wrapf(ErrSeasonOpen, "%s:%s", boardID, season)
+			}
+			return nil
+		}}
+}
+
+// PayoutStep pays the final standings of the board.
+func PayoutStep(p *a5gpayout.Processor, boardID string) *Step {
+	return &Step{Name: "payout:" + boardID,
+		Run: func(ctx context.Context, season string) error {
+			_, err := p.Pay(ctx, boardID, season)
+			return err
+		}}
+}
+
+type jobPayload struct {
+	Season string `json:"season"`
+}
+
+// NewJob makes an a5gjobs job closing season, run it by a pool with
+// Pipeline.JobHandler registered for JobKind.
+func NewJob(season string, maxAttempts int) (*a5gjobs.Job, error) {
+	b, err := json.Marshal(&jobPayload{Season: season})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return a5gjobs.NewJob(JobKind, b, a5gjobs.PriorityHigh, maxAttempts)
+}
+
+// JobHandler runs the rollover of a NewJob job; retries resume it.
+func (p *Pipeline) JobHandler() a5gjobs.HandlerFunc {
+	return func(ctx context.Context, j *a5gjobs.Job) error {
+		x := new(jobPayload)
+		if err := json.Unmarshal(j.Payload, x); err != nil {
+			return errors.WithStack(err)
+		}
+		_, err := p.Run(ctx, x.Season)
+		return err
+	}
+}
@@ -0,0 +1,74 @@
+package a5gseason
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestPipeline(t *testing.T) {
+	var calls []string
+	fail := "archive"
+	step := func(name string) *Step {
+		return &Step{Name: name, Run: func(ctx context.Context, season string) error {
+			calls = append(calls, name)
+			if name == fail {
+				return errors.New("cold storage down")
+			}
+			return nil
+		}}
+	}
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	if _, err := NewPipeline([]*Step{step("freeze"), step("freeze")},
+		NewMemoryStore(), l); err == nil {
+		t.Fatal("expected a duplicate step error")
+	}
+	p, err := NewPipeline([]*Step{step("freeze"), step("payout"),
+		step("archive"), step("reset"), step("open")}, NewMemoryStore(), l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err = p.Rollover("s1"); errors.Cause(err) != ErrRolloverUnknown {
+		t.Fatalf("unexpected error %v", err)
+	}
+	r, err := p.Run(ctx, "s1")
+	if err == nil {
+		t.Fatal("expected an archive error")
+	}
+	if r.Status != StatusFailed || r.Steps[2].Status != StatusFailed ||
+		r.Steps[2].LastErr != "cold storage down" || r.Steps[1].Status != StatusDone {
+		t.Errorf("unexpected failed rollover %+v", r)
+	}
+
+	fail = ""
+	j, err := NewJob("s1", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.JobHandler()(ctx, j); err != nil {
+		t.Fatal(err)
+	}
+	if r, err = p.Run(ctx, "s1"); err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != StatusDone || r.Steps[2].Attempts != 2 || r.Steps[4].DoneAt == 0 {
+		t.Errorf("unexpected rollover %+v", r)
+	}
+	got := strings.Join(calls, " ")
+	if got != "freeze payout archive archive reset open" {
+		t.Errorf("unexpected steps %q", got)
+	}
+
+	// A stale runner loses the race to store its progress.
+	stale := r.clone()
+	stale.Version--
+	if _, err = p.save("s1", stale, r.clone()); errors.Cause(err) != ErrRolloverBusy {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package a5gseason
+
+import (
+	"database/sql"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryStore struct {
+	mu        sync.Mutex
+	rollovers map[string]*Rollover
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{rollovers: make(map[string]*Rollover)}
+}
+
+func (s *memoryStore) Get(season string) (*Rollover, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.rollovers[season]
+	if !ok {
+		return nil, nil
+	}
+	return r.clone(), nil
+}
+
+func (s *memoryStore) Update(season string, prev, next *Rollover) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	x, ok := s.rollovers[season]
+	if ok != (prev != nil) || ok && x.Version != prev.Version {
+		return false, nil
+	}
+	s.rollovers[season] = next.clone()
+	return true, nil
+}
+
+// dbStore keeps rollovers in a MySQL table, a row per season:
+//
+//	CREATE TABLE season_rollovers (
+//	  season VARCHAR(64) NOT NULL PRIMARY KEY,
+//	  status VARCHAR(16) NOT NULL,
+//	  steps TEXT NOT NULL,
+//	  version BIGINT NOT NULL,
+//	  updated_at DATETIME NOT NULL);
+type dbStore struct {
+	pooler    a5gdb.Pooler
+	tableName string
+}
+
+type dbRollover struct {
+	Status  string `db:"status"`
+	Steps   string `db:"steps"`
+	Version int64  `db:"version"`
+}
+
+func NewDBStore(p a5gdb.Pooler, tableName string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if tableName == "" {
+		return nil, errors.New("empty season rollover table name")
+	}
+	return &dbStore{pooler: p, tableName: tableName}, nil
+}
+
+func (s *dbStore) Get(season string) (*Rollover, error) {
+	x := new(dbRollover)
+	err := s.pooler.WritePool().NewSession().
+		Select("status", "steps", "version").From(s.tableName).
+		Where(dbr.Eq("season", season)).LoadOne(x)
+	if err == dbr.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	r := &Rollover{Season: season, Status: x.Status, Version: x.Version}
+	if err = json.Unmarshal([]byte(x.Steps), &r.Steps); err != nil {
+		return nil, errors.Wrap(err, "season rollover steps")
+	}
+	return r, nil
+}
+
+func (s *dbStore) Update(season string, prev, next *Rollover) (bool, error) {
+	b, err := json.Marshal(next.Steps)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	sess := s.pooler.WritePool().NewSession()
+	var res sql.Result
+	if prev == nil {
+		res, err = sess.InsertBySql("INSERT IGNORE INTO "+s.tableName+
+			" (season, status, steps, version, updated_at) VALUES (?, ?, ?, ?, ?)",
+			season, next.Status, string(b), next.Version, time.Now().UTC()).Exec()
+	} else {
+		res, err = sess.Update(s.tableName).
+			Set("status", next.Status).
+			Set("steps", string(b)).
+			Set("version", next.Version).
+			Set("updated_at", time.Now().UTC()).
+			Where(dbr.Eq("season", season)).
+			Where(dbr.Eq("version", prev.Version)).Exec()
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	return n == 1, nil
+}
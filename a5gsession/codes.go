@@ -0,0 +1,50 @@
+package a5gsession
+
+import (
+	"net/http"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCodeSessionInvalid = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4010,
+		Name:     "session_invalid",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "invalid session"})
+
+	ErrCodeSessionExpired = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4011,
+		Name:     "session_expired",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "session expired"})
+
+	ErrCodeSessionRevoked = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4012,
+		Name:     "session_revoked",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "session revoked"})
+)
+
+func init() {
+	for _, c := range []a5gapi.APIErrCode{
+		ErrCodeSessionInvalid, ErrCodeSessionExpired, ErrCodeSessionRevoked} {
+		a5ghttp.DefaultStatusMapper.SetCode(c, http.StatusUnauthorized)
+	}
+}
+
+// APIErr converts Manager errors to public API errors.
+func APIErr(err error) *a5gapi.APIErr {
+	switch errors.Cause(err) {
+	case ErrSessionExpired:
+		return a5gapi.NewErr(ErrCodeSessionExpired, "")
+	case ErrSessionRevoked:
+		return a5gapi.NewErr(ErrCodeSessionRevoked, "")
+	}
+	return a5gapi.NewErr(ErrCodeSessionInvalid, "")
+}
@@ -0,0 +1,58 @@
+package a5gsession
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5ghttp"
+)
+
+type ctxKey int
+
+const ctxKeySession ctxKey = iota
+
+func ContextWithSession(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, ctxKeySession, s)
+}
+
+func FromContext(ctx context.Context) (*Session, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	s, ok := ctx.Value(ctxKeySession).(*Session)
+	return s, ok && s != nil
+}
+
+// Middleware validates "Authorization: Bearer <access token>" and injects
+// the session into the request context. Requests without a valid session
+// are answered with a 401 a5gapi envelope.
+func (m *Manager) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, err := m.Validate(bearerToken(r))
+		if err != nil {
+			m.Logger.With(
+				a5gfields.String("requestId",
+					a5gapi.RequestIDFromContext(r.Context())),
+				a5gfields.String("uri", r.RequestURI)).
+				Debug(err.Error())
+			if err = a5ghttp.WriteErrResponse(w, r, nil, APIErr(err)); err != nil {
+				m.Logger.Error(err.Error())
+			}
+			return
+		}
+		ctx := a5gapi.ContextWithAccountID(
+			ContextWithSession(r.Context(), s), s.AccountID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func bearerToken(r *http.Request) string {
+	s := r.Header.Get("Authorization")
+	if len(s) > 7 && strings.EqualFold(s[:7], "bearer ") {
+		return strings.TrimSpace(s[7:])
+	}
+	return ""
+}
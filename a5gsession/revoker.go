@@ -0,0 +1,74 @@
+package a5gsession
+
+import (
+	"sync"
+	"time"
+)
+
+// Revoker keeps forced invalidations: single sessions (by session ID) and
+// whole accounts (every session issued before the given time). Revoke is
+// a check-and-set: it reports false when sessionID was revoked already, so
+// of concurrent callers exactly one wins.
+type Revoker interface {
+	Revoke(sessionID string, until time.Time) (bool, error)
+	IsRevoked(sessionID string) (bool, error)
+	RevokeAccount(accountID uint64, issuedBefore time.Time) error
+	AccountRevokedBefore(accountID uint64) (time.Time, error)
+}
+
+type memoryRevoker struct {
+	mu       sync.Mutex
+	sessions map[string]time.Time
+	accounts map[uint64]time.Time
+}
+
+// NewMemoryRevoker is a single-process Revoker; revoked session IDs are
+// forgotten once their tokens would have expired anyway.
+func NewMemoryRevoker() Revoker {
+	return &memoryRevoker{
+		sessions: make(map[string]time.Time),
+		accounts: make(map[uint64]time.Time)}
+}
+
+func (r *memoryRevoker) Revoke(sessionID string, until time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for k, t := range r.sessions {
+		if now.After(t) {
+			delete(r.sessions, k)
+		}
+	}
+	if t, ok := r.sessions[sessionID]; ok {
+		if until.After(t) {
+			r.sessions[sessionID] = until
+		}
+		return false, nil
+	}
+	r.sessions[sessionID] = until
+	return true, nil
+}
+
+func (r *memoryRevoker) IsRevoked(sessionID string) (bool, error) {
+	r.mu.Lock()
+	t, ok := r.sessions[sessionID]
+	r.mu.Unlock()
+	return ok && !time.Now().After(t), nil
+}
+
+func (r *memoryRevoker) RevokeAccount(
+	accountID uint64, issuedBefore time.Time) error {
+	r.mu.Lock()
+	if issuedBefore.After(r.accounts[accountID]) {
+		r.accounts[accountID] = issuedBefore
+	}
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *memoryRevoker) AccountRevokedBefore(accountID uint64) (time.Time, error) {
+	r.mu.Lock()
+	t := r.accounts[accountID]
+	r.mu.Unlock()
+	return t, nil
+}
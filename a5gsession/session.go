@@ -0,0 +1,236 @@
+package a5gsession
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrSessionInvalid = errors.New("invalid session token")
+	ErrSessionExpired = errors.New("session token expired")
+	ErrSessionRevoked = errors.New("session token revoked")
+)
+
+type Kind string
+
+const (
+	KindAccess  Kind = "access"
+	KindRefresh Kind = "refresh"
+)
+
+// Session is the signed token body. ID is shared by the access and
+// refresh tokens of one login and survives refreshes, TokenID is unique
+// per token.
+type Session struct {
+	ID        string `json:"sid"`
+	TokenID   string `json:"tid"`
+	Kind      Kind   `json:"knd"`
+	AccountID uint64 `json:"acc"`
+	DeviceID  string `json:"dev"`
+	// IssuedAt and ExpiresAt are unix milliseconds.
+	IssuedAt  int64 `json:"iat"`
+	ExpiresAt int64 `json:"exp"`
+}
+
+func (s *Session) Expiry() time.Time { return fromMillis(s.ExpiresAt) }
+
+// Tokens is a freshly issued token pair.
+type Tokens struct {
+	AccessToken  string    `json:"accessToken"`
+	RefreshToken string    `json:"refreshToken"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
+
+// Manager issues, validates, refreshes and invalidates session tokens.
+type Manager struct {
+	Signer     Signer
+	Revoker    Revoker
+	Logger     a5glogs.Logger
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+
+	now func() time.Time
+}
+
+func NewManager(s Signer, r Revoker, l a5glogs.Logger) (*Manager, error) {
+	if s == nil {
+		return nil, errors.New("signer missing")
+	}
+	if r == nil {
+		return nil, errors.New("revoker missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Manager{
+		Signer:     s,
+		Revoker:    r,
+		Logger:     l,
+		AccessTTL:  15 * time.Minute,
+		RefreshTTL: 30 * 24 * time.Hour,
+		now:        time.Now}, nil
+}
+
+// Issue starts a new login session of account on device.
+func (m *Manager) Issue(accountID uint64, deviceID string) (*Tokens, error) {
+	if accountID == 0 {
+		return nil, errors.New("account id missing")
+	}
+	if deviceID == "" {
+		return nil, errors.New("device id missing")
+	}
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	return m.issue(id, accountID, deviceID)
+}
+
+func (m *Manager) issue(
+	id string, accountID uint64, deviceID string) (*Tokens, error) {
+	now := m.now()
+	access, err := m.sign(&Session{
+		ID:        id,
+		Kind:      KindAccess,
+		AccountID: accountID,
+		DeviceID:  deviceID,
+		IssuedAt:  toMillis(now),
+		ExpiresAt: toMillis(now.Add(m.AccessTTL))})
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := m.sign(&Session{
+		ID:        id,
+		Kind:      KindRefresh,
+		AccountID: accountID,
+		DeviceID:  deviceID,
+		IssuedAt:  toMillis(now),
+		ExpiresAt: toMillis(now.Add(m.RefreshTTL))})
+	if err != nil {
+		return nil, err
+	}
+	return &Tokens{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpiresAt:    now.Add(m.AccessTTL)}, nil
+}
+
+// Validate checks an access token.
+func (m *Manager) Validate(token string) (*Session, error) {
+	return m.validate(token, KindAccess)
+}
+
+// Refresh exchanges a refresh token for a new pair of the same session.
+// The used refresh token is revoked, so it works only once, even for
+// concurrent requests.
+func (m *Manager) Refresh(refreshToken string) (*Tokens, error) {
+	s, err := m.validate(refreshToken, KindRefresh)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := m.Revoker.Revoke(s.TokenID, s.Expiry())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrSessionRevoked
+	}
+	return m.issue(s.ID, s.AccountID, s.DeviceID)
+}
+
+// Invalidate revokes every token of the session, including refreshed ones.
+func (m *Manager) Invalidate(s *Session) error {
+	if s == nil || s.ID == "" {
+		return errors.New("session missing")
+	}
+	_, err := m.Revoker.Revoke(s.ID, m.now().Add(m.RefreshTTL))
+	return err
+}
+
+// InvalidateAccount revokes every session of the account issued so far.
+func (m *Manager) InvalidateAccount(accountID uint64) error {
+	return m.Revoker.RevokeAccount(accountID, m.now())
+}
+
+func (m *Manager) sign(s *Session) (string, error) {
+	var err error
+	if s.TokenID, err = newID(); err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	body := base64.RawURLEncoding.EncodeToString(b)
+	sig, err := m.Signer.Sign([]byte(body))
+	if err != nil {
+		return "", err
+	}
+	return body + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func (m *Manager) validate(token string, k Kind) (*Session, error) {
+	i := strings.LastIndexByte(token, '.')
+	if i < 1 {
+		return nil, ErrSessionInvalid
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(token[i+1:])
+	if err != nil {
+		return nil, ErrSessionInvalid
+	}
+	if !m.Signer.Verify([]byte(token[:i]), sig) {
+		return nil, ErrSessionInvalid
+	}
+	b, err := base64.RawURLEncoding.DecodeString(token[:i])
+	if err != nil {
+		return nil, ErrSessionInvalid
+	}
+	s := new(Session)
+	if err = json.Unmarshal(b, s); err != nil {
+		return nil, ErrSessionInvalid
+	}
+	if s.Kind != k || s.ID == "" || s.TokenID == "" || s.AccountID == 0 {
+		return nil, ErrSessionInvalid
+	}
+	if !m.now().Before(s.Expiry()) {
+		return nil, ErrSessionExpired
+	}
+	for _, id := range []string{s.ID, s.TokenID} {
+		revoked, err := m.Revoker.IsRevoked(id)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrSessionRevoked
+		}
+	}
+	t, err := m.Revoker.AccountRevokedBefore(s.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	if !t.IsZero() && s.IssuedAt <= toMillis(t) {
+		return nil, ErrSessionRevoked
+	}
+	return s, nil
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func toMillis(t time.Time) int64 { return t.UnixNano() / int64(time.Millisecond) }
+
+func fromMillis(i int64) time.Time {
+	return time.Unix(0, i*int64(time.Millisecond))
+}
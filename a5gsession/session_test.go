@@ -0,0 +1,138 @@
+package a5gsession
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ed25519"
+)
+
+func newTestManager(t *testing.T, s Signer) *Manager {
+	m, err := NewManager(s, NewMemoryRevoker(),
+		a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestManager(t *testing.T) {
+	h, err := NewHMACSigner(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, k, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := NewEd25519Signer(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []Signer{h, e} {
+		m := newTestManager(t, s)
+		now := time.Now()
+		m.now = func() time.Time { return now }
+		tokens, err := m.Issue(1, "device")
+		if err != nil {
+			t.Fatal(err)
+		}
+		x, err := m.Validate(tokens.AccessToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if x.AccountID != 1 || x.DeviceID != "device" {
+			t.Errorf("unexpected session %+v", x)
+		}
+		tests := []struct {
+			token string
+			err   error
+		}{
+			{"", ErrSessionInvalid},
+			{tokens.RefreshToken, ErrSessionInvalid},
+			{strings.Replace(tokens.AccessToken, ".", "x.", 1), ErrSessionInvalid},
+			{tokens.AccessToken + "x", ErrSessionInvalid}}
+		for _, test := range tests {
+			if _, err := m.Validate(test.token); errors.Cause(err) != test.err {
+				t.Errorf("token %q: expected %v, got %v", test.token, test.err, err)
+			}
+		}
+
+		refreshed, err := m.Refresh(tokens.RefreshToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = m.Refresh(tokens.RefreshToken); err != ErrSessionRevoked {
+			t.Errorf("refresh token reuse: expected %v, got %v",
+				ErrSessionRevoked, err)
+		}
+		now = now.Add(m.AccessTTL)
+		if _, err = m.Validate(tokens.AccessToken); err != ErrSessionExpired {
+			t.Errorf("expected %v, got %v", ErrSessionExpired, err)
+		}
+		if err = m.Invalidate(x); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = m.Refresh(refreshed.RefreshToken); err != ErrSessionRevoked {
+			t.Errorf("invalidated session: expected %v, got %v",
+				ErrSessionRevoked, err)
+		}
+
+		tokens, err = m.Issue(1, "device")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = m.InvalidateAccount(1); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = m.Validate(tokens.AccessToken); err != ErrSessionRevoked {
+			t.Errorf("invalidated account: expected %v, got %v",
+				ErrSessionRevoked, err)
+		}
+	}
+}
+
+func TestManagerConcurrentRefresh(t *testing.T) {
+	h, err := NewHMACSigner(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newTestManager(t, h)
+	tokens, err := m.Issue(1, "device")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		refreshed int
+	)
+	start := make(chan struct{})
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, err := m.Refresh(tokens.RefreshToken)
+			if err != nil && err != ErrSessionRevoked {
+				t.Error(err)
+			}
+			mu.Lock()
+			if err == nil {
+				refreshed++
+			}
+			mu.Unlock()
+		}()
+	}
+	close(start)
+	wg.Wait()
+	if refreshed != 1 {
+		t.Errorf("refresh token used %d times", refreshed)
+	}
+}
@@ -0,0 +1,75 @@
+package a5gsession
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ed25519"
+)
+
+// Signer signs and verifies token bodies. Services that only validate
+// tokens may use NewEd25519Verifier, which cannot sign.
+type Signer interface {
+	Sign(b []byte) ([]byte, error)
+	Verify(b, sig []byte) bool
+}
+
+type hmacSigner struct{ secretKey []byte }
+
+// NewHMACSigner is an HMAC-SHA256 signer.
+func NewHMACSigner(secretKey []byte) (Signer, error) {
+	if len(secretKey) < 32 {
+		return nil, errors.New("hmac secret key is shorter than 32 bytes")
+	}
+	return &hmacSigner{secretKey: append([]byte(nil), secretKey...)}, nil
+}
+
+func (s *hmacSigner) Sign(b []byte) ([]byte, error) {
+	h := hmac.New(sha256.New, s.secretKey)
+	if _, err := h.Write(b); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return h.Sum(nil), nil
+}
+
+func (s *hmacSigner) Verify(b, sig []byte) bool {
+	x, err := s.Sign(b)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(x, sig)
+}
+
+type ed25519Signer struct {
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+}
+
+func NewEd25519Signer(k ed25519.PrivateKey) (Signer, error) {
+	if len(k) != ed25519.PrivateKeySize {
+		return nil, errors.New("invalid ed25519 private key")
+	}
+	return &ed25519Signer{
+		privateKey: k,
+		publicKey:  k.Public().(ed25519.PublicKey)}, nil
+}
+
+// NewEd25519Verifier returns a Signer whose Sign always fails.
+func NewEd25519Verifier(k ed25519.PublicKey) (Signer, error) {
+	if len(k) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid ed25519 public key")
+	}
+	return &ed25519Signer{publicKey: k}, nil
+}
+
+func (s *ed25519Signer) Sign(b []byte) ([]byte, error) {
+	if s.privateKey == nil {
+		return nil, errors.New("ed25519 verifier can not sign")
+	}
+	return ed25519.Sign(s.privateKey, b), nil
+}
+
+func (s *ed25519Signer) Verify(b, sig []byte) bool {
+	return ed25519.Verify(s.publicKey, b, sig)
+}
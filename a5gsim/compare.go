@@ -0,0 +1,122 @@
+package a5gsim
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// FlowDelta projects a currency per player and day under both bundles.
+type FlowDelta struct {
+	Currency string     `json:"currency"`
+	Faucet   [2]float64 `json:"faucet"`
+	Sink     [2]float64 `json:"sink"`
+	Net      [2]float64 `json:"net"`
+}
+
+// PaceDelta is progression of a quest under both bundles: the share of
+// players who claimed it and the mean day they did.
+type PaceDelta struct {
+	Quest   string     `json:"quest"`
+	Share   [2]float64 `json:"share"`
+	MeanDay [2]float64 `json:"meanDay"`
+}
+
+// Comparison holds the base bundle first and the candidate second in
+// every pair.
+type Comparison struct {
+	Versions   [2]string    `json:"versions"`
+	Currencies []*FlowDelta `json:"currencies"`
+	Quests     []*PaceDelta `json:"quests"`
+}
+
+// Compare projects base and candidate results of the same behavior.
+func Compare(base, candidate *Result) *Comparison {
+	c := &Comparison{Versions: [2]string{base.Version, candidate.Version}}
+	results := [2]*Result{base, candidate}
+	for _, id := range flowKeys(base, candidate) {
+		d := &FlowDelta{Currency: id}
+		for i, r := range results {
+			if f := r.Currencies[id]; f != nil {
+				d.Faucet[i] = perPlayerDay(r, f.Faucet)
+				d.Sink[i] = perPlayerDay(r, f.Sink)
+				d.Net[i] = d.Faucet[i] - d.Sink[i]
+			}
+		}
+		c.Currencies = append(c.Currencies, d)
+	}
+	for _, id := range paceKeys(base, candidate) {
+		d := &PaceDelta{Quest: id}
+		for i, r := range results {
+			if p := r.Quests[id]; p != nil && r.Players > 0 {
+				d.Share[i] = float64(p.Claimed) / float64(r.Players)
+				d.MeanDay[i] = p.MeanDay
+			}
+		}
+		c.Quests = append(c.Quests, d)
+	}
+	return c
+}
+
+func perPlayerDay(r *Result, n int64) float64 {
+	if r.Players == 0 || r.Days == 0 {
+		return 0
+	}
+	return float64(n) / float64(r.Players*r.Days)
+}
+
+// Lines renders the comparison for people, e.g.
+//
+//	soft faucet/player/day 12.5 -> 20 (+60%)
+//	quest hunter claimed by 80% -> 95% of players, on day 3.2 -> 2.1
+func (c *Comparison) Lines() []string {
+	a := []string{fmt.Sprintf("%q -> %q", c.Versions[0], c.Versions[1])}
+	for _, d := range c.Currencies {
+		a = append(a,
+			fmt.Sprintf("%s faucet/player/day %s", d.Currency, pair(d.Faucet)),
+			fmt.Sprintf("%s sink/player/day %s", d.Currency, pair(d.Sink)),
+			fmt.Sprintf("%s net/player/day %s", d.Currency, pair(d.Net)))
+	}
+	for _, d := range c.Quests {
+		a = append(a, fmt.Sprintf("quest %s claimed by %.0f%% -> %.0f%% of players, on day %.1f -> %.1f",
+			d.Quest, d.Share[0]*100, d.Share[1]*100, d.MeanDay[0], d.MeanDay[1]))
+	}
+	return a
+}
+
+func pair(v [2]float64) string {
+	s := fmt.Sprintf("%.4g -> %.4g", v[0], v[1])
+	if v[0] != 0 && v[0] != v[1] {
+		s += fmt.Sprintf(" (%+.0f%%)", (v[1]-v[0])/math.Abs(v[0])*100)
+	}
+	return s
+}
+
+func flowKeys(a, b *Result) []string {
+	m := make(map[string]bool)
+	for _, r := range []*Result{a, b} {
+		for k := range r.Currencies {
+			m[k] = true
+		}
+	}
+	return keys(m)
+}
+
+func paceKeys(a, b *Result) []string {
+	m := make(map[string]bool)
+	for _, r := range []*Result{a, b} {
+		for k := range r.Quests {
+			m[k] = true
+		}
+	}
+	return keys(m)
+}
+
+func keys(m map[string]bool) []string {
+	a := make([]string, 0, len(m))
+	for k := range m {
+		a = append(a, k)
+	}
+	sort.Strings(a)
+	return a
+}
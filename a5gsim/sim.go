@@ -0,0 +1,272 @@
+// Package a5gsim replays recorded or synthetic player behavior against
+// balance data bundles offline, through the same wallet, inventory and
+// quest code the servers run, and projects currency faucets and sinks and
+// progression pace. Comparing the live bundle with a candidate shows what
+// a balance change does to the economy before players see it.
+package a5gsim
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"sort"
+	"strconv"
+
+	"github.com/armor5games/a5g/a5gbalance"
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gquest"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+)
+
+// Action is a player action on Day of the simulation, counted from 0:
+// Event reported N times to quests, or a spend of Amount of Currency at
+// Sink, e.g. a shop.
+type Action struct {
+	AccountID uint64 `json:"accountId"`
+	Day       int    `json:"day"`
+	Event     string `json:"event,omitempty"`
+	N         int64  `json:"n,omitempty"`
+	Sink      string `json:"sink,omitempty"`
+	Currency  string `json:"currency,omitempty"`
+	Amount    int64  `json:"amount,omitempty"`
+}
+
+// ReadActions reads recorded actions, a JSON object per line, e.g.
+// exported from analytics.
+func ReadActions(r io.Reader) ([]*Action, error) {
+	var a []*Action
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+		x := new(Action)
+		if err := json.Unmarshal(s.Bytes(), x); err != nil {
+			return nil, errors.Wrapf(err, "line %d", line)
+		}
+		a = append(a, x)
+	}
+	if err := s.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return a, nil
+}
+
+// SpendRate is a sink players spend at PerDay times a day on average.
+type SpendRate struct {
+	Sink     string  `json:"sink"`
+	Currency string  `json:"currency"`
+	Amount   int64   `json:"amount"`
+	PerDay   float64 `json:"perDay"`
+}
+
+// Synthetic is behavior of Players over Days: Events are mean reports
+// per player and day by event. Equal Seeds generate equal actions, so
+// bundles are compared on the same behavior.
+type Synthetic struct {
+	Players int                `json:"players"`
+	Days    int                `json:"days"`
+	Seed    int64              `json:"seed"`
+	Events  map[string]float64 `json:"events"`
+	Spends  []*SpendRate       `json:"spends,omitempty"`
+}
+
+func (s *Synthetic) Actions() []*Action {
+	r := rand.New(rand.NewSource(s.Seed))
+	events := make([]string, 0, len(s.Events))
+	for e := range s.Events {
+		events = append(events, e)
+	}
+	sort.Strings(events)
+	var a []*Action
+	for day := 0; day < s.Days; day++ {
+		for p := 1; p <= s.Players; p++ {
+			id := uint64(p)
+			for _, e := range events {
+				if n := times(r, s.Events[e]); n > 0 {
+					a = append(a, &Action{AccountID: id, Day: day, Event: e, N: n})
+				}
+			}
+			for _, x := range s.Spends {
+				for n := times(r, x.PerDay); n > 0; n-- {
+					a = append(a, &Action{AccountID: id, Day: day, Sink: x.Sink,
+						Currency: x.Currency, Amount: x.Amount})
+				}
+			}
+		}
+	}
+	return a
+}
+
+// times draws a count of mean mean: its integer part plus one more with
+// the probability of its fraction.
+func times(r *rand.Rand, mean float64) int64 {
+	n := int64(mean)
+	if r.Float64() < mean-float64(n) {
+		n++
+	}
+	return n
+}
+
+// Flow sums a currency: Faucet granted by quests, Sink spent, and
+// Blocked spends players could not afford.
+type Flow struct {
+	Faucet  int64 `json:"faucet"`
+	Sink    int64 `json:"sink"`
+	Blocked int64 `json:"blocked"`
+}
+
+// Pace is the progression of a quest: players who claimed it and the
+// mean day they did. Failed claims hit wallet or inventory caps, the
+// quest stays completed and unclaimed.
+type Pace struct {
+	Claimed int     `json:"claimed"`
+	Failed  int     `json:"failed,omitempty"`
+	MeanDay float64 `json:"meanDay"`
+}
+
+type Result struct {
+	Version    string           `json:"version"`
+	Players    int              `json:"players"`
+	Days       int              `json:"days"`
+	Currencies map[string]*Flow `json:"currencies"`
+	Quests     map[string]*Pace `json:"quests"`
+}
+
+// Run replays actions in day order against b. Completed quests are
+// claimed right away and quest rules count as matched.
+func Run(ctx context.Context, b *a5gbalance.Bundle, actions []*Action,
+	l a5glogs.Logger) (*Result, error) {
+	s, err := newSim(b, l)
+	if err != nil {
+		return nil, err
+	}
+	sorted := append([]*Action(nil), actions...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Day < sorted[j].Day })
+	players := make(map[uint64]bool)
+	for i, x := range sorted {
+		players[x.AccountID] = true
+		if x.Day+1 > s.result.Days {
+			s.result.Days = x.Day + 1
+		}
+		if err = s.apply(ctx, i, x); err != nil {
+			return nil, errors.Wrapf(err, "action %d", i)
+		}
+	}
+	s.result.Players = len(players)
+	for id, p := range s.result.Quests {
+		if p.Claimed > 0 {
+			p.MeanDay = float64(s.days[id]) / float64(p.Claimed)
+		}
+	}
+	return s.result, nil
+}
+
+type sim struct {
+	wallet *a5gwallet.Wallet
+	quests *a5gquest.Quests
+	result *Result
+	// days sums claim days by quest.
+	days map[string]int
+}
+
+func newSim(b *a5gbalance.Bundle, l a5glogs.Logger) (*sim, error) {
+	currencies, err := a5gwallet.NewCurrencies(b.Currencies...)
+	if err != nil {
+		return nil, err
+	}
+	catalog, err := a5ginventory.NewCatalog(b.Inventory)
+	if err != nil {
+		return nil, err
+	}
+	config, err := a5gquest.NewConfig(b.Quests)
+	if err != nil {
+		return nil, err
+	}
+	s := &sim{
+		result: &Result{Version: b.Version,
+			Currencies: make(map[string]*Flow),
+			Quests:     make(map[string]*Pace)},
+		days: make(map[string]int)}
+	if s.wallet, err = a5gwallet.NewWallet(a5gwallet.NewMemoryStore(), currencies, l); err != nil {
+		return nil, err
+	}
+	inventory, err := a5ginventory.NewInventory(a5ginventory.NewMemoryStore(), catalog, l)
+	if err != nil {
+		return nil, err
+	}
+	// Overflow would be mailed to players, the simulation drops it.
+	inventory.Mailer = a5ginventory.MailerFunc(
+		func(uint64, *a5ginventory.Tx, []*a5ginventory.Stack) error { return nil })
+	if s.quests, err = a5gquest.NewQuests(config, a5gquest.NewMemoryStore(), l); err != nil {
+		return nil, err
+	}
+	s.quests.Wallet = s.wallet
+	s.quests.Inventory = inventory
+	s.quests.Rules = func(context.Context, uint64, string) (bool, error) { return true, nil }
+	return s, nil
+}
+
+func (s *sim) flow(currency string) *Flow {
+	f := s.result.Currencies[currency]
+	if f == nil {
+		f = new(Flow)
+		s.result.Currencies[currency] = f
+	}
+	return f
+}
+
+func (s *sim) apply(ctx context.Context, i int, x *Action) error {
+	if x.Sink != "" {
+		_, err := s.wallet.Debit(x.AccountID, "sim:"+strconv.Itoa(i), x.Sink, "sim",
+			x.Currency, x.Amount)
+		switch errors.Cause(err) {
+		case nil:
+			s.flow(x.Currency).Sink += x.Amount
+		case a5gwallet.ErrInsufficientFunds:
+			s.flow(x.Currency).Blocked += x.Amount
+		default:
+			return err
+		}
+		return nil
+	}
+	changed, err := s.quests.Report(ctx, x.AccountID, x.Event, x.N)
+	if err != nil {
+		return err
+	}
+	for _, p := range changed {
+		if p.Status != a5gquest.StatusCompleted {
+			continue
+		}
+		pace := s.result.Quests[p.QuestID]
+		if pace == nil {
+			pace = new(Pace)
+			s.result.Quests[p.QuestID] = pace
+		}
+		res, err := s.quests.Claim(ctx, x.AccountID, p.QuestID)
+		switch errors.Cause(err) {
+		case nil:
+		case a5gwallet.ErrBalanceCapExceeded, a5ginventory.ErrCapExceeded,
+			a5ginventory.ErrTabFull:
+			pace.Failed++
+			continue
+		default:
+			return err
+		}
+		if res.Replayed {
+			continue
+		}
+		pace.Claimed++
+		s.days[p.QuestID] += x.Day
+		if res.Reward != nil {
+			for c, n := range res.Reward.Currencies {
+				s.flow(c).Faucet += n
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package a5gsim
+
+import (
+	"context"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/armor5games/a5g/a5gbalance"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/sirupsen/logrus"
+)
+
+func testBundle(t *testing.T, version, reward string) *a5gbalance.Bundle {
+	b, problems := a5gbalance.Parse([]byte(`{"version": "` + version + `",
+		"currencies": [{"id": "soft", "max": 150}], "inventory": {"items": []},
+		"quests": [{"id": "hunter", "reward": {"currencies": {"soft": ` + reward + `}},
+			"objectives": [{"id": "zombies", "event": "kill_zombie", "target": 4}]}]}`))
+	if b == nil {
+		t.Fatal(problems)
+	}
+	return b
+}
+
+func TestRun(t *testing.T) {
+	actions, err := ReadActions(strings.NewReader(`{"accountId": 1, "day": 0, "event": "kill_zombie", "n": 3}
+{"accountId": 1, "day": 1, "sink": "shop", "currency": "soft", "amount": 10}
+
+{"accountId": 2, "day": 2, "event": "kill_zombie", "n": 5}
+{"accountId": 1, "day": 1, "event": "kill_zombie", "n": 1}
+{"accountId": 1, "day": 3, "sink": "shop", "currency": "soft", "amount": 60}
+{"accountId": 2, "day": 3, "sink": "shop", "currency": "soft", "amount": 60}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	ctx := context.Background()
+	r, err := Run(ctx, testBundle(t, "1", "100"), actions, a5glogs.NewLogrusWrapper(l))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Result{Version: "1", Players: 2, Days: 4,
+		Currencies: map[string]*Flow{"soft": {Faucet: 200, Sink: 120, Blocked: 10}},
+		Quests:     map[string]*Pace{"hunter": {Claimed: 2, MeanDay: 1.5}}}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("Run() => %+v want %+v", r, want)
+	}
+
+	// Over the balance cap of 150 claims fail.
+	c, err := Run(ctx, testBundle(t, "2", "200"), actions, a5glogs.NewLogrusWrapper(l))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := c.Quests["hunter"]; p.Claimed != 0 || p.Failed != 2 {
+		t.Errorf("unexpected pace %+v", p)
+	}
+	lines := Compare(r, c).Lines()
+	if want := []string{`"1" -> "2"`,
+		"soft faucet/player/day 25 -> 0 (-100%)",
+		"soft sink/player/day 15 -> 0 (-100%)",
+		"soft net/player/day 10 -> 0 (-100%)",
+		"quest hunter claimed by 100% -> 0% of players, on day 1.5 -> 0.0",
+	}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("Lines() => %q want %q", lines, want)
+	}
+}
+
+func TestSynthetic(t *testing.T) {
+	s := &Synthetic{Players: 100, Days: 10, Seed: 1,
+		Events: map[string]float64{"kill_zombie": 0.5},
+		Spends: []*SpendRate{{Sink: "shop", Currency: "soft", Amount: 10, PerDay: 1.2}}}
+	a := s.Actions()
+	if !reflect.DeepEqual(a, s.Actions()) {
+		t.Error("Actions() of a seed differ")
+	}
+	var kills, spends int64
+	for _, x := range a {
+		if x.Event != "" {
+			kills += x.N
+		} else {
+			spends++
+		}
+	}
+	if kills < 400 || kills > 600 || spends < 1100 || spends > 1300 {
+		t.Errorf("unexpected %d kills and %d spends", kills, spends)
+	}
+}
@@ -0,0 +1,112 @@
+package a5gstage
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCodeStageUnknown = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4051,
+		Name:     "stage_unknown",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "stage not found"})
+
+	ErrCodeStageLocked = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4236,
+		Name:     "stage_locked",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "stage is locked"})
+
+	ErrCodeSweepLocked = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4237,
+		Name:     "stage_sweep_locked",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "stage must be cleared with every star to sweep"})
+)
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeStageUnknown, http.StatusNotFound)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeStageLocked, http.StatusUnprocessableEntity)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeSweepLocked, http.StatusUnprocessableEntity)
+}
+
+type ListResponse struct {
+	Stages []*StageView `json:"stages"`
+}
+
+type SweepRequest struct {
+	StageID string `json:"stageId" validate:"required"`
+	Times   int64  `json:"times" validate:"min=1,max=100"`
+}
+
+// ListHandler answers with stages of the a5gsession authenticated player.
+func (s *Stages) ListHandler() a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		sess, ok := a5gsession.FromContext(ctx)
+		if !ok {
+			return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+		}
+		stages, err := s.List(sess.AccountID)
+		if err != nil {
+			return nil, s.apiErrs(err)
+		}
+		return &ListResponse{Stages: stages}, nil
+	}
+}
+
+// SweepHandler sweeps a stage of the a5gsession authenticated player and
+// answers with the Result. Clears are reported by the battle service
+// calling Clear, not by clients.
+func (s *Stages) SweepHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(SweepRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			sess, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			p := req.Payload.(*SweepRequest)
+			res, err := s.Sweep(ctx, sess.AccountID, p.StageID, p.Times)
+			if err != nil {
+				return nil, s.apiErrs(err)
+			}
+			return res, nil
+		})
+}
+
+func (s *Stages) apiErrs(err error) []*a5gapi.APIErr {
+	var c a5gapi.APIErrCode
+	switch errors.Cause(err) {
+	case ErrStageUnknown:
+		c = ErrCodeStageUnknown
+	case ErrStageLocked:
+		c = ErrCodeStageLocked
+	case ErrSweepLocked:
+		c = ErrCodeSweepLocked
+	case a5gwallet.ErrInsufficientFunds, a5gwallet.ErrBalanceCapExceeded,
+		a5gwallet.ErrTxConflict:
+		return s.Wallet.APIErrs(err)
+	case a5ginventory.ErrCapExceeded, a5ginventory.ErrTabFull:
+		return s.Inventory.APIErrs(err)
+	default:
+		s.Logger.Error(err.Error())
+		return a5gapi.NewJSONMsgDefautlErrors(err)
+	}
+	return []*a5gapi.APIErr{a5gapi.NewErr(c, "")}
+}
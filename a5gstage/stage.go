@@ -0,0 +1,379 @@
+package a5gstage
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+)
+
+// Reason of wallet and inventory transactions of stage clears and sweeps.
+const Reason = "stage"
+
+// MaxStars is the best rating of a stage.
+const MaxStars = 3
+
+var (
+	ErrStageUnknown = errors.New("stage unknown")
+	ErrStageLocked  = errors.New("stage locked")
+	ErrSweepLocked  = errors.New("stage sweep locked")
+)
+
+// Event types passed to listeners.
+const (
+	EventCleared = "cleared"
+	EventSwept   = "swept"
+)
+
+// Reward is what a stage grants: wallet currencies and inventory items.
+type Reward struct {
+	Currencies map[string]int64 `json:"currencies,omitempty"`
+	Items      map[string]int64 `json:"items,omitempty"`
+}
+
+func (r *Reward) add(x *Reward, times int64) {
+	if x == nil {
+		return
+	}
+	for k, n := range x.Currencies {
+		if r.Currencies == nil {
+			r.Currencies = make(map[string]int64)
+		}
+		r.Currencies[k] += n * times
+	}
+	for k, n := range x.Items {
+		if r.Items == nil {
+			r.Items = make(map[string]int64)
+		}
+		r.Items[k] += n * times
+	}
+}
+
+// Stage is a campaign battle costing Energy. Reward is granted by every
+// clear and sweep, FirstClear by the first clear and Perfect by the first
+// clear with MaxStars.
+type Stage struct {
+	ID         string  `json:"id"`
+	Energy     int64   `json:"energy"`
+	Reward     *Reward `json:"reward,omitempty"`
+	FirstClear *Reward `json:"firstClear,omitempty"`
+	Perfect    *Reward `json:"perfect,omitempty"`
+}
+
+// Config is an balance data of the campaign, stages unlock in order as
+// the previous one is cleared. EnergyCurrency is the wallet currency
+// stages cost. Stage IDs key the stored progress, so they must not be
+// reused for something else; new stages may be appended.
+type Config struct {
+	Stages         []*Stage `json:"stages"`
+	EnergyCurrency string   `json:"energyCurrency"`
+
+	byID map[string]int
+}
+
+func NewConfig(c *Config) (*Config, error) {
+	if c == nil {
+		return nil, errors.New("nil stage config")
+	}
+	if c.EnergyCurrency == "" {
+		return nil, errors.New("empty stage energy currency")
+	}
+	c.byID = make(map[string]int, len(c.Stages))
+	for i, x := range c.Stages {
+		if x == nil || x.ID == "" {
+			return nil, errors.New("empty stage id")
+		}
+		if _, ok := c.byID[x.ID]; ok {
+			return nil, errors.Errorf("duplicate stage %q", x.ID)
+		}
+		if x.Energy < 0 {
+			return nil, errors.Errorf("stage %q has negative energy", x.ID)
+		}
+		c.byID[x.ID] = i
+	}
+	return c, nil
+}
+
+func NewConfigJSON(b []byte) (*Config, error) {
+	c := new(Config)
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return NewConfig(c)
+}
+
+// Progress is a cleared stage of a player: the best Stars and the number
+// of clears and sweeps. Version is bumped by every update.
+type Progress struct {
+	StageID string `json:"stageId"`
+	Stars   int    `json:"stars"`
+	Clears  int64  `json:"clears"`
+	Version int64  `json:"version"`
+}
+
+// Store keeps stage progress. Update replaces the progress of a stage
+// only while its version is still that of prev, reporting whether it did;
+// nil prev stands for no progress and nil next removes it.
+type Store interface {
+	List(accountID uint64) (map[string]*Progress, error)
+	Update(accountID uint64, prev, next *Progress) (bool, error)
+}
+
+// Event is passed to listeners, e.g. analytics, after rewards are
+// granted. Times is the number of clears, a sweep makes several.
+type Event struct {
+	Type     string    `json:"type"`
+	Stars    int       `json:"stars,omitempty"`
+	Times    int64     `json:"times,omitempty"`
+	Progress *Progress `json:"progress"`
+	At       int64     `json:"at"`
+}
+
+type EventFunc func(ctx context.Context, accountID uint64, e *Event)
+
+// Stages tracks campaign progress. Battles are played and validated by
+// the game, which reports results with Clear; mount the handlers behind
+// a5gidempotency, every call is a new clear.
+type Stages struct {
+	Config    *Config
+	Store     Store
+	Wallet    *a5gwallet.Wallet
+	Inventory *a5ginventory.Inventory
+	Logger    a5glogs.Logger
+
+	listeners []EventFunc
+	now       func() time.Time
+}
+
+func NewStages(
+	c *Config, s Store, w *a5gwallet.Wallet, l a5glogs.Logger,
+	listeners ...EventFunc) (*Stages, error) {
+	if c == nil {
+		return nil, errors.New("nil stage config")
+	}
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if w == nil {
+		return nil, errors.New("wallet missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Stages{
+		Config:    c,
+		Store:     s,
+		Wallet:    w,
+		Logger:    l,
+		listeners: listeners,
+		now:       time.Now}, nil
+}
+
+// StageView is a stage of the player for the client UI.
+type StageView struct {
+	ID         string  `json:"id"`
+	Energy     int64   `json:"energy"`
+	Unlocked   bool    `json:"unlocked"`
+	Stars      int     `json:"stars"`
+	Clears     int64   `json:"clears"`
+	Sweep      bool    `json:"sweep"`
+	Reward     *Reward `json:"reward,omitempty"`
+	FirstClear *Reward `json:"firstClear,omitempty"`
+	Perfect    *Reward `json:"perfect,omitempty"`
+}
+
+// List returns stages of a player in config order; first clear and
+// perfect rewards are omitted once granted.
+func (s *Stages) List(accountID uint64) ([]*StageView, error) {
+	all, err := s.Store.List(accountID)
+	if err != nil {
+		return nil, err
+	}
+	a := make([]*StageView, 0, len(s.Config.Stages))
+	for i, x := range s.Config.Stages {
+		v := &StageView{
+			ID:         x.ID,
+			Energy:     x.Energy,
+			Unlocked:   s.unlocked(i, all),
+			Reward:     x.Reward,
+			FirstClear: x.FirstClear,
+			Perfect:    x.Perfect}
+		if p := all[x.ID]; p != nil {
+			v.Stars, v.Clears, v.FirstClear = p.Stars, p.Clears, nil
+			v.Sweep = p.Stars == MaxStars
+			if v.Sweep {
+				v.Perfect = nil
+			}
+		}
+		a = append(a, v)
+	}
+	return a, nil
+}
+
+func (s *Stages) unlocked(i int, all map[string]*Progress) bool {
+	return i == 0 || all[s.Config.Stages[i-1].ID] != nil
+}
+
+// Result is the payload of clears and sweeps.
+type Result struct {
+	Progress  *Progress             `json:"progress"`
+	Reward    *Reward               `json:"reward,omitempty"`
+	Wallet    *a5gwallet.Result     `json:"wallet,omitempty"`
+	Inventory *a5ginventory.Changes `json:"inventory,omitempty"`
+}
+
+// Clear charges the stage energy and grants rewards of a won battle with
+// stars, 1 to MaxStars.
+func (s *Stages) Clear(
+	ctx context.Context, accountID uint64, stageID string, stars int) (
+	*Result, error) {
+	if stars < 1 || stars > MaxStars {
+		return nil, errors.Errorf("stars %d out of range", stars)
+	}
+	e := &Event{Type: EventCleared, Stars: stars, Times: 1}
+	return s.apply(ctx, accountID, stageID, e, func(x *Stage, prev *Progress) (
+		*Progress, *Reward, error) {
+		r := new(Reward)
+		r.add(x.Reward, 1)
+		next := &Progress{StageID: x.ID, Stars: stars, Clears: 1}
+		if prev == nil {
+			r.add(x.FirstClear, 1)
+		} else {
+			next = clone(prev)
+			next.Clears++
+			next.Version++
+			if stars > prev.Stars {
+				next.Stars = stars
+			}
+		}
+		if stars == MaxStars && (prev == nil || prev.Stars < MaxStars) {
+			r.add(x.Perfect, 1)
+		}
+		return next, r, nil
+	})
+}
+
+// Sweep repeats a stage cleared with MaxStars times without a battle,
+// charging energy and granting the stage reward for each.
+func (s *Stages) Sweep(
+	ctx context.Context, accountID uint64, stageID string, times int64) (
+	*Result, error) {
+	if times < 1 {
+		return nil, errors.Errorf("sweep times %d out of range", times)
+	}
+	e := &Event{Type: EventSwept, Times: times}
+	return s.apply(ctx, accountID, stageID, e, func(x *Stage, prev *Progress) (
+		*Progress, *Reward, error) {
+		if prev == nil || prev.Stars < MaxStars {
+			return nil, nil, errors.Wrap(ErrSweepLocked, x.ID)
+		}
+		next := clone(prev)
+		next.Clears += times
+		next.Version++
+		r := new(Reward)
+		r.add(x.Reward, times)
+		return next, r, nil
+	})
+}
+
+type advanceFunc func(x *Stage, prev *Progress) (*Progress, *Reward, error)
+
+// apply stores the advanced progress and grants its reward. A failed
+// grant reverts the progress so the player may retry: the wallet
+// transaction is keyed by the clears count, so a retry replays it rather
+// than charging twice, and inventory ones are atomic.
+func (s *Stages) apply(
+	ctx context.Context, accountID uint64, stageID string, e *Event,
+	fn advanceFunc) (*Result, error) {
+	i, ok := s.Config.byID[stageID]
+	if !ok {
+		return nil, errors.Wrap(ErrStageUnknown, stageID)
+	}
+	x := s.Config.Stages[i]
+	all, err := s.Store.List(accountID)
+	if err != nil {
+		return nil, err
+	}
+	if !s.unlocked(i, all) {
+		return nil, errors.Wrap(ErrStageLocked, stageID)
+	}
+	prev := all[stageID]
+	next, r, err := fn(x, prev)
+	if err != nil {
+		return nil, err
+	}
+	ok, err = s.Store.Update(accountID, prev, next)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.Errorf("stage %q progress update conflict", stageID)
+	}
+	res, err := s.grant(accountID, x, next, e.Times, r)
+	if err != nil {
+		var revert *Progress
+		if prev != nil {
+			revert = clone(prev)
+			revert.Version = next.Version + 1
+		}
+		if _, y := s.Store.Update(accountID, next, revert); y != nil {
+			s.Logger.Error(y.Error())
+		}
+		return nil, err
+	}
+	res.Progress = next
+	res.Reward = r
+	e.Progress = next
+	e.At = s.now().Unix()
+	for _, fn := range s.listeners {
+		fn(ctx, accountID, e)
+	}
+	return res, nil
+}
+
+func (s *Stages) grant(
+	accountID uint64, x *Stage, p *Progress, times int64, r *Reward) (
+	*Result, error) {
+	res := new(Result)
+	ref := strconv.FormatUint(accountID, 10) + ":" + x.ID + ":" +
+		strconv.FormatInt(p.Clears, 10)
+	t := a5gwallet.NewTx("stage:"+ref, Reason, Reason)
+	if x.Energy > 0 {
+		t.Debit(s.Config.EnergyCurrency, x.Energy*times)
+	}
+	for c, n := range r.Currencies {
+		t.Credit(c, n)
+	}
+	if len(t.Changes) > 0 {
+		y, err := s.Wallet.Apply(accountID, t)
+		if err != nil {
+			return nil, err
+		}
+		res.Wallet = y
+	}
+	if len(r.Items) > 0 {
+		if s.Inventory == nil {
+			return nil, errors.New("inventory missing")
+		}
+		t := a5ginventory.NewTx(Reason, ref).MailOverflow()
+		for id, n := range r.Items {
+			t.Grant(id, n)
+		}
+		y, err := s.Inventory.Apply(accountID, t)
+		if err != nil {
+			return nil, err
+		}
+		res.Inventory = y
+	}
+	return res, nil
+}
+
+func clone(p *Progress) *Progress {
+	x := *p
+	return &x
+}
@@ -0,0 +1,95 @@
+package a5gstage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestStages(t *testing.T) {
+	c, err := NewConfigJSON([]byte(`{"energyCurrency": "energy", "stages": [
+		{"id": "1-1", "energy": 6, "reward": {"currencies": {"soft": 5}},
+			"firstClear": {"currencies": {"soft": 50}},
+			"perfect": {"currencies": {"gems": 10}}},
+		{"id": "1-2", "energy": 8}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	currencies, _ := a5gwallet.NewCurrencies(a5gwallet.Currency{ID: "energy"},
+		a5gwallet.Currency{ID: "soft"}, a5gwallet.Currency{ID: "gems"})
+	w, _ := a5gwallet.NewWallet(a5gwallet.NewMemoryStore(), currencies, l)
+	if _, err = w.Credit(1, "seed", "test", "test", "energy", 30); err != nil {
+		t.Fatal(err)
+	}
+	var events int
+	s, err := NewStages(c, NewMemoryStore(), w, l,
+		func(ctx context.Context, accountID uint64, e *Event) { events++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	tests := []struct {
+		name     string
+		stageID  string
+		stars    int
+		sweep    int64
+		err      error
+		balances map[string]int64
+	}{
+		{"unknown", "2-1", 0, 1, ErrStageUnknown,
+			map[string]int64{"energy": 30}},
+		{"locked", "1-2", 1, 0, ErrStageLocked,
+			map[string]int64{"energy": 30}},
+		{"sweep uncleared", "1-1", 0, 1, ErrSweepLocked,
+			map[string]int64{"energy": 30}},
+		{"first clear", "1-1", 2, 0, nil,
+			map[string]int64{"energy": 24, "soft": 55}},
+		{"sweep imperfect", "1-1", 0, 1, ErrSweepLocked,
+			map[string]int64{"energy": 24, "soft": 55}},
+		{"perfect", "1-1", 3, 0, nil,
+			map[string]int64{"energy": 18, "soft": 60, "gems": 10}},
+		{"perfect again", "1-1", 3, 0, nil,
+			map[string]int64{"energy": 12, "soft": 65, "gems": 10}},
+		{"sweep", "1-1", 0, 2, nil,
+			map[string]int64{"energy": 0, "soft": 75, "gems": 10}},
+		{"no energy", "1-1", 0, 1, a5gwallet.ErrInsufficientFunds,
+			map[string]int64{"energy": 0, "soft": 75, "gems": 10}},
+	}
+	for _, test := range tests {
+		if test.sweep > 0 {
+			_, err = s.Sweep(ctx, 1, test.stageID, test.sweep)
+		} else {
+			_, err = s.Clear(ctx, 1, test.stageID, test.stars)
+		}
+		if errors.Cause(err) != test.err {
+			t.Fatalf("%s: unexpected error %v", test.name, err)
+		}
+		balances, _ := w.Balances(1)
+		for _, b := range balances {
+			if b.Balance != test.balances[b.Currency] {
+				t.Errorf("%s: unexpected %s balance %d",
+					test.name, b.Currency, b.Balance)
+			}
+		}
+	}
+	stages, err := s.List(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x := stages[0]; x.Stars != 3 || x.Clears != 5 || !x.Sweep ||
+		x.FirstClear != nil || x.Perfect != nil {
+		t.Errorf("unexpected stage %+v", x)
+	}
+	if x := stages[1]; !x.Unlocked || x.Clears != 0 {
+		t.Errorf("unexpected stage %+v", x)
+	}
+	if events != 4 {
+		t.Errorf("expected 4 events, got %d", events)
+	}
+}
@@ -0,0 +1,145 @@
+package a5gstage
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryStore struct {
+	mu       sync.Mutex
+	progress map[uint64]map[string]*Progress
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{progress: make(map[uint64]map[string]*Progress)}
+}
+
+func (s *memoryStore) List(accountID uint64) (map[string]*Progress, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := make(map[string]*Progress, len(s.progress[accountID]))
+	for id, p := range s.progress[accountID] {
+		m[id] = clone(p)
+	}
+	return m, nil
+}
+
+func (s *memoryStore) Update(accountID uint64, prev, next *Progress) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.progress[accountID]
+	if !ok {
+		m = make(map[string]*Progress)
+		s.progress[accountID] = m
+	}
+	var id string
+	if next != nil {
+		id = next.StageID
+	} else {
+		id = prev.StageID
+	}
+	x, ok := m[id]
+	if ok != (prev != nil) || ok && x.Version != prev.Version {
+		return false, nil
+	}
+	if next == nil {
+		delete(m, id)
+	} else {
+		m[id] = clone(next)
+	}
+	return true, nil
+}
+
+// dbStore keeps stage progress in a MySQL table, a row per cleared stage:
+//
+//	CREATE TABLE stage_progress (
+//	  account_id BIGINT UNSIGNED NOT NULL,
+//	  stage_id VARCHAR(64) NOT NULL,
+//	  stars TINYINT NOT NULL,
+//	  clears BIGINT NOT NULL,
+//	  version BIGINT NOT NULL,
+//	  updated_at DATETIME NOT NULL,
+//	  PRIMARY KEY (account_id, stage_id));
+type dbStore struct {
+	pooler    a5gdb.Pooler
+	tableName string
+}
+
+type dbProgress struct {
+	StageID string `db:"stage_id"`
+	Stars   int    `db:"stars"`
+	Clears  int64  `db:"clears"`
+	Version int64  `db:"version"`
+}
+
+func NewDBStore(p a5gdb.Pooler, tableName string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if tableName == "" {
+		return nil, errors.New("empty stage progress table name")
+	}
+	return &dbStore{pooler: p, tableName: tableName}, nil
+}
+
+func (s *dbStore) List(accountID uint64) (map[string]*Progress, error) {
+	var rows []*dbProgress
+	_, err := s.pooler.ReadPool().NewSession().
+		Select("stage_id", "stars", "clears", "version").From(s.tableName).
+		Where(dbr.Eq("account_id", accountID)).Load(&rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	m := make(map[string]*Progress, len(rows))
+	for _, x := range rows {
+		m[x.StageID] = &Progress{
+			StageID: x.StageID,
+			Stars:   x.Stars,
+			Clears:  x.Clears,
+			Version: x.Version}
+	}
+	return m, nil
+}
+
+func (s *dbStore) Update(accountID uint64, prev, next *Progress) (bool, error) {
+	sess := s.pooler.WritePool().NewSession()
+	var (
+		res sql.Result
+		err error
+	)
+	switch {
+	case next == nil:
+		res, err = sess.DeleteFrom(s.tableName).
+			Where(dbr.Eq("account_id", accountID)).
+			Where(dbr.Eq("stage_id", prev.StageID)).
+			Where(dbr.Eq("version", prev.Version)).Exec()
+	case prev == nil:
+		res, err = sess.InsertBySql("INSERT IGNORE INTO "+s.tableName+
+			" (account_id, stage_id, stars, clears, version, updated_at)"+
+			" VALUES (?, ?, ?, ?, ?, ?)",
+			accountID, next.StageID, next.Stars, next.Clears, next.Version,
+			time.Now().UTC()).Exec()
+	default:
+		res, err = sess.Update(s.tableName).
+			Set("stars", next.Stars).
+			Set("clears", next.Clears).
+			Set("version", next.Version).
+			Set("updated_at", time.Now().UTC()).
+			Where(dbr.Eq("account_id", accountID)).
+			Where(dbr.Eq("stage_id", next.StageID)).
+			Where(dbr.Eq("version", prev.Version)).Exec()
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	return n == 1, nil
+}
@@ -0,0 +1,57 @@
+package a5gstreak
+
+import (
+	"context"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+)
+
+// CalendarHandler answers with the streak Calendar of the a5gsession
+// authenticated player.
+func (s *Streaks) CalendarHandler() a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		sess, ok := a5gsession.FromContext(ctx)
+		if !ok {
+			return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+		}
+		c, err := s.Calendar(sess.AccountID)
+		if err != nil {
+			return nil, s.apiErrs(err)
+		}
+		return c, nil
+	}
+}
+
+// ClaimHandler claims today's reward of the a5gsession authenticated
+// player; repeated claims answer with the calendar only.
+func (s *Streaks) ClaimHandler() a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		sess, ok := a5gsession.FromContext(ctx)
+		if !ok {
+			return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+		}
+		res, err := s.Claim(sess.AccountID)
+		if err != nil {
+			return nil, s.apiErrs(err)
+		}
+		return res, nil
+	}
+}
+
+func (s *Streaks) apiErrs(err error) []*a5gapi.APIErr {
+	switch errors.Cause(err) {
+	case a5gwallet.ErrBalanceCapExceeded:
+		return s.Wallet.APIErrs(err)
+	case a5ginventory.ErrCapExceeded, a5ginventory.ErrTabFull:
+		return s.Inventory.APIErrs(err)
+	}
+	s.Logger.Error(err.Error())
+	return a5gapi.NewJSONMsgDefautlErrors(err)
+}
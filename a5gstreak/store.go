@@ -0,0 +1,130 @@
+package a5gstreak
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryStore struct {
+	mu     sync.Mutex
+	states map[uint64]State
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{states: make(map[uint64]State)}
+}
+
+func (s *memoryStore) Get(accountID uint64) (*State, error) {
+	s.mu.Lock()
+	x, ok := s.states[accountID]
+	s.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	return &x, nil
+}
+
+func (s *memoryStore) Claim(accountID uint64, prev, next *State) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	x, ok := s.states[accountID]
+	if ok != (prev != nil) || ok && x != *prev {
+		return false, nil
+	}
+	if next == nil {
+		delete(s.states, accountID)
+	} else {
+		s.states[accountID] = *next
+	}
+	return true, nil
+}
+
+// dbStore keeps streak states in a MySQL table:
+//
+//	CREATE TABLE login_streaks (
+//	  account_id BIGINT UNSIGNED PRIMARY KEY,
+//	  streak INT NOT NULL,
+//	  total INT NOT NULL,
+//	  last_day CHAR(10) NOT NULL,
+//	  updated_at DATETIME NOT NULL);
+type dbStore struct {
+	pooler    a5gdb.Pooler
+	tableName string
+}
+
+type dbState struct {
+	Streak  int    `db:"streak"`
+	Total   int    `db:"total"`
+	LastDay string `db:"last_day"`
+}
+
+func NewDBStore(p a5gdb.Pooler, tableName string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if tableName == "" {
+		return nil, errors.New("empty streak table name")
+	}
+	return &dbStore{pooler: p, tableName: tableName}, nil
+}
+
+func (s *dbStore) Get(accountID uint64) (*State, error) {
+	x := new(dbState)
+	err := s.pooler.ReadPool().NewSession().
+		Select("streak", "total", "last_day").From(s.tableName).
+		Where(dbr.Eq("account_id", accountID)).LoadOne(x)
+	if err == dbr.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	return &State{Streak: x.Streak, Total: x.Total, LastDay: x.LastDay}, nil
+}
+
+func (s *dbStore) Claim(accountID uint64, prev, next *State) (bool, error) {
+	sess := s.pooler.WritePool().NewSession()
+	var (
+		res sql.Result
+		err error
+	)
+	switch {
+	case prev == nil && next == nil:
+		return true, nil
+	case prev == nil:
+		res, err = sess.InsertBySql("INSERT IGNORE INTO "+s.tableName+
+			" (account_id, streak, total, last_day, updated_at)"+
+			" VALUES (?, ?, ?, ?, ?)",
+			accountID, next.Streak, next.Total, next.LastDay,
+			time.Now().UTC()).Exec()
+	case next == nil:
+		res, err = sess.DeleteFrom(s.tableName).
+			Where(dbr.Eq("account_id", accountID)).
+			Where(dbr.Eq("streak", prev.Streak)).
+			Where(dbr.Eq("total", prev.Total)).
+			Where(dbr.Eq("last_day", prev.LastDay)).Exec()
+	default:
+		res, err = sess.Update(s.tableName).
+			Set("streak", next.Streak).
+			Set("total", next.Total).
+			Set("last_day", next.LastDay).
+			Set("updated_at", time.Now().UTC()).
+			Where(dbr.Eq("account_id", accountID)).
+			Where(dbr.Eq("streak", prev.Streak)).
+			Where(dbr.Eq("total", prev.Total)).
+			Where(dbr.Eq("last_day", prev.LastDay)).Exec()
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	return n == 1, nil
+}
@@ -0,0 +1,314 @@
+package a5gstreak
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5greset"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+)
+
+// Reason of wallet and inventory transactions of streak rewards.
+const Reason = "login_streak"
+
+const dayKeyLayout = "2006-01-02"
+
+// Reward is what a streak day grants: wallet currencies and inventory
+// items.
+type Reward struct {
+	Currencies map[string]int64 `json:"currencies,omitempty"`
+	Items      map[string]int64 `json:"items,omitempty"`
+}
+
+// Config is an balance data of the streak calendar. Days are rewards of
+// consecutive claims, Cycle starts the calendar over after the last day
+// instead of repeating it; Grace is the number of days a player may miss
+// without breaking the streak.
+type Config struct {
+	Days  []*Reward `json:"days"`
+	Cycle bool      `json:"cycle,omitempty"`
+	Grace int       `json:"grace,omitempty"`
+}
+
+// State is the streak of a player; LastDay is the key of the game day of
+// the last claim, empty before the first one.
+type State struct {
+	Streak  int    `json:"streak"`
+	Total   int    `json:"total"`
+	LastDay string `json:"lastDay"`
+}
+
+// Store keeps streak states. Claim replaces the state of a player only
+// while it is still prev, reporting whether it did; nil prev stands for no
+// state and nil next removes it.
+type Store interface {
+	Get(accountID uint64) (*State, error)
+	Claim(accountID uint64, prev, next *State) (bool, error)
+}
+
+// Streaks tracks consecutive daily claims on game days of a5greset, so
+// players with ModePlayer resets claim at their own midnight.
+type Streaks struct {
+	Config    *Config
+	Store     Store
+	Reset     *a5greset.Service
+	Wallet    *a5gwallet.Wallet
+	Inventory *a5ginventory.Inventory
+	Logger    a5glogs.Logger
+
+	now func() time.Time
+}
+
+func NewStreaks(
+	c *Config, s Store, r *a5greset.Service, l a5glogs.Logger) (*Streaks, error) {
+	if c == nil {
+		return nil, errors.New("nil streak config")
+	}
+	if len(c.Days) == 0 {
+		return nil, errors.New("empty streak days")
+	}
+	if c.Grace < 0 {
+		return nil, errors.New("negative streak grace")
+	}
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if r == nil {
+		return nil, errors.New("reset service missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Streaks{
+		Config: c, Store: s, Reset: r, Logger: l, now: time.Now}, nil
+}
+
+func NewConfigJSON(b []byte) (*Config, error) {
+	c := new(Config)
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return c, nil
+}
+
+// CalendarDay is a reward of the calendar, Status is one of "claimed",
+// "today" (claimable), "next" (claimed tomorrow) or "locked".
+type CalendarDay struct {
+	Day    int     `json:"day"`
+	Reward *Reward `json:"reward"`
+	Status string  `json:"status"`
+}
+
+// Calendar is the streak state for the client UI. BreaksAt is when the
+// streak breaks without a claim and NextDayAt when the next claim opens,
+// both in unix seconds.
+type Calendar struct {
+	Streak    int            `json:"streak"`
+	Total     int            `json:"total"`
+	CanClaim  bool           `json:"canClaim"`
+	NextDayAt int64          `json:"nextDayAt"`
+	BreaksAt  int64          `json:"breaksAt,omitempty"`
+	Days      []*CalendarDay `json:"days"`
+}
+
+// ClaimResult is the payload of a claim. A claim repeated on the same day
+// is Replayed: nothing is granted again.
+type ClaimResult struct {
+	Calendar  *Calendar             `json:"calendar"`
+	Reward    *Reward               `json:"reward,omitempty"`
+	Wallet    *a5gwallet.Result     `json:"wallet,omitempty"`
+	Inventory *a5ginventory.Changes `json:"inventory,omitempty"`
+	Replayed  bool                  `json:"replayed,omitempty"`
+}
+
+// Calendar returns the streak calendar of a player.
+func (s *Streaks) Calendar(accountID uint64) (*Calendar, error) {
+	x, day, err := s.load(accountID)
+	if err != nil {
+		return nil, err
+	}
+	return s.calendar(x, day), nil
+}
+
+// Claim grants the reward of today, once a game day. A failed grant
+// reverts the claim so the player may retry: wallet transactions are
+// idempotent by the day and inventory ones are atomic.
+func (s *Streaks) Claim(accountID uint64) (*ClaimResult, error) {
+	prev, day, err := s.load(accountID)
+	if err != nil {
+		return nil, err
+	}
+	if prev.LastDay == day.Key {
+		return &ClaimResult{Calendar: s.calendar(prev, day), Replayed: true}, nil
+	}
+	next := &State{
+		Streak:  s.streak(prev, day) + 1,
+		Total:   prev.Total + 1,
+		LastDay: day.Key}
+	var p *State
+	if prev.LastDay != "" {
+		p = prev
+	}
+	ok, err := s.Store.Claim(accountID, p, next)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		// Claimed concurrently, answer as a repeated claim.
+		return s.replay(accountID)
+	}
+	reward := s.reward(next.Streak)
+	res, err := s.grant(accountID, day.Key, reward)
+	if err != nil {
+		if _, x := s.Store.Claim(accountID, next, p); x != nil {
+			s.Logger.Error(x.Error())
+		}
+		return nil, err
+	}
+	res.Calendar = s.calendar(next, day)
+	res.Reward = reward
+	return res, nil
+}
+
+func (s *Streaks) replay(accountID uint64) (*ClaimResult, error) {
+	x, day, err := s.load(accountID)
+	if err != nil {
+		return nil, err
+	}
+	return &ClaimResult{Calendar: s.calendar(x, day), Replayed: true}, nil
+}
+
+func (s *Streaks) load(accountID uint64) (*State, a5greset.Period, error) {
+	day, err := s.Reset.Day(int64(accountID), s.now())
+	if err != nil {
+		return nil, day, err
+	}
+	x, err := s.Store.Get(accountID)
+	if err != nil {
+		return nil, day, err
+	}
+	if x == nil {
+		x = new(State)
+	}
+	return x, day, nil
+}
+
+// streak is the streak going on at day, zero when broken.
+func (s *Streaks) streak(x *State, day a5greset.Period) int {
+	if x.LastDay == "" {
+		return 0
+	}
+	n, err := daysBetween(x.LastDay, day.Key)
+	if err != nil || n < 0 || n > s.Config.Grace+1 {
+		return 0
+	}
+	return x.Streak
+}
+
+// daysBetween counts calendar days between day keys, so it does not
+// depend on DST or the reset offset.
+func daysBetween(from, to string) (int, error) {
+	a, err := time.Parse(dayKeyLayout, from)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	b, err := time.Parse(dayKeyLayout, to)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return int(b.Sub(a).Hours()/24 + 0.5), nil
+}
+
+// index is the calendar day of the nth claim of a streak, from zero.
+func (s *Streaks) index(n int) int {
+	k := len(s.Config.Days)
+	if s.Config.Cycle {
+		return (n - 1) % k
+	}
+	if n > k {
+		return k - 1
+	}
+	return n - 1
+}
+
+func (s *Streaks) reward(n int) *Reward {
+	return s.Config.Days[s.index(n)]
+}
+
+func (s *Streaks) calendar(x *State, day a5greset.Period) *Calendar {
+	claimed := x.LastDay == day.Key
+	streak := x.Streak
+	if !claimed {
+		streak = s.streak(x, day)
+	}
+	c := &Calendar{
+		Streak:    streak,
+		Total:     x.Total,
+		CanClaim:  !claimed,
+		NextDayAt: day.End.Unix()}
+	if streak > 0 {
+		// The streak survives Grace missed days after the day following
+		// the last claim.
+		if n, err := daysBetween(x.LastDay, day.Key); err == nil {
+			c.BreaksAt = day.End.AddDate(0, 0, s.Config.Grace+1-n).Unix()
+		}
+	}
+	// Days of the current lap of the calendar.
+	n := streak
+	if !claimed {
+		n++
+	}
+	current := s.index(n)
+	for i, r := range s.Config.Days {
+		d := &CalendarDay{Day: i + 1, Reward: r, Status: "locked"}
+		switch {
+		case i < current || i == current && claimed:
+			d.Status = "claimed"
+		case i == current:
+			d.Status = "today"
+		case i == current+1 && claimed:
+			d.Status = "next"
+		}
+		c.Days = append(c.Days, d)
+	}
+	return c
+}
+
+func (s *Streaks) grant(
+	accountID uint64, dayKey string, r *Reward) (*ClaimResult, error) {
+	res := new(ClaimResult)
+	ref := strconv.FormatUint(accountID, 10) + ":" + dayKey
+	if len(r.Currencies) > 0 {
+		if s.Wallet == nil {
+			return nil, errors.New("wallet missing")
+		}
+		t := a5gwallet.NewTx("streak:"+ref, Reason, Reason)
+		for c, n := range r.Currencies {
+			t.Credit(c, n)
+		}
+		x, err := s.Wallet.Apply(accountID, t)
+		if err != nil {
+			return nil, err
+		}
+		res.Wallet = x
+	}
+	if len(r.Items) > 0 {
+		if s.Inventory == nil {
+			return nil, errors.New("inventory missing")
+		}
+		t := a5ginventory.NewTx(Reason, ref).MailOverflow()
+		for id, n := range r.Items {
+			t.Grant(id, n)
+		}
+		x, err := s.Inventory.Apply(accountID, t)
+		if err != nil {
+			return nil, err
+		}
+		res.Inventory = x
+	}
+	return res, nil
+}
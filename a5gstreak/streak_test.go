@@ -0,0 +1,90 @@
+package a5gstreak
+
+import (
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5greset"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/sirupsen/logrus"
+)
+
+func TestStreaksClaim(t *testing.T) {
+	c, err := NewConfigJSON([]byte(`{"grace": 1, "cycle": true, "days": [
+		{"currencies": {"soft": 10}}, {"currencies": {"soft": 20}},
+		{"currencies": {"soft": 30}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reset, err := a5greset.NewService(
+		&a5greset.Reset{Location: time.UTC, Offset: 4 * time.Hour},
+		a5greset.ModeGame, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	s, err := NewStreaks(c, NewMemoryStore(), reset, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	currencies, _ := a5gwallet.NewCurrencies(a5gwallet.Currency{ID: "soft"})
+	s.Wallet, _ = a5gwallet.NewWallet(a5gwallet.NewMemoryStore(), currencies, l)
+	start := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		at       time.Time
+		streak   int
+		granted  int64
+		replayed bool
+		statuses string
+	}{
+		{"first", start, 1, 10, false, "claimed next locked"},
+		{"same day", start.Add(8 * time.Hour), 1, 0, true, "claimed next locked"},
+		// 03:00 is still the game day of the first claim.
+		{"before reset", start.Add(15 * time.Hour), 1, 0, true,
+			"claimed next locked"},
+		{"next day", start.Add(24 * time.Hour), 2, 20, false,
+			"claimed claimed next"},
+		{"within grace", start.Add(72 * time.Hour), 3, 30, false,
+			"claimed claimed claimed"},
+		{"cycled", start.Add(96 * time.Hour), 4, 10, false,
+			"claimed next locked"},
+		{"broken", start.Add(168 * time.Hour), 1, 10, false,
+			"claimed next locked"},
+	}
+	for _, test := range tests {
+		at := test.at
+		s.now = func() time.Time { return at }
+		res, err := s.Claim(1)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		var granted int64
+		if res.Wallet != nil {
+			granted = res.Wallet.Changes[0].Amount
+		}
+		var statuses string
+		for i, d := range res.Calendar.Days {
+			if i > 0 {
+				statuses += " "
+			}
+			statuses += d.Status
+		}
+		if res.Calendar.Streak != test.streak || granted != test.granted ||
+			res.Replayed != test.replayed || statuses != test.statuses {
+			t.Errorf("%s: unexpected streak %d, granted %d, replayed %v, %q",
+				test.name, res.Calendar.Streak, granted, res.Replayed, statuses)
+		}
+	}
+	s.now = func() time.Time { return start.Add(192 * time.Hour) }
+	x, err := s.Calendar(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Claimed on Mar 8, the streak breaks once Mar 10 ends at 04:00 Mar 11.
+	breaks := time.Date(2020, 3, 11, 4, 0, 0, 0, time.UTC).Unix()
+	if !x.CanClaim || x.Streak != 1 || x.BreaksAt != breaks {
+		t.Errorf("unexpected calendar %+v", x)
+	}
+}
@@ -0,0 +1,62 @@
+package a5gtimeline
+
+import (
+	"context"
+	"time"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5gcursor"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gvalidate"
+)
+
+const cursorKind = "timeline"
+
+type TimelineRequest struct {
+	AccountID uint64   `json:"accountId" validate:"required"`
+	Kinds     []string `json:"kinds"`
+	// From and To bound event times in unix seconds, zero is unbound.
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+// TimelineHandler answers with a page of a player timeline, newest
+// first, mount it on an admin route class.
+func (t *Timeline) TimelineHandler(
+	c *a5gcursor.Cursors, l a5gcursor.PageLimits) a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(TimelineRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			r := req.Payload.(*TimelineRequest)
+			cursor := new(Cursor)
+			limit, isFirst, e := c.ParsePage(req, cursorKind, r.AccountID, l, cursor)
+			if e != nil {
+				return nil, []*a5gapi.APIErr{e}
+			}
+			if isFirst {
+				cursor = nil
+			}
+			q := &Query{Kinds: r.Kinds}
+			if r.From > 0 {
+				q.From = time.Unix(r.From, 0)
+			}
+			if r.To > 0 {
+				q.To = time.Unix(r.To, 0)
+			}
+			events, next, err := t.Page(r.AccountID, q, cursor, limit)
+			if err != nil {
+				return nil, t.apiErrs(err)
+			}
+			page, err := c.NextPage(cursorKind, r.AccountID, limit, next != nil, nil, next)
+			if err != nil {
+				return nil, t.apiErrs(err)
+			}
+			return &a5gapi.Paged{Items: events, Page: page}, nil
+		})
+}
+
+func (t *Timeline) apiErrs(err error) []*a5gapi.APIErr {
+	t.Logger.Error(err.Error())
+	return a5gapi.NewJSONMsgDefautlErrors(err)
+}
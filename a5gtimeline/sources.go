@@ -0,0 +1,117 @@
+package a5gtimeline
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+)
+
+// WalletSource serves wallet ledger entries of a player; credits of at
+// least BigGrants of their currency are KindBigGrant events. The ledger
+// serves its latest entries only, so the timeline reaches Scan entries
+// back.
+type WalletSource struct {
+	Wallet    *a5gwallet.Wallet
+	BigGrants map[string]int64
+	Scan      int
+}
+
+func NewWalletSource(w *a5gwallet.Wallet) (*WalletSource, error) {
+	if w == nil {
+		return nil, errors.New("wallet missing")
+	}
+	return &WalletSource{
+		Wallet:    w,
+		BigGrants: make(map[string]int64),
+		Scan:      1000}, nil
+}
+
+func (s *WalletSource) Events(
+	accountID uint64, q *Query, before time.Time, limit int) ([]*Event, error) {
+	entries, err := s.Wallet.Store.Ledger(a5gwallet.PlayerAccount(accountID), s.Scan)
+	if err != nil {
+		return nil, err
+	}
+	a := []*Event{}
+	for _, x := range entries {
+		if len(a) >= limit {
+			break
+		}
+		if !before.IsZero() && x.CreatedAt.After(before) {
+			continue
+		}
+		e := &Event{
+			AccountID: accountID,
+			Kind:      KindWallet,
+			Source:    "wallet",
+			At:        x.CreatedAt.UTC(),
+			Summary:   signed(x.Amount) + " " + x.Currency + " " + x.Reason,
+			RefID:     x.TxID}
+		if big := s.BigGrants[x.Currency]; big > 0 && x.Amount >= big {
+			e.Kind = KindBigGrant
+		}
+		if e.Data, err = json.Marshal(x); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if q.Match(e) {
+			a = append(a, e)
+		}
+	}
+	return a, nil
+}
+
+// InventorySource serves inventory audit log entries of a player, Scan
+// entries back like WalletSource.
+type InventorySource struct {
+	Inventory *a5ginventory.Inventory
+	Scan      int
+}
+
+func NewInventorySource(inv *a5ginventory.Inventory) (*InventorySource, error) {
+	if inv == nil {
+		return nil, errors.New("inventory missing")
+	}
+	return &InventorySource{Inventory: inv, Scan: 1000}, nil
+}
+
+func (s *InventorySource) Events(
+	accountID uint64, q *Query, before time.Time, limit int) ([]*Event, error) {
+	entries, err := s.Inventory.Store.Log(accountID, s.Scan)
+	if err != nil {
+		return nil, err
+	}
+	a := []*Event{}
+	for _, x := range entries {
+		if len(a) >= limit {
+			break
+		}
+		if !before.IsZero() && x.CreatedAt.After(before) {
+			continue
+		}
+		e := &Event{
+			AccountID: accountID,
+			Kind:      KindInventory,
+			Source:    "inventory",
+			At:        x.CreatedAt.UTC(),
+			Summary:   signed(x.Delta) + " " + x.ItemID + " " + x.Reason,
+			RefID:     x.RefID}
+		if e.Data, err = json.Marshal(x); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if q.Match(e) {
+			a = append(a, e)
+		}
+	}
+	return a, nil
+}
+
+func signed(n int64) string {
+	if n > 0 {
+		return "+" + strconv.FormatInt(n, 10)
+	}
+	return strconv.FormatInt(n, 10)
+}
@@ -0,0 +1,128 @@
+package a5gtimeline
+
+import (
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryStore struct {
+	mu     sync.Mutex
+	events map[uint64][]Event
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{events: make(map[uint64][]Event)}
+}
+
+func (s *memoryStore) Append(e *Event) error {
+	s.mu.Lock()
+	s.events[e.AccountID] = append(s.events[e.AccountID], *e)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryStore) Events(
+	accountID uint64, q *Query, before time.Time, limit int) ([]*Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := []*Event{}
+	events := s.events[accountID]
+	for i := len(events) - 1; i >= 0 && len(a) < limit; i-- {
+		e := events[i]
+		if (before.IsZero() || !e.At.After(before)) && q.Match(&e) {
+			a = append(a, &e)
+		}
+	}
+	return a, nil
+}
+
+// dbStore keeps recorded events in a MySQL table:
+//
+//	CREATE TABLE timeline_events (
+//	  id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+//	  account_id BIGINT UNSIGNED NOT NULL,
+//	  kind VARCHAR(32) NOT NULL,
+//	  summary VARCHAR(255) NOT NULL,
+//	  ref_id VARCHAR(128) NOT NULL,
+//	  data TEXT NOT NULL,
+//	  created_at DATETIME(6) NOT NULL,
+//	  KEY (account_id, created_at));
+type dbStore struct {
+	pooler    a5gdb.Pooler
+	tableName string
+}
+
+type dbEvent struct {
+	AccountID uint64    `db:"account_id"`
+	Kind      string    `db:"kind"`
+	Summary   string    `db:"summary"`
+	RefID     string    `db:"ref_id"`
+	Data      string    `db:"data"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+func NewDBStore(p a5gdb.Pooler, tableName string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if tableName == "" {
+		return nil, errors.New("empty timeline table name")
+	}
+	return &dbStore{pooler: p, tableName: tableName}, nil
+}
+
+func (s *dbStore) Append(e *Event) error {
+	_, err := s.pooler.WritePool().NewSession().InsertInto(s.tableName).
+		Pair("account_id", e.AccountID).
+		Pair("kind", e.Kind).
+		Pair("summary", e.Summary).
+		Pair("ref_id", e.RefID).
+		Pair("data", string(e.Data)).
+		Pair("created_at", e.At).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	return nil
+}
+
+func (s *dbStore) Events(
+	accountID uint64, q *Query, before time.Time, limit int) ([]*Event, error) {
+	stmt := s.pooler.ReadPool().NewSession().
+		Select("account_id", "kind", "summary", "ref_id", "data", "created_at").
+		From(s.tableName).Where(dbr.Eq("account_id", accountID)).
+		OrderDesc("created_at").OrderDesc("id").Limit(uint64(limit))
+	if !before.IsZero() {
+		stmt.Where(dbr.Lte("created_at", before))
+	}
+	if !q.From.IsZero() {
+		stmt.Where(dbr.Gte("created_at", q.From))
+	}
+	if !q.To.IsZero() {
+		stmt.Where(dbr.Lt("created_at", q.To))
+	}
+	if len(q.Kinds) > 0 {
+		stmt.Where(dbr.Eq("kind", q.Kinds))
+	}
+	var a []*dbEvent
+	if _, err := stmt.Load(&a); err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	events := make([]*Event, len(a))
+	for i, x := range a {
+		events[i] = &Event{
+			AccountID: x.AccountID,
+			Kind:      x.Kind,
+			Source:    "record",
+			At:        x.CreatedAt.UTC(),
+			Summary:   x.Summary,
+			RefID:     x.RefID}
+		if x.Data != "" {
+			events[i].Data = []byte(x.Data)
+		}
+	}
+	return events, nil
+}
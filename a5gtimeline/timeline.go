@@ -0,0 +1,199 @@
+package a5gtimeline
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+// Kinds of events of the built-in sources; recorded events have kinds of
+// their own, e.g. "login", "purchase" and "ban".
+const (
+	KindWallet    = "wallet"
+	KindBigGrant  = "big_grant"
+	KindInventory = "inventory"
+)
+
+// Event is an entry of a player timeline. Source names where it comes
+// from, RefID is its ID there, e.g. a transaction ID.
+type Event struct {
+	AccountID uint64          `json:"accountId"`
+	Kind      string          `json:"kind"`
+	Source    string          `json:"source"`
+	At        time.Time       `json:"at"`
+	Summary   string          `json:"summary,omitempty"`
+	RefID     string          `json:"refId,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+}
+
+// Query filters a timeline, empty fields match every event.
+type Query struct {
+	Kinds []string
+	From  time.Time
+	To    time.Time
+}
+
+// Match reports whether e is within the query.
+func (q *Query) Match(e *Event) bool {
+	if !q.From.IsZero() && e.At.Before(q.From) || !q.To.IsZero() && !e.At.Before(q.To) {
+		return false
+	}
+	if len(q.Kinds) == 0 {
+		return true
+	}
+	for _, k := range q.Kinds {
+		if k == e.Kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Source serves events of a player matching q at or before before (any
+// when zero), newest first, up to limit.
+type Source interface {
+	Events(accountID uint64, q *Query, before time.Time, limit int) ([]*Event, error)
+}
+
+// Store keeps events recorded from the audit and analytics streams.
+type Store interface {
+	Source
+	Append(e *Event) error
+}
+
+// Timeline merges the Store and Sources, e.g. the wallet and the
+// inventory ledgers, into one timeline per player for support staff.
+type Timeline struct {
+	Store   Store
+	Sources []Source
+	// Tracked are analytics events recorded by Track, by event name.
+	Tracked map[string]bool
+	Logger  a5glogs.Logger
+
+	now func() time.Time
+}
+
+func NewTimeline(s Store, sources []Source, l a5glogs.Logger) (*Timeline, error) {
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	for _, x := range sources {
+		if x == nil {
+			return nil, errors.New("nil timeline source")
+		}
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Timeline{
+		Store:   s,
+		Sources: sources,
+		Tracked: make(map[string]bool),
+		Logger:  l,
+		now:     time.Now}, nil
+}
+
+// Record appends an event of the audit stream, e.g. a ban; data is
+// marshaled to JSON.
+func (t *Timeline) Record(
+	accountID uint64, kind, refID, summary string, data interface{}) error {
+	if accountID == 0 || kind == "" {
+		return errors.New("invalid timeline event")
+	}
+	e := &Event{
+		AccountID: accountID,
+		Kind:      kind,
+		Source:    "record",
+		At:        t.now().UTC(),
+		Summary:   summary,
+		RefID:     refID}
+	if data != nil {
+		b, err := json.Marshal(data)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		e.Data = b
+	}
+	return t.Store.Append(e)
+}
+
+// Track records Tracked events of the analytics stream, so a Timeline
+// is an a5gconsent.Tracker.
+func (t *Timeline) Track(
+	ctx context.Context, accountID uint64, event string, payload interface{}) error {
+	if !t.Tracked[event] {
+		return nil
+	}
+	return t.Record(accountID, event, "", "", payload)
+}
+
+// Cursor is where a page ends: its last event time and how many events
+// of that very time were served.
+type Cursor struct {
+	Before int64 `json:"before"`
+	Skip   int   `json:"skip"`
+}
+
+func less(a, b *Event) bool {
+	if !a.At.Equal(b.At) {
+		return a.At.After(b.At)
+	}
+	if a.Source != b.Source {
+		return a.Source < b.Source
+	}
+	if a.Kind != b.Kind {
+		return a.Kind < b.Kind
+	}
+	return a.RefID < b.RefID
+}
+
+// Page serves up to limit events after c (from the newest when nil) and
+// the cursor of the next page, nil when there are no more.
+func (t *Timeline) Page(
+	accountID uint64, q *Query, c *Cursor, limit int) ([]*Event, *Cursor, error) {
+	if limit < 1 {
+		return nil, nil, errors.New("invalid timeline page limit")
+	}
+	var before time.Time
+	skip := 0
+	if c != nil {
+		before, skip = time.Unix(0, c.Before).UTC(), c.Skip
+	}
+	n := limit + skip + 1
+	var a []*Event
+	for _, s := range append([]Source{t.Store}, t.Sources...) {
+		events, err := s.Events(accountID, q, before, n)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, e := range events {
+			if q.Match(e) {
+				a = append(a, e)
+			}
+		}
+	}
+	sort.SliceStable(a, func(i, j int) bool { return less(a[i], a[j]) })
+	if skip > len(a) {
+		skip = len(a)
+	}
+	a = a[skip:]
+	if len(a) <= limit {
+		return a, nil, nil
+	}
+	a = a[:limit]
+	last := a[len(a)-1].At
+	next := &Cursor{Before: last.UnixNano()}
+	if c != nil && last.Equal(before) {
+		next.Skip = c.Skip
+	}
+	for _, e := range a {
+		if e.At.Equal(last) {
+			next.Skip++
+		}
+	}
+	return a, next, nil
+}
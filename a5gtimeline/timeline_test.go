@@ -0,0 +1,102 @@
+package a5gtimeline
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/sirupsen/logrus"
+)
+
+func TestTimelinePage(t *testing.T) {
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	c, _ := a5gwallet.NewCurrencies(a5gwallet.Currency{ID: "gold"})
+	w, _ := a5gwallet.NewWallet(a5gwallet.NewMemoryStore(), c, l)
+	catalog, _ := a5ginventory.NewCatalogJSON([]byte(`{"items": [{"id": "hat"}]}`))
+	inv, _ := a5ginventory.NewInventory(a5ginventory.NewMemoryStore(), catalog, l)
+	ws, _ := NewWalletSource(w)
+	ws.BigGrants["gold"] = 1000
+	is, _ := NewInventorySource(inv)
+	tl, err := NewTimeline(NewMemoryStore(), []Source{ws, is}, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tl.Tracked["login"] = true
+
+	// Recorded events are older than ledger entries, three of them at
+	// the same time to page through.
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tl.now = func() time.Time { return now }
+	if err = tl.Track(context.Background(), 7, "login", map[string]string{"ip": "10.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = tl.Track(context.Background(), 7, "tap", nil); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Hour)
+	for _, ref := range []string{"p1", "p2", "p3"} {
+		if err = tl.Record(7, "purchase", ref, "", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = tl.Record(8, "ban", "b1", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Credit(7, "tx1", "test", "quest", "gold", 10); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Credit(7, "tx2", "test", "support", "gold", 5000); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = inv.Apply(7, a5ginventory.NewTx("shop", "o1").Grant("hat", 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []*Event
+	var cursor *Cursor
+	for i := 0; i < 10; i++ {
+		var page []*Event
+		page, cursor, err = tl.Page(7, &Query{}, cursor, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, page...)
+		if cursor == nil {
+			break
+		}
+	}
+	if len(got) != 7 {
+		t.Fatalf("unexpected %d events", len(got))
+	}
+	seen := make(map[string]bool)
+	for i, e := range got {
+		if i > 0 && e.At.After(got[i-1].At) {
+			t.Errorf("%d: events out of order", i)
+		}
+		if seen[e.Kind+e.RefID] {
+			t.Errorf("%d: %s %s served twice", i, e.Kind, e.RefID)
+		}
+		seen[e.Kind+e.RefID] = true
+	}
+	if last := got[6]; last.Kind != "login" || string(last.Data) != `{"ip":"10.0.0.1"}` {
+		t.Errorf("unexpected oldest event %+v", last)
+	}
+
+	big, _, err := tl.Page(7, &Query{Kinds: []string{KindBigGrant, "purchase"}}, nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(big) != 4 || big[0].RefID != "tx2" || big[0].Summary != "+5000 gold support" {
+		t.Errorf("unexpected filtered events %+v", big)
+	}
+	old, _, err := tl.Page(7, &Query{To: now}, nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(old) != 1 || old[0].Kind != "login" {
+		t.Errorf("unexpected bounded events %+v", old)
+	}
+}
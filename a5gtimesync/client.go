@@ -0,0 +1,65 @@
+package a5gtimesync
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Sample is one time sync round trip measured by a client: local times of
+// sending the request and receiving the response and the response server
+// time.
+type Sample struct {
+	Sent       time.Time
+	Received   time.Time
+	ServerTime time.Time
+	Seq        uint64
+}
+
+func (s Sample) RTT() time.Duration { return s.Received.Sub(s.Sent) }
+
+// Offset is server time minus client time assuming symmetric network
+// delays; add it to local time to get server time.
+func (s Sample) Offset() time.Duration {
+	mid := s.Sent.Add(s.RTT() / 2)
+	return s.ServerTime.Sub(mid)
+}
+
+// Estimate picks the offset of the fastest round trip, whose error is
+// bounded by its RTT/2, and reports the spread (drift) of offsets of the
+// other samples. Samples received out of Seq order or with a negative RTT
+// are ignored.
+func Estimate(samples []Sample) (offset, rtt, drift time.Duration, ok bool) {
+	var a []Sample
+	var lastSeq uint64
+	sorted := append([]Sample(nil), samples...)
+	sort.SliceStable(sorted, func(i, k int) bool {
+		return sorted[i].Received.Before(sorted[k].Received)
+	})
+	for _, s := range sorted {
+		if s.RTT() < 0 || (s.Seq != 0 && s.Seq <= lastSeq) {
+			continue
+		}
+		if s.Seq != 0 {
+			lastSeq = s.Seq
+		}
+		a = append(a, s)
+	}
+	if len(a) == 0 {
+		return 0, 0, 0, false
+	}
+	best := a[0]
+	min, max := time.Duration(math.MaxInt64), time.Duration(math.MinInt64)
+	for _, s := range a {
+		if s.RTT() < best.RTT() {
+			best = s
+		}
+		if o := s.Offset(); o < min {
+			min = o
+		}
+		if o := s.Offset(); o > max {
+			max = o
+		}
+	}
+	return best.Offset(), best.RTT(), max - min, true
+}
@@ -0,0 +1,94 @@
+package a5gtimesync
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+)
+
+var ErrCodeClientTimeSkewed = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+	Code:     4003,
+	Name:     "client_time_skewed",
+	Severity: a5gapi.ErrSeverityWarn,
+	Public:   true,
+	Message:  "client time is out of sync"})
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeClientTimeSkewed, http.StatusBadRequest)
+}
+
+// SyncRequest and SyncResponse times are unix milliseconds.
+type SyncRequest struct {
+	ClientTime int64 `json:"clientTime,omitempty"`
+}
+
+type SyncResponse struct {
+	// ClientTime echoes the request one so clients match samples.
+	ClientTime int64 `json:"clientTime,omitempty"`
+	ServerTime int64 `json:"serverTime"`
+	// Seq grows with every answer of this server instance, clients drop
+	// samples arriving out of order.
+	Seq uint64 `json:"seq"`
+}
+
+// Syncer answers time sync requests.
+type Syncer struct {
+	seq uint64
+	now func() time.Time
+}
+
+func NewSyncer() *Syncer { return &Syncer{now: time.Now} }
+
+func (s *Syncer) Handler() a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		p := new(SyncRequest)
+		// The payload is optional, the server time is useful without it.
+		_ = a5ghttp.DecodePayload(req, p)
+		return &SyncResponse{
+			ClientTime: p.ClientTime,
+			ServerTime: Millis(s.now()),
+			Seq:        atomic.AddUint64(&s.seq, 1)}, nil
+	}
+}
+
+// Tolerance bounds how far behind (Past) and ahead of (Future) server time
+// client-supplied timestamps may be.
+type Tolerance struct {
+	Past   time.Duration
+	Future time.Duration
+}
+
+func (t Tolerance) Allowed(clientTime, now time.Time) bool {
+	d := clientTime.Sub(now)
+	return d <= t.Future && -d <= t.Past
+}
+
+// Check returns a public error for a skewed clientTime, nil otherwise.
+func (t Tolerance) Check(clientTime, now time.Time) *a5gapi.APIErr {
+	if t.Allowed(clientTime, now) {
+		return nil
+	}
+	return a5gapi.NewErr(ErrCodeClientTimeSkewed,
+		"client %d, server %d", clientTime.Unix(), now.Unix())
+}
+
+// CheckRequest checks the envelope Time (unix seconds) if the client set
+// one.
+func (t Tolerance) CheckRequest(
+	req *a5gapi.APIMsgRequest, now time.Time) *a5gapi.APIErr {
+	if req.Time == 0 {
+		return nil
+	}
+	return t.Check(time.Unix(int64(req.Time), 0), now)
+}
+
+func Millis(t time.Time) int64 { return t.UnixNano() / int64(time.Millisecond) }
+
+func FromMillis(i int64) time.Time {
+	return time.Unix(0, i*int64(time.Millisecond))
+}
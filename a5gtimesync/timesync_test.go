@@ -0,0 +1,93 @@
+package a5gtimesync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5gapi"
+)
+
+func TestEstimate(t *testing.T) {
+	t0 := time.Unix(1000, 0)
+	ms := time.Millisecond
+	// sample is a round trip sent at local ms sent, answered by a server
+	// ahead by 5s after d1 and received after another d2.
+	sample := func(seq uint64, sent, d1, d2 time.Duration) Sample {
+		return Sample{Sent: t0.Add(sent), Received: t0.Add(sent + d1 + d2),
+			ServerTime: t0.Add(sent + d1 + 5*time.Second), Seq: seq}
+	}
+	tests := []struct {
+		name    string
+		samples []Sample
+		offset  time.Duration
+		rtt     time.Duration
+		drift   time.Duration
+		ok      bool
+	}{
+		{"none", nil, 0, 0, 0, false},
+		{"symmetric", []Sample{sample(1, 0, 40*ms, 40*ms)},
+			5 * time.Second, 80 * ms, 0, true},
+		// The slow asymmetric sample is off by (d1-d2)/2, the fast one wins.
+		{"fastest", []Sample{
+			sample(1, 0, 300*ms, 100*ms),
+			sample(2, time.Second, 10*ms, 10*ms)},
+			5 * time.Second, 20 * ms, 100 * ms, true},
+		{"out of order", []Sample{
+			sample(2, 0, 50*ms, 50*ms),
+			sample(1, time.Second, 5*ms, 5*ms)},
+			5 * time.Second, 100 * ms, 0, true},
+		{"negative rtt", []Sample{
+			{Sent: t0, Received: t0.Add(-ms), ServerTime: t0}}, 0, 0, 0, false},
+	}
+	for _, x := range tests {
+		offset, rtt, drift, ok := Estimate(x.samples)
+		if offset != x.offset || rtt != x.rtt || drift != x.drift || ok != x.ok {
+			t.Errorf("%s: Estimate() => %v %v %v %v want %v %v %v %v", x.name,
+				offset, rtt, drift, ok, x.offset, x.rtt, x.drift, x.ok)
+		}
+	}
+}
+
+func TestTolerance(t *testing.T) {
+	now := time.Unix(1000, 0)
+	tol := Tolerance{Past: time.Minute, Future: 5 * time.Second}
+	tests := []struct {
+		time uint64
+		ok   bool
+	}{
+		{0, true},
+		{1000, true},
+		{940, true},
+		{939, false},
+		{1005, true},
+		{1006, false},
+	}
+	for _, x := range tests {
+		err := tol.CheckRequest(&a5gapi.APIMsgRequest{Time: x.time}, now)
+		if (err == nil) != x.ok {
+			t.Errorf("time %d: CheckRequest() => %v", x.time, err)
+		}
+		if err != nil && err.Code != uint64(ErrCodeClientTimeSkewed) {
+			t.Errorf("time %d: code %d", x.time, err.Code)
+		}
+	}
+}
+
+func TestSyncer(t *testing.T) {
+	s := NewSyncer()
+	s.now = func() time.Time { return time.Unix(1000, 0) }
+	h := s.Handler()
+	var last uint64
+	for i := 0; i < 2; i++ {
+		v, errs := h(context.Background(), &a5gapi.APIMsgRequest{})
+		r, ok := v.(*SyncResponse)
+		if !ok || len(errs) != 0 || r.ServerTime != 1000000 || r.Seq <= last {
+			t.Fatalf("unexpected answer %+v %v", v, errs)
+		}
+		last = r.Seq
+	}
+	if FromMillis(Millis(time.Unix(1, 5e6))) != time.Unix(1, 5e6) {
+		t.Error("millis round trip")
+	}
+}
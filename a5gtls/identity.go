@@ -0,0 +1,58 @@
+package a5gtls
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+)
+
+// ClientIdentity is taken from the verified client certificate.
+type ClientIdentity struct {
+	CommonName   string   `json:"commonName"`
+	Organization []string `json:"organization,omitempty"`
+	DNSNames     []string `json:"dnsNames,omitempty"`
+	URIs         []string `json:"uris,omitempty"`
+}
+
+type ctxKey int
+
+const ctxKeyClientIdentity ctxKey = iota
+
+// NewClientIdentity returns nil unless the peer presented a certificate
+// which was verified against the CA pool.
+func NewClientIdentity(s *tls.ConnectionState) *ClientIdentity {
+	if s == nil || len(s.VerifiedChains) == 0 ||
+		len(s.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	c := s.VerifiedChains[0][0]
+	v := &ClientIdentity{
+		CommonName:   c.Subject.CommonName,
+		Organization: c.Subject.Organization,
+		DNSNames:     c.DNSNames}
+	for _, u := range c.URIs {
+		v.URIs = append(v.URIs, u.String())
+	}
+	return v
+}
+
+func ContextWithClientIdentity(
+	ctx context.Context, v *ClientIdentity) context.Context {
+	return context.WithValue(ctx, ctxKeyClientIdentity, v)
+}
+
+func ClientIdentityFromContext(ctx context.Context) *ClientIdentity {
+	v, _ := ctx.Value(ctxKeyClientIdentity).(*ClientIdentity)
+	return v
+}
+
+// ClientIdentityMiddleware exposes the peer identity to handlers for
+// authorization decisions.
+func ClientIdentityMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if v := NewClientIdentity(r.TLS); v != nil {
+			r = r.WithContext(ContextWithClientIdentity(r.Context(), v))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,150 @@
+package a5gtls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+// Reloader keeps the service certificate and the CA pool used to verify
+// peers, re-reading the files when they change on disk (certificate
+// rotation) without restarting listeners. The produced *tls.Config can be
+// used for HTTP servers and with grpc's credentials.NewTLS alike.
+type Reloader struct {
+	CertFile string
+	KeyFile  string
+	CAFile   string
+	Logger   a5glogs.Logger
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+	modTime time.Time
+}
+
+func NewReloader(
+	certFile, keyFile, caFile string, l a5glogs.Logger) (*Reloader, error) {
+	if certFile == "" || keyFile == "" || caFile == "" {
+		return nil, errors.New("empty tls file name")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	r := &Reloader{
+		CertFile: certFile,
+		KeyFile:  keyFile,
+		CAFile:   caFile,
+		Logger:   l}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Reloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.CertFile, r.KeyFile)
+	if err != nil {
+		return errors.Wrap(err, "tls.LoadX509KeyPair fn")
+	}
+	b, err := ioutil.ReadFile(r.CAFile)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return errors.New("no ca certificates found")
+	}
+	modTime, err := r.lastModTime()
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.pool = pool
+	r.modTime = modTime
+	r.mu.Unlock()
+	return nil
+}
+
+// Watch polls files modification time each interval and reloads them until
+// ctx is done. Failed reloads keep the previous certificates.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		modTime, err := r.lastModTime()
+		if err != nil {
+			r.Logger.Error(err.Error())
+			continue
+		}
+		r.mu.RLock()
+		changed := modTime.After(r.modTime)
+		r.mu.RUnlock()
+		if !changed {
+			continue
+		}
+		if err = r.Reload(); err != nil {
+			r.Logger.Error(err.Error())
+			continue
+		}
+		r.Logger.Info("tls certificates reloaded")
+	}
+}
+
+// ServerConfig requires and verifies client certificates (mutual TLS).
+func (r *Reloader) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				ClientCAs:    r.pool,
+				ClientAuth:   tls.RequireAndVerifyClientCert}, nil
+		}}
+}
+
+// ClientConfig presents the current certificate to servers. RootCAs is a
+// snapshot, so take a new config (or client) after rotation of the CA.
+func (r *Reloader) ClientConfig() *tls.Config {
+	r.mu.RLock()
+	pool := r.pool
+	r.mu.RUnlock()
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    pool,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (
+			*tls.Certificate, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return r.cert, nil
+		}}
+}
+
+func (r *Reloader) lastModTime() (time.Time, error) {
+	var t time.Time
+	for _, s := range []string{r.CertFile, r.KeyFile, r.CAFile} {
+		fileInfo, err := os.Stat(s)
+		if err != nil {
+			return t, errors.WithStack(err)
+		}
+		if fileInfo.ModTime().After(t) {
+			t = fileInfo.ModTime()
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,164 @@
+package a5gtls
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/sirupsen/logrus"
+)
+
+// writeCert writes a self-signed certificate, which is its own CA, and
+// returns it DER encoded.
+func writeCert(t *testing.T, dir, commonName string) []byte {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &k.PublicKey, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	for name, b := range map[string][]byte{
+		"cert.pem": certPEM, "key.pem": keyPEM, "ca.pem": certPEM} {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), b, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return der
+}
+
+func currentCert(t *testing.T, r *Reloader) []byte {
+	c, err := r.ClientConfig().GetClientCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.Certificate[0]
+}
+
+func TestReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "a5gtls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	name := func(s string) string { return filepath.Join(dir, s) }
+
+	if _, err = NewReloader(
+		name("cert.pem"), name("key.pem"), name("ca.pem"), l); err == nil {
+		t.Error("expected a missing files error")
+	}
+	first := writeCert(t, dir, "game-1")
+	r, err := NewReloader(name("cert.pem"), name("key.pem"), name("ca.pem"), l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(currentCert(t, r), first) {
+		t.Fatal("unexpected certificate")
+	}
+
+	second := writeCert(t, dir, "game-2")
+	if err = r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(currentCert(t, r), second) {
+		t.Error("certificate not rotated")
+	}
+
+	// Invalid certificates keep the previous one.
+	err = ioutil.WriteFile(name("cert.pem"), []byte("not a certificate"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Reload(); err == nil {
+		t.Error("expected an invalid certificate error")
+	}
+	if !bytes.Equal(currentCert(t, r), second) {
+		t.Error("invalid certificate replaced the previous one")
+	}
+}
+
+func TestReloaderHandshake(t *testing.T) {
+	dir, err := ioutil.TempDir("", "a5gtls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeCert(t, dir, "game-1")
+	r, err := NewReloader(filepath.Join(dir, "cert.pem"),
+		filepath.Join(dir, "key.pem"), filepath.Join(dir, "ca.pem"),
+		a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		config   *tls.Config
+		identity string
+	}{
+		{"mutual", r.ClientConfig(), "game-1"},
+		{"no client certificate", &tls.Config{RootCAs: r.ClientConfig().RootCAs}, ""},
+	}
+	for _, test := range tests {
+		c1, c2 := net.Pipe()
+		test.config.ServerName = "localhost"
+		client := tls.Client(c1, test.config)
+		server := tls.Server(c2, r.ServerConfig())
+		done := make(chan error, 1)
+		go func() {
+			done <- client.Handshake()
+			// Drain alerts and session tickets, net.Pipe is unbuffered.
+			io.Copy(ioutil.Discard, c1)
+		}()
+		serverErr := server.Handshake()
+		c2.Close()
+		<-done
+		c1.Close()
+		if test.identity == "" {
+			if serverErr == nil {
+				t.Errorf("%s: expected a handshake error", test.name)
+			}
+			continue
+		}
+		if serverErr != nil {
+			t.Errorf("%s: %v", test.name, serverErr)
+			continue
+		}
+		s := server.ConnectionState()
+		if v := NewClientIdentity(&s); v == nil || v.CommonName != test.identity {
+			t.Errorf("%s: unexpected identity %+v", test.name, v)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package a5gtrade
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCodeNotParty = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4032,
+		Name:     "trade_not_party",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "not a party of the trade"})
+
+	ErrCodeBanned = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4033,
+		Name:     "trade_banned",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "a party of the trade is banned"})
+
+	ErrCodeTradeUnknown = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4057,
+		Name:     "trade_unknown",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "trade not found"})
+
+	ErrCodeNotTradable = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4246,
+		Name:     "trade_not_tradable",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "not tradable"})
+
+	ErrCodeTradeState = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4247,
+		Name:     "trade_state",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "trade was accepted, settled or cancelled already"})
+)
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeNotParty, http.StatusForbidden)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeBanned, http.StatusForbidden)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeTradeUnknown, http.StatusNotFound)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeNotTradable, http.StatusUnprocessableEntity)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeTradeState, http.StatusConflict)
+}
+
+type ProposeRequest struct {
+	ID    string `json:"id" validate:"required,max=64"`
+	To    uint64 `json:"to" validate:"required"`
+	Offer Side   `json:"offer"`
+	Ask   Side   `json:"ask"`
+}
+
+type TradeRequest struct {
+	ID string `json:"id" validate:"required"`
+}
+
+// ProposeHandler proposes a trade of the session player.
+func (tr *Trader) ProposeHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(ProposeRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			r := req.Payload.(*ProposeRequest)
+			t, err := tr.Propose(ctx, &Trade{
+				ID: r.ID, From: s.AccountID, To: r.To, Offer: r.Offer, Ask: r.Ask})
+			if err != nil {
+				return nil, tr.apiErrs(err)
+			}
+			return t, nil
+		})
+}
+
+// AcceptHandler accepts a trade proposed to the session player.
+func (tr *Trader) AcceptHandler() a5ghttp.HandlerFunc {
+	return tr.handler(func(ctx context.Context, id string, accountID uint64) (*Trade, error) {
+		return tr.Accept(ctx, id, accountID)
+	})
+}
+
+// CancelHandler cancels an open trade of the session player.
+func (tr *Trader) CancelHandler() a5ghttp.HandlerFunc {
+	return tr.handler(func(ctx context.Context, id string, accountID uint64) (*Trade, error) {
+		return tr.Cancel(id, accountID)
+	})
+}
+
+// TradeHandler answers with a trade of the session player.
+func (tr *Trader) TradeHandler() a5ghttp.HandlerFunc {
+	return tr.handler(func(ctx context.Context, id string, accountID uint64) (*Trade, error) {
+		t, err := tr.get(id)
+		if err != nil {
+			return nil, err
+		}
+		if t.From != accountID && t.To != accountID {
+			return nil, ErrNotParty
+		}
+		return t, nil
+	})
+}
+
+func (tr *Trader) handler(
+	fn func(ctx context.Context, id string, accountID uint64) (*Trade, error)) a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(TradeRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			t, err := fn(ctx, req.Payload.(*TradeRequest).ID, s.AccountID)
+			if err != nil {
+				return nil, tr.apiErrs(err)
+			}
+			return t, nil
+		})
+}
+
+func (tr *Trader) apiErrs(err error) []*a5gapi.APIErr {
+	switch errors.Cause(err) {
+	case ErrNotParty:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeNotParty, "")}
+	case ErrBanned:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeBanned, "")}
+	case ErrTradeUnknown:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeTradeUnknown, "")}
+	case ErrNotTradable:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeNotTradable, "%s", err)}
+	case ErrTradeState, ErrTradeBusy:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeTradeState, "")}
+	case a5gwallet.ErrInsufficientFunds:
+		return tr.Wallet.APIErrs(err)
+	case a5ginventory.ErrInsufficient:
+		return tr.Inventory.APIErrs(err)
+	}
+	tr.Logger.Error(err.Error())
+	return a5gapi.NewJSONMsgDefautlErrors(err)
+}
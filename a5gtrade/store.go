@@ -0,0 +1,199 @@
+package a5gtrade
+
+import (
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryStore struct {
+	mu     sync.Mutex
+	trades map[string]*Trade
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{trades: make(map[string]*Trade)}
+}
+
+func (s *memoryStore) Get(id string) (*Trade, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.trades[id]
+	if !ok {
+		return nil, nil
+	}
+	return t.clone(), nil
+}
+
+func (s *memoryStore) Update(prev, next *Trade) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	x, ok := s.trades[next.ID]
+	if ok != (prev != nil) || ok && x.Version != prev.Version {
+		return false, nil
+	}
+	s.trades[next.ID] = next.clone()
+	return true, nil
+}
+
+func (s *memoryStore) list(fn func(t *Trade) bool, limit int) []*Trade {
+	a := []*Trade{}
+	for _, t := range s.trades {
+		if fn(t) {
+			a = append(a, t.clone())
+		}
+	}
+	sort.Slice(a, func(i, j int) bool {
+		if a[i].SettleAt != a[j].SettleAt {
+			return a[i].SettleAt < a[j].SettleAt
+		}
+		return a[i].ID < a[j].ID
+	})
+	if limit > 0 && len(a) > limit {
+		a = a[:limit]
+	}
+	return a
+}
+
+func (s *memoryStore) Due(before int64, limit int) ([]*Trade, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list(func(t *Trade) bool {
+		return t.Status == StatusHeld && t.SettleAt <= before
+	}, limit), nil
+}
+
+func (s *memoryStore) Open(accountID uint64) ([]*Trade, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list(func(t *Trade) bool {
+		return t.open() && (t.From == accountID || t.To == accountID)
+	}, 0), nil
+}
+
+// dbStore keeps trades in a MySQL table:
+//
+//	CREATE TABLE trades (
+//	  id VARCHAR(64) NOT NULL PRIMARY KEY,
+//	  from_id BIGINT UNSIGNED NOT NULL,
+//	  to_id BIGINT UNSIGNED NOT NULL,
+//	  status VARCHAR(16) NOT NULL,
+//	  settle_at BIGINT NOT NULL,
+//	  data TEXT NOT NULL,
+//	  version BIGINT NOT NULL,
+//	  updated_at DATETIME NOT NULL,
+//	  KEY status (status, settle_at),
+//	  KEY from_id (from_id, status),
+//	  KEY to_id (to_id, status));
+type dbStore struct {
+	pooler    a5gdb.Pooler
+	tableName string
+}
+
+type dbTrade struct {
+	Data    string `db:"data"`
+	Version int64  `db:"version"`
+}
+
+func NewDBStore(p a5gdb.Pooler, tableName string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if tableName == "" {
+		return nil, errors.New("empty trades table name")
+	}
+	return &dbStore{pooler: p, tableName: tableName}, nil
+}
+
+func decode(rows []*dbTrade) ([]*Trade, error) {
+	a := make([]*Trade, 0, len(rows))
+	for _, r := range rows {
+		t := new(Trade)
+		if err := json.Unmarshal([]byte(r.Data), t); err != nil {
+			return nil, errors.Wrap(err, "trade data")
+		}
+		t.Version = r.Version
+		a = append(a, t)
+	}
+	return a, nil
+}
+
+func (s *dbStore) Get(id string) (*Trade, error) {
+	var rows []*dbTrade
+	_, err := s.pooler.WritePool().NewSession().
+		Select("data", "version").From(s.tableName).
+		Where(dbr.Eq("id", id)).Load(&rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	a, err := decode(rows)
+	if err != nil || len(a) == 0 {
+		return nil, err
+	}
+	return a[0], nil
+}
+
+func (s *dbStore) Update(prev, next *Trade) (bool, error) {
+	b, err := json.Marshal(next)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	sess := s.pooler.WritePool().NewSession()
+	var res sql.Result
+	if prev == nil {
+		res, err = sess.InsertBySql("INSERT IGNORE INTO "+s.tableName+
+			" (id, from_id, to_id, status, settle_at, data, version, updated_at)"+
+			" VALUES (?, ?, ?, ?, ?, ?, ?, ?)", next.ID, next.From, next.To,
+			next.Status, next.SettleAt, string(b), next.Version,
+			time.Now().UTC()).Exec()
+	} else {
+		res, err = sess.Update(s.tableName).
+			Set("status", next.Status).
+			Set("settle_at", next.SettleAt).
+			Set("data", string(b)).
+			Set("version", next.Version).
+			Set("updated_at", time.Now().UTC()).
+			Where(dbr.Eq("id", next.ID)).
+			Where(dbr.Eq("version", prev.Version)).Exec()
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	return n == 1, nil
+}
+
+func (s *dbStore) Due(before int64, limit int) ([]*Trade, error) {
+	var rows []*dbTrade
+	_, err := s.pooler.WritePool().NewSession().
+		Select("data", "version").From(s.tableName).
+		Where(dbr.Eq("status", StatusHeld)).
+		Where(dbr.Lte("settle_at", before)).
+		OrderAsc("settle_at").Limit(uint64(limit)).Load(&rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	return decode(rows)
+}
+
+func (s *dbStore) Open(accountID uint64) ([]*Trade, error) {
+	var rows []*dbTrade
+	_, err := s.pooler.WritePool().NewSession().
+		Select("data", "version").From(s.tableName).
+		Where(dbr.Or(dbr.Eq("from_id", accountID), dbr.Eq("to_id", accountID))).
+		Where(dbr.Eq("status", []string{StatusProposed, StatusHeld})).
+		OrderAsc("settle_at").Load(&rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	return decode(rows)
+}
@@ -0,0 +1,495 @@
+package a5gtrade
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrTradeUnknown = errors.New("trade unknown")
+	ErrNotTradable  = errors.New("not tradable")
+	ErrTradeState   = errors.New("trade not in a state for this")
+	ErrTradeBusy    = errors.New("trade changed concurrently")
+	ErrNotParty     = errors.New("not a party of the trade")
+	ErrBanned       = errors.New("trading party banned")
+)
+
+// Statuses of trades. Proposed trades hold the offer in escrow, held ones
+// both sides until SettleAt; voided trades were cancelled by the ban of a
+// party. Failed trades need support, LastErr tells why.
+const (
+	StatusProposed  = "proposed"
+	StatusHeld      = "held"
+	StatusCompleted = "completed"
+	StatusCancelled = "cancelled"
+	StatusVoided    = "voided"
+	StatusFailed    = "failed"
+)
+
+// Side is what a party gives.
+type Side struct {
+	Currencies map[string]int64 `json:"currencies,omitempty"`
+	Items      map[string]int64 `json:"items,omitempty"`
+}
+
+func (s *Side) empty() bool { return len(s.Currencies)+len(s.Items) == 0 }
+
+// Trade swaps Offer of From for Ask of To.
+type Trade struct {
+	ID        string `json:"id"`
+	From      uint64 `json:"from"`
+	To        uint64 `json:"to"`
+	Offer     Side   `json:"offer"`
+	Ask       Side   `json:"ask"`
+	Value     int64  `json:"value"`
+	Status    string `json:"status"`
+	CreatedAt int64  `json:"createdAt"`
+	SettleAt  int64  `json:"settleAt,omitempty"`
+	LastErr   string `json:"lastErr,omitempty"`
+	Version   int64  `json:"-"`
+}
+
+func (t *Trade) clone() *Trade {
+	x := *t
+	return &x
+}
+
+func (t *Trade) open() bool {
+	return t.Status == StatusProposed || t.Status == StatusHeld
+}
+
+// Store keeps trades. Update replaces prev with next unless the trade
+// changed since prev was read, nil prev creates it; Due lists held trades
+// to settle by before; Open lists open trades of a party.
+type Store interface {
+	Get(id string) (*Trade, error)
+	Update(prev, next *Trade) (bool, error)
+	Due(before int64, limit int) ([]*Trade, error)
+	Open(accountID uint64) ([]*Trade, error)
+}
+
+// Config prices tradable currencies and items per unit; trades worth
+// Threshold or more are held for Window before they settle.
+type Config struct {
+	Currencies map[string]int64 `json:"currencies"`
+	Items      map[string]int64 `json:"items"`
+	Threshold  int64            `json:"threshold"`
+	Window     time.Duration    `json:"window"`
+}
+
+// BannedFunc reports whether a player is banned.
+type BannedFunc func(ctx context.Context, accountID uint64) (bool, error)
+
+// Trader runs trades through escrow: both sides leave the inventories of
+// the parties when they commit to a trade and go to the other party on
+// settlement, or back on cancellation. It is an a5gapp.Module settling
+// held trades every Interval.
+type Trader struct {
+	Config    *Config
+	Store     Store
+	Wallet    *a5gwallet.Wallet
+	Inventory *a5ginventory.Inventory
+	Banned    BannedFunc
+	Logger    a5glogs.Logger
+	Interval  time.Duration
+
+	now     func() time.Time
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+func NewTrader(c *Config, s Store, w *a5gwallet.Wallet,
+	inv *a5ginventory.Inventory, banned BannedFunc, l a5glogs.Logger) (*Trader, error) {
+	if c == nil {
+		return nil, errors.New("nil trade config")
+	}
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if w == nil || inv == nil {
+		return nil, errors.New("wallet or inventory missing")
+	}
+	if banned == nil {
+		return nil, errors.New("banned func missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Trader{
+		Config:    c,
+		Store:     s,
+		Wallet:    w,
+		Inventory: inv,
+		Banned:    banned,
+		Logger:    l,
+		Interval:  time.Minute,
+		now:       time.Now}, nil
+}
+
+func (tr *Trader) value(s *Side) (int64, error) {
+	var v int64
+	for id, n := range s.Currencies {
+		price, ok := tr.Config.Currencies[id]
+		if !ok || n <= 0 {
+			return 0, errors.Wrap(ErrNotTradable, id)
+		}
+		v += price * n
+	}
+	for id, n := range s.Items {
+		price, ok := tr.Config.Items[id]
+		if !ok || n <= 0 {
+			return 0, errors.Wrap(ErrNotTradable, id)
+		}
+		v += price * n
+	}
+	return v, nil
+}
+
+func (tr *Trader) banned(ctx context.Context, t *Trade) error {
+	for _, id := range []uint64{t.From, t.To} {
+		banned, err := tr.Banned(ctx, id)
+		if err != nil {
+			return err
+		}
+		if banned {
+			return ErrBanned
+		}
+	}
+	return nil
+}
+
+// Propose puts the offer of a trade into escrow. The ID is made by the
+// client.
+func (tr *Trader) Propose(ctx context.Context, t *Trade) (*Trade, error) {
+	if t.ID == "" || t.From == 0 || t.To == 0 || t.From == t.To {
+		return nil, errors.New("invalid trade")
+	}
+	if t.Offer.empty() || t.Ask.empty() {
+		return nil, errors.New("empty trade side")
+	}
+	offer, err := tr.value(&t.Offer)
+	if err != nil {
+		return nil, err
+	}
+	ask, err := tr.value(&t.Ask)
+	if err != nil {
+		return nil, err
+	}
+	if err = tr.banned(ctx, t); err != nil {
+		return nil, err
+	}
+	x := t.clone()
+	x.Value = offer
+	if ask > offer {
+		x.Value = ask
+	}
+	x.Status = StatusProposed
+	x.CreatedAt = tr.now().Unix()
+	x.SettleAt = 0
+	x.LastErr = ""
+	x.Version = 1
+	ok, err := tr.Store.Update(nil, x)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.Wrap(ErrTradeBusy, t.ID)
+	}
+	if err = tr.move(x, x.From, &x.Offer, "offer", -1); err != nil {
+		return tr.revert(x, StatusCancelled, err)
+	}
+	return x, nil
+}
+
+// Accept puts the ask into escrow; the trade settles at once unless it
+// is worth Threshold or more, then it is held for Window.
+func (tr *Trader) Accept(ctx context.Context, id string, accountID uint64) (*Trade, error) {
+	t, err := tr.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if t.To != accountID {
+		return nil, ErrNotParty
+	}
+	if t.Status != StatusProposed {
+		return nil, errors.Wrap(ErrTradeState, t.Status)
+	}
+	if err = tr.banned(ctx, t); err != nil {
+		return nil, err
+	}
+	x := t.clone()
+	x.Status = StatusHeld
+	x.SettleAt = tr.now().Unix()
+	if x.Value >= tr.Config.Threshold && tr.Config.Threshold > 0 {
+		x.SettleAt = tr.now().Add(tr.Config.Window).Unix()
+	}
+	if x, err = tr.save(t, x); err != nil {
+		return nil, err
+	}
+	if err = tr.move(x, x.To, &x.Ask, "ask", -1); err != nil {
+		return tr.revert(x, StatusProposed, err)
+	}
+	if x.SettleAt > tr.now().Unix() {
+		return x, nil
+	}
+	return tr.settle(ctx, x)
+}
+
+// Cancel returns escrowed sides of an open trade to their parties, either
+// party may cancel until the trade settles.
+func (tr *Trader) Cancel(id string, accountID uint64) (*Trade, error) {
+	t, err := tr.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if t.From != accountID && t.To != accountID {
+		return nil, ErrNotParty
+	}
+	return tr.unwind(t, StatusCancelled)
+}
+
+// VoidAccount voids open trades of a player, call it on bans.
+func (tr *Trader) VoidAccount(accountID uint64) error {
+	a, err := tr.Store.Open(accountID)
+	if err != nil {
+		return err
+	}
+	for _, t := range a {
+		if _, err = tr.unwind(t, StatusVoided); err != nil &&
+			errors.Cause(err) != ErrTradeState && errors.Cause(err) != ErrTradeBusy {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tr *Trader) unwind(t *Trade, status string) (*Trade, error) {
+	if !t.open() {
+		return nil, errors.Wrap(ErrTradeState, t.Status)
+	}
+	x := t.clone()
+	x.Status = status
+	x, err := tr.save(t, x)
+	if err != nil {
+		return nil, err
+	}
+	if err = tr.move(x, x.From, &x.Offer, "offer:refund", 1); err != nil {
+		return tr.fail(x, err)
+	}
+	if t.Status == StatusHeld {
+		if err = tr.move(x, x.To, &x.Ask, "ask:refund", 1); err != nil {
+			return tr.fail(x, err)
+		}
+	}
+	return x, nil
+}
+
+// SettleDue settles held trades past their window, voiding trades of
+// banned parties, and returns the number of trades settled or voided.
+func (tr *Trader) SettleDue(ctx context.Context) (int, error) {
+	a, err := tr.Store.Due(tr.now().Unix(), 100)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, t := range a {
+		if err = ctx.Err(); err != nil {
+			return n, errors.WithStack(err)
+		}
+		if _, err = tr.settle(ctx, t); err != nil {
+			tr.Logger.With(a5gfields.String("tradeID", t.ID)).Error(err.Error())
+			continue
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (tr *Trader) settle(ctx context.Context, t *Trade) (*Trade, error) {
+	if err := tr.banned(ctx, t); err != nil {
+		if errors.Cause(err) == ErrBanned {
+			return tr.unwind(t, StatusVoided)
+		}
+		return nil, err
+	}
+	x := t.clone()
+	x.Status = StatusCompleted
+	x, err := tr.save(t, x)
+	if err != nil {
+		return nil, err
+	}
+	if err = tr.move(x, x.To, &x.Offer, "offer:deliver", 1); err != nil {
+		return tr.fail(x, err)
+	}
+	if err = tr.move(x, x.From, &x.Ask, "ask:deliver", 1); err != nil {
+		return tr.fail(x, err)
+	}
+	return x, nil
+}
+
+func (tr *Trader) get(id string) (*Trade, error) {
+	t, err := tr.Store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, errors.Wrap(ErrTradeUnknown, id)
+	}
+	return t, nil
+}
+
+func (tr *Trader) save(prev, next *Trade) (*Trade, error) {
+	next.Version = prev.Version + 1
+	ok, err := tr.Store.Update(prev, next)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.Wrap(ErrTradeBusy, prev.ID)
+	}
+	return next, nil
+}
+
+// revert sets the status back after a side could not be taken into
+// escrow, e.g. for lack of funds, and returns the cause.
+func (tr *Trader) revert(t *Trade, status string, cause error) (*Trade, error) {
+	x := t.clone()
+	x.Status = status
+	x.SettleAt = 0
+	x.LastErr = cause.Error()
+	if _, err := tr.save(t, x); err != nil {
+		tr.Logger.With(a5gfields.String("tradeID", t.ID)).Error(err.Error())
+	}
+	return nil, cause
+}
+
+// fail marks a trade whose escrow could not be moved, assets in escrow
+// stay booked on its counterparty for support to resolve.
+func (tr *Trader) fail(t *Trade, cause error) (*Trade, error) {
+	x := t.clone()
+	x.Status = StatusFailed
+	x.LastErr = cause.Error()
+	if _, err := tr.save(t, x); err != nil {
+		tr.Logger.With(a5gfields.String("tradeID", t.ID)).Error(err.Error())
+	}
+	return nil, errors.Wrapf(cause, "trade %s", t.ID)
+}
+
+func sorted(m map[string]int64) []string {
+	a := make([]string, 0, len(m))
+	for id := range m {
+		a = append(a, id)
+	}
+	sort.Strings(a)
+	return a
+}
+
+// move takes (sign -1) a side from a party into escrow or gives (sign 1)
+// it to one. Wallet transactions are keyed by the trade, its version and
+// the step, so a step is booked once; currencies go first as they may
+// fail for funds.
+func (tr *Trader) move(t *Trade, accountID uint64, s *Side, step string, sign int64) error {
+	ref := "trade:" + t.ID + ":" + strconv.FormatInt(t.Version, 10) + ":" + step
+	if len(s.Currencies) > 0 {
+		wt := a5gwallet.NewTx(ref, "escrow:"+t.ID, "trade")
+		for _, id := range sorted(s.Currencies) {
+			if sign < 0 {
+				wt.Debit(id, s.Currencies[id])
+			} else {
+				wt.Credit(id, s.Currencies[id])
+			}
+		}
+		if _, err := tr.Wallet.Apply(accountID, wt); err != nil {
+			return err
+		}
+	}
+	if len(s.Items) == 0 {
+		return nil
+	}
+	it := a5ginventory.NewTx("trade", ref)
+	if sign > 0 {
+		it.MailOverflow()
+	}
+	for _, id := range sorted(s.Items) {
+		it.Grant(id, sign*s.Items[id])
+	}
+	if _, err := tr.Inventory.Apply(accountID, it); err != nil {
+		if sign < 0 && len(s.Currencies) > 0 {
+			tr.refund(t, accountID, s, ref)
+		}
+		return err
+	}
+	return nil
+}
+
+func (tr *Trader) refund(t *Trade, accountID uint64, s *Side, ref string) {
+	wt := a5gwallet.NewTx(ref+":refund", "escrow:"+t.ID, "trade")
+	for _, id := range sorted(s.Currencies) {
+		wt.Credit(id, s.Currencies[id])
+	}
+	if _, err := tr.Wallet.Apply(accountID, wt); err != nil {
+		tr.Logger.With(a5gfields.String("tradeID", t.ID),
+			a5gfields.String("accountID", strconv.FormatUint(accountID, 10))).
+			Error(errors.Wrap(err, "trade escrow not refunded").Error())
+	}
+}
+
+func (tr *Trader) Name() string { return "trade" }
+
+// Start settles due trades every Interval until Stop is called.
+func (tr *Trader) Start(context.Context) error {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if tr.cancel != nil {
+		return errors.New("trader already started")
+	}
+	var ctx context.Context
+	ctx, tr.cancel = context.WithCancel(context.Background())
+	tr.stopped = make(chan struct{})
+	go tr.run(ctx, tr.stopped)
+	return nil
+}
+
+func (tr *Trader) run(ctx context.Context, stopped chan struct{}) {
+	defer close(stopped)
+	t := time.NewTicker(tr.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if _, err := tr.SettleDue(ctx); err != nil && ctx.Err() == nil {
+			tr.Logger.Error(err.Error())
+		}
+	}
+}
+
+// Stop waits for the running settlement until ctx is done.
+func (tr *Trader) Stop(ctx context.Context) error {
+	tr.mu.Lock()
+	cancel, stopped := tr.cancel, tr.stopped
+	tr.cancel = nil
+	tr.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
@@ -0,0 +1,136 @@
+package a5gtrade
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5ginventory"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gwallet"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestTrader(t *testing.T) {
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	c, _ := a5gwallet.NewCurrencies(a5gwallet.Currency{ID: "gold"})
+	w, _ := a5gwallet.NewWallet(a5gwallet.NewMemoryStore(), c, l)
+	catalog, _ := a5ginventory.NewCatalogJSON([]byte(`{"items": [{"id": "sword"}]}`))
+	inv, _ := a5ginventory.NewInventory(a5ginventory.NewMemoryStore(), catalog, l)
+	for id := uint64(1); id <= 4; id++ {
+		if _, err := w.Credit(id, fmt.Sprint("seed", id), "test", "seed", "gold", 1000); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := inv.Apply(id, a5ginventory.NewTx("seed", "").Grant("sword", 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	banned := map[uint64]bool{}
+	tr, err := NewTrader(&Config{
+		Currencies: map[string]int64{"gold": 1},
+		Items:      map[string]int64{"sword": 500},
+		Threshold:  400,
+		Window:     time.Hour}, NewMemoryStore(), w, inv,
+		func(ctx context.Context, id uint64) (bool, error) { return banned[id], nil }, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	tr.now = func() time.Time { return now }
+	ctx := context.Background()
+	holdings := func(id uint64) string {
+		b, _ := w.Balances(id)
+		s, _ := inv.Stacks(id)
+		var gold, swords int64
+		if len(b) > 0 {
+			gold = b[0].Balance
+		}
+		if len(s) > 0 {
+			swords = s[0].Quantity
+		}
+		return fmt.Sprintf("%d gold %d swords", gold, swords)
+	}
+	expect := func(id uint64, s string) {
+		if got := holdings(id); got != s {
+			t.Errorf("account %d: expected %s, got %s", id, s, got)
+		}
+	}
+
+	// A cheap trade settles on accept.
+	if _, err = tr.Propose(ctx, &Trade{ID: "t1", From: 1, To: 2,
+		Offer: Side{Currencies: map[string]int64{"gold": 100}},
+		Ask:   Side{Currencies: map[string]int64{"gold": 50}}}); err != nil {
+		t.Fatal(err)
+	}
+	expect(1, "900 gold 1 swords")
+	if _, err = tr.Accept(ctx, "t1", 1); errors.Cause(err) != ErrNotParty {
+		t.Errorf("unexpected error %v", err)
+	}
+	x, err := tr.Accept(ctx, "t1", 2)
+	if err != nil || x.Status != StatusCompleted {
+		t.Fatalf("Accept() => %+v %v", x, err)
+	}
+	expect(1, "950 gold 1 swords")
+	expect(2, "1050 gold 1 swords")
+
+	// A sword for gold is held for the window, then settles.
+	if _, err = tr.Propose(ctx, &Trade{ID: "t2", From: 1, To: 2,
+		Offer: Side{Items: map[string]int64{"sword": 1}},
+		Ask:   Side{Currencies: map[string]int64{"gold": 600}}}); err != nil {
+		t.Fatal(err)
+	}
+	if x, err = tr.Accept(ctx, "t2", 2); err != nil || x.Status != StatusHeld {
+		t.Fatalf("Accept() => %+v %v", x, err)
+	}
+	expect(1, "950 gold 0 swords")
+	expect(2, "450 gold 1 swords")
+	if n, _ := tr.SettleDue(ctx); n != 0 {
+		t.Errorf("settled %d trades within the window", n)
+	}
+	now = now.Add(time.Hour)
+	if n, _ := tr.SettleDue(ctx); n != 1 {
+		t.Errorf("settled %d trades after the window", n)
+	}
+	expect(1, "1550 gold 0 swords")
+	expect(2, "450 gold 2 swords")
+
+	// A ban during the window voids the trade.
+	if _, err = tr.Propose(ctx, &Trade{ID: "t3", From: 3, To: 4,
+		Offer: Side{Items: map[string]int64{"sword": 1}},
+		Ask:   Side{Currencies: map[string]int64{"gold": 700}}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tr.Accept(ctx, "t3", 4); err != nil {
+		t.Fatal(err)
+	}
+	banned[3] = true
+	now = now.Add(time.Hour)
+	if n, _ := tr.SettleDue(ctx); n != 1 {
+		t.Errorf("voided %d trades", n)
+	}
+	if x, _ = tr.Store.Get("t3"); x.Status != StatusVoided {
+		t.Errorf("unexpected status %s", x.Status)
+	}
+	expect(3, "1000 gold 1 swords")
+	expect(4, "1000 gold 1 swords")
+
+	// Lack of funds leaves the trade proposed; cancel refunds the offer.
+	if _, err = tr.Propose(ctx, &Trade{ID: "t4", From: 4, To: 2,
+		Offer: Side{Items: map[string]int64{"sword": 1}},
+		Ask:   Side{Currencies: map[string]int64{"gold": 900}}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tr.Accept(ctx, "t4", 2); errors.Cause(err) != a5gwallet.ErrInsufficientFunds {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if x, err = tr.Cancel("t4", 2); err != nil || x.Status != StatusCancelled {
+		t.Fatalf("Cancel() => %+v %v", x, err)
+	}
+	if _, err = tr.Cancel("t4", 4); errors.Cause(err) != ErrTradeState {
+		t.Errorf("unexpected error %v", err)
+	}
+	expect(4, "1000 gold 1 swords")
+	expect(2, "450 gold 2 swords")
+}
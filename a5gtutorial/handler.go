@@ -0,0 +1,86 @@
+package a5gtutorial
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCodeStepUnknown = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4049,
+		Name:     "tutorial_step_unknown",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "tutorial step not found"})
+
+	ErrCodeStepOrder = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4234,
+		Name:     "tutorial_step_order",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "tutorial step is not the current one"})
+)
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeStepUnknown, http.StatusNotFound)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeStepOrder, http.StatusUnprocessableEntity)
+}
+
+type CompleteRequest struct {
+	StepID string `json:"stepId" validate:"required"`
+}
+
+// StateHandler answers with the tutorial State of the a5gsession
+// authenticated player.
+func (t *Tutorial) StateHandler() a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		sess, ok := a5gsession.FromContext(ctx)
+		if !ok {
+			return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+		}
+		s, err := t.State(ctx, sess.AccountID)
+		if err != nil {
+			return nil, t.apiErrs(err)
+		}
+		return s, nil
+	}
+}
+
+// CompleteHandler completes the current step of the a5gsession
+// authenticated player and answers with the State.
+func (t *Tutorial) CompleteHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(CompleteRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			sess, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			p := req.Payload.(*CompleteRequest)
+			s, err := t.Complete(ctx, sess.AccountID, p.StepID)
+			if err != nil {
+				return nil, t.apiErrs(err)
+			}
+			return s, nil
+		})
+}
+
+func (t *Tutorial) apiErrs(err error) []*a5gapi.APIErr {
+	switch errors.Cause(err) {
+	case ErrStepUnknown:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeStepUnknown, "")}
+	case ErrStepOrder:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeStepOrder, "")}
+	}
+	t.Logger.Error(err.Error())
+	return a5gapi.NewJSONMsgDefautlErrors(err)
+}
@@ -0,0 +1,123 @@
+package a5gtutorial
+
+import (
+	"database/sql"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryStore struct {
+	mu       sync.Mutex
+	progress map[uint64]*Progress
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{progress: make(map[uint64]*Progress)}
+}
+
+func (s *memoryStore) Get(accountID uint64) (*Progress, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.progress[accountID]
+	if !ok {
+		return nil, nil
+	}
+	return p.clone(), nil
+}
+
+func (s *memoryStore) Update(accountID uint64, prev, next *Progress) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	x, ok := s.progress[accountID]
+	if ok != (prev != nil) || ok && x.Version != prev.Version {
+		return false, nil
+	}
+	s.progress[accountID] = next.clone()
+	return true, nil
+}
+
+// dbStore keeps tutorial progress in a MySQL table, a row per player:
+//
+//	CREATE TABLE tutorial_progress (
+//	  account_id BIGINT UNSIGNED NOT NULL,
+//	  steps TEXT NOT NULL,
+//	  version BIGINT NOT NULL,
+//	  updated_at DATETIME NOT NULL,
+//	  PRIMARY KEY (account_id));
+//
+// Steps are a JSON object keyed by step ID, so config changes need no
+// schema migration.
+type dbStore struct {
+	pooler    a5gdb.Pooler
+	tableName string
+}
+
+type dbProgress struct {
+	Steps   string `db:"steps"`
+	Version int64  `db:"version"`
+}
+
+func NewDBStore(p a5gdb.Pooler, tableName string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if tableName == "" {
+		return nil, errors.New("empty tutorial progress table name")
+	}
+	return &dbStore{pooler: p, tableName: tableName}, nil
+}
+
+func (s *dbStore) Get(accountID uint64) (*Progress, error) {
+	x := new(dbProgress)
+	err := s.pooler.ReadPool().NewSession().
+		Select("steps", "version").From(s.tableName).
+		Where(dbr.Eq("account_id", accountID)).LoadOne(x)
+	if err == dbr.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	p := &Progress{Version: x.Version}
+	if err = json.Unmarshal([]byte(x.Steps), &p.Steps); err != nil {
+		return nil, errors.Wrap(err, "tutorial steps")
+	}
+	if p.Steps == nil {
+		p.Steps = make(map[string]*StepState)
+	}
+	return p, nil
+}
+
+func (s *dbStore) Update(accountID uint64, prev, next *Progress) (bool, error) {
+	b, err := json.Marshal(next.Steps)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	sess := s.pooler.WritePool().NewSession()
+	var res sql.Result
+	if prev == nil {
+		res, err = sess.InsertBySql("INSERT IGNORE INTO "+s.tableName+
+			" (account_id, steps, version, updated_at) VALUES (?, ?, ?, ?)",
+			accountID, string(b), next.Version, time.Now().UTC()).Exec()
+	} else {
+		res, err = sess.Update(s.tableName).
+			Set("steps", string(b)).
+			Set("version", next.Version).
+			Set("updated_at", time.Now().UTC()).
+			Where(dbr.Eq("account_id", accountID)).
+			Where(dbr.Eq("version", prev.Version)).Exec()
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "dbr.Exec fn")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql.Result.RowsAffected fn")
+	}
+	return n == 1, nil
+}
@@ -0,0 +1,336 @@
+package a5gtutorial
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrStepUnknown = errors.New("tutorial step unknown")
+	ErrStepOrder   = errors.New("tutorial step out of order")
+)
+
+// Statuses of a step for a player.
+const (
+	StatusPending   = "pending"
+	StatusCompleted = "completed"
+	StatusSkipped   = "skipped"
+)
+
+// Event types passed to listeners; together they make the tutorial
+// funnel.
+const (
+	EventStarted   = "started"
+	EventCompleted = "completed"
+	EventSkipped   = "skipped"
+	EventFinished  = "finished"
+)
+
+// casAttempts bounds retries of progress updates raced by concurrent
+// requests of the same player.
+const casAttempts = 5
+
+// Step is a tutorial step the client plays, Payload is its client config,
+// e.g. the dialog and the highlighted button. SkipWhen names rules of
+// Tutorial.Rules; a step is skipped when any of them holds for the player
+// on the first contact with the tutorial, e.g. "returning" for a player
+// who reinstalled the game.
+type Step struct {
+	ID       string          `json:"id"`
+	SkipWhen []string        `json:"skipWhen,omitempty"`
+	Payload  json.RawMessage `json:"payload,omitempty"`
+}
+
+// Config is an balance data of the tutorial, steps are played in order.
+// Step IDs key the stored progress, so they must not be reused for
+// something else; new steps may be appended.
+type Config struct {
+	steps []*Step
+	byID  map[string]int
+}
+
+func NewConfig(steps []*Step) (*Config, error) {
+	if len(steps) == 0 {
+		return nil, errors.New("empty tutorial steps")
+	}
+	c := &Config{steps: steps, byID: make(map[string]int, len(steps))}
+	for i, x := range steps {
+		if x == nil || x.ID == "" {
+			return nil, errors.New("empty tutorial step id")
+		}
+		if _, ok := c.byID[x.ID]; ok {
+			return nil, errors.Errorf("duplicate tutorial step %q", x.ID)
+		}
+		c.byID[x.ID] = i
+	}
+	return c, nil
+}
+
+func NewConfigJSON(b []byte) (*Config, error) {
+	var steps []*Step
+	if err := json.Unmarshal(b, &steps); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return NewConfig(steps)
+}
+
+// StepState is a finished step of a player, At in unix seconds.
+type StepState struct {
+	Status string `json:"status"`
+	At     int64  `json:"at"`
+}
+
+// Progress is the tutorial of a player, Steps are keyed by step ID.
+// Version is bumped by every update.
+type Progress struct {
+	Steps   map[string]*StepState `json:"steps"`
+	Version int64                 `json:"version"`
+}
+
+func (p *Progress) clone() *Progress {
+	x := &Progress{
+		Steps:   make(map[string]*StepState, len(p.Steps)),
+		Version: p.Version}
+	for k, v := range p.Steps {
+		y := *v
+		x.Steps[k] = &y
+	}
+	return x
+}
+
+// Store keeps tutorial progress. Update replaces the progress of a player
+// only while its version is still that of prev, reporting whether it did;
+// nil prev stands for no progress.
+type Store interface {
+	Get(accountID uint64) (*Progress, error)
+	Update(accountID uint64, prev, next *Progress) (bool, error)
+}
+
+// RuleFunc reports whether a skip rule holds for a player, e.g. whether
+// the account already has progress elsewhere.
+type RuleFunc func(ctx context.Context, accountID uint64) (bool, error)
+
+// Event is passed to listeners, e.g. analytics, after progress is stored.
+// Index is the position of the step in the config.
+type Event struct {
+	Type   string `json:"type"`
+	StepID string `json:"stepId,omitempty"`
+	Index  int    `json:"index"`
+	At     int64  `json:"at"`
+}
+
+type EventFunc func(ctx context.Context, accountID uint64, e *Event)
+
+// Tutorial tracks steps players complete; the server rather than the
+// client decides which step is next, so a reinstalled client resumes
+// where the player stopped.
+type Tutorial struct {
+	Config *Config
+	Store  Store
+	Rules  map[string]RuleFunc
+	Logger a5glogs.Logger
+
+	listeners []EventFunc
+	now       func() time.Time
+}
+
+func NewTutorial(
+	c *Config, s Store, l a5glogs.Logger, listeners ...EventFunc) (*Tutorial, error) {
+	if c == nil {
+		return nil, errors.New("nil tutorial config")
+	}
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Tutorial{
+		Config:    c,
+		Store:     s,
+		Rules:     make(map[string]RuleFunc),
+		Logger:    l,
+		listeners: listeners,
+		now:       time.Now}, nil
+}
+
+// StepView is a step of the player for the client.
+type StepView struct {
+	ID      string          `json:"id"`
+	Status  string          `json:"status"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// State is the tutorial of a player. Current is the step to play, empty
+// once the tutorial is finished.
+type State struct {
+	Steps    []*StepView `json:"steps"`
+	Current  string      `json:"current,omitempty"`
+	Finished bool        `json:"finished"`
+}
+
+// State returns the tutorial of a player, starting it and applying skip
+// rules on the first call.
+func (t *Tutorial) State(ctx context.Context, accountID uint64) (*State, error) {
+	p, err := t.progress(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	return t.state(p), nil
+}
+
+// Complete marks the current step of a player completed. Completing a
+// finished step again is a no-op, so clients may retry.
+func (t *Tutorial) Complete(
+	ctx context.Context, accountID uint64, stepID string) (*State, error) {
+	i, ok := t.Config.byID[stepID]
+	if !ok {
+		return nil, errors.Wrap(ErrStepUnknown, stepID)
+	}
+	p, err := t.progress(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	for n := 0; ; n++ {
+		if p.Steps[stepID] != nil {
+			return t.state(p), nil
+		}
+		if current, _ := t.current(p); current != i {
+			return nil, errors.Wrap(ErrStepOrder, stepID)
+		}
+		next := p.clone()
+		next.Version++
+		next.Steps[stepID] = &StepState{
+			Status: StatusCompleted, At: t.now().Unix()}
+		ok, err := t.Store.Update(accountID, p, next)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			t.emit(ctx, accountID, EventCompleted, i)
+			if _, ok := t.current(next); !ok {
+				t.emit(ctx, accountID, EventFinished, -1)
+			}
+			return t.state(next), nil
+		}
+		if n == casAttempts-1 {
+			return nil, errors.Errorf("tutorial step %q update conflict", stepID)
+		}
+		if p, err = t.Store.Get(accountID); err != nil {
+			return nil, err
+		}
+		if p == nil {
+			return nil, errors.New("tutorial progress vanished")
+		}
+	}
+}
+
+// progress returns the stored progress or starts the tutorial, skipping
+// steps by rules.
+func (t *Tutorial) progress(ctx context.Context, accountID uint64) (*Progress, error) {
+	p, err := t.Store.Get(accountID)
+	if err != nil || p != nil {
+		return p, err
+	}
+	next := &Progress{Steps: make(map[string]*StepState)}
+	at := t.now().Unix()
+	memo := make(map[string]bool)
+	for _, x := range t.Config.steps {
+		skip, err := t.skip(ctx, accountID, x, memo)
+		if err != nil {
+			return nil, err
+		}
+		if skip {
+			next.Steps[x.ID] = &StepState{Status: StatusSkipped, At: at}
+		}
+	}
+	ok, err := t.Store.Update(accountID, nil, next)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		// Started concurrently.
+		if p, err = t.Store.Get(accountID); err != nil {
+			return nil, err
+		}
+		if p == nil {
+			return nil, errors.New("tutorial progress vanished")
+		}
+		return p, nil
+	}
+	t.emit(ctx, accountID, EventStarted, -1)
+	for i, x := range t.Config.steps {
+		if next.Steps[x.ID] != nil {
+			t.emit(ctx, accountID, EventSkipped, i)
+		}
+	}
+	if _, ok := t.current(next); !ok {
+		t.emit(ctx, accountID, EventFinished, -1)
+	}
+	return next, nil
+}
+
+func (t *Tutorial) skip(
+	ctx context.Context, accountID uint64, x *Step, memo map[string]bool) (
+	bool, error) {
+	for _, name := range x.SkipWhen {
+		v, ok := memo[name]
+		if !ok {
+			fn, known := t.Rules[name]
+			if !known {
+				return false, errors.Errorf(
+					"tutorial step %q unknown skip rule %q", x.ID, name)
+			}
+			var err error
+			if v, err = fn(ctx, accountID); err != nil {
+				return false, err
+			}
+			memo[name] = v
+		}
+		if v {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// current returns the index of the first step not finished yet.
+func (t *Tutorial) current(p *Progress) (int, bool) {
+	for i, x := range t.Config.steps {
+		if p.Steps[x.ID] == nil {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func (t *Tutorial) state(p *Progress) *State {
+	s := &State{Steps: make([]*StepView, 0, len(t.Config.steps))}
+	for _, x := range t.Config.steps {
+		v := &StepView{ID: x.ID, Status: StatusPending, Payload: x.Payload}
+		if y := p.Steps[x.ID]; y != nil {
+			v.Status = y.Status
+		}
+		s.Steps = append(s.Steps, v)
+	}
+	if i, ok := t.current(p); ok {
+		s.Current = t.Config.steps[i].ID
+	} else {
+		s.Finished = true
+	}
+	return s
+}
+
+func (t *Tutorial) emit(ctx context.Context, accountID uint64, typ string, i int) {
+	e := &Event{Type: typ, Index: i, At: t.now().Unix()}
+	if i >= 0 {
+		e.StepID = t.Config.steps[i].ID
+	}
+	for _, fn := range t.listeners {
+		fn(ctx, accountID, e)
+	}
+}
@@ -0,0 +1,84 @@
+package a5gtutorial
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestTutorial(t *testing.T) {
+	c, err := NewConfigJSON([]byte(`[
+		{"id": "welcome"},
+		{"id": "first_battle", "skipWhen": ["returning"]},
+		{"id": "shop", "payload": {"highlight": "shop_button"}}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []string
+	tu, err := NewTutorial(c, NewMemoryStore(),
+		a5glogs.NewLogrusWrapper(logrus.New()),
+		func(ctx context.Context, accountID uint64, e *Event) {
+			events = append(events, e.Type+":"+e.StepID)
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.Rules["returning"] = func(ctx context.Context, accountID uint64) (bool, error) {
+		return accountID == 2, nil
+	}
+
+	ctx := context.Background()
+	tests := []struct {
+		name      string
+		accountID uint64
+		step      string
+		err       error
+		current   string
+		statuses  string
+	}{
+		{"unknown", 1, "tavern", ErrStepUnknown, "", ""},
+		{"out of order", 1, "shop", ErrStepOrder, "", ""},
+		{"first", 1, "welcome", nil, "first_battle",
+			"completed pending pending"},
+		{"again", 1, "welcome", nil, "first_battle",
+			"completed pending pending"},
+		{"second", 1, "first_battle", nil, "shop",
+			"completed completed pending"},
+		{"finished", 1, "shop", nil, "",
+			"completed completed completed"},
+		{"returning", 2, "welcome", nil, "shop",
+			"completed skipped pending"},
+	}
+	for _, test := range tests {
+		s, err := tu.Complete(ctx, test.accountID, test.step)
+		if errors.Cause(err) != test.err {
+			t.Fatalf("%s: unexpected error %v", test.name, err)
+		}
+		if err != nil {
+			continue
+		}
+		var statuses []string
+		for _, x := range s.Steps {
+			statuses = append(statuses, x.Status)
+		}
+		if s.Current != test.current || s.Finished != (test.current == "") ||
+			strings.Join(statuses, " ") != test.statuses {
+			t.Errorf("%s: unexpected state %+v, %v", test.name, s, statuses)
+		}
+	}
+	expected := "started: completed:welcome completed:first_battle " +
+		"completed:shop finished: started: skipped:first_battle " +
+		"completed:welcome"
+	if s := strings.Join(events, " "); s != expected {
+		t.Errorf("unexpected events %q", s)
+	}
+
+	tu.Rules = nil
+	if _, err = tu.State(ctx, 3); err == nil {
+		t.Error("expected an unknown skip rule error")
+	}
+}
@@ -0,0 +1,35 @@
+package a5guihints
+
+import (
+	"context"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/armor5games/a5g/a5gvalidate"
+)
+
+type LayoutRequest struct {
+	ClientVersion string `json:"clientVersion" validate:"required,pattern=^[0-9]{1,9}(\\.[0-9]{1,9}){0,3}$"`
+}
+
+// LayoutHandler answers with the layout of the a5gsession authenticated
+// player on the requesting client version.
+func (h *Hints) LayoutHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(LayoutRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			x, err := h.Layout(ctx, int64(s.AccountID),
+				req.Payload.(*LayoutRequest).ClientVersion)
+			if err != nil {
+				h.Logger.Error(err.Error())
+				return nil, a5gapi.NewJSONMsgDefautlErrors(err)
+			}
+			return x, nil
+		})
+}
@@ -0,0 +1,208 @@
+package a5guihints
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gremote"
+	"github.com/pkg/errors"
+)
+
+// Element is a piece of client UI placed into Slot, e.g. a store tab, a
+// banner or a feature entry point. It is shown, in Order, to clients
+// within [MinVersion, MaxVersion) when Flag, a bool flag of the remote
+// config, is on and the player is in any of Segments; empty conditions
+// always hold. Payload is passed to the client as is.
+type Element struct {
+	ID         string          `json:"id"`
+	Slot       string          `json:"slot"`
+	Order      int             `json:"order,omitempty"`
+	Flag       string          `json:"flag,omitempty"`
+	Segments   []string        `json:"segments,omitempty"`
+	MinVersion string          `json:"minVersion,omitempty"`
+	MaxVersion string          `json:"maxVersion,omitempty"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+
+	min, max []int
+}
+
+func (e *Element) parse() error {
+	if e.ID == "" || e.Slot == "" {
+		return errors.New("empty ui element id or slot")
+	}
+	var err error
+	if e.MinVersion != "" {
+		if e.min, err = ParseVersion(e.MinVersion); err != nil {
+			return errors.Wrapf(err, "ui element %q", e.ID)
+		}
+	}
+	if e.MaxVersion != "" {
+		if e.max, err = ParseVersion(e.MaxVersion); err != nil {
+			return errors.Wrapf(err, "ui element %q", e.ID)
+		}
+	}
+	return nil
+}
+
+// ParseVersion parses a dotted numeric client version, e.g. "1.12.3".
+func ParseVersion(s string) ([]int, error) {
+	parts := strings.Split(s, ".")
+	v := make([]int, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, errors.Errorf("invalid version %q", s)
+		}
+		v[i] = n
+	}
+	return v, nil
+}
+
+// compareVersions orders versions, missing parts are zeros.
+func compareVersions(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// Hint is an element as the client lays it out.
+type Hint struct {
+	ID      string          `json:"id"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Layout is the hints of a player by slot. Version is a hash of them, so
+// clients holding it may skip laying out the UI again.
+type Layout struct {
+	Version string             `json:"version"`
+	Slots   map[string][]*Hint `json:"slots"`
+}
+
+// Hints computes layouts from elements, the remote config and segments.
+type Hints struct {
+	Config   *a5gremote.Config
+	Segments a5gremote.SegmentFunc
+	Logger   a5glogs.Logger
+
+	mu       sync.RWMutex
+	elements []*Element
+}
+
+func NewHints(elements []*Element, c *a5gremote.Config, l a5glogs.Logger) (*Hints, error) {
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	h := &Hints{Config: c, Logger: l}
+	if err := h.Replace(elements); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Replace swaps the elements, e.g. on a config reload.
+func (h *Hints) Replace(elements []*Element) error {
+	ids := make(map[string]bool, len(elements))
+	for _, e := range elements {
+		if e == nil {
+			return errors.New("nil ui element")
+		}
+		if err := e.parse(); err != nil {
+			return err
+		}
+		if e.Flag != "" && h.Config == nil {
+			return errors.Errorf("ui element %q: remote config missing", e.ID)
+		}
+		k := e.Slot + ":" + e.ID
+		if ids[k] {
+			return errors.Errorf("duplicate ui element %q", k)
+		}
+		ids[k] = true
+	}
+	a := append([]*Element(nil), elements...)
+	sort.SliceStable(a, func(i, j int) bool { return a[i].Order < a[j].Order })
+	h.mu.Lock()
+	h.elements = a
+	h.mu.Unlock()
+	return nil
+}
+
+// Layout returns the layout of a player on a client version.
+func (h *Hints) Layout(
+	ctx context.Context, playerID int64, clientVersion string) (*Layout, error) {
+	version, err := ParseVersion(clientVersion)
+	if err != nil {
+		return nil, err
+	}
+	h.mu.RLock()
+	elements := h.elements
+	h.mu.RUnlock()
+	var flags *a5gremote.Snapshot
+	if h.Config != nil {
+		if flags, err = h.Config.Resolve(ctx, playerID, false); err != nil {
+			return nil, err
+		}
+	}
+	var segments []string
+	segmented := false
+	x := &Layout{Slots: make(map[string][]*Hint)}
+	for _, e := range elements {
+		if e.min != nil && compareVersions(version, e.min) < 0 ||
+			e.max != nil && compareVersions(version, e.max) >= 0 {
+			continue
+		}
+		if e.Flag != "" && !flags.Bool(e.Flag) {
+			continue
+		}
+		if len(e.Segments) > 0 {
+			if !segmented && h.Segments != nil {
+				if segments, err = h.Segments(ctx, playerID); err != nil {
+					return nil, err
+				}
+			}
+			segmented = true
+			if !intersects(e.Segments, segments) {
+				continue
+			}
+		}
+		x.Slots[e.Slot] = append(x.Slots[e.Slot], &Hint{ID: e.ID, Payload: e.Payload})
+	}
+	// Map keys are marshaled sorted, so equal layouts hash equally.
+	b, err := json.Marshal(x.Slots)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	sum := sha256.Sum256(b)
+	x.Version = hex.EncodeToString(sum[:8])
+	return x, nil
+}
+
+func intersects(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
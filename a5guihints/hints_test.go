@@ -0,0 +1,78 @@
+package a5guihints
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gremote"
+	"github.com/sirupsen/logrus"
+)
+
+func TestHintsLayout(t *testing.T) {
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	c, err := a5gremote.NewConfig(context.Background(),
+		a5gremote.SourceFunc(func(context.Context) ([]byte, error) {
+			return []byte(`{"flags": [
+				{"key": "clans", "type": "bool", "default": false}],
+				"overrides": [{"segment": "beta", "values": {"clans": true}}]}`), nil
+		}), l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Segments = func(ctx context.Context, playerID int64) ([]string, error) {
+		if playerID == 2 {
+			return []string{"beta", "payer"}, nil
+		}
+		return nil, nil
+	}
+	h, err := NewHints([]*Element{
+		{ID: "gems", Slot: "store_tab", Order: 2},
+		{ID: "offers", Slot: "store_tab", Order: 1, Segments: []string{"payer"}},
+		{ID: "clans", Slot: "menu", Flag: "clans"},
+		{ID: "pass", Slot: "store_tab", Order: 3, MinVersion: "1.10"},
+		{ID: "old_shop", Slot: "menu", MaxVersion: "1.10"},
+	}, c, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Segments = c.Segments
+	if err = h.Replace([]*Element{{ID: "x", Slot: "menu", MinVersion: "1.x"}}); err == nil {
+		t.Error("expected an invalid version error")
+	}
+
+	var a = []struct {
+		playerID int64
+		version  string
+		layout   string
+	}{
+		{1, "1.9.5", "menu:old_shop store_tab:gems"},
+		{1, "1.10", "store_tab:gems,pass"},
+		{2, "1.10.1", "menu:clans store_tab:offers,gems,pass"},
+	}
+	versions := make(map[string]bool)
+	for _, v := range a {
+		x, err := h.Layout(context.Background(), v.playerID, v.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var slots []string
+		for _, slot := range []string{"menu", "store_tab"} {
+			var ids []string
+			for _, hint := range x.Slots[slot] {
+				ids = append(ids, hint.ID)
+			}
+			if len(ids) > 0 {
+				slots = append(slots, slot+":"+strings.Join(ids, ","))
+			}
+		}
+		if got := strings.Join(slots, " "); got != v.layout {
+			t.Errorf("%d %s: unexpected layout %q", v.playerID, v.version, got)
+		}
+		versions[x.Version] = true
+	}
+	if len(versions) != len(a) {
+		t.Error("layouts share a version")
+	}
+}
@@ -0,0 +1,65 @@
+package a5gundo
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCodeActionNotFound = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4042,
+		Name:     "undo_action_not_found",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "nothing to undo"})
+
+	ErrCodeWindowExpired = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4100,
+		Name:     "undo_window_expired",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "undo window expired"})
+)
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeActionNotFound, http.StatusNotFound)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeWindowExpired, http.StatusGone)
+}
+
+type UndoRequest struct {
+	ActionID string `json:"actionId"`
+}
+
+// Handler is the undo endpoint for a5gsession authenticated players,
+// answering with the undone Action.
+func (u *Undoer) Handler(l a5glogs.Logger) a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		s, ok := a5gsession.FromContext(ctx)
+		if !ok {
+			return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+		}
+		p := new(UndoRequest)
+		if err := a5ghttp.DecodePayload(req, p); err != nil || p.ActionID == "" {
+			return nil, []*a5gapi.APIErr{
+				a5gapi.NewErr(a5ghttp.ErrCodeRequestMalformed, "")}
+		}
+		a, err := u.Undo(ctx, s.AccountID, p.ActionID)
+		switch errors.Cause(err) {
+		case nil:
+			return a, nil
+		case ErrActionNotFound:
+			return nil, []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeActionNotFound, "")}
+		case ErrWindowExpired:
+			return nil, []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeWindowExpired, "")}
+		}
+		l.Error(err.Error())
+		return nil, a5gapi.NewJSONMsgDefautlErrors(err)
+	}
+}
@@ -0,0 +1,235 @@
+package a5gundo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrActionNotFound = errors.New("undo action not found")
+	ErrWindowExpired  = errors.New("undo window expired")
+)
+
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusUndone    Status = "undone"
+	StatusFinalized Status = "finalized"
+)
+
+func (s Status) String() string { return string(s) }
+
+// Action is a destructive player action (salvage item, dismiss hero) kept
+// reversible until ExpiresAt. Payload is whatever its kind needs to undo
+// or finalize it, e.g. the soft-deleted item id.
+type Action struct {
+	ID        string          `json:"id"`
+	AccountID uint64          `json:"accountId"`
+	Kind      string          `json:"kind"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	Status    Status          `json:"status"`
+	CreatedAt time.Time       `json:"createdAt"`
+	ExpiresAt time.Time       `json:"expiresAt"`
+}
+
+// Kind reverses an action (restores soft-deleted state) or finalizes it
+// (hard-deletes) once the undo window is over.
+type Kind struct {
+	Window   time.Duration
+	Undo     func(context.Context, *Action) error
+	Finalize func(context.Context, *Action) error
+}
+
+// Store keeps actions; Take and TakeExpired move pending actions to the
+// given status atomically so an action is undone or finalized only once.
+type Store interface {
+	Put(a *Action) error
+	Take(accountID uint64, id string, now time.Time, s Status) (*Action, error)
+	TakeExpired(now time.Time, limit int) ([]*Action, error)
+}
+
+// Undoer records reversible actions and undoes or finalizes them.
+type Undoer struct {
+	Store Store
+
+	mu    sync.RWMutex
+	kinds map[string]*Kind
+	now   func() time.Time
+}
+
+func NewUndoer(s Store) (*Undoer, error) {
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	return &Undoer{Store: s, kinds: make(map[string]*Kind), now: time.Now}, nil
+}
+
+func (u *Undoer) Register(name string, k *Kind) error {
+	if name == "" {
+		return errors.New("empty action kind")
+	}
+	if k == nil || k.Undo == nil || k.Finalize == nil || k.Window <= 0 {
+		return errors.Errorf("incomplete action kind %q", name)
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if _, ok := u.kinds[name]; ok {
+		return errors.Errorf("action kind %q already registered", name)
+	}
+	u.kinds[name] = k
+	return nil
+}
+
+func (u *Undoer) kind(name string) (*Kind, error) {
+	u.mu.RLock()
+	k, ok := u.kinds[name]
+	u.mu.RUnlock()
+	if !ok {
+		return nil, errors.Errorf("unknown action kind %q", name)
+	}
+	return k, nil
+}
+
+// Record is called by the handler after the soft delete; payload is
+// marshaled to JSON.
+func (u *Undoer) Record(
+	accountID uint64, kind string, payload interface{}) (*Action, error) {
+	k, err := u.kind(kind)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	id := make([]byte, 16)
+	if _, err = rand.Read(id); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	now := u.now()
+	a := &Action{
+		ID:        hex.EncodeToString(id),
+		AccountID: accountID,
+		Kind:      kind,
+		Payload:   b,
+		Status:    StatusPending,
+		CreatedAt: now,
+		ExpiresAt: now.Add(k.Window)}
+	if err = u.Store.Put(a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Undo reverses a pending action of the account.
+func (u *Undoer) Undo(ctx context.Context, accountID uint64, id string) (
+	*Action, error) {
+	a, err := u.Store.Take(accountID, id, u.now(), StatusUndone)
+	if err != nil {
+		return nil, err
+	}
+	k, err := u.kind(a.Kind)
+	if err != nil {
+		return nil, err
+	}
+	if err = k.Undo(ctx, a); err != nil {
+		a.Status = StatusPending
+		if err2 := u.Store.Put(a); err2 != nil {
+			return nil, errors.Wrap(err, err2.Error())
+		}
+		return nil, err
+	}
+	return a, nil
+}
+
+// FinalizeExpired finalizes up to limit actions whose window is over; run
+// it periodically (e.g. as an a5gjobs job). It returns the number done,
+// failed actions stay pending and are retried by the next run.
+func (u *Undoer) FinalizeExpired(ctx context.Context, limit int) (int, error) {
+	a, err := u.Store.TakeExpired(u.now(), limit)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	var errs []string
+	for _, x := range a {
+		k, err := u.kind(x.Kind)
+		if err == nil {
+			err = k.Finalize(ctx, x)
+		}
+		if err == nil {
+			n++
+			continue
+		}
+		// Put it back to retry on the next run.
+		errs = append(errs, x.ID+": "+err.Error())
+		x.Status = StatusPending
+		if err = u.Store.Put(x); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) != 0 {
+		return n, errors.Errorf("finalize actions: %s", strings.Join(errs, "; "))
+	}
+	return n, nil
+}
+
+type memoryStore struct {
+	mu      sync.Mutex
+	actions map[string]*Action
+}
+
+// NewMemoryStore is a single-process Store; finished actions are dropped.
+func NewMemoryStore() Store {
+	return &memoryStore{actions: make(map[string]*Action)}
+}
+
+func (s *memoryStore) Put(a *Action) error {
+	x := *a
+	s.mu.Lock()
+	s.actions[a.ID] = &x
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryStore) Take(
+	accountID uint64, id string, now time.Time, st Status) (*Action, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.actions[id]
+	if !ok || a.AccountID != accountID {
+		return nil, ErrActionNotFound
+	}
+	if !now.Before(a.ExpiresAt) {
+		return nil, ErrWindowExpired
+	}
+	delete(s.actions, id)
+	a.Status = st
+	return a, nil
+}
+
+func (s *memoryStore) TakeExpired(now time.Time, limit int) ([]*Action, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var a []*Action
+	for id, x := range s.actions {
+		if len(a) == limit {
+			break
+		}
+		if now.Before(x.ExpiresAt) {
+			continue
+		}
+		delete(s.actions, id)
+		x.Status = StatusFinalized
+		a = append(a, x)
+	}
+	return a, nil
+}
@@ -0,0 +1,104 @@
+package a5gundo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestUndoWindow(t *testing.T) {
+	u, err := NewUndoer(NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1000, 0)
+	u.now = func() time.Time { return now }
+	var undone, finalized []string
+	var failUndo, failFinalize bool
+	err = u.Register("salvage", &Kind{
+		Window: 10 * time.Minute,
+		Undo: func(_ context.Context, a *Action) error {
+			if failUndo {
+				return errors.New("restore failed")
+			}
+			undone = append(undone, string(a.Payload))
+			return nil
+		},
+		Finalize: func(_ context.Context, a *Action) error {
+			if failFinalize {
+				return errors.New("delete failed")
+			}
+			finalized = append(finalized, string(a.Payload))
+			return nil
+		}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = u.Record(1, "dismiss", nil); err == nil {
+		t.Error("recorded an action of an unknown kind")
+	}
+	ctx := context.Background()
+	a, err := u.Record(1, "salvage", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := u.Record(1, "salvage", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.ExpiresAt.Equal(now.Add(10*time.Minute)) || a.Status != StatusPending {
+		t.Errorf("unexpected action %+v", a)
+	}
+
+	tests := []struct {
+		name      string
+		after     time.Duration
+		accountID uint64
+		id        string
+		failUndo  bool
+		err       error
+	}{
+		{"other account", 0, 2, a.ID, false, ErrActionNotFound},
+		{"unknown", 0, 1, "x", false, ErrActionNotFound},
+		{"undo fails", time.Minute, 1, a.ID, true, nil},
+		{"in window", 8 * time.Minute, 1, a.ID, false, nil},
+		{"undone twice", 0, 1, a.ID, false, ErrActionNotFound},
+		{"window over", time.Minute, 1, b.ID, false, ErrWindowExpired},
+	}
+	for _, x := range tests {
+		now = now.Add(x.after)
+		failUndo = x.failUndo
+		got, err := u.Undo(ctx, x.accountID, x.id)
+		switch {
+		case x.failUndo:
+			if err == nil {
+				t.Errorf("%s: undo error lost", x.name)
+			}
+		case errors.Cause(err) != x.err:
+			t.Errorf("%s: Undo() => %v want %v", x.name, err, x.err)
+		case err == nil && got.Status != StatusUndone:
+			t.Errorf("%s: status %q", x.name, got.Status)
+		}
+	}
+	if len(undone) != 1 || undone[0] != "7" {
+		t.Errorf("undone %q", undone)
+	}
+
+	// A failed finalize stays pending for the next run.
+	failFinalize = true
+	if n, err := u.FinalizeExpired(ctx, 10); n != 0 || err == nil {
+		t.Errorf("FinalizeExpired() => %d, %v", n, err)
+	}
+	failFinalize = false
+	if n, err := u.FinalizeExpired(ctx, 10); n != 1 || err != nil {
+		t.Errorf("FinalizeExpired() => %d, %v", n, err)
+	}
+	if n, err := u.FinalizeExpired(ctx, 10); n != 0 || err != nil {
+		t.Errorf("FinalizeExpired() => %d, %v on an empty store", n, err)
+	}
+	if len(finalized) != 1 || finalized[0] != "8" {
+		t.Errorf("finalized %q", finalized)
+	}
+}
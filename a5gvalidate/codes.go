@@ -0,0 +1,61 @@
+package a5gvalidate
+
+import (
+	"net/http"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+)
+
+var (
+	ErrCodeRequired = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4221,
+		Name:     "validation_required",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "field is required"})
+
+	ErrCodeMin = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4222,
+		Name:     "validation_min",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "value is too small"})
+
+	ErrCodeMax = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4223,
+		Name:     "validation_max",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "value is too large"})
+
+	ErrCodeOneOf = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4224,
+		Name:     "validation_oneof",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "value is not allowed"})
+
+	ErrCodePattern = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4225,
+		Name:     "validation_pattern",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "value has invalid format"})
+
+	// ErrCodeInvalid is for Validator rules without a code of their own.
+	ErrCodeInvalid = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4226,
+		Name:     "validation_invalid",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "value is invalid"})
+)
+
+func init() {
+	for _, c := range []a5gapi.APIErrCode{
+		ErrCodeRequired, ErrCodeMin, ErrCodeMax, ErrCodeOneOf, ErrCodePattern,
+		ErrCodeInvalid} {
+		a5ghttp.DefaultStatusMapper.SetCode(c, http.StatusUnprocessableEntity)
+	}
+}
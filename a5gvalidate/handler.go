@@ -0,0 +1,45 @@
+package a5gvalidate
+
+import (
+	"context"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+)
+
+// Decode unmarshals payload of a request decoded by a5ghttp.Adapter (or
+// a5gws) into v and validates it.
+func Decode(req *a5gapi.APIMsgRequest, v interface{}) []*a5gapi.APIErr {
+	if err := a5ghttp.DecodePayload(req, v); err != nil {
+		return []*a5gapi.APIErr{
+			a5gapi.NewErr(a5ghttp.ErrCodeRequestMalformed, "%s", err.Error())}
+	}
+	if a := Validate(v); a != nil {
+		return a.APIErrs()
+	}
+	return nil
+}
+
+// Handler decodes and validates the payload into a value newPayload
+// returns before fn runs; fn finds it in req.Payload:
+//
+//	a5gvalidate.Handler(
+//		func() interface{} { return new(CreateClan) },
+//		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+//			interface{}, []*a5gapi.APIErr) {
+//			p := req.Payload.(*CreateClan)
+//			...
+//		})
+func Handler(
+	newPayload func() interface{}, fn a5ghttp.HandlerFunc) a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		v := newPayload()
+		if errs := Decode(req, v); errs != nil {
+			return nil, errs
+		}
+		x := *req
+		x.Payload = v
+		return fn(ctx, &x)
+	}
+}
@@ -0,0 +1,275 @@
+package a5gvalidate
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/armor5games/a5g/a5gapi"
+)
+
+// Validator is implemented by payload types (or their nested structs) with
+// rules struct tags can not express. Returned errors are relative to the
+// struct, Validate prefixes their fields with the struct path.
+type Validator interface {
+	Validate() Errors
+}
+
+// FieldError is a failed rule of one field; Code is one of the ErrCode*
+// validation codes (or any registered code for custom rules).
+type FieldError struct {
+	Field   string
+	Code    a5gapi.APIErrCode
+	Details string
+}
+
+func (e *FieldError) Error() string {
+	if e.Details == "" {
+		return e.Field
+	}
+	return e.Field + ": " + e.Details
+}
+
+type Errors []*FieldError
+
+func (a Errors) Error() string {
+	s := make([]string, len(a))
+	for i, e := range a {
+		s[i] = e.Error()
+	}
+	return strings.Join(s, "; ")
+}
+
+// APIErrs converts field errors to public API errors carrying field paths.
+func (a Errors) APIErrs() []*a5gapi.APIErr {
+	var errs []*a5gapi.APIErr
+	for _, e := range a {
+		x := a5gapi.NewErr(e.Code, "%s", e.Details)
+		if e.Details == "" {
+			x = a5gapi.NewErr(e.Code, "")
+		}
+		x.Field = e.Field
+		errs = append(errs, x)
+	}
+	return errs
+}
+
+// Validate checks `validate` struct tags of v and calls Validator of every
+// struct met, fields are named by their json names:
+//
+//	type Payload struct {
+//		Name  string `json:"name" validate:"required,min=3,max=16"`
+//		Class string `json:"class" validate:"oneof=warrior mage"`
+//		Tag   string `json:"tag" validate:"pattern=^[A-Z0-9]{2,5}$"`
+//		Items []Item `json:"items" validate:"max=20"`
+//	}
+//
+// min and max bound numbers by value and strings, slices and maps by
+// length; pattern takes the rest of the tag, so it goes last. Unknown rules
+// panic, they are programming errors.
+func Validate(v interface{}) Errors {
+	var a Errors
+	walk(reflect.ValueOf(v), "", &a)
+	if len(a) == 0 {
+		return nil
+	}
+	return a
+}
+
+var validatorType = reflect.TypeOf((*Validator)(nil)).Elem()
+
+func walk(v reflect.Value, path string, a *Errors) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		walkStruct(v, path, a)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			walk(v.Index(i), fmt.Sprintf("%s[%d]", path, i), a)
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			walk(v.MapIndex(k), fmt.Sprintf("%s[%v]", path, k.Interface()), a)
+		}
+	}
+}
+
+func walkStruct(v reflect.Value, path string, a *Errors) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := jsonName(f)
+		if name == "-" {
+			continue
+		}
+		p := name
+		if f.Anonymous && f.Tag.Get("json") == "" {
+			p = path
+		} else if path != "" {
+			p = path + "." + name
+		}
+		fv := v.Field(i)
+		if tag := f.Tag.Get("validate"); tag != "" {
+			if !check(fv, p, tag, a) {
+				continue
+			}
+		}
+		walk(fv, p, a)
+	}
+	x := v
+	if !x.Type().Implements(validatorType) && x.CanAddr() {
+		x = x.Addr()
+	}
+	if x.Type().Implements(validatorType) {
+		for _, e := range x.Interface().(Validator).Validate() {
+			e2 := *e
+			switch {
+			case path == "":
+			case e2.Field == "":
+				e2.Field = path
+			case strings.HasPrefix(e2.Field, "["):
+				e2.Field = path + e2.Field
+			default:
+				e2.Field = path + "." + e2.Field
+			}
+			*a = append(*a, &e2)
+		}
+	}
+}
+
+func jsonName(f reflect.StructField) string {
+	s := strings.Split(f.Tag.Get("json"), ",")[0]
+	if s == "" {
+		return f.Name
+	}
+	return s
+}
+
+// check applies tag rules to v, it stops at the first failed rule and
+// reports whether nested values are worth checking.
+func check(v reflect.Value, path, tag string, a *Errors) bool {
+	for tag != "" {
+		var rule string
+		switch i := strings.IndexByte(tag, ','); {
+		case strings.HasPrefix(tag, "pattern="), i < 0:
+			rule, tag = tag, ""
+		default:
+			rule, tag = tag[:i], tag[i+1:]
+		}
+		name, arg := rule, ""
+		if i := strings.IndexByte(rule, '='); i >= 0 {
+			name, arg = rule[:i], rule[i+1:]
+		}
+		var e *FieldError
+		switch name {
+		case "required":
+			if isZero(v) {
+				e = &FieldError{Code: ErrCodeRequired}
+			}
+		case "min", "max":
+			e = checkBound(v, name == "min", arg)
+		case "oneof":
+			if !isZero(v) && !oneOf(v, strings.Fields(arg)) {
+				e = &FieldError{Code: ErrCodeOneOf, Details: arg}
+			}
+		case "pattern":
+			if s := indirect(v); s.Kind() == reflect.String && s.Len() > 0 &&
+				!pattern(arg).MatchString(s.String()) {
+				e = &FieldError{Code: ErrCodePattern}
+			}
+		default:
+			panic(fmt.Sprintf("unknown validation rule %q of %s", name, path))
+		}
+		if e != nil {
+			e.Field = path
+			*a = append(*a, e)
+			return false
+		}
+	}
+	return true
+}
+
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v
+}
+
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	case reflect.Slice, reflect.Map, reflect.String, reflect.Array:
+		return v.Len() == 0
+	}
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
+
+func checkBound(v reflect.Value, isMin bool, arg string) *FieldError {
+	bound, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		panic(fmt.Sprintf("invalid validation bound %q", arg))
+	}
+	v = indirect(v)
+	var x float64
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		x = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64:
+		x = float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		x = v.Float()
+	case reflect.String:
+		x = float64(len([]rune(v.String())))
+	case reflect.Slice, reflect.Map, reflect.Array:
+		x = float64(v.Len())
+	default:
+		return nil
+	}
+	switch {
+	case isMin && x < bound:
+		return &FieldError{Code: ErrCodeMin, Details: arg}
+	case !isMin && x > bound:
+		return &FieldError{Code: ErrCodeMax, Details: arg}
+	}
+	return nil
+}
+
+func oneOf(v reflect.Value, a []string) bool {
+	s := fmt.Sprint(indirect(v).Interface())
+	for _, x := range a {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	patternsMu sync.Mutex
+	patterns   = make(map[string]*regexp.Regexp)
+)
+
+func pattern(s string) *regexp.Regexp {
+	patternsMu.Lock()
+	defer patternsMu.Unlock()
+	r, ok := patterns[s]
+	if !ok {
+		r = regexp.MustCompile(s)
+		patterns[s] = r
+	}
+	return r
+}
@@ -0,0 +1,64 @@
+package a5gvalidate
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/armor5games/a5g/a5gapi"
+)
+
+type testItem struct {
+	ID    uint64 `json:"id" validate:"required"`
+	Count int    `json:"count" validate:"min=1,max=99"`
+}
+
+type testPayload struct {
+	Name  string     `json:"name" validate:"required,min=3,max=16"`
+	Class string     `json:"class" validate:"oneof=warrior mage"`
+	Tag   string     `json:"tag" validate:"pattern=^[A-Z0-9]{2,5}$"`
+	Items []testItem `json:"items" validate:"max=2"`
+	From  int        `json:"from"`
+	To    int        `json:"to"`
+}
+
+func (p *testPayload) Validate() Errors {
+	if p.From > p.To {
+		return Errors{{Field: "to", Code: ErrCodeInvalid}}
+	}
+	return nil
+}
+
+func TestValidate(t *testing.T) {
+	var a = []struct {
+		in     *testPayload
+		fields []string
+		codes  []a5gapi.APIErrCode
+	}{
+		{&testPayload{Name: "abc", Class: "mage", Tag: "A1"}, nil, nil},
+		{&testPayload{}, []string{"name"}, []a5gapi.APIErrCode{ErrCodeRequired}},
+		{&testPayload{Name: "ab", Class: "rogue", Tag: "a"},
+			[]string{"name", "class", "tag"},
+			[]a5gapi.APIErrCode{ErrCodeMin, ErrCodeOneOf, ErrCodePattern}},
+		{&testPayload{Name: "abc", Items: []testItem{{ID: 1, Count: 1}, {Count: 100}}},
+			[]string{"items[1].id", "items[1].count"},
+			[]a5gapi.APIErrCode{ErrCodeRequired, ErrCodeMax}},
+		{&testPayload{Name: "abc", Items: make([]testItem, 3)},
+			[]string{"items"}, []a5gapi.APIErrCode{ErrCodeMax}},
+		{&testPayload{Name: "abc", From: 2, To: 1},
+			[]string{"to"}, []a5gapi.APIErrCode{ErrCodeInvalid}},
+	}
+	for i, v := range a {
+		var (
+			fields []string
+			codes  []a5gapi.APIErrCode
+		)
+		for _, e := range Validate(v.in) {
+			fields = append(fields, e.Field)
+			codes = append(codes, e.Code)
+		}
+		if !reflect.DeepEqual(fields, v.fields) || !reflect.DeepEqual(codes, v.codes) {
+			t.Errorf("#%d: Validate => %v %v want %v %v",
+				i, fields, codes, v.fields, v.codes)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package a5gvoice
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCodeRoomUnknown = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4066,
+		Name:     "voice_room_unknown",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "voice room not found"})
+
+	ErrCodeNotMember = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4267,
+		Name:     "voice_not_member",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "not a member of the party or match"})
+
+	ErrCodeBanned = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4268,
+		Name:     "voice_banned",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "banned from voice chat"})
+
+	ErrCodeSanctionInvalid = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4269,
+		Name:     "voice_sanction_invalid",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "unexpected voice sanction"})
+)
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeRoomUnknown, http.StatusNotFound)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeNotMember, http.StatusForbidden)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeBanned, http.StatusForbidden)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeSanctionInvalid, http.StatusUnprocessableEntity)
+}
+
+type JoinRequest struct {
+	Kind string `json:"kind" validate:"required,max=32"`
+	ID   string `json:"id" validate:"required,max=64"`
+}
+
+type SanctionRequest struct {
+	AccountID uint64 `json:"accountId" validate:"required"`
+	Kind      string `json:"kind" validate:"oneof=mute ban"`
+	// Seconds is the length of the sanction.
+	Seconds int64 `json:"seconds" validate:"min=1"`
+}
+
+type LiftRequest struct {
+	AccountID uint64 `json:"accountId" validate:"required"`
+}
+
+// JoinHandler answers with a Grant to the room of a party or match of
+// the session player.
+func (v *Voice) JoinHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(JoinRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			r := req.Payload.(*JoinRequest)
+			g, err := v.Join(ctx, s.AccountID, r.Kind, r.ID)
+			if err != nil {
+				return nil, v.apiErrs(err)
+			}
+			return g, nil
+		})
+}
+
+// SanctionHandler mutes or bans a player in voice chat, mount it on an
+// admin route class.
+func (v *Voice) SanctionHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(SanctionRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			r := req.Payload.(*SanctionRequest)
+			err := v.Sanction(ctx, r.AccountID, r.Kind,
+				time.Duration(r.Seconds)*time.Second)
+			if err != nil {
+				return nil, v.apiErrs(err)
+			}
+			return r, nil
+		})
+}
+
+// LiftHandler ends a voice sanction, mount it on an admin route class.
+func (v *Voice) LiftHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return new(LiftRequest) },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			r := req.Payload.(*LiftRequest)
+			if err := v.Lift(ctx, r.AccountID); err != nil {
+				return nil, v.apiErrs(err)
+			}
+			return r, nil
+		})
+}
+
+func (v *Voice) apiErrs(err error) []*a5gapi.APIErr {
+	switch errors.Cause(err) {
+	case ErrRoomUnknown:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeRoomUnknown, "")}
+	case ErrNotMember:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeNotMember, "")}
+	case ErrBanned:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeBanned, "%s", err)}
+	case ErrSanctionInvalid:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeSanctionInvalid, "%s", err)}
+	}
+	v.Logger.Error(err.Error())
+	return a5gapi.NewJSONMsgDefautlErrors(err)
+}
@@ -0,0 +1,165 @@
+package a5gvoice
+
+import (
+	"sync"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryStore struct {
+	mu        sync.Mutex
+	sanctions map[uint64]Sanction
+	sessions  map[uint64]map[string]int64
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{
+		sanctions: make(map[uint64]Sanction),
+		sessions:  make(map[uint64]map[string]int64)}
+}
+
+func (s *memoryStore) Sanction(accountID uint64, now int64) (*Sanction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	x, ok := s.sanctions[accountID]
+	if !ok || x.Until <= now {
+		return nil, nil
+	}
+	return &x, nil
+}
+
+func (s *memoryStore) SetSanction(x *Sanction) error {
+	s.mu.Lock()
+	s.sanctions[x.AccountID] = *x
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryStore) ClearSanction(accountID uint64) error {
+	s.mu.Lock()
+	delete(s.sanctions, accountID)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryStore) AddSession(x *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rooms, ok := s.sessions[x.AccountID]
+	if !ok {
+		rooms = make(map[string]int64)
+		s.sessions[x.AccountID] = rooms
+	}
+	rooms[x.Room] = x.ExpiresAt
+	return nil
+}
+
+func (s *memoryStore) Sessions(accountID uint64, now int64) ([]*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := []*Session{}
+	for room, expiresAt := range s.sessions[accountID] {
+		if expiresAt <= now {
+			delete(s.sessions[accountID], room)
+			continue
+		}
+		a = append(a, &Session{Room: room, AccountID: accountID, ExpiresAt: expiresAt})
+	}
+	return a, nil
+}
+
+// dbStore keeps sanctions and sessions in MySQL tables:
+//
+//	CREATE TABLE voice_sanctions (
+//	  account_id BIGINT UNSIGNED NOT NULL PRIMARY KEY,
+//	  kind VARCHAR(16) NOT NULL,
+//	  expires_at BIGINT NOT NULL);
+//
+//	CREATE TABLE voice_sessions (
+//	  account_id BIGINT UNSIGNED NOT NULL,
+//	  room VARCHAR(128) NOT NULL,
+//	  expires_at BIGINT NOT NULL,
+//	  PRIMARY KEY (account_id, room),
+//	  KEY expires (expires_at));
+//
+// Expired sessions are left for a periodic DELETE by expires_at.
+type dbStore struct {
+	pooler        a5gdb.Pooler
+	sanctionTable string
+	sessionTable  string
+}
+
+func NewDBStore(p a5gdb.Pooler, sanctionTable, sessionTable string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if sanctionTable == "" || sessionTable == "" {
+		return nil, errors.New("empty voice table name")
+	}
+	return &dbStore{
+		pooler:        p,
+		sanctionTable: sanctionTable,
+		sessionTable:  sessionTable}, nil
+}
+
+func (s *dbStore) Sanction(accountID uint64, now int64) (*Sanction, error) {
+	x := new(Sanction)
+	err := s.pooler.ReadPool().NewSession().
+		Select("account_id", "kind", "expires_at").From(s.sanctionTable).
+		Where(dbr.Eq("account_id", accountID)).
+		Where(dbr.Gt("expires_at", now)).LoadOne(x)
+	if err == dbr.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).LoadOne fn")
+	}
+	return x, nil
+}
+
+func (s *dbStore) SetSanction(x *Sanction) error {
+	_, err := s.pooler.WritePool().NewSession().InsertBySql("INSERT INTO "+
+		s.sanctionTable+" (account_id, kind, expires_at) VALUES (?, ?, ?)"+
+		" ON DUPLICATE KEY UPDATE kind = VALUES(kind),"+
+		" expires_at = VALUES(expires_at)",
+		x.AccountID, x.Kind, x.Until).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	return nil
+}
+
+func (s *dbStore) ClearSanction(accountID uint64) error {
+	_, err := s.pooler.WritePool().NewSession().
+		DeleteFrom(s.sanctionTable).
+		Where(dbr.Eq("account_id", accountID)).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*DeleteStmt).Exec fn")
+	}
+	return nil
+}
+
+func (s *dbStore) AddSession(x *Session) error {
+	_, err := s.pooler.WritePool().NewSession().InsertBySql("INSERT INTO "+
+		s.sessionTable+" (account_id, room, expires_at) VALUES (?, ?, ?)"+
+		" ON DUPLICATE KEY UPDATE expires_at = VALUES(expires_at)",
+		x.AccountID, x.Room, x.ExpiresAt).Exec()
+	if err != nil {
+		return errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	return nil
+}
+
+func (s *dbStore) Sessions(accountID uint64, now int64) ([]*Session, error) {
+	a := []*Session{}
+	_, err := s.pooler.ReadPool().NewSession().
+		Select("room", "account_id", "expires_at").From(s.sessionTable).
+		Where(dbr.Eq("account_id", accountID)).
+		Where(dbr.Gt("expires_at", now)).Load(&a)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	return a, nil
+}
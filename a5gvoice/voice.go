@@ -0,0 +1,217 @@
+package a5gvoice
+
+import (
+	"context"
+	"time"
+
+	"github.com/armor5games/a5g/a5gfields"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrRoomUnknown     = errors.New("voice room unknown")
+	ErrNotMember       = errors.New("not a voice room member")
+	ErrBanned          = errors.New("banned from voice chat")
+	ErrSanctionInvalid = errors.New("voice sanction invalid")
+)
+
+// Kinds of rooms, players join the room of their party or match.
+const (
+	KindParty = "party"
+	KindMatch = "match"
+)
+
+// Kinds of sanctions. Muted players join rooms to listen only, banned
+// ones can not join at all.
+const (
+	SanctionMute = "mute"
+	SanctionBan  = "ban"
+)
+
+// Provider is a third-party voice service such as Vivox or Agora. Token
+// signs access to a room, listen-only for muted players; Mute and Kick
+// apply sanctions to players already in a room.
+type Provider interface {
+	Token(ctx context.Context, room string, accountID uint64, listenOnly bool,
+		ttl time.Duration) (string, error)
+	Mute(ctx context.Context, room string, accountID uint64, muted bool) error
+	Kick(ctx context.Context, room string, accountID uint64) error
+}
+
+// MembersFunc returns players of a party or match, nil when it is gone.
+type MembersFunc func(ctx context.Context, id string) ([]uint64, error)
+
+// Grant is what a client passes to the voice SDK, ExpiresAt in unix
+// seconds.
+type Grant struct {
+	Room       string `json:"room"`
+	Token      string `json:"token"`
+	ListenOnly bool   `json:"listenOnly"`
+	ExpiresAt  int64  `json:"expiresAt"`
+}
+
+// Sanction is a moderation action on voice chat, Until in unix seconds.
+type Sanction struct {
+	AccountID uint64 `json:"accountId" db:"account_id"`
+	Kind      string `json:"kind" db:"kind"`
+	Until     int64  `json:"until" db:"expires_at"`
+}
+
+// Session is a room a player got a token for, kept until the token
+// expires so sanctions reach players already talking.
+type Session struct {
+	Room      string `db:"room"`
+	AccountID uint64 `db:"account_id"`
+	ExpiresAt int64  `db:"expires_at"`
+}
+
+// Store keeps sanctions and sessions. Sanction returns nil when the
+// player has none in force at now; Sessions lists unexpired ones.
+type Store interface {
+	Sanction(accountID uint64, now int64) (*Sanction, error)
+	SetSanction(s *Sanction) error
+	ClearSanction(accountID uint64) error
+	AddSession(s *Session) error
+	Sessions(accountID uint64, now int64) ([]*Session, error)
+}
+
+// Voice brokers voice rooms of parties and matches: it checks that a
+// player belongs to the party or match behind a room and is not banned
+// before the Provider signs a token.
+type Voice struct {
+	Provider Provider
+	Store    Store
+	Rooms    map[string]MembersFunc
+	Logger   a5glogs.Logger
+	TTL      time.Duration
+
+	now func() time.Time
+}
+
+func NewVoice(p Provider, s Store, rooms map[string]MembersFunc,
+	l a5glogs.Logger) (*Voice, error) {
+	if p == nil {
+		return nil, errors.New("voice provider missing")
+	}
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	for kind, fn := range rooms {
+		if kind == "" {
+			return nil, errors.New("empty voice room kind")
+		}
+		if fn == nil {
+			return nil, errors.Errorf("voice room kind %q: members func missing", kind)
+		}
+	}
+	return &Voice{
+		Provider: p,
+		Store:    s,
+		Rooms:    rooms,
+		Logger:   l,
+		TTL:      time.Hour,
+		now:      time.Now}, nil
+}
+
+// Room is the provider room of a party or match.
+func Room(kind, id string) string { return kind + ":" + id }
+
+// Join signs a token of the room of a party or match for a member.
+func (v *Voice) Join(
+	ctx context.Context, accountID uint64, kind, id string) (*Grant, error) {
+	fn, ok := v.Rooms[kind]
+	if !ok {
+		return nil, errors.Wrap(ErrRoomUnknown, kind)
+	}
+	members, err := fn(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if members == nil {
+		return nil, errors.Wrap(ErrRoomUnknown, Room(kind, id))
+	}
+	if !contains(members, accountID) {
+		return nil, ErrNotMember
+	}
+	now := v.now()
+	s, err := v.Store.Sanction(accountID, now.Unix())
+	if err != nil {
+		return nil, err
+	}
+	if s != nil && s.Kind == SanctionBan {
+		return nil, errors.Wrapf(ErrBanned, "until %d", s.Until)
+	}
+	g := &Grant{
+		Room:       Room(kind, id),
+		ListenOnly: s != nil && s.Kind == SanctionMute,
+		ExpiresAt:  now.Add(v.TTL).Unix()}
+	if g.Token, err = v.Provider.Token(
+		ctx, g.Room, accountID, g.ListenOnly, v.TTL); err != nil {
+		return nil, err
+	}
+	err = v.Store.AddSession(
+		&Session{Room: g.Room, AccountID: accountID, ExpiresAt: g.ExpiresAt})
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Sanction mutes or bans a player for d and applies it to the rooms they
+// are in: muted players are muted there, banned ones kicked. Provider
+// failures are logged, the sanction holds for the next Join anyway.
+func (v *Voice) Sanction(
+	ctx context.Context, accountID uint64, kind string, d time.Duration) error {
+	if (kind != SanctionMute && kind != SanctionBan) || d <= 0 {
+		return errors.Wrapf(ErrSanctionInvalid, "%s for %s", kind, d)
+	}
+	now := v.now()
+	err := v.Store.SetSanction(
+		&Sanction{AccountID: accountID, Kind: kind, Until: now.Add(d).Unix()})
+	if err != nil {
+		return err
+	}
+	return v.propagate(ctx, accountID, now, func(room string) error {
+		if kind == SanctionBan {
+			return v.Provider.Kick(ctx, room, accountID)
+		}
+		return v.Provider.Mute(ctx, room, accountID, true)
+	})
+}
+
+// Lift ends a sanction early, unmuting the player in their rooms.
+func (v *Voice) Lift(ctx context.Context, accountID uint64) error {
+	if err := v.Store.ClearSanction(accountID); err != nil {
+		return err
+	}
+	return v.propagate(ctx, accountID, v.now(), func(room string) error {
+		return v.Provider.Mute(ctx, room, accountID, false)
+	})
+}
+
+func (v *Voice) propagate(ctx context.Context, accountID uint64, now time.Time,
+	fn func(room string) error) error {
+	sessions, err := v.Store.Sessions(accountID, now.Unix())
+	if err != nil {
+		return err
+	}
+	for _, s := range sessions {
+		if err = fn(s.Room); err != nil {
+			v.Logger.With(a5gfields.String("voiceRoom", s.Room)).Error(err.Error())
+		}
+	}
+	return nil
+}
+
+func contains(a []uint64, id uint64) bool {
+	for _, x := range a {
+		if x == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package a5gvoice
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+type fakeProvider struct {
+	calls []string
+}
+
+func (p *fakeProvider) Token(ctx context.Context, room string, accountID uint64,
+	listenOnly bool, ttl time.Duration) (string, error) {
+	return fmt.Sprintf("%s/%d/%t", room, accountID, listenOnly), nil
+}
+
+func (p *fakeProvider) Mute(
+	ctx context.Context, room string, accountID uint64, muted bool) error {
+	p.calls = append(p.calls, fmt.Sprintf("mute %s %d %t", room, accountID, muted))
+	return nil
+}
+
+func (p *fakeProvider) Kick(ctx context.Context, room string, accountID uint64) error {
+	p.calls = append(p.calls, fmt.Sprintf("kick %s %d", room, accountID))
+	return nil
+}
+
+func TestVoice(t *testing.T) {
+	p := new(fakeProvider)
+	v, err := NewVoice(p, NewMemoryStore(), map[string]MembersFunc{
+		KindParty: func(ctx context.Context, id string) ([]uint64, error) {
+			if id != "p1" {
+				return nil, nil
+			}
+			return []uint64{1, 2}, nil
+		}}, a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1600000000, 0)
+	v.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		accountID uint64
+		kind, id  string
+		err       error
+	}{
+		{"unknown kind", 1, KindMatch, "m1", ErrRoomUnknown},
+		{"gone party", 1, KindParty, "p2", ErrRoomUnknown},
+		{"not member", 3, KindParty, "p1", ErrNotMember},
+		{"member", 1, KindParty, "p1", nil},
+	}
+	for _, test := range tests {
+		_, err := v.Join(ctx, test.accountID, test.kind, test.id)
+		if errors.Cause(err) != test.err {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+	}
+
+	if err = v.Sanction(ctx, 1, "shout", time.Hour); errors.Cause(err) != ErrSanctionInvalid {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err = v.Sanction(ctx, 1, SanctionMute, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	g, err := v.Join(ctx, 1, KindParty, "p1")
+	if err != nil || !g.ListenOnly || g.Token != "party:p1/1/true" {
+		t.Errorf("unexpected grant %+v %v", g, err)
+	}
+	if err = v.Sanction(ctx, 1, SanctionBan, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = v.Join(ctx, 1, KindParty, "p1"); errors.Cause(err) != ErrBanned {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err = v.Lift(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"mute party:p1 1 true", "kick party:p1 1", "mute party:p1 1 false"}
+	if fmt.Sprint(p.calls) != fmt.Sprint(want) {
+		t.Errorf("unexpected provider calls %q", p.calls)
+	}
+
+	// Sanctions expire, so do sessions.
+	if err = v.Sanction(ctx, 2, SanctionBan, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(2 * time.Hour)
+	if g, err = v.Join(ctx, 2, KindParty, "p1"); err != nil || g.ListenOnly {
+		t.Errorf("unexpected grant %+v %v", g, err)
+	}
+	p.calls = nil
+	if err = v.Sanction(ctx, 1, SanctionMute, time.Hour); err != nil || len(p.calls) != 0 {
+		t.Errorf("expired session sanctioned %q %v", p.calls, err)
+	}
+}
@@ -0,0 +1,107 @@
+package a5gwallet
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5gsession"
+	"github.com/armor5games/a5g/a5gvalidate"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCodeInsufficientFunds = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4095,
+		Name:     "wallet_insufficient_funds",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "not enough currency"})
+
+	ErrCodeBalanceCapExceeded = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4096,
+		Name:     "wallet_balance_cap_exceeded",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "currency balance is full"})
+
+	ErrCodeTxConflict = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4097,
+		Name:     "wallet_tx_conflict",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "transaction id already used"})
+)
+
+func init() {
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeInsufficientFunds, http.StatusConflict)
+	a5ghttp.DefaultStatusMapper.SetCode(
+		ErrCodeBalanceCapExceeded, http.StatusConflict)
+	a5ghttp.DefaultStatusMapper.SetCode(ErrCodeTxConflict, http.StatusConflict)
+}
+
+type BalancesResponse struct {
+	Balances []*Balance `json:"balances"`
+}
+
+type LedgerRequest struct {
+	Limit int `json:"limit" validate:"min=1,max=100"`
+}
+
+type LedgerResponse struct {
+	Entries []*Entry `json:"entries"`
+}
+
+// BalancesHandler answers with the balances of the a5gsession
+// authenticated player. Game handlers change balances through Apply and
+// answer with its Result.
+func (w *Wallet) BalancesHandler() a5ghttp.HandlerFunc {
+	return func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		s, ok := a5gsession.FromContext(ctx)
+		if !ok {
+			return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+		}
+		balances, err := w.Balances(s.AccountID)
+		if err != nil {
+			return nil, w.APIErrs(err)
+		}
+		return &BalancesResponse{Balances: balances}, nil
+	}
+}
+
+// LedgerHandler answers with the latest ledger entries of the a5gsession
+// authenticated player, newest first.
+func (w *Wallet) LedgerHandler() a5ghttp.HandlerFunc {
+	return a5gvalidate.Handler(
+		func() interface{} { return &LedgerRequest{Limit: 20} },
+		func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+			interface{}, []*a5gapi.APIErr) {
+			s, ok := a5gsession.FromContext(ctx)
+			if !ok {
+				return nil, []*a5gapi.APIErr{a5gsession.APIErr(nil)}
+			}
+			p := req.Payload.(*LedgerRequest)
+			entries, err := w.Store.Ledger(PlayerAccount(s.AccountID), p.Limit)
+			if err != nil {
+				return nil, w.APIErrs(err)
+			}
+			return &LedgerResponse{Entries: entries}, nil
+		})
+}
+
+// APIErrs converts an Apply error, the currency is named in the message.
+func (w *Wallet) APIErrs(err error) []*a5gapi.APIErr {
+	switch errors.Cause(err) {
+	case ErrInsufficientFunds:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeInsufficientFunds, "%s", err)}
+	case ErrBalanceCapExceeded:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeBalanceCapExceeded, "%s", err)}
+	case ErrTxConflict:
+		return []*a5gapi.APIErr{a5gapi.NewErr(ErrCodeTxConflict, "")}
+	}
+	w.Logger.Error(err.Error())
+	return a5gapi.NewJSONMsgDefautlErrors(err)
+}
@@ -0,0 +1,285 @@
+package a5gwallet
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/go-sql-driver/mysql"
+	"github.com/gocraft/dbr"
+	"github.com/pkg/errors"
+)
+
+type memoryStore struct {
+	mu       sync.Mutex
+	balances map[uint64]map[string]int64
+	ledger   []*Entry
+	txs      map[string]string
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{
+		balances: make(map[uint64]map[string]int64),
+		txs:      make(map[string]string)}
+}
+
+func (s *memoryStore) Balances(accountID uint64) ([]*Balance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := make([]*Balance, 0, len(s.balances[accountID]))
+	for c, n := range s.balances[accountID] {
+		a = append(a, &Balance{Currency: c, Balance: n})
+	}
+	sort.Slice(a, func(i, j int) bool { return a[i].Currency < a[j].Currency })
+	return a, nil
+}
+
+func (s *memoryStore) Apply(
+	accountID uint64, t *Tx, c *Currencies) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if account, ok := s.txs[t.ID]; ok {
+		var deltas []*Delta
+		if account == PlayerAccount(accountID) {
+			for _, e := range s.ledger {
+				if e.TxID == t.ID && e.Account == account {
+					deltas = append(deltas, e.delta())
+				}
+			}
+		}
+		return t.Replay(deltas)
+	}
+	m := s.balances[accountID]
+	deltas, err := c.Resolve(m, t.Changes)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		m = make(map[string]int64)
+		s.balances[accountID] = m
+	}
+	for _, d := range deltas {
+		m[d.Currency] = d.Balance
+	}
+	s.ledger = append(s.ledger, newEntries(accountID, t, deltas)...)
+	s.txs[t.ID] = PlayerAccount(accountID)
+	return &Result{TxID: t.ID, Changes: deltas}, nil
+}
+
+func (s *memoryStore) Ledger(account string, limit int) ([]*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var a []*Entry
+	for i := len(s.ledger) - 1; i >= 0 && (limit <= 0 || len(a) < limit); i-- {
+		if s.ledger[i].Account == account {
+			x := *s.ledger[i]
+			a = append(a, &x)
+		}
+	}
+	return a, nil
+}
+
+// newEntries books every delta on the player and the counterparty
+// accounts.
+func newEntries(accountID uint64, t *Tx, deltas []*Delta) []*Entry {
+	a := make([]*Entry, 0, 2*len(deltas))
+	for _, d := range deltas {
+		a = append(a, &Entry{
+			TxID:      t.ID,
+			Account:   PlayerAccount(accountID),
+			Currency:  d.Currency,
+			Amount:    d.Amount,
+			Balance:   d.Balance,
+			Reason:    t.Reason,
+			CreatedAt: t.At}, &Entry{
+			TxID:      t.ID,
+			Account:   t.Counterparty,
+			Currency:  d.Currency,
+			Amount:    -d.Amount,
+			Reason:    t.Reason,
+			CreatedAt: t.At})
+	}
+	return a
+}
+
+func (e *Entry) delta() *Delta {
+	return &Delta{Currency: e.Currency, Amount: e.Amount, Balance: e.Balance}
+}
+
+// dbStore keeps balances and the ledger in MySQL tables:
+//
+//	CREATE TABLE wallet_balances (
+//	  account_id BIGINT UNSIGNED NOT NULL,
+//	  currency VARCHAR(32) NOT NULL,
+//	  balance BIGINT NOT NULL,
+//	  PRIMARY KEY (account_id, currency));
+//
+//	CREATE TABLE wallet_ledger (
+//	  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+//	  tx_id VARCHAR(128) NOT NULL,
+//	  account VARCHAR(64) NOT NULL,
+//	  currency VARCHAR(32) NOT NULL,
+//	  amount BIGINT NOT NULL,
+//	  balance BIGINT NOT NULL,
+//	  reason VARCHAR(64) NOT NULL,
+//	  created_at DATETIME NOT NULL,
+//	  UNIQUE KEY tx_id (tx_id, account, currency),
+//	  KEY account (account, id));
+type dbStore struct {
+	pooler            a5gdb.Pooler
+	balancesTableName string
+	ledgerTableName   string
+}
+
+type dbBalance struct {
+	Currency string `db:"currency"`
+	Balance  int64  `db:"balance"`
+}
+
+type dbEntry struct {
+	TxID      string    `db:"tx_id"`
+	Account   string    `db:"account"`
+	Currency  string    `db:"currency"`
+	Amount    int64     `db:"amount"`
+	Balance   int64     `db:"balance"`
+	Reason    string    `db:"reason"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+var entryColumns = []string{
+	"tx_id", "account", "currency", "amount",
+	"balance", "reason", "created_at"}
+
+func NewDBStore(
+	p a5gdb.Pooler, balancesTableName, ledgerTableName string) (Store, error) {
+	if p == nil {
+		return nil, errors.New("db pooler missing")
+	}
+	if balancesTableName == "" {
+		return nil, errors.New("empty wallet balances table name")
+	}
+	if ledgerTableName == "" {
+		return nil, errors.New("empty wallet ledger table name")
+	}
+	return &dbStore{
+		pooler:            p,
+		balancesTableName: balancesTableName,
+		ledgerTableName:   ledgerTableName}, nil
+}
+
+func (s *dbStore) Balances(accountID uint64) ([]*Balance, error) {
+	var a []*dbBalance
+	_, err := s.pooler.ReadPool().NewSession().
+		Select("currency", "balance").From(s.balancesTableName).
+		Where(dbr.Eq("account_id", accountID)).
+		OrderAsc("currency").Load(&a)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	balances := make([]*Balance, len(a))
+	for i, x := range a {
+		balances[i] = &Balance{Currency: x.Currency, Balance: x.Balance}
+	}
+	return balances, nil
+}
+
+// Apply locks the changed balances of the player, so concurrent
+// transactions of the same player are serialized and see the ledger rows
+// of each other; a transaction id reused for another player fails on the
+// ledger unique key with ErrTxConflict.
+func (s *dbStore) Apply(
+	accountID uint64, t *Tx, c *Currencies) (*Result, error) {
+	currencies := make([]string, len(t.Changes))
+	for i, x := range t.Changes {
+		currencies[i] = x.Currency
+	}
+	tx, err := s.pooler.WritePool().NewSession().Begin()
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*Session).Begin fn")
+	}
+	defer tx.RollbackUnlessCommitted()
+	var a []*dbBalance
+	_, err = tx.Select("currency", "balance").From(s.balancesTableName).
+		Where(dbr.Eq("account_id", accountID)).
+		Where(dbr.Eq("currency", currencies)).
+		Suffix("FOR UPDATE").Load(&a)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	var booked []*dbEntry
+	_, err = tx.Select(entryColumns...).From(s.ledgerTableName).
+		Where(dbr.Eq("tx_id", t.ID)).Load(&booked)
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	if len(booked) > 0 {
+		var deltas []*Delta
+		for _, x := range booked {
+			if x.Account == PlayerAccount(accountID) {
+				deltas = append(deltas, &Delta{
+					Currency: x.Currency, Amount: x.Amount, Balance: x.Balance})
+			}
+		}
+		return t.Replay(deltas)
+	}
+	m := make(map[string]int64, len(a))
+	for _, x := range a {
+		m[x.Currency] = x.Balance
+	}
+	deltas, err := c.Resolve(m, t.Changes)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range deltas {
+		_, err = tx.InsertBySql("INSERT INTO "+s.balancesTableName+
+			" (account_id, currency, balance) VALUES (?, ?, ?)"+
+			" ON DUPLICATE KEY UPDATE balance = VALUES(balance)",
+			accountID, d.Currency, d.Balance).Exec()
+		if err != nil {
+			return nil, errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+		}
+	}
+	stmt := tx.InsertInto(s.ledgerTableName).Columns(entryColumns...)
+	for _, e := range newEntries(accountID, t, deltas) {
+		x := dbEntry(*e)
+		stmt.Record(&x)
+	}
+	if _, err = stmt.Exec(); duplicateEntry(err) {
+		return nil, errors.Wrap(ErrTxConflict, t.ID)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "dbr.(*InsertStmt).Exec fn")
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "dbr.(*Tx).Commit fn")
+	}
+	return &Result{TxID: t.ID, Changes: deltas}, nil
+}
+
+// mysqlDupEntry is ER_DUP_ENTRY, a unique key violation.
+const mysqlDupEntry = 1062
+
+func duplicateEntry(err error) bool {
+	e, ok := errors.Cause(err).(*mysql.MySQLError)
+	return ok && e.Number == mysqlDupEntry
+}
+
+func (s *dbStore) Ledger(account string, limit int) ([]*Entry, error) {
+	stmt := s.pooler.ReadPool().NewSession().
+		Select(entryColumns...).From(s.ledgerTableName).
+		Where(dbr.Eq("account", account)).OrderDesc("id")
+	if limit > 0 {
+		stmt.Limit(uint64(limit))
+	}
+	var a []*dbEntry
+	if _, err := stmt.Load(&a); err != nil {
+		return nil, errors.Wrap(err, "dbr.(*SelectStmt).Load fn")
+	}
+	l := make([]*Entry, len(a))
+	for i, x := range a {
+		e := Entry(*x)
+		l[i] = &e
+	}
+	return l, nil
+}
@@ -0,0 +1,108 @@
+package a5gwallet
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/go-sql-driver/mysql"
+	"github.com/gocraft/dbr"
+	"github.com/gocraft/dbr/dialect"
+	"github.com/pkg/errors"
+)
+
+// testDriver answers selects with no rows and fails statements that
+// contain a key of errs.
+type testDriver struct{ errs map[string]error }
+
+var testDB = &testDriver{}
+
+func init() { sql.Register("a5gwallet_test", testDB) }
+
+func (d *testDriver) Open(string) (driver.Conn, error) { return &testConn{d}, nil }
+
+type testConn struct{ d *testDriver }
+
+func (c *testConn) Prepare(q string) (driver.Stmt, error) { return &testStmt{c.d, q}, nil }
+func (c *testConn) Close() error                          { return nil }
+func (c *testConn) Begin() (driver.Tx, error)             { return c, nil }
+func (c *testConn) Commit() error                         { return nil }
+func (c *testConn) Rollback() error                       { return nil }
+
+type testStmt struct {
+	d *testDriver
+	q string
+}
+
+func (s *testStmt) Close() error  { return nil }
+func (s *testStmt) NumInput() int { return -1 }
+
+func (s *testStmt) Exec([]driver.Value) (driver.Result, error) {
+	for k, err := range s.d.errs {
+		if strings.Contains(s.q, k) {
+			return nil, err
+		}
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *testStmt) Query([]driver.Value) (driver.Rows, error) { return testRows{}, nil }
+
+type testRows struct{}
+
+func (testRows) Columns() []string         { return nil }
+func (testRows) Close() error              { return nil }
+func (testRows) Next([]driver.Value) error { return io.EOF }
+
+type testPooler struct{ *dbr.Connection }
+
+func (p testPooler) NewSession() *dbr.Session   { return p.Connection.NewSession(nil) }
+func (p testPooler) ReadPool() a5gdb.Connector  { return p }
+func (p testPooler) WritePool() a5gdb.Connector { return p }
+func (p testPooler) Validate() error            { return nil }
+
+func TestDBStoreApplyDuplicate(t *testing.T) {
+	d := testDB
+	d.errs = map[string]error{}
+	db, err := sql.Open("a5gwallet_test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewDBStore(testPooler{&dbr.Connection{
+		DB: db, Dialect: dialect.MySQL, EventReceiver: &dbr.NullEventReceiver{}}},
+		"wallet_balances", "wallet_ledger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewCurrencies(Currency{ID: "hard"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := NewTx("t1", "iap", "purchase").Credit("hard", 50)
+	tx.Changes = tx.merged()
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"booked", nil, nil},
+		{"duplicate", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"},
+			ErrTxConflict},
+		{"other", &mysql.MySQLError{Number: 1213, Message: "Deadlock found"}, nil},
+	}
+	for _, x := range tests {
+		d.errs["wallet_ledger"] = x.err
+		_, err := s.Apply(1, tx, c)
+		switch {
+		case x.err == nil && err != nil:
+			t.Errorf("%s: %v", x.name, err)
+		case x.want != nil && errors.Cause(err) != x.want:
+			t.Errorf("%s: %v want %v", x.name, err, x.want)
+		case x.err != nil && x.want == nil && errors.Cause(err) != x.err:
+			t.Errorf("%s: %v want %v", x.name, err, x.err)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package a5gwallet
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCurrencyUnknown    = errors.New("wallet currency unknown")
+	ErrInsufficientFunds  = errors.New("insufficient wallet funds")
+	ErrBalanceCapExceeded = errors.New("wallet balance cap exceeded")
+	// ErrTxConflict is a transaction id reused for other changes.
+	ErrTxConflict = errors.New("wallet transaction id conflict")
+)
+
+// Currency is a wallet currency, e.g. "soft", "hard" or an event one.
+// Debits may not take a balance below Floor; Max caps credits, zero is
+// uncapped.
+type Currency struct {
+	ID    string `json:"id"`
+	Floor int64  `json:"floor,omitempty"`
+	Max   int64  `json:"max,omitempty"`
+}
+
+type Currencies struct {
+	m map[string]Currency
+}
+
+func NewCurrencies(a ...Currency) (*Currencies, error) {
+	c := &Currencies{m: make(map[string]Currency, len(a))}
+	for _, x := range a {
+		if x.ID == "" {
+			return nil, errors.New("empty currency id")
+		}
+		if _, ok := c.m[x.ID]; ok {
+			return nil, errors.Errorf("duplicate currency %q", x.ID)
+		}
+		if x.Max != 0 && x.Max < x.Floor {
+			return nil, errors.Errorf("currency %q max below floor", x.ID)
+		}
+		c.m[x.ID] = x
+	}
+	return c, nil
+}
+
+func (c *Currencies) Currency(id string) (Currency, bool) {
+	x, ok := c.m[id]
+	return x, ok
+}
+
+// Resolve computes deltas of changes against the current balances of the
+// changed currencies, failing the whole transaction when a balance would
+// go below its Floor or above its Max. It is meant for Store
+// implementations.
+func (c *Currencies) Resolve(
+	balances map[string]int64, changes []Change) ([]*Delta, error) {
+	deltas := make([]*Delta, 0, len(changes))
+	for _, x := range changes {
+		cur, ok := c.m[x.Currency]
+		if !ok {
+			return nil, errors.Wrap(ErrCurrencyUnknown, x.Currency)
+		}
+		n := balances[x.Currency] + x.Amount
+		if x.Amount < 0 && n < cur.Floor {
+			return nil, errors.Wrap(ErrInsufficientFunds, x.Currency)
+		}
+		if x.Amount > 0 && cur.Max != 0 && n > cur.Max {
+			return nil, errors.Wrap(ErrBalanceCapExceeded, x.Currency)
+		}
+		deltas = append(deltas, &Delta{
+			Currency: x.Currency, Amount: x.Amount, Balance: n})
+	}
+	return deltas, nil
+}
+
+// Change credits (positive Amount) or debits (negative Amount) a currency.
+type Change struct {
+	Currency string
+	Amount   int64
+}
+
+// Tx is a set of changes of a player wallet applied all at once or not at
+// all. Every change is booked twice: on the player account and, with the
+// opposite sign, on the Counterparty account, e.g. "shop" or "rewards".
+// ID makes the transaction idempotent: applying it again returns the
+// original result.
+type Tx struct {
+	ID           string
+	Counterparty string
+	Reason       string
+	Changes      []Change
+	At           time.Time
+}
+
+func NewTx(id, counterparty, reason string) *Tx {
+	return &Tx{ID: id, Counterparty: counterparty, Reason: reason}
+}
+
+func (t *Tx) Credit(currency string, amount int64) *Tx {
+	t.Changes = append(t.Changes, Change{Currency: currency, Amount: amount})
+	return t
+}
+
+func (t *Tx) Debit(currency string, amount int64) *Tx {
+	t.Changes = append(t.Changes, Change{Currency: currency, Amount: -amount})
+	return t
+}
+
+// merged sums changes of the same currency, sorted by currency so stores
+// lock rows in the same order.
+func (t *Tx) merged() []Change {
+	m := make(map[string]int64, len(t.Changes))
+	for _, x := range t.Changes {
+		m[x.Currency] += x.Amount
+	}
+	a := make([]Change, 0, len(m))
+	for id, n := range m {
+		if n != 0 {
+			a = append(a, Change{Currency: id, Amount: n})
+		}
+	}
+	sort.Slice(a, func(i, j int) bool { return a[i].Currency < a[j].Currency })
+	return a
+}
+
+// Replay checks the player deltas of a transaction already booked under
+// the id of t, returning ErrTxConflict for other changes. It is meant for
+// Store implementations.
+func (t *Tx) Replay(deltas []*Delta) (*Result, error) {
+	if len(deltas) != len(t.Changes) {
+		return nil, errors.Wrap(ErrTxConflict, t.ID)
+	}
+	sort.Slice(deltas, func(i, j int) bool {
+		return deltas[i].Currency < deltas[j].Currency
+	})
+	for i, x := range t.Changes {
+		if deltas[i].Currency != x.Currency || deltas[i].Amount != x.Amount {
+			return nil, errors.Wrap(ErrTxConflict, t.ID)
+		}
+	}
+	return &Result{TxID: t.ID, Changes: deltas, Replayed: true}, nil
+}
+
+type Balance struct {
+	Currency string `json:"currency"`
+	Balance  int64  `json:"balance"`
+}
+
+// Delta is a change of a balance, Balance is the resulting one.
+type Delta struct {
+	Currency string `json:"currency"`
+	Amount   int64  `json:"amount"`
+	Balance  int64  `json:"balance"`
+}
+
+// Result is the standard payload of handlers changing wallets, the client
+// applies Changes to its copy of the balances.
+type Result struct {
+	TxID     string   `json:"txId"`
+	Changes  []*Delta `json:"changes"`
+	Replayed bool     `json:"replayed,omitempty"`
+}
+
+// Entry is a ledger record, one of the two a change is booked as. Balance
+// is kept for player accounts only.
+type Entry struct {
+	TxID      string    `json:"txId"`
+	Account   string    `json:"account"`
+	Currency  string    `json:"currency"`
+	Amount    int64     `json:"amount"`
+	Balance   int64     `json:"balance"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// PlayerAccount is the ledger account of a player wallet.
+func PlayerAccount(accountID uint64) string {
+	return "player:" + strconv.FormatUint(accountID, 10)
+}
+
+// Store keeps balances and the ledger. Apply gets a transaction with
+// merged changes of known currencies and books it atomically, or replays
+// the one already booked under its ID.
+type Store interface {
+	Balances(accountID uint64) ([]*Balance, error)
+	Apply(accountID uint64, t *Tx, c *Currencies) (*Result, error)
+	Ledger(account string, limit int) ([]*Entry, error)
+}
+
+// Wallet is the Go API other subsystems (shop, rewards) change player
+// balances through.
+type Wallet struct {
+	Store      Store
+	Currencies *Currencies
+	Logger     a5glogs.Logger
+
+	now func() time.Time
+}
+
+func NewWallet(s Store, c *Currencies, l a5glogs.Logger) (*Wallet, error) {
+	if s == nil {
+		return nil, errors.New("store missing")
+	}
+	if c == nil {
+		return nil, errors.New("currencies missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Wallet{Store: s, Currencies: c, Logger: l, now: time.Now}, nil
+}
+
+func (w *Wallet) Apply(accountID uint64, t *Tx) (*Result, error) {
+	if t == nil {
+		return nil, errors.New("nil wallet transaction")
+	}
+	if t.ID == "" {
+		return nil, errors.New("empty wallet transaction id")
+	}
+	if t.Counterparty == "" {
+		return nil, errors.New("empty wallet transaction counterparty")
+	}
+	x := *t
+	x.Changes = t.merged()
+	if len(x.Changes) == 0 {
+		return nil, errors.New("empty wallet transaction")
+	}
+	for _, c := range x.Changes {
+		if _, ok := w.Currencies.Currency(c.Currency); !ok {
+			return nil, errors.Wrap(ErrCurrencyUnknown, c.Currency)
+		}
+	}
+	if x.At.IsZero() {
+		x.At = w.now().UTC()
+	}
+	return w.Store.Apply(accountID, &x, w.Currencies)
+}
+
+func (w *Wallet) Credit(
+	accountID uint64, txID, counterparty, reason, currency string,
+	amount int64) (*Result, error) {
+	if amount <= 0 {
+		return nil, errors.Errorf("non-positive credit amount %d", amount)
+	}
+	return w.Apply(accountID,
+		NewTx(txID, counterparty, reason).Credit(currency, amount))
+}
+
+func (w *Wallet) Debit(
+	accountID uint64, txID, counterparty, reason, currency string,
+	amount int64) (*Result, error) {
+	if amount <= 0 {
+		return nil, errors.Errorf("non-positive debit amount %d", amount)
+	}
+	return w.Apply(accountID,
+		NewTx(txID, counterparty, reason).Debit(currency, amount))
+}
+
+func (w *Wallet) Balances(accountID uint64) ([]*Balance, error) {
+	return w.Store.Balances(accountID)
+}
@@ -0,0 +1,86 @@
+package a5gwallet
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestWalletApply(t *testing.T) {
+	c, err := NewCurrencies(
+		Currency{ID: "soft", Max: 1000}, Currency{ID: "hard"},
+		Currency{ID: "event", Floor: -10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWallet(
+		NewMemoryStore(), c, a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		tx       *Tx
+		err      error
+		expected []Delta
+		replayed bool
+	}{
+		{"credit", NewTx("t1", "iap", "purchase").Credit("hard", 50), nil,
+			[]Delta{{"hard", 50, 50}}, false},
+		{"replay", NewTx("t1", "iap", "purchase").Credit("hard", 50), nil,
+			[]Delta{{"hard", 50, 50}}, true},
+		{"conflict", NewTx("t1", "iap", "purchase").Credit("hard", 70),
+			ErrTxConflict, nil, false},
+		{"exchange", NewTx("t2", "exchange", "exchange").
+			Debit("hard", 10).Credit("soft", 900), nil,
+			[]Delta{{"hard", -10, 40}, {"soft", 900, 900}}, false},
+		{"cap", NewTx("t3", "rewards", "quest").Credit("soft", 101),
+			ErrBalanceCapExceeded, nil, false},
+		{"all or nothing", NewTx("t4", "shop", "buy").
+			Debit("soft", 100).Debit("hard", 41), ErrInsufficientFunds, nil, false},
+		{"floor", NewTx("t5", "shop", "buy").Debit("event", 10), nil,
+			[]Delta{{"event", -10, -10}}, false},
+		{"below floor", NewTx("t6", "shop", "buy").Debit("event", 1),
+			ErrInsufficientFunds, nil, false},
+	}
+	for _, test := range tests {
+		res, err := w.Apply(1, test.tx)
+		if errors.Cause(err) != test.err {
+			t.Fatalf("%s: unexpected error %v", test.name, err)
+		}
+		var deltas []Delta
+		if res != nil {
+			for _, d := range res.Changes {
+				deltas = append(deltas, *d)
+			}
+			if res.Replayed != test.replayed {
+				t.Errorf("%s: expected replayed %v", test.name, test.replayed)
+			}
+		}
+		if !reflect.DeepEqual(deltas, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, deltas)
+		}
+	}
+	if _, err = w.Credit(2, "t1", "iap", "purchase", "hard", 50); errors.Cause(
+		err) != ErrTxConflict {
+		t.Errorf("expected conflict of another player, got %v", err)
+	}
+	var sum int64
+	for _, account := range []string{PlayerAccount(1), "iap", "exchange"} {
+		l, err := w.Store.Ledger(account, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range l {
+			if e.Currency == "hard" {
+				sum += e.Amount
+			}
+		}
+	}
+	if sum != 0 {
+		t.Errorf("unbalanced ledger %d", sum)
+	}
+}
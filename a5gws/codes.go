@@ -0,0 +1,19 @@
+package a5gws
+
+import "github.com/armor5games/a5g/a5gapi"
+
+var (
+	ErrCodeMethodUnknown = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4040,
+		Name:     "websocket_method_unknown",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "unknown method"})
+
+	ErrCodeTooManyRequests = a5gapi.MustRegisterErrCode(a5gapi.ErrCodeDefinition{
+		Code:     4292,
+		Name:     "websocket_too_many_requests",
+		Severity: a5gapi.ErrSeverityWarn,
+		Public:   true,
+		Message:  "too many requests in flight"})
+)
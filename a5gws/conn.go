@@ -0,0 +1,251 @@
+package a5gws
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+)
+
+var ErrConnClosed = errors.New("websocket connection closed")
+
+// Conn is an upgraded client connection. Its context is derived from the
+// upgrade request, so values put by HTTP middlewares (sessions, request
+// ids) are visible to frame handlers.
+type Conn struct {
+	server *Server
+	ws     *websocket.Conn
+	ctx    context.Context
+	cancel context.CancelFunc
+	send   chan []byte
+	// inFlight holds a token per running handler.
+	inFlight chan struct{}
+
+	closeOnce sync.Once
+	handlers  sync.WaitGroup
+}
+
+func newConn(s *Server, ws *websocket.Conn, r *http.Request) *Conn {
+	ctx, cancel := context.WithCancel(r.Context())
+	n := s.MaxInFlight
+	if n < 1 {
+		n = 1
+	}
+	return &Conn{
+		server:   s,
+		ws:       ws,
+		ctx:      ctx,
+		cancel:   cancel,
+		send:     make(chan []byte, 64),
+		inFlight: make(chan struct{}, n)}
+}
+
+func (c *Conn) Context() context.Context { return c.ctx }
+
+// Push sends a server initiated event. It fails instead of blocking when
+// the client does not keep up.
+func (c *Conn) Push(event string, payload interface{}) error {
+	res, err := c.server.Responder.NewResponse(c.ctx, true, payload, nil)
+	if err != nil {
+		return err
+	}
+	return c.write(&Frame{Push: event, Response: res})
+}
+
+func (c *Conn) Close() error {
+	c.closeWith(websocket.CloseNormalClosure, "")
+	return nil
+}
+
+func (c *Conn) write(f *Frame) error {
+	b, err := json.Marshal(f)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	select {
+	case <-c.ctx.Done():
+		return errors.WithStack(ErrConnClosed)
+	default:
+	}
+	select {
+	case c.send <- b:
+		return nil
+	case <-c.ctx.Done():
+		return errors.WithStack(ErrConnClosed)
+	default:
+		return errors.New("websocket send buffer is full")
+	}
+}
+
+func (c *Conn) closeWith(code int, text string) {
+	c.closeOnce.Do(func() {
+		deadline := time.Now().Add(c.server.WriteWait)
+		msg := websocket.FormatCloseMessage(code, text)
+		if err := c.ws.WriteControl(websocket.CloseMessage, msg, deadline); err != nil &&
+			err != websocket.ErrCloseSent {
+			c.server.Logger.Debug(err.Error())
+		}
+		c.cancel()
+		if err := c.ws.Close(); err != nil {
+			c.server.Logger.Debug(err.Error())
+		}
+	})
+}
+
+func (c *Conn) readPump() {
+	defer func() {
+		c.handlers.Wait()
+		c.closeWith(websocket.CloseNormalClosure, "")
+	}()
+	s := c.server
+	c.ws.SetReadLimit(s.MaxFrameSize)
+	if err := c.ws.SetReadDeadline(time.Now().Add(s.PongWait)); err != nil {
+		s.Logger.Debug(err.Error())
+		return
+	}
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(time.Now().Add(s.PongWait))
+	})
+	for {
+		_, b, err := c.ws.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err,
+				websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				s.Logger.Warn(err.Error())
+			}
+			return
+		}
+		f, err := decodeFrame(b)
+		if err != nil || f.ID == "" || f.Method == "" {
+			if err := c.write(c.errFrame(f, a5gapi.NewErr(
+				a5ghttp.ErrCodeRequestMalformed, ""))); err != nil {
+				s.Logger.Warn(err.Error())
+			}
+			continue
+		}
+		select {
+		case c.inFlight <- struct{}{}:
+		default:
+			if err := c.write(c.errFrame(f, a5gapi.NewErr(
+				ErrCodeTooManyRequests, "%d", cap(c.inFlight)))); err != nil {
+				s.Logger.Warn(err.Error())
+			}
+			continue
+		}
+		c.handlers.Add(1)
+		go c.dispatch(f)
+	}
+}
+
+func (c *Conn) dispatch(f *Frame) {
+	defer func() {
+		<-c.inFlight
+		c.handlers.Done()
+	}()
+	s := c.server
+	fn, ok := s.handler(f.Method)
+	if !ok {
+		if err := c.write(c.errFrame(f, a5gapi.NewErr(
+			ErrCodeMethodUnknown, "%s", f.Method))); err != nil {
+			s.Logger.Warn(err.Error())
+		}
+		return
+	}
+	// Every frame is its own request: correlate by the client supplied
+	// request id or, failing that, by the frame id.
+	requestID := f.Request.RequestID
+	if requestID == "" {
+		requestID = f.ID
+	}
+	ctx := a5gapi.ContextWithRoute(
+		a5gapi.ContextWithRequestID(c.ctx, requestID), "ws "+f.Method)
+	if s.Versions != nil {
+		x := f.Request.APIVersion
+		if x == 0 {
+			x = a5gapi.APIVersionFromContext(c.ctx)
+		}
+		v, ok := s.Versions.Negotiate(x)
+		if !ok {
+			e := c.errFrame(f, a5gapi.NewErr(
+				a5ghttp.ErrCodeAPIVersionUnsupported, "%d", x))
+			if e.Response != nil {
+				e.Response.RequestID = requestID
+				e.Response.Meta = s.Versions.Meta()
+			}
+			if err := c.write(e); err != nil {
+				s.Logger.Warn(err.Error())
+			}
+			return
+		}
+		ctx = a5gapi.ContextWithAPIVersion(ctx, v)
+	}
+	payload, errs := fn(ctx, f.Request)
+	payload, page := a5gapi.UnwrapPaged(payload)
+	// Errors an HTTP client would get a 4xx for are unsuccessful here too.
+	isSuccess := a5ghttp.MaxSeverity(errs) < a5gapi.ErrSeverityError &&
+		a5ghttp.DefaultStatusMapper.Status(errs) < http.StatusBadRequest
+	if isSuccess {
+		var err error
+		if payload, err = a5gapi.SelectFields(payload, f.Request.Fields); err != nil {
+			errs = append(errs, a5gapi.NewJSONMsgDefautlErrors(err)...)
+			isSuccess = false
+		}
+	}
+	res, err := s.Responder.NewResponse(ctx, isSuccess, payload, nil, errs...)
+	if err != nil {
+		s.Logger.Error(err.Error())
+		return
+	}
+	if isSuccess {
+		res.Page = page
+	}
+	if err = c.write(&Frame{ID: f.ID, Response: res}); err != nil {
+		s.Logger.Warn(err.Error())
+	}
+}
+
+func (c *Conn) errFrame(f *Frame, e *a5gapi.APIErr) *Frame {
+	res, err := a5gapi.NewMsgResponse(0, false, nil, nil, e)
+	if err != nil {
+		c.server.Logger.Error(err.Error())
+	}
+	x := &Frame{Response: res}
+	if f != nil {
+		x.ID = f.ID
+	}
+	return x
+}
+
+func (c *Conn) writePump() {
+	s := c.server
+	t := time.NewTicker(s.PingInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case b := <-c.send:
+			if err := c.ws.SetWriteDeadline(time.Now().Add(s.WriteWait)); err != nil {
+				s.Logger.Debug(err.Error())
+			}
+			if err := c.ws.WriteMessage(websocket.TextMessage, b); err != nil {
+				s.Logger.Debug(err.Error())
+				c.closeWith(websocket.CloseGoingAway, "")
+				return
+			}
+		case <-t.C:
+			deadline := time.Now().Add(s.WriteWait)
+			if err := c.ws.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				s.Logger.Debug(err.Error())
+				c.closeWith(websocket.CloseGoingAway, "")
+				return
+			}
+		}
+	}
+}
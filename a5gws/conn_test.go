@@ -0,0 +1,152 @@
+package a5gws
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+type testConfig struct{}
+
+func (testConfig) DebugLevel() int { return 0 }
+
+func newTestServer(t *testing.T) *Server {
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	r, err := a5gapi.NewResponder(testConfig{}, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServer(r, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// testFrame is a response frame as clients see it.
+type testFrame struct {
+	ID       string `json:"id"`
+	Response struct {
+		APIVersion uint64 `json:"apiVersion"`
+		Success    bool   `json:"success"`
+		Messages   []struct {
+			Code uint64 `json:"code"`
+		} `json:"messages"`
+	} `json:"response"`
+}
+
+func (f *testFrame) code() uint64 {
+	if len(f.Response.Messages) == 0 {
+		return 0
+	}
+	return f.Response.Messages[0].Code
+}
+
+func TestConnFrames(t *testing.T) {
+	s := newTestServer(t)
+	s.MaxInFlight = 2
+	var err error
+	if s.Versions, err = a5ghttp.NewVersions(2, 3, "", s.Logger); err != nil {
+		t.Fatal(err)
+	}
+	release := make(chan struct{})
+	err = s.Handle("block", func(context.Context, *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		<-release
+		return "done", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Handle("echo", func(ctx context.Context, req *a5gapi.APIMsgRequest) (
+		interface{}, []*a5gapi.APIErr) {
+		return "ok", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	ws, _, err := websocket.DefaultDialer.Dial(
+		"ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	read := func() *testFrame {
+		f := new(testFrame)
+		if err := ws.ReadJSON(f); err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	tests := []struct {
+		name    string
+		frame   string
+		id      string
+		code    uint64
+		version uint64
+	}{
+		{"malformed", `{"id":`, "", 4000, 0},
+		{"no method", `{"id":"1"}`, "1", 4000, 0},
+		{"unknown method", `{"id":"2","method":"nope"}`, "2", 4040, 0},
+		{"old version", `{"id":"3","method":"echo","request":{"apiVersion":1}}`,
+			"3", 4260, 0},
+		{"negotiated", `{"id":"4","method":"echo","request":{"apiVersion":3}}`,
+			"4", 0, 3},
+	}
+	for _, test := range tests {
+		if err = ws.WriteMessage(websocket.TextMessage, []byte(test.frame)); err != nil {
+			t.Fatal(err)
+		}
+		f := read()
+		if f.ID != test.id || f.code() != test.code ||
+			f.Response.APIVersion != test.version {
+			t.Errorf("%s: unexpected frame %+v", test.name, f)
+		}
+	}
+
+	// A third request while two handlers run is refused, not queued.
+	for _, id := range []string{"5", "6", "7"} {
+		b, _ := json.Marshal(&Frame{ID: id, Method: "block",
+			Request: &a5gapi.APIMsgRequest{APIVersion: 2}})
+		if err = ws.WriteMessage(websocket.TextMessage, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if f := read(); f.ID != "7" || f.code() != 4292 {
+		t.Errorf("unexpected frame %+v", f)
+	}
+	close(release)
+	for i := 0; i < 2; i++ {
+		if f := read(); !f.Response.Success {
+			t.Errorf("unexpected frame %+v", f)
+		}
+	}
+}
+
+func TestConnPushBufferFull(t *testing.T) {
+	s := newTestServer(t)
+	c := newConn(s, nil, httptest.NewRequest(http.MethodGet, "/", nil))
+	for i := 0; i < cap(c.send); i++ {
+		if err := c.Push("tick", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Push("tick", 0); err == nil {
+		t.Error("expected a full send buffer error")
+	}
+	c.cancel()
+	if err := c.Push("tick", 0); err == nil {
+		t.Error("expected a closed connection error")
+	}
+}
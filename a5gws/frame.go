@@ -0,0 +1,31 @@
+package a5gws
+
+import (
+	"encoding/json"
+
+	"github.com/armor5games/a5g/a5gapi"
+)
+
+// Frame is an WebSocket message carrying the regular a5gapi envelope.
+// Client requests set ID and Method, the response echoes ID. Server pushes
+// set Push (the event name) and no ID.
+type Frame struct {
+	ID       string                 `json:"id,omitempty"`
+	Method   string                 `json:"method,omitempty"`
+	Push     string                 `json:"push,omitempty"`
+	Request  *a5gapi.APIMsgRequest  `json:"request,omitempty"`
+	Response *a5gapi.APIMsgResponse `json:"response,omitempty"`
+}
+
+// decodeFrame keeps request payload raw for a5ghttp.DecodePayload.
+func decodeFrame(b []byte) (*Frame, error) {
+	f := &Frame{Request: &a5gapi.APIMsgRequest{Payload: new(json.RawMessage)}}
+	if err := json.Unmarshal(b, f); err != nil {
+		return nil, err
+	}
+	if f.Request == nil {
+		// Explicit "request": null.
+		f.Request = &a5gapi.APIMsgRequest{Payload: new(json.RawMessage)}
+	}
+	return f, nil
+}
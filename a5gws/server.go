@@ -0,0 +1,168 @@
+package a5gws
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/armor5games/a5g/a5gapi"
+	"github.com/armor5games/a5g/a5ghttp"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+)
+
+var ErrServerClosed = errors.New("websocket server closed")
+
+// Server upgrades HTTP connections and dispatches request frames to
+// handlers by method. Handlers share a5ghttp.HandlerFunc signature, so the
+// same handler can be mounted on both transports.
+type Server struct {
+	Upgrader     websocket.Upgrader
+	Responder    *a5gapi.Responder
+	Logger       a5glogs.Logger
+	PingInterval time.Duration
+	PongWait     time.Duration
+	WriteWait    time.Duration
+	MaxFrameSize int64
+	// MaxInFlight limits handlers running at once per connection, frames
+	// over it are answered with ErrCodeTooManyRequests.
+	MaxInFlight int
+	// Versions, when set, negotiates the envelope version of every frame;
+	// frames without one use the version of the upgrade request.
+	Versions *a5ghttp.Versions
+	// OnConnect is called after upgrade, e.g. to index connections by
+	// account for pushes. OnDisconnect is called once the connection is
+	// gone.
+	OnConnect    func(*Conn)
+	OnDisconnect func(*Conn)
+
+	mu       sync.RWMutex
+	handlers map[string]a5ghttp.HandlerFunc
+	conns    map[*Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+func NewServer(r *a5gapi.Responder, l a5glogs.Logger) (*Server, error) {
+	if r == nil {
+		return nil, errors.New("responder missing")
+	}
+	if l == nil {
+		return nil, errors.New("logger missing")
+	}
+	return &Server{
+		Responder:    r,
+		Logger:       l,
+		PingInterval: 30 * time.Second,
+		PongWait:     60 * time.Second,
+		WriteWait:    10 * time.Second,
+		MaxFrameSize: 1 << 20,
+		MaxInFlight:  8,
+		handlers:     make(map[string]a5ghttp.HandlerFunc),
+		conns:        make(map[*Conn]struct{})}, nil
+}
+
+func (s *Server) Handle(method string, fn a5ghttp.HandlerFunc) error {
+	if method == "" {
+		return errors.New("empty websocket method")
+	}
+	if fn == nil {
+		return errors.New("nil websocket handler")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.handlers[method]; ok {
+		return errors.Errorf("websocket method %q already registered", method)
+	}
+	s.handlers[method] = fn
+	return nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	closed := s.closed
+	s.mu.RUnlock()
+	if closed {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable),
+			http.StatusServiceUnavailable)
+		return
+	}
+	ws, err := s.Upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrader has already answered with an HTTP error.
+		s.Logger.Warn(err.Error())
+		return
+	}
+	c := newConn(s, ws, r)
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		c.closeWith(websocket.CloseGoingAway, "server shutdown")
+		return
+	}
+	s.conns[c] = struct{}{}
+	s.wg.Add(1)
+	s.mu.Unlock()
+	if s.OnConnect != nil {
+		s.OnConnect(c)
+	}
+	go c.writePump()
+	c.readPump()
+	s.mu.Lock()
+	delete(s.conns, c)
+	s.mu.Unlock()
+	if s.OnDisconnect != nil {
+		s.OnDisconnect(c)
+	}
+	s.wg.Done()
+}
+
+// Shutdown stops accepting connections, sends a going-away close frame to
+// every client and waits for connections to finish until ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	conns := make([]*Conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+	for _, c := range conns {
+		c.closeWith(websocket.CloseGoingAway, "server shutdown")
+	}
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
+
+// Broadcast pushes an event to every connected client.
+func (s *Server) Broadcast(event string, payload interface{}) {
+	s.mu.RLock()
+	conns := make([]*Conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.RUnlock()
+	for _, c := range conns {
+		if err := c.Push(event, payload); err != nil {
+			s.Logger.Warn(err.Error())
+		}
+	}
+}
+
+func (s *Server) handler(method string) (a5ghttp.HandlerFunc, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	fn, ok := s.handlers[method]
+	return fn, ok
+}
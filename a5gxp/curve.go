@@ -0,0 +1,138 @@
+package a5gxp
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// Step is an level curve balance table row: total experience required to
+// reach Level and an optional reward id granted on reaching it.
+type Step struct {
+	Level  uint64 `json:"level"`
+	XP     uint64 `json:"xp"`
+	Reward string `json:"reward,omitempty"`
+}
+
+// LevelUp is emitted for every level gained, so a grant spanning several
+// levels produces several events in ascending order.
+type LevelUp struct {
+	Level  uint64 `json:"level"`
+	Reward string `json:"reward,omitempty"`
+}
+
+type Curve struct{ steps []Step }
+
+// NewCurve expects steps for levels 1..N in order, level 1 at zero XP and
+// XP strictly increasing.
+func NewCurve(steps []Step) (*Curve, error) {
+	if len(steps) == 0 {
+		return nil, errors.New("empty level curve")
+	}
+	for i, s := range steps {
+		if s.Level != uint64(i+1) {
+			return nil, errors.Errorf("unexpected level curve level %d", s.Level)
+		}
+		if i == 0 && s.XP != 0 {
+			return nil, errors.New("level curve must start at zero xp")
+		}
+		if i > 0 && s.XP <= steps[i-1].XP {
+			return nil, errors.Errorf("level curve xp is not increasing at level %d",
+				s.Level)
+		}
+	}
+	a := make([]Step, len(steps))
+	copy(a, steps)
+	return &Curve{steps: a}, nil
+}
+
+func NewCurveJSON(b []byte) (*Curve, error) {
+	var steps []Step
+	if err := json.Unmarshal(b, &steps); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return NewCurve(steps)
+}
+
+func (c *Curve) MaxLevel() uint64 { return uint64(len(c.steps)) }
+
+// MaxXP is the experience at which the curve ends; grants are capped there.
+func (c *Curve) MaxXP() uint64 { return c.steps[len(c.steps)-1].XP }
+
+func (c *Curve) Level(xp uint64) uint64 {
+	i := len(c.steps) - 1
+	for i > 0 && c.steps[i].XP > xp {
+		i--
+	}
+	return c.steps[i].Level
+}
+
+// Progress returns current level, XP earned within it and XP the level
+// spans (zero at max level).
+func (c *Curve) Progress(xp uint64) (level, current, span uint64) {
+	level = c.Level(xp)
+	s := c.steps[level-1]
+	if level == c.MaxLevel() {
+		return level, 0, 0
+	}
+	return level, xp - s.XP, c.steps[level].XP - s.XP
+}
+
+// Grant adds amount to xp and returns the new total (capped at MaxXP) with
+// level ups in between.
+func (c *Curve) Grant(xp, amount uint64) (uint64, []LevelUp) {
+	from := c.Level(xp)
+	x := xp + amount
+	if x < xp || x > c.MaxXP() {
+		x = c.MaxXP()
+	}
+	to := c.Level(x)
+	var a []LevelUp
+	for l := from + 1; l <= to; l++ {
+		a = append(a, LevelUp{Level: l, Reward: c.steps[l-1].Reward})
+	}
+	return x, a
+}
+
+type LevelUpFunc func(ctx context.Context, accountID uint64, e LevelUp)
+
+// SaveFunc persists the new experience total of a grant, e.g. in the
+// transaction updating the player.
+type SaveFunc func(xp uint64) error
+
+// Granter applies grants on a curve and notifies listeners (quests,
+// analytics) about each level up.
+type Granter struct {
+	curve     *Curve
+	listeners []LevelUpFunc
+}
+
+func NewGranter(c *Curve, listeners ...LevelUpFunc) (*Granter, error) {
+	if c == nil {
+		return nil, errors.New("level curve missing")
+	}
+	return &Granter{curve: c, listeners: listeners}, nil
+}
+
+func (g *Granter) Curve() *Curve { return g.curve }
+
+// Grant adds amount to xp and saves the new total; listeners are told
+// about level ups only once it is saved, a failed save grants nothing.
+func (g *Granter) Grant(
+	ctx context.Context, accountID uint64, xp, amount uint64, save SaveFunc) (
+	uint64, []LevelUp, error) {
+	if save == nil {
+		return 0, nil, errors.New("save fn missing")
+	}
+	x, a := g.curve.Grant(xp, amount)
+	if err := save(x); err != nil {
+		return xp, nil, err
+	}
+	for _, e := range a {
+		for _, fn := range g.listeners {
+			fn(ctx, accountID, e)
+		}
+	}
+	return x, a, nil
+}
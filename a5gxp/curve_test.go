@@ -0,0 +1,62 @@
+package a5gxp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestGranterGrant(t *testing.T) {
+	c, err := NewCurveJSON([]byte(`[{"level": 1, "xp": 0},
+		{"level": 2, "xp": 100, "reward": "chest"},
+		{"level": 3, "xp": 250}, {"level": 4, "xp": 500}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var notified []uint64
+	g, err := NewGranter(c, func(ctx context.Context, accountID uint64, e LevelUp) {
+		if accountID != 7 {
+			t.Errorf("unexpected account %d", accountID)
+		}
+		notified = append(notified, e.Level)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var saved uint64
+	fail := errors.New("db down")
+	failing := func(xp uint64) error { return fail }
+	x, a, err := g.Grant(context.Background(), 7, 50, 250, failing)
+	if errors.Cause(err) != fail || x != 50 || len(a) != 0 || len(notified) != 0 {
+		t.Errorf("unexpected failed grant %d %v %v, notified %v", x, a, err, notified)
+	}
+
+	save := func(xp uint64) error {
+		if len(notified) != 0 {
+			t.Error("listeners notified before the save")
+		}
+		saved = xp
+		return nil
+	}
+	x, a, err = g.Grant(context.Background(), 7, 50, 250, save)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x != 300 || saved != 300 || len(a) != 2 || a[0].Reward != "chest" {
+		t.Errorf("unexpected grant %d %v", x, a)
+	}
+	if len(notified) != 2 || notified[0] != 2 || notified[1] != 3 {
+		t.Errorf("unexpected level ups %v", notified)
+	}
+
+	// Grants are capped at the end of the curve.
+	notified = nil
+	if x, a, err = g.Grant(context.Background(), 7, 300, 1<<63, func(xp uint64) error {
+		saved = xp
+		return nil
+	}); err != nil || x != 500 || saved != 500 || len(a) != 1 || a[0].Level != 4 {
+		t.Errorf("unexpected capped grant %d %v %v", x, a, err)
+	}
+}
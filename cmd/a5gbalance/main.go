@@ -0,0 +1,80 @@
+// Command a5gbalance validates a balance data bundle and prints its diff
+// against the live one before rollout:
+//
+//	a5gbalance -live live.json -sanity sanity.json next.json
+//
+// It exits with 1 when the bundle is invalid, so release pipelines may
+// gate on it.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/armor5games/a5g/a5gbalance"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	live := flag.String("live", "", "live bundle file, none when empty or missing")
+	sanity := flag.String("sanity", "", "sanity bounds file")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: a5gbalance [flags] bundle.json")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	r, err := check(*live, *sanity, flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if *asJSON {
+		b, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		fmt.Println(string(b))
+	} else {
+		for _, s := range r.Lines() {
+			fmt.Println(s)
+		}
+	}
+	if !r.Valid {
+		os.Exit(1)
+	}
+}
+
+func check(live, sanity, name string) (*a5gbalance.Report, error) {
+	var s a5gbalance.Sanity
+	if sanity != "" {
+		b, err := ioutil.ReadFile(sanity)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(b, &s); err != nil {
+			return nil, err
+		}
+	}
+	liveFunc := func(context.Context) (*a5gbalance.Bundle, error) { return nil, nil }
+	if live != "" {
+		liveFunc = a5gbalance.FileLive(live)
+	}
+	v, err := a5gbalance.NewValidator(
+		liveFunc, s, a5glogs.NewLogrusWrapper(logrus.New()))
+	if err != nil {
+		return nil, err
+	}
+	raw, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return v.Check(context.Background(), raw)
+}
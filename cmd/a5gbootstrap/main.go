@@ -0,0 +1,145 @@
+// Command a5gbootstrap provisions a fresh environment in one go, e.g. a
+// new regional stack:
+//
+//	a5gbootstrap -dsn "$DSN" -migrations ./migrations \
+//	  -balance balance.json -balance-live /etc/game/balance.json \
+//	  -admins ops,support -health https://eu3.example.com/ready
+//
+// It migrates the database, seeds the balance bundle when there is no
+// live one, creates missing admin accounts with an API key and waits for
+// the servers to be healthy. Runs are idempotent, a failed one is fixed
+// and run again. The report printed holds the API keys of new accounts,
+// which are shown nowhere else. The migrations create the admin account
+// tables of a5gadmin.NewDBAccountStore.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/armor5games/a5g/a5gadmin"
+	"github.com/armor5games/a5g/a5gbootstrap"
+	"github.com/armor5games/a5g/a5gdb"
+	"github.com/armor5games/a5g/a5glogs"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/gocraft/dbr"
+	"github.com/sirupsen/logrus"
+)
+
+// connector serves both pools from one connection, a fresh environment
+// has no replicas yet.
+type connector struct{ *dbr.Connection }
+
+func (c connector) NewSession() *dbr.Session   { return c.Connection.NewSession(nil) }
+func (c connector) ReadPool() a5gdb.Connector  { return c }
+func (c connector) WritePool() a5gdb.Connector { return c }
+func (c connector) Validate() error            { return c.Ping() }
+
+func main() {
+	dsn := flag.String("dsn", os.Getenv("A5GBOOTSTRAP_DSN"), "MySQL DSN, none skips migrations and admins")
+	migrations := flag.String("migrations", "", "directory of *.sql migrations")
+	migrationsTable := flag.String("migrations-table", "schema_migrations", "table of applied migrations")
+	balance := flag.String("balance", "", "balance bundle to seed")
+	balanceLive := flag.String("balance-live", "", "live balance file the servers read")
+	sanity := flag.String("sanity", "", "balance sanity bounds file")
+	admins := flag.String("admins", "", "comma separated admin account names")
+	accountsTable := flag.String("admins-table", "admin_accounts", "table of admin accounts")
+	keysTable := flag.String("keys-table", "admin_api_keys", "table of admin API keys")
+	health := flag.String("health", "", "comma separated health URLs to wait for")
+	healthTimeout := flag.Duration("health-timeout", 5*time.Minute, "time to wait for health")
+	flag.Parse()
+	if flag.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "usage: a5gbootstrap [flags]")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	b, err := a5gbootstrap.NewBootstrap(l)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	b.Admins, b.HealthURLs = list(*admins), list(*health)
+	b.BalanceLive, b.HealthTimeout = *balanceLive, *healthTimeout
+	if err = configure(b, *dsn, *migrations, *migrationsTable,
+		*accountsTable, *keysTable, *balance, *sanity); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	r, err := b.Run(context.Background())
+	x, e := json.MarshalIndent(r, "", "  ")
+	if e != nil {
+		fmt.Fprintln(os.Stderr, e)
+		os.Exit(1)
+	}
+	fmt.Println(string(x))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func configure(b *a5gbootstrap.Bootstrap, dsn, migrations, migrationsTable,
+	accountsTable, keysTable, balance, sanity string) error {
+	if balance != "" {
+		raw, err := ioutil.ReadFile(balance)
+		if err != nil {
+			return err
+		}
+		b.Balance = raw
+	}
+	if sanity != "" {
+		raw, err := ioutil.ReadFile(sanity)
+		if err != nil {
+			return err
+		}
+		if err = json.Unmarshal(raw, &b.Sanity); err != nil {
+			return err
+		}
+	}
+	if dsn == "" {
+		if migrations != "" || len(b.Admins) > 0 {
+			return fmt.Errorf("migrations and admins need -dsn")
+		}
+		return nil
+	}
+	conn, err := dbr.Open("mysql", dsn, nil)
+	if err != nil {
+		return err
+	}
+	p := connector{conn}
+	if migrations != "" {
+		if b.Migrations, err = a5gbootstrap.LoadMigrations(migrations); err != nil {
+			return err
+		}
+		if b.Migrator, err = a5gbootstrap.NewMigrator(p, migrationsTable); err != nil {
+			return err
+		}
+	}
+	if len(b.Admins) > 0 {
+		s, err := a5gadmin.NewDBAccountStore(p, accountsTable, keysTable)
+		if err != nil {
+			return err
+		}
+		if b.Accounts, err = a5gadmin.NewAccounts(s, b.Logger); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func list(s string) []string {
+	var a []string
+	for _, x := range strings.Split(s, ",") {
+		if x = strings.TrimSpace(x); x != "" {
+			a = append(a, x)
+		}
+	}
+	return a
+}
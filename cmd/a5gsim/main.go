@@ -0,0 +1,106 @@
+// Command a5gsim projects the economy of a candidate balance data bundle
+// against the live one on the same player behavior, recorded
+//
+//	a5gsim -base live.json -candidate next.json -actions actions.jsonl
+//
+// or synthetic, e.g. {"players": 1000, "days": 30, "events": {...}}:
+//
+//	a5gsim -base live.json -candidate next.json -synthetic players.json
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/armor5games/a5g/a5gbalance"
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gsim"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	base := flag.String("base", "", "base bundle file, e.g. the live one")
+	candidate := flag.String("candidate", "", "candidate bundle file")
+	actions := flag.String("actions", "", "recorded actions file, a JSON object per line")
+	synthetic := flag.String("synthetic", "", "synthetic behavior file")
+	asJSON := flag.Bool("json", false, "print the comparison as JSON")
+	flag.Parse()
+	if *base == "" || *candidate == "" || (*actions == "") == (*synthetic == "") {
+		fmt.Fprintln(os.Stderr,
+			"usage: a5gsim -base FILE -candidate FILE (-actions FILE | -synthetic FILE)")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	c, err := run(*base, *candidate, *actions, *synthetic)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if !*asJSON {
+		for _, s := range c.Lines() {
+			fmt.Println(s)
+		}
+		return
+	}
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(string(b))
+}
+
+func run(base, candidate, actions, synthetic string) (*a5gsim.Comparison, error) {
+	a, err := loadActions(actions, synthetic)
+	if err != nil {
+		return nil, err
+	}
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	var results [2]*a5gsim.Result
+	for i, name := range []string{base, candidate} {
+		raw, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		b, problems := a5gbalance.Parse(raw)
+		if b == nil {
+			return nil, errors.Errorf("%s: %s", name, problems[0].Message)
+		}
+		results[i], err = a5gsim.Run(
+			context.Background(), b, a, a5glogs.NewLogrusWrapper(l))
+		if err != nil {
+			return nil, errors.Wrap(err, name)
+		}
+	}
+	return a5gsim.Compare(results[0], results[1]), nil
+}
+
+func loadActions(actions, synthetic string) ([]*a5gsim.Action, error) {
+	if actions != "" {
+		f, err := os.Open(actions)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err := f.Close(); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}()
+		return a5gsim.ReadActions(f)
+	}
+	raw, err := ioutil.ReadFile(synthetic)
+	if err != nil {
+		return nil, err
+	}
+	s := new(a5gsim.Synthetic)
+	if err = json.Unmarshal(raw, s); err != nil {
+		return nil, err
+	}
+	return s.Actions(), nil
+}
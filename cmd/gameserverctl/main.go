@@ -0,0 +1,254 @@
+// Command gameserverctl runs common ops tasks against the a5gops
+// endpoints of game server nodes:
+//
+//	gameserverctl -addr https://eu1.example.com,https://eu2.example.com maintenance on -message "back at 10:00"
+//	gameserverctl -addr https://eu1.example.com grant -id outage-1 -reason outage -currency gems -amount 50 17 42
+//	gameserverctl -addr https://eu1.example.com inspect 42
+//	gameserverctl -addr https://eu2.example.com drain [-resume]
+//	gameserverctl -addr https://eu1.example.com logs -level warn -field module=shop -f
+//
+// Maintenance, drain and logs act on every node of -addr, the others on
+// the first one. The admin session token comes from -token or
+// GAMESERVERCTL_TOKEN.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/armor5games/a5g/a5glogs"
+	"github.com/armor5games/a5g/a5gops"
+	"github.com/sirupsen/logrus"
+)
+
+type fieldsFlag map[string]string
+
+func (f fieldsFlag) String() string { return fmt.Sprint(map[string]string(f)) }
+
+func (f fieldsFlag) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return fmt.Errorf("field %q is not key=value", s)
+	}
+	f[s[:i]] = s[i+1:]
+	return nil
+}
+
+func main() {
+	addr := flag.String("addr", "", "comma separated node base URLs")
+	token := flag.String("token", os.Getenv("GAMESERVERCTL_TOKEN"), "admin session token")
+	timeout := flag.Duration("timeout", 30*time.Second, "timeout of a call")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			"usage: gameserverctl [flags] maintenance|grant|inspect|drain|logs [args]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *addr == "" || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	l := a5glogs.NewLogrusWrapper(logrus.New())
+	var clients []*a5gops.Client
+	for _, s := range strings.Split(*addr, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			clients = append(clients, a5gops.NewClient(s, *token, l))
+		}
+	}
+	cmds := map[string]func([]*a5gops.Client, time.Duration, []string) error{
+		"maintenance": maintenance,
+		"grant":       grant,
+		"inspect":     inspect,
+		"drain":       drain,
+		"logs":        logs}
+	cmd, ok := cmds[flag.Arg(0)]
+	if !ok || len(clients) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := cmd(clients, *timeout, flag.Args()[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func usage(fs *flag.FlagSet, args string) {
+	fmt.Fprintf(os.Stderr, "usage: gameserverctl %s [flags] %s\n", fs.Name(), args)
+	fs.PrintDefaults()
+	os.Exit(2)
+}
+
+func maintenance(clients []*a5gops.Client, timeout time.Duration, args []string) error {
+	fs := flag.NewFlagSet("maintenance", flag.ExitOnError)
+	message := fs.String("message", "", "message shown to players")
+	if len(args) == 0 || args[0] != "on" && args[0] != "off" {
+		usage(fs, "on|off")
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	req := &a5gops.MaintenanceRequest{On: args[0] == "on", Message: *message}
+	return each(clients, timeout, func(ctx context.Context, c *a5gops.Client) (
+		interface{}, error) {
+		return c.Maintenance(ctx, req)
+	})
+}
+
+func grant(clients []*a5gops.Client, timeout time.Duration, args []string) error {
+	fs := flag.NewFlagSet("grant", flag.ExitOnError)
+	req := new(a5gops.CompensateRequest)
+	fs.StringVar(&req.GrantID, "id", "", "grant ID, repeating a grant pays nobody twice")
+	fs.StringVar(&req.Reason, "reason", "", "reason booked in the ledger")
+	fs.StringVar(&req.Currency, "currency", "", "currency ID")
+	fs.Int64Var(&req.Amount, "amount", 0, "amount per player")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if req.GrantID == "" || req.Reason == "" || req.Currency == "" ||
+		req.Amount <= 0 || fs.NArg() == 0 {
+		usage(fs, "accountID...")
+	}
+	for _, s := range fs.Args() {
+		id, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("account ID %q: %v", s, err)
+		}
+		req.AccountIDs = append(req.AccountIDs, id)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	res, err := clients[0].Compensate(ctx, req)
+	if err != nil {
+		return err
+	}
+	if err = printJSON(res); err != nil {
+		return err
+	}
+	for _, g := range res.Grants {
+		if g.Error != "" {
+			return fmt.Errorf("grant %s failed for some players", req.GrantID)
+		}
+	}
+	return nil
+}
+
+func inspect(clients []*a5gops.Client, timeout time.Duration, args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		usage(fs, "accountID")
+	}
+	id, err := strconv.ParseUint(fs.Arg(0), 10, 64)
+	if err != nil {
+		return fmt.Errorf("account ID %q: %v", fs.Arg(0), err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	x, err := clients[0].Inspect(ctx, id)
+	if err != nil {
+		return err
+	}
+	return printJSON(x)
+}
+
+func drain(clients []*a5gops.Client, timeout time.Duration, args []string) error {
+	fs := flag.NewFlagSet("drain", flag.ExitOnError)
+	resume := fs.Bool("resume", false, "take drained nodes back into rotation")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	return each(clients, timeout, func(ctx context.Context, c *a5gops.Client) (
+		interface{}, error) {
+		return c.Drain(ctx, *resume)
+	})
+}
+
+func logs(clients []*a5gops.Client, timeout time.Duration, args []string) error {
+	fs := flag.NewFlagSet("logs", flag.ExitOnError)
+	fields := make(fieldsFlag)
+	req := &a5gops.LogsRequest{LogFilter: a5gops.LogFilter{Fields: fields}}
+	fs.StringVar(&req.Level, "level", "", "minimal level: debug, info, warn or error")
+	fs.StringVar(&req.Contains, "contains", "", "text the message contains")
+	fs.Var(fields, "field", "key=value the entry has, repeatable")
+	fs.IntVar(&req.Limit, "n", 100, "entries per node and call")
+	follow := fs.Bool("f", false, "follow new entries")
+	interval := fs.Duration("interval", time.Second, "poll interval of -f")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	after := make([]uint64, len(clients))
+	for {
+		for i, c := range clients {
+			x := *req
+			x.AfterSeq = after[i]
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			res, err := c.Logs(ctx, &x)
+			cancel()
+			if err != nil {
+				return err
+			}
+			after[i] = res.LastSeq
+			for _, e := range res.Entries {
+				printEntry(c.BaseURL, e)
+			}
+		}
+		if !*follow {
+			return nil
+		}
+		time.Sleep(*interval)
+	}
+}
+
+// each calls fn on every node and prints the answers, failing when any
+// node does.
+func each(clients []*a5gops.Client, timeout time.Duration,
+	fn func(context.Context, *a5gops.Client) (interface{}, error)) error {
+	failed := 0
+	for _, c := range clients {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		x, err := fn(ctx, c)
+		cancel()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", c.BaseURL, err)
+			failed++
+			continue
+		}
+		b, err := json.Marshal(x)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %s\n", c.BaseURL, b)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d nodes failed", failed, len(clients))
+	}
+	return nil
+}
+
+func printEntry(node string, e *a5gops.LogEntry) {
+	pairs := make([]string, 0, len(e.Fields))
+	for k, v := range e.Fields {
+		pairs = append(pairs, k+"="+strconv.Quote(v))
+	}
+	sort.Strings(pairs)
+	fmt.Printf("%s %s %-5s %s %s\n", node, e.Time.Format(time.RFC3339),
+		e.Level, e.Message, strings.Join(pairs, " "))
+}
+
+func printJSON(x interface{}) error {
+	b, err := json.MarshalIndent(x, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}